@@ -0,0 +1,99 @@
+package analyzer
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// adNetworks lists common advertising and content-recommendation networks
+var adNetworks = []thirdPartySignature{
+	{
+		name:    "Google AdSense",
+		sources: []string{"pagead2.googlesyndication.com", "googleads.g.doubleclick.net"},
+		markers: []string{"adsbygoogle"},
+	},
+	{
+		name:    "Google Ad Manager",
+		sources: []string{"securepubads.g.doubleclick.net", "www.googletagservices.com/tag/js/gpt.js"},
+		inline:  []string{"googletag.defineSlot"},
+	},
+	{
+		name:    "Prebid",
+		sources: []string{"prebid"},
+		inline:  []string{"pbjs.addAdUnits", "pbjs.que"},
+	},
+	{
+		name:    "Amazon Publisher Services",
+		sources: []string{"c.amazon-adsystem.com"},
+		inline:  []string{"apstag.init"},
+	},
+	{
+		name:    "Taboola",
+		sources: []string{"cdn.taboola.com"},
+		inline:  []string{"window._taboola"},
+	},
+	{
+		name:    "Outbrain",
+		sources: []string{"widgets.outbrain.com"},
+		markers: []string{"OUTBRAIN"},
+	},
+	{
+		name:    "Criteo",
+		sources: []string{"static.criteo.net", "bidder.criteo.com"},
+	},
+	{
+		name:    "Media.net",
+		sources: []string{"contextual.media.net"},
+	},
+}
+
+// adSlotSources are iframe sources that render an individual ad
+var adSlotSources = []string{"googlesyndication.com", "doubleclick.net", "amazon-adsystem.com", "adnxs.com"}
+
+// detectAds reports the ad networks present and approximates the number of ad slots
+func (a *Analyzer) detectAds(doc *html.Node) *AdInfo {
+	info := &AdInfo{}
+	for _, match := range matchThirdParties(doc, adNetworks) {
+		info.Networks = append(info.Networks, match.name)
+	}
+
+	traverser := NewHTMLTraverser()
+	traverser.TraverseAllElements(doc, func(n *html.Node) {
+		if isAdSlot(traverser, n) {
+			info.SlotCount++
+		}
+		// GPT slots are defined in script and rendered into placeholder divs later
+		if n.Data == "script" && traverser.GetAttributeValue(n, "src") == "" {
+			info.SlotCount += strings.Count(nodeText(n), "googletag.defineSlot(")
+		}
+	})
+
+	if len(info.Networks) == 0 && info.SlotCount == 0 {
+		return nil
+	}
+	return info
+}
+
+// isAdSlot reports whether an element is an ad placement rendered in the static markup
+func isAdSlot(traverser *HTMLTraverser, n *html.Node) bool {
+	class := " " + traverser.GetAttributeValue(n, "class") + " "
+	id := traverser.GetAttributeValue(n, "id")
+
+	switch {
+	case n.Data == "ins" && strings.Contains(class, " adsbygoogle "):
+		return true
+	case strings.Contains(class, " OUTBRAIN "):
+		return true
+	case strings.HasPrefix(id, "taboola-"):
+		return true
+	case n.Data == "iframe":
+		src := strings.ToLower(traverser.GetAttributeValue(n, "src"))
+		for _, source := range adSlotSources {
+			if strings.Contains(src, source) {
+				return true
+			}
+		}
+	}
+	return false
+}
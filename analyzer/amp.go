@@ -0,0 +1,162 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+
+	"web-page-analyzer/logger"
+)
+
+// AMP pairing issue types
+const (
+	AMPMissingCanonical       = "missing_canonical"
+	AMPCanonicalNotSelf       = "canonical_not_self"
+	AMPCounterpartUnreachable = "counterpart_unreachable"
+	AMPNotAMP                 = "not_amp"
+	AMPMissingReturnLink      = "missing_return_link"
+)
+
+// checkAMPPair verifies the link between an AMP page and its canonical page: an
+// AMP page must declare a canonical, and a canonical page's rel="amphtml" must
+// lead to an AMP page whose canonical points back. When check is set, the other
+// page of the pair is fetched to verify it resolves and links back. It returns
+// nil when the page neither is AMP nor links to an AMP version.
+func (a *Analyzer) checkAMPPair(ctx context.Context, doc *html.Node, baseURL *url.URL, finalURL string, check bool) *AMPReport {
+	isAMP := isAMPDocument(doc)
+	ampURL := linkWithRel(doc, "amphtml", baseURL)
+	if !isAMP && ampURL == "" {
+		return nil
+	}
+	report := &AMPReport{IsAMP: isAMP, Canonical: linkWithRel(doc, "canonical", baseURL), AMPURL: ampURL}
+	pageURL := baseURL.String()
+	if finalURL != "" {
+		pageURL = finalURL
+	}
+	isSelf := func(link string) bool {
+		key := sitemapKey(link)
+		return key == sitemapKey(baseURL.String()) || key == sitemapKey(pageURL)
+	}
+	addIssue := func(issueType, message string) {
+		report.Issues = append(report.Issues, AMPIssue{Type: issueType, Message: message})
+	}
+
+	// The counterpart is the other page of the pair, expected to link back to this one
+	var counterpart, backRel string
+	switch {
+	case isAMP && report.Canonical == "":
+		addIssue(AMPMissingCanonical, `AMP page has no rel="canonical" link`)
+	case isAMP && !isSelf(report.Canonical):
+		counterpart, backRel = report.Canonical, "amphtml"
+	case isAMP:
+		// A standalone AMP page is its own canonical
+	default:
+		if report.Canonical != "" && !isSelf(report.Canonical) {
+			addIssue(AMPCanonicalNotSelf, fmt.Sprintf("Page links to an AMP version but declares %s as canonical", report.Canonical))
+		}
+		counterpart, backRel = ampURL, "canonical"
+	}
+
+	if counterpart != "" && check {
+		report.Counterpart = counterpart
+		status, counterDoc, counterURL, err := a.fetchCounterpart(ctx, counterpart)
+		report.CounterpartStatus = status
+		switch {
+		case err != nil:
+			addIssue(AMPCounterpartUnreachable, fmt.Sprintf("%s could not be fetched: %v", counterpart, err))
+		case status >= http.StatusBadRequest:
+			addIssue(AMPCounterpartUnreachable, fmt.Sprintf("%s returned status %d", counterpart, status))
+		default:
+			if !isAMP && !isAMPDocument(counterDoc) {
+				addIssue(AMPNotAMP, fmt.Sprintf("%s is not an AMP page", counterpart))
+			}
+			if back := linkWithRel(counterDoc, backRel, counterURL); !isSelf(back) {
+				message := fmt.Sprintf("%s has no rel=%q link back to this page", counterpart, backRel)
+				if back != "" {
+					message = fmt.Sprintf("%s has rel=%q pointing at %s instead of this page", counterpart, backRel, back)
+				}
+				addIssue(AMPMissingReturnLink, message)
+			}
+		}
+	}
+
+	report.Consistent = len(report.Issues) == 0
+	return report
+}
+
+// isAMPDocument reports whether the <html> element carries the amp or ⚡ attribute
+func isAMPDocument(doc *html.Node) bool {
+	isAMP := false
+	NewHTMLTraverser().TraverseElements(doc, "html", func(n *html.Node) {
+		for _, attr := range n.Attr {
+			if attr.Key == "amp" || attr.Key == "⚡" {
+				isAMP = true
+			}
+		}
+	})
+	return isAMP
+}
+
+// linkWithRel returns the href of the first <link> whose rel includes rel,
+// resolved against baseURL, or "" when there is none
+func linkWithRel(doc *html.Node, rel string, baseURL *url.URL) string {
+	var href string
+	traverser := NewHTMLTraverser()
+	traverser.TraverseElements(doc, "link", func(n *html.Node) {
+		if href != "" {
+			return
+		}
+		for _, value := range strings.Fields(strings.ToLower(traverser.GetAttributeValue(n, "rel"))) {
+			if value != rel {
+				continue
+			}
+			if target, err := baseURL.Parse(strings.TrimSpace(traverser.GetAttributeValue(n, "href"))); err == nil && target.String() != "" {
+				href = target.String()
+			}
+			return
+		}
+	})
+	return href
+}
+
+// fetchCounterpart fetches the other page of an AMP pair and parses the start of
+// it, returning its status, document and the URL it was served from
+func (a *Analyzer) fetchCounterpart(ctx context.Context, target string) (int, *html.Node, *url.URL, error) {
+	fetchCtx, cancel := context.WithTimeout(ctx, AMPFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(fetchCtx, "GET", target, nil)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	setBrowserHeaders(req)
+
+	client := a.getHTTPClient()
+	defer a.putHTTPClient(client)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			logger.WithAnalysis(target).Debugw("Failed to close response body", "error", closeErr)
+		}
+	}()
+
+	body, err := readBody(resp.Body, AMPBodyLimit)
+	if err != nil {
+		return resp.StatusCode, nil, nil, err
+	}
+	defer releaseBuffer(body)
+	doc, err := html.Parse(bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return resp.StatusCode, nil, nil, err
+	}
+	return resp.StatusCode, doc, resp.Request.URL, nil
+}
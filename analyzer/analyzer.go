@@ -1,16 +1,19 @@
 package analyzer
 
 import (
+	"bytes"
 	"context"
 	"fmt"
-	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"web-page-analyzer/logger"
+	"web-page-analyzer/tracing"
 
 	"golang.org/x/net/html"
 )
@@ -21,6 +24,74 @@ type Analyzer struct {
 	timeout        time.Duration
 	circuitBreaker *CircuitBreaker
 
+	// stripTrackingParams removes tracking query parameters when building cache keys
+	stripTrackingParams bool
+
+	// threatCheckers flag known-malicious page and link destinations
+	threatCheckers []ThreatChecker
+
+	// rdapClient looks up and caches domain registration details
+	rdapClient *RDAPClient
+	// wayback finds archived captures of pages
+	wayback *WaybackClient
+	// pageSpeed queries PageSpeed Insights; nil unless an API key is configured
+	pageSpeed *PageSpeedClient
+
+	// inflight coalesces concurrent analyses of the same URL and options
+	inflight *singleFlight
+
+	// eventQueues feed every completed analysis to the registered publishers
+	eventQueues []chan queuedEvent
+
+	// notifier posts webhook notifications when its rules fire
+	notifier *Notifier
+
+	// plugins are custom checks run against every fetched page
+	plugins []AnalysisPlugin
+
+	// extractionRules populate custom_fields on every analysis
+	extractionRules []compiledRule
+
+	// blockPrivateNetworks refuses connections to non-public addresses
+	blockPrivateNetworks atomic.Bool
+
+	// botIdentity names the analyzer to target sites; nil sends a browser User-Agent
+	botIdentity atomic.Pointer[BotIdentity]
+	// optOuts caches the robots.txt files checked for opt-outs of the named bot
+	optOuts *optOutCache
+
+	// sharedStore, when set, shares rate limits and breaker state between replicas
+	sharedStore SharedStore
+
+	// hostLimiter caps outbound requests per target host; nil means unlimited
+	hostLimiter atomic.Pointer[hostRateLimiter]
+
+	// throttle tracks hosts answering 429 and how long to hold requests to them
+	throttle *throttleTracker
+	// reputation tracks link check outcomes per host across analyses
+	reputation *reputationTracker
+
+	// workerConfig sizes link-check worker pools; workerCounters aggregates their state
+	workerConfig   atomic.Pointer[WorkerPoolConfig]
+	workerCounters *workerPoolCounters
+
+	// maxOutboundRequests and maxOutboundTime bound each analysis; zero is unlimited
+	maxOutboundRequests int
+	maxOutboundTime     time.Duration
+
+	// maxBodySize is the largest page body read for analysis
+	maxBodySize int64
+
+	// linkCheckDeadline bounds the link checks of an analysis that has no
+	// earlier deadline of its own
+	linkCheckDeadline time.Duration
+
+	// snippetThresholds judge the title and meta description lengths
+	snippetThresholds SnippetThresholds
+
+	// priorities hold batch link checks back while interactive analyses run
+	priorities *priorityGate
+
 	// Modular components
 	cacheManager   *CacheManager
 	metricsManager *MetricsManager
@@ -29,8 +100,18 @@ type Analyzer struct {
 
 // NewAnalyzer creates a new analyzer instance with optimized settings
 func NewAnalyzer(timeout time.Duration) *Analyzer {
+	analyzer := &Analyzer{}
+
+	// Dialer enforcing the network policy on every resolved address
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   analyzer.dialControl,
+	}
+
 	// Create optimized transport for faster link checking
 	transport := &http.Transport{
+		DialContext:           dialer.DialContext,
 		MaxIdleConns:          100,
 		MaxIdleConnsPerHost:   20,               // Increased for better parallel link checking
 		IdleConnTimeout:       30 * time.Second, // Reduced for faster cleanup
@@ -44,10 +125,13 @@ func NewAnalyzer(timeout time.Duration) *Analyzer {
 		ResponseHeaderTimeout: LinkCheckTimeout, // Fast response header timeout
 	}
 
+	// Every request to a target site passes the per-host rate limit
+	throttled := &throttledTransport{next: transport, analyzer: analyzer}
+
 	// Create HTTP client with optimized transport
 	httpClient := &http.Client{
 		Timeout:   timeout,
-		Transport: transport,
+		Transport: throttled,
 	}
 
 	// Create HTTP client pool for concurrent operations
@@ -55,19 +139,35 @@ func NewAnalyzer(timeout time.Duration) *Analyzer {
 		New: func() interface{} {
 			return &http.Client{
 				Timeout:   timeout,
-				Transport: transport,
+				Transport: throttled,
 			}
 		},
 	}
 
-	analyzer := &Analyzer{
-		httpClient:     httpClient,
-		timeout:        timeout,
-		circuitBreaker: NewCircuitBreaker(DefaultFailureThreshold, CircuitBreakerTimeout, DefaultSuccessThreshold),
-		httpClientPool: httpClientPool,
-		cacheManager:   NewCacheManager(CacheDefaultTTL),
-		metricsManager: NewMetricsManager(),
-	}
+	analyzer.httpClient = httpClient
+	analyzer.timeout = timeout
+	analyzer.maxBodySize = DefaultMaxBodySize
+	analyzer.linkCheckDeadline = DefaultLinkCheckDeadline
+	analyzer.circuitBreaker = NewCircuitBreaker(DefaultFailureThreshold, CircuitBreakerTimeout, DefaultSuccessThreshold)
+	analyzer.httpClientPool = httpClientPool
+	analyzer.cacheManager = NewCacheManager(CacheDefaultTTL)
+	analyzer.priorities = newPriorityGate()
+	analyzer.metricsManager = NewMetricsManager()
+	analyzer.metricsManager.cache = analyzer.cacheManager
+	analyzer.metricsManager.breaker = analyzer.circuitBreaker
+	analyzer.throttle = newThrottleTracker(DefaultRetryAfterBudget)
+	analyzer.metricsManager.throttle = analyzer.throttle
+	analyzer.reputation = newReputationTracker()
+	analyzer.SetWorkerPoolConfig(DefaultWorkerPoolConfig())
+	analyzer.SetSnippetThresholds(DefaultSnippetThresholds())
+	analyzer.workerCounters = &workerPoolCounters{}
+	analyzer.metricsManager.workers = analyzer.workerCounters
+	analyzer.metricsManager.workerConfig = &analyzer.workerConfig
+	analyzer.rdapClient = NewRDAPClient(RDAPEndpoint)
+	analyzer.wayback = NewWaybackClient(WaybackAvailabilityEndpoint, WaybackArchiveEndpoint)
+	analyzer.inflight = newSingleFlight()
+	analyzer.optOuts = newOptOutCache()
+	analyzer.plugins = registered()
 
 	return analyzer
 }
@@ -77,6 +177,40 @@ func (a *Analyzer) SetCacheVerbose(verbose bool) {
 	a.cacheManager.SetVerbose(verbose)
 }
 
+// SetMaxBodySize sets the largest page body read for analysis; larger pages fail
+// with ErrCodeContentTooLarge. Zero or less restores DefaultMaxBodySize.
+func (a *Analyzer) SetMaxBodySize(size int64) {
+	if size <= 0 {
+		size = DefaultMaxBodySize
+	}
+	a.maxBodySize = size
+}
+
+// SetLinkCheckDeadline sets how long an analysis may spend checking links when
+// its context allows longer; links left unchecked are counted in UncheckedLinks.
+// Zero or less restores DefaultLinkCheckDeadline.
+func (a *Analyzer) SetLinkCheckDeadline(d time.Duration) {
+	if d <= 0 {
+		d = DefaultLinkCheckDeadline
+	}
+	a.linkCheckDeadline = d
+}
+
+// SetNegativeCacheTTL sets how long failed analyses are cached; zero disables caching failures
+func (a *Analyzer) SetNegativeCacheTTL(ttl time.Duration) {
+	a.cacheManager.SetNegativeTTL(ttl)
+}
+
+// SetUncachedErrorCodes sets error codes (e.g. ErrCodeTimeoutError) whose results are never cached
+func (a *Analyzer) SetUncachedErrorCodes(codes ...string) {
+	a.cacheManager.SetUncachedErrorCodes(codes...)
+}
+
+// SetStripTrackingParams enables or disables tracking-parameter stripping in cache keys
+func (a *Analyzer) SetStripTrackingParams(strip bool) {
+	a.stripTrackingParams = strip
+}
+
 // GetMetrics returns current performance metrics
 func (a *Analyzer) GetMetrics() MetricsManager {
 	return a.metricsManager.GetMetrics()
@@ -87,21 +221,41 @@ func (a *Analyzer) AnalyzeURL(targetURL string) *AnalysisResult {
 	return a.AnalyzeURLWithContext(context.Background(), targetURL)
 }
 
-// AnalyzeURLWithContext analyzes a URL with context support
+// AnalyzeURLWithContext analyzes a URL with context support; like every
+// analysis it is traced as an AnalyzeURL span
 func (a *Analyzer) AnalyzeURLWithContext(ctx context.Context, targetURL string) *AnalysisResult {
+	return a.AnalyzeURLWithOptions(ctx, targetURL, AnalysisOptions{})
+}
+
+// AnalyzeURLWithOptions analyzes a URL with context support and optional analysis features
+func (a *Analyzer) AnalyzeURLWithOptions(ctx context.Context, targetURL string, opts AnalysisOptions) *AnalysisResult {
+	ctx, span := tracing.Start(ctx, "AnalyzeURL", tracing.KindInternal,
+		tracing.String("url.full", targetURL),
+		tracing.String("analysis.priority", opts.Priority.String()),
+	)
+	defer span.End()
+	ctx = withPriority(ctx, opts.Priority)
+
+	result := a.analyzeURL(ctx, targetURL, opts)
+	span.SetAttributes(
+		tracing.Bool("analysis.cache_hit", result.CacheHit),
+		tracing.Bool("analysis.coalesced", result.Coalesced),
+	)
+	if result.Error != nil {
+		span.SetError(result.Error.Code + ": " + result.Error.Message)
+	}
+	return result
+}
+
+// analyzeURL serves an analysis from the cache, a concurrent analysis of the
+// same page, or a new one
+func (a *Analyzer) analyzeURL(ctx context.Context, targetURL string, opts AnalysisOptions) *AnalysisResult {
 	startTime := time.Now()
 
 	// Track active requests
 	a.metricsManager.incrementActiveRequests()
 	defer a.metricsManager.decrementActiveRequests()
 
-	// Check cache first
-	if cachedResult, found := a.cacheManager.Get(targetURL); found {
-		a.metricsManager.RecordCacheHit()
-		return cachedResult
-	}
-	a.metricsManager.RecordCacheMiss()
-
 	// Create result
 	result := &AnalysisResult{
 		URL:           targetURL,
@@ -113,35 +267,149 @@ func (a *Analyzer) AnalyzeURLWithContext(ctx context.Context, targetURL string)
 	if err != nil {
 		result.Error = NewAnalysisError(ErrCodeInvalidURL, "Invalid URL format").WithDetails(err.Error())
 		a.updateMetrics(startTime)
+		a.metricsManager.recordFailure()
 		return result
 	}
 
+	// Equivalent spellings of a URL share a cache entry; results differ per
+	// option set, so options are part of the cache key
+	result.NormalizedURL = CanonicalizeURL(parsedURL, a.stripTrackingParams)
+	result.HostASCII = parsedURL.Hostname()
+	result.HostUnicode = HostToUnicode(result.HostASCII)
+	cacheKey := a.cacheKeyFor(parsedURL, opts)
+
+	// Check cache first
+	if !opts.BypassCache {
+		if cachedResult, found := a.cacheManager.Get(cacheKey); found {
+			a.metricsManager.RecordCacheHit()
+			// Echo this caller's input rather than whichever spelling populated the cache
+			hit := *cachedResult
+			hit.URL = targetURL
+			hit.CacheHit = true
+			return &hit
+		}
+		a.metricsManager.RecordCacheMiss()
+	}
+
+	// Concurrent requests for the same page and options share one analysis
+	shared, coalesced, err := a.inflight.Do(ctx, cacheKey, a.timeout, func(flightCtx context.Context) *AnalysisResult {
+		return a.runAnalysis(flightCtx, targetURL, parsedURL, result, opts, cacheKey, startTime)
+	})
+	a.updateMetrics(startTime)
+	if err != nil || shared.Error != nil {
+		a.metricsManager.recordFailure()
+	}
+
+	if err != nil {
+		// This caller gave up before the shared analysis finished; the result
+		// is still being filled in for the others, so report on a fresh one
+		return &AnalysisResult{
+			URL:           targetURL,
+			NormalizedURL: result.NormalizedURL,
+			HeadingCounts: make(map[string]int),
+			Error:         ClassifyFetchError(parsedURL.String(), err),
+		}
+	}
+	if !coalesced {
+		return shared
+	}
+
+	// Echo this caller's input rather than the spelling that started the analysis
+	joined := *shared
+	joined.URL = targetURL
+	joined.Coalesced = true
+	return &joined
+}
+
+// runAnalysis fetches and analyzes a page that was not found in the cache
+func (a *Analyzer) runAnalysis(ctx context.Context, targetURL string, parsedURL *url.URL, result *AnalysisResult, opts AnalysisOptions, cacheKey string, startTime time.Time) *AnalysisResult {
 	// Check circuit breaker
 	if !a.circuitBreaker.CanExecute() {
-		result.Error = NewAnalysisError(ErrCodeInternalError, "Service temporarily unavailable")
-		a.updateMetrics(startTime)
+		result.Error = NewCircuitOpenError(a.circuitBreaker.RetryAfter())
 		return result
 	}
 
-	// Execute analysis with circuit breaker
-	err = a.circuitBreaker.Execute(func() error {
-		return a.performAnalysis(ctx, parsedURL, result)
-	})
+	var err error
 
-	if err != nil {
-		if result.Error == nil {
-			result.Error = NewAnalysisError(ErrCodeInternalError, "Analysis failed").WithCause(err)
+	// Batch link checks yield to this analysis while it runs
+	defer a.priorities.enter(opts.Priority)()
+
+	// Every outbound request made for this analysis is charged to its budget,
+	// and the time spent in each phase is recorded
+	budget := a.newOutboundBudget()
+	ctx = withOutboundBudget(ctx, budget)
+	timer := &phaseTimer{}
+	ctx = withPhaseTimer(ctx, timer)
+
+	// PageSpeed Insights takes many seconds, so it is queried while the page is analyzed
+	var pageSpeed chan *PageSpeedReport
+	if opts.PageSpeed && a.pageSpeed != nil {
+		pageSpeed = make(chan *PageSpeedReport, 1)
+		go func() { pageSpeed <- a.pageSpeed.Lookup(ctx, parsedURL.String()) }()
+	}
+
+	// Execute analysis, unless the site opted out of the bot
+	if err = a.checkOptOut(ctx, parsedURL); err == nil {
+		switch {
+		case opts.QuickCheck:
+			err = a.performQuickCheck(ctx, parsedURL, result)
+		case !opts.ArchiveDate.IsZero():
+			err = a.performArchivedAnalysis(ctx, parsedURL, result, opts)
+		default:
+			err = a.performAnalysis(ctx, parsedURL, result, opts)
 		}
-		a.circuitBreaker.OnFailure()
-	} else {
+	}
+
+	// Only infrastructure-level failures count against the circuit breaker;
+	// problems with the user-supplied target must not block everyone else
+	switch {
+	case err == nil:
 		a.circuitBreaker.OnSuccess()
+	case IsInfrastructureError(err):
+		a.circuitBreaker.OnFailure()
+	}
+	if err != nil && result.Error == nil {
+		result.Error = ClassifyFetchError(parsedURL.String(), err)
 	}
 
+	// Fetches refuse deprecated protocols and untrusted certificates, so a
+	// failed handshake is repeated leniently to report what the server offers
+	if result.Error != nil && result.Error.Code == ErrCodeTLSError && result.TLS == nil && opts.ArchiveDate.IsZero() {
+		result.TLS = a.inspectTLS(ctx, failedTLSURL(err, parsedURL))
+	}
+
+	// Compare scheme and host variants when requested
+	if opts.CompareVariants && result.Error == nil {
+		result.Variants = a.compareVariants(ctx, parsedURL)
+	}
+
+	// Look up domain registration details when requested
+	if opts.LookupDomain && result.Error == nil {
+		result.Domain = a.rdapClient.Lookup(ctx, parsedURL.Hostname())
+	}
+	if pageSpeed != nil && result.Error == nil {
+		result.PageSpeed = <-pageSpeed
+	}
+	result.Outbound = budget.usage()
+
 	// Cache the result
-	a.cacheManager.Set(targetURL, result)
+	result.AnalysisDurationMs = time.Since(startTime).Milliseconds()
+	result.Timings = timer.timings(time.Since(startTime))
+	a.metricsManager.recordCost(result.Outbound, result.Timings)
+	recordCost(ctx, result.Outbound)
+	// An analysis every caller abandoned is incomplete, so it is neither cached nor announced
+	if ctx.Err() != context.Canceled {
+		a.cacheManager.Set(cacheKey, result)
+		a.publishEvent(result)
+		if a.notifier != nil {
+			a.notifier.notify(result)
+		}
+	}
 
-	// Update metrics
-	a.updateMetrics(startTime)
+	// Persist what the link checks learned about their hosts
+	if err := a.reputation.save(false); err != nil {
+		logger.WithAnalysis(parsedURL.String()).Warnw("Failed to save host reputation", "error", err)
+	}
 
 	// Log completion
 	logger.WithAnalysis(targetURL).Infow("Analysis completed",
@@ -158,10 +426,17 @@ func (a *Analyzer) AnalyzeURLWithContext(ctx context.Context, targetURL string)
 	return result
 }
 
+// NormalizeURL validates a URL the way analyses do, adding a missing scheme and
+// converting internationalized hosts to punycode
+func (a *Analyzer) NormalizeURL(targetURL string) (*url.URL, error) {
+	return a.normalizeURL(targetURL)
+}
+
 // normalizeURL validates and normalizes the input URL
 func (a *Analyzer) normalizeURL(targetURL string) (*url.URL, error) {
-	// Add scheme if missing
-	if !strings.HasPrefix(targetURL, "http://") && !strings.HasPrefix(targetURL, "https://") {
+	// Add scheme if missing (schemes are case-insensitive)
+	lowerURL := strings.ToLower(targetURL)
+	if !strings.HasPrefix(lowerURL, "http://") && !strings.HasPrefix(lowerURL, "https://") {
 		targetURL = "https://" + targetURL
 	}
 
@@ -176,36 +451,56 @@ func (a *Analyzer) normalizeURL(targetURL string) (*url.URL, error) {
 		return nil, &url.Error{Op: "parse", URL: targetURL, Err: &url.Error{Op: "scheme", URL: targetURL, Err: &url.Error{Op: "unsupported", URL: targetURL}}}
 	}
 
+	// Convert internationalized domain names to punycode so they can be
+	// resolved and cached under a single spelling
+	asciiHost, err := HostToASCII(parsedURL.Hostname())
+	if err != nil {
+		return nil, &url.Error{Op: "idna", URL: targetURL, Err: err}
+	}
+	if port := parsedURL.Port(); port != "" {
+		parsedURL.Host = net.JoinHostPort(asciiHost, port)
+	} else if strings.Contains(asciiHost, ":") {
+		parsedURL.Host = "[" + asciiHost + "]"
+	} else {
+		parsedURL.Host = asciiHost
+	}
+
 	return parsedURL, nil
 }
 
 // performAnalysis performs the actual web page analysis
-func (a *Analyzer) performAnalysis(ctx context.Context, parsedURL *url.URL, result *AnalysisResult) error {
+func (a *Analyzer) performAnalysis(ctx context.Context, parsedURL *url.URL, result *AnalysisResult, opts AnalysisOptions) error {
+	ctx, span := tracing.Start(ctx, "performAnalysis", tracing.KindInternal, tracing.String("url.full", parsedURL.String()))
+	defer span.End()
+
+	// The fetch span covers the request and reading the body; it is ended
+	// explicitly once the body is read, or by the defer on earlier returns
+	fetchCtx, fetchSpan := tracing.Start(ctx, "fetch", tracing.KindClient,
+		tracing.String("http.request.method", http.MethodGet),
+		tracing.String("url.full", parsedURL.String()),
+	)
+	defer fetchSpan.End()
+
 	// Create HTTP request with context
-	req, err := http.NewRequestWithContext(ctx, "GET", parsedURL.String(), nil)
+	req, err := http.NewRequestWithContext(fetchCtx, "GET", parsedURL.String(), nil)
 	if err != nil {
 		return err
 	}
 
 	// Set headers to mimic a real browser (but avoid compression)
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7")
-	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
-	req.Header.Set("Accept-Encoding", "identity") // Avoid compression for simplicity
-	req.Header.Set("Connection", "keep-alive")
-	req.Header.Set("Upgrade-Insecure-Requests", "1")
-	req.Header.Set("Sec-Fetch-Dest", "document")
-	req.Header.Set("Sec-Fetch-Mode", "navigate")
-	req.Header.Set("Sec-Fetch-Site", "none")
-	req.Header.Set("Cache-Control", "max-age=0")
+	setBrowserHeaders(req)
 
 	// Get HTTP client from pool
 	client := a.httpClientPool.Get().(*http.Client)
 	defer a.httpClientPool.Put(client)
 
 	// Make request
+	stopFetch := timePhase(ctx, phaseFetch)
+	defer stopFetch()
+	result.FetchedAt = time.Now().UTC()
 	resp, err := client.Do(req)
 	if err != nil {
+		fetchSpan.SetError(err.Error())
 		return err
 	}
 	defer func() {
@@ -213,6 +508,12 @@ func (a *Analyzer) performAnalysis(ctx context.Context, parsedURL *url.URL, resu
 			logger.WithAnalysis(parsedURL.String()).Warnw("Failed to close response body", "error", closeErr)
 		}
 	}()
+	fetchSpan.SetAttributes(tracing.Int("http.response.status_code", resp.StatusCode))
+	result.FinalURL = resp.Request.URL.String()
+	result.TLS = tlsInfo(resp.TLS)
+	if opts.IncludeHeaders {
+		captureHeaders(resp, result)
+	}
 
 	// Debug: Log response headers
 	logger.WithAnalysis(parsedURL.String()).Infow("HTTP response received",
@@ -223,37 +524,179 @@ func (a *Analyzer) performAnalysis(ctx context.Context, parsedURL *url.URL, resu
 	)
 
 	// Check response status
+	result.StatusCode = resp.StatusCode
+	reportProgress(ctx, Progress{Stage: ProgressFetched, StatusCode: resp.StatusCode, FinalURL: resp.Request.URL.String()})
+
+	// Assertions are evaluated on every return path, so status and header
+	// checks still apply to error responses
+	var doc *html.Node
+	var source string
+	if len(opts.Assertions) > 0 {
+		defer func() {
+			result.Assertions = evaluateAssertions(opts.Assertions, resp, doc, source)
+		}()
+	}
+
 	if resp.StatusCode >= 400 {
-		result.StatusCode = resp.StatusCode
+		// A 503 may be a maintenance page rather than a genuine failure
+		if resp.StatusCode == http.StatusServiceUnavailable {
+			var errDoc *html.Node
+			if errBody, readErr := readBody(resp.Body, MaintenanceBodyLimit); readErr == nil {
+				errDoc, _ = html.Parse(bytes.NewReader(errBody.Bytes()))
+				releaseBuffer(errBody)
+			}
+			if maintenance := a.detectMaintenancePage(resp.StatusCode, resp.Header, errDoc); maintenance != nil {
+				result.Maintenance = maintenance
+				result.Error = NewMaintenanceError(parsedURL.String(), maintenance).WithStatusCode(resp.StatusCode)
+				return nil
+			}
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests {
+			result.Error = NewRateLimitedError(parsedURL.String(), resp.StatusCode, resp.Header.Get("Retry-After"))
+			return nil
+		}
+
 		result.Error = NewAnalysisError(ErrCodeHTTPError, "HTTP request failed").WithStatusCode(resp.StatusCode)
 		return nil
 	}
 
-	// Read response body
-	body, err := io.ReadAll(resp.Body)
+	// Read response body, refusing pages larger than the configured limit. A
+	// declared length over it is refused before reading; otherwise at most one
+	// byte past the limit is read, so an endless body cannot exhaust memory.
+	tooLarge := &contentTooLargeError{limit: a.maxBodySize}
+	if resp.ContentLength > a.maxBodySize {
+		fetchSpan.SetError(tooLarge.Error())
+		return tooLarge
+	}
+	body, err := readBody(resp.Body, a.maxBodySize+1)
 	if err != nil {
+		fetchSpan.SetError(err.Error())
 		return err
 	}
+	defer releaseBuffer(body)
+	if int64(body.Len()) > a.maxBodySize {
+		fetchSpan.SetError(tooLarge.Error())
+		return tooLarge
+	}
+	result.ContentLength = int64(body.Len())
+	if opts.SnapshotLimit > 0 {
+		html := body.Bytes()
+		snapshot := &HTMLSnapshot{Header: resp.Header.Clone(), Truncated: int64(len(html)) > opts.SnapshotLimit}
+		if snapshot.Truncated {
+			html = html[:opts.SnapshotLimit]
+		}
+		// The body buffer is pooled, so the snapshot needs its own copy
+		snapshot.HTML = append([]byte(nil), html...)
+		result.Snapshot = snapshot
+	}
+	fetchSpan.SetAttributes(tracing.Int("http.response.body.size", body.Len()))
+	fetchSpan.End()
+	stopFetch()
 
 	// Parse HTML
-	doc, err := html.Parse(strings.NewReader(string(body)))
+	_, parseSpan := tracing.Start(ctx, "parse", tracing.KindInternal)
+	stopParse := timePhase(ctx, phaseParse)
+	doc, err = html.Parse(bytes.NewReader(body.Bytes()))
+	stopParse()
+	parseSpan.End()
 	if err != nil {
-		logger.WithAnalysis(parsedURL.String()).Errorw("HTML parsing failed", "error", err, "body_length", len(body))
+		logger.WithAnalysis(parsedURL.String()).Errorw("HTML parsing failed", "error", err, "body_length", body.Len())
 		return err
 	}
 
 	// Check if parsing succeeded
 	if doc == nil {
-		logger.WithAnalysis(parsedURL.String()).Errorw("HTML parsing returned nil document", "body_length", len(body))
+		logger.WithAnalysis(parsedURL.String()).Errorw("HTML parsing returned nil document", "body_length", body.Len())
 		return fmt.Errorf("HTML parsing returned nil document")
 	}
+	source = body.String()
+	reportProgress(ctx, Progress{Stage: ProgressParsed, ContentLength: result.ContentLength})
 
-	// Analyze document
-	a.analyzeDocumentWithContext(ctx, doc, result, parsedURL, string(body))
+	// Holding pages served with a success status would produce misleading content analysis
+	if a.reportMaintenancePage(parsedURL, resp, doc, result) {
+		return nil
+	}
+
+	result.HTTPSReadiness = a.checkHTTPSReadiness(ctx, parsedURL, resp)
+
+	// Identify the CDN serving the final URL
+	result.CDN = a.detectCDN(ctx, resp.Request.URL.Hostname(), resp.Header)
+
+	a.analyzeContent(ctx, parsedURL, resp, doc, source, result, opts)
+
+	// Cross-check indexing directives with robots.txt and the sitemap when requested
+	if opts.CheckRobots {
+		result.Robots = a.checkRobotsConsistency(ctx, parsedURL, resp, doc)
+	}
+
+	// Run custom checks
+	a.runPlugins(ctx, doc, resp, result)
 
 	return nil
 }
 
+// reportMaintenancePage reports the page as a holding page when it is one,
+// returning whether it did; maintenance phrases on other pages are only recorded
+func (a *Analyzer) reportMaintenancePage(parsedURL *url.URL, resp *http.Response, doc *html.Node, result *AnalysisResult) bool {
+	maintenance := a.detectMaintenancePage(resp.StatusCode, resp.Header, doc)
+	if maintenance == nil {
+		return false
+	}
+	if !maintenance.HoldingPage {
+		// Maintenance phrases on a regular page are reported, not treated as a failure
+		result.Maintenance = maintenance
+		return false
+	}
+	result.StatusCode = resp.StatusCode
+	result.PageTitle, result.TitleCount = a.extractPageTitle(doc)
+	result.Maintenance = maintenance
+	result.Error = NewMaintenanceError(parsedURL.String(), maintenance).WithStatusCode(resp.StatusCode)
+	return true
+}
+
+// analyzeContent runs the checks made on a parsed page and its response
+// headers, for fetched and stored pages alike
+func (a *Analyzer) analyzeContent(ctx context.Context, parsedURL *url.URL, resp *http.Response, doc *html.Node, source string, result *AnalysisResult, opts AnalysisOptions) {
+	// Analyze response security policies
+	result.CSP = a.analyzeCSP(resp.Header, doc)
+	result.InlineScripts = a.findInlineScripts(doc)
+
+	// Analyze document
+	a.analyzeDocumentWithContext(ctx, doc, result, parsedURL, source, opts)
+
+	// Indexing directives are cheap to read, so they are reported for every page
+	result.Noindex = hasNoindex(metaRobotsDirectives(doc)) || hasNoindex(xRobotsTagDirectives(resp.Header))
+}
+
+// setBrowserHeaders sets request headers that mimic a real browser navigation
+func setBrowserHeaders(req *http.Request) {
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7")
+	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
+	req.Header.Set("Accept-Encoding", AcceptEncoding) // Decoded by the transport
+	req.Header.Set("Connection", "keep-alive")
+	req.Header.Set("Upgrade-Insecure-Requests", "1")
+	req.Header.Set("Sec-Fetch-Dest", "document")
+	req.Header.Set("Sec-Fetch-Mode", "navigate")
+	req.Header.Set("Sec-Fetch-Site", "none")
+	req.Header.Set("Cache-Control", "max-age=0")
+}
+
+// reportedRequestHeaders are the request headers echoed back when headers are included
+var reportedRequestHeaders = []string{"User-Agent", "Accept", "Accept-Language", "Accept-Encoding"}
+
+// captureHeaders records the full response headers and the identifying request headers
+func captureHeaders(resp *http.Response, result *AnalysisResult) {
+	result.ResponseHeaders = resp.Header.Clone()
+	result.RequestHeaders = make(map[string][]string)
+	for _, name := range reportedRequestHeaders {
+		if values := resp.Request.Header.Values(name); len(values) > 0 {
+			result.RequestHeaders[name] = values
+		}
+	}
+}
+
 // updateMetrics updates performance metrics
 func (a *Analyzer) updateMetrics(startTime time.Time) {
 	duration := time.Since(startTime)
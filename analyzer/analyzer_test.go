@@ -1,14 +1,42 @@
 package analyzer
 
 import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
+	"web-page-analyzer/tracing"
+
+	"github.com/andybalholm/brotli"
 	"golang.org/x/net/html"
 )
 
@@ -73,9 +101,9 @@ func TestAnalyzeURL_InvalidURL(t *testing.T) {
 		t.Fatal("Expected error for invalid URL")
 	}
 
-	// The URL gets normalized and fails at network level, so it's INTERNAL_ERROR
-	if result.Error.Code != ErrCodeInternalError {
-		t.Errorf("Expected error code %s, got %s", ErrCodeInternalError, result.Error.Code)
+	// The URL gets normalized to https://invalid-url, so host resolution fails
+	if result.Error.Code != ErrCodeDNSError {
+		t.Errorf("Expected error code %s, got %s", ErrCodeDNSError, result.Error.Code)
 	}
 
 	if result.URL != "invalid-url" {
@@ -322,7 +350,7 @@ func TestAnalyzeLinks(t *testing.T) {
 		"mailto:test@example.com", // should be ignored
 	}
 
-	analyzer.analyzeLinksConcurrent(links, baseURL, result)
+	analyzer.analyzeLinksConcurrent(context.Background(), links, baseURL, result)
 
 	// Should count /good and /bad as internal links
 	// Should count https://external.com as external (but will be inaccessible in test)
@@ -375,11 +403,16 @@ func TestCacheManager(t *testing.T) {
 	// Test cache expiration
 	time.Sleep(150 * time.Millisecond)
 	if _, found := cache.Get("test.com"); found {
-		t.Error("Expected expired cache entry to be removed")
+		t.Error("Expected expired cache entry not to be served")
 	}
 
-	// Test cache stats
-	total, _ := cache.GetStats()
+	// Expired entries remain until the write path or cleanup removes them
+	total, expired := cache.GetStats()
+	if total != 1 || expired != 1 {
+		t.Errorf("Expected 1 expired entry, got %d total and %d expired", total, expired)
+	}
+	cache.clearExpired()
+	total, _ = cache.GetStats()
 	if total != 0 {
 		t.Errorf("Expected 0 total entries, got %d", total)
 	}
@@ -422,12 +455,28 @@ func TestMetricsManager(t *testing.T) {
 		t.Errorf("Expected 1 total request, got %d", finalMetrics.TotalRequests)
 	}
 
+	// Error rate and latency percentiles
+	metrics.recordFailure()
+	for i := 1; i <= 19; i++ {
+		metrics.updateMetrics(time.Duration(i*100) * time.Millisecond)
+	}
+	finalMetrics = metrics.GetMetrics()
+	if finalMetrics.FailedRequests != 1 || finalMetrics.ErrorRate() != 0.05 {
+		t.Errorf("Expected 1 failure and a 5%% error rate, got %d and %v", finalMetrics.FailedRequests, finalMetrics.ErrorRate())
+	}
+	if finalMetrics.LatencyP50 != 900*time.Millisecond || finalMetrics.LatencyP95 != 1800*time.Millisecond {
+		t.Errorf("Expected p50 900ms and p95 1.8s, got %v and %v", finalMetrics.LatencyP50, finalMetrics.LatencyP95)
+	}
+
 	// Test reset
 	metrics.Reset()
 	resetMetrics := metrics.GetMetrics()
 	if resetMetrics.TotalRequests != 0 {
 		t.Error("Expected reset total requests to be 0")
 	}
+	if resetMetrics.FailedRequests != 0 || resetMetrics.LatencyP95 != 0 {
+		t.Error("Expected reset failures and latency percentiles to be 0")
+	}
 }
 
 func TestCircuitBreaker(t *testing.T) {
@@ -586,3 +635,4991 @@ func TestAnalyzerMethods(t *testing.T) {
 	// Test Stop method
 	analyzer.Stop()
 }
+
+func TestAnalyzeURL_MaintenancePage(t *testing.T) {
+	testCases := []struct {
+		name       string
+		status     int
+		retryAfter string
+		body       string
+		expected   bool
+		// reported marks regular pages whose maintenance phrases are only recorded
+		reported bool
+	}{
+		{
+			name:       "503 with Retry-After",
+			status:     http.StatusServiceUnavailable,
+			retryAfter: "120",
+			body:       "<html><body>Unavailable</body></html>",
+			expected:   true,
+		},
+		{
+			name:     "503 with maintenance template",
+			status:   http.StatusServiceUnavailable,
+			body:     "<html><head><title>Down for maintenance</title></head><body></body></html>",
+			expected: true,
+		},
+		{
+			name:     "200 holding page",
+			status:   http.StatusOK,
+			body:     "<!DOCTYPE html><html><body><h1>We'll be back soon!</h1></body></html>",
+			expected: true,
+		},
+		{
+			name:     "Bare 503",
+			status:   http.StatusServiceUnavailable,
+			body:     "<html><body>Error</body></html>",
+			expected: false,
+		},
+		{
+			name:     "Regular page mentioning maintenance",
+			status:   http.StatusOK,
+			body:     "<!DOCTYPE html><html><head><title>Blog</title></head><body><p>We'll be back with more posts under maintenance topics.</p></body></html>",
+			expected: false,
+		},
+		{
+			name:     "200 with maintenance title and heading",
+			status:   http.StatusOK,
+			body:     "<!DOCTYPE html><html><head><title>Scheduled maintenance</title></head><body><h1>Down for maintenance</h1><p>" + strings.Repeat("Release notes, guides and product updates. ", 20) + "</p></body></html>",
+			expected: true,
+		},
+		{
+			name:       "200 with Retry-After and maintenance heading",
+			status:     http.StatusOK,
+			retryAfter: "3600",
+			body:       "<!DOCTYPE html><html><body><h1>Down for maintenance</h1><p>" + strings.Repeat("Release notes, guides and product updates. ", 20) + "</p></body></html>",
+			expected:   true,
+		},
+		{
+			name:     "Regular page with a coming soon heading",
+			status:   http.StatusOK,
+			body:     "<!DOCTYPE html><html><head><title>Blog</title></head><body><h2>New features coming soon</h2><p>" + strings.Repeat("Release notes, guides and product updates. ", 20) + "</p></body></html>",
+			reported: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.retryAfter != "" {
+					w.Header().Set("Retry-After", tc.retryAfter)
+				}
+				w.Header().Set("Content-Type", "text/html")
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+
+			analyzer := NewAnalyzer(5 * time.Second)
+			result := analyzer.AnalyzeURL(server.URL)
+
+			if tc.expected {
+				if result.Maintenance == nil {
+					t.Fatal("Expected maintenance page to be detected")
+				}
+				if result.Error == nil || result.Error.Code != ErrCodeMaintenance {
+					t.Errorf("Expected error code %s, got %v", ErrCodeMaintenance, result.Error)
+				}
+				if result.Maintenance.RetryAfter != tc.retryAfter {
+					t.Errorf("Expected Retry-After %q, got %q", tc.retryAfter, result.Maintenance.RetryAfter)
+				}
+				if !result.Maintenance.HoldingPage {
+					t.Error("Expected a holding page")
+				}
+			} else if tc.reported {
+				if result.Error != nil {
+					t.Fatalf("Expected the page to be analyzed, got error %v", result.Error)
+				}
+				if result.Maintenance == nil || result.Maintenance.HoldingPage {
+					t.Errorf("Expected maintenance indicators without a holding page, got %+v", result.Maintenance)
+				}
+			} else if result.Maintenance != nil {
+				t.Errorf("Expected no maintenance detection, got %v", result.Maintenance.Indicators)
+			}
+		})
+	}
+}
+
+func TestValidateHTML(t *testing.T) {
+	analyzer := NewAnalyzer(30 * time.Second)
+
+	testCases := []struct {
+		name     string
+		html     string
+		expected []ValidationIssue
+	}{
+		{
+			name:     "Well-formed document",
+			html:     "<!DOCTYPE html>\n<html>\n<body>\n<ul><li>One<li>Two</ul>\n<p>Text\n</body>\n</html>",
+			expected: nil,
+		},
+		{
+			name: "Unclosed element",
+			html: "<html>\n<body>\n<div>\n<span>text</span>\n</body>\n</html>",
+			expected: []ValidationIssue{
+				{Type: ValidationUnclosedElement, Element: "div", Line: 3},
+			},
+		},
+		{
+			name: "Misnested elements",
+			html: "<html><body>\n<b><i>text</b></i>\n</body></html>",
+			expected: []ValidationIssue{
+				{Type: ValidationMisnestedElement, Element: "i", Line: 2},
+				{Type: ValidationStrayEndTag, Element: "i", Line: 2},
+			},
+		},
+		{
+			name: "Wrong context",
+			html: "<html><body>\n<li>orphan</li>\n<p>\n<div>block</div>\n</body></html>",
+			expected: []ValidationIssue{
+				{Type: ValidationInvalidContext, Element: "li", Line: 2},
+				{Type: ValidationInvalidContext, Element: "div", Line: 4},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			issues := analyzer.validateHTML(tc.html)
+			if len(issues) != len(tc.expected) {
+				t.Fatalf("Expected %d issues, got %d: %+v", len(tc.expected), len(issues), issues)
+			}
+			for i, expected := range tc.expected {
+				got := issues[i]
+				if got.Type != expected.Type || got.Element != expected.Element || got.Line != expected.Line {
+					t.Errorf("Issue %d: expected %s <%s> on line %d, got %s <%s> on line %d",
+						i, expected.Type, expected.Element, expected.Line, got.Type, got.Element, got.Line)
+				}
+			}
+		})
+	}
+}
+
+func TestFindDeadAnchors(t *testing.T) {
+	analyzer := NewAnalyzer(30 * time.Second)
+	baseURL, _ := url.Parse("https://example.com/docs?page=1")
+
+	doc, err := parseHTMLString(`<html><body>
+		<a href="#intro">Intro</a>
+		<a href="#usage">Usage</a>
+		<a href="#legacy">Legacy</a>
+		<a href="#missing">Missing</a>
+		<a href="#missing">Missing again</a>
+		<a href="/docs?page=1#gone">Same page</a>
+		<a href="/other#elsewhere">Other page</a>
+		<a href="#">Top</a>
+		<a href="#top">Top</a>
+		<h2 id="intro">Intro</h2>
+		<section id="usage"></section>
+		<a name="legacy"></a>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("Failed to parse HTML: %v", err)
+	}
+
+	dead := analyzer.findDeadAnchors(doc, baseURL)
+	expected := []string{"#missing", "#gone"}
+	if len(dead) != len(expected) {
+		t.Fatalf("Expected dead anchors %v, got %v", expected, dead)
+	}
+	for i := range expected {
+		if dead[i] != expected[i] {
+			t.Errorf("Expected dead anchor %s, got %s", expected[i], dead[i])
+		}
+	}
+}
+
+func TestAnalyzeCSP(t *testing.T) {
+	analyzer := NewAnalyzer(30 * time.Second)
+
+	t.Run("Missing policy", func(t *testing.T) {
+		csp := analyzer.analyzeCSP(http.Header{}, nil)
+		if csp.Present {
+			t.Error("Expected no policy to be present")
+		}
+		if len(csp.Findings) != 1 {
+			t.Errorf("Expected 1 finding, got %d", len(csp.Findings))
+		}
+	})
+
+	t.Run("Weak header and meta policy", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("Content-Security-Policy", "default-src 'self'; script-src 'self' 'unsafe-inline' 'unsafe-eval'")
+		doc, err := parseHTMLString(`<html><head><meta http-equiv="Content-Security-Policy" content="img-src *"></head></html>`)
+		if err != nil {
+			t.Fatalf("Failed to parse HTML: %v", err)
+		}
+
+		csp := analyzer.analyzeCSP(header, doc)
+		if !csp.Present {
+			t.Fatal("Expected policy to be present")
+		}
+		if len(csp.Sources) != 2 {
+			t.Errorf("Expected header and meta sources, got %v", csp.Sources)
+		}
+		if got := csp.Directives["script-src"]; len(got) != 3 {
+			t.Errorf("Expected 3 script-src sources, got %v", got)
+		}
+
+		severities := make(map[string]string)
+		for _, finding := range csp.Findings {
+			severities[finding.Message] = finding.Severity
+		}
+		expected := map[string]string{
+			"script-src allows 'unsafe-inline'": SeverityHigh,
+			"script-src allows 'unsafe-eval'":   SeverityHigh,
+		}
+		for message, severity := range expected {
+			if severities[message] != severity {
+				t.Errorf("Expected %q with severity %s, got %q", message, severity, severities[message])
+			}
+		}
+		// The header's default-src still restricts images to the page's origin
+		if _, ok := severities["img-src allows any source via wildcard"]; ok {
+			t.Error("Expected the wildcard img-src to be restricted by the header policy")
+		}
+	})
+
+	t.Run("Stricter policy alongside a weak one", func(t *testing.T) {
+		header := http.Header{}
+		header.Add("Content-Security-Policy", "default-src 'self'; script-src * 'unsafe-inline'")
+		header.Add("Content-Security-Policy", "script-src 'self' 'unsafe-inline'")
+
+		csp := analyzer.analyzeCSP(header, nil)
+		var messages []string
+		for _, finding := range csp.Findings {
+			messages = append(messages, finding.Message)
+		}
+		if strings.Join(messages, "; ") != "script-src allows 'unsafe-inline'" {
+			t.Errorf("Expected only the weakness both policies permit, got %v", messages)
+		}
+	})
+
+	t.Run("Nonce-based policy", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("Content-Security-Policy", "default-src 'self'; script-src 'nonce-abc' 'unsafe-inline'")
+
+		csp := analyzer.analyzeCSP(header, nil)
+		for _, finding := range csp.Findings {
+			if finding.Severity == SeverityHigh {
+				t.Errorf("Unexpected high severity finding: %s", finding.Message)
+			}
+		}
+	})
+}
+
+func TestHTTPSReadinessGrade(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    HTTPSReadiness
+		expected string
+	}{
+		{
+			name:     "No HTTPS",
+			input:    HTTPSReadiness{},
+			expected: GradeF,
+		},
+		{
+			name:     "HTTPS without redirect or HSTS",
+			input:    HTTPSReadiness{HTTPSAvailable: true},
+			expected: GradeC,
+		},
+		{
+			name:     "Redirect with short HSTS",
+			input:    HTTPSReadiness{HTTPSAvailable: true, RedirectsToHTTPS: true, HSTS: parseHSTSHeader("max-age=300")},
+			expected: GradeB,
+		},
+		{
+			name:     "Redirect with one year HSTS",
+			input:    HTTPSReadiness{HTTPSAvailable: true, RedirectsToHTTPS: true, HSTS: parseHSTSHeader("max-age=31536000")},
+			expected: GradeA,
+		},
+		{
+			name:     "Preload-ready HSTS",
+			input:    HTTPSReadiness{HTTPSAvailable: true, RedirectsToHTTPS: true, HSTS: parseHSTSHeader(`max-age="63072000"; includeSubDomains; preload`)},
+			expected: GradeAPlus,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			grade, _ := gradeHTTPSReadiness(&tc.input)
+			if grade != tc.expected {
+				t.Errorf("Expected grade %s, got %s", tc.expected, grade)
+			}
+		})
+	}
+}
+
+func TestBuildVariantURLs(t *testing.T) {
+	parsedURL, _ := url.Parse("https://www.example.com/path?q=1#frag")
+	variants := buildVariantURLs(parsedURL)
+
+	expected := []string{
+		"http://example.com/path?q=1",
+		"http://www.example.com/path?q=1",
+		"https://example.com/path?q=1",
+		"https://www.example.com/path?q=1",
+	}
+	if len(variants) != len(expected) {
+		t.Fatalf("Expected %d variants, got %v", len(expected), variants)
+	}
+	for i := range expected {
+		if variants[i] != expected[i] {
+			t.Errorf("Expected variant %s, got %s", expected[i], variants[i])
+		}
+	}
+
+	ipURL, _ := url.Parse("http://127.0.0.1:8080/")
+	if got := buildVariantURLs(ipURL); len(got) != 2 {
+		t.Errorf("Expected only scheme variants for IP hosts, got %v", got)
+	}
+}
+
+func TestAnalyzeURL_CompareVariants(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<!DOCTYPE html><html><head><title>Variant</title></head><body></body></html>"))
+	}))
+	defer server.Close()
+
+	analyzer := NewAnalyzer(5 * time.Second)
+	result := analyzer.AnalyzeURLWithOptions(context.Background(), server.URL, AnalysisOptions{CompareVariants: true})
+
+	if result.Variants == nil {
+		t.Fatal("Expected variant comparison in result")
+	}
+	if len(result.Variants.Variants) != 2 {
+		t.Fatalf("Expected 2 variants, got %d", len(result.Variants.Variants))
+	}
+
+	// The test server only speaks plain HTTP, so the https variant must fail
+	if result.Variants.Consistent {
+		t.Error("Expected variants to be inconsistent")
+	}
+	if result.Variants.Variants[0].Title != "Variant" {
+		t.Errorf("Expected http variant title 'Variant', got '%s'", result.Variants.Variants[0].Title)
+	}
+	if result.Variants.Variants[1].Error == "" {
+		t.Error("Expected https variant to fail")
+	}
+
+	// Plain analyses are cached separately and carry no comparison
+	if plain := analyzer.AnalyzeURL(server.URL); plain.Variants != nil {
+		t.Error("Expected no variant comparison without the option")
+	}
+}
+
+func TestCanonicalizeURL(t *testing.T) {
+	testCases := []struct {
+		name          string
+		input         string
+		stripTracking bool
+		expected      string
+	}{
+		{"Empty path", "https://example.com", false, "https://example.com/"},
+		{"Uppercase host", "https://EXAMPLE.com/", false, "https://example.com/"},
+		{"Default port", "https://example.com:443/path", false, "https://example.com/path"},
+		{"Non-default port", "http://example.com:8080/", false, "http://example.com:8080/"},
+		{"Fragment", "https://example.com/page#section", false, "https://example.com/page"},
+		{"Sorted query", "https://example.com/?b=2&a=1", false, "https://example.com/?a=1&b=2"},
+		{"Tracking kept", "https://example.com/?utm_source=x&a=1", false, "https://example.com/?a=1&utm_source=x"},
+		{"Tracking stripped", "https://example.com/?utm_source=x&gclid=y&a=1", true, "https://example.com/?a=1"},
+		{"Only tracking", "https://example.com/?utm_medium=x", true, "https://example.com/"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			parsedURL, err := url.Parse(tc.input)
+			if err != nil {
+				t.Fatalf("Failed to parse URL: %v", err)
+			}
+			if got := CanonicalizeURL(parsedURL, tc.stripTracking); got != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestAnalyzeURL_NormalizedCacheKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<!DOCTYPE html><html><head><title>Cached</title></head><body></body></html>"))
+	}))
+	defer server.Close()
+
+	analyzer := NewAnalyzer(5 * time.Second)
+	first := analyzer.AnalyzeURL(server.URL + "/?b=2&a=1")
+	second := analyzer.AnalyzeURL(strings.ToUpper(server.URL) + "/?a=1&b=2#top")
+
+	if hits := analyzer.GetMetrics().CacheHits; hits != 1 {
+		t.Errorf("Expected equivalent URLs to share a cache entry, got %d cache hits", hits)
+	}
+	if second.PageTitle != first.PageTitle {
+		t.Errorf("Expected cached title %q, got %q", first.PageTitle, second.PageTitle)
+	}
+	if second.URL != strings.ToUpper(server.URL)+"/?a=1&b=2#top" {
+		t.Errorf("Expected cached result to echo the caller's URL, got %s", second.URL)
+	}
+}
+
+func TestAnalyzeURL_FetchMetadata(t *testing.T) {
+	body := "<!DOCTYPE html><html><head><title>Final</title></head><body></body></html>"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/start" {
+			http.Redirect(w, r, "/final", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	analyzer := NewAnalyzer(5 * time.Second)
+	before := time.Now()
+	result := analyzer.AnalyzeURL(server.URL + "/start#intro")
+
+	if result.Error != nil {
+		t.Fatalf("Unexpected error: %s", result.Error.Message)
+	}
+	if result.NormalizedURL != server.URL+"/start" {
+		t.Errorf("Expected normalized URL %s/start, got %s", server.URL, result.NormalizedURL)
+	}
+	if result.FinalURL != server.URL+"/final" {
+		t.Errorf("Expected final URL %s/final, got %s", server.URL, result.FinalURL)
+	}
+	if result.FetchedAt.Before(before.Add(-time.Second)) {
+		t.Errorf("Expected fetched_at to be set, got %v", result.FetchedAt)
+	}
+	if result.ContentLength != int64(len(body)) {
+		t.Errorf("Expected content length %d, got %d", len(body), result.ContentLength)
+	}
+	if result.CacheHit {
+		t.Error("Expected first analysis not to be a cache hit")
+	}
+
+	cached := analyzer.AnalyzeURL(server.URL + "/start")
+	if !cached.CacheHit {
+		t.Error("Expected second analysis to be a cache hit")
+	}
+	if !cached.FetchedAt.Equal(result.FetchedAt) {
+		t.Error("Expected cached result to keep the original fetch time")
+	}
+}
+
+func TestAnalyzeURL_ConnectionRefused(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	closedURL := server.URL
+	server.Close()
+
+	analyzer := NewAnalyzer(5 * time.Second)
+	result := analyzer.AnalyzeURL(closedURL)
+
+	if result.Error == nil {
+		t.Fatal("Expected error for closed server")
+	}
+	if result.Error.Code != ErrCodeConnRefused {
+		t.Errorf("Expected error code %s, got %s", ErrCodeConnRefused, result.Error.Code)
+	}
+}
+
+func TestAnalyzeURL_BlockedByPolicy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html></html>"))
+	}))
+	defer server.Close()
+
+	analyzer := NewAnalyzer(5 * time.Second)
+	analyzer.SetBlockPrivateNetworks(true)
+	result := analyzer.AnalyzeURL(server.URL)
+
+	if result.Error == nil {
+		t.Fatal("Expected loopback target to be blocked")
+	}
+	if result.Error.Code != ErrCodeBlockedByPolicy {
+		t.Errorf("Expected error code %s, got %s", ErrCodeBlockedByPolicy, result.Error.Code)
+	}
+}
+
+func TestClassifyFetchError(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"DNS", &url.Error{Op: "Get", URL: "https://x", Err: &net.DNSError{Err: "no such host", Name: "x"}}, ErrCodeDNSError},
+		{"TLS", &url.Error{Op: "Get", URL: "https://x", Err: x509.UnknownAuthorityError{}}, ErrCodeTLSError},
+		{"Refused", &url.Error{Op: "Get", URL: "https://x", Err: syscall.ECONNREFUSED}, ErrCodeConnRefused},
+		{"Reset", &url.Error{Op: "Get", URL: "https://x", Err: syscall.ECONNRESET}, ErrCodeConnReset},
+		{"Timeout", context.DeadlineExceeded, ErrCodeTimeoutError},
+		{"Content too large", &contentTooLargeError{limit: DefaultMaxBodySize}, ErrCodeContentTooLarge},
+		{"Blocked", fmt.Errorf("dial: %w", errBlockedByPolicy), ErrCodeBlockedByPolicy},
+		{"Other", errors.New("boom"), ErrCodeInternalError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ClassifyFetchError("https://x", tc.err); got.Code != tc.expected {
+				t.Errorf("Expected error code %s, got %s", tc.expected, got.Code)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		value    string
+		expected int
+		ok       bool
+	}{
+		{"120", 120, true},
+		{"Wed, 01 Jan 2025 12:01:30 GMT", 90, true},
+		{"Wed, 01 Jan 2025 11:00:00 GMT", 0, true},
+		{"", 0, false},
+		{"-5", 0, false},
+		{"soon", 0, false},
+	}
+
+	for _, tc := range testCases {
+		seconds, ok := ParseRetryAfter(tc.value, now)
+		if ok != tc.ok || seconds != tc.expected {
+			t.Errorf("ParseRetryAfter(%q): expected (%d, %v), got (%d, %v)", tc.value, tc.expected, tc.ok, seconds, ok)
+		}
+	}
+}
+
+func TestAnalyzeURL_RateLimited(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	analyzer := NewAnalyzer(5 * time.Second)
+	result := analyzer.AnalyzeURL(server.URL)
+
+	if result.Error == nil {
+		t.Fatal("Expected error for HTTP 429")
+	}
+	if result.Error.Code != ErrCodeRateLimited {
+		t.Errorf("Expected error code %s, got %s", ErrCodeRateLimited, result.Error.Code)
+	}
+	if result.Error.RetryAfterSeconds != 30 {
+		t.Errorf("Expected retry_after_seconds 30, got %d", result.Error.RetryAfterSeconds)
+	}
+	if result.Error.Suggestion == "" {
+		t.Error("Expected a remediation suggestion")
+	}
+}
+
+func TestAnalyzeURL_CircuitOpenHints(t *testing.T) {
+	analyzer := NewAnalyzer(5 * time.Second)
+	for i := 0; i < DefaultFailureThreshold; i++ {
+		analyzer.circuitBreaker.OnFailure()
+	}
+
+	result := analyzer.AnalyzeURL("https://example.com")
+	if result.Error == nil {
+		t.Fatal("Expected error while circuit breaker is open")
+	}
+	if result.Error.Code != ErrCodeCircuitOpen {
+		t.Errorf("Expected error code %s, got %s", ErrCodeCircuitOpen, result.Error.Code)
+	}
+	if result.Error.RetryAfterSeconds <= 0 || result.Error.RetryAfterSeconds > int(CircuitBreakerTimeout.Seconds()) {
+		t.Errorf("Expected retry_after_seconds within the breaker timeout, got %d", result.Error.RetryAfterSeconds)
+	}
+	if result.Error.Suggestion == "" {
+		t.Error("Expected a remediation suggestion")
+	}
+}
+
+func TestAnalyzeURL_SkipLinkCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<!DOCTYPE html><html><body>
+			<a href="/internal">Internal</a>
+			<a href="http://unreachable.invalid/">External</a>
+		</body></html>`))
+	}))
+	defer server.Close()
+
+	analyzer := NewAnalyzer(5 * time.Second)
+	result := analyzer.AnalyzeURLWithOptions(context.Background(), server.URL, AnalysisOptions{SkipLinkCheck: true})
+
+	if result.InternalLinks != 1 || result.ExternalLinks != 1 {
+		t.Errorf("Expected 1 internal and 1 external link, got %d and %d", result.InternalLinks, result.ExternalLinks)
+	}
+	if result.InaccessibleLinks != 0 {
+		t.Errorf("Expected no accessibility checks, got %d inaccessible links", result.InaccessibleLinks)
+	}
+}
+
+func TestAnalyzeURL_IncludeLinks(t *testing.T) {
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer external.Close()
+	externalURL := strings.Replace(external.URL, "127.0.0.1", "localhost", 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<!DOCTYPE html><html><body>
+			<a href="/internal">Internal</a>
+			<a href="` + externalURL + `/ok">OK</a>
+			<a href="` + externalURL + `/missing">Missing</a>
+		</body></html>`))
+	}))
+	defer server.Close()
+
+	analyzer := NewAnalyzer(5 * time.Second)
+
+	result := analyzer.AnalyzeURLWithOptions(context.Background(), server.URL, AnalysisOptions{})
+	if result.LinkDetails != nil {
+		t.Errorf("Expected no link details without IncludeLinks, got %+v", result.LinkDetails)
+	}
+
+	result = analyzer.AnalyzeURLWithOptions(context.Background(), server.URL, AnalysisOptions{IncludeLinks: true})
+	if result.Error != nil {
+		t.Fatalf("Unexpected error: %v", result.Error)
+	}
+	if len(result.LinkDetails) != 3 {
+		t.Fatalf("Expected 3 link details, got %+v", result.LinkDetails)
+	}
+	byURL := make(map[string]LinkDetail)
+	for _, detail := range result.LinkDetails {
+		byURL[detail.URL] = detail
+	}
+
+	internal := byURL["/internal"]
+	if !internal.Internal || internal.AbsoluteURL != server.URL+"/internal" || internal.StatusCode != 0 {
+		t.Errorf("Expected an unchecked internal link resolved against the page, got %+v", internal)
+	}
+	ok := byURL[externalURL+"/ok"]
+	if ok.Internal || !ok.Accessible || ok.StatusCode != http.StatusOK || ok.Error != "" {
+		t.Errorf("Expected an accessible external link with status 200, got %+v", ok)
+	}
+	missing := byURL[externalURL+"/missing"]
+	if missing.Accessible || missing.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected an inaccessible external link with status 404, got %+v", missing)
+	}
+	for i := 1; i < len(result.LinkDetails); i++ {
+		if result.LinkDetails[i-1].AbsoluteURL > result.LinkDetails[i].AbsoluteURL {
+			t.Errorf("Expected link details sorted by absolute URL, got %+v", result.LinkDetails)
+		}
+	}
+}
+
+func TestAnalyzeURL_WaybackCapture(t *testing.T) {
+	var requested string
+	archive := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/available":
+			requested = r.URL.Query().Get("timestamp")
+			if strings.Contains(r.URL.Query().Get("url"), "never") {
+				w.Write([]byte(`{"url": "never.example", "archived_snapshots": {}}`))
+				return
+			}
+			w.Write([]byte(`{"archived_snapshots": {"closest": {"available": true, "status": "200", "timestamp": "20240114210733"}}}`))
+		case r.URL.Path == "/web/20240114210733id_/https://example.com/login":
+			w.Header().Set("X-Archive-Orig-Content-Security-Policy", "default-src 'self'")
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<!DOCTYPE html><html><head><title>Sign in</title></head><body>
+				<form><input type="text" name="user"><input type="password" name="pass"></form>
+			</body></html>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer archive.Close()
+
+	analyzer := NewAnalyzer(5 * time.Second)
+	analyzer.wayback = NewWaybackClient(archive.URL+"/available", archive.URL+"/web/")
+	date, _ := ParseArchiveDate("2024-01-15")
+
+	result := analyzer.AnalyzeURLWithOptions(context.Background(), "https://example.com/login", AnalysisOptions{ArchiveDate: date, SkipLinkCheck: true})
+	if result.Error != nil {
+		t.Fatalf("Unexpected error: %v", result.Error)
+	}
+	if requested != "20240115000000" {
+		t.Errorf("Expected the capture closest to 20240115000000, got %q", requested)
+	}
+	captured := time.Date(2024, 1, 14, 21, 7, 33, 0, time.UTC)
+	if result.Archive == nil || !result.Archive.CapturedAt.Equal(captured) || !result.FetchedAt.Equal(captured) {
+		t.Fatalf("Expected the capture to be reported, got %+v", result.Archive)
+	}
+	if result.Archive.URL != archive.URL+"/web/20240114210733/https://example.com/login" {
+		t.Errorf("Expected the capture URL, got %s", result.Archive.URL)
+	}
+	if result.PageTitle != "Sign in" || !result.HasLoginForm || result.StatusCode != http.StatusOK {
+		t.Errorf("Expected the capture to be analyzed, got title %q, login form %v, status %d", result.PageTitle, result.HasLoginForm, result.StatusCode)
+	}
+	if result.CSP == nil || len(result.CSP.Sources) == 0 {
+		t.Errorf("Expected the archived CSP header to be analyzed, got %+v", result.CSP)
+	}
+
+	result = analyzer.AnalyzeURLWithOptions(context.Background(), "https://never.example/", AnalysisOptions{ArchiveDate: date})
+	if result.Error == nil || result.Error.Code != ErrCodeNotArchived {
+		t.Errorf("Expected %s, got %+v", ErrCodeNotArchived, result.Error)
+	}
+}
+
+func TestParseArchiveDate(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected time.Time
+		valid    bool
+	}{
+		{"2024-01-15", time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC), true},
+		{"2024-01-15T09:30:00+02:00", time.Date(2024, 1, 15, 7, 30, 0, 0, time.UTC), true},
+		{"20240115093000", time.Date(2024, 1, 15, 9, 30, 0, 0, time.UTC), true},
+		{"20240115", time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC), true},
+		{"2024", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		{"202401150", time.Time{}, false},
+		{"2024-13-01", time.Time{}, false},
+		{"yesterday", time.Time{}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			date, err := ParseArchiveDate(tc.value)
+			if (err == nil) != tc.valid {
+				t.Fatalf("Expected valid=%v, got %v", tc.valid, err)
+			}
+			if !date.Equal(tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, date)
+			}
+		})
+	}
+}
+
+func TestAnalyzeURL_PageSpeed(t *testing.T) {
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><head><title>Fast</title></head><body></body></html>`))
+	}))
+	defer page.Close()
+
+	var lookups atomic.Int32
+	fail := false
+	pageSpeed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups.Add(1)
+		if r.Header.Get("X-Goog-Api-Key") != "test-key" || !strings.HasPrefix(r.URL.Query().Get("url"), page.URL) || r.URL.Query().Get("strategy") != "mobile" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if fail {
+			http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{
+			"loadingExperience": {
+				"overall_category": "AVERAGE",
+				"metrics": {
+					"LARGEST_CONTENTFUL_PAINT_MS": {"percentile": 2870, "category": "AVERAGE"},
+					"CUMULATIVE_LAYOUT_SHIFT_SCORE": {"percentile": 4, "category": "FAST"}
+				}
+			},
+			"lighthouseResult": {"categories": {"performance": {"score": 0.87}}}
+		}`))
+	}))
+	defer pageSpeed.Close()
+
+	analyzer := NewAnalyzer(5 * time.Second)
+	if analyzer.PageSpeedEnabled() {
+		t.Fatal("Expected PageSpeed Insights to be disabled without a key")
+	}
+	analyzer.pageSpeed = NewPageSpeedClient(pageSpeed.URL, "test-key")
+
+	opts := AnalysisOptions{PageSpeed: true, SkipLinkCheck: true}
+	result := analyzer.AnalyzeURLWithOptions(context.Background(), page.URL, opts)
+	if result.Error != nil {
+		t.Fatalf("Unexpected error: %v", result.Error)
+	}
+	report := result.PageSpeed
+	if report == nil || report.Error != "" {
+		t.Fatalf("Expected a PageSpeed Insights report, got %+v", report)
+	}
+	if report.PerformanceScore == nil || *report.PerformanceScore != 87 {
+		t.Errorf("Expected performance score 87, got %v", report.PerformanceScore)
+	}
+	field := report.FieldData
+	if field == nil || field.OverallCategory != "AVERAGE" || field.LCP == nil || field.LCP.P75 != 2870 {
+		t.Fatalf("Expected LCP field data, got %+v", field)
+	}
+	if field.CLS == nil || field.CLS.P75 != 0.04 || field.INP != nil || report.OriginFieldData != nil {
+		t.Errorf("Expected CLS 0.04 and no other field data, got %+v, origin %+v", field, report.OriginFieldData)
+	}
+
+	// Reports are cached apart from the analysis, and failures are not
+	analyzer.pageSpeed.Lookup(context.Background(), page.URL)
+	if lookups.Load() != 1 {
+		t.Errorf("Expected the report to be cached, got %d lookups", lookups.Load())
+	}
+	fail = true
+	if report := analyzer.pageSpeed.Lookup(context.Background(), page.URL+"/other"); report.Error == "" {
+		t.Errorf("Expected a failed lookup to be reported, got %+v", report)
+	}
+}
+
+func TestHostToASCII(t *testing.T) {
+	testCases := []struct {
+		unicode string
+		ascii   string
+	}{
+		{"example.com", "example.com"},
+		{"EXAMPLE.com", "example.com"},
+		{"münchen.de", "xn--mnchen-3ya.de"},
+		{"MÜNCHEN.de", "xn--mnchen-3ya.de"},
+		{"例え.jp", "xn--r8jz45g.jp"},
+		{"bücher。example", "xn--bcher-kva.example"},
+		{"faß.de", "xn--fa-hia.de"},
+		{"::1", "::1"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.unicode, func(t *testing.T) {
+			ascii, err := HostToASCII(tc.unicode)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if ascii != tc.ascii {
+				t.Errorf("Expected %s, got %s", tc.ascii, ascii)
+			}
+			if back := HostToUnicode(ascii); back != strings.ToLower(strings.ReplaceAll(tc.unicode, "。", ".")) {
+				t.Errorf("Expected round trip to %s, got %s", strings.ToLower(tc.unicode), back)
+			}
+		})
+	}
+}
+
+func TestHostToASCII_Invalid(t *testing.T) {
+	// Labels that are not valid IDNA, such as ones starting with a combining mark, are rejected
+	for _, host := range []string{"\u0301a.example", "ab\u200d.example"} {
+		if ascii, err := HostToASCII(host); err == nil {
+			t.Errorf("Expected error for %q, got %s", host, ascii)
+		}
+	}
+	if unicode := HostToUnicode("xn--a.example"); unicode != "xn--a.example" {
+		t.Errorf("Expected an undecodable label to be left as it is, got %s", unicode)
+	}
+}
+
+func TestNormalizeURL_IDN(t *testing.T) {
+	analyzer := NewAnalyzer(5 * time.Second)
+
+	parsedURL, err := analyzer.normalizeURL("münchen.de:8443/pfad")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if parsedURL.String() != "https://xn--mnchen-3ya.de:8443/pfad" {
+		t.Errorf("Expected punycode URL, got %s", parsedURL.String())
+	}
+}
+
+func TestAnalyzeURL_ExpandShortLinks(t *testing.T) {
+	var pageURL string
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/landing" {
+			w.Write([]byte("<html></html>"))
+			return
+		}
+		w.Write([]byte(`<!DOCTYPE html><html><body><a href="` + pageURL + `">Short</a></body></html>`))
+	}))
+	defer page.Close()
+
+	shortener := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, page.URL+"/landing", http.StatusMovedPermanently)
+	}))
+	defer shortener.Close()
+
+	// Treat the local shortener as a known shortening service for the test
+	urlShorteners["localhost"] = true
+	defer delete(urlShorteners, "localhost")
+	pageURL = strings.Replace(shortener.URL, "127.0.0.1", "localhost", 1) + "/abc"
+
+	analyzer := NewAnalyzer(5 * time.Second)
+	result := analyzer.AnalyzeURLWithOptions(context.Background(), page.URL, AnalysisOptions{ExpandShortLinks: true})
+
+	if len(result.ShortLinks) != 1 {
+		t.Fatalf("Expected 1 short link expansion, got %d", len(result.ShortLinks))
+	}
+	if result.ShortLinks[0].FinalURL != page.URL+"/landing" {
+		t.Errorf("Expected final URL %s/landing, got %s", page.URL, result.ShortLinks[0].FinalURL)
+	}
+	if result.InternalLinks != 1 || result.ExternalLinks != 0 {
+		t.Errorf("Expected the expanded link to be internal, got %d internal and %d external", result.InternalLinks, result.ExternalLinks)
+	}
+
+	// Expansions are charged to the outbound budget, which the page fetch uses up
+	analyzer.SetOutboundBudget(1, 0)
+	result = analyzer.AnalyzeURLWithOptions(context.Background(), page.URL, AnalysisOptions{ExpandShortLinks: true, SkipLinkCheck: true})
+	if len(result.ShortLinks) != 1 || result.ShortLinks[0].FinalURL != "" || result.ShortLinks[0].Error == "" {
+		t.Fatalf("Expected the expansion to fail once the budget is used up, got %+v", result.ShortLinks)
+	}
+	if result.Outbound == nil || !slices.Contains(result.Outbound.SkippedURLs, pageURL) {
+		t.Errorf("Expected %s among the skipped URLs, got %+v", pageURL, result.Outbound)
+	}
+}
+
+func TestAnalyzeURL_QuickCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "HEAD" {
+			t.Errorf("Expected HEAD request, got %s", r.Method)
+		}
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+			return
+		}
+		w.Header().Set("X-Test", "quick")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	analyzer := NewAnalyzer(5 * time.Second)
+	result := analyzer.AnalyzeURLWithOptions(context.Background(), server.URL+"/old", AnalysisOptions{QuickCheck: true})
+
+	if result.Error != nil {
+		t.Fatalf("Unexpected error: %v", result.Error)
+	}
+	if result.QuickCheck == nil || !result.QuickCheck.Reachable {
+		t.Fatalf("Expected reachable quick check result, got %+v", result.QuickCheck)
+	}
+	if result.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", result.StatusCode)
+	}
+	if len(result.QuickCheck.RedirectChain) != 1 || result.QuickCheck.RedirectChain[0].StatusCode != http.StatusMovedPermanently {
+		t.Errorf("Expected one 301 redirect hop, got %+v", result.QuickCheck.RedirectChain)
+	}
+	if result.FinalURL != server.URL+"/new" {
+		t.Errorf("Expected final URL %s/new, got %s", server.URL, result.FinalURL)
+	}
+	if got := result.QuickCheck.Headers["X-Test"]; len(got) != 1 || got[0] != "quick" {
+		t.Errorf("Expected X-Test header to be captured, got %v", got)
+	}
+	if result.PageTitle != "" || result.HTMLVersion != "" {
+		t.Errorf("Expected body not to be analyzed in quick mode")
+	}
+}
+
+func TestTLSInfo(t *testing.T) {
+	cert := &x509.Certificate{
+		NotBefore:   time.Now().Add(-60 * 24 * time.Hour),
+		NotAfter:    time.Now().Add(10*24*time.Hour + time.Hour),
+		DNSNames:    []string{"example.com", "www.example.com"},
+		IPAddresses: []net.IP{net.ParseIP("192.0.2.1")},
+	}
+	cert.Subject.CommonName = "example.com"
+	cert.Issuer.CommonName = "Example CA"
+
+	info := tlsInfo(&tls.ConnectionState{
+		Version:          tls.VersionTLS10,
+		CipherSuite:      tls.TLS_RSA_WITH_RC4_128_SHA,
+		ServerName:       "example.com",
+		PeerCertificates: []*x509.Certificate{cert},
+	})
+	if info.Version != "TLS 1.0" || info.Issuer != "Example CA" || info.DaysUntilExpiry != 10 {
+		t.Errorf("Unexpected TLS info %+v", info)
+	}
+	if strings.Join(info.SANs, ",") != "example.com,www.example.com,192.0.2.1" {
+		t.Errorf("Expected DNS and IP SANs, got %v", info.SANs)
+	}
+	var subjects []string
+	for _, finding := range info.Findings {
+		subjects = append(subjects, finding.Subject)
+	}
+	if strings.Join(subjects, ",") != "TLS 1.0,TLS_RSA_WITH_RC4_128_SHA,certificate" {
+		t.Errorf("Expected protocol, cipher and expiry findings, got %+v", info.Findings)
+	}
+
+	cert.NotAfter = time.Now().Add(365 * 24 * time.Hour)
+	info = tlsInfo(&tls.ConnectionState{
+		Version:          tls.VersionTLS13,
+		CipherSuite:      tls.TLS_AES_128_GCM_SHA256,
+		PeerCertificates: []*x509.Certificate{cert},
+	})
+	if len(info.Findings) != 0 {
+		t.Errorf("Expected no findings for a modern connection, got %+v", info.Findings)
+	}
+	if tlsInfo(nil) != nil {
+		t.Error("Expected no TLS info for a plain HTTP response")
+	}
+}
+
+func TestAnalyzeURL_TLSInspection(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "expired.test"},
+		NotBefore:    time.Now().Add(-90 * 24 * time.Hour),
+		NotAfter:     time.Now().Add(-2 * 24 * time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+
+	testCases := []struct {
+		name     string
+		config   *tls.Config
+		version  string
+		messages []string
+	}{
+		{
+			name:     "Deprecated protocol",
+			config:   &tls.Config{MinVersion: tls.VersionTLS10, MaxVersion: tls.VersionTLS10},
+			version:  "TLS 1.0",
+			messages: []string{"deprecated protocol", "Certificate is not trusted"},
+		},
+		{
+			name:     "Expired certificate",
+			config:   &tls.Config{Certificates: []tls.Certificate{expired}},
+			version:  "TLS 1.3",
+			messages: []string{"Certificate expired on", "Certificate is not trusted"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+				w.Write([]byte("<html></html>"))
+			}))
+			server.TLS = tc.config
+			server.StartTLS()
+			defer server.Close()
+
+			analyzer := NewAnalyzer(5 * time.Second)
+			result := analyzer.AnalyzeURL(server.URL)
+			if result.Error == nil || result.Error.Code != ErrCodeTLSError {
+				t.Fatalf("Expected error code %s, got %v", ErrCodeTLSError, result.Error)
+			}
+			if result.TLS == nil {
+				t.Fatal("Expected the failed handshake to be inspected")
+			}
+			if result.TLS.Version != tc.version {
+				t.Errorf("Expected %s, got %s", tc.version, result.TLS.Version)
+			}
+			var messages []string
+			for _, finding := range result.TLS.Findings {
+				messages = append(messages, finding.Message)
+			}
+			for _, message := range tc.messages {
+				if !strings.Contains(strings.Join(messages, "\n"), message) {
+					t.Errorf("Expected a finding containing %q, got %v", message, messages)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractMainContent(t *testing.T) {
+	paragraph := strings.Repeat("The quick brown fox jumps over the lazy dog, again and again. ", 10)
+	testCases := []struct {
+		name        string
+		html        string
+		contains    string
+		notContains []string
+	}{
+		{
+			name: "Article element",
+			html: `<html><body><nav>Home About Contact</nav><article><h1>Story</h1><p>` + paragraph + `</p></article>
+				<footer>Copyright notice</footer></body></html>`,
+			contains:    "Story",
+			notContains: []string{"Home About", "Copyright"},
+		},
+		{
+			name: "Scored paragraphs",
+			html: `<html><body><div class="menu"><a href="/">Menu link</a></div><div id="story"><p>` + paragraph + `</p><p>` + paragraph + `</p>
+				<div class="ad-banner sponsored">Buy now</div></div><div class="sidebar"><p>` + paragraph + `</p></div></body></html>`,
+			contains:    "quick brown fox",
+			notContains: []string{"Menu link", "Buy now"},
+		},
+	}
+
+	analyzer := NewAnalyzer(5 * time.Second)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader(tc.html))
+			if err != nil {
+				t.Fatalf("Failed to parse HTML: %v", err)
+			}
+
+			content := analyzer.extractMainContent(doc)
+			if content == nil {
+				t.Fatal("Expected main content, got nil")
+			}
+			if !strings.Contains(content.Text, tc.contains) {
+				t.Errorf("Expected content to contain %q, got %q", tc.contains, content.Text)
+			}
+			for _, unwanted := range tc.notContains {
+				if strings.Contains(content.Text, unwanted) {
+					t.Errorf("Expected content not to contain %q", unwanted)
+				}
+			}
+			if content.WordCount == 0 || content.ReadingTimeMinutes < 1 {
+				t.Errorf("Expected word count and reading time, got %d words and %d minutes", content.WordCount, content.ReadingTimeMinutes)
+			}
+		})
+	}
+}
+
+func TestContentFingerprint(t *testing.T) {
+	base := strings.Repeat("The analyzer fingerprints page content to find near duplicate pages across a site. ", 10)
+
+	original := contentFingerprint(base)
+	similar := contentFingerprint(base + "One extra sentence.")
+	different := contentFingerprint(strings.Repeat("Completely unrelated words about cooking pasta with fresh basil. ", 10))
+
+	if original == "" || len(original) != 16 {
+		t.Fatalf("Expected 16 character fingerprint, got %q", original)
+	}
+
+	near, err := FingerprintDistance(original, similar)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	far, err := FingerprintDistance(original, different)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if near > DefaultDuplicateThreshold {
+		t.Errorf("Expected similar texts within %d bits, got %d", DefaultDuplicateThreshold, near)
+	}
+	if far <= DefaultDuplicateThreshold {
+		t.Errorf("Expected different texts to exceed %d bits, got %d", DefaultDuplicateThreshold, far)
+	}
+	if contentFingerprint("   ") != "" {
+		t.Error("Expected empty fingerprint for empty text")
+	}
+}
+
+func TestBlocklist(t *testing.T) {
+	blocklist := NewBlocklist([]string{
+		"# comment line",
+		"evil.example MALWARE",
+		"https://phish.example.org/login SOCIAL_ENGINEERING",
+		"https://phish.example.org/ UNWANTED_SOFTWARE",
+		"https://phish.example.org/login/reset POTENTIALLY_HARMFUL_APPLICATION",
+		"",
+	})
+
+	testCases := []struct {
+		url      string
+		expected string
+	}{
+		{"https://evil.example/download", "MALWARE"},
+		{"https://cdn.evil.example/x.js", "MALWARE"},
+		{"https://phish.example.org/login?next=/", "SOCIAL_ENGINEERING"},
+		{"https://phish.example.org/login/reset", "POTENTIALLY_HARMFUL_APPLICATION"},
+		{"https://phish.example.org/about", "UNWANTED_SOFTWARE"},
+		{"https://www.example.org/login", ""},
+		{"https://notevil.example/", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.url, func(t *testing.T) {
+			flagged, err := blocklist.CheckURLs(context.Background(), []string{tc.url})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			got := ""
+			if len(flagged) > 0 {
+				got = flagged[0].Threat
+			}
+			if got != tc.expected {
+				t.Errorf("Expected threat %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestAnalyzeURL_ThreatCheck(t *testing.T) {
+	safeBrowsing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("key") != "test-key" {
+			t.Errorf("Expected API key to be sent")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"matches":[{"threatType":"SOCIAL_ENGINEERING","threat":{"url":"https://phishing.example/"}}]}`))
+	}))
+	defer safeBrowsing.Close()
+
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><a href="https://malware.example/file">Download</a><a href="https://phishing.example/">Login</a><a href="/local">Local</a></body></html>`))
+	}))
+	defer page.Close()
+
+	client := NewSafeBrowsingClient("test-key")
+	client.endpoint = safeBrowsing.URL
+
+	analyzer := NewAnalyzer(5 * time.Second)
+	analyzer.AddThreatChecker(NewBlocklist([]string{"malware.example MALWARE"}))
+	analyzer.AddThreatChecker(client)
+	result := analyzer.AnalyzeURLWithOptions(context.Background(), page.URL, AnalysisOptions{SkipLinkCheck: true})
+
+	if len(result.FlaggedURLs) != 2 {
+		t.Fatalf("Expected 2 flagged URLs, got %+v", result.FlaggedURLs)
+	}
+	if result.FlaggedURLs[0].Source != ThreatSourceBlocklist || result.FlaggedURLs[0].URL != "https://malware.example/file" {
+		t.Errorf("Expected blocklist match for malware link, got %+v", result.FlaggedURLs[0])
+	}
+	if result.FlaggedURLs[1].Source != ThreatSourceSafeBrowsing || result.FlaggedURLs[1].Threat != "SOCIAL_ENGINEERING" {
+		t.Errorf("Expected Safe Browsing match for phishing link, got %+v", result.FlaggedURLs[1])
+	}
+}
+
+// threatCheckerFunc adapts a function to the ThreatChecker interface
+type threatCheckerFunc func(ctx context.Context, urls []string) ([]FlaggedURL, error)
+
+func (f threatCheckerFunc) CheckURLs(ctx context.Context, urls []string) ([]FlaggedURL, error) {
+	return f(ctx, urls)
+}
+
+func TestAnalyzeURL_ThreatCheckTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+	}))
+	defer slow.Close()
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><a href="` + strings.Replace(slow.URL, "127.0.0.1", "localhost", 1) + `/slow">Slow</a></body></html>`))
+	}))
+	defer page.Close()
+
+	var remaining time.Duration
+	analyzer := NewAnalyzer(30 * time.Second)
+	analyzer.AddThreatChecker(threatCheckerFunc(func(ctx context.Context, urls []string) ([]FlaggedURL, error) {
+		if deadline, ok := ctx.Deadline(); ok {
+			remaining = time.Until(deadline)
+		}
+		return nil, nil
+	}))
+	analyzer.AnalyzeURLWithOptions(context.Background(), page.URL, AnalysisOptions{})
+
+	// The whole ThreatCheckTimeout is left however long the link checks took
+	if remaining > ThreatCheckTimeout || remaining < ThreatCheckTimeout-time.Second {
+		t.Errorf("Expected the threat check to get its own %v timeout, got %v left", ThreatCheckTimeout, remaining)
+	}
+}
+
+func TestRDAPClient_Lookup(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/domain/example.co.uk" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/rdap+json")
+		w.Write([]byte(`{
+			"ldhName": "EXAMPLE.CO.UK",
+			"status": ["active"],
+			"events": [
+				{"eventAction": "registration", "eventDate": "2000-01-01T00:00:00Z"},
+				{"eventAction": "expiration", "eventDate": "2099-01-01T00:00:00Z"}
+			],
+			"entities": [{"roles": ["registrar"], "vcardArray": ["vcard", [["version", {}, "text", "4.0"], ["fn", {}, "text", "Example Registrar Ltd"]]]}],
+			"nameservers": [{"ldhName": "NS1.EXAMPLE.NET"}]
+		}`))
+	}))
+	defer server.Close()
+
+	client := NewRDAPClient(server.URL + "/domain/")
+
+	info := client.Lookup(context.Background(), "www.example.co.uk")
+	if info == nil || info.Error != "" {
+		t.Fatalf("Expected domain info, got %+v", info)
+	}
+	if info.Domain != "example.co.uk" {
+		t.Errorf("Expected domain example.co.uk, got %s", info.Domain)
+	}
+	if info.Registrar != "Example Registrar Ltd" {
+		t.Errorf("Expected registrar Example Registrar Ltd, got %s", info.Registrar)
+	}
+	if info.CreatedAt == nil || info.CreatedAt.Year() != 2000 || info.AgeDays <= 0 {
+		t.Errorf("Expected creation date in 2000, got %v (%d days)", info.CreatedAt, info.AgeDays)
+	}
+	if info.ExpiresAt == nil || info.DaysUntilExpiry <= 0 {
+		t.Errorf("Expected future expiry, got %v (%d days)", info.ExpiresAt, info.DaysUntilExpiry)
+	}
+	if len(info.Nameservers) != 1 || info.Nameservers[0] != "ns1.example.net" {
+		t.Errorf("Expected nameserver ns1.example.net, got %v", info.Nameservers)
+	}
+
+	// A second lookup for the same registrable domain is served from the cache
+	client.Lookup(context.Background(), "example.co.uk")
+	if requests != 1 {
+		t.Errorf("Expected 1 RDAP request, got %d", requests)
+	}
+
+	if client.Lookup(context.Background(), "127.0.0.1") != nil {
+		t.Error("Expected no lookup for IP addresses")
+	}
+	if missing := client.Lookup(context.Background(), "unknown.example.org"); missing == nil || missing.Error == "" {
+		t.Errorf("Expected lookup error for unknown domain, got %+v", missing)
+	}
+}
+
+func TestRDAPClient_CacheBound(t *testing.T) {
+	client := NewRDAPClient(RDAPEndpoint)
+	now := time.Now()
+	for i := 0; i < MaxRDAPCacheEntries; i++ {
+		client.cache[fmt.Sprintf("domain%d.example", i)] = rdapCacheEntry{expiresAt: now.Add(time.Hour + time.Duration(i)*time.Second)}
+	}
+	client.cache["domain0.example"] = rdapCacheEntry{expiresAt: now.Add(-time.Second)}
+
+	// Expired entries make room first
+	client.store("new1.example", &DomainInfo{})
+	if len(client.cache) != MaxRDAPCacheEntries {
+		t.Errorf("Expected %d cached domains, got %d", MaxRDAPCacheEntries, len(client.cache))
+	}
+	if _, ok := client.cache["domain0.example"]; ok {
+		t.Error("Expected the expired entry to be dropped")
+	}
+
+	// Otherwise the entry expiring soonest is evicted
+	client.store("new2.example", &DomainInfo{})
+	if len(client.cache) != MaxRDAPCacheEntries {
+		t.Errorf("Expected %d cached domains, got %d", MaxRDAPCacheEntries, len(client.cache))
+	}
+	if _, ok := client.cache["domain1.example"]; ok {
+		t.Error("Expected the entry expiring soonest to be evicted")
+	}
+	if _, ok := client.cache["new1.example"]; !ok {
+		t.Error("Expected the newer entry to be kept")
+	}
+}
+
+func TestMatchCDN(t *testing.T) {
+	testCases := []struct {
+		name     string
+		header   http.Header
+		cname    string
+		ips      []net.IP
+		expected string
+	}{
+		{
+			name:     "Cloudflare headers",
+			header:   http.Header{"Server": {"cloudflare"}, "Cf-Ray": {"8a1b2c3d4e5f-LHR"}},
+			expected: CDNCloudflare,
+		},
+		{
+			name:     "Fastly CNAME",
+			header:   http.Header{},
+			cname:    "example.map.fastly.net",
+			expected: CDNFastly,
+		},
+		{
+			name:     "Fastly cache node",
+			header:   http.Header{"X-Served-By": {"cache-iad-kiad7000025-IAD, cache-lhr7331-LHR"}, "X-Cache": {"MISS, HIT"}},
+			expected: CDNFastly,
+		},
+		{
+			name:     "Fastly debug header",
+			header:   http.Header{"Fastly-Debug-Digest": {"04c3e527819b6a877de6577f7461e132"}},
+			expected: CDNFastly,
+		},
+		{
+			name:     "Varnish without Fastly",
+			header:   http.Header{"Via": {"1.1 varnish (Varnish/7.4)"}, "X-Served-By": {"cache-01"}, "X-Cache": {"HIT"}},
+			expected: "",
+		},
+		{
+			name:     "Fastly-style node name without X-Cache",
+			header:   http.Header{"X-Served-By": {"cache-lhr7331-LHR"}},
+			expected: "",
+		},
+		{
+			name:     "Akamai edge hostname",
+			header:   http.Header{},
+			cname:    "www.example.com.edgekey.net",
+			expected: CDNAkamai,
+		},
+		{
+			name:     "CloudFront via header",
+			header:   http.Header{"Via": {"1.1 abc.cloudfront.net (CloudFront)"}, "X-Amz-Cf-Pop": {"LHR61-P1"}},
+			expected: CDNCloudFront,
+		},
+		{
+			name:     "Cloudflare IP range",
+			header:   http.Header{},
+			ips:      []net.IP{net.ParseIP("104.16.132.229")},
+			expected: CDNCloudflare,
+		},
+		{
+			name:     "No CDN",
+			header:   http.Header{"Server": {"nginx"}},
+			ips:      []net.IP{net.ParseIP("93.184.216.34")},
+			expected: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			info := matchCDN(tc.header, tc.cname, tc.ips)
+			got := ""
+			if info != nil {
+				got = info.Provider
+			}
+			if got != tc.expected {
+				t.Errorf("Expected provider %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestAnalyzeURL_IncludeHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Add("Set-Cookie", "a=1")
+		w.Header().Add("Set-Cookie", "b=2")
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		w.Write([]byte("<html><head><title>Headers</title></head></html>"))
+	}))
+	defer server.Close()
+
+	analyzer := NewAnalyzer(5 * time.Second)
+
+	result := analyzer.AnalyzeURLWithOptions(context.Background(), server.URL, AnalysisOptions{})
+	if result.ResponseHeaders != nil || result.RequestHeaders != nil {
+		t.Error("Expected headers to be omitted by default")
+	}
+
+	for _, path := range []string{"/", "/missing"} {
+		result = analyzer.AnalyzeURLWithOptions(context.Background(), server.URL+path, AnalysisOptions{IncludeHeaders: true})
+		if got := result.ResponseHeaders["Set-Cookie"]; len(got) != 2 {
+			t.Errorf("%s: expected 2 Set-Cookie values, got %v", path, got)
+		}
+		if got := result.RequestHeaders["User-Agent"]; len(got) != 1 || !strings.Contains(got[0], "Mozilla") {
+			t.Errorf("%s: expected User-Agent request header, got %v", path, got)
+		}
+		if _, ok := result.RequestHeaders["Cache-Control"]; ok {
+			t.Errorf("%s: expected only selected request headers", path)
+		}
+	}
+}
+
+func TestMeasureDOM(t *testing.T) {
+	analyzer := NewAnalyzer(5 * time.Second)
+
+	doc, err := html.Parse(strings.NewReader(`<html><head><title>T</title></head><body><div><p><span>a</span></p></div><ul><li>1</li><li>2</li><li>3</li></ul></body></html>`))
+	if err != nil {
+		t.Fatalf("Failed to parse HTML: %v", err)
+	}
+
+	metrics := analyzer.measureDOM(doc)
+	// html, head, title, body, div, p, span, ul, li x3
+	if metrics.NodeCount != 11 {
+		t.Errorf("Expected 11 elements, got %d", metrics.NodeCount)
+	}
+	// html > body > div > p > span
+	if metrics.MaxDepth != 5 {
+		t.Errorf("Expected depth 5, got %d", metrics.MaxDepth)
+	}
+	if metrics.MaxChildren != 3 || metrics.MaxChildrenElement != "ul" {
+		t.Errorf("Expected <ul> with 3 children, got <%s> with %d", metrics.MaxChildrenElement, metrics.MaxChildren)
+	}
+	if len(metrics.Findings) != 0 {
+		t.Errorf("Expected no findings for a small document, got %v", metrics.Findings)
+	}
+
+	large, err := html.Parse(strings.NewReader("<ul>" + strings.Repeat("<li>item</li>", 900) + "</ul>"))
+	if err != nil {
+		t.Fatalf("Failed to parse HTML: %v", err)
+	}
+	metrics = analyzer.measureDOM(large)
+	subjects := make(map[string]bool)
+	for _, finding := range metrics.Findings {
+		subjects[finding.Subject] = true
+	}
+	if !subjects["node_count"] || !subjects["max_children"] {
+		t.Errorf("Expected node_count and max_children findings, got %v", metrics.Findings)
+	}
+}
+
+func TestFindInlineScripts(t *testing.T) {
+	analyzer := NewAnalyzer(5 * time.Second)
+
+	doc, err := html.Parse(strings.NewReader(`<html><body onload="init()">
+		<button onclick="save()" onmouseover="hover()">Save</button>
+		<a href="javascript:void(0)">Menu</a>
+		<a href="/page">Page</a>
+		<script>var x = eval("1+1"); setTimeout("run()", 10); setTimeout(run, 10);</script>
+		<script src="/app.js"></script>
+	</body></html>`))
+	if err != nil {
+		t.Fatalf("Failed to parse HTML: %v", err)
+	}
+
+	report := analyzer.findInlineScripts(doc)
+	if report.EventHandlerCount != 3 {
+		t.Errorf("Expected 3 event handlers, got %d", report.EventHandlerCount)
+	}
+	if report.EventHandlers["onclick"] != 1 || report.EventHandlers["onload"] != 1 {
+		t.Errorf("Expected onclick and onload counts, got %v", report.EventHandlers)
+	}
+	if report.JavaScriptURLCount != 1 {
+		t.Errorf("Expected 1 javascript: URL, got %d", report.JavaScriptURLCount)
+	}
+	if report.EvalCount != 2 {
+		t.Errorf("Expected 2 eval-style calls, got %d", report.EvalCount)
+	}
+	if len(report.Findings) != 3 {
+		t.Errorf("Expected 3 findings, got %d", len(report.Findings))
+	}
+
+	clean, _ := html.Parse(strings.NewReader(`<html><body><a href="/x">X</a></body></html>`))
+	if report := analyzer.findInlineScripts(clean); report.EventHandlerCount != 0 || len(report.Findings) != 0 {
+		t.Errorf("Expected no inline scripts, got %+v", report)
+	}
+}
+
+func TestDetectConsent(t *testing.T) {
+	testCases := []struct {
+		name      string
+		html      string
+		platforms []string
+		banner    bool
+	}{
+		{
+			name:      "OneTrust script",
+			html:      `<html><head><script src="https://cdn.cookielaw.org/scripttemplates/otSDKStub.js"></script><script>function OptanonWrapper() {}</script></head></html>`,
+			platforms: []string{"OneTrust"},
+			banner:    true,
+		},
+		{
+			name:      "Cookiebot dialog markup",
+			html:      `<html><body><div id="CybotCookiebotDialog">We use cookies</div></body></html>`,
+			platforms: []string{"Cookiebot"},
+			banner:    true,
+		},
+		{
+			name:      "Didomi and custom banner",
+			html:      `<html><head><script src="https://sdk.privacy-center.org/loader.js"></script></head><body><div class="site-cookie-banner">Accept</div></body></html>`,
+			platforms: []string{"Didomi"},
+			banner:    true,
+		},
+		{
+			name:   "Hand-rolled banner",
+			html:   `<html><body><div id="cookie-notice">This site uses cookies</div></body></html>`,
+			banner: true,
+		},
+		{
+			name:   "No consent tooling",
+			html:   `<html><body><p>Cookies are delicious</p></body></html>`,
+			banner: false,
+		},
+	}
+
+	analyzer := NewAnalyzer(5 * time.Second)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader(tc.html))
+			if err != nil {
+				t.Fatalf("Failed to parse HTML: %v", err)
+			}
+
+			info := analyzer.detectConsent(doc)
+			if strings.Join(info.Platforms, ",") != strings.Join(tc.platforms, ",") {
+				t.Errorf("Expected platforms %v, got %v", tc.platforms, info.Platforms)
+			}
+			if info.BannerPresent != tc.banner {
+				t.Errorf("Expected banner present %v, got %v", tc.banner, info.BannerPresent)
+			}
+		})
+	}
+}
+
+func TestDetectPaywall(t *testing.T) {
+	testCases := []struct {
+		name     string
+		html     string
+		found    bool
+		gated    bool
+		vendors  []string
+		sections []string
+	}{
+		{
+			name: "isAccessibleForFree false with gated part",
+			html: `<html><head><script type="application/ld+json">{"@context": "https://schema.org", "@type": "NewsArticle",
+				"isAccessibleForFree": "False",
+				"hasPart": {"@type": "WebPageElement", "isAccessibleForFree": false, "cssSelector": ".paywalled-body"}}</script></head>
+				<body><div class="paywalled-body">Subscribers only</div></body></html>`,
+			found:    true,
+			gated:    true,
+			sections: []string{".paywalled-body"},
+		},
+		{
+			name: "Free article with metering vendor",
+			html: `<html><head><script src="https://cdn.tinypass.com/api/tinypass.min.js"></script>
+				<script type="application/ld+json">{"@type": "Article", "isAccessibleForFree": true}</script></head></html>`,
+			found:   true,
+			gated:   false,
+			vendors: []string{"Piano"},
+		},
+		{
+			name:  "Microdata marker",
+			html:  `<html><body><article itemscope itemtype="https://schema.org/Article"><meta itemprop="isAccessibleForFree" content="https://schema.org/False"></article></body></html>`,
+			found: true,
+			gated: true,
+		},
+		{
+			name:  "Registration wall markup",
+			html:  `<html><body><div id="article-regwall">Register to keep reading</div></body></html>`,
+			found: true,
+			gated: true,
+		},
+		{
+			name:  "No paywall",
+			html:  `<html><body><p>Free to read</p></body></html>`,
+			found: false,
+		},
+	}
+
+	analyzer := NewAnalyzer(5 * time.Second)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader(tc.html))
+			if err != nil {
+				t.Fatalf("Failed to parse HTML: %v", err)
+			}
+
+			info := analyzer.detectPaywall(doc)
+			if (info != nil) != tc.found {
+				t.Fatalf("Expected paywall found %v, got %+v", tc.found, info)
+			}
+			if info == nil {
+				return
+			}
+			if info.LikelyGated != tc.gated {
+				t.Errorf("Expected likely gated %v, got %v (evidence %v)", tc.gated, info.LikelyGated, info.Evidence)
+			}
+			if strings.Join(info.Vendors, ",") != strings.Join(tc.vendors, ",") {
+				t.Errorf("Expected vendors %v, got %v", tc.vendors, info.Vendors)
+			}
+			if strings.Join(info.GatedSections, ",") != strings.Join(tc.sections, ",") {
+				t.Errorf("Expected gated sections %v, got %v", tc.sections, info.GatedSections)
+			}
+		})
+	}
+}
+
+func TestDetectAds(t *testing.T) {
+	analyzer := NewAnalyzer(5 * time.Second)
+
+	doc, err := html.Parse(strings.NewReader(`<html><head>
+		<script async src="https://pagead2.googlesyndication.com/pagead/js/adsbygoogle.js"></script>
+		<script async src="https://securepubads.g.doubleclick.net/tag/js/gpt.js"></script>
+		<script>googletag.cmd.push(function() {
+			googletag.defineSlot('/1234/top', [728, 90], 'div-gpt-ad-1').addService(googletag.pubads());
+			googletag.defineSlot('/1234/side', [300, 250], 'div-gpt-ad-2').addService(googletag.pubads());
+		});</script>
+		<script src="https://cdn.taboola.com/libtrc/site/loader.js"></script>
+	</head><body>
+		<ins class="adsbygoogle" data-ad-slot="1"></ins>
+		<ins class="adsbygoogle" data-ad-slot="2"></ins>
+		<div id="taboola-below-article"></div>
+	</body></html>`))
+	if err != nil {
+		t.Fatalf("Failed to parse HTML: %v", err)
+	}
+
+	info := analyzer.detectAds(doc)
+	if info == nil {
+		t.Fatal("Expected ads to be detected")
+	}
+	expected := "Google AdSense,Google Ad Manager,Taboola"
+	if got := strings.Join(info.Networks, ","); got != expected {
+		t.Errorf("Expected networks %s, got %s", expected, got)
+	}
+	if info.SlotCount != 5 {
+		t.Errorf("Expected 5 ad slots, got %d", info.SlotCount)
+	}
+
+	clean, _ := html.Parse(strings.NewReader(`<html><body><p>No ads here</p></body></html>`))
+	if info := analyzer.detectAds(clean); info != nil {
+		t.Errorf("Expected no ads, got %+v", info)
+	}
+}
+
+func TestDetectPaymentForms(t *testing.T) {
+	analyzer := NewAnalyzer(5 * time.Second)
+
+	testCases := []struct {
+		name      string
+		baseURL   string
+		html      string
+		forms     int
+		providers []string
+		findings  int
+	}{
+		{
+			name:    "Secure card form",
+			baseURL: "https://shop.example.com/checkout",
+			html: `<form action="/pay" method="post"><input autocomplete="cc-number" name="n">
+				<input name="exp_date"><input name="cvc"></form>`,
+			forms:    1,
+			findings: 0,
+		},
+		{
+			name:    "Card form posting over HTTP",
+			baseURL: "https://shop.example.com/checkout",
+			html:    `<form action="http://pay.example.com/charge"><input name="cardNumber"><input name="cvv"></form>`,
+			forms:   1,
+			// Only the insecure form action is flagged
+			findings: 1,
+		},
+		{
+			name:      "Stripe embed on HTTP page",
+			baseURL:   "http://shop.example.com/checkout",
+			html:      `<script src="https://js.stripe.com/v3/"></script><div id="card-element"></div>`,
+			providers: []string{"Stripe"},
+			findings:  1,
+		},
+		{
+			name:    "Regular form",
+			baseURL: "https://example.com/",
+			html:    `<form><input name="email"><input name="message"></form>`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader(tc.html))
+			if err != nil {
+				t.Fatalf("Failed to parse HTML: %v", err)
+			}
+			baseURL, _ := url.Parse(tc.baseURL)
+
+			info := analyzer.detectPaymentForms(doc, baseURL)
+			if tc.forms == 0 && len(tc.providers) == 0 {
+				if info != nil {
+					t.Errorf("Expected no payment info, got %+v", info)
+				}
+				return
+			}
+			if info == nil {
+				t.Fatal("Expected payment info, got nil")
+			}
+			if len(info.Forms) != tc.forms {
+				t.Errorf("Expected %d payment forms, got %d", tc.forms, len(info.Forms))
+			}
+			if strings.Join(info.Providers, ",") != strings.Join(tc.providers, ",") {
+				t.Errorf("Expected providers %v, got %v", tc.providers, info.Providers)
+			}
+			if len(info.Findings) != tc.findings {
+				t.Errorf("Expected %d findings, got %v", tc.findings, info.Findings)
+			}
+		})
+	}
+}
+
+func TestAnalyzeLoginForms(t *testing.T) {
+	analyzer := NewAnalyzer(5 * time.Second)
+
+	testCases := []struct {
+		name     string
+		baseURL  string
+		html     string
+		subjects []string
+	}{
+		{
+			name:    "Secure form",
+			baseURL: "https://example.com/login",
+			html: `<form action="/session" method="post"><input type="hidden" name="csrf_token" value="x">
+				<input type="text" name="username"><input type="password" name="password" autocomplete="current-password"></form>`,
+			subjects: nil,
+		},
+		{
+			name:    "Insecure form",
+			baseURL: "http://example.com/login",
+			html: `<form action="http://example.com/session"><input type="text" name="username">
+				<input type="password" name="password" autocomplete="off"></form>`,
+			subjects: []string{"page", "action", "method", "csrf", "autocomplete"},
+		},
+		{
+			name:    "Token in meta tag",
+			baseURL: "https://example.com/login",
+			html: `<html><head><meta name="csrf-token" content="x"></head><body><form method="post" autocomplete="off">
+				<input type="email" name="email"><input type="password" name="password"></form></body></html>`,
+			subjects: []string{"autocomplete"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader(tc.html))
+			if err != nil {
+				t.Fatalf("Failed to parse HTML: %v", err)
+			}
+			baseURL, _ := url.Parse(tc.baseURL)
+
+			forms := analyzer.analyzeLoginForms(doc, baseURL)
+			if len(forms) != 1 {
+				t.Fatalf("Expected 1 login form, got %d", len(forms))
+			}
+
+			var subjects []string
+			for _, finding := range forms[0].Findings {
+				subjects = append(subjects, finding.Subject)
+			}
+			if strings.Join(subjects, ",") != strings.Join(tc.subjects, ",") {
+				t.Errorf("Expected findings %v, got %v", tc.subjects, subjects)
+			}
+		})
+	}
+}
+
+func TestAnalyzeLinksConcurrent_CancelsOutstandingChecks(t *testing.T) {
+	var started, aborted int32
+	var mu sync.Mutex
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		started++
+		mu.Unlock()
+		select {
+		case <-r.Context().Done():
+			mu.Lock()
+			aborted++
+			mu.Unlock()
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer slow.Close()
+
+	// Use a different host name so the links count as external and get checked
+	external := strings.Replace(slow.URL, "127.0.0.1", "localhost", 1)
+	var links []string
+	for i := 0; i < 8; i++ {
+		links = append(links, fmt.Sprintf("%s/slow/%d", external, i))
+	}
+
+	analyzer := NewAnalyzer(10 * time.Second)
+	baseURL, _ := url.Parse(slow.URL)
+	result := &AnalysisResult{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	analyzer.analyzeLinksConcurrent(ctx, links, baseURL, result)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected link analysis to stop promptly after cancellation, took %v", elapsed)
+	}
+
+	// Give the server a moment to observe the aborted connections
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		done := started > 0 && aborted == started
+		mu.Unlock()
+		if done {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if started == 0 || aborted != started {
+		t.Errorf("Expected all %d in-flight checks to be aborted, got %d", started, aborted)
+	}
+}
+
+func TestCacheManager_ConcurrentAccess(t *testing.T) {
+	cache := NewCacheManager(20 * time.Millisecond)
+	defer cache.Stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				key := fmt.Sprintf("https://example.com/%d", j%25)
+				if j%3 == 0 {
+					cache.Set(key, &AnalysisResult{URL: key})
+				} else if cached, found := cache.Get(key); found && cached.URL != key {
+					t.Errorf("Expected cached URL %s, got %s", key, cached.URL)
+				}
+				if j%50 == 0 {
+					time.Sleep(25 * time.Millisecond)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	total, _ := cache.GetStats()
+	if total > 25 {
+		t.Errorf("Expected at most 25 entries, got %d", total)
+	}
+}
+
+func TestIsInfrastructureError(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"Nil", nil, false},
+		{"Unknown host", &net.DNSError{Err: "no such host", Name: "nope.invalid", IsNotFound: true}, false},
+		{"Resolver timeout", &net.DNSError{Err: "i/o timeout", Name: "example.com", IsTimeout: true}, true},
+		{"Resolver failure", &net.DNSError{Err: "server misbehaving", Name: "example.com", IsTemporary: true}, true},
+		{"Connection refused", &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, false},
+		{"Network unreachable", &net.OpError{Op: "dial", Err: syscall.ENETUNREACH}, true},
+		{"Too many open files", &net.OpError{Op: "dial", Err: syscall.EMFILE}, true},
+		{"Deadline exceeded", context.DeadlineExceeded, true},
+		{"Client cancelled", context.Canceled, false},
+		{"Certificate error", x509.UnknownAuthorityError{}, false},
+		{"Blocked by policy", errBlockedByPolicy, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := IsInfrastructureError(tc.err); got != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestAnalyzeURL_TargetErrorsDoNotTripBreaker(t *testing.T) {
+	// A closed port refuses connections: a problem with the target, not with us
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to reserve a port: %v", err)
+	}
+	target := "http://" + listener.Addr().String()
+	listener.Close()
+
+	analyzer := NewAnalyzer(5 * time.Second)
+	for i := 0; i < DefaultFailureThreshold+1; i++ {
+		result := analyzer.AnalyzeURLWithOptions(context.Background(), fmt.Sprintf("%s/%d", target, i), AnalysisOptions{})
+		if result.Error == nil || result.Error.Code != ErrCodeConnRefused {
+			t.Fatalf("Expected connection refused error, got %v", result.Error)
+		}
+	}
+
+	if analyzer.circuitBreaker.State() != StateClosed {
+		t.Error("Expected circuit breaker to stay closed for target errors")
+	}
+}
+
+func TestAnalyzeLinksConcurrent_SkipsFailingHosts(t *testing.T) {
+	// A server that is closed immediately refuses every connection
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	downURL := strings.Replace(down.URL, "127.0.0.1", "localhost", 1)
+	down.Close()
+
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer healthy.Close()
+
+	var links []string
+	for i := 0; i < 100; i++ {
+		links = append(links, fmt.Sprintf("%s/page/%d", downURL, i))
+	}
+	links = append(links, strings.Replace(healthy.URL, "127.0.0.1", "localhost", 1)+"/ok")
+
+	analyzer := NewAnalyzer(10 * time.Second)
+	baseURL, _ := url.Parse("https://example.com")
+	result := &AnalysisResult{}
+
+	analyzer.analyzeLinksConcurrent(context.Background(), links, baseURL, result)
+
+	if result.SkippedLinks == 0 {
+		t.Error("Expected links to the failing host to be skipped")
+	}
+	if result.InaccessibleLinks+result.SkippedLinks != 100 {
+		t.Errorf("Expected 100 inaccessible or skipped links, got %d inaccessible and %d skipped", result.InaccessibleLinks, result.SkippedLinks)
+	}
+	if len(result.InaccessibleURLs) != result.InaccessibleLinks || !strings.HasPrefix(result.InaccessibleURLs[0], downURL+"/page/") {
+		t.Errorf("Expected the %d inaccessible links to be listed, got %v", result.InaccessibleLinks, result.InaccessibleURLs)
+	}
+	downHost := strings.TrimPrefix(downURL, "http://")
+	if len(result.FailingHosts) != 1 || result.FailingHosts[0] != downHost {
+		t.Errorf("Expected failing hosts [%s], got %v", downHost, result.FailingHosts)
+	}
+}
+
+func TestAnalyzeLinksConcurrent_ReportsUncheckedLinks(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/slow/") {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer slow.Close()
+
+	external := strings.Replace(slow.URL, "127.0.0.1", "localhost", 1)
+	links := []string{external + "/fast"}
+	for i := 0; i < 6; i++ {
+		links = append(links, fmt.Sprintf("%s/slow/%d", external, i))
+	}
+
+	analyzer := NewAnalyzer(10 * time.Second)
+	analyzer.SetLinkCheckDeadline(300 * time.Millisecond)
+	baseURL, _ := url.Parse(slow.URL)
+	result := &AnalysisResult{}
+
+	start := time.Now()
+	analyzer.analyzeLinksConcurrent(context.Background(), links, baseURL, result)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected link analysis to stop at the configured deadline, took %v", elapsed)
+	}
+	if result.UncheckedLinks != 6 {
+		t.Errorf("Expected the 6 slow links to be unchecked, got %d", result.UncheckedLinks)
+	}
+	if result.ExternalLinks != 1 || result.InaccessibleLinks != 0 {
+		t.Errorf("Expected only the fast link to be reported, got %d external and %d inaccessible", result.ExternalLinks, result.InaccessibleLinks)
+	}
+
+	// A caller deadline earlier than the configured one wins
+	analyzer.SetLinkCheckDeadline(0)
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	result = &AnalysisResult{}
+	start = time.Now()
+	analyzer.analyzeLinksConcurrent(ctx, links, baseURL, result)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected link analysis to stop at the caller's deadline, took %v", elapsed)
+	}
+	if result.UncheckedLinks != 6 {
+		t.Errorf("Expected the 6 slow links to be unchecked, got %d", result.UncheckedLinks)
+	}
+}
+
+func TestReadBody(t *testing.T) {
+	body, err := readBody(strings.NewReader("<html>pooled</html>"), 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if body.String() != "<html>pool" {
+		t.Errorf("Expected body truncated to limit, got %q", body.String())
+	}
+	releaseBuffer(body)
+
+	// A recycled buffer must not leak bytes from its previous use
+	body, err = readBody(strings.NewReader("new"), 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if body.String() != "new" {
+		t.Errorf("Expected new, got %q", body.String())
+	}
+	releaseBuffer(body)
+}
+
+// benchmarkPage builds a page with the given number of links
+func benchmarkPage(links int) string {
+	var sb strings.Builder
+	sb.WriteString("<html><head><title>Bench</title></head><body>")
+	for i := 0; i < links; i++ {
+		fmt.Fprintf(&sb, `<div><p>Paragraph %d</p><a href="https://example%d.com/page">Link</a></div>`, i, i%20)
+	}
+	sb.WriteString("</body></html>")
+	return sb.String()
+}
+
+func BenchmarkReadBody(b *testing.B) {
+	page := benchmarkPage(500)
+
+	b.Run("ReadAll", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			body, _ := io.ReadAll(io.LimitReader(strings.NewReader(page), DefaultMaxBodySize+1))
+			_ = body
+		}
+	})
+
+	b.Run("Pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			body, _ := readBody(strings.NewReader(page), DefaultMaxBodySize+1)
+			releaseBuffer(body)
+		}
+	})
+}
+
+func BenchmarkTraverseElements(b *testing.B) {
+	doc, _ := html.Parse(strings.NewReader(benchmarkPage(500)))
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		count := 0
+		NewHTMLTraverser().TraverseElements(doc, "a", func(*html.Node) { count++ })
+	}
+}
+
+func BenchmarkProcessLink(b *testing.B) {
+	baseURL, _ := url.Parse("https://example.com")
+	accessible := func(string) bool { return true }
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		NewLinkProcessor().ProcessLink("https://other.example.org/path?q=1", baseURL, accessible)
+	}
+}
+
+func TestAnalyzeURL_CoalescesConcurrentRequests(t *testing.T) {
+	var mu sync.Mutex
+	fetches := 0
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetches++
+		mu.Unlock()
+		<-release
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Shared</title></head><body></body></html>`))
+	}))
+	defer server.Close()
+
+	// A single analysis may fetch the page more than once (e.g. HTTPS readiness)
+	close(release)
+	NewAnalyzer(10*time.Second).AnalyzeURLWithOptions(context.Background(), server.URL, AnalysisOptions{SkipLinkCheck: true})
+	perAnalysis := fetches
+	fetches = 0
+	release = make(chan struct{})
+
+	analyzer := NewAnalyzer(10 * time.Second)
+
+	// Spellings differing only in host case normalize to the same key
+	targets := []string{server.URL, server.URL, server.URL + "/", server.URL, strings.Replace(server.URL, "http://", "HTTP://", 1)}
+	results := make([]*AnalysisResult, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target string) {
+			defer wg.Done()
+			results[i] = analyzer.AnalyzeURLWithOptions(context.Background(), target, AnalysisOptions{SkipLinkCheck: true})
+		}(i, target)
+	}
+
+	// Let every caller join the in-flight analysis before the page is served
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if fetches != perAnalysis {
+		t.Errorf("Expected %d fetches for concurrent identical analyses, got %d", perAnalysis, fetches)
+	}
+
+	coalesced := 0
+	for i, result := range results {
+		if result.Error != nil {
+			t.Fatalf("Unexpected error: %v", result.Error)
+		}
+		if result.PageTitle != "Shared" {
+			t.Errorf("Expected title Shared, got %s", result.PageTitle)
+		}
+		if result.URL != targets[i] {
+			t.Errorf("Expected URL %s, got %s", targets[i], result.URL)
+		}
+		if result.Coalesced {
+			coalesced++
+		}
+	}
+	if coalesced != len(targets)-1 {
+		t.Errorf("Expected %d coalesced results, got %d", len(targets)-1, coalesced)
+	}
+}
+
+func TestAnalyzeURL_CoalescedCallerCancellation(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Slow</title></head></html>`))
+	}))
+	defer server.Close()
+
+	analyzer := NewAnalyzer(10 * time.Second)
+
+	// The first caller giving up must not fail the analysis for the second
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan *AnalysisResult, 1)
+	go func() {
+		first <- analyzer.AnalyzeURLWithOptions(ctx, server.URL, AnalysisOptions{SkipLinkCheck: true})
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	second := make(chan *AnalysisResult, 1)
+	go func() {
+		second <- analyzer.AnalyzeURLWithOptions(context.Background(), server.URL, AnalysisOptions{SkipLinkCheck: true})
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	if result := <-first; result.Error == nil {
+		t.Error("Expected an error for the cancelled caller")
+	}
+
+	close(release)
+	result := <-second
+	if result.Error != nil || result.PageTitle != "Slow" {
+		t.Errorf("Expected the remaining caller to get the page, got error %v and title %q", result.Error, result.PageTitle)
+	}
+}
+
+func TestAnalyzeURL_AbandonedAnalysisCancelled(t *testing.T) {
+	abandoned := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(abandoned)
+	}))
+	defer server.Close()
+
+	analyzer := NewAnalyzer(10 * time.Second)
+
+	// Once every caller has given up, the shared analysis stops fetching
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan *AnalysisResult, 1)
+	go func() {
+		done <- analyzer.AnalyzeURLWithOptions(ctx, server.URL, AnalysisOptions{SkipLinkCheck: true})
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+
+	select {
+	case <-abandoned:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the abandoned analysis to be cancelled")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if total, _ := analyzer.cacheManager.GetStats(); total != 0 {
+		t.Errorf("Expected the abandoned analysis not to be cached, got %d entries", total)
+	}
+}
+
+func TestCacheManager_NegativeTTL(t *testing.T) {
+	cache := NewCacheManager(time.Hour)
+	defer cache.Stop()
+	cache.SetNegativeTTL(50 * time.Millisecond)
+	cache.SetUncachedErrorCodes(ErrCodeTimeoutError)
+
+	success := &AnalysisResult{URL: "https://ok.example"}
+	failure := &AnalysisResult{URL: "https://down.example", Error: NewAnalysisError(ErrCodeConnRefused, "refused")}
+	timeout := &AnalysisResult{URL: "https://slow.example", Error: NewAnalysisError(ErrCodeTimeoutError, "timeout")}
+
+	cache.Set(success.URL, success)
+	cache.Set(failure.URL, failure)
+	cache.Set(timeout.URL, timeout)
+
+	if _, found := cache.Get(timeout.URL); found {
+		t.Error("Expected uncached error code not to be stored")
+	}
+	if _, found := cache.Get(failure.URL); !found {
+		t.Error("Expected failed result to be cached for the negative TTL")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if _, found := cache.Get(failure.URL); found {
+		t.Error("Expected failed result to expire after the negative TTL")
+	}
+	if _, found := cache.Get(success.URL); !found {
+		t.Error("Expected successful result to outlive the negative TTL")
+	}
+}
+
+func TestAnalyzer_GetMetricsIncludesCacheAndBreaker(t *testing.T) {
+	analyzer := NewAnalyzer(10 * time.Second)
+	defer analyzer.Stop()
+
+	analyzer.cacheManager.Set("https://example.com", &AnalysisResult{URL: "https://example.com"})
+	analyzer.metricsManager.RecordCacheHit()
+	analyzer.metricsManager.RecordCacheHit()
+	analyzer.metricsManager.RecordCacheHit()
+	analyzer.metricsManager.RecordCacheMiss()
+
+	for i := 0; i < DefaultFailureThreshold; i++ {
+		analyzer.circuitBreaker.OnFailure()
+	}
+
+	metrics := analyzer.GetMetrics()
+	if metrics.CacheEntries != 1 {
+		t.Errorf("Expected 1 cache entry, got %d", metrics.CacheEntries)
+	}
+	if ratio := metrics.CacheHitRatio(); ratio != 0.75 {
+		t.Errorf("Expected hit ratio 0.75, got %f", ratio)
+	}
+	if metrics.CircuitBreakerState != "open" {
+		t.Errorf("Expected breaker state open, got %s", metrics.CircuitBreakerState)
+	}
+	if metrics.CircuitBreakerTrips != 1 {
+		t.Errorf("Expected 1 breaker trip, got %d", metrics.CircuitBreakerTrips)
+	}
+	if metrics.CircuitBreakerFailures != DefaultFailureThreshold {
+		t.Errorf("Expected %d consecutive failures, got %d", DefaultFailureThreshold, metrics.CircuitBreakerFailures)
+	}
+}
+
+func TestEventPublishers(t *testing.T) {
+	// Minimal NATS server: greet, accept one PUB and confirm the trailing PING
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	natsMessages := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("INFO {\"server_id\":\"test\"}\r\n"))
+
+		reader := bufio.NewReader(conn)
+		var subject string
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+			switch {
+			case len(fields) == 3 && fields[0] == "PUB":
+				size, _ := strconv.Atoi(fields[2])
+				payload := make([]byte, size+2)
+				io.ReadFull(reader, payload)
+				subject = fields[1]
+				natsMessages <- subject + " " + string(payload[:size])
+			case len(fields) == 1 && fields[0] == "PING":
+				conn.Write([]byte("PONG\r\n"))
+				return
+			}
+		}
+	}()
+
+	produced := make(chan kafkaRecords, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/topics/analyses" || r.Header.Get("Content-Type") != "application/vnd.kafka.json.v2+json" {
+			t.Errorf("Unexpected produce request %s with %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		var records kafkaRecords
+		json.NewDecoder(r.Body).Decode(&records)
+		produced <- records
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Events</title></head><body></body></html>`))
+	}))
+	defer page.Close()
+
+	natsPublisher, err := NewNATSPublisher("nats://"+listener.Addr().String(), "analyses.completed")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	analyzer := NewAnalyzer(10 * time.Second)
+	analyzer.AddEventPublisher(natsPublisher)
+	analyzer.AddEventPublisher(NewKafkaRESTPublisher(proxy.URL, "analyses"))
+
+	analyzer.AnalyzeURLWithOptions(context.Background(), page.URL, AnalysisOptions{SkipLinkCheck: true})
+
+	select {
+	case message := <-natsMessages:
+		subject, payload, _ := strings.Cut(message, " ")
+		var event AnalysisEvent
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			t.Fatalf("Invalid NATS payload: %v", err)
+		}
+		if subject != "analyses.completed" || event.Type != EventAnalysisCompleted || event.Result.PageTitle != "Events" {
+			t.Errorf("Unexpected NATS event on %s: %+v", subject, event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("Expected an event published to NATS")
+	}
+
+	select {
+	case records := <-produced:
+		if len(records.Records) != 1 || !strings.HasPrefix(records.Records[0].Key, page.URL) {
+			t.Errorf("Expected one record keyed by %s, got %+v", page.URL, records.Records)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("Expected an event produced to Kafka")
+	}
+}
+
+func TestNATSPublisher_ReusesConnection(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	// Each connection confirms PINGs until closeAfter PUBs, then hangs up
+	var accepted atomic.Int32
+	closeAfter := 2
+	published := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			go func(conn net.Conn) {
+				defer conn.Close()
+				conn.Write([]byte("INFO {\"server_id\":\"test\"}\r\n"))
+				reader := bufio.NewReader(conn)
+				pubs := 0
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					fields := strings.Fields(line)
+					switch {
+					case len(fields) == 3 && fields[0] == "PUB":
+						size, _ := strconv.Atoi(fields[2])
+						payload := make([]byte, size+2)
+						io.ReadFull(reader, payload)
+						published <- string(payload[:size])
+						pubs++
+					case len(fields) == 1 && fields[0] == "PING":
+						conn.Write([]byte("PONG\r\n"))
+						if pubs == closeAfter {
+							return
+						}
+					}
+				}
+			}(conn)
+		}
+	}()
+
+	publisher, err := NewNATSPublisher("nats://"+listener.Addr().String(), "analyses")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer publisher.Close()
+
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		err := publisher.Publish(ctx, "", []byte(strconv.Itoa(i)))
+		cancel()
+		if err != nil {
+			t.Fatalf("Publish %d failed: %v", i, err)
+		}
+		if got := <-published; got != strconv.Itoa(i) {
+			t.Errorf("Expected event %d, got %s", i, got)
+		}
+	}
+
+	// The first two events share a connection; the third dials again after the server hung up
+	if accepted.Load() != 2 {
+		t.Errorf("Expected 2 connections for 3 events, got %d", accepted.Load())
+	}
+}
+
+// blockingPublisher holds every event until released
+type blockingPublisher struct {
+	release   chan struct{}
+	published atomic.Int32
+}
+
+func (p *blockingPublisher) Publish(ctx context.Context, _ string, _ []byte) error {
+	<-p.release
+	p.published.Add(1)
+	return nil
+}
+
+func TestPublishEvent_QueueFull(t *testing.T) {
+	publisher := &blockingPublisher{release: make(chan struct{})}
+	analyzer := NewAnalyzer(10 * time.Second)
+	analyzer.AddEventPublisher(publisher)
+
+	// The worker holds one event and the queue the next MaxQueuedEvents; the
+	// rest are dropped without waiting for the publisher
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < MaxQueuedEvents+10; i++ {
+			analyzer.publishEvent(&AnalysisResult{URL: "https://example.com/"})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected publishing to a stalled publisher not to block")
+	}
+
+	close(publisher.release)
+	deadline := time.Now().Add(2 * time.Second)
+	for publisher.published.Load() < MaxQueuedEvents && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if published := publisher.published.Load(); published < MaxQueuedEvents || published > MaxQueuedEvents+1 {
+		t.Errorf("Expected %d or %d events published, got %d", MaxQueuedEvents, MaxQueuedEvents+1, published)
+	}
+}
+
+func TestNewNATSPublisher_InvalidURL(t *testing.T) {
+	testCases := []struct {
+		url     string
+		subject string
+	}{
+		{"http://localhost:4222", "analyses"},
+		{"nats://", "analyses"},
+		{"nats://localhost", "bad subject"},
+	}
+
+	for _, tc := range testCases {
+		if _, err := NewNATSPublisher(tc.url, tc.subject); err == nil {
+			t.Errorf("Expected error for %s with subject %q", tc.url, tc.subject)
+		}
+	}
+}
+
+func TestNotifier_Evaluate(t *testing.T) {
+	notifier, err := NewNotifier(NotificationConfig{
+		Rules: []NotificationRule{
+			{Condition: ConditionAnalysisFailed},
+			{Condition: ConditionBrokenLinks, Threshold: 2},
+			{Condition: ConditionLoginFormRemoved},
+			{Name: "title", Condition: ConditionTitleChanged},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		result   *AnalysisResult
+		expected []string
+	}{
+		{"first run", &AnalysisResult{URL: "https://a.test", PageTitle: "Home", HasLoginForm: true}, nil},
+		{"broken links", &AnalysisResult{URL: "https://a.test", PageTitle: "Home", HasLoginForm: true, InaccessibleLinks: 3}, []string{ConditionBrokenLinks}},
+		{"failure keeps state", &AnalysisResult{URL: "https://a.test", Error: NewAnalysisError(ErrCodeNetworkError, "down")}, []string{ConditionAnalysisFailed}},
+		{"login removed and title changed", &AnalysisResult{URL: "https://a.test", PageTitle: "Welcome"}, []string{ConditionLoginFormRemoved, "title"}},
+		{"other page", &AnalysisResult{URL: "https://b.test", PageTitle: "B"}, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var fired []string
+			for _, notification := range notifier.Evaluate(tc.result) {
+				fired = append(fired, notification.Rule)
+			}
+			if strings.Join(fired, ",") != strings.Join(tc.expected, ",") {
+				t.Errorf("Expected %v, got %v", tc.expected, fired)
+			}
+		})
+	}
+}
+
+func TestNotifier_DeliversToWebhooks(t *testing.T) {
+	received := make(chan map[string]interface{}, 2)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		received <- body
+	}))
+	defer hook.Close()
+
+	notifier, err := NewNotifier(NotificationConfig{
+		Webhooks: []Webhook{{URL: hook.URL, Format: WebhookFormatSlack}, {URL: hook.URL}},
+		Rules:    []NotificationRule{{Condition: ConditionAnalysisFailed}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	notifier.notify(&AnalysisResult{URL: "https://down.test", Error: NewAnalysisError(ErrCodeDNSError, "Failed to resolve host")})
+
+	var formats []string
+	for i := 0; i < 2; i++ {
+		select {
+		case body := <-received:
+			if text, ok := body["text"].(string); ok && strings.Contains(text, "down.test") {
+				formats = append(formats, WebhookFormatSlack)
+			} else if body["condition"] == ConditionAnalysisFailed {
+				formats = append(formats, WebhookFormatGeneric)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Expected notifications to be delivered")
+		}
+	}
+	if strings.Join(formats, ",") != "slack,generic" {
+		t.Errorf("Expected slack and generic payloads, got %v", formats)
+	}
+}
+
+func TestNewNotifier_InvalidConfig(t *testing.T) {
+	testCases := []NotificationConfig{
+		{Rules: []NotificationRule{{Condition: "page_slow"}}},
+		{Webhooks: []Webhook{{URL: ""}}},
+		{Webhooks: []Webhook{{URL: "https://hooks.test", Format: "discord"}}},
+	}
+
+	for _, tc := range testCases {
+		if _, err := NewNotifier(tc); err == nil {
+			t.Errorf("Expected error for %+v", tc)
+		}
+	}
+}
+
+// startFakeRedis serves the handful of commands and scripts the shared store uses
+func startFakeRedis(t *testing.T, password string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	var mu sync.Mutex
+	data := make(map[string]string)
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		authenticated := password == ""
+		for {
+			request, err := readRESP(reader)
+			if err != nil {
+				return
+			}
+			args := make([]string, 0)
+			for _, arg := range request.([]interface{}) {
+				args = append(args, arg.(string))
+			}
+
+			mu.Lock()
+			var reply string
+			switch {
+			case args[0] == "AUTH":
+				authenticated = args[1] == password
+				reply = "+OK\r\n"
+				if !authenticated {
+					reply = "-WRONGPASS invalid password\r\n"
+				}
+			case !authenticated:
+				reply = "-NOAUTH Authentication required\r\n"
+			case args[0] == "EVAL" && args[1] == incrScript:
+				value, _ := strconv.Atoi(data[args[3]])
+				data[args[3]] = strconv.Itoa(value + 1)
+				reply = ":" + data[args[3]] + "\r\n"
+				if ttl, err := strconv.Atoi(args[4]); err != nil || ttl <= 0 {
+					reply = "-ERR invalid expire time\r\n"
+				}
+			case args[0] == "GET":
+				value, ok := data[args[1]]
+				reply = "$-1\r\n"
+				if ok {
+					reply = "$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+				}
+			case args[0] == "SET":
+				data[args[1]] = args[2]
+				reply = "+OK\r\n"
+			case args[0] == "DEL":
+				delete(data, args[1])
+				reply = ":1\r\n"
+			default:
+				reply = "-ERR unknown command\r\n"
+			}
+			mu.Unlock()
+			conn.Write([]byte(reply))
+		}
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestRedisClient(t *testing.T) {
+	addr := startFakeRedis(t, "secret")
+	ctx := context.Background()
+
+	client, err := NewRedisClient("redis://:secret@" + addr + "/0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer client.Close()
+
+	for want := int64(1); want <= 3; want++ {
+		if count, err := client.Incr(ctx, "hits", time.Minute); err != nil || count != want {
+			t.Errorf("Expected count %d, got %d (%v)", want, count, err)
+		}
+	}
+	if err := client.Set(ctx, "open", 42, time.Minute); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if value, err := client.Get(ctx, "open"); err != nil || value != 42 {
+		t.Errorf("Expected 42, got %d (%v)", value, err)
+	}
+	client.Delete(ctx, "open")
+	if value, err := client.Get(ctx, "open"); err != nil || value != 0 {
+		t.Errorf("Expected a missing key to read as 0, got %d (%v)", value, err)
+	}
+
+	wrong, _ := NewRedisClient("redis://:wrong@" + addr)
+	if _, err := wrong.Get(ctx, "hits"); err == nil {
+		t.Error("Expected an authentication error")
+	}
+}
+
+func TestNewRedisClient_InvalidURL(t *testing.T) {
+	for _, redisURL := range []string{"http://localhost:6379", "redis://", "redis://localhost/db"} {
+		if _, err := NewRedisClient(redisURL); err == nil {
+			t.Errorf("Expected error for %s", redisURL)
+		}
+	}
+}
+
+func TestCircuitBreaker_SharedStore(t *testing.T) {
+	store := newMemoryStore()
+	replicaA := NewCircuitBreaker(4, time.Minute, DefaultSuccessThreshold)
+	replicaB := NewCircuitBreaker(4, time.Minute, DefaultSuccessThreshold)
+	replicaA.SetSharedStore(store)
+	replicaB.SetSharedStore(store)
+
+	// Failures on either replica count toward the same threshold
+	replicaA.OnFailure()
+	replicaB.OnFailure()
+	replicaA.OnFailure()
+	if !replicaA.CanExecute() || !replicaB.CanExecute() {
+		t.Fatal("Expected both breakers closed below the shared threshold")
+	}
+	replicaB.OnFailure()
+
+	if replicaB.State() != StateOpen {
+		t.Errorf("Expected the replica reaching the threshold to open, got %s", StateName(replicaB.State()))
+	}
+	if replicaA.CanExecute() {
+		t.Error("Expected the other replica to honour the shared open state")
+	}
+	if retry := replicaA.RetryAfter(); retry <= 0 || retry > time.Minute {
+		t.Errorf("Expected a retry delay up to a minute, got %v", retry)
+	}
+
+	// A success anywhere resets the consecutive failure count
+	other := NewCircuitBreaker(2, time.Minute, DefaultSuccessThreshold)
+	other.SetSharedStore(newMemoryStore())
+	other.OnFailure()
+	other.OnSuccess()
+	other.OnFailure()
+	if other.State() != StateClosed {
+		t.Error("Expected non-consecutive failures to leave the breaker closed")
+	}
+}
+
+func TestHostRateLimit(t *testing.T) {
+	var mu sync.Mutex
+	var requests []time.Time
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, time.Now())
+		mu.Unlock()
+	}))
+	defer page.Close()
+
+	analyzer := NewAnalyzer(10 * time.Second)
+	analyzer.SetSharedStore(newMemoryStore())
+	analyzer.SetHostRateLimit(2)
+
+	client := analyzer.getHTTPClient()
+	defer analyzer.putHTTPClient(client)
+	for i := 0; i < 4; i++ {
+		resp, err := client.Get(page.URL)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	// At most two requests fit into any one-second window
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) != 4 {
+		t.Fatalf("Expected 4 requests, got %d", len(requests))
+	}
+	if requests[2].Truncate(time.Second).Equal(requests[0].Truncate(time.Second)) {
+		t.Errorf("Expected the third request to wait for the next window, got %v and %v", requests[0], requests[2])
+	}
+
+	// A cancelled request gives up instead of waiting for capacity
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", page.URL, nil)
+	if _, err := client.Do(req); err == nil {
+		t.Error("Expected a cancelled request to fail")
+	}
+}
+
+// testPlugin adapts a function to AnalysisPlugin
+type testPlugin struct {
+	name    string
+	analyze func(doc *html.Node) ([]PluginFinding, error)
+}
+
+func (p testPlugin) Name() string { return p.name }
+
+func (p testPlugin) Analyze(ctx context.Context, doc *html.Node, resp *http.Response, result *AnalysisResult) ([]PluginFinding, error) {
+	return p.analyze(doc)
+}
+
+func TestPlugins(t *testing.T) {
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Plugins</title><script src="/consent/v2.js"></script></head><body></body></html>`))
+	}))
+	defer page.Close()
+
+	consentSnippet := testPlugin{name: "consent-snippet", analyze: func(doc *html.Node) ([]PluginFinding, error) {
+		found := false
+		NewHTMLTraverser().TraverseElements(doc, "script", func(n *html.Node) {
+			if strings.Contains(NewHTMLTraverser().GetAttributeValue(n, "src"), "/consent/v2.js") {
+				found = true
+			}
+		})
+		return []PluginFinding{{Check: "consent_banner_snippet", Passed: found, Severity: "error"}}, nil
+	}}
+	failing := testPlugin{name: "failing", analyze: func(*html.Node) ([]PluginFinding, error) {
+		return nil, errors.New("lookup failed")
+	}}
+	panicking := testPlugin{name: "panicking", analyze: func(*html.Node) ([]PluginFinding, error) {
+		panic("boom")
+	}}
+
+	analyzer := NewAnalyzer(10 * time.Second)
+	analyzer.AddPlugin(consentSnippet)
+	analyzer.AddPlugin(failing)
+	analyzer.AddPlugin(panicking)
+
+	result := analyzer.AnalyzeURLWithOptions(context.Background(), page.URL, AnalysisOptions{SkipLinkCheck: true})
+	if result.Error != nil {
+		t.Fatalf("Unexpected error: %v", result.Error)
+	}
+	if len(result.Plugins) != 3 {
+		t.Fatalf("Expected 3 plugin reports, got %+v", result.Plugins)
+	}
+	if report := result.Plugins[0]; report.Plugin != "consent-snippet" || len(report.Findings) != 1 || !report.Findings[0].Passed {
+		t.Errorf("Expected the consent snippet check to pass, got %+v", report)
+	}
+	if report := result.Plugins[1]; report.Error != "lookup failed" {
+		t.Errorf("Expected the plugin error to be reported, got %+v", report)
+	}
+	if report := result.Plugins[2]; !strings.Contains(report.Error, "panicked") {
+		t.Errorf("Expected the plugin panic to be contained, got %+v", report)
+	}
+}
+
+func TestRegisterPlugin(t *testing.T) {
+	plugin := testPlugin{name: "registered-test-plugin", analyze: func(*html.Node) ([]PluginFinding, error) { return nil, nil }}
+	RegisterPlugin(plugin)
+	defer func() {
+		pluginsMu.Lock()
+		delete(registeredPlugins, plugin.name)
+		pluginsMu.Unlock()
+	}()
+
+	if names := NewAnalyzer(time.Second).Plugins(); len(names) != 1 || names[0] != plugin.name {
+		t.Errorf("Expected new analyzers to run the registered plugin, got %v", names)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected registering a duplicate name to panic")
+		}
+	}()
+	RegisterPlugin(plugin)
+}
+
+func TestLoadPlugins(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "README.txt"), []byte("not a plugin"), 0o600)
+
+	plugins, err := LoadPlugins(dir)
+	if err != nil || len(plugins) != 0 {
+		t.Errorf("Expected no plugins and no error, got %d (%v)", len(plugins), err)
+	}
+	if _, err := LoadPlugins(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expected an error for a missing directory")
+	}
+
+	os.WriteFile(filepath.Join(dir, "broken.so"), []byte("not an ELF file"), 0o600)
+	if _, err := LoadPlugins(dir); err == nil {
+		t.Error("Expected an error for an invalid shared object")
+	}
+}
+
+func TestCompileSelector(t *testing.T) {
+	doc, _ := html.Parse(strings.NewReader(`<html><body>
+		<div id="product" class="card featured">
+			<h1 class="title">Widget</h1>
+			<span class="price" data-currency="EUR">19.99</span>
+			<ul><li><a href="/a" rel="nofollow noopener">A</a></li><li><a href="https://other.example/b">B</a></li></ul>
+		</div>
+		<p class="price">Unrelated</p>
+	</body></html>`))
+
+	testCases := []struct {
+		selector string
+		expected int
+	}{
+		{"span.price", 1},
+		{".price", 2},
+		{"#product .price", 1},
+		{"div.card.featured > h1", 1},
+		{"div > a", 0},
+		{"ul a", 2},
+		{"a[href^='https://']", 1},
+		{`a[rel~=nofollow]`, 1},
+		{"[data-currency=EUR]", 1},
+		{"h1, p.price", 2},
+		{"*", 12},
+	}
+
+	for _, tc := range testCases {
+		sel, err := compileSelector(tc.selector)
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %v", tc.selector, err)
+			continue
+		}
+		if got := len(sel.matchAll(doc)); got != tc.expected {
+			t.Errorf("Expected %d matches for %q, got %d", tc.expected, tc.selector, got)
+		}
+	}
+
+	for _, invalid := range []string{"", "a,", "a:hover", "h1 + p", "[href", "div >", "a[href|=en]"} {
+		if _, err := compileSelector(invalid); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
+
+func TestCustomFields(t *testing.T) {
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Product</title><meta name="author" content="Jane Doe"></head><body>
+			<span class="price">
+				19.99 EUR
+			</span>
+			<a class="tag">red</a><a class="tag">large</a>
+		</body></html>`))
+	}))
+	defer page.Close()
+
+	analyzer := NewAnalyzer(10 * time.Second)
+	if err := analyzer.SetExtractionRules([]ExtractionRule{
+		{Name: "price", Selector: ".price"},
+		{Name: "author", Selector: "meta[name=author]", Attribute: "content"},
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	result := analyzer.AnalyzeURLWithOptions(context.Background(), page.URL, AnalysisOptions{
+		SkipLinkCheck: true,
+		ExtractionRules: []ExtractionRule{
+			{Name: "tags", Selector: "a.tag", All: true},
+			{Name: "author", Selector: "title"},
+			{Name: "missing", Selector: "#nothing"},
+		},
+	})
+	if result.Error != nil {
+		t.Fatalf("Unexpected error: %v", result.Error)
+	}
+
+	expected := map[string]string{"price": "19.99 EUR", "author": "Product", "tags": "red | large"}
+	if len(result.CustomFields) != len(expected) {
+		t.Errorf("Expected %d custom fields, got %v", len(expected), result.CustomFields)
+	}
+	for name, value := range expected {
+		if result.CustomFields[name] != value {
+			t.Errorf("Expected %s=%q, got %q", name, value, result.CustomFields[name])
+		}
+	}
+
+	if err := ValidateExtractionRules([]ExtractionRule{{Name: "a", Selector: "p"}, {Name: "a", Selector: "h1"}}); err == nil {
+		t.Error("Expected error for duplicate rule names")
+	}
+}
+
+func TestAssertions(t *testing.T) {
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("X-Version", "42")
+		if r.URL.Path == "/gone" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`<html><head><title>Status</title><script>var hidden = "Outage";</script></head>
+			<body><h1>All   systems operational</h1><p>Build 1.2.3</p></body></html>`))
+	}))
+	defer page.Close()
+
+	analyzer := NewAnalyzer(10 * time.Second)
+
+	assertions := []Assertion{
+		{Type: AssertText, Value: "All systems operational"},
+		{Type: AssertText, Value: "Outage", Not: true},
+		{Type: AssertRegex, Value: `Build \d+\.\d+\.\d+`},
+		{Type: AssertHeader, Name: "X-Version", Value: "42"},
+		{Type: AssertStatus, Value: "200"},
+		{Type: AssertText, Value: "Maintenance"},
+	}
+	result := analyzer.AnalyzeURLWithOptions(context.Background(), page.URL, AnalysisOptions{SkipLinkCheck: true, Assertions: assertions})
+	if result.Assertions == nil {
+		t.Fatal("Expected an assertion report")
+	}
+	expected := []bool{true, true, true, true, true, false}
+	for i, passed := range expected {
+		if result.Assertions.Results[i].Passed != passed {
+			t.Errorf("Expected assertion %d passed=%v, got %+v", i, passed, result.Assertions.Results[i])
+		}
+	}
+	if result.Assertions.Passed || result.Assertions.Failed != 1 {
+		t.Errorf("Expected 1 failed assertion, got %+v", result.Assertions)
+	}
+
+	// Status and header assertions still apply to error responses; body assertions fail
+	result = analyzer.AnalyzeURLWithOptions(context.Background(), page.URL+"/gone", AnalysisOptions{
+		SkipLinkCheck: true,
+		Assertions: []Assertion{
+			{Type: AssertStatus, Value: "404"},
+			{Type: AssertHeader, Name: "X-Version", Value: "41", Not: true},
+			{Type: AssertText, Value: "Not Found", Not: true},
+		},
+	})
+	if result.Assertions == nil {
+		t.Fatal("Expected an assertion report for an error response")
+	}
+	expected = []bool{true, true, false}
+	for i, passed := range expected {
+		if result.Assertions.Results[i].Passed != passed {
+			t.Errorf("Expected assertion %d passed=%v, got %+v", i, passed, result.Assertions.Results[i])
+		}
+	}
+
+	testCases := []struct {
+		name      string
+		assertion Assertion
+	}{
+		{"unknown type", Assertion{Type: "xpath", Value: "//h1"}},
+		{"empty text", Assertion{Type: AssertText}},
+		{"bad regex", Assertion{Type: AssertRegex, Value: "("}},
+		{"missing header name", Assertion{Type: AssertHeader, Value: "x"}},
+		{"bad status", Assertion{Type: AssertStatus, Value: "abc"}},
+	}
+	for _, tc := range testCases {
+		if err := ValidateAssertions([]Assertion{tc.assertion}); err == nil {
+			t.Errorf("Expected validation error for %s", tc.name)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/busy":
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		case "/once":
+			if hits.Add(1) == 1 {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>OK</title></head><body></body></html>`))
+	}))
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+	host := serverURL.Hostname()
+	analyzer := NewAnalyzer(10 * time.Second)
+
+	// A short Retry-After is waited out and the request retried
+	start := time.Now()
+	result := analyzer.AnalyzeURLWithOptions(context.Background(), server.URL+"/once", AnalysisOptions{SkipLinkCheck: true})
+	if result.Error != nil {
+		t.Fatalf("Expected the retried request to succeed, got %v", result.Error)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Expected to wait out Retry-After, took %v", elapsed)
+	}
+
+	// A Retry-After beyond the budget is reported at once
+	result = analyzer.AnalyzeURLWithOptions(context.Background(), server.URL+"/busy", AnalysisOptions{SkipLinkCheck: true})
+	if result.Error == nil || result.Error.RetryAfterSeconds != 60 {
+		t.Fatalf("Expected a rate limited error with retry_after_seconds 60, got %v", result.Error)
+	}
+
+	throttled := analyzer.GetMetrics().ThrottledHosts
+	if len(throttled) != 1 || throttled[0].Host != host {
+		t.Fatalf("Expected throttling recorded for %s, got %+v", host, throttled)
+	}
+	stats := throttled[0]
+	if stats.Throttled != 2 || stats.Retried != 1 || stats.GaveUp != 1 || stats.WaitedMs < 1000 || stats.LastRetryAfter != 60 {
+		t.Errorf("Unexpected throttling stats: %+v", stats)
+	}
+
+	// With no budget the 429 is returned without waiting
+	hits.Store(0)
+	analyzer = NewAnalyzer(10 * time.Second)
+	analyzer.SetRetryAfterBudget(0)
+	result = analyzer.AnalyzeURLWithOptions(context.Background(), server.URL+"/once", AnalysisOptions{SkipLinkCheck: true})
+	if result.Error == nil || result.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Expected an immediate 429 with no budget, got status %d", result.StatusCode)
+	}
+}
+
+func TestOutboundBudget(t *testing.T) {
+	var linkChecks atomic.Int32
+	links := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		linkChecks.Add(1)
+	}))
+	defer links.Close()
+
+	// External links are checked; localhost is a different host from the page's 127.0.0.1
+	external := strings.Replace(links.URL, "127.0.0.1", "localhost", 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<html><head><title>Links</title></head><body>
+			<a href="%[1]s/a">a</a><a href="%[1]s/b">b</a><a href="%[1]s/c">c</a><a href="%[1]s/d">d</a><a href="%[1]s/e">e</a>
+		</body></html>`, external)
+	}))
+	defer server.Close()
+
+	// Measure what an unlimited analysis uses
+	analyzer := NewAnalyzer(10 * time.Second)
+	result := analyzer.AnalyzeURL(server.URL)
+	unlimited := result.Outbound
+	if unlimited == nil || unlimited.Exhausted || linkChecks.Load() != 5 {
+		t.Fatalf("Expected 5 link checks without limits, got %d and usage %+v", linkChecks.Load(), unlimited)
+	}
+
+	// Allow all but two of those requests
+	linkChecks.Store(0)
+	analyzer = NewAnalyzer(10 * time.Second)
+	analyzer.SetOutboundBudget(unlimited.Requests-2, 0)
+	result = analyzer.AnalyzeURL(server.URL)
+	if result.Error != nil {
+		t.Fatalf("Unexpected error: %v", result.Error)
+	}
+
+	usage := result.Outbound
+	if usage.Requests != unlimited.Requests-2 || !usage.Exhausted || usage.Skipped != 2 || len(usage.SkippedURLs) != 2 {
+		t.Errorf("Expected %d requests and 2 skipped, got %+v", unlimited.Requests-2, usage)
+	}
+	if checks := linkChecks.Load(); checks != 3 {
+		t.Errorf("Expected 3 link checks within the budget, got %d", checks)
+	}
+	if result.SkippedLinks != 2 || result.InaccessibleLinks != 0 {
+		t.Errorf("Expected 2 skipped and no inaccessible links, got %d skipped and %d inaccessible", result.SkippedLinks, result.InaccessibleLinks)
+	}
+}
+
+func TestAnalysisWorkerPool(t *testing.T) {
+	counters := &workerPoolCounters{}
+	release := make(chan struct{})
+	pool := NewAnalysisWorkerPool(2, 8, func(ctx context.Context, job AnalysisJob) LinkResult {
+		<-release
+		return LinkResult{Link: job.Link, IsAccessible: true}
+	}, counters)
+
+	ctx := context.Background()
+	pool.Start(ctx)
+	for i := 0; i < 5; i++ {
+		if err := pool.Submit(ctx, AnalysisJob{Link: fmt.Sprintf("https://example.com/%d", i)}); err != nil {
+			t.Fatalf("Unexpected submit error: %v", err)
+		}
+	}
+	pool.Close()
+
+	// Both workers block on the first two jobs, leaving three queued
+	deadline := time.Now().Add(2 * time.Second)
+	for counters.busy.Load() != 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	stats := counters.snapshot(DefaultWorkerPoolConfig())
+	if stats.ActivePools != 1 || stats.Workers != 2 || stats.BusyWorkers != 2 || stats.QueueDepth != 3 || stats.QueueCapacity != 8 || stats.Utilization != 1 {
+		t.Errorf("Unexpected stats while saturated: %+v", stats)
+	}
+
+	close(release)
+	received := 0
+	for range pool.Results() {
+		received++
+		if received == 5 {
+			break
+		}
+	}
+	pool.Wait()
+
+	stats = counters.snapshot(DefaultWorkerPoolConfig())
+	if stats.ActivePools != 0 || stats.Workers != 0 || stats.QueueDepth != 0 || stats.JobsProcessed != 5 {
+		t.Errorf("Unexpected stats after the pool finished: %+v", stats)
+	}
+}
+
+func TestSetWorkerPoolConfig(t *testing.T) {
+	analyzer := NewAnalyzer(5 * time.Second)
+
+	testCases := []struct {
+		name     string
+		config   WorkerPoolConfig
+		expected WorkerPoolConfig
+	}{
+		{"defaults", WorkerPoolConfig{}, DefaultWorkerPoolConfig()},
+		{"custom", WorkerPoolConfig{MinWorkers: 2, MaxWorkers: 8, QueueMultiplier: 2}, WorkerPoolConfig{MinWorkers: 2, MaxWorkers: 8, QueueMultiplier: 2}},
+		{"max below min", WorkerPoolConfig{MinWorkers: 10, MaxWorkers: 5}, WorkerPoolConfig{MinWorkers: 10, MaxWorkers: 10, QueueMultiplier: BufferMultiplier}},
+	}
+	for _, tc := range testCases {
+		analyzer.SetWorkerPoolConfig(tc.config)
+		if got := analyzer.WorkerPoolConfig(); got != tc.expected {
+			t.Errorf("%s: expected %+v, got %+v", tc.name, tc.expected, got)
+		}
+	}
+
+	// Pools are clamped to the configured bounds
+	analyzer.SetWorkerPoolConfig(WorkerPoolConfig{MinWorkers: 2, MaxWorkers: 8})
+	if pool := analyzer.newLinkCheckPool(1000, nil); pool.workers != 8 || cap(pool.jobQueue) != 8*BufferMultiplier {
+		t.Errorf("Expected 8 workers and a queue of %d, got %d and %d", 8*BufferMultiplier, pool.workers, cap(pool.jobQueue))
+	}
+	if pool := analyzer.newLinkCheckPool(1, nil); pool.workers != 2 {
+		t.Errorf("Expected 2 workers for a small page, got %d", pool.workers)
+	}
+	if stats := analyzer.GetMetrics().WorkerPool; stats.MaxWorkers != 8 {
+		t.Errorf("Expected metrics to report max_workers 8, got %+v", stats)
+	}
+}
+
+func TestAdaptiveLimit(t *testing.T) {
+	counters := &workerPoolCounters{}
+	limit := newAdaptiveLimit(2, 16, counters)
+	ctx := context.Background()
+
+	// Run a round of checks at the current limit, all with the same result
+	round := func(result LinkResult) {
+		t.Helper()
+		n := int(limit.limit)
+		starts := make([]time.Time, n)
+		for i := range starts {
+			started, err := limit.acquire(ctx)
+			if err != nil {
+				t.Fatalf("Unexpected acquire error: %v", err)
+			}
+			starts[i] = started
+		}
+		for _, started := range starts {
+			limit.release(started, &result)
+		}
+	}
+
+	// Slow start doubles the limit every round of healthy checks, up to the maximum
+	healthy := LinkResult{StatusCode: http.StatusOK, Latency: 50 * time.Millisecond}
+	for _, expected := range []int64{4, 8, 16, 16} {
+		round(healthy)
+		if got := counters.limit.Load(); got != expected {
+			t.Fatalf("Expected a limit of %d, got %d", expected, got)
+		}
+	}
+
+	// A round of rate limited checks halves the limit once
+	round(LinkResult{StatusCode: http.StatusTooManyRequests})
+	if counters.limit.Load() != 8 || counters.backoffs.Load() != 1 {
+		t.Fatalf("Expected one backoff to 8, got %d after %d backoffs", counters.limit.Load(), counters.backoffs.Load())
+	}
+	// Timeouts and slow checks back off too, never below the minimum
+	round(LinkResult{CheckError: context.DeadlineExceeded})
+	round(LinkResult{StatusCode: http.StatusOK, Latency: AdaptiveSlowCheck + time.Second})
+	round(LinkResult{CheckError: context.DeadlineExceeded})
+	if counters.limit.Load() != 2 || counters.backoffs.Load() != 4 {
+		t.Fatalf("Expected the minimum limit after 4 backoffs, got %d after %d", counters.limit.Load(), counters.backoffs.Load())
+	}
+
+	// After a backoff the limit grows by about one per round
+	round(healthy)
+	round(healthy)
+	if counters.limit.Load() != 3 {
+		t.Errorf("Expected additive increase to 3, got %d", counters.limit.Load())
+	}
+
+	// Checks wait for a slot until one is released
+	held := make([]time.Time, int(limit.limit))
+	for i := range held {
+		held[i], _ = limit.acquire(ctx)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := limit.acquire(waitCtx); err == nil {
+		t.Error("Expected acquire to wait while the limit is reached")
+	}
+	for _, started := range held {
+		limit.release(started, nil)
+	}
+
+	limit.close()
+	if counters.limit.Load() != 0 {
+		t.Errorf("Expected the limit withdrawn from metrics, got %d", counters.limit.Load())
+	}
+}
+
+func TestRobotsTxtRules(t *testing.T) {
+	robots := parseRobotsTxt(`
+# Comments are ignored
+User-agent: *
+Disallow: /private
+Allow: /private/open
+
+User-agent: Googlebot
+User-agent: Bingbot
+Disallow: /search
+Disallow: /*.pdf$
+Allow: /search/help
+
+Sitemap: https://example.com/sitemap.xml
+`)
+
+	testCases := []struct {
+		agent   string
+		path    string
+		allowed bool
+		rule    string
+	}{
+		{"googlebot", "/", true, ""},
+		{"googlebot", "/search?q=go", false, "Disallow: /search"},
+		{"googlebot", "/search/help", true, "Allow: /search/help"},
+		{"googlebot", "/docs/guide.pdf", false, "Disallow: /*.pdf$"},
+		{"googlebot", "/docs/guide.pdf?download=1", true, ""},
+		{"googlebot", "/private", true, ""}, // the googlebot group replaces *
+		{"otherbot", "/private/page", false, "Disallow: /private"},
+		{"otherbot", "/private/open/page", true, "Allow: /private/open"},
+		{"otherbot", "/robots.txt", true, ""},
+	}
+
+	for _, tc := range testCases {
+		allowed, rule := robots.allowed(tc.agent, tc.path)
+		if allowed != tc.allowed || rule != tc.rule {
+			t.Errorf("%s %s: expected %v (%q), got %v (%q)", tc.agent, tc.path, tc.allowed, tc.rule, allowed, rule)
+		}
+	}
+	if len(robots.sitemaps) != 1 || robots.sitemaps[0] != "https://example.com/sitemap.xml" {
+		t.Errorf("Expected the listed sitemap, got %v", robots.sitemaps)
+	}
+}
+
+func TestRobotsConsistency(t *testing.T) {
+	var serverURL string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprintf(w, "User-agent: *\nDisallow: /blocked\nSitemap: %s/sitemap_index.xml\n", serverURL)
+		case "/sitemap_index.xml":
+			fmt.Fprintf(w, `<?xml version="1.0"?><sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"><sitemap><loc>%s/pages.xml</loc></sitemap></sitemapindex>`, serverURL)
+		case "/pages.xml":
+			fmt.Fprintf(w, `<?xml version="1.0"?><urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"><url><loc>%[1]s/noindex</loc></url><url><loc>%[1]s/blocked</loc></url></urlset>`, serverURL)
+		case "/header-noindex":
+			w.Header().Set("X-Robots-Tag", "googlebot: noindex, nofollow")
+			w.Write([]byte(`<html><head><title>Page</title></head><body></body></html>`))
+		case "/noindex":
+			w.Write([]byte(`<html><head><meta name="robots" content="noindex, follow"></head><body></body></html>`))
+		default:
+			w.Write([]byte(`<html><head><title>Page</title></head><body></body></html>`))
+		}
+	}))
+	defer server.Close()
+	serverURL = server.URL
+
+	analyzer := NewAnalyzer(10 * time.Second)
+
+	testCases := []struct {
+		path       string
+		indexable  bool
+		blocked    bool
+		inSitemap  bool
+		consistent bool
+	}{
+		{"/ok", true, false, false, true},
+		{"/noindex", false, false, true, false},
+		{"/blocked", true, true, true, false},
+		{"/header-noindex", false, false, false, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			result := analyzer.AnalyzeURLWithOptions(context.Background(), server.URL+tc.path, AnalysisOptions{SkipLinkCheck: true, CheckRobots: true})
+			report := result.Robots
+			if report == nil {
+				t.Fatalf("Expected a robots report, got error %v", result.Error)
+			}
+			if report.Indexable != tc.indexable || report.BlockedByRobotsTxt != tc.blocked ||
+				report.InSitemap != tc.inSitemap || report.Consistent != tc.consistent {
+				t.Errorf("Expected indexable=%v blocked=%v in_sitemap=%v consistent=%v, got %+v",
+					tc.indexable, tc.blocked, tc.inSitemap, tc.consistent, report)
+			}
+			if result.Noindex == tc.indexable {
+				t.Errorf("Expected noindex=%v, got %v", !tc.indexable, result.Noindex)
+			}
+		})
+	}
+}
+
+func TestValidateStructuredData(t *testing.T) {
+	analyzer := NewAnalyzer(10 * time.Second)
+
+	testCases := []struct {
+		name     string
+		scripts  string
+		errors   int
+		warnings int
+		issues   []string // properties expected to be reported
+	}{
+		{
+			"complete article",
+			`{"@context": "https://schema.org", "@type": "Article", "headline": "News", "image": "a.jpg", "author": {"@type": "Person", "name": "A"}, "datePublished": "2024-01-01", "dateModified": "2024-01-02"}`,
+			0, 0, nil,
+		},
+		{
+			"article missing headline",
+			`{"@context": "https://schema.org", "@type": "NewsArticle", "image": "a.jpg"}`,
+			1, 3, []string{"headline", "author", "datePublished", "dateModified"},
+		},
+		{
+			"product offers",
+			`{"@type": "Product", "name": "Shoe", "image": "s.jpg", "description": "d", "brand": "b", "sku": "1", "offers": [{"@type": "Offer", "priceCurrency": "EUR"}, {"@type": "AggregateOffer", "lowPrice": 10}]}`,
+			2, 1, []string{"offers[0].price", "offers[0].availability", "offers[1].priceCurrency"},
+		},
+		{
+			"product without offers",
+			`{"@type": "schema:Product", "name": "Shoe", "image": "s.jpg", "description": "d", "brand": "b", "sku": "1"}`,
+			1, 0, []string{"offers"},
+		},
+		{
+			"faq in graph",
+			`{"@context": "https://schema.org", "@graph": [{"@type": "WebPage"}, {"@type": "FAQPage", "mainEntity": [{"@type": "Question", "name": "Q?", "acceptedAnswer": {"@type": "Answer"}}]}]}`,
+			1, 0, []string{"mainEntity[0].acceptedAnswer[0].text"},
+		},
+		{
+			"breadcrumbs",
+			`{"@type": "BreadcrumbList", "itemListElement": [{"@type": "ListItem", "position": 1, "item": {"@id": "/", "name": "Home"}}, {"@type": "ListItem", "position": 2, "name": "Shoes"}, {"@type": "ListItem", "name": "Red"}]}`,
+			2, 0, []string{"itemListElement[1].item", "itemListElement[2].position"},
+		},
+		{
+			"invalid json",
+			`{"@type": "Article", "headline": }`,
+			1, 0, nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader(`<html><head><script type="application/ld+json">` + tc.scripts + `</script></head><body></body></html>`))
+			if err != nil {
+				t.Fatalf("Failed to parse HTML: %v", err)
+			}
+			report := analyzer.validateStructuredData(doc)
+			if report == nil {
+				t.Fatal("Expected a structured data report")
+			}
+			if report.Errors != tc.errors || report.Warnings != tc.warnings || report.Valid != (tc.errors == 0) {
+				t.Errorf("Expected %d errors and %d warnings, got %+v", tc.errors, tc.warnings, report)
+			}
+			var properties []string
+			for _, item := range report.Items {
+				for _, issue := range item.Issues {
+					properties = append(properties, issue.Property)
+				}
+			}
+			if strings.Join(properties, " ") != strings.Join(tc.issues, " ") {
+				t.Errorf("Expected issues for %v, got %v", tc.issues, properties)
+			}
+		})
+	}
+
+	doc, _ := html.Parse(strings.NewReader(`<html><head><script type="text/javascript">var a = 1;</script></head></html>`))
+	if report := analyzer.validateStructuredData(doc); report != nil {
+		t.Errorf("Expected no report without JSON-LD, got %+v", report)
+	}
+}
+
+func TestValidateStructuredData_Markup(t *testing.T) {
+	analyzer := NewAnalyzer(10 * time.Second)
+	doc, err := html.Parse(strings.NewReader(`<html><head>
+		<meta property="og:title" content="Shoe">
+		<script type="application/ld+json">{"@type": "WebSite", "name": "Shop"}</script>
+	</head><body>
+		<div itemscope itemtype="https://schema.org/Product">
+			<h1 itemprop="name">Red shoe</h1>
+			<img itemprop="image" src="shoe.jpg">
+			<p itemprop="description">A shoe</p>
+			<div itemprop="offers" itemscope itemtype="https://schema.org/Offer">
+				<meta itemprop="priceCurrency" content="EUR">
+				<span itemprop="price" content="49.00">€49</span>
+				<link itemprop="availability" href="https://schema.org/InStock">
+			</div>
+			<div itemprop="brand" itemscope itemtype="https://schema.org/Brand"><span itemprop="name">Acme</span></div>
+		</div>
+		<div vocab="https://schema.org/" typeof="FAQPage">
+			<div property="mainEntity" typeof="Question">
+				<h2 property="name">Sizes?</h2>
+				<div property="acceptedAnswer" typeof="Answer"><p property="text">All of them</p></div>
+			</div>
+			<div property="mainEntity" typeof="Question"><h2 property="name">Colors?</h2></div>
+		</div>
+		<article typeof="schema:Article"><h1 property="schema:headline">News</h1></article>
+	</body></html>`))
+	if err != nil {
+		t.Fatalf("Failed to parse HTML: %v", err)
+	}
+
+	report := analyzer.validateStructuredData(doc)
+	if report == nil {
+		t.Fatal("Expected a structured data report")
+	}
+	if !reflect.DeepEqual(report.Types, []string{"Article", "FAQPage", "Product", "WebSite"}) {
+		t.Errorf("Expected the detected types, got %v", report.Types)
+	}
+	if report.Blocks != 1 || len(report.Items) != 4 {
+		t.Fatalf("Expected one JSON-LD block and four items, got %+v", report)
+	}
+
+	issues := make(map[string][]string)
+	for _, item := range report.Items {
+		key := item.Format + " " + item.Type
+		issues[key] = []string{}
+		for _, issue := range item.Issues {
+			issues[key] = append(issues[key], issue.Property)
+		}
+	}
+	expected := map[string][]string{
+		"json-ld WebSite":   {},
+		"microdata Product": {"sku"},
+		"rdfa FAQPage":      {"mainEntity[1].acceptedAnswer"},
+		"rdfa Article":      {"image", "author", "datePublished", "dateModified"},
+	}
+	if !reflect.DeepEqual(issues, expected) {
+		t.Errorf("Expected issues %v, got %v", expected, issues)
+	}
+}
+
+func TestCheckHreflangReciprocity(t *testing.T) {
+	en := HreflangLink{Lang: "en", URL: "https://example.com/en"}
+	de := HreflangLink{Lang: "de", URL: "https://example.com/de"}
+	fr := HreflangLink{Lang: "fr", URL: "https://example.com/fr"}
+	external := HreflangLink{Lang: "es", URL: "https://example.es/"}
+
+	testCases := []struct {
+		name       string
+		pages      []HreflangPage
+		issues     []string
+		unverified int
+	}{
+		{
+			"reciprocal",
+			[]HreflangPage{
+				{URL: "https://example.com/en", Alternates: []HreflangLink{en, de, external}},
+				{URL: "https://EXAMPLE.com/de#top", Alternates: []HreflangLink{en, de}},
+			},
+			nil, 1,
+		},
+		{
+			"missing return link and self reference",
+			[]HreflangPage{
+				{URL: "https://example.com/en", Alternates: []HreflangLink{en, de, fr}},
+				{URL: "https://example.com/de", Alternates: []HreflangLink{en}},
+				{URL: "https://example.com/fr"},
+			},
+			[]string{HreflangMissingReturnLink, HreflangMissingSelfReference}, 0,
+		},
+		{
+			"language mismatch after redirect",
+			[]HreflangPage{
+				{URL: "https://example.com/", FinalURL: "https://example.com/en", Alternates: []HreflangLink{en, de}},
+				{URL: "https://example.com/de", Alternates: []HreflangLink{en, {Lang: "de-at", URL: "https://example.com/de"}}},
+			},
+			[]string{HreflangLanguageMismatch}, 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			report := CheckHreflangReciprocity(tc.pages)
+			var issues []string
+			for _, issue := range report.Issues {
+				issues = append(issues, issue.Type)
+			}
+			if strings.Join(issues, " ") != strings.Join(tc.issues, " ") {
+				t.Errorf("Expected issues %v, got %+v", tc.issues, report.Issues)
+			}
+			if report.Unverified != tc.unverified || report.Consistent != (len(tc.issues) == 0) {
+				t.Errorf("Expected %d unverified alternates, got %+v", tc.unverified, report)
+			}
+		})
+	}
+
+	analyzer := NewAnalyzer(10 * time.Second)
+	doc, _ := html.Parse(strings.NewReader(`<html><head>
+		<link rel="alternate" hreflang="EN" href="/en">
+		<link rel="Alternate" hreflang="x-default" href="https://example.com/">
+		<link rel="canonical" href="/de">
+		<link rel="alternate" href="/feed.xml"></head></html>`))
+	baseURL, _ := url.Parse("https://example.com/de")
+	alternates := analyzer.extractHreflang(doc, baseURL)
+	expected := []HreflangLink{{Lang: "en", URL: "https://example.com/en"}, {Lang: "x-default", URL: "https://example.com/"}}
+	if len(alternates) != len(expected) || alternates[0] != expected[0] || alternates[1] != expected[1] {
+		t.Errorf("Expected alternates %v, got %v", expected, alternates)
+	}
+}
+
+func TestAuditResponsiveImages(t *testing.T) {
+	analyzer := NewAnalyzer(10 * time.Second)
+
+	testCases := []struct {
+		name     string
+		body     string
+		expected ResponsiveImageReport
+		findings []string // finding subjects in order
+	}{
+		{
+			"responsive image",
+			`<img src="a.jpg" srcset="a-480.jpg 480w, a-960.jpg 960w" sizes="(max-width: 600px) 480px, 960px" width="960" height="540">`,
+			ResponsiveImageReport{Images: 1, WithSrcset: 1},
+			nil,
+		},
+		{
+			"large image without variants",
+			`<img src="hero.jpg" width="1200" height="600"><img src="icon.png" width="32px" height="32px">`,
+			ResponsiveImageReport{Images: 2, LargeWithoutVariants: 1},
+			[]string{"hero.jpg"},
+		},
+		{
+			"picture sources",
+			`<picture><source srcset="b.avif 1x, b@2x.avif 2x" type="image/avif"><img src="b.jpg" width="1200" height="600"></picture>`,
+			ResponsiveImageReport{Images: 1, InPicture: 1},
+			nil,
+		},
+		{
+			"missing dimensions and sizes",
+			`<img src="c.jpg" srcset="c-480.jpg 480w, c-960.jpg 960w">`,
+			ResponsiveImageReport{Images: 1, WithSrcset: 1, MissingDimensions: 1},
+			[]string{"c.jpg", "c.jpg"},
+		},
+		{
+			"invalid srcset",
+			`<img src="d.jpg" srcset="d-1.jpg 1x, d-2.jpg 960w" width="10" height="10">`,
+			ResponsiveImageReport{Images: 1, WithSrcset: 1},
+			[]string{"d.jpg"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader("<html><body>" + tc.body + "</body></html>"))
+			if err != nil {
+				t.Fatalf("Failed to parse HTML: %v", err)
+			}
+			report := analyzer.auditResponsiveImages(doc)
+			if report == nil {
+				t.Fatal("Expected a responsive image report")
+			}
+			var subjects []string
+			for _, finding := range report.Findings {
+				subjects = append(subjects, finding.Subject)
+			}
+			if report.Images != tc.expected.Images || report.WithSrcset != tc.expected.WithSrcset ||
+				report.InPicture != tc.expected.InPicture || report.MissingDimensions != tc.expected.MissingDimensions ||
+				report.LargeWithoutVariants != tc.expected.LargeWithoutVariants {
+				t.Errorf("Expected %+v, got %+v", tc.expected, *report)
+			}
+			if strings.Join(subjects, " ") != strings.Join(tc.findings, " ") {
+				t.Errorf("Expected findings for %v, got %+v", tc.findings, report.Findings)
+			}
+		})
+	}
+
+	doc, _ := html.Parse(strings.NewReader("<html><body><p>No images</p></body></html>"))
+	if report := analyzer.auditResponsiveImages(doc); report != nil {
+		t.Errorf("Expected no report without images, got %+v", report)
+	}
+}
+
+func TestExtractLinks(t *testing.T) {
+	analyzer := NewAnalyzer(10 * time.Second)
+	pageURL, _ := url.Parse("https://example.com/docs/page.html")
+
+	testCases := []struct {
+		name     string
+		document string
+		expected []string
+	}{
+		{
+			"anchors, areas and navigation links",
+			`<head><link rel="stylesheet" href="/style.css"><link rel="icon" href="/favicon.ico"><link rel="next" href="page2.html"><link rel="Alternate" hreflang="de" href="/de/"></head>
+			<body><a href="intro.html">Intro</a><a href="#top">Top</a><map><area href="/map/north" alt="North"><area nohref alt="None"></map></body>`,
+			[]string{"page2.html", "/de/", "intro.html", "/map/north"},
+		},
+		{
+			"base href",
+			`<head><base href="/v2/"><link rel="prev" href="page0.html"></head><body><a href="intro.html">Intro</a><a href="https://other.test/x">X</a><a href="#top">Top</a></body>`,
+			[]string{"https://example.com/v2/page0.html", "https://example.com/v2/intro.html", "https://other.test/x"},
+		},
+		{
+			"base without href",
+			`<head><base target="_blank"></head><body><a href="intro.html">Intro</a></body>`,
+			[]string{"intro.html"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader("<html>" + tc.document + "</html>"))
+			if err != nil {
+				t.Fatalf("Failed to parse HTML: %v", err)
+			}
+			links := analyzer.extractLinks(doc, pageURL)
+			if strings.Join(links, " ") != strings.Join(tc.expected, " ") {
+				t.Errorf("Expected links %v, got %v", tc.expected, links)
+			}
+		})
+	}
+}
+
+func TestAuditNewTabLinks(t *testing.T) {
+	analyzer := NewAnalyzer(10 * time.Second)
+
+	testCases := []struct {
+		name     string
+		document string
+		expected *NewTabLinkReport
+	}{
+		{
+			"target blank",
+			`<body><a href="/a" target="_blank" rel="noopener noreferrer">A</a><a href="/b" target="_BLANK">B</a>
+			<a href="/c" target="_blank" rel="noreferrer">C</a><a href="/d" target="help">D</a><a href="/e" target="_self">E</a></body>`,
+			&NewTabLinkReport{NewTabLinks: 4, MissingNoopener: 2, Examples: []string{"/b", "/d"}},
+		},
+		{
+			"base target",
+			`<head><base target="_blank"></head><body><a href="/a">A</a><a href="/b" target="_self">B</a><map><area href="/c" rel="noopener"></map><a name="anchor">No href</a></body>`,
+			&NewTabLinkReport{NewTabLinks: 2, FromBaseTarget: 2, BaseTarget: "_blank", MissingNoopener: 1, Examples: []string{"/a"}},
+		},
+		{
+			"no new tabs",
+			`<body><a href="/a">A</a></body>`,
+			nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader("<html>" + tc.document + "</html>"))
+			if err != nil {
+				t.Fatalf("Failed to parse HTML: %v", err)
+			}
+			report := analyzer.auditNewTabLinks(doc)
+			if (report == nil) != (tc.expected == nil) {
+				t.Fatalf("Expected report %+v, got %+v", tc.expected, report)
+			}
+			if report == nil {
+				return
+			}
+			if report.NewTabLinks != tc.expected.NewTabLinks || report.FromBaseTarget != tc.expected.FromBaseTarget ||
+				report.BaseTarget != tc.expected.BaseTarget || report.MissingNoopener != tc.expected.MissingNoopener ||
+				strings.Join(report.Examples, " ") != strings.Join(tc.expected.Examples, " ") {
+				t.Errorf("Expected %+v, got %+v", tc.expected, report)
+			}
+		})
+	}
+}
+
+func TestMeasureSnippet(t *testing.T) {
+	analyzer := NewAnalyzer(10 * time.Second)
+	// text repeats ordinary words to n characters
+	text := func(n int) string {
+		return strings.Repeat("the quick brown fox jumps over a lazy dog ", 10)[:n]
+	}
+	description := func(n int) string {
+		return `<meta name="Description" content="` + text(n) + `">`
+	}
+
+	testCases := []struct {
+		name               string
+		title              string
+		head               string
+		titleVerdict       string
+		descriptionVerdict string
+		descriptionLength  int
+	}{
+		{"missing", "", "", SnippetMissing, SnippetMissing, 0},
+		{"too short", "Home", description(50), SnippetTooShort, SnippetTooShort, 50},
+		{"ok", text(55), description(140), SnippetOK, SnippetOK, 140},
+		{"too many characters", strings.Repeat("i", 61), description(161), SnippetTooLong, SnippetTooLong, 161},
+		// 55 wide capitals fit the character limit but overflow 600 pixels
+		{"too wide", strings.Repeat("W", 55), description(140), SnippetTooLong, SnippetOK, 140},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader("<html><head>" + tc.head + "</head></html>"))
+			if err != nil {
+				t.Fatalf("Failed to parse HTML: %v", err)
+			}
+			report := analyzer.measureSnippet(doc, tc.title)
+			if report.Title.Verdict != tc.titleVerdict {
+				t.Errorf("Expected title verdict %s, got %s (%+v)", tc.titleVerdict, report.Title.Verdict, report.Title)
+			}
+			if report.MetaDescription.Verdict != tc.descriptionVerdict {
+				t.Errorf("Expected description verdict %s, got %s", tc.descriptionVerdict, report.MetaDescription.Verdict)
+			}
+			if report.MetaDescription.Characters != tc.descriptionLength {
+				t.Errorf("Expected description length %d, got %d", tc.descriptionLength, report.MetaDescription.Characters)
+			}
+		})
+	}
+
+	// Custom thresholds apply, with unset values keeping the defaults
+	custom := NewAnalyzer(10 * time.Second)
+	custom.SetSnippetThresholds(SnippetThresholds{TitleMinChars: 3, TitleMaxChars: 10})
+	doc, _ := html.Parse(strings.NewReader("<html></html>"))
+	report := custom.measureSnippet(doc, "Home")
+	if report.Title.Verdict != SnippetOK || report.Title.MaxPixels != DefaultSnippetThresholds().TitleMaxPixels {
+		t.Errorf("Expected custom thresholds with default pixels, got %+v", report.Title)
+	}
+	if width := textWidth("Home", titleFontSize); width != 53 {
+		t.Errorf("Expected width 53, got %d", width)
+	}
+}
+
+func TestExtractPageTitle(t *testing.T) {
+	analyzer := NewAnalyzer(10 * time.Second)
+
+	testCases := []struct {
+		name          string
+		document      string
+		expectedTitle string
+		expectedCount int
+	}{
+		{"single", `<head><title>Home</title></head>`, "Home", 1},
+		{"missing", `<head></head><body>No title</body>`, "", 0},
+		{"empty", `<head><title>  </title></head>`, "", 1},
+		{"multiple uses first", `<head><title>First</title><title>Second</title></head>`, "First", 2},
+		{"entities", `<head><title>Tom &amp; Jerry &#8211; Caf&eacute;&nbsp;Menu</title></head>`, "Tom & Jerry – Café Menu", 1},
+		{"whitespace collapsed", "<head><title>\n  Line one\n\tline two  </title></head>", "Line one line two", 1},
+		{"svg title skipped", `<head></head><body><svg><title>Icon</title></svg></body>`, "", 0},
+		{"title in body", `<body><title>Late</title></body>`, "Late", 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader("<html>" + tc.document + "</html>"))
+			if err != nil {
+				t.Fatalf("Failed to parse HTML: %v", err)
+			}
+			title, count := analyzer.extractPageTitle(doc)
+			if title != tc.expectedTitle {
+				t.Errorf("Expected title %q, got %q", tc.expectedTitle, title)
+			}
+			if count != tc.expectedCount {
+				t.Errorf("Expected %d titles, got %d", tc.expectedCount, count)
+			}
+		})
+	}
+
+	// Text split across several nodes is joined
+	doc, _ := html.Parse(strings.NewReader("<html><head><title>Split</title></head></html>"))
+	titleNode := doc.FirstChild.FirstChild.FirstChild
+	titleNode.AppendChild(&html.Node{Type: html.TextNode, Data: " title"})
+	if title, _ := analyzer.extractPageTitle(doc); title != "Split title" {
+		t.Errorf("Expected joined title, got %q", title)
+	}
+}
+
+func TestExtractSEOMetadata(t *testing.T) {
+	analyzer := NewAnalyzer(10 * time.Second)
+	baseURL, _ := url.Parse("https://example.com/blog/post")
+
+	testCases := []struct {
+		name     string
+		document string
+		expected SEOMetadata
+	}{
+		{
+			"complete",
+			`<head>
+				<meta name="Description" content="  A post
+					about things ">
+				<meta name="keywords" content="go, web ,, page analysis ">
+				<link rel="canonical" href="/blog/post">
+				<meta name="robots" content="NoIndex, follow">
+				<meta name="viewport" content="width=device-width,  initial-scale=1">
+			</head>`,
+			SEOMetadata{
+				Description: "A post about things",
+				Keywords:    []string{"go", "web", "page analysis"},
+				Canonical:   "https://example.com/blog/post",
+				Robots:      []string{"noindex", "follow"},
+				Viewport:    "width=device-width, initial-scale=1",
+			},
+		},
+		{"missing", `<head><title>Bare</title></head>`, SEOMetadata{}},
+		{
+			"first tag wins",
+			`<head>
+				<meta name="description" content="First"><meta name="description" content="Second">
+				<link rel="canonical" href="https://example.com/a"><link rel="canonical" href="https://example.com/b">
+			</head>`,
+			SEOMetadata{Description: "First", Canonical: "https://example.com/a"},
+		},
+		{
+			"robots combined",
+			`<head><meta name="robots" content="noindex"><meta name="robots" content="nofollow"></head>`,
+			SEOMetadata{Robots: []string{"noindex", "nofollow"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader("<html>" + tc.document + "</html>"))
+			if err != nil {
+				t.Fatalf("Failed to parse HTML: %v", err)
+			}
+			seo := analyzer.extractSEOMetadata(doc, baseURL)
+			if !reflect.DeepEqual(*seo, tc.expected) {
+				t.Errorf("Expected %+v, got %+v", tc.expected, *seo)
+			}
+		})
+	}
+}
+
+func TestAuditSocialImages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.png" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+	}))
+	defer server.Close()
+
+	analyzer := NewAnalyzer(10 * time.Second)
+	baseURL, _ := url.Parse(server.URL + "/page")
+	doc, err := html.Parse(strings.NewReader(`<html><head>
+		<meta property="og:image" content="/preview.png">
+		<meta property="og:image:width" content="1200"><meta property="og:image:height" content="630">
+		<meta property="og:image" content="/missing.png">
+		<meta name="twitter:image" content="/preview.png">
+		<meta property="og:image:width" content="wide">
+	</head></html>`))
+	if err != nil {
+		t.Fatalf("Failed to parse HTML: %v", err)
+	}
+
+	report := analyzer.auditSocialImages(context.Background(), doc, baseURL, true)
+	if report == nil || len(report.Images) != 3 {
+		t.Fatalf("Expected 3 social images, got %+v", report)
+	}
+	first := report.Images[0]
+	if first.Property != SocialImageOpenGraph || first.URL != server.URL+"/preview.png" || first.Width != 1200 || first.Height != 630 {
+		t.Errorf("Expected og:image with dimensions, got %+v", first)
+	}
+	if report.Images[2].Property != SocialImageTwitter {
+		t.Errorf("Expected twitter:image, got %s", report.Images[2].Property)
+	}
+	for i, expected := range []bool{true, false, true} {
+		if accessible := report.Images[i].Accessible; accessible == nil || *accessible != expected {
+			t.Errorf("Expected image %d accessible %v, got %v", i, expected, accessible)
+		}
+	}
+	if report.Broken != 1 {
+		t.Errorf("Expected 1 broken image, got %d", report.Broken)
+	}
+	if report.MissingDimensions != 1 {
+		t.Errorf("Expected 1 og:image missing dimensions, got %d", report.MissingDimensions)
+	}
+
+	// Without checks the images are listed but not judged
+	unchecked := analyzer.auditSocialImages(context.Background(), doc, baseURL, false)
+	if unchecked.Broken != 0 || unchecked.Images[1].Accessible != nil {
+		t.Errorf("Expected unchecked images, got %+v", unchecked)
+	}
+
+	empty, _ := html.Parse(strings.NewReader("<html></html>"))
+	if report := analyzer.auditSocialImages(context.Background(), empty, baseURL, true); report != nil {
+		t.Errorf("Expected no report without social images, got %+v", report)
+	}
+}
+
+func TestAuditImages(t *testing.T) {
+	var heads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		heads.Add(1)
+		switch r.URL.Path {
+		case "/missing.png":
+			http.NotFound(w, r)
+		case "/hero.jpg":
+			w.Header().Set("Content-Length", "204800")
+		case "/logo.png":
+			w.Header().Set("Content-Length", "4096")
+		}
+	}))
+	defer server.Close()
+
+	analyzer := NewAnalyzer(10 * time.Second)
+	baseURL, _ := url.Parse(server.URL + "/page")
+	doc, err := html.Parse(strings.NewReader(`<html><body>
+		<img src="/logo.png" alt="Example">
+		<img src="/hero.jpg" alt="">
+		<img src="/hero.jpg#large">
+		<img src="/missing.png">
+		<img src="/dynamic.svg" alt="Chart">
+		<img src="data:image/gif;base64,R0lGODlhAQABAAAAACw=" alt="Pixel">
+	</body></html>`))
+	if err != nil {
+		t.Fatalf("Failed to parse HTML: %v", err)
+	}
+
+	report := analyzer.auditImages(context.Background(), doc, baseURL, true)
+	if report == nil {
+		t.Fatal("Expected an image report")
+	}
+	if report.Images != 6 || report.MissingAlt != 2 || report.EmptyAlt != 1 || report.AltCoverage != 66.7 {
+		t.Errorf("Expected 6 images, 2 missing alt, 1 empty alt and 66.7%% coverage, got %+v", report)
+	}
+	if report.Checked != 4 || heads.Load() != 4 {
+		t.Errorf("Expected 4 distinct HTTP images checked, got %d (%d requests)", report.Checked, heads.Load())
+	}
+	if len(report.Broken) != 1 || report.Broken[0].URL != server.URL+"/missing.png" || report.Broken[0].StatusCode != http.StatusNotFound {
+		t.Errorf("Expected the missing image to be broken, got %+v", report.Broken)
+	}
+	// The image declaring no Content-Length is not listed
+	expected := []ImageSize{{server.URL + "/hero.jpg", 204800}, {server.URL + "/logo.png", 4096}}
+	if !reflect.DeepEqual(report.Largest, expected) {
+		t.Errorf("Expected images by size %v, got %v", expected, report.Largest)
+	}
+
+	// Without checks only the markup is counted
+	heads.Store(0)
+	unchecked := analyzer.auditImages(context.Background(), doc, baseURL, false)
+	if unchecked.Checked != 0 || unchecked.Broken != nil || unchecked.Largest != nil || heads.Load() != 0 {
+		t.Errorf("Expected unchecked images, got %+v", unchecked)
+	}
+
+	empty, _ := html.Parse(strings.NewReader("<html></html>"))
+	if report := analyzer.auditImages(context.Background(), empty, baseURL, true); report != nil {
+		t.Errorf("Expected no report without images, got %+v", report)
+	}
+}
+
+func TestHostReputation(t *testing.T) {
+	var requests atomic.Int32
+	alive := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer alive.Close()
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer dead.Close()
+
+	path := filepath.Join(t.TempDir(), "hosts.json")
+	analyzer := NewAnalyzer(10 * time.Second)
+	if err := analyzer.LoadHostReputation(path); err != nil {
+		t.Fatalf("Failed to load host reputation: %v", err)
+	}
+
+	ctx := context.Background()
+	for i := 0; i < ReputationDeadChecks; i++ {
+		analyzer.checkLinkStatus(ctx, alive.URL+"/page")
+		analyzer.checkLinkStatus(ctx, dead.URL+"/page")
+	}
+	requests.Store(0)
+	if _, _, err := analyzer.checkLinkStatus(ctx, dead.URL+"/other"); !errors.Is(err, errKnownDeadHost) || requests.Load() != 0 {
+		t.Errorf("Expected the dead host to fail without a request, got %v after %d requests", err, requests.Load())
+	}
+	if status, _, err := analyzer.checkLinkStatus(ctx, alive.URL+"/other"); status != http.StatusOK || err != nil {
+		t.Errorf("Expected the live host to be checked, got %d, %v", status, err)
+	}
+
+	hosts := analyzer.HostReputations()
+	if len(hosts) != 2 {
+		t.Fatalf("Expected 2 hosts, got %+v", hosts)
+	}
+	live, failing := hosts[0], hosts[1]
+	if live.Host != strings.TrimPrefix(alive.URL, "http://") {
+		live, failing = failing, live
+	}
+	if live.Checks != ReputationDeadChecks+1 || live.SuccessRate != 100 || live.Dead || live.LastSuccessAt == nil {
+		t.Errorf("Expected a healthy host, got %+v", live)
+	}
+	// Fast hosts get the shortest timeout once enough checks succeeded
+	if live.TimeoutMs != ReputationMinTimeout.Milliseconds() {
+		t.Errorf("Expected a %v timeout, got %dms", ReputationMinTimeout, live.TimeoutMs)
+	}
+	if failing.Checks != ReputationDeadChecks || failing.SuccessRate != 0 || !failing.Dead || failing.TimeoutMs != LinkCheckTimeout.Milliseconds() {
+		t.Errorf("Expected a dead host, got %+v", failing)
+	}
+
+	// The table survives a restart
+	if err := analyzer.SaveHostReputation(); err != nil {
+		t.Fatalf("Failed to save host reputation: %v", err)
+	}
+	restarted := NewAnalyzer(10 * time.Second)
+	if err := restarted.LoadHostReputation(path); err != nil {
+		t.Fatalf("Failed to reload host reputation: %v", err)
+	}
+	if reloaded := restarted.HostReputations(); !reflect.DeepEqual(reloaded, analyzer.HostReputations()) {
+		t.Errorf("Expected the reloaded table to match, got %+v", reloaded)
+	}
+
+	// Dead hosts are checked again once the recheck interval has passed
+	samples := []reputationSample{}
+	for i := 0; i < ReputationDeadChecks; i++ {
+		samples = append(samples, reputationSample{At: time.Now().Add(-ReputationRecheckAfter)})
+	}
+	if hostDead(samples, time.Now()) {
+		t.Error("Expected a dead host to be due for another check")
+	}
+}
+
+func TestCheckAMPPair(t *testing.T) {
+	pages := map[string]string{
+		"/article":      `<html><head><link rel="canonical" href="/article"><link rel="amphtml" href="/article/amp"></head></html>`,
+		"/article/amp":  `<html amp><head><link rel="canonical" href="/article"></head></html>`,
+		"/orphan":       `<html><head><link rel="amphtml" href="/orphan/amp"></head></html>`,
+		"/orphan/amp":   `<html ⚡><head><link rel="canonical" href="/elsewhere"></head></html>`,
+		"/plain":        `<html><head><link rel="amphtml" href="/plain/amp"></head></html>`,
+		"/plain/amp":    `<html><head><link rel="canonical" href="/plain"></head></html>`,
+		"/standalone":   `<html amp><head><link rel="canonical" href="/standalone"></head></html>`,
+		"/no-canonical": `<html amp><head></head></html>`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(page))
+	}))
+	defer server.Close()
+
+	analyzer := NewAnalyzer(10 * time.Second)
+
+	testCases := []struct {
+		name           string
+		path           string
+		document       string
+		expectedIssues []string
+		expectedNil    bool
+	}{
+		{"canonical page with reciprocal amp", "/article", pages["/article"], nil, false},
+		{"amp page with reciprocal canonical", "/article/amp", pages["/article/amp"], nil, false},
+		{"amp page not linking back", "/orphan", pages["/orphan"], []string{AMPMissingReturnLink}, false},
+		{"amphtml target is not amp", "/plain", pages["/plain"], []string{AMPNotAMP}, false},
+		{"amp target missing", "/broken", `<html><head><link rel="amphtml" href="/broken/amp"></head></html>`, []string{AMPCounterpartUnreachable}, false},
+		{"canonical elsewhere", "/copy", `<html><head><link rel="canonical" href="/article"><link rel="amphtml" href="/article/amp"></head></html>`,
+			[]string{AMPCanonicalNotSelf, AMPMissingReturnLink}, false},
+		{"standalone amp", "/standalone", pages["/standalone"], nil, false},
+		{"amp without canonical", "/no-canonical", pages["/no-canonical"], []string{AMPMissingCanonical}, false},
+		{"no amp", "/other", `<html><head><link rel="canonical" href="/other"></head></html>`, nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader(tc.document))
+			if err != nil {
+				t.Fatalf("Failed to parse HTML: %v", err)
+			}
+			baseURL, _ := url.Parse(server.URL + tc.path)
+			report := analyzer.checkAMPPair(context.Background(), doc, baseURL, "", true)
+			if tc.expectedNil {
+				if report != nil {
+					t.Errorf("Expected no report, got %+v", report)
+				}
+				return
+			}
+			if report == nil {
+				t.Fatal("Expected a report, got nil")
+			}
+			var issues []string
+			for _, issue := range report.Issues {
+				issues = append(issues, issue.Type)
+			}
+			if strings.Join(issues, ",") != strings.Join(tc.expectedIssues, ",") {
+				t.Errorf("Expected issues %v, got %+v", tc.expectedIssues, report.Issues)
+			}
+			if report.Consistent != (len(tc.expectedIssues) == 0) {
+				t.Errorf("Expected consistent %v, got %v", len(tc.expectedIssues) == 0, report.Consistent)
+			}
+		})
+	}
+
+	// Without checks the counterpart is not fetched
+	doc, _ := html.Parse(strings.NewReader(`<html><head><link rel="amphtml" href="/broken/amp"></head></html>`))
+	baseURL, _ := url.Parse(server.URL + "/broken")
+	if report := analyzer.checkAMPPair(context.Background(), doc, baseURL, "", false); report.Counterpart != "" || !report.Consistent {
+		t.Errorf("Expected an unchecked consistent report, got %+v", report)
+	}
+}
+
+func TestDetectInterstitials(t *testing.T) {
+	article := "<article><p>" + strings.Repeat("This paragraph is the real article text of the page. ", 6) + "</p></article>"
+	testCases := []struct {
+		name     string
+		html     string
+		kinds    []string
+		replaces bool
+	}{
+		{
+			name:     "Age gate replacing the page",
+			html:     `<html><head><title>Welcome</title></head><body><div class="age-gate-modal"><h2>Are you over 21?</h2><button>Yes</button><button>No</button></div></body></html>`,
+			kinds:    []string{InterstitialAgeGate},
+			replaces: true,
+		},
+		{
+			name:     "Cookie wall prompt",
+			html:     `<html><body><h1>Accept cookies to continue</h1><button>Accept</button></body></html>`,
+			kinds:    []string{InterstitialCookieWall},
+			replaces: true,
+		},
+		{
+			name:     "Full-screen overlay over content",
+			html:     `<html><body><div style="position: fixed; inset: 0; z-index: 1000">Subscribe to our newsletter</div>` + article + `</body></html>`,
+			kinds:    []string{InterstitialOverlay},
+			replaces: false,
+		},
+		{
+			name: "Hidden modal",
+			html: `<html><body><div class="interstitial" style="display: none">Later</div>` + article + `</body></html>`,
+		},
+		{
+			name: "Regular page",
+			html: `<html><body>` + article + `</body></html>`,
+		},
+	}
+
+	analyzer := NewAnalyzer(5 * time.Second)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader(tc.html))
+			if err != nil {
+				t.Fatalf("Failed to parse HTML: %v", err)
+			}
+
+			report := analyzer.detectInterstitials(doc)
+			if len(tc.kinds) == 0 {
+				if report != nil {
+					t.Errorf("Expected no interstitial, got %+v", report)
+				}
+				return
+			}
+			if report == nil {
+				t.Fatalf("Expected interstitial kinds %v, got none", tc.kinds)
+			}
+			if strings.Join(report.Kinds, ",") != strings.Join(tc.kinds, ",") {
+				t.Errorf("Expected kinds %v, got %v (evidence %v)", tc.kinds, report.Kinds, report.Evidence)
+			}
+			if report.ReplacesContent != tc.replaces {
+				t.Errorf("Expected replaces content %v, got %v", tc.replaces, report.ReplacesContent)
+			}
+			if len(report.Findings) != 1 {
+				t.Errorf("Expected one finding, got %v", report.Findings)
+			}
+		})
+	}
+}
+
+func TestDetectClientSideRendering(t *testing.T) {
+	analyzer := NewAnalyzer(10 * time.Second)
+	baseURL, _ := url.Parse("https://example.com/page")
+	article := "<p>" + strings.Repeat("Server rendered text. ", 20) + "</p>"
+
+	testCases := []struct {
+		name               string
+		document           string
+		expectedTargets    []string
+		expectedFrameworks []string
+		expectedEmptyShell bool
+		expectedRendering  bool
+		expectedNil        bool
+	}{
+		{
+			"script redirects",
+			`<script>if (window.location.href == "x") {} window.location.href = "/login"; location.replace('https://other.example/')</script>`,
+			[]string{"https://example.com/login", "https://other.example/"}, nil, false, true, false,
+		},
+		{
+			"computed target",
+			`<script>top.location = target + "?next=1"</script>`,
+			[]string{""}, nil, false, true, false,
+		},
+		{
+			"meta refresh",
+			`<head><meta http-equiv="Refresh" content="5; URL='/moved'"><meta http-equiv="refresh" content="30"></head>`,
+			[]string{"https://example.com/moved"}, nil, false, true, false,
+		},
+		{
+			"next.js shell",
+			`<body><div id="__next"></div><script id="__NEXT_DATA__" type="application/json">{}</script></body>`,
+			nil, []string{"Next.js"}, true, true, false,
+		},
+		{
+			"server rendered react",
+			`<body><div id="root" data-reactroot="">` + article + `</div></body>`,
+			nil, []string{"React"}, false, false, false,
+		},
+		{
+			"static page",
+			`<body>` + article + `</body>`,
+			nil, nil, false, false, true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader("<html>" + tc.document + "</html>"))
+			if err != nil {
+				t.Fatalf("Failed to parse HTML: %v", err)
+			}
+			report := analyzer.detectClientSideRendering(doc, baseURL)
+			if tc.expectedNil {
+				if report != nil {
+					t.Errorf("Expected no report, got %+v", report)
+				}
+				return
+			}
+			if report == nil {
+				t.Fatal("Expected a report, got nil")
+			}
+			var targets []string
+			for _, redirect := range report.Redirects {
+				targets = append(targets, redirect.Target)
+			}
+			if strings.Join(targets, " ") != strings.Join(tc.expectedTargets, " ") || len(targets) != len(tc.expectedTargets) {
+				t.Errorf("Expected redirect targets %q, got %+v", tc.expectedTargets, report.Redirects)
+			}
+			if strings.Join(report.Frameworks, ",") != strings.Join(tc.expectedFrameworks, ",") {
+				t.Errorf("Expected frameworks %v, got %v", tc.expectedFrameworks, report.Frameworks)
+			}
+			if report.EmptyShell != tc.expectedEmptyShell || report.RenderingRecommended != tc.expectedRendering {
+				t.Errorf("Expected empty shell %v and rendering %v, got %+v", tc.expectedEmptyShell, tc.expectedRendering, report)
+			}
+		})
+	}
+
+	doc, _ := html.Parse(strings.NewReader(`<html><head><meta http-equiv="refresh" content="0;url=/next"></head></html>`))
+	if report := analyzer.detectClientSideRendering(doc, baseURL); report.Redirects[0].DelaySeconds != 0 || report.Redirects[0].Method != ClientRedirectMetaRefresh {
+		t.Errorf("Expected an immediate meta refresh, got %+v", report.Redirects[0])
+	}
+}
+
+func TestMockClient(t *testing.T) {
+	var client Client = NewMockClient()
+	mock := client.(*MockClient)
+	mock.SetResult("https://example.com", &AnalysisResult{PageTitle: "Example", InternalLinks: 3})
+
+	result := client.AnalyzeURLWithOptions(context.Background(), "https://example.com", AnalysisOptions{SkipLinkCheck: true})
+	if result.Error != nil || result.PageTitle != "Example" || result.URL != "https://example.com" {
+		t.Errorf("Expected the registered result, got %+v", result)
+	}
+	// Callers may modify results without affecting later calls
+	result.PageTitle = "Changed"
+	if again := client.AnalyzeURLWithOptions(context.Background(), "https://example.com", AnalysisOptions{}); again.PageTitle != "Example" {
+		t.Errorf("Expected an unmodified result, got %q", again.PageTitle)
+	}
+
+	missing := client.AnalyzeURLWithOptions(context.Background(), "https://missing.example", AnalysisOptions{})
+	if missing.Error == nil || missing.Error.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected a 404 error for an unknown URL, got %+v", missing.Error)
+	}
+
+	calls := mock.Calls()
+	if len(calls) != 3 || calls[0].URL != "https://example.com" || !calls[0].Options.SkipLinkCheck || calls[2].URL != "https://missing.example" {
+		t.Errorf("Expected 3 recorded calls, got %+v", calls)
+	}
+
+	mock.AnalyzeFunc = func(ctx context.Context, targetURL string, opts AnalysisOptions) *AnalysisResult {
+		return &AnalysisResult{URL: targetURL, PageTitle: "Generated"}
+	}
+	if result := client.AnalyzeURLWithOptions(context.Background(), "https://missing.example", AnalysisOptions{}); result.PageTitle != "Generated" {
+		t.Errorf("Expected AnalyzeFunc to produce the result, got %+v", result)
+	}
+}
+
+// testLimiter refuses the first refusals acquisitions and counts the slots held
+type testLimiter struct {
+	mu       sync.Mutex
+	refusals int
+	held     int
+	batch    bool
+}
+
+func (l *testLimiter) Acquire(ctx context.Context, batch bool) (func(), bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.batch = batch
+	if l.refusals > 0 {
+		l.refusals--
+		return nil, false
+	}
+	l.held++
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.held--
+	}, true
+}
+
+func TestLimitedClient(t *testing.T) {
+	mock := NewMockClient()
+	limiter := &testLimiter{refusals: 1}
+	mock.AnalyzeFunc = func(ctx context.Context, targetURL string, opts AnalysisOptions) *AnalysisResult {
+		limiter.mu.Lock()
+		defer limiter.mu.Unlock()
+		return &AnalysisResult{URL: targetURL, PageTitle: fmt.Sprintf("held %d", limiter.held)}
+	}
+	client := LimitedClient(mock, limiter)
+
+	// A saturated limiter is asked again rather than failing the analysis
+	result := client.AnalyzeURLWithOptions(context.Background(), "https://example.com", AnalysisOptions{})
+	if result.Error != nil || result.PageTitle != "held 1" {
+		t.Errorf("Expected the analysis to run holding a slot, got %+v", result)
+	}
+	if !limiter.batch || limiter.held != 0 {
+		t.Errorf("Expected a batch slot given back after the analysis, got batch %v and %d held", limiter.batch, limiter.held)
+	}
+
+	// The wait ends with the context
+	limiter.refusals = 100
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	result = client.AnalyzeURLWithOptions(ctx, "https://example.com", AnalysisOptions{})
+	if result.Error == nil || result.Error.Code != ErrCodeTimeoutError {
+		t.Errorf("Expected a timeout error while waiting for a slot, got %+v", result.Error)
+	}
+	if calls := mock.Calls(); len(calls) != 1 {
+		t.Errorf("Expected only the admitted analysis to run, got %d calls", len(calls))
+	}
+}
+
+func TestAnalyzeProgress(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<!DOCTYPE html><html><head><title>Links</title></head><body>`)
+		for i := 0; i < 25; i++ {
+			fmt.Fprintf(w, `<a href="/page-%d">Page %d</a>`, i, i)
+		}
+		fmt.Fprint(w, `</body></html>`)
+	}))
+	defer testServer.Close()
+
+	analyzer := NewAnalyzer(10 * time.Second)
+	var mu sync.Mutex
+	var events []Progress
+	ctx := WithProgress(context.Background(), func(progress Progress) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, progress)
+	})
+
+	result := analyzer.AnalyzeURLWithOptions(ctx, testServer.URL, AnalysisOptions{})
+	if result.Error != nil {
+		t.Fatalf("Unexpected error: %v", result.Error)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var stages []string
+	for _, event := range events {
+		stages = append(stages, event.Stage)
+	}
+	expected := []string{ProgressFetched, ProgressParsed, ProgressDocument, ProgressLinks, ProgressLinks, ProgressLinks}
+	if strings.Join(stages, " ") != strings.Join(expected, " ") {
+		t.Fatalf("Expected stages %v, got %v", expected, stages)
+	}
+	if events[0].StatusCode != http.StatusOK || events[0].FinalURL != testServer.URL {
+		t.Errorf("Expected the fetched event to carry status 200 and the final URL, got %+v", events[0])
+	}
+	if events[1].ContentLength != result.ContentLength {
+		t.Errorf("Expected the parsed event to carry the content length %d, got %d", result.ContentLength, events[1].ContentLength)
+	}
+	if document := events[2]; document.PageTitle != "Links" || document.HTMLVersion != "HTML5" {
+		t.Errorf("Expected the document event to carry the title and HTML version, got %+v", document)
+	}
+	for i, checked := range []int{0, LinkProgressInterval, 25} {
+		if links := events[3+i]; links.LinksChecked != checked || links.LinksTotal != 25 {
+			t.Errorf("Expected %d of 25 links checked, got %+v", checked, links)
+		}
+	}
+
+	// A cached analysis reports no progress
+	events = nil
+	mu.Unlock()
+	analyzer.AnalyzeURLWithOptions(ctx, testServer.URL, AnalysisOptions{})
+	mu.Lock()
+	if len(events) != 0 {
+		t.Errorf("Expected no progress from a cache hit, got %+v", events)
+	}
+}
+
+func TestAnalyzeTracing(t *testing.T) {
+	var mu sync.Mutex
+	spans := make(map[string]map[string]interface{})
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []map[string]interface{} `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		mu.Lock()
+		defer mu.Unlock()
+		for _, resource := range request.ResourceSpans {
+			for _, scope := range resource.ScopeSpans {
+				for _, span := range scope.Spans {
+					spans[span["name"].(string)] = span
+				}
+			}
+		}
+	}))
+	defer collector.Close()
+
+	// Only external links are checked; localhost is another host than 127.0.0.1
+	external := httptest.NewServer(http.NotFoundHandler())
+	defer external.Close()
+	missing := strings.Replace(external.URL, "127.0.0.1", "localhost", 1) + "/missing"
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<!DOCTYPE html><html><head><title>Traced</title></head><body><a href="%s">Missing</a></body></html>`, missing)
+	}))
+	defer testServer.Close()
+
+	tracing.Enable(collector.URL, "analyzer-test", nil)
+	defer tracing.Shutdown(context.Background())
+
+	header := http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}
+	analyzer := NewAnalyzer(10 * time.Second)
+	result := analyzer.AnalyzeURLWithContext(tracing.Extract(context.Background(), header), testServer.URL)
+	if result.Error != nil {
+		t.Fatalf("Unexpected error: %v", result.Error)
+	}
+	if err := tracing.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// Each span's parent, from the remote caller down to the link check
+	parents := map[string]string{
+		"AnalyzeURL":             "",
+		"performAnalysis":        "AnalyzeURL",
+		"fetch":                  "performAnalysis",
+		"parse":                  "performAnalysis",
+		"analyzeDocument":        "performAnalysis",
+		"analyzeLinksConcurrent": "analyzeDocument",
+		"checkLink":              "analyzeLinksConcurrent",
+	}
+	for name, parent := range parents {
+		span, ok := spans[name]
+		if !ok {
+			t.Errorf("Expected a %s span, got %v", name, spans)
+			continue
+		}
+		if span["traceId"] != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("Expected %s in the caller's trace, got %v", name, span["traceId"])
+		}
+		expected := "00f067aa0ba902b7"
+		if parent != "" {
+			expected, _ = spans[parent]["spanId"].(string)
+		}
+		if span["parentSpanId"] != expected {
+			t.Errorf("Expected %s to be a child of %q, got %v", name, parent, span["parentSpanId"])
+		}
+	}
+
+	// The link check records the status of the broken link
+	attributes, _ := json.Marshal(spans["checkLink"]["attributes"])
+	if !strings.Contains(string(attributes), `"key":"http.response.status_code","value":{"intValue":"404"}`) {
+		t.Errorf("Expected the link check to record status 404, got %s", attributes)
+	}
+}
+
+func TestParsePriority(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected Priority
+		valid    bool
+	}{
+		{"", PriorityInteractive, true},
+		{"interactive", PriorityInteractive, true},
+		{"batch", PriorityBatch, true},
+		{"urgent", PriorityInteractive, false},
+	}
+
+	for _, tt := range tests {
+		priority, err := ParsePriority(tt.value)
+		if (err == nil) != tt.valid || priority != tt.expected {
+			t.Errorf("ParsePriority(%q): expected %v (valid %v), got %v, %v", tt.value, tt.expected, tt.valid, priority, err)
+		}
+	}
+}
+
+func TestPriorityGate(t *testing.T) {
+	gate := newPriorityGate()
+	batchCtx := withPriority(context.Background(), PriorityBatch)
+
+	// Interactive checks are never held back
+	if _, err := gate.admit(context.Background()); err != nil {
+		t.Fatalf("Expected an interactive check to be admitted, got %v", err)
+	}
+
+	// While an interactive analysis runs, batch checks are capped
+	leave := gate.enter(PriorityInteractive)
+	var releases []func()
+	for i := 0; i < BatchLinkChecksWhileInteractive; i++ {
+		release, err := gate.admit(batchCtx)
+		if err != nil {
+			t.Fatalf("Expected batch check %d to be admitted, got %v", i, err)
+		}
+		releases = append(releases, release)
+	}
+
+	admitted := make(chan func(), 1)
+	go func() {
+		release, _ := gate.admit(batchCtx)
+		admitted <- release
+	}()
+	select {
+	case <-admitted:
+		t.Fatalf("Expected a batch check over the cap to wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// A finished batch check lets the waiting one through
+	releases[0]()
+	select {
+	case release := <-admitted:
+		releases[0] = release
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the waiting batch check to be admitted")
+	}
+
+	// A waiting check gives up with its context
+	ctx, cancel := context.WithTimeout(batchCtx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := gate.admit(ctx); err == nil {
+		t.Errorf("Expected a cancelled wait to fail")
+	}
+
+	// Once no interactive analysis runs, batch checks are not capped
+	leave()
+	release, err := gate.admit(batchCtx)
+	if err != nil {
+		t.Fatalf("Expected batch checks to be uncapped, got %v", err)
+	}
+	releases = append(releases, release)
+	if stats := gate.stats(); stats.InteractiveAnalyses != 0 || stats.BatchLinkChecks != BatchLinkChecksWhileInteractive+1 {
+		t.Errorf("Expected no interactive analyses and %d batch checks, got %+v", BatchLinkChecksWhileInteractive+1, stats)
+	}
+	for _, release := range releases {
+		release()
+	}
+	if stats := gate.stats(); stats.BatchLinkChecks != 0 {
+		t.Errorf("Expected all batch checks released, got %+v", stats)
+	}
+}
+
+func TestHeadLinkLatency(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	analyzer := NewAnalyzer(5 * time.Second)
+	leave := analyzer.priorities.enter(PriorityInteractive)
+	defer leave()
+	batchCtx := withPriority(context.Background(), PriorityBatch)
+	var releases []func()
+	for i := 0; i < BatchLinkChecksWhileInteractive; i++ {
+		release, _ := analyzer.priorities.admit(batchCtx)
+		releases = append(releases, release)
+	}
+
+	// The wait for a turn is not part of the check's latency
+	wait := 200 * time.Millisecond
+	time.AfterFunc(wait, releases[0])
+	start := time.Now()
+	statusCode, _, latency, err := analyzer.headLink(batchCtx, server.URL)
+	if err != nil || statusCode != http.StatusOK {
+		t.Fatalf("Expected a 200 check, got %d and %v", statusCode, err)
+	}
+	if elapsed := time.Since(start); elapsed < wait {
+		t.Fatalf("Expected the check to wait for a turn, took %v", elapsed)
+	}
+	if latency <= 0 || latency >= wait {
+		t.Errorf("Expected the round-trip time without the wait, got %v", latency)
+	}
+	for _, release := range releases[1:] {
+		release()
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	var pageFetches, robotsFetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			robotsFetches.Add(1)
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+			return
+		}
+		pageFetches.Add(1)
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><head><title>Page</title></head><body></body></html>"))
+	}))
+	defer server.Close()
+
+	analyzer := NewAnalyzer(5 * time.Second)
+	checks := func(result *DryRunResult) map[string]string {
+		statuses := make(map[string]string)
+		for _, check := range result.Checks {
+			statuses[check.Name] = check.Status
+		}
+		return statuses
+	}
+
+	report := analyzer.DryRunAll(context.Background(), []string{server.URL + "/page", server.URL + "/private", "http://%zz"}, AnalysisOptions{CompareVariants: true})
+	if pageFetches.Load() != 0 || robotsFetches.Load() != 1 {
+		t.Fatalf("Expected no page fetches and one shared robots.txt fetch, got %d and %d", pageFetches.Load(), robotsFetches.Load())
+	}
+	if report.Allowed != 2 || report.Blocked != 1 || report.LinkChecks != 2 {
+		t.Errorf("Expected 2 allowed, 1 blocked and 2 with link checks, got %+v", report)
+	}
+
+	page, private, invalid := report.Results[0], report.Results[1], report.Results[2]
+	if statuses := checks(page); statuses[CheckDNS] != CheckPass || statuses[CheckRobotsTxt] != CheckPass || statuses[CheckCircuitBreaker] != CheckPass {
+		t.Errorf("Expected the page to pass every check, got %+v", page.Checks)
+	}
+	serverURL, _ := url.Parse(server.URL)
+	if page.EstimatedCost.Requests != 1+len(buildVariantURLs(serverURL)) || !page.EstimatedCost.LinkChecks {
+		t.Errorf("Expected the fetch, the variants and link checks, got %+v", page.EstimatedCost)
+	}
+	if statuses := checks(private); statuses[CheckRobotsTxt] != CheckWarn || !private.Allowed {
+		t.Errorf("Expected a robots.txt warning on an allowed page, got %+v", private)
+	}
+	if invalid.Allowed || invalid.Error == nil || invalid.Error.Code != ErrCodeInvalidURL {
+		t.Errorf("Expected an invalid URL error, got %+v", invalid)
+	}
+
+	// Once analyzed, the page would come from the cache at no cost
+	analyzer.AnalyzeURL(server.URL + "/page")
+	cached := analyzer.DryRun(context.Background(), server.URL+"/page", AnalysisOptions{})
+	if !cached.WouldHitCache || cached.CachedAt == nil || cached.EstimatedCost.Requests != 0 || len(cached.Checks) != 0 {
+		t.Errorf("Expected a cache hit, got %+v", cached)
+	}
+
+	// The network policy refuses loopback targets before robots.txt is read
+	analyzer.SetBlockPrivateNetworks(true)
+	blocked := analyzer.DryRun(context.Background(), server.URL+"/other", AnalysisOptions{})
+	if blocked.Allowed || checks(blocked)[CheckNetworkPolicy] != CheckFail || robotsFetches.Load() != 1 {
+		t.Errorf("Expected the network policy to block the page, got %+v", blocked)
+	}
+}
+
+func TestAnalyzeCost(t *testing.T) {
+	page := `<html><head><title>Cost</title></head><body><h1>Cost</h1></body></html>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(page))
+	}))
+	defer server.Close()
+
+	analyzer := NewAnalyzer(5 * time.Second)
+	var charged []*OutboundUsage
+	ctx := WithCostRecorder(context.Background(), func(usage *OutboundUsage) {
+		charged = append(charged, usage)
+	})
+
+	result := analyzer.AnalyzeURLWithOptions(ctx, server.URL, AnalysisOptions{})
+	if result.Error != nil {
+		t.Fatalf("Unexpected error: %v", result.Error)
+	}
+	// Probes such as the HTTPS check add requests, but only the page has a body
+	if result.Outbound.Requests < 1 || result.Outbound.Bytes != int64(len(page)) {
+		t.Errorf("Expected requests reading %d bytes, got %+v", len(page), result.Outbound)
+	}
+	if result.Timings == nil {
+		t.Fatal("Expected timings")
+	}
+	if sum := result.Timings.FetchMs + result.Timings.ParseMs + result.Timings.LinkChecksMs + result.Timings.OtherMs; sum > result.AnalysisDurationMs+1 {
+		t.Errorf("Expected the phases to add up to at most the %dms analysis, got %+v", result.AnalysisDurationMs, result.Timings)
+	}
+
+	// A cache hit is not charged again
+	analyzer.AnalyzeURLWithOptions(ctx, server.URL, AnalysisOptions{})
+	if len(charged) != 1 || charged[0].Requests != result.Outbound.Requests {
+		t.Errorf("Expected one charge for the analysis that ran, got %d", len(charged))
+	}
+
+	metrics := analyzer.GetMetrics()
+	if metrics.OutboundRequests != int64(result.Outbound.Requests) || metrics.OutboundBytes != int64(len(page)) {
+		t.Errorf("Expected metrics to total %d requests and %d bytes, got %d and %d", result.Outbound.Requests, len(page), metrics.OutboundRequests, metrics.OutboundBytes)
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	page := `<html><head><title>Large</title></head><body>` + strings.Repeat("x", 2048) + `</body></html>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/chunked" {
+			// Flushing before writing leaves the length undeclared
+			w.(http.Flusher).Flush()
+		}
+		w.Write([]byte(page))
+	}))
+	defer server.Close()
+
+	analyzer := NewAnalyzer(5 * time.Second)
+	analyzer.SetMaxBodySize(1024)
+
+	for _, path := range []string{"/declared", "/chunked"} {
+		result := analyzer.AnalyzeURLWithOptions(context.Background(), server.URL+path, AnalysisOptions{SkipLinkCheck: true})
+		if result.Error == nil || result.Error.Code != ErrCodeContentTooLarge {
+			t.Errorf("Expected %s for %s, got %+v", ErrCodeContentTooLarge, path, result.Error)
+		}
+	}
+
+	analyzer.SetMaxBodySize(0)
+	result := analyzer.AnalyzeURLWithOptions(context.Background(), server.URL+"/default", AnalysisOptions{SkipLinkCheck: true})
+	if result.Error != nil || result.PageTitle != "Large" {
+		t.Errorf("Expected the page to fit the default limit, got %+v", result.Error)
+	}
+}
+
+func TestContentEncoding(t *testing.T) {
+	page := `<html><head><title>Compressed</title></head><body><h1>Hello</h1></body></html>`
+	encoders := map[string]func(io.Writer) io.WriteCloser{
+		"gzip": func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		"br":   func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) },
+		// deflate is sent both zlib-wrapped and raw
+		"deflate": func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) },
+		"raw-deflate": func(w io.Writer) io.WriteCloser {
+			fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+			return fw
+		},
+	}
+
+	for name, encode := range encoders {
+		t.Run(name, func(t *testing.T) {
+			var compressed bytes.Buffer
+			writer := encode(&compressed)
+			writer.Write([]byte(page))
+			writer.Close()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !strings.Contains(r.Header.Get("Accept-Encoding"), "br") {
+					t.Errorf("Expected brotli to be accepted, got %q", r.Header.Get("Accept-Encoding"))
+				}
+				w.Header().Set("Content-Type", "text/html")
+				w.Header().Set("Content-Encoding", strings.TrimPrefix(name, "raw-"))
+				w.Write(compressed.Bytes())
+			}))
+			defer server.Close()
+
+			analyzer := NewAnalyzer(5 * time.Second)
+			result := analyzer.AnalyzeURLWithOptions(context.Background(), server.URL, AnalysisOptions{SkipLinkCheck: true})
+			if result.Error != nil {
+				t.Fatalf("Unexpected error: %v", result.Error)
+			}
+			if result.PageTitle != "Compressed" || result.ContentLength != int64(len(page)) {
+				t.Errorf("Expected the decoded page, got title %q and %d bytes", result.PageTitle, result.ContentLength)
+			}
+			// Egress is charged for the bytes on the wire
+			if result.Outbound.Bytes != int64(compressed.Len()) {
+				t.Errorf("Expected %d compressed bytes charged, got %d", compressed.Len(), result.Outbound.Bytes)
+			}
+		})
+	}
+}
+
+func TestBotIdentity(t *testing.T) {
+	var mu sync.Mutex
+	var userAgent, from string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			// Rules for every crawler are not an opt-out; only the group naming the bot is
+			w.Write([]byte("User-agent: *\nDisallow: /\n\nUser-agent: TestBot\nDisallow: /private\n"))
+			return
+		}
+		mu.Lock()
+		userAgent, from = r.UserAgent(), r.Header.Get("From")
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Bot</title></head><body></body></html>`))
+	}))
+	defer server.Close()
+
+	analyzer := NewAnalyzer(5 * time.Second)
+	analyzer.SetBotIdentity(BotIdentity{Name: "TestBot/1.0", InfoURL: "https://example.com/bot", Contact: "bots@example.com"})
+	opts := AnalysisOptions{SkipLinkCheck: true, IncludeHeaders: true}
+
+	result := analyzer.AnalyzeURLWithOptions(context.Background(), server.URL+"/public", opts)
+	if result.Error != nil {
+		t.Fatalf("Unexpected error: %v", result.Error)
+	}
+	mu.Lock()
+	if userAgent != "Mozilla/5.0 (compatible; TestBot/1.0; +https://example.com/bot)" || from != "bots@example.com" {
+		t.Errorf("Expected the bot identity, got User-Agent %q and From %q", userAgent, from)
+	}
+	mu.Unlock()
+	if got := result.RequestHeaders["User-Agent"]; len(got) != 1 || !strings.Contains(got[0], "TestBot") {
+		t.Errorf("Expected the reported User-Agent to be the bot's, got %v", got)
+	}
+
+	optedOut := analyzer.AnalyzeURLWithOptions(context.Background(), server.URL+"/private/page", opts)
+	if optedOut.Error == nil || optedOut.Error.Code != ErrCodeOptedOut {
+		t.Errorf("Expected %s, got %+v", ErrCodeOptedOut, optedOut.Error)
+	}
+	if dryRun := analyzer.DryRun(context.Background(), server.URL+"/private/other", opts); dryRun.Allowed {
+		t.Errorf("Expected the dry run to refuse an opted-out page, got %+v", dryRun.Checks)
+	}
+
+	// Without a name nothing is opted out and the browser User-Agent is kept
+	analyzer.SetBotIdentity(BotIdentity{Contact: "bots@example.com"})
+	if result := analyzer.AnalyzeURLWithOptions(context.Background(), server.URL+"/private/anonymous", opts); result.Error != nil {
+		t.Errorf("Unexpected error: %v", result.Error)
+	}
+	mu.Lock()
+	if strings.Contains(userAgent, "TestBot") || from != "bots@example.com" {
+		t.Errorf("Expected the browser User-Agent with From, got %q and %q", userAgent, from)
+	}
+	mu.Unlock()
+}
@@ -0,0 +1,69 @@
+package analyzer
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// findDeadAnchors returns in-page fragment links whose target id or name does not exist
+func (a *Analyzer) findDeadAnchors(doc *html.Node, baseURL *url.URL) []string {
+	traverser := NewHTMLTraverser()
+	targets := make(map[string]bool)
+	var fragments []string
+
+	traverser.TraverseAllElements(doc, func(n *html.Node) {
+		if id := traverser.GetAttributeValue(n, "id"); id != "" {
+			targets[id] = true
+		}
+		if n.Data == "a" {
+			if name := traverser.GetAttributeValue(n, "name"); name != "" {
+				targets[name] = true
+			}
+			if fragment, ok := inPageFragment(traverser.GetAttributeValue(n, "href"), baseURL); ok {
+				fragments = append(fragments, fragment)
+			}
+		}
+	})
+
+	var dead []string
+	seen := make(map[string]bool)
+	for _, fragment := range fragments {
+		if targets[fragment] || seen[fragment] {
+			continue
+		}
+		seen[fragment] = true
+		dead = append(dead, "#"+fragment)
+	}
+
+	return dead
+}
+
+// inPageFragment returns the decoded fragment of href when it points into the current document.
+// The empty fragment and "#top" always scroll to the top of the page and are never dead.
+func inPageFragment(href string, baseURL *url.URL) (string, bool) {
+	if !strings.Contains(href, "#") {
+		return "", false
+	}
+
+	linkURL, err := url.Parse(href)
+	if err != nil {
+		return "", false
+	}
+
+	if baseURL != nil && !strings.HasPrefix(href, "#") {
+		resolved := baseURL.ResolveReference(linkURL)
+		if resolved.Scheme != baseURL.Scheme || resolved.Host != baseURL.Host ||
+			resolved.Path != baseURL.Path || resolved.RawQuery != baseURL.RawQuery {
+			return "", false
+		}
+	}
+
+	fragment := linkURL.Fragment
+	if fragment == "" || strings.EqualFold(fragment, "top") {
+		return "", false
+	}
+
+	return fragment, true
+}
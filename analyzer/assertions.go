@@ -0,0 +1,165 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Assertion types
+const (
+	AssertText   = "text"   // Value must appear in the page's visible text
+	AssertRegex  = "regex"  // Value is a regular expression that must match the HTML source
+	AssertHeader = "header" // response header Name must equal Value
+	AssertStatus = "status" // the response status code must equal Value
+)
+
+// Assertion is a per-request expectation about the fetched page, reported as
+// a pass/fail finding in AnalysisResult.Assertions
+type Assertion struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	// Name is the header checked by header assertions
+	Name string `json:"name,omitempty"`
+	// Not inverts the assertion: the text or pattern must not appear, or the header or status must differ
+	Not bool `json:"not,omitempty"`
+}
+
+// AssertionResult is the outcome of one assertion
+type AssertionResult struct {
+	Assertion
+	Passed bool `json:"passed"`
+	// Actual is the observed header or status value; text assertions leave it empty
+	Actual  string `json:"actual,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// AssertionReport summarises the assertions evaluated for a request
+type AssertionReport struct {
+	Passed  bool              `json:"passed"`
+	Failed  int               `json:"failed"`
+	Results []AssertionResult `json:"results"`
+}
+
+// ValidateAssertions reports the first problem with a set of assertions, if any
+func ValidateAssertions(assertions []Assertion) error {
+	if len(assertions) > MaxAssertions {
+		return fmt.Errorf("at most %d assertions are allowed", MaxAssertions)
+	}
+	for i, assertion := range assertions {
+		switch assertion.Type {
+		case AssertText:
+			if assertion.Value == "" {
+				return fmt.Errorf("assertion %d: value is required", i)
+			}
+		case AssertRegex:
+			if _, err := regexp.Compile(assertion.Value); err != nil {
+				return fmt.Errorf("assertion %d: %w", i, err)
+			}
+		case AssertHeader:
+			if assertion.Name == "" {
+				return fmt.Errorf("assertion %d: header name is required", i)
+			}
+		case AssertStatus:
+			if code, err := strconv.Atoi(assertion.Value); err != nil || code < 100 || code > 599 {
+				return fmt.Errorf("assertion %d: invalid status code %q", i, assertion.Value)
+			}
+		default:
+			return fmt.Errorf("assertion %d: unknown type %q", i, assertion.Type)
+		}
+	}
+	return nil
+}
+
+// evaluateAssertions checks each assertion against the response. Body
+// assertions fail when the page body was not analyzed, e.g. on an error status.
+func evaluateAssertions(assertions []Assertion, resp *http.Response, doc *html.Node, source string) *AssertionReport {
+	report := &AssertionReport{Results: make([]AssertionResult, 0, len(assertions))}
+	var text string
+	if doc != nil {
+		text = visibleText(doc)
+	}
+
+	for _, assertion := range assertions {
+		result := AssertionResult{Assertion: assertion}
+		var found bool
+
+		switch assertion.Type {
+		case AssertText, AssertRegex:
+			if doc == nil {
+				result.Message = "page body was not analyzed"
+				report.Results = append(report.Results, result)
+				report.Failed++
+				continue
+			}
+			if assertion.Type == AssertText {
+				found = strings.Contains(text, assertion.Value)
+			} else if re, err := regexp.Compile(assertion.Value); err == nil {
+				found = re.MatchString(source)
+			} else {
+				result.Message = err.Error()
+				report.Results = append(report.Results, result)
+				report.Failed++
+				continue
+			}
+		case AssertHeader:
+			result.Actual = resp.Header.Get(assertion.Name)
+			found = result.Actual == assertion.Value
+		case AssertStatus:
+			result.Actual = strconv.Itoa(resp.StatusCode)
+			found = result.Actual == strings.TrimSpace(assertion.Value)
+		default:
+			result.Message = "unknown assertion type"
+			report.Results = append(report.Results, result)
+			report.Failed++
+			continue
+		}
+
+		result.Passed = found != assertion.Not
+		if !result.Passed {
+			report.Failed++
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	report.Passed = report.Failed == 0
+	return report
+}
+
+// visibleText returns the page's text outside scripts and styles, whitespace-collapsed
+func visibleText(doc *html.Node) string {
+	var sb strings.Builder
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			sb.WriteString(n.Data)
+			sb.WriteByte(' ')
+			return
+		case html.ElementNode:
+			switch n.Data {
+			case "script", "style", "noscript", "template":
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			collect(c)
+		}
+	}
+	collect(doc)
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
+
+// assertionKey identifies a set of assertions in cache keys
+func assertionKey(assertions []Assertion) string {
+	data, _ := json.Marshal(assertions)
+	h := fnv.New64a()
+	h.Write(data)
+	return fmt.Sprintf("assert:%x", h.Sum64())
+}
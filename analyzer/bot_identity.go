@@ -0,0 +1,139 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BotIdentity is how the analyzer introduces itself to target sites. The zero
+// value sends a regular browser User-Agent and honors no opt-outs.
+type BotIdentity struct {
+	// Name is the product token in the User-Agent, e.g. "PageAnalyzerBot/1.0";
+	// robots.txt groups for it without the version opt a site out
+	Name string `json:"name"`
+	// InfoURL is a page describing the bot, embedded in the User-Agent
+	InfoURL string `json:"info_url,omitempty"`
+	// Contact is the operator's email address, sent as the From header
+	Contact string `json:"contact,omitempty"`
+}
+
+// UserAgent returns the User-Agent sent as this bot
+func (id BotIdentity) UserAgent() string {
+	if id.InfoURL == "" {
+		return fmt.Sprintf("Mozilla/5.0 (compatible; %s)", id.Name)
+	}
+	return fmt.Sprintf("Mozilla/5.0 (compatible; %s; +%s)", id.Name, id.InfoURL)
+}
+
+// robotsToken is the robots.txt user agent the bot answers to
+func (id BotIdentity) robotsToken() string {
+	token, _, _ := strings.Cut(id.Name, "/")
+	return strings.ToLower(token)
+}
+
+// SetBotIdentity identifies outbound requests as id: the User-Agent names the
+// bot and its info page and From carries the contact address. Once named, the
+// bot no longer fetches pages whose robots.txt disallows it by name; rules for
+// all user agents are not treated as an opt-out. Without a Name only the From
+// header is added.
+func (a *Analyzer) SetBotIdentity(id BotIdentity) {
+	if id.Name == "" && id.InfoURL != "" {
+		id.Name = DefaultBotName
+	}
+	if id == (BotIdentity{}) {
+		a.botIdentity.Store(nil)
+		return
+	}
+	a.botIdentity.Store(&id)
+}
+
+// BotIdentity returns the identity outbound requests are sent under
+func (a *Analyzer) BotIdentity() BotIdentity {
+	if id := a.botIdentity.Load(); id != nil {
+		return *id
+	}
+	return BotIdentity{}
+}
+
+// identify returns req as sent under the analyzer's bot identity
+func (a *Analyzer) identify(req *http.Request) *http.Request {
+	id := a.botIdentity.Load()
+	if id == nil {
+		return req
+	}
+	req = req.Clone(req.Context())
+	if id.Name != "" {
+		req.Header.Set("User-Agent", id.UserAgent())
+	}
+	if id.Contact != "" {
+		req.Header.Set("From", id.Contact)
+	}
+	return req
+}
+
+// optOutCache remembers the robots.txt of each site for opt-out checks
+type optOutCache struct {
+	mu    sync.Mutex
+	sites map[string]optOutEntry
+}
+
+// optOutEntry is a site's robots.txt, nil when it has none or it could not be read
+type optOutEntry struct {
+	robots    *robotsTxt
+	expiresAt time.Time
+}
+
+func newOptOutCache() *optOutCache {
+	return &optOutCache{sites: make(map[string]optOutEntry)}
+}
+
+// checkOptOut returns errOptedOut when the page's robots.txt disallows the
+// named bot. A robots.txt that cannot be read opts nothing out.
+func (a *Analyzer) checkOptOut(ctx context.Context, pageURL *url.URL) error {
+	id := a.botIdentity.Load()
+	if id == nil || id.Name == "" {
+		return nil
+	}
+
+	site := pageURL.Scheme + "://" + pageURL.Host
+	a.optOuts.mu.Lock()
+	entry, ok := a.optOuts.sites[site]
+	a.optOuts.mu.Unlock()
+	if !ok || time.Now().After(entry.expiresAt) {
+		robotsURL := &url.URL{Scheme: pageURL.Scheme, Host: pageURL.Host, Path: "/robots.txt"}
+		content, status, err := a.fetchRobotsResource(ctx, robotsURL.String(), RobotsTxtBodyLimit)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		entry = optOutEntry{expiresAt: time.Now().Add(OptOutRobotsTTL)}
+		if err == nil && status >= 200 && status < 300 {
+			entry.robots = parseRobotsTxt(string(content))
+		}
+		a.optOuts.mu.Lock()
+		a.optOuts.sites[site] = entry
+		a.optOuts.mu.Unlock()
+	}
+
+	if rule, optedOut := botOptOut(entry.robots, id.robotsToken(), robotsPath(pageURL)); optedOut {
+		return fmt.Errorf("%w (%s)", errOptedOut, rule)
+	}
+	return nil
+}
+
+// botOptOut reports whether robots disallows path for the bot token in a group
+// naming it, returning the matching rule
+func botOptOut(robots *robotsTxt, token, path string) (string, bool) {
+	if robots == nil {
+		return "", false
+	}
+	if _, named := robots.groups[token]; !named {
+		return "", false
+	}
+	allowed, rule := robots.allowed(token, path)
+	return rule, !allowed
+}
@@ -0,0 +1,35 @@
+package analyzer
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// bodyBufferPool recycles the buffers response bodies are read into
+var bodyBufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// readBody reads at most limit bytes from r into a pooled buffer. The caller must
+// hand the buffer back with releaseBuffer once it no longer references its bytes.
+func readBody(r io.Reader, limit int64) (*bytes.Buffer, error) {
+	buf := bodyBufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	if _, err := buf.ReadFrom(io.LimitReader(r, limit)); err != nil {
+		releaseBuffer(buf)
+		return nil, err
+	}
+	return buf, nil
+}
+
+// releaseBuffer returns a buffer to the pool, dropping oversized ones so that a
+// single huge page does not pin its memory for the lifetime of the process
+func releaseBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > MaxPooledBufferSize {
+		return
+	}
+	bodyBufferPool.Put(buf)
+}
@@ -4,16 +4,27 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"web-page-analyzer/logger"
 )
 
-// CacheManager handles caching operations for analysis results
+// cacheShard is an independently locked partition of the cache
+type cacheShard struct {
+	mutex   sync.RWMutex
+	entries map[string]*CacheEntry
+}
+
+// CacheManager handles caching operations for analysis results.
+// Entries are spread over independently locked shards so concurrent analyses
+// of different URLs don't contend on a single lock.
 type CacheManager struct {
-	cache         map[string]*CacheEntry
-	mutex         sync.RWMutex
+	shards        []*cacheShard
 	ttl           time.Duration
+	negativeTTL   time.Duration   // TTL for failed analyses
+	uncached      map[string]bool // error codes that are never cached
+	evictions     atomic.Int64    // expired entries removed so far
 	cleanupTicker *time.Ticker
 	stopChan      chan struct{}
 	verbose       bool // Control logging verbosity
@@ -22,10 +33,15 @@ type CacheManager struct {
 // NewCacheManager creates a new cache manager
 func NewCacheManager(ttl time.Duration) *CacheManager {
 	cm := &CacheManager{
-		cache:    make(map[string]*CacheEntry),
-		ttl:      ttl,
-		stopChan: make(chan struct{}),
-		verbose:  false, // Default to quiet logging
+		shards:      make([]*cacheShard, CacheShardCount),
+		ttl:         ttl,
+		negativeTTL: CacheNegativeTTL,
+		uncached:    make(map[string]bool),
+		stopChan:    make(chan struct{}),
+		verbose:     false, // Default to quiet logging
+	}
+	for i := range cm.shards {
+		cm.shards[i] = &cacheShard{entries: make(map[string]*CacheEntry)}
 	}
 	cm.startCleanup()
 	return cm
@@ -57,9 +73,10 @@ func (cm *CacheManager) Stop() {
 }
 
 // generateCacheKey generates an MD5 hash for the URL to use as cache key
-func (cm *CacheManager) generateCacheKey(url string) string {
+// and returns the shard holding it
+func (cm *CacheManager) generateCacheKey(url string) (string, *cacheShard) {
 	hash := md5.Sum([]byte(url))
-	return hex.EncodeToString(hash[:])
+	return hex.EncodeToString(hash[:]), cm.shards[int(hash[0])%len(cm.shards)]
 }
 
 // SetVerbose enables or disables verbose logging
@@ -67,26 +84,42 @@ func (cm *CacheManager) SetVerbose(verbose bool) {
 	cm.verbose = verbose
 }
 
-// Get retrieves a result from cache if it exists and is not expired
-func (cm *CacheManager) Get(url string) (*AnalysisResult, bool) {
-	key := cm.generateCacheKey(url)
+// SetNegativeTTL sets how long failed analyses are cached
+func (cm *CacheManager) SetNegativeTTL(ttl time.Duration) {
+	cm.negativeTTL = ttl
+}
 
-	cm.mutex.RLock()
-	defer cm.mutex.RUnlock()
+// SetUncachedErrorCodes sets the error codes whose results are never cached
+func (cm *CacheManager) SetUncachedErrorCodes(codes ...string) {
+	uncached := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		uncached[code] = true
+	}
+	cm.uncached = uncached
+}
 
-	entry, exists := cm.cache[key]
-	if !exists {
-		return nil, false
+// ttlFor returns how long a result may be cached, or zero if it must not be.
+// Failures get the shorter negative TTL so transient errors clear quickly.
+func (cm *CacheManager) ttlFor(result *AnalysisResult) time.Duration {
+	if result.Error == nil {
+		return cm.ttl
 	}
+	if cm.uncached[result.Error.Code] {
+		return 0
+	}
+	return cm.negativeTTL
+}
+
+// Get retrieves a result from cache if it exists and is not expired.
+// Expired entries are only reported as misses here; they are removed on the write path.
+func (cm *CacheManager) Get(url string) (*AnalysisResult, bool) {
+	key, shard := cm.generateCacheKey(url)
 
-	// Check if entry has expired
-	if time.Since(entry.Timestamp) > entry.TTL {
-		// Entry expired, remove it
-		cm.mutex.RUnlock()
-		cm.mutex.Lock()
-		delete(cm.cache, key)
-		cm.mutex.Unlock()
-		cm.mutex.RLock()
+	shard.mutex.RLock()
+	entry, exists := shard.entries[key]
+	shard.mutex.RUnlock()
+
+	if !exists || time.Since(entry.Timestamp) > entry.TTL {
 		return nil, false
 	}
 
@@ -96,40 +129,59 @@ func (cm *CacheManager) Get(url string) (*AnalysisResult, bool) {
 	return entry.Result, true
 }
 
-// Set stores a result in the cache
+// Set stores a result in the cache and drops expired entries from the same shard.
+// Failed results are kept for the negative TTL, or not at all for uncached error codes.
 func (cm *CacheManager) Set(url string, result *AnalysisResult) {
-	key := cm.generateCacheKey(url)
+	ttl := cm.ttlFor(result)
+	if ttl <= 0 {
+		if cm.verbose {
+			logger.WithCache("skip", url).Infow("Cache skipped for error result", "error_code", result.Error.Code)
+		}
+		return
+	}
 
-	cm.mutex.Lock()
-	defer cm.mutex.Unlock()
+	key, shard := cm.generateCacheKey(url)
+	now := time.Now()
 
-	cm.cache[key] = &CacheEntry{
+	shard.mutex.Lock()
+	cm.evictions.Add(int64(shard.removeExpired(now)))
+	shard.entries[key] = &CacheEntry{
 		Result:    result,
-		Timestamp: time.Now(),
-		TTL:       cm.ttl,
+		Timestamp: now,
+		TTL:       ttl,
 	}
+	shard.mutex.Unlock()
 
 	if cm.verbose {
 		logger.WithCache("set", url).Info("Cache set")
 	}
 }
 
+// removeExpired deletes expired entries; the caller must hold the write lock
+func (s *cacheShard) removeExpired(now time.Time) int {
+	removed := 0
+	for key, entry := range s.entries {
+		if now.Sub(entry.Timestamp) > entry.TTL {
+			delete(s.entries, key)
+			removed++
+		}
+	}
+	return removed
+}
+
 // clearExpired removes expired cache entries
 func (cm *CacheManager) clearExpired() {
-	cm.mutex.Lock()
-	defer cm.mutex.Unlock()
-
 	now := time.Now()
 	expiredCount := 0
+	remainingCount := 0
 
-	for key, entry := range cm.cache {
-		if now.Sub(entry.Timestamp) > entry.TTL {
-			delete(cm.cache, key)
-			expiredCount++
-		}
+	for _, shard := range cm.shards {
+		shard.mutex.Lock()
+		expiredCount += shard.removeExpired(now)
+		remainingCount += len(shard.entries)
+		shard.mutex.Unlock()
 	}
-
-	remainingCount := len(cm.cache)
+	cm.evictions.Add(int64(expiredCount))
 
 	// Only log if we actually removed expired entries or if cache is getting large
 	if expiredCount > 0 {
@@ -148,18 +200,25 @@ func (cm *CacheManager) clearExpired() {
 
 // GetStats returns cache statistics
 func (cm *CacheManager) GetStats() (int, int) {
-	cm.mutex.RLock()
-	defer cm.mutex.RUnlock()
-
-	total := len(cm.cache)
+	total := 0
 	expired := 0
 	now := time.Now()
 
-	for _, entry := range cm.cache {
-		if now.Sub(entry.Timestamp) > entry.TTL {
-			expired++
+	for _, shard := range cm.shards {
+		shard.mutex.RLock()
+		total += len(shard.entries)
+		for _, entry := range shard.entries {
+			if now.Sub(entry.Timestamp) > entry.TTL {
+				expired++
+			}
 		}
+		shard.mutex.RUnlock()
 	}
 
 	return total, expired
 }
+
+// Evictions returns the number of expired entries removed from the cache
+func (cm *CacheManager) Evictions() int64 {
+	return cm.evictions.Load()
+}
@@ -0,0 +1,76 @@
+package analyzer
+
+// Capabilities describes what this analyzer supports and how it is limited, so
+// API clients can adapt instead of hardcoding assumptions
+type Capabilities struct {
+	// Render reports JavaScript rendering; pages are analyzed as served, so it is always false
+	Render          bool             `json:"render"`
+	Formats         []string         `json:"formats"`
+	Options         []string         `json:"options"`
+	AssertionTypes  []string         `json:"assertion_types"`
+	Plugins         []string         `json:"plugins"`
+	ExtractionRules int              `json:"extraction_rules"`
+	SharedState     bool             `json:"shared_state"`
+	PageSpeed       bool             `json:"pagespeed"`     // whether the pagespeed option is available
+	Bot             *BotIdentity     `json:"bot,omitempty"` // identity sent to target sites, when configured
+	Limits          CapabilityLimits `json:"limits"`
+	WorkerPool      WorkerPoolConfig `json:"worker_pool"`
+}
+
+// CapabilityLimits are the bounds applied to every analysis; zero means unlimited
+type CapabilityLimits struct {
+	TimeoutSeconds           float64 `json:"timeout_seconds"`
+	LinkCheckTimeoutSeconds  float64 `json:"link_check_timeout_seconds"`
+	LinkCheckDeadlineSeconds float64 `json:"link_check_deadline_seconds"`
+	MaxBodyBytes             int64   `json:"max_body_bytes"`
+	MaxLinks                 int     `json:"max_links"`
+	MaxOutboundRequests      int     `json:"max_outbound_requests"`
+	MaxOutboundSeconds       float64 `json:"max_outbound_seconds"`
+	HostRateLimit            int     `json:"host_rate_limit"`
+	RetryAfterBudgetSeconds  float64 `json:"retry_after_budget_seconds"`
+	MaxExtractionRules       int     `json:"max_extraction_rules"`
+	MaxAssertions            int     `json:"max_assertions"`
+	MaxHeadingsTextLimit     int     `json:"max_headings_text_limit"`
+}
+
+// analysisOptionParams are the /analyze form parameters selecting optional features
+var analysisOptionParams = []string{
+	"compare_variants", "check_links", "expand_short_links", "mode", "extract_content",
+	"whois", "include_headers", "collect_links", "include_links", "check_images", "check_robots", "include_headings_text",
+	"headings_text_limit", "extract", "assert", "fields",
+	"priority", "wayback_date", "pagespeed",
+}
+
+// Capabilities reports this analyzer's features and limits
+func (a *Analyzer) Capabilities() Capabilities {
+	hostRateLimit := 0
+	if limiter := a.hostLimiter.Load(); limiter != nil {
+		hostRateLimit = limiter.limit
+	}
+
+	return Capabilities{
+		Render:          false,
+		Formats:         []string{"json"},
+		Options:         append([]string(nil), analysisOptionParams...),
+		AssertionTypes:  []string{AssertText, AssertRegex, AssertHeader, AssertStatus},
+		Plugins:         a.Plugins(),
+		ExtractionRules: len(a.extractionRules),
+		SharedState:     a.sharedStore != nil,
+		PageSpeed:       a.pageSpeed != nil,
+		Limits: CapabilityLimits{
+			TimeoutSeconds:           a.timeout.Seconds(),
+			LinkCheckTimeoutSeconds:  LinkCheckTimeout.Seconds(),
+			LinkCheckDeadlineSeconds: a.linkCheckDeadline.Seconds(),
+			MaxBodyBytes:             a.maxBodySize,
+			MaxOutboundRequests:      a.maxOutboundRequests,
+			MaxOutboundSeconds:       a.maxOutboundTime.Seconds(),
+			HostRateLimit:            hostRateLimit,
+			RetryAfterBudgetSeconds:  a.throttle.Budget().Seconds(),
+			MaxExtractionRules:       MaxExtractionRules,
+			MaxAssertions:            MaxAssertions,
+			MaxHeadingsTextLimit:     MaxHeadingsTextLimit,
+		},
+		Bot:        a.botIdentity.Load(),
+		WorkerPool: a.WorkerPoolConfig(),
+	}
+}
@@ -0,0 +1,181 @@
+package analyzer
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// CDN providers
+const (
+	CDNCloudflare = "Cloudflare"
+	CDNFastly     = "Fastly"
+	CDNAkamai     = "Akamai"
+	CDNCloudFront = "CloudFront"
+)
+
+// cdnSignature describes how a CDN provider can be recognized
+type cdnSignature struct {
+	provider string
+	// headers whose presence identifies the provider
+	headers []string
+	// headerValues pairs a header with a lowercase substring of its value
+	headerValues [][2]string
+	// headerPrefixes are lowercase prefixes of header names owned by the provider
+	headerPrefixes []string
+	// headerPatterns match header values too generic to identify the provider
+	// without a companion header
+	headerPatterns []cdnHeaderPattern
+	// cnameSuffixes are canonical name suffixes owned by the provider
+	cnameSuffixes []string
+	// ipRanges are published edge address ranges
+	ipRanges []*net.IPNet
+}
+
+// cdnHeaderPattern matches the lowercase value of header, counting only when
+// the response also carries the companion header
+type cdnHeaderPattern struct {
+	header    string
+	pattern   *regexp.Regexp
+	companion string
+}
+
+// cdnSignatures lists the recognized CDN providers
+var cdnSignatures = []cdnSignature{
+	{
+		provider:      CDNCloudflare,
+		headers:       []string{"Cf-Ray", "Cf-Cache-Status"},
+		headerValues:  [][2]string{{"Server", "cloudflare"}},
+		cnameSuffixes: []string{".cdn.cloudflare.net"},
+		ipRanges: mustParseCIDRs(
+			"173.245.48.0/20", "103.21.244.0/22", "103.22.200.0/22", "103.31.4.0/22",
+			"141.101.64.0/18", "108.162.192.0/18", "190.93.240.0/20", "188.114.96.0/20",
+			"197.234.240.0/22", "198.41.128.0/17", "162.158.0.0/15", "104.16.0.0/13",
+			"104.24.0.0/14", "172.64.0.0/13", "131.0.72.0/22", "2606:4700::/32",
+		),
+	},
+	{
+		provider:       CDNFastly,
+		headers:        []string{"X-Fastly-Request-Id"},
+		headerPrefixes: []string{"fastly-debug-"},
+		// Any Varnish cache sends Via: varnish, so only Fastly's cache node
+		// names, such as cache-lhr7331-LHR, are taken as evidence
+		headerPatterns: []cdnHeaderPattern{{
+			header:    "X-Served-By",
+			pattern:   regexp.MustCompile(`(^|[\s,])cache-[a-z0-9-]*[a-z]{3}\d+-[a-z]{3}($|[\s,])`),
+			companion: "X-Cache",
+		}},
+		cnameSuffixes: []string{".fastly.net", ".fastlylb.net"},
+		ipRanges:      mustParseCIDRs("151.101.0.0/16", "199.232.0.0/16", "2a04:4e42::/32"),
+	},
+	{
+		provider:      CDNAkamai,
+		headers:       []string{"X-Akamai-Transformed", "Akamai-Grn", "X-Akamai-Request-Id"},
+		headerValues:  [][2]string{{"Server", "akamai"}},
+		cnameSuffixes: []string{".akamaiedge.net", ".akamai.net", ".edgekey.net", ".edgesuite.net", ".akamaized.net"},
+	},
+	{
+		provider:      CDNCloudFront,
+		headers:       []string{"X-Amz-Cf-Id", "X-Amz-Cf-Pop"},
+		headerValues:  [][2]string{{"Via", "cloudfront"}, {"X-Cache", "cloudfront"}},
+		cnameSuffixes: []string{".cloudfront.net"},
+		ipRanges: mustParseCIDRs(
+			"13.32.0.0/15", "13.224.0.0/14", "18.64.0.0/14", "52.84.0.0/15",
+			"54.230.0.0/16", "54.239.128.0/18", "99.84.0.0/16", "205.251.192.0/19",
+		),
+	},
+}
+
+// mustParseCIDRs parses a list of CIDR blocks, panicking on invalid input
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// detectCDN identifies the CDN serving host from response headers, its canonical
+// name and its resolved addresses. It returns nil when no CDN is recognized.
+func (a *Analyzer) detectCDN(ctx context.Context, host string, header http.Header) *CDNInfo {
+	lookupCtx, cancel := context.WithTimeout(ctx, CDNLookupTimeout)
+	defer cancel()
+
+	var cname string
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		if name, err := net.DefaultResolver.LookupCNAME(lookupCtx, host); err == nil {
+			cname = strings.TrimSuffix(strings.ToLower(name), ".")
+		}
+		if addrs, err := net.DefaultResolver.LookupIPAddr(lookupCtx, host); err == nil {
+			for _, addr := range addrs {
+				ips = append(ips, addr.IP)
+			}
+		}
+	}
+
+	return matchCDN(header, cname, ips)
+}
+
+// matchCDN returns the provider with the most matching evidence
+func matchCDN(header http.Header, cname string, ips []net.IP) *CDNInfo {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var best *CDNInfo
+	for _, signature := range cdnSignatures {
+		var evidence []string
+
+		for _, name := range signature.headers {
+			if header.Get(name) != "" {
+				evidence = append(evidence, "header:"+strings.ToLower(name))
+			}
+		}
+		for _, pair := range signature.headerValues {
+			if strings.Contains(strings.ToLower(header.Get(pair[0])), pair[1]) {
+				evidence = append(evidence, "header:"+strings.ToLower(pair[0]))
+			}
+		}
+		for _, name := range names {
+			for _, prefix := range signature.headerPrefixes {
+				if strings.HasPrefix(strings.ToLower(name), prefix) {
+					evidence = appendUnique(evidence, "header:"+strings.ToLower(name))
+				}
+			}
+		}
+		for _, pattern := range signature.headerPatterns {
+			if header.Get(pattern.companion) != "" && pattern.pattern.MatchString(strings.ToLower(header.Get(pattern.header))) {
+				evidence = append(evidence, "header:"+strings.ToLower(pattern.header))
+			}
+		}
+		for _, suffix := range signature.cnameSuffixes {
+			if cname != "" && strings.HasSuffix(cname, suffix) {
+				evidence = append(evidence, "cname:"+cname)
+			}
+		}
+		for _, ip := range ips {
+			for _, network := range signature.ipRanges {
+				if network.Contains(ip) {
+					evidence = appendUnique(evidence, "ip:"+ip.String())
+				}
+			}
+		}
+
+		if len(evidence) > 0 && (best == nil || len(evidence) > len(best.Evidence)) {
+			best = &CDNInfo{Provider: signature.provider, Evidence: evidence}
+		}
+	}
+	return best
+}
@@ -1,8 +1,17 @@
 package analyzer
 
 import (
+	"context"
 	"sync"
 	"time"
+
+	"web-page-analyzer/logger"
+)
+
+// Shared circuit breaker keys
+const (
+	breakerFailuresKey = SharedKeyPrefix + "breaker:failures"
+	breakerOpenKey     = SharedKeyPrefix + "breaker:open_until"
 )
 
 // CircuitBreaker states
@@ -12,10 +21,25 @@ const (
 	StateHalfOpen
 )
 
+// StateName returns a readable name for a circuit breaker state
+func StateName(state int) string {
+	switch state {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half_open"
+	default:
+		return "unknown"
+	}
+}
+
 // CircuitBreaker implements the circuit breaker pattern
 type CircuitBreaker struct {
 	state           int
 	failureCount    int
+	trips           int64 // times the breaker has opened
 	lastFailureTime time.Time
 	mutex           sync.RWMutex
 
@@ -23,6 +47,11 @@ type CircuitBreaker struct {
 	failureThreshold int
 	timeout          time.Duration
 	successThreshold int
+
+	// store, when set, counts failures and holds the open state for all replicas;
+	// sharedOpenUntil caches when another replica's trip ends
+	store           SharedStore
+	sharedOpenUntil time.Time
 }
 
 // NewCircuitBreaker creates a new circuit breaker
@@ -35,6 +64,20 @@ func NewCircuitBreaker(failureThreshold int, timeout time.Duration, successThres
 	}
 }
 
+// SetSharedStore makes failures count, and trips apply, across every instance using the store
+func (cb *CircuitBreaker) SetSharedStore(store SharedStore) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	cb.store = store
+}
+
+// sharedStore returns the shared store, if any
+func (cb *CircuitBreaker) sharedStore() SharedStore {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+	return cb.store
+}
+
 // State returns the current state of the circuit breaker
 func (cb *CircuitBreaker) State() int {
 	cb.mutex.RLock()
@@ -42,8 +85,49 @@ func (cb *CircuitBreaker) State() int {
 	return cb.state
 }
 
-// CanExecute checks if the circuit breaker allows execution
+// Stats returns the current state, consecutive failures and total trips
+func (cb *CircuitBreaker) Stats() (state int, failures int, trips int64) {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+	return cb.state, cb.failureCount, cb.trips
+}
+
+// RetryAfter returns how long until an open circuit breaker allows a trial request
+func (cb *CircuitBreaker) RetryAfter() time.Duration {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+
+	var remaining time.Duration
+	if cb.state == StateOpen {
+		remaining = cb.timeout - time.Since(cb.lastFailureTime)
+	}
+	if shared := time.Until(cb.sharedOpenUntil); shared > remaining {
+		remaining = shared
+	}
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// CanExecute checks if the circuit breaker allows execution. With a shared
+// store, a breaker opened by any replica rejects execution here too.
 func (cb *CircuitBreaker) CanExecute() bool {
+	if store := cb.sharedStore(); store != nil {
+		openUntil, err := store.Get(context.Background(), breakerOpenKey)
+		if err != nil {
+			logger.WithComponent("circuit_breaker").Warnw("Shared breaker state unavailable", "error", err)
+		} else {
+			until := time.UnixMilli(openUntil)
+			cb.mutex.Lock()
+			cb.sharedOpenUntil = until
+			cb.mutex.Unlock()
+			if openUntil > 0 && time.Now().Before(until) {
+				return false
+			}
+		}
+	}
+
 	cb.mutex.Lock()
 	defer cb.mutex.Unlock()
 
@@ -65,6 +149,13 @@ func (cb *CircuitBreaker) CanExecute() bool {
 
 // OnSuccess records a successful execution
 func (cb *CircuitBreaker) OnSuccess() {
+	// Failures are counted while consecutive, so any success resets the shared count
+	if store := cb.sharedStore(); store != nil {
+		if err := store.Delete(context.Background(), breakerFailuresKey); err != nil {
+			logger.WithComponent("circuit_breaker").Warnw("Shared breaker state unavailable", "error", err)
+		}
+	}
+
 	cb.mutex.Lock()
 	defer cb.mutex.Unlock()
 
@@ -77,18 +168,42 @@ func (cb *CircuitBreaker) OnSuccess() {
 	}
 }
 
-// OnFailure records a failed execution
+// OnFailure records a failed execution. With a shared store, the threshold
+// applies to consecutive failures seen by all replicas together.
 func (cb *CircuitBreaker) OnFailure() {
-	cb.mutex.Lock()
-	defer cb.mutex.Unlock()
+	sharedFailures := int64(0)
+	store := cb.sharedStore()
+	if store != nil {
+		count, err := store.Incr(context.Background(), breakerFailuresKey, cb.timeout)
+		if err != nil {
+			logger.WithComponent("circuit_breaker").Warnw("Shared breaker state unavailable", "error", err)
+		}
+		sharedFailures = count
+	}
 
+	cb.mutex.Lock()
 	cb.failureCount++
 	cb.lastFailureTime = time.Now()
 
-	if cb.state == StateClosed && cb.failureCount >= cb.failureThreshold {
+	opened := false
+	if cb.state == StateClosed && (cb.failureCount >= cb.failureThreshold || sharedFailures >= int64(cb.failureThreshold)) {
 		cb.state = StateOpen
+		cb.trips++
+		opened = true
 	} else if cb.state == StateHalfOpen {
 		cb.state = StateOpen
+		cb.trips++
+		opened = true
+	}
+	openUntil := cb.lastFailureTime.Add(cb.timeout)
+	cb.mutex.Unlock()
+
+	if opened && store != nil {
+		ctx := context.Background()
+		if err := store.Set(ctx, breakerOpenKey, openUntil.UnixMilli(), cb.timeout); err != nil {
+			logger.WithComponent("circuit_breaker").Warnw("Shared breaker state unavailable", "error", err)
+		}
+		store.Delete(ctx, breakerFailuresKey)
 	}
 }
 
@@ -115,4 +230,5 @@ func (cb *CircuitBreaker) Reset() {
 
 	cb.state = StateClosed
 	cb.failureCount = 0
+	cb.sharedOpenUntil = time.Time{}
 }
@@ -0,0 +1,118 @@
+package analyzer
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Client analyzes web pages. *Analyzer implements it in process; code that only
+// needs analysis results can depend on Client and use MockClient in tests.
+type Client interface {
+	AnalyzeURLWithOptions(ctx context.Context, targetURL string, opts AnalysisOptions) *AnalysisResult
+}
+
+var (
+	_ Client = (*Analyzer)(nil)
+	_ Client = (*MockClient)(nil)
+	_ Client = ClientFunc(nil)
+)
+
+// ClientFunc adapts a function to the Client interface, for example to wrap
+// another Client
+type ClientFunc func(ctx context.Context, targetURL string, opts AnalysisOptions) *AnalysisResult
+
+// AnalyzeURLWithOptions calls f
+func (f ClientFunc) AnalyzeURLWithOptions(ctx context.Context, targetURL string, opts AnalysisOptions) *AnalysisResult {
+	return f(ctx, targetURL, opts)
+}
+
+// Limiter admits analyses against a shared capacity, as the server's
+// concurrency limiter does. Acquire returns the func giving the slot back, or
+// false when no slot was free in time or ctx ended first.
+type Limiter interface {
+	Acquire(ctx context.Context, batch bool) (func(), bool)
+}
+
+// LimitedClient wraps client so that every analysis first takes a batch slot
+// of limiter, for background work such as jobs, crawls and scheduled runs.
+// Nobody waits on that work, so a saturated limiter is retried after
+// CapacityRetryWait until ctx ends, rather than failing the analysis.
+func LimitedClient(client Client, limiter Limiter) Client {
+	return ClientFunc(func(ctx context.Context, targetURL string, opts AnalysisOptions) *AnalysisResult {
+		for {
+			if release, ok := limiter.Acquire(ctx, true); ok {
+				defer release()
+				return client.AnalyzeURLWithOptions(ctx, targetURL, opts)
+			}
+			select {
+			case <-time.After(CapacityRetryWait):
+			case <-ctx.Done():
+				return &AnalysisResult{
+					URL:           targetURL,
+					HeadingCounts: make(map[string]int),
+					Error:         ClassifyFetchError(targetURL, ctx.Err()),
+				}
+			}
+		}
+	})
+}
+
+// MockCall records one analysis requested from a MockClient
+type MockCall struct {
+	URL     string
+	Options AnalysisOptions
+}
+
+// MockClient is a Client returning canned results without network access. It
+// answers from AnalyzeFunc when set, otherwise from the results registered with
+// SetResult, and reports URLs without a result as 404 Not Found. It is safe for
+// concurrent use.
+type MockClient struct {
+	// AnalyzeFunc, when set, produces the result of every call
+	AnalyzeFunc func(ctx context.Context, targetURL string, opts AnalysisOptions) *AnalysisResult
+
+	mu      sync.Mutex
+	results map[string]*AnalysisResult
+	calls   []MockCall
+}
+
+// NewMockClient creates a mock client without results
+func NewMockClient() *MockClient {
+	return &MockClient{results: make(map[string]*AnalysisResult)}
+}
+
+// SetResult registers the result returned for targetURL
+func (m *MockClient) SetResult(targetURL string, result *AnalysisResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.results[targetURL] = result
+}
+
+// AnalyzeURLWithOptions records the call and returns a copy of the result for targetURL
+func (m *MockClient) AnalyzeURLWithOptions(ctx context.Context, targetURL string, opts AnalysisOptions) *AnalysisResult {
+	m.mu.Lock()
+	m.calls = append(m.calls, MockCall{URL: targetURL, Options: opts})
+	canned, ok := m.results[targetURL]
+	m.mu.Unlock()
+
+	if m.AnalyzeFunc != nil {
+		return m.AnalyzeFunc(ctx, targetURL, opts)
+	}
+	if !ok {
+		return &AnalysisResult{URL: targetURL, FetchedAt: time.Now(), Error: NewHTTPError(http.StatusNotFound, targetURL)}
+	}
+	result := *canned
+	if result.URL == "" {
+		result.URL = targetURL
+	}
+	return &result
+}
+
+// Calls returns the analyses requested so far, in order
+func (m *MockClient) Calls() []MockCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]MockCall(nil), m.calls...)
+}
@@ -0,0 +1,201 @@
+package analyzer
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Client redirect methods
+const (
+	ClientRedirectScript      = "script"
+	ClientRedirectMetaRefresh = "meta_refresh"
+)
+
+// hydrationFrameworks are frameworks that render or hydrate the page in the browser
+var hydrationFrameworks = []thirdPartySignature{
+	{
+		name:    "Next.js",
+		sources: []string{"/_next/static/"},
+		markers: []string{"__next", "__NEXT_DATA__"},
+		inline:  []string{"self.__next_f"},
+	},
+	{
+		name:    "Nuxt",
+		sources: []string{"/_nuxt/"},
+		markers: []string{"__nuxt", "__NUXT_DATA__"},
+		inline:  []string{"window.__NUXT__"},
+	},
+	{
+		name:    "Gatsby",
+		markers: []string{"___gatsby"},
+	},
+	{
+		name:   "Remix",
+		inline: []string{"window.__remixContext"},
+	},
+	{
+		name:    "SvelteKit",
+		sources: []string{"/_app/immutable/"},
+		inline:  []string{"__sveltekit"},
+	},
+	{
+		name:    "Astro",
+		sources: []string{"/_astro/"},
+	},
+	{
+		name:       "React",
+		attributes: []string{"data-reactroot", "data-reactid"},
+	},
+	{
+		name:       "Vue",
+		attributes: []string{"data-server-rendered", "data-v-app"},
+	},
+	{
+		name:       "Angular",
+		attributes: []string{"ng-version", "ng-server-context"},
+	},
+}
+
+// appRootIDs are the ids of elements single-page apps render into
+var appRootIDs = map[string]bool{"root": true, "app": true, "__next": true, "__nuxt": true, "___gatsby": true}
+
+var (
+	// locationAssignPattern matches assignments such as window.location = "..." or
+	// location.href = url, but not comparisons
+	locationAssignPattern = regexp.MustCompile(`\b(?:(?:window|document|self|top)\.location(?:\.href)?|location\.href)\s*=\s*([^=;\n][^;\n]*)`)
+	// locationCallPattern matches location.replace("...") and location.assign("...")
+	locationCallPattern = regexp.MustCompile(`\blocation\.(?:replace|assign)\(\s*([^)]*)\)`)
+)
+
+// detectClientSideRendering reports redirects performed in the browser and the
+// markers of frameworks that render or hydrate the page with JavaScript, where
+// analyzing the served HTML may miss what users see; it returns nil when there
+// are none
+func (a *Analyzer) detectClientSideRendering(doc *html.Node, baseURL *url.URL) *ClientSideReport {
+	report := &ClientSideReport{}
+	for _, match := range matchThirdParties(doc, hydrationFrameworks) {
+		report.Frameworks = append(report.Frameworks, match.name)
+		report.Evidence = append(report.Evidence, match.evidence...)
+	}
+
+	traverser := NewHTMLTraverser()
+	addRedirect := func(redirect ClientRedirect) {
+		if len(report.Redirects) < MaxClientRedirects {
+			report.Redirects = append(report.Redirects, redirect)
+		}
+	}
+	var body *html.Node
+	emptyRoot := ""
+	traverser.TraverseAllElements(doc, func(n *html.Node) {
+		switch n.Data {
+		case "body":
+			body = n
+		case "meta":
+			if strings.EqualFold(traverser.GetAttributeValue(n, "http-equiv"), "refresh") {
+				if redirect, ok := parseMetaRefresh(traverser.GetAttributeValue(n, "content"), baseURL); ok {
+					addRedirect(redirect)
+				}
+			}
+		case "script":
+			if traverser.GetAttributeValue(n, "src") == "" {
+				for _, redirect := range scriptRedirects(nodeText(n), baseURL) {
+					addRedirect(redirect)
+				}
+			}
+		}
+		if id := traverser.GetAttributeValue(n, "id"); emptyRoot == "" && appRootIDs[id] && strings.TrimSpace(nodeText(n)) == "" {
+			emptyRoot = id
+		}
+	})
+
+	// An empty app root in a page with little text means the content is rendered in the browser
+	if emptyRoot != "" && body != nil && len(strings.TrimSpace(contentText(body))) < MinServerRenderedText {
+		report.EmptyShell = true
+		report.Evidence = append(report.Evidence, "empty_root:"+emptyRoot)
+	}
+
+	if len(report.Redirects) > 0 {
+		report.Findings = append(report.Findings, Finding{Severity: SeverityMedium, Subject: "redirect",
+			Message: "Page redirects in the browser; the analyzed HTML may not be the page users end up on"})
+	}
+	if report.EmptyShell {
+		report.Findings = append(report.Findings, Finding{Severity: SeverityMedium, Subject: "#" + emptyRoot,
+			Message: "Page content is rendered by JavaScript into an empty app root; headings, links and text are missing from the served HTML"})
+	} else if len(report.Frameworks) > 0 {
+		report.Findings = append(report.Findings, Finding{Severity: SeverityInfo, Subject: strings.Join(report.Frameworks, ", "),
+			Message: "Page is hydrated in the browser, which may change its content after load"})
+	}
+	if len(report.Findings) == 0 {
+		return nil
+	}
+	report.RenderingRecommended = len(report.Redirects) > 0 || report.EmptyShell
+	return report
+}
+
+// parseMetaRefresh parses the content of <meta http-equiv="refresh">, such as
+// "5; url=/next"; a refresh without a URL reloads the page and is not a redirect
+func parseMetaRefresh(content string, baseURL *url.URL) (ClientRedirect, bool) {
+	delay, target, found := strings.Cut(content, ";")
+	if !found {
+		delay, target, _ = strings.Cut(content, ",")
+	}
+	target = strings.TrimSpace(target)
+	if len(target) >= 4 && strings.EqualFold(target[:4], "url=") {
+		target = strings.TrimSpace(target[4:])
+	}
+	target = strings.Trim(target, `'"`)
+	if target == "" {
+		return ClientRedirect{}, false
+	}
+
+	redirect := ClientRedirect{Method: ClientRedirectMetaRefresh, Target: target}
+	if seconds, err := strconv.ParseFloat(strings.TrimSpace(delay), 64); err == nil && seconds > 0 {
+		redirect.DelaySeconds = seconds
+	}
+	if resolved, err := baseURL.Parse(target); err == nil {
+		redirect.Target = resolved.String()
+	}
+	return redirect, true
+}
+
+// scriptRedirects finds assignments to and navigation calls on location in an
+// inline script; targets given as string literals are resolved against baseURL
+func scriptRedirects(script string, baseURL *url.URL) []ClientRedirect {
+	var redirects []ClientRedirect
+	for _, pattern := range []*regexp.Regexp{locationAssignPattern, locationCallPattern} {
+		for _, match := range pattern.FindAllStringSubmatch(script, MaxClientRedirects) {
+			redirect := ClientRedirect{Method: ClientRedirectScript, Code: match[0]}
+			if len(redirect.Code) > 120 {
+				redirect.Code = redirect.Code[:120] + "..."
+			}
+			if target, ok := stringLiteral(match[1]); ok {
+				if resolved, err := baseURL.Parse(target); err == nil {
+					redirect.Target = resolved.String()
+				}
+			}
+			redirects = append(redirects, redirect)
+		}
+	}
+	return redirects
+}
+
+// stringLiteral returns the contents of a quoted JavaScript string expression
+func stringLiteral(expression string) (string, bool) {
+	expression = strings.TrimSpace(expression)
+	if len(expression) < 2 {
+		return "", false
+	}
+	quote := expression[0]
+	if (quote != '"' && quote != '\'' && quote != '`') || expression[len(expression)-1] != quote {
+		return "", false
+	}
+	value := expression[1 : len(expression)-1]
+	if strings.ContainsRune(value, rune(quote)) || (quote == '`' && strings.Contains(value, "${")) {
+		return "", false
+	}
+	return value, true
+}
@@ -0,0 +1,81 @@
+package analyzer
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// consentPlatforms lists common consent-management platforms
+var consentPlatforms = []thirdPartySignature{
+	{
+		name:    "OneTrust",
+		sources: []string{"cdn.cookielaw.org", "optanon.blob.core.windows.net", "otsdkstub.js"},
+		markers: []string{"onetrust-banner-sdk", "onetrust-consent-sdk"},
+		inline:  []string{"OptanonWrapper"},
+	},
+	{
+		name:    "Cookiebot",
+		sources: []string{"consent.cookiebot.com", "consentcdn.cookiebot.com"},
+		markers: []string{"CybotCookiebotDialog"},
+	},
+	{
+		name:    "Didomi",
+		sources: []string{"sdk.privacy-center.org"},
+		markers: []string{"didomi-host", "didomi-notice"},
+		inline:  []string{"didomiConfig"},
+	},
+	{
+		name:    "TrustArc",
+		sources: []string{"consent.trustarc.com", "consent.truste.com"},
+		markers: []string{"truste-consent-track", "teconsent"},
+	},
+	{
+		name:    "Quantcast Choice",
+		sources: []string{"cmp.quantcast.com", "quantcast.mgr.consensu.org"},
+		markers: []string{"qc-cmp2-container"},
+	},
+	{
+		name:    "Usercentrics",
+		sources: []string{"app.usercentrics.eu", "web.cmp.usercentrics.eu"},
+		markers: []string{"usercentrics-root"},
+	},
+	{
+		name:    "Osano",
+		sources: []string{"cmp.osano.com"},
+	},
+	{
+		name:    "CookieYes",
+		sources: []string{"cdn-cookieyes.com"},
+		markers: []string{"cky-consent"},
+	},
+}
+
+// consentBannerTokens are id and class tokens used by hand-rolled cookie banners
+var consentBannerTokens = []string{"cookie-banner", "cookie-consent", "cookieconsent", "cookie-notice", "cookie-bar", "gdpr-banner", "cc-banner"}
+
+// detectConsent reports consent-management platforms and whether a consent banner is present.
+// CMP banners are usually injected at runtime, so a detected platform implies a banner.
+func (a *Analyzer) detectConsent(doc *html.Node) *ConsentInfo {
+	info := &ConsentInfo{}
+
+	for _, match := range matchThirdParties(doc, consentPlatforms) {
+		info.Platforms = append(info.Platforms, match.name)
+		info.Evidence = append(info.Evidence, match.evidence...)
+	}
+
+	traverser := NewHTMLTraverser()
+	traverser.TraverseAllElements(doc, func(n *html.Node) {
+		names := strings.ToLower(traverser.GetAttributeValue(n, "id") + " " + traverser.GetAttributeValue(n, "class"))
+		for _, name := range strings.Fields(names) {
+			for _, token := range consentBannerTokens {
+				if strings.Contains(name, token) {
+					info.Evidence = appendUnique(info.Evidence, "banner:"+token)
+				}
+			}
+		}
+	})
+
+	info.BannerPresent = len(info.Evidence) > 0
+	return info
+}
@@ -4,20 +4,63 @@ import "time"
 
 // Timeout constants
 const (
-	DefaultTimeout        = 60 * time.Second
-	LinkCheckTimeout      = 3 * time.Second
-	HTMLAnalysisTimeout   = 10 * time.Second
-	CircuitBreakerTimeout = 60 * time.Second
-	CacheCleanupInterval  = 5 * time.Minute
-	CacheDefaultTTL       = 5 * time.Minute
+	DefaultTimeout   = 60 * time.Second
+	LinkCheckTimeout = 3 * time.Second
+	// DefaultLinkCheckDeadline bounds an analysis's link checks unless its
+	// caller's deadline is earlier; LinkCheckDeadlineReserve (at most a tenth
+	// of the time left) of that deadline is kept for reporting the results
+	DefaultLinkCheckDeadline = 45 * time.Second
+	LinkCheckDeadlineReserve = 1 * time.Second
+	HTMLAnalysisTimeout      = 10 * time.Second
+	VariantFetchTimeout      = 10 * time.Second
+	AMPFetchTimeout          = 10 * time.Second
+	ThreatCheckTimeout       = 5 * time.Second
+	RDAPLookupTimeout        = 10 * time.Second
+	WaybackLookupTimeout     = 10 * time.Second
+	EventPublishTimeout      = 5 * time.Second
+	NotificationTimeout      = 10 * time.Second
+	PluginTimeout            = 5 * time.Second
+	RDAPCacheTTL             = 24 * time.Hour
+	PageSpeedTimeout         = 45 * time.Second // Lighthouse runs remotely for each lookup
+	PageSpeedCacheTTL        = 6 * time.Hour
+	CDNLookupTimeout         = 3 * time.Second
+	CircuitBreakerTimeout    = 60 * time.Second
+	CacheCleanupInterval     = 5 * time.Minute
+	CacheDefaultTTL          = 5 * time.Minute
+	CacheNegativeTTL         = 30 * time.Second
+	RedisTimeout             = 2 * time.Second
 )
 
 // HTTP constants
 const (
-	MaxHeaderBytes = 1 << 20 // 1MB
-	ReadTimeout    = 15 * time.Second
-	WriteTimeout   = 15 * time.Second
-	IdleTimeout    = 60 * time.Second
+	MaxHeaderBytes       = 1 << 20  // 1MB
+	DefaultMaxBodySize   = 10 << 20 // 10MB maximum page size fetched for analysis
+	MaintenanceBodyLimit = 1 << 16  // 64KB read from error responses for maintenance detection
+	VariantBodyLimit     = 1 << 18  // 256KB read from variant responses to extract the title
+	AMPBodyLimit         = 1 << 18  // 256KB read from AMP and canonical counterparts to find their links
+	ReadTimeout          = 15 * time.Second
+	WriteTimeout         = 15 * time.Second
+	IdleTimeout          = 60 * time.Second
+
+	// MaintenanceMaxContentText is the characters of body text below which a
+	// successful page with a maintenance phrase counts as a holding page
+	MaintenanceMaxContentText = 500
+)
+
+// Cache constants
+const (
+	CacheShardCount     = 16
+	MaxRDAPCacheEntries = 10000 // registrable domains whose lookups are kept
+)
+
+// Metrics constants
+const (
+	LatencyWindowSize = 1000 // recent analysis durations kept for latency percentiles
+)
+
+// Buffer pool constants
+const (
+	MaxPooledBufferSize = 1 << 20 // 1MB; larger body buffers are left to the GC
 )
 
 // Worker pool constants
@@ -25,6 +68,8 @@ const (
 	BufferMultiplier = 4
 	MinWorkers       = 4
 	MaxWorkers       = 100
+	// AdaptiveSlowCheck is the check latency above which a pool's concurrency backs off
+	AdaptiveSlowCheck = 2 * time.Second
 )
 
 // Circuit breaker constants
@@ -33,8 +78,171 @@ const (
 	DefaultSuccessThreshold = 2
 )
 
+// Shared state constants
+const (
+	SharedKeyPrefix = "web-page-analyzer:" // namespaces keys in a shared Redis
+	RedisPoolSize   = 10                   // idle Redis connections kept for reuse
+)
+
+// Retry-After constants
+const (
+	DefaultRetryAfterBudget = 10 * time.Second // total a request may wait on 429 responses
+	DefaultRetryAfterWait   = 1 * time.Second  // wait when a 429 carries no usable Retry-After
+	MaxRetryAfterAttempts   = 2                // retries of one request after 429 responses
+	MaxThrottledHosts       = 1000             // hosts tracked in throttling metrics
+)
+
+// Background work constants
+const (
+	CapacityRetryWait = 1 * time.Second // wait before background work asks a saturated limiter again
+	MaxQueuedEvents   = 1000            // events waiting for each publisher; newer ones are dropped
+)
+
+// Host reputation constants
+const (
+	ReputationWindow       = 20               // most recent link checks kept per host
+	MaxReputationHosts     = 5000             // hosts tracked; the least recently checked are evicted
+	ReputationDeadChecks   = 5                // failed checks in a row after which a host counts as dead
+	ReputationRecheckAfter = 1 * time.Hour    // a dead host is checked again once this long has passed
+	ReputationMinSamples   = 5                // successful checks needed to tune a host's timeout
+	ReputationTimeoutScale = 4                // multiple of a host's median latency allowed per check
+	ReputationMinTimeout   = 1 * time.Second  // shortest tuned link check timeout
+	ReputationMaxTimeout   = 10 * time.Second // longest tuned link check timeout
+	ReputationSaveInterval = 30 * time.Second // least time between writes of the reputation file
+)
+
+// Link check constants
+const (
+	LinkHostFailureBudget = 3  // failed checks before remaining links to a host are skipped
+	LinkProgressInterval  = 20 // checked links between progress reports
+)
+
+// Outbound budget constants
+const (
+	MaxReportedSkippedURLs = 20 // URLs listed when an analysis exceeds its outbound budget
+)
+
+// Robots consistency constants
+const (
+	RobotsFetchTimeout = 10 * time.Second
+	RobotsTxtBodyLimit = 512 << 10 // crawlers ignore robots.txt content beyond 500KiB
+	SitemapBodyLimit   = 10 << 20  // 10MB, above the 50,000 URL sitemap limit
+	MaxSitemapFetches  = 5         // sitemaps and sitemap indexes read per analysis
+	MaxSitemapURLs     = 50000     // page URLs collected from sitemaps, one full sitemap
+)
+
+// Bot identity constants
+const (
+	DefaultBotName  = "WebPageAnalyzer" // product token used when only an info URL is configured
+	OptOutRobotsTTL = time.Hour         // how long a site's robots.txt is trusted for opt-out checks
+)
+
+// Content extraction constants
+const (
+	ReadingWordsPerMinute = 200
+	MinParagraphLength    = 25
+	MinContentLength      = 140
+)
+
+// Threat check constants
+const (
+	MaxSafeBrowsingEntries = 500
+)
+
+// DOM size thresholds, matching Lighthouse's DOM size audit
+const (
+	DOMNodeWarningThreshold = 800
+	DOMNodeErrorThreshold   = 1400
+	DOMDepthThreshold       = 32
+	DOMChildrenThreshold    = 60
+)
+
+// Inline script detection constants
+const (
+	MaxInlineScriptExamples = 10
+	MaxInlineScriptSnippet  = 100
+)
+
+// Duplicate detection constants
+const (
+	FingerprintShingleSize    = 3
+	DefaultDuplicateThreshold = 3
+	MaxDuplicateURLs          = 50
+)
+
+// Responsive image constants
+const (
+	ResponsiveImageMinWidth    = 640 // declared widths from which images need responsive variants
+	MaxResponsiveImageFindings = 50
+)
+
+// Heading text constants
+const (
+	DefaultHeadingsTextLimit = 20  // headings returned per level by include_headings_text
+	MaxHeadingsTextLimit     = 500 // largest headings_text_limit accepted
+)
+
+// New tab link constants
+const (
+	MaxNewTabExamples = 10
+)
+
+// Client-side rendering constants
+const (
+	MaxClientRedirects    = 10
+	MinServerRenderedText = 200 // characters of body text below which an app root counts as an empty shell
+)
+
+// TLS inspection constants
+const (
+	CertExpiryWarningDays = 30               // certificates expiring within this many days are flagged
+	TLSInspectionTimeout  = 10 * time.Second // handshake made to report on a failed TLS fetch
+)
+
+// Social image constants
+const (
+	MaxSocialImages = 20
+)
+
+// Image constants
+const (
+	MaxImageChecks = 100 // distinct image URLs HEAD-checked per page
+	LargestImages  = 5   // images listed by size
+)
+
+// Hreflang constants
+const (
+	MaxHreflangURLs = 50
+)
+
+// HTML validation constants
+const (
+	MaxValidationIssues = 100
+)
+
 // Cache constants
 const (
 	CacheCleanupIntervalMinutes = 5
 	CacheVerboseThreshold       = 10
 )
+
+// Custom extraction constants
+const (
+	MaxExtractionRules = 50
+	MaxExtractedValue  = 1000 // characters kept per extracted value
+)
+
+// Request priority constants
+const (
+	BatchLinkChecksWhileInteractive = 4 // batch link checks allowed at once while an interactive analysis runs
+)
+
+// Dry run constants
+const (
+	MaxDryRunURLs     = 1000 // URLs accepted per dry run
+	DryRunConcurrency = 8    // URLs dry-run at once
+	DryRunDNSTimeout  = 5 * time.Second
+)
+
+// MaxAssertions caps the content assertions accepted per request
+const MaxAssertions = 50
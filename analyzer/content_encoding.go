@@ -0,0 +1,83 @@
+package analyzer
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// AcceptEncoding lists the content codings analysis requests accept
+const AcceptEncoding = "gzip, deflate, br"
+
+// decodeContentEncoding makes resp read its body decompressed when the server
+// used a coding from AcceptEncoding. The response headers are kept as sent;
+// ContentLength becomes unknown and Uncompressed is set, as the standard
+// transport does for the gzip it negotiates itself.
+func decodeContentEncoding(resp *http.Response) *http.Response {
+	if resp.Uncompressed || resp.Body == nil || resp.Body == http.NoBody {
+		return resp
+	}
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	switch encoding {
+	case "gzip", "x-gzip", "deflate", "br":
+	default:
+		return resp
+	}
+
+	resp.Body = &decodedBody{body: resp.Body, encoding: encoding}
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp
+}
+
+// decodedBody decompresses a response body, creating the decoder on the first
+// read so empty bodies, as in HEAD responses, are not an error
+type decodedBody struct {
+	body     io.ReadCloser
+	encoding string
+	reader   io.Reader
+	err      error
+}
+
+func (b *decodedBody) Read(p []byte) (int, error) {
+	if b.reader == nil && b.err == nil {
+		b.reader, b.err = newDecoder(b.encoding, b.body)
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.reader.Read(p)
+}
+
+func (b *decodedBody) Close() error {
+	return b.body.Close()
+}
+
+// newDecoder returns a reader decompressing r according to encoding
+func newDecoder(encoding string, r io.Reader) (io.Reader, error) {
+	switch encoding {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r)
+	case "br":
+		return brotli.NewReader(r), nil
+	default:
+		// deflate should be zlib-wrapped, but some servers send raw deflate
+		buffered := bufio.NewReader(r)
+		if header, err := buffered.Peek(2); err == nil && isZlibHeader(header) {
+			return zlib.NewReader(buffered)
+		}
+		return flate.NewReader(buffered), nil
+	}
+}
+
+// isZlibHeader reports whether header starts a zlib stream: deflate
+// compression with a checksum making the first two bytes a multiple of 31
+func isZlibHeader(header []byte) bool {
+	return header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0
+}
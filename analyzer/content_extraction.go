@@ -0,0 +1,213 @@
+package analyzer
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// boilerplateElements never contain main article content
+var boilerplateElements = map[string]bool{
+	"nav": true, "footer": true, "header": true, "aside": true, "script": true,
+	"style": true, "noscript": true, "form": true, "iframe": true, "svg": true,
+	"button": true, "template": true, "select": true, "dialog": true,
+}
+
+// boilerplateRoles are ARIA landmark roles used for page chrome
+var boilerplateRoles = map[string]bool{
+	"navigation": true, "banner": true, "contentinfo": true, "complementary": true,
+	"search": true, "dialog": true, "alert": true,
+}
+
+// boilerplateTokens are class and id tokens that mark ads and page chrome
+var boilerplateTokens = map[string]bool{
+	"ad": true, "ads": true, "advert": true, "advertisement": true, "sponsor": true,
+	"sponsored": true, "promo": true, "sidebar": true, "comment": true, "comments": true,
+	"cookie": true, "share": true, "social": true, "menu": true, "breadcrumb": true,
+	"breadcrumbs": true, "footer": true, "nav": true, "navbar": true, "related": true,
+	"popup": true, "newsletter": true, "banner": true,
+}
+
+// contentBlockElements start a new line of text in the extracted content
+var contentBlockElements = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "main": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"li": true, "pre": true, "blockquote": true, "br": true, "tr": true,
+	"td": true, "th": true, "dt": true, "dd": true, "figcaption": true,
+}
+
+// scoredElements are the elements whose text is used to score their ancestors
+var scoredElements = map[string]bool{
+	"p": true, "pre": true, "blockquote": true, "td": true,
+}
+
+// extractMainContent isolates the main article content of the page and returns
+// its plain text with a word count and estimated reading time
+func (a *Analyzer) extractMainContent(doc *html.Node) *MainContent {
+	candidate := findContentRoot(doc)
+	if candidate == nil {
+		return nil
+	}
+
+	text := contentText(candidate)
+	words := len(strings.Fields(text))
+	content := &MainContent{
+		Text:      text,
+		WordCount: words,
+	}
+	if words > 0 {
+		content.ReadingTimeMinutes = (words + ReadingWordsPerMinute - 1) / ReadingWordsPerMinute
+	}
+	return content
+}
+
+// findContentRoot picks the element most likely to hold the main content.
+// Semantic <article> and <main> elements win; otherwise paragraphs are scored
+// and their scores propagated to parents and grandparents.
+func findContentRoot(doc *html.Node) *html.Node {
+	traverser := NewHTMLTraverser()
+
+	var semantic, body *html.Node
+	semanticLength := 0
+	scores := make(map[*html.Node]float64)
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if isBoilerplate(traverser, n) {
+				return
+			}
+			switch {
+			case n.Data == "body":
+				body = n
+			case n.Data == "article" || n.Data == "main":
+				// Prefer the semantic element with the most text
+				if length := len(contentText(n)); length > semanticLength {
+					semantic, semanticLength = n, length
+				}
+			case scoredElements[n.Data]:
+				scoreParagraph(n, scores)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	if semantic != nil && semanticLength >= MinContentLength {
+		return semantic
+	}
+
+	var best *html.Node
+	bestScore := 0.0
+	for n, score := range scores {
+		score *= 1 - linkDensity(n)
+		if score > bestScore {
+			best, bestScore = n, score
+		}
+	}
+	if best != nil {
+		return best
+	}
+	if semantic != nil {
+		return semantic
+	}
+	return body
+}
+
+// scoreParagraph adds a paragraph's score to its parent and half of it to its grandparent
+func scoreParagraph(n *html.Node, scores map[*html.Node]float64) {
+	text := nodeText(n)
+	if len(text) < MinParagraphLength || n.Parent == nil {
+		return
+	}
+
+	score := 1 + float64(strings.Count(text, ","))
+	if bonus := float64(len(text)) / 100; bonus < 3 {
+		score += bonus
+	} else {
+		score += 3
+	}
+
+	scores[n.Parent] += score
+	if n.Parent.Parent != nil {
+		scores[n.Parent.Parent] += score / 2
+	}
+}
+
+// linkDensity returns the share of an element's text that sits inside links
+func linkDensity(n *html.Node) float64 {
+	total := len(nodeText(n))
+	if total == 0 {
+		return 0
+	}
+
+	linked := 0
+	NewHTMLTraverser().TraverseElements(n, "a", func(link *html.Node) {
+		linked += len(nodeText(link))
+	})
+	return float64(linked) / float64(total)
+}
+
+// isBoilerplate reports whether an element is navigation, advertising or other page chrome
+func isBoilerplate(traverser *HTMLTraverser, n *html.Node) bool {
+	if boilerplateElements[n.Data] {
+		return true
+	}
+	if boilerplateRoles[strings.ToLower(traverser.GetAttributeValue(n, "role"))] {
+		return true
+	}
+
+	names := traverser.GetAttributeValue(n, "class") + " " + traverser.GetAttributeValue(n, "id")
+	tokens := strings.FieldsFunc(strings.ToLower(names), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, token := range tokens {
+		if boilerplateTokens[token] {
+			return true
+		}
+	}
+	return false
+}
+
+// contentText returns the readable text of an element, skipping boilerplate
+// descendants and keeping one line per block element
+func contentText(root *html.Node) string {
+	traverser := NewHTMLTraverser()
+	var sb strings.Builder
+
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			sb.WriteString(n.Data)
+			return
+		case html.ElementNode:
+			if n != root && isBoilerplate(traverser, n) {
+				return
+			}
+		}
+
+		block := n.Type == html.ElementNode && contentBlockElements[n.Data]
+		if block {
+			sb.WriteString("\n")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			collect(c)
+		}
+		if block {
+			sb.WriteString("\n")
+		}
+	}
+	collect(root)
+
+	var lines []string
+	for _, line := range strings.Split(sb.String(), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,102 @@
+package analyzer
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// Analysis phases timed for the cost breakdown
+const (
+	phaseFetch = iota
+	phaseParse
+	phaseLinkChecks
+	phaseCount
+)
+
+// AnalysisTimings breaks down the wall-clock time of an analysis. Link checks
+// run concurrently, so LinkChecksMs is the time until the last one finished.
+type AnalysisTimings struct {
+	FetchMs      int64 `json:"fetch_ms"` // requesting the page and reading its body
+	ParseMs      int64 `json:"parse_ms"`
+	LinkChecksMs int64 `json:"link_checks_ms"`
+	OtherMs      int64 `json:"other_ms"` // content checks, probes and lookups
+}
+
+// phaseTimer sums the time an analysis spends in each phase
+type phaseTimer struct {
+	mu      sync.Mutex
+	elapsed [phaseCount]time.Duration
+}
+
+type phaseTimerKey struct{}
+
+// withPhaseTimer attaches a timer to the context of an analysis
+func withPhaseTimer(ctx context.Context, timer *phaseTimer) context.Context {
+	return context.WithValue(ctx, phaseTimerKey{}, timer)
+}
+
+// timePhase starts timing phase for the analysis ctx belongs to and returns the
+// func that stops it; only the first call counts, so it may also be deferred
+// as a fallback for early returns
+func timePhase(ctx context.Context, phase int) func() {
+	timer, _ := ctx.Value(phaseTimerKey{}).(*phaseTimer)
+	if timer == nil {
+		return func() {}
+	}
+	start := time.Now()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			timer.mu.Lock()
+			defer timer.mu.Unlock()
+			timer.elapsed[phase] += time.Since(start)
+		})
+	}
+}
+
+// timings reports the phases of an analysis that took total
+func (t *phaseTimer) timings(total time.Duration) *AnalysisTimings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	timings := &AnalysisTimings{
+		FetchMs:      t.elapsed[phaseFetch].Milliseconds(),
+		ParseMs:      t.elapsed[phaseParse].Milliseconds(),
+		LinkChecksMs: t.elapsed[phaseLinkChecks].Milliseconds(),
+	}
+	if other := total.Milliseconds() - timings.FetchMs - timings.ParseMs - timings.LinkChecksMs; other > 0 {
+		timings.OtherMs = other
+	}
+	return timings
+}
+
+// countingBody charges the response body bytes read to an outbound budget
+type countingBody struct {
+	io.ReadCloser
+	budget *outboundBudget
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.budget.addBytes(n)
+	return n, err
+}
+
+type costRecorderKey struct{}
+
+// WithCostRecorder returns a context whose analyses pass their outbound usage to
+// record once they finish, e.g. to charge egress to the caller. Only the
+// analysis that ran is charged: results answered from the cache or shared with
+// a concurrent request for the same page cost nothing and are not recorded.
+func WithCostRecorder(ctx context.Context, record func(*OutboundUsage)) context.Context {
+	return context.WithValue(ctx, costRecorderKey{}, record)
+}
+
+// recordCost passes usage to the cost recorder of the analysis ctx belongs to, if any
+func recordCost(ctx context.Context, usage *OutboundUsage) {
+	if record, ok := ctx.Value(costRecorderKey{}).(func(*OutboundUsage)); ok {
+		record(usage)
+	}
+}
@@ -0,0 +1,276 @@
+package analyzer
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Finding severities
+const (
+	SeverityHigh   = "high"
+	SeverityMedium = "medium"
+	SeverityLow    = "low"
+	SeverityInfo   = "info"
+)
+
+// CSP policy sources
+const (
+	CSPSourceHeader           = "header"
+	CSPSourceHeaderReportOnly = "header-report-only"
+	CSPSourceMeta             = "meta"
+)
+
+// scriptDirectives are the directives that govern script execution
+var scriptDirectives = []string{"script-src", "script-src-elem", "script-src-attr"}
+
+// analyzeCSP parses the Content-Security-Policy from response headers and meta tags
+// and flags weak configurations. Browsers enforce every policy delivered, so a
+// weakness is only reported when all enforced policies permit it.
+func (a *Analyzer) analyzeCSP(header http.Header, doc *html.Node) *CSPAnalysis {
+	analysis := &CSPAnalysis{
+		Directives: make(map[string][]string),
+	}
+
+	var policies []map[string][]string
+	addPolicies := func(source string, values []string) {
+		for _, value := range values {
+			if strings.TrimSpace(value) == "" {
+				continue
+			}
+			analysis.Sources = appendUnique(analysis.Sources, source)
+			policy := parseCSPPolicy(value)
+			policies = append(policies, policy)
+			for name, sources := range policy {
+				// Directives lists the first declaration of each directive; the
+				// policies are still evaluated independently
+				if _, exists := analysis.Directives[name]; !exists {
+					analysis.Directives[name] = sources
+				}
+			}
+		}
+	}
+
+	if header != nil {
+		addPolicies(CSPSourceHeader, header.Values("Content-Security-Policy"))
+	}
+	if doc != nil {
+		var metaPolicies []string
+		traverser := NewHTMLTraverser()
+		traverser.TraverseElements(doc, "meta", func(n *html.Node) {
+			if strings.EqualFold(traverser.GetAttributeValue(n, "http-equiv"), "Content-Security-Policy") {
+				metaPolicies = append(metaPolicies, traverser.GetAttributeValue(n, "content"))
+			}
+		})
+		addPolicies(CSPSourceMeta, metaPolicies)
+	}
+
+	enforced := len(policies) > 0
+	if header != nil && !enforced {
+		addPolicies(CSPSourceHeaderReportOnly, header.Values("Content-Security-Policy-Report-Only"))
+	}
+
+	analysis.Present = len(policies) > 0
+	analysis.Findings = cspFindings(policies, enforced)
+	return analysis
+}
+
+// parseCSPPolicy splits a serialized policy into lowercase directive names and their source lists
+func parseCSPPolicy(policy string) map[string][]string {
+	directives := make(map[string][]string)
+	for _, part := range strings.Split(policy, ";") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+		name := strings.ToLower(fields[0])
+		if _, exists := directives[name]; exists {
+			continue
+		}
+		directives[name] = fields[1:]
+	}
+	return directives
+}
+
+// cspWeakness is a weak source a policy allows, and the directive whose
+// resources it applies to
+type cspWeakness struct {
+	directive string
+	source    string // lowercase
+	finding   Finding
+}
+
+// cspFindings evaluates the policies for weak configurations, keeping the
+// weaknesses every policy permits
+func cspFindings(policies []map[string][]string, enforced bool) []Finding {
+	var findings []Finding
+
+	if len(policies) == 0 {
+		return append(findings, Finding{
+			Severity: SeverityMedium,
+			Message:  "No Content-Security-Policy is set",
+		})
+	}
+
+	if !enforced {
+		findings = append(findings, Finding{
+			Severity: SeverityMedium,
+			Message:  "Content-Security-Policy is report-only and not enforced",
+		})
+	}
+
+	defaultSrc := false
+	for _, policy := range policies {
+		if _, ok := policy["default-src"]; ok {
+			defaultSrc = true
+		}
+	}
+	if !defaultSrc {
+		findings = append(findings, Finding{
+			Severity: SeverityLow,
+			Subject:  "default-src",
+			Message:  "No default-src fallback is defined",
+		})
+	}
+
+	seen := make(map[string]bool)
+	for i, policy := range policies {
+		for _, weakness := range cspWeaknesses(policy) {
+			if seen[weakness.finding.Message] {
+				continue
+			}
+			permitted := true
+			for j, other := range policies {
+				if j != i && !cspPermits(other, weakness.directive, weakness.source) {
+					permitted = false
+					break
+				}
+			}
+			if permitted {
+				seen[weakness.finding.Message] = true
+				findings = append(findings, weakness.finding)
+			}
+		}
+	}
+
+	return findings
+}
+
+// cspWeaknesses lists the weak sources one policy allows
+func cspWeaknesses(directives map[string][]string) []cspWeakness {
+	var weaknesses []cspWeakness
+
+	names := make([]string, 0, len(directives))
+	for name := range directives {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		sources := directives[name]
+		isScript := isScriptDirective(name) || (name == "default-src" && !hasAnyDirective(directives, scriptDirectives))
+		// A default-src standing in for script-src is weak for scripts
+		directive := name
+		if isScript && name == "default-src" {
+			directive = "script-src"
+		}
+		hasNonceOrHash := false
+		for _, source := range sources {
+			lower := strings.ToLower(source)
+			if strings.HasPrefix(lower, "'nonce-") || strings.HasPrefix(lower, "'sha") || lower == "'strict-dynamic'" {
+				hasNonceOrHash = true
+			}
+		}
+
+		add := func(source, severity, message string) {
+			weaknesses = append(weaknesses, cspWeakness{
+				directive: directive,
+				source:    source,
+				finding:   Finding{Severity: severity, Subject: name, Message: message},
+			})
+		}
+		for _, source := range sources {
+			lower := strings.ToLower(source)
+			switch {
+			case lower == "'unsafe-inline'":
+				severity := SeverityLow
+				if isScript && !hasNonceOrHash {
+					severity = SeverityHigh
+				}
+				add(lower, severity, fmt.Sprintf("%s allows 'unsafe-inline'", name))
+			case lower == "'unsafe-eval'":
+				severity := SeverityMedium
+				if isScript {
+					severity = SeverityHigh
+				}
+				add(lower, severity, fmt.Sprintf("%s allows 'unsafe-eval'", name))
+			case lower == "*":
+				severity := SeverityMedium
+				if isScript {
+					severity = SeverityHigh
+				}
+				add(lower, severity, fmt.Sprintf("%s allows any source via wildcard", name))
+			case isScript && (lower == "http:" || lower == "https:" || lower == "data:"):
+				add(lower, SeverityMedium, fmt.Sprintf("%s allows any %s source", name, lower))
+			}
+		}
+	}
+
+	return weaknesses
+}
+
+// cspPermits reports whether a policy allows source for the resources of
+// directive, falling back to script-src and default-src as browsers do; a
+// policy restricting none of them allows everything
+func cspPermits(directives map[string][]string, directive, source string) bool {
+	sources, ok := directives[directive]
+	if !ok && isScriptDirective(directive) {
+		sources, ok = directives["script-src"]
+	}
+	if !ok && strings.HasSuffix(directive, "-src") {
+		sources, ok = directives["default-src"]
+	}
+	if !ok {
+		return true
+	}
+
+	hasNonceOrHash := false
+	permitted := false
+	for _, allowed := range sources {
+		lower := strings.ToLower(allowed)
+		if strings.HasPrefix(lower, "'nonce-") || strings.HasPrefix(lower, "'sha") || lower == "'strict-dynamic'" {
+			hasNonceOrHash = true
+		}
+		if lower == source || (lower == "*" && (source == "http:" || source == "https:")) {
+			permitted = true
+		}
+	}
+	// Browsers ignore 'unsafe-inline' for scripts once a nonce or hash is given
+	if source == "'unsafe-inline'" && isScriptDirective(directive) && hasNonceOrHash {
+		return false
+	}
+	return permitted
+}
+
+// isScriptDirective reports whether a directive governs script execution
+func isScriptDirective(name string) bool {
+	for _, directive := range scriptDirectives {
+		if name == directive {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAnyDirective reports whether any of the named directives is defined
+func hasAnyDirective(directives map[string][]string, names []string) bool {
+	for _, name := range names {
+		if _, ok := directives[name]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,353 @@
+package analyzer
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// selector is a compiled comma-separated list of CSS selectors. The supported
+// subset is type, universal, #id, .class and attribute selectors ([attr],
+// [attr=v], [attr~=v], [attr^=v], [attr$=v], [attr*=v]) joined by descendant
+// (space) and child (>) combinators.
+type selector []complexSelector
+
+// complexSelector is a chain of compound selectors; combinators[i] joins parts[i] and parts[i+1]
+type complexSelector struct {
+	parts       []compoundSelector
+	combinators []byte
+}
+
+// compoundSelector matches a single element
+type compoundSelector struct {
+	tag     string
+	id      string
+	classes []string
+	attrs   []attrSelector
+}
+
+// attrSelector matches an attribute by presence or value
+type attrSelector struct {
+	name  string
+	op    string
+	value string
+}
+
+// compileSelector parses a selector list
+func compileSelector(source string) (selector, error) {
+	var compiled selector
+	for _, part := range splitSelectorList(source) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("empty selector in %q", source)
+		}
+		chain, err := parseComplexSelector(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %w", part, err)
+		}
+		compiled = append(compiled, chain)
+	}
+	return compiled, nil
+}
+
+// splitSelectorList splits on commas outside attribute brackets and quotes
+func splitSelectorList(source string) []string {
+	var parts []string
+	depth, quote, start := 0, byte(0), 0
+	for i := 0; i < len(source); i++ {
+		switch c := source[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, source[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, source[start:])
+}
+
+// parseComplexSelector parses compound selectors and the combinators between them
+func parseComplexSelector(source string) (complexSelector, error) {
+	var chain complexSelector
+	pos := 0
+	for {
+		compound, next, err := parseCompoundSelector(source, pos)
+		if err != nil {
+			return chain, err
+		}
+		chain.parts = append(chain.parts, compound)
+		pos = next
+
+		sawSpace := false
+		for pos < len(source) && isSelectorSpace(source[pos]) {
+			pos++
+			sawSpace = true
+		}
+		if pos == len(source) {
+			return chain, nil
+		}
+		switch source[pos] {
+		case '>':
+			chain.combinators = append(chain.combinators, '>')
+			pos++
+			for pos < len(source) && isSelectorSpace(source[pos]) {
+				pos++
+			}
+		case '+', '~':
+			return chain, fmt.Errorf("sibling combinator %q is not supported", source[pos])
+		default:
+			if !sawSpace {
+				return chain, fmt.Errorf("unexpected %q", source[pos])
+			}
+			chain.combinators = append(chain.combinators, ' ')
+		}
+	}
+}
+
+// parseCompoundSelector parses one compound selector starting at pos
+func parseCompoundSelector(source string, pos int) (compoundSelector, int, error) {
+	var compound compoundSelector
+	start := pos
+
+	if pos < len(source) && source[pos] == '*' {
+		pos++
+	} else if name, next := readIdent(source, pos); next > pos {
+		compound.tag = strings.ToLower(name)
+		pos = next
+	}
+
+	for pos < len(source) {
+		switch source[pos] {
+		case '#', '.':
+			name, next := readIdent(source, pos+1)
+			if name == "" {
+				return compound, pos, fmt.Errorf("expected a name after %q", source[pos])
+			}
+			if source[pos] == '#' {
+				compound.id = name
+			} else {
+				compound.classes = append(compound.classes, name)
+			}
+			pos = next
+		case '[':
+			attr, next, err := parseAttrSelector(source, pos+1)
+			if err != nil {
+				return compound, pos, err
+			}
+			compound.attrs = append(compound.attrs, attr)
+			pos = next
+		case ':':
+			return compound, pos, fmt.Errorf("pseudo-classes are not supported")
+		default:
+			if pos == start {
+				return compound, pos, fmt.Errorf("unexpected %q", source[pos])
+			}
+			return compound, pos, nil
+		}
+	}
+	if pos == start {
+		return compound, pos, fmt.Errorf("expected a selector")
+	}
+	return compound, pos, nil
+}
+
+// parseAttrSelector parses the inside of [...] starting after the bracket
+func parseAttrSelector(source string, pos int) (attrSelector, int, error) {
+	var attr attrSelector
+	pos = skipSelectorSpace(source, pos)
+	name, next := readIdent(source, pos)
+	if name == "" {
+		return attr, pos, fmt.Errorf("expected an attribute name")
+	}
+	attr.name = strings.ToLower(name)
+	pos = skipSelectorSpace(source, next)
+
+	if pos < len(source) && source[pos] != ']' {
+		for _, op := range []string{"~=", "^=", "$=", "*=", "="} {
+			if strings.HasPrefix(source[pos:], op) {
+				attr.op = op
+				pos += len(op)
+				break
+			}
+		}
+		if attr.op == "" {
+			return attr, pos, fmt.Errorf("unsupported attribute operator at %q", source[pos:])
+		}
+		pos = skipSelectorSpace(source, pos)
+
+		if pos < len(source) && (source[pos] == '"' || source[pos] == '\'') {
+			end := strings.IndexByte(source[pos+1:], source[pos])
+			if end < 0 {
+				return attr, pos, fmt.Errorf("unterminated string")
+			}
+			attr.value = source[pos+1 : pos+1+end]
+			pos += end + 2
+		} else {
+			attr.value, pos = readIdent(source, pos)
+		}
+		pos = skipSelectorSpace(source, pos)
+	}
+
+	if pos >= len(source) || source[pos] != ']' {
+		return attr, pos, fmt.Errorf("expected ]")
+	}
+	return attr, pos + 1, nil
+}
+
+// readIdent reads a CSS identifier starting at pos
+func readIdent(source string, pos int) (string, int) {
+	start := pos
+	for pos < len(source) {
+		c := source[pos]
+		if c == '-' || c == '_' || c >= 0x80 || (c >= '0' && c <= '9') || (c|0x20 >= 'a' && c|0x20 <= 'z') {
+			pos++
+			continue
+		}
+		break
+	}
+	return source[start:pos], pos
+}
+
+func isSelectorSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func skipSelectorSpace(source string, pos int) int {
+	for pos < len(source) && isSelectorSpace(source[pos]) {
+		pos++
+	}
+	return pos
+}
+
+// matchAll returns the elements under root matched by any selector in the list, in document order
+func (s selector) matchAll(root *html.Node) []*html.Node {
+	var matches []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && s.matches(n) {
+			matches = append(matches, n)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+	return matches
+}
+
+// matches reports whether any selector in the list matches the element
+func (s selector) matches(n *html.Node) bool {
+	for _, chain := range s {
+		if chain.matchAt(n, len(chain.parts)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAt matches parts[i] against n and the earlier parts against its ancestors
+func (c complexSelector) matchAt(n *html.Node, i int) bool {
+	if !c.parts[i].matches(n) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	parent := parentElement(n)
+	if c.combinators[i-1] == '>' {
+		return parent != nil && c.matchAt(parent, i-1)
+	}
+	for ; parent != nil; parent = parentElement(parent) {
+		if c.matchAt(parent, i-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// parentElement returns the nearest element ancestor
+func parentElement(n *html.Node) *html.Node {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.Type == html.ElementNode {
+			return p
+		}
+	}
+	return nil
+}
+
+// matches reports whether the element satisfies every condition of the compound selector
+func (cs compoundSelector) matches(n *html.Node) bool {
+	if cs.tag != "" && n.Data != cs.tag {
+		return false
+	}
+	if cs.id != "" && attributeValue(n, "id") != cs.id {
+		return false
+	}
+	if len(cs.classes) > 0 {
+		classes := strings.Fields(attributeValue(n, "class"))
+		for _, want := range cs.classes {
+			if !containsString(classes, want) {
+				return false
+			}
+		}
+	}
+	for _, attr := range cs.attrs {
+		if !attr.matches(n) {
+			return false
+		}
+	}
+	return true
+}
+
+// matches reports whether the element's attribute satisfies the selector
+func (as attrSelector) matches(n *html.Node) bool {
+	for _, a := range n.Attr {
+		if a.Namespace != "" || a.Key != as.name {
+			continue
+		}
+		switch as.op {
+		case "":
+			return true
+		case "=":
+			return a.Val == as.value
+		case "~=":
+			return containsString(strings.Fields(a.Val), as.value)
+		case "^=":
+			return as.value != "" && strings.HasPrefix(a.Val, as.value)
+		case "$=":
+			return as.value != "" && strings.HasSuffix(a.Val, as.value)
+		case "*=":
+			return as.value != "" && strings.Contains(a.Val, as.value)
+		}
+	}
+	return false
+}
+
+// attributeValue returns an attribute's value, or "" when it is absent
+func attributeValue(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// containsString reports whether values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
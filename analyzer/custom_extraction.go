@@ -0,0 +1,155 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// ExtractionRule extracts a value from the first element matching a CSS selector
+// into AnalysisResult.CustomFields under Name
+type ExtractionRule struct {
+	Name     string `json:"name"`
+	Selector string `json:"selector"`
+	// Attribute is read from the matched element; empty extracts its text content
+	Attribute string `json:"attribute,omitempty"`
+	// All collects every match, joined by " | ", instead of only the first
+	All bool `json:"all,omitempty"`
+}
+
+// compiledRule is an extraction rule with its parsed selector
+type compiledRule struct {
+	ExtractionRule
+	selector selector
+}
+
+// compileExtractionRules validates rules and parses their selectors
+func compileExtractionRules(rules []ExtractionRule) ([]compiledRule, error) {
+	if len(rules) > MaxExtractionRules {
+		return nil, fmt.Errorf("at most %d extraction rules are allowed", MaxExtractionRules)
+	}
+	seen := make(map[string]bool, len(rules))
+	compiled := make([]compiledRule, 0, len(rules))
+	for i, rule := range rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("rule %d: name is required", i)
+		}
+		if seen[rule.Name] {
+			return nil, fmt.Errorf("rule %q is defined twice", rule.Name)
+		}
+		seen[rule.Name] = true
+
+		sel, err := compileSelector(rule.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", rule.Name, err)
+		}
+		rule.Attribute = strings.ToLower(rule.Attribute)
+		compiled = append(compiled, compiledRule{ExtractionRule: rule, selector: sel})
+	}
+	return compiled, nil
+}
+
+// ValidateExtractionRules reports the first problem with a set of rules, if any
+func ValidateExtractionRules(rules []ExtractionRule) error {
+	_, err := compileExtractionRules(rules)
+	return err
+}
+
+// LoadExtractionRules reads a JSON array of extraction rules from a file
+func LoadExtractionRules(path string) ([]ExtractionRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []ExtractionRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := ValidateExtractionRules(rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// SetExtractionRules sets the rules applied to every analysis. Rules given in a
+// request's options are applied after these and replace rules of the same name.
+func (a *Analyzer) SetExtractionRules(rules []ExtractionRule) error {
+	compiled, err := compileExtractionRules(rules)
+	if err != nil {
+		return err
+	}
+	a.extractionRules = compiled
+	return nil
+}
+
+// extractCustomFields applies the configured and per-request rules to the document
+func (a *Analyzer) extractCustomFields(doc *html.Node, requested []ExtractionRule) map[string]string {
+	rules := a.extractionRules
+	if len(requested) > 0 {
+		// Requests are validated by the handler; rules that fail to compile here are skipped
+		if compiled, err := compileExtractionRules(requested); err == nil {
+			overridden := make(map[string]bool, len(compiled))
+			for _, rule := range compiled {
+				overridden[rule.Name] = true
+			}
+			merged := make([]compiledRule, 0, len(rules)+len(compiled))
+			for _, rule := range rules {
+				if !overridden[rule.Name] {
+					merged = append(merged, rule)
+				}
+			}
+			rules = append(merged, compiled...)
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	fields := make(map[string]string)
+	for _, rule := range rules {
+		var values []string
+		for _, n := range rule.selector.matchAll(doc) {
+			value := extractedValue(n, rule.Attribute)
+			if value == "" {
+				continue
+			}
+			values = append(values, value)
+			if !rule.All {
+				break
+			}
+		}
+		if len(values) > 0 {
+			fields[rule.Name] = truncateValue(strings.Join(values, " | "))
+		}
+	}
+	return fields
+}
+
+// extractedValue returns an element's attribute, or its whitespace-collapsed text
+func extractedValue(n *html.Node, attribute string) string {
+	if attribute != "" {
+		return strings.TrimSpace(attributeValue(n, attribute))
+	}
+	return strings.Join(strings.Fields(nodeText(n)), " ")
+}
+
+// truncateValue limits an extracted value to MaxExtractedValue characters
+func truncateValue(value string) string {
+	runes := []rune(value)
+	if len(runes) <= MaxExtractedValue {
+		return value
+	}
+	return string(runes[:MaxExtractedValue])
+}
+
+// extractionKey identifies a set of per-request rules in cache keys
+func extractionKey(rules []ExtractionRule) string {
+	data, _ := json.Marshal(rules)
+	h := fnv.New64a()
+	h.Write(data)
+	return fmt.Sprintf("extract:%x", h.Sum64())
+}
@@ -0,0 +1,74 @@
+package analyzer
+
+import (
+	"fmt"
+
+	"golang.org/x/net/html"
+)
+
+// measureDOM reports Lighthouse-style DOM size metrics counted over element nodes
+func (a *Analyzer) measureDOM(doc *html.Node) *DOMMetrics {
+	metrics := &DOMMetrics{}
+
+	var walk func(n *html.Node, depth int)
+	walk = func(n *html.Node, depth int) {
+		children := 0
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			children++
+			metrics.NodeCount++
+			if depth+1 > metrics.MaxDepth {
+				metrics.MaxDepth = depth + 1
+			}
+			walk(c, depth+1)
+		}
+		if children > metrics.MaxChildren {
+			metrics.MaxChildren = children
+			metrics.MaxChildrenElement = n.Data
+		}
+	}
+	walk(doc, 0)
+
+	metrics.Findings = domFindings(metrics)
+	return metrics
+}
+
+// domFindings flags DOM sizes above the Lighthouse warning thresholds
+func domFindings(metrics *DOMMetrics) []Finding {
+	var findings []Finding
+
+	switch {
+	case metrics.NodeCount > DOMNodeErrorThreshold:
+		findings = append(findings, Finding{
+			Severity: SeverityHigh,
+			Subject:  "node_count",
+			Message:  fmt.Sprintf("DOM has %d elements; more than %d slows rendering and increases memory use", metrics.NodeCount, DOMNodeErrorThreshold),
+		})
+	case metrics.NodeCount > DOMNodeWarningThreshold:
+		findings = append(findings, Finding{
+			Severity: SeverityMedium,
+			Subject:  "node_count",
+			Message:  fmt.Sprintf("DOM has %d elements; aim for fewer than %d", metrics.NodeCount, DOMNodeWarningThreshold),
+		})
+	}
+
+	if metrics.MaxDepth > DOMDepthThreshold {
+		findings = append(findings, Finding{
+			Severity: SeverityMedium,
+			Subject:  "max_depth",
+			Message:  fmt.Sprintf("DOM is nested %d levels deep; aim for at most %d", metrics.MaxDepth, DOMDepthThreshold),
+		})
+	}
+
+	if metrics.MaxChildren > DOMChildrenThreshold {
+		findings = append(findings, Finding{
+			Severity: SeverityMedium,
+			Subject:  "max_children",
+			Message:  fmt.Sprintf("<%s> has %d child elements; aim for at most %d", metrics.MaxChildrenElement, metrics.MaxChildren, DOMChildrenThreshold),
+		})
+	}
+
+	return findings
+}
@@ -0,0 +1,201 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// RDAPEndpoint is the RDAP bootstrap service that redirects to the authoritative registry
+const RDAPEndpoint = "https://rdap.org/domain/"
+
+// RDAPClient looks up domain registration data over RDAP and caches the results
+// of up to MaxRDAPCacheEntries domains
+type RDAPClient struct {
+	endpoint   string
+	httpClient *http.Client
+	cacheTTL   time.Duration
+
+	mu    sync.Mutex
+	cache map[string]rdapCacheEntry
+}
+
+// rdapCacheEntry holds a cached registration lookup
+type rdapCacheEntry struct {
+	info      *DomainInfo
+	expiresAt time.Time
+}
+
+// NewRDAPClient creates an RDAP client using the given bootstrap endpoint
+func NewRDAPClient(endpoint string) *RDAPClient {
+	return &RDAPClient{
+		endpoint:   endpoint,
+		httpClient: &http.Client{Timeout: RDAPLookupTimeout},
+		cacheTTL:   RDAPCacheTTL,
+		cache:      make(map[string]rdapCacheEntry),
+	}
+}
+
+// rdapDomain is the subset of an RDAP domain response used by the analyzer
+type rdapDomain struct {
+	LDHName string   `json:"ldhName"`
+	Status  []string `json:"status"`
+	Events  []struct {
+		Action string `json:"eventAction"`
+		Date   string `json:"eventDate"`
+	} `json:"events"`
+	Entities []struct {
+		Roles      []string        `json:"roles"`
+		VCardArray json.RawMessage `json:"vcardArray"`
+	} `json:"entities"`
+	Nameservers []struct {
+		LDHName string `json:"ldhName"`
+	} `json:"nameservers"`
+}
+
+// Lookup returns registration details for the registrable domain of host.
+// It returns nil for IP addresses and hosts without a registrable domain.
+func (c *RDAPClient) Lookup(ctx context.Context, host string) *DomainInfo {
+	if net.ParseIP(host) != nil {
+		return nil
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(strings.ToLower(strings.TrimSuffix(host, ".")))
+	if err != nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	entry, ok := c.cache[domain]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.info
+	}
+
+	info, err := c.fetch(ctx, domain)
+	if err != nil {
+		// Failed lookups are reported but not cached so they are retried next time
+		return &DomainInfo{Domain: domain, Error: err.Error()}
+	}
+
+	c.mu.Lock()
+	c.store(domain, info)
+	c.mu.Unlock()
+
+	return info
+}
+
+// store caches the lookup of domain, first dropping expired entries and then
+// the entry expiring soonest when the cache is full; the caller must hold the lock
+func (c *RDAPClient) store(domain string, info *DomainInfo) {
+	if _, ok := c.cache[domain]; !ok && len(c.cache) >= MaxRDAPCacheEntries {
+		now := time.Now()
+		var oldest string
+		for candidate, entry := range c.cache {
+			if now.After(entry.expiresAt) {
+				delete(c.cache, candidate)
+			} else if oldest == "" || entry.expiresAt.Before(c.cache[oldest].expiresAt) {
+				oldest = candidate
+			}
+		}
+		if len(c.cache) >= MaxRDAPCacheEntries {
+			delete(c.cache, oldest)
+		}
+	}
+	c.cache[domain] = rdapCacheEntry{info: info, expiresAt: time.Now().Add(c.cacheTTL)}
+}
+
+// fetch performs the RDAP request for a registrable domain
+func (c *RDAPClient) fetch(ctx context.Context, domain string) (*DomainInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.endpoint+domain, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/rdap+json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("RDAP lookup failed: HTTP %d", resp.StatusCode)
+	}
+
+	var data rdapDomain
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	return parseRDAPDomain(domain, &data, time.Now()), nil
+}
+
+// parseRDAPDomain converts an RDAP response into domain registration details
+func parseRDAPDomain(domain string, data *rdapDomain, now time.Time) *DomainInfo {
+	info := &DomainInfo{
+		Domain: domain,
+		Status: data.Status,
+	}
+
+	for _, event := range data.Events {
+		date, err := time.Parse(time.RFC3339, event.Date)
+		if err != nil {
+			continue
+		}
+		date = date.UTC()
+		switch event.Action {
+		case "registration":
+			info.CreatedAt = &date
+			info.AgeDays = int(now.Sub(date).Hours() / 24)
+		case "expiration":
+			info.ExpiresAt = &date
+			info.DaysUntilExpiry = int(date.Sub(now).Hours() / 24)
+		case "last changed":
+			info.UpdatedAt = &date
+		}
+	}
+
+	for _, entity := range data.Entities {
+		for _, role := range entity.Roles {
+			if role == "registrar" {
+				info.Registrar = vcardFullName(entity.VCardArray)
+			}
+		}
+	}
+
+	for _, ns := range data.Nameservers {
+		info.Nameservers = append(info.Nameservers, strings.ToLower(ns.LDHName))
+	}
+
+	return info
+}
+
+// vcardFullName extracts the "fn" property from a jCard array
+func vcardFullName(raw json.RawMessage) string {
+	var card []json.RawMessage
+	if err := json.Unmarshal(raw, &card); err != nil || len(card) < 2 {
+		return ""
+	}
+
+	var properties [][]json.RawMessage
+	if err := json.Unmarshal(card[1], &properties); err != nil {
+		return ""
+	}
+	for _, property := range properties {
+		if len(property) < 4 {
+			continue
+		}
+		var name, value string
+		if json.Unmarshal(property[0], &name) == nil && name == "fn" && json.Unmarshal(property[3], &value) == nil {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,319 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Dry run check names
+const (
+	CheckCircuitBreaker = "circuit_breaker"
+	CheckDNS            = "dns"
+	CheckNetworkPolicy  = "network_policy"
+	CheckThrottle       = "throttle"
+	CheckThreatLists    = "threat_lists"
+	CheckRobotsTxt      = "robots_txt"
+)
+
+// Dry run check outcomes; only a failed check stops the analysis
+const (
+	CheckPass = "pass"
+	CheckWarn = "warn"
+	CheckFail = "fail"
+)
+
+// DryRunCheck is the outcome of one check an analysis would pass through
+type DryRunCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// DryRunCost estimates the outbound requests an analysis would make. Link
+// checks depend on the page, so they are flagged rather than counted.
+type DryRunCost struct {
+	// Requests are known before the page is read: the fetch and the requested probes
+	Requests int `json:"requests"`
+	// LinkChecks adds one request per external link and short link on the page,
+	// and per image with CheckImages
+	LinkChecks bool `json:"link_checks"`
+	// MaxRequests is the outbound budget capping the total; zero is unlimited
+	MaxRequests int `json:"max_requests,omitempty"`
+}
+
+// DryRunResult reports what analyzing a URL would do, without fetching it
+type DryRunResult struct {
+	URL           string         `json:"url"`
+	NormalizedURL string         `json:"normalized_url,omitempty"`
+	HostUnicode   string         `json:"host_unicode,omitempty"`
+	HostASCII     string         `json:"host_ascii,omitempty"`
+	Allowed       bool           `json:"allowed"`
+	WouldHitCache bool           `json:"would_hit_cache"`
+	CachedAt      *time.Time     `json:"cached_at,omitempty"`
+	WouldCoalesce bool           `json:"would_coalesce,omitempty"`
+	Checks        []DryRunCheck  `json:"checks,omitempty"`
+	EstimatedCost DryRunCost     `json:"estimated_cost"`
+	Error         *AnalysisError `json:"error,omitempty"`
+}
+
+// DryRunReport is the dry run of a batch of URLs with its totals
+type DryRunReport struct {
+	Results           []*DryRunResult `json:"results"`
+	Allowed           int             `json:"allowed"`
+	Blocked           int             `json:"blocked"`
+	CacheHits         int             `json:"cache_hits"`
+	EstimatedRequests int             `json:"estimated_requests"`
+	LinkChecks        int             `json:"link_checks"` // analyses that would also check their links
+}
+
+// DryRunAll dry-runs every URL with opts, DryRunConcurrency at a time. URLs
+// on the same site share one DNS lookup and robots.txt fetch.
+func (a *Analyzer) DryRunAll(ctx context.Context, targetURLs []string, opts AnalysisOptions) *DryRunReport {
+	report := &DryRunReport{Results: make([]*DryRunResult, len(targetURLs))}
+	sites := newDryRunSites()
+
+	semaphore := make(chan struct{}, DryRunConcurrency)
+	var wg sync.WaitGroup
+	for i, targetURL := range targetURLs {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, targetURL string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			report.Results[i] = a.dryRun(ctx, targetURL, opts, sites)
+		}(i, targetURL)
+	}
+	wg.Wait()
+
+	for _, result := range report.Results {
+		if !result.Allowed {
+			report.Blocked++
+			continue
+		}
+		report.Allowed++
+		if result.WouldHitCache {
+			report.CacheHits++
+		}
+		report.EstimatedRequests += result.EstimatedCost.Requests
+		if result.EstimatedCost.LinkChecks {
+			report.LinkChecks++
+		}
+	}
+	return report
+}
+
+// DryRun reports what analyzing targetURL with opts would do: whether the URL
+// is valid and allowed, whether the cache or an analysis in progress would
+// answer it, and the requests it would cost. Only DNS and robots.txt are
+// consulted; the page itself is never fetched.
+func (a *Analyzer) DryRun(ctx context.Context, targetURL string, opts AnalysisOptions) *DryRunResult {
+	return a.dryRun(ctx, targetURL, opts, newDryRunSites())
+}
+
+// dryRun follows the path of analyzeURL and runAnalysis up to the fetch
+func (a *Analyzer) dryRun(ctx context.Context, targetURL string, opts AnalysisOptions, sites *dryRunSites) *DryRunResult {
+	result := &DryRunResult{URL: targetURL}
+
+	parsedURL, err := a.normalizeURL(targetURL)
+	if err != nil {
+		result.Error = NewAnalysisError(ErrCodeInvalidURL, "Invalid URL format").WithDetails(err.Error())
+		return result
+	}
+	result.NormalizedURL = CanonicalizeURL(parsedURL, a.stripTrackingParams)
+	result.HostASCII = parsedURL.Hostname()
+	result.HostUnicode = HostToUnicode(result.HostASCII)
+	cacheKey := a.cacheKeyFor(parsedURL, opts)
+
+	// A cached result or an analysis in progress answers before any check runs
+	if !opts.BypassCache {
+		if cached, found := a.cacheManager.Get(cacheKey); found {
+			fetchedAt := cached.FetchedAt
+			result.Allowed = true
+			result.WouldHitCache = true
+			result.CachedAt = &fetchedAt
+			return result
+		}
+	}
+	if a.inflight.pending(cacheKey) {
+		result.Allowed = true
+		result.WouldCoalesce = true
+		return result
+	}
+
+	if retryAfter := a.circuitBreaker.RetryAfter(); retryAfter > 0 {
+		result.addCheck(CheckCircuitBreaker, CheckFail, fmt.Sprintf("circuit breaker is open; analyses resume in %s", retryAfter.Round(time.Second)))
+	} else {
+		result.addCheck(CheckCircuitBreaker, CheckPass, "")
+	}
+
+	site := sites.lookup(ctx, a, parsedURL)
+	switch {
+	case site.dnsErr != nil:
+		result.addCheck(CheckDNS, CheckFail, site.dnsErr.Error())
+	default:
+		result.addCheck(CheckDNS, CheckPass, strings.Join(site.addresses, ", "))
+	}
+	switch {
+	case !a.blockPrivateNetworks.Load():
+		result.addCheck(CheckNetworkPolicy, CheckPass, "private networks are not blocked")
+	case site.blockedAddress != "":
+		result.addCheck(CheckNetworkPolicy, CheckFail, fmt.Sprintf("%s: %s", errBlockedByPolicy, site.blockedAddress))
+	case site.dnsErr == nil:
+		result.addCheck(CheckNetworkPolicy, CheckPass, "")
+	}
+
+	if until := a.throttle.cooldown(parsedURL.Hostname()); time.Now().Before(until) {
+		result.addCheck(CheckThrottle, CheckWarn, fmt.Sprintf("host asked to slow down; requests are held until %s", until.UTC().Format(time.RFC3339)))
+	}
+
+	if len(a.threatCheckers) > 0 {
+		var flagged, failures []string
+		for _, checker := range a.threatCheckers {
+			matches, err := checker.CheckURLs(ctx, []string{parsedURL.String()})
+			if err != nil {
+				failures = append(failures, err.Error())
+				continue
+			}
+			for _, match := range matches {
+				flagged = append(flagged, match.Source+": "+match.Threat)
+			}
+		}
+		switch {
+		case len(flagged) > 0:
+			result.addCheck(CheckThreatLists, CheckWarn, "flagged by "+strings.Join(flagged, ", "))
+		case len(failures) > 0:
+			result.addCheck(CheckThreatLists, CheckWarn, "threat check failed: "+strings.Join(failures, "; "))
+		default:
+			result.addCheck(CheckThreatLists, CheckPass, "")
+		}
+	}
+
+	// Only a site opting out of the named bot stops the analysis; a page
+	// disallowed for RobotsUserAgent is a warning
+	id := a.BotIdentity()
+	switch {
+	case site.robotsErr != nil:
+		result.addCheck(CheckRobotsTxt, CheckWarn, "robots.txt could not be read: "+site.robotsErr.Error())
+	case site.robots != nil:
+		if rule, optedOut := botOptOut(site.robots, id.robotsToken(), robotsPath(parsedURL)); id.Name != "" && optedOut {
+			result.addCheck(CheckRobotsTxt, CheckFail, fmt.Sprintf("robots.txt opts %s out of the page (%s)", id.Name, rule))
+		} else if allowed, rule := site.robots.allowed(RobotsUserAgent, robotsPath(parsedURL)); !allowed {
+			result.addCheck(CheckRobotsTxt, CheckWarn, fmt.Sprintf("%s disallows the page (%s)", RobotsUserAgent, rule))
+		} else {
+			result.addCheck(CheckRobotsTxt, CheckPass, rule)
+		}
+	case site.robotsStatus >= 500:
+		result.addCheck(CheckRobotsTxt, CheckWarn, fmt.Sprintf("robots.txt returned HTTP %d, which crawlers treat as disallowing the site", site.robotsStatus))
+	case site.robotsStatus != 0:
+		result.addCheck(CheckRobotsTxt, CheckPass, fmt.Sprintf("no robots.txt (HTTP %d)", site.robotsStatus))
+	}
+
+	result.Allowed = true
+	for _, check := range result.Checks {
+		if check.Status == CheckFail {
+			result.Allowed = false
+		}
+	}
+	if result.Allowed {
+		result.EstimatedCost = a.estimateCost(parsedURL, opts)
+	}
+	return result
+}
+
+// addCheck records the outcome of a check
+func (r *DryRunResult) addCheck(name, status, detail string) {
+	r.Checks = append(r.Checks, DryRunCheck{Name: name, Status: status, Detail: detail})
+}
+
+// estimateCost counts the requests runAnalysis would make before reading the page
+func (a *Analyzer) estimateCost(parsedURL *url.URL, opts AnalysisOptions) DryRunCost {
+	cost := DryRunCost{Requests: 1, MaxRequests: a.maxOutboundRequests}
+	if a.BotIdentity().Name != "" {
+		// robots.txt for the opt-out check, unless read recently
+		cost.Requests++
+	}
+	if opts.CompareVariants {
+		cost.Requests += len(buildVariantURLs(parsedURL))
+	}
+	if opts.LookupDomain {
+		cost.Requests++
+	}
+	if opts.QuickCheck {
+		return cost
+	}
+	if opts.CheckRobots {
+		// robots.txt and at least one sitemap
+		cost.Requests += 2
+	}
+	cost.LinkChecks = !opts.SkipLinkCheck || opts.CheckImages
+	return cost
+}
+
+// dryRunSite is what a dry run learns about a site, shared by its URLs
+type dryRunSite struct {
+	once sync.Once
+
+	addresses      []string
+	dnsErr         error
+	blockedAddress string // a resolved address the network policy refuses
+
+	robots       *robotsTxt
+	robotsStatus int
+	robotsErr    error
+}
+
+// dryRunSites looks up each scheme and host once per dry run
+type dryRunSites struct {
+	mu    sync.Mutex
+	sites map[string]*dryRunSite
+}
+
+// newDryRunSites creates an empty site table
+func newDryRunSites() *dryRunSites {
+	return &dryRunSites{sites: make(map[string]*dryRunSite)}
+}
+
+// lookup resolves the site of parsedURL and reads its robots.txt, unless the
+// network policy would refuse the connection
+func (s *dryRunSites) lookup(ctx context.Context, a *Analyzer, parsedURL *url.URL) *dryRunSite {
+	key := parsedURL.Scheme + "://" + parsedURL.Host
+	s.mu.Lock()
+	site, ok := s.sites[key]
+	if !ok {
+		site = &dryRunSite{}
+		s.sites[key] = site
+	}
+	s.mu.Unlock()
+
+	site.once.Do(func() {
+		lookupCtx, cancel := context.WithTimeout(ctx, DryRunDNSTimeout)
+		defer cancel()
+		addrs, err := net.DefaultResolver.LookupIPAddr(lookupCtx, parsedURL.Hostname())
+		if err != nil {
+			site.dnsErr = err
+			return
+		}
+		for _, addr := range addrs {
+			site.addresses = append(site.addresses, addr.IP.String())
+			if site.blockedAddress == "" && a.blockPrivateNetworks.Load() && isPrivateIP(addr.IP) {
+				site.blockedAddress = addr.IP.String()
+			}
+		}
+		if site.blockedAddress != "" {
+			return
+		}
+
+		robotsURL := &url.URL{Scheme: parsedURL.Scheme, Host: parsedURL.Host, Path: "/robots.txt"}
+		content, status, err := a.fetchRobotsResource(ctx, robotsURL.String(), RobotsTxtBodyLimit)
+		site.robotsStatus, site.robotsErr = status, err
+		if err == nil && status >= 200 && status < 300 {
+			site.robots = parseRobotsTxt(string(content))
+		}
+	})
+	return site
+}
@@ -0,0 +1,127 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// contentFingerprint returns the SimHash of text as a hexadecimal string.
+// Near-duplicate texts produce fingerprints with a small Hamming distance.
+func contentFingerprint(text string) string {
+	words := strings.Fields(strings.ToLower(text))
+	if len(words) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%016x", simHash(words))
+}
+
+// simHash computes a 64-bit SimHash over overlapping word shingles
+func simHash(words []string) uint64 {
+	var weights [64]int
+
+	shingles := len(words) - FingerprintShingleSize + 1
+	if shingles < 1 {
+		shingles = 1
+	}
+	for i := 0; i < shingles; i++ {
+		end := i + FingerprintShingleSize
+		if end > len(words) {
+			end = len(words)
+		}
+
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:end], " ")))
+		sum := h.Sum64()
+
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<uint(bit)) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	var fingerprint uint64
+	for bit := 0; bit < 64; bit++ {
+		if weights[bit] > 0 {
+			fingerprint |= 1 << uint(bit)
+		}
+	}
+	return fingerprint
+}
+
+// FingerprintDistance returns the Hamming distance between two content fingerprints
+func FingerprintDistance(a, b string) (int, error) {
+	x, err := strconv.ParseUint(a, 16, 64)
+	if err != nil {
+		return 0, err
+	}
+	y, err := strconv.ParseUint(b, 16, 64)
+	if err != nil {
+		return 0, err
+	}
+	return bits.OnesCount64(x ^ y), nil
+}
+
+// FindDuplicates analyzes each URL and reports pairs of pages whose content
+// fingerprints differ by at most threshold bits
+func (a *Analyzer) FindDuplicates(ctx context.Context, urls []string, threshold int) *DuplicateReport {
+	return a.FindDuplicatesStreaming(ctx, urls, threshold, nil)
+}
+
+// FindDuplicatesStreaming is FindDuplicates calling each, when set, with every
+// analysis as soon as it completes; calls are made one at a time
+func (a *Analyzer) FindDuplicatesStreaming(ctx context.Context, urls []string, threshold int, each func(*AnalysisResult)) *DuplicateReport {
+	emit := serialize(each)
+	report := &DuplicateReport{
+		Threshold: threshold,
+		Pages:     make([]PageFingerprint, len(urls)),
+	}
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, MinWorkers)
+	for i, target := range urls {
+		wg.Add(1)
+		go func(i int, target string) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			result := a.AnalyzeURLWithOptions(ctx, target, AnalysisOptions{SkipLinkCheck: true, Priority: PriorityBatch})
+			emit(result)
+			page := PageFingerprint{URL: target, Fingerprint: result.ContentFingerprint}
+			if result.Error != nil {
+				page.Error = result.Error.Message
+			}
+			report.Pages[i] = page
+		}(i, target)
+	}
+	wg.Wait()
+
+	for i := 0; i < len(report.Pages); i++ {
+		for j := i + 1; j < len(report.Pages); j++ {
+			first, second := report.Pages[i], report.Pages[j]
+			if first.Fingerprint == "" || second.Fingerprint == "" {
+				continue
+			}
+			distance, err := FingerprintDistance(first.Fingerprint, second.Fingerprint)
+			if err != nil || distance > threshold {
+				continue
+			}
+			report.Duplicates = append(report.Duplicates, DuplicatePair{
+				URLA:       first.URL,
+				URLB:       second.URL,
+				Distance:   distance,
+				Similarity: 1 - float64(distance)/64,
+			})
+		}
+	}
+
+	return report
+}
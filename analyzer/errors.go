@@ -1,7 +1,17 @@
 package analyzer
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 )
 
@@ -14,8 +24,35 @@ const (
 	ErrCodeTimeoutError    = "TIMEOUT_ERROR"
 	ErrCodeValidationError = "VALIDATION_ERROR"
 	ErrCodeInternalError   = "INTERNAL_ERROR"
+	ErrCodeMaintenance     = "MAINTENANCE"
+	ErrCodeDNSError        = "DNS_ERROR"
+	ErrCodeTLSError        = "TLS_ERROR"
+	ErrCodeConnRefused     = "CONNECTION_REFUSED"
+	ErrCodeConnReset       = "CONNECTION_RESET"
+	ErrCodeContentTooLarge = "CONTENT_TOO_LARGE"
+	ErrCodeBlockedByPolicy = "BLOCKED_BY_POLICY"
+	ErrCodeOptedOut        = "OPTED_OUT"
+	ErrCodeNotArchived     = "NOT_ARCHIVED"
+	ErrCodeArchiveError    = "ARCHIVE_ERROR"
+	ErrCodeCircuitOpen     = "CIRCUIT_OPEN"
+	ErrCodeRateLimited     = "RATE_LIMITED"
 )
 
+// Sentinel errors raised while fetching the target page
+var (
+	errBlockedByPolicy = errors.New("destination blocked by network policy")
+	errOptedOut        = errors.New("site opted out of this bot in robots.txt")
+)
+
+// contentTooLargeError reports a page whose body exceeds the analyzer's size limit
+type contentTooLargeError struct {
+	limit int64
+}
+
+func (e *contentTooLargeError) Error() string {
+	return fmt.Sprintf("response body exceeds %d byte limit", e.limit)
+}
+
 // AnalysisError represents a structured error with additional context
 type AnalysisError struct {
 	Code       string    `json:"code"`
@@ -24,7 +61,11 @@ type AnalysisError struct {
 	URL        string    `json:"url,omitempty"`
 	Timestamp  time.Time `json:"timestamp"`
 	StatusCode int       `json:"status_code,omitempty"`
-	Cause      error     `json:"-"`
+	// RetryAfterSeconds tells clients how long to wait before retrying, when known
+	RetryAfterSeconds int `json:"retry_after_seconds,omitempty"`
+	// Suggestion is a human-readable remediation hint
+	Suggestion string `json:"suggestion,omitempty"`
+	Cause      error  `json:"-"`
 }
 
 // Error implements the error interface
@@ -73,6 +114,18 @@ func (e *AnalysisError) WithCause(cause error) *AnalysisError {
 	return e
 }
 
+// WithRetryAfter adds the number of seconds a client should wait before retrying
+func (e *AnalysisError) WithRetryAfter(seconds int) *AnalysisError {
+	e.RetryAfterSeconds = seconds
+	return e
+}
+
+// WithSuggestion adds a human-readable remediation hint
+func (e *AnalysisError) WithSuggestion(suggestion string) *AnalysisError {
+	e.Suggestion = suggestion
+	return e
+}
+
 // IsAnalysisError checks if an error is an AnalysisError
 func IsAnalysisError(err error) bool {
 	_, ok := err.(*AnalysisError)
@@ -112,11 +165,153 @@ func NewParseError(url string, cause error) *AnalysisError {
 		WithCause(cause)
 }
 
+func NewMaintenanceError(url string, info *MaintenanceInfo) *AnalysisError {
+	err := NewAnalysisError(ErrCodeMaintenance, "Site is under maintenance").
+		WithURL(url).
+		WithSuggestion("The site is showing a maintenance page; retry once maintenance is over")
+	if info != nil && info.RetryAfter != "" {
+		err.WithDetails("Retry-After: " + info.RetryAfter)
+		if seconds, ok := ParseRetryAfter(info.RetryAfter, time.Now()); ok {
+			err.WithRetryAfter(seconds)
+		}
+	}
+	return err
+}
+
 func NewTimeoutError(url string, timeout time.Duration) *AnalysisError {
 	return NewAnalysisError(ErrCodeTimeoutError, fmt.Sprintf("Request timed out after %v", timeout)).
 		WithURL(url)
 }
 
+func NewCircuitOpenError(retryAfter time.Duration) *AnalysisError {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	return NewAnalysisError(ErrCodeCircuitOpen, "Service temporarily unavailable").
+		WithRetryAfter(seconds).
+		WithSuggestion(fmt.Sprintf("The analyzer is pausing requests after repeated failures; retry in %d seconds", seconds))
+}
+
+func NewRateLimitedError(url string, statusCode int, retryAfter string) *AnalysisError {
+	err := NewAnalysisError(ErrCodeRateLimited, "Target site is rate limiting requests").
+		WithURL(url).
+		WithStatusCode(statusCode).
+		WithSuggestion("The target site rejected the request as too frequent; wait before analyzing it again")
+	if seconds, ok := ParseRetryAfter(retryAfter, time.Now()); ok {
+		err.WithRetryAfter(seconds)
+	}
+	return err
+}
+
+// ParseRetryAfter parses a Retry-After header value given either as delay seconds or
+// as an HTTP date, returning the number of seconds to wait
+func ParseRetryAfter(value string, now time.Time) (int, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return seconds, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		seconds := int(math.Ceil(date.Sub(now).Seconds()))
+		if seconds < 0 {
+			seconds = 0
+		}
+		return seconds, true
+	}
+	return 0, false
+}
+
+// ClassifyFetchError maps a low-level fetch failure to a structured AnalysisError
+func ClassifyFetchError(url string, err error) *AnalysisError {
+	if ae := GetAnalysisError(err); ae != nil {
+		return ae
+	}
+
+	var dnsErr *net.DNSError
+	var tooLargeErr *contentTooLargeError
+	var certInvalidErr x509.CertificateInvalidError
+	var hostnameErr x509.HostnameError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var certVerifyErr *tls.CertificateVerificationError
+	var recordHeaderErr tls.RecordHeaderError
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, errBlockedByPolicy):
+		return NewAnalysisError(ErrCodeBlockedByPolicy, "Destination is blocked by network policy").
+			WithURL(url).
+			WithCause(err)
+	case errors.Is(err, errOptedOut):
+		return NewAnalysisError(ErrCodeOptedOut, "Site has opted out of analysis by this bot").
+			WithURL(url).
+			WithDetails(err.Error()).
+			WithCause(err)
+	case errors.As(err, &tooLargeErr):
+		return NewAnalysisError(ErrCodeContentTooLarge, fmt.Sprintf("Response body exceeds %d bytes", tooLargeErr.limit)).
+			WithURL(url).
+			WithCause(err)
+	case errors.As(err, &dnsErr):
+		return NewAnalysisError(ErrCodeDNSError, "Failed to resolve host").
+			WithURL(url).
+			WithDetails(dnsErr.Error()).
+			WithCause(err)
+	case errors.As(err, &certInvalidErr), errors.As(err, &hostnameErr), errors.As(err, &unknownAuthorityErr),
+		errors.As(err, &certVerifyErr), errors.As(err, &recordHeaderErr), strings.Contains(err.Error(), "tls: "):
+		return NewAnalysisError(ErrCodeTLSError, "TLS handshake failed").
+			WithURL(url).
+			WithDetails(err.Error()).
+			WithCause(err)
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return NewAnalysisError(ErrCodeConnRefused, "Connection refused by target").
+			WithURL(url).
+			WithCause(err)
+	case errors.Is(err, syscall.ECONNRESET), strings.Contains(err.Error(), "connection reset"):
+		return NewAnalysisError(ErrCodeConnReset, "Connection reset by target").
+			WithURL(url).
+			WithCause(err)
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return NewAnalysisError(ErrCodeTimeoutError, "Request timed out").
+			WithURL(url).
+			WithSuggestion("The target did not respond within the time limit; retry later when the site is less busy").
+			WithCause(err)
+	case errors.As(err, &netErr):
+		return NewNetworkError(url, err).WithDetails(err.Error())
+	default:
+		return NewAnalysisError(ErrCodeInternalError, "Analysis failed").
+			WithURL(url).
+			WithCause(err)
+	}
+}
+
+// IsInfrastructureError reports whether a fetch error points at the analyzer's own
+// egress (resolver failures, unreachable networks, exhausted sockets, timeouts)
+// rather than at the user-supplied target
+func IsInfrastructureError(err error) bool {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var tooLargeErr *contentTooLargeError
+
+	switch {
+	case err == nil, errors.Is(err, context.Canceled):
+		return false
+	case errors.Is(err, errBlockedByPolicy), errors.Is(err, errOptedOut), errors.As(err, &tooLargeErr):
+		return false
+	case errors.As(err, &dnsErr):
+		// A name that does not exist is a bad URL; a failing resolver is ours
+		return !dnsErr.IsNotFound
+	case errors.Is(err, syscall.ENETUNREACH), errors.Is(err, syscall.EADDRNOTAVAIL),
+		errors.Is(err, syscall.EMFILE), errors.Is(err, syscall.ENFILE), errors.Is(err, syscall.ENOBUFS):
+		return true
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return true
+	default:
+		return false
+	}
+}
+
 // httpStatusText returns HTTP status text (simplified version)
 func httpStatusText(statusCode int) string {
 	switch statusCode {
@@ -0,0 +1,309 @@
+package analyzer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"web-page-analyzer/logger"
+)
+
+// Event types
+const (
+	EventAnalysisCompleted = "analysis.completed"
+	EventAnalysisFailed    = "analysis.failed"
+)
+
+// EventPublisher delivers completed analyses to a downstream pipeline
+type EventPublisher interface {
+	Publish(ctx context.Context, key string, payload []byte) error
+}
+
+// queuedEvent is an encoded event waiting for a publisher
+type queuedEvent struct {
+	url     string
+	key     string
+	payload []byte
+}
+
+// AddEventPublisher registers a publisher notified of every completed analysis.
+// Each publisher gets its own queue of up to MaxQueuedEvents events, delivered
+// one at a time, so a slow broker holds up neither responses nor other publishers.
+func (a *Analyzer) AddEventPublisher(publisher EventPublisher) {
+	queue := make(chan queuedEvent, MaxQueuedEvents)
+	a.eventQueues = append(a.eventQueues, queue)
+	go func() {
+		for event := range queue {
+			ctx, cancel := context.WithTimeout(context.Background(), EventPublishTimeout)
+			if err := publisher.Publish(ctx, event.key, event.payload); err != nil {
+				logger.WithAnalysis(event.url).Warnw("Failed to publish analysis event", "error", err)
+			}
+			cancel()
+		}
+	}()
+}
+
+// publishEvent queues a completed analysis for the registered publishers,
+// dropping it for those whose queue is full
+func (a *Analyzer) publishEvent(result *AnalysisResult) {
+	if len(a.eventQueues) == 0 {
+		return
+	}
+
+	event := AnalysisEvent{
+		Type:      EventAnalysisCompleted,
+		Timestamp: time.Now().UTC(),
+		Result:    result,
+	}
+	if result.Error != nil {
+		event.Type = EventAnalysisFailed
+	}
+
+	// Encode now, while the result is not yet shared with other readers
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logger.WithAnalysis(result.URL).Errorw("Failed to encode analysis event", "error", err)
+		return
+	}
+	key := result.NormalizedURL
+	if key == "" {
+		key = result.URL
+	}
+
+	for _, queue := range a.eventQueues {
+		select {
+		case queue <- queuedEvent{url: result.URL, key: key, payload: payload}:
+		default:
+			logger.WithAnalysis(result.URL).Warnw("Dropped analysis event: publisher queue is full", "queued", MaxQueuedEvents)
+		}
+	}
+}
+
+// NATSPublisher publishes events to a NATS subject using the core text protocol.
+// It keeps one connection open, dialing again after a failure, and confirms
+// each event with PING/PONG.
+type NATSPublisher struct {
+	address  string
+	subject  string
+	user     string
+	password string
+	token    string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewNATSPublisher creates a publisher for a nats://[user:password@]host:port URL
+func NewNATSPublisher(serverURL, subject string) (*NATSPublisher, error) {
+	parsed, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme != "nats" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid NATS URL %q: expected nats://host:port", serverURL)
+	}
+	if subject == "" || strings.ContainsAny(subject, " \t\r\n") {
+		return nil, fmt.Errorf("invalid NATS subject %q", subject)
+	}
+
+	publisher := &NATSPublisher{address: parsed.Host, subject: subject}
+	if _, _, err := net.SplitHostPort(parsed.Host); err != nil {
+		publisher.address = net.JoinHostPort(parsed.Host, "4222")
+	}
+	if parsed.User != nil {
+		if password, ok := parsed.User.Password(); ok {
+			publisher.user = parsed.User.Username()
+			publisher.password = password
+		} else {
+			publisher.token = parsed.User.Username()
+		}
+	}
+	return publisher, nil
+}
+
+// Publish sends the payload to the configured subject. An event that fails on
+// a connection kept from earlier events is sent once more on a new connection,
+// since the server may have closed the idle one.
+func (p *NATSPublisher) Publish(ctx context.Context, _ string, payload []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	reused := p.conn != nil
+	err := p.publish(ctx, payload)
+	if err != nil && reused && ctx.Err() == nil {
+		err = p.publish(ctx, payload)
+	}
+	return err
+}
+
+// Close closes the connection kept for publishing, if any
+func (p *NATSPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Close()
+	p.conn, p.reader = nil, nil
+	return err
+}
+
+// publish sends one event, connecting first when no connection is open. Any
+// failure closes the connection so that the next event dials again.
+func (p *NATSPublisher) publish(ctx context.Context, payload []byte) error {
+	if p.conn == nil {
+		if err := p.connect(ctx); err != nil {
+			return err
+		}
+	}
+
+	deadline, _ := ctx.Deadline()
+	p.conn.SetDeadline(deadline)
+	err := p.send(payload)
+	if err != nil {
+		p.conn.Close()
+		p.conn, p.reader = nil, nil
+	}
+	return err
+}
+
+// connect dials the server and sends CONNECT once it has greeted us with INFO
+func (p *NATSPublisher) connect(ctx context.Context) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", p.address)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	reader := bufio.NewReader(conn)
+	info, err := reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if !strings.HasPrefix(info, "INFO") {
+		conn.Close()
+		return fmt.Errorf("unexpected NATS greeting: %q", strings.TrimSpace(info))
+	}
+
+	options := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "web-page-analyzer",
+		"lang":     "go",
+	}
+	if p.user != "" {
+		options["user"] = p.user
+		options["pass"] = p.password
+	}
+	if p.token != "" {
+		options["auth_token"] = p.token
+	}
+	connect, err := json.Marshal(options)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\n", connect); err != nil {
+		conn.Close()
+		return err
+	}
+
+	p.conn, p.reader = conn, reader
+	return nil
+}
+
+// send publishes the payload and waits for the server to confirm it
+func (p *NATSPublisher) send(payload []byte) error {
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "PUB %s %d\r\n", p.subject, len(payload))
+	message.Write(payload)
+	message.WriteString("\r\nPING\r\n")
+	if _, err := p.conn.Write(message.Bytes()); err != nil {
+		return err
+	}
+
+	// The server answers PING only after processing everything before it; its
+	// own keep-alive PINGs, sent while the connection was idle, are answered too
+	for {
+		line, err := p.reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		switch line = strings.TrimSpace(line); {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := p.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("NATS error: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+// KafkaRESTPublisher publishes events to a Kafka topic through a Kafka REST Proxy (v2 API)
+type KafkaRESTPublisher struct {
+	endpoint   string
+	topic      string
+	httpClient *http.Client
+}
+
+// NewKafkaRESTPublisher creates a publisher posting to {proxyURL}/topics/{topic}
+func NewKafkaRESTPublisher(proxyURL, topic string) *KafkaRESTPublisher {
+	return &KafkaRESTPublisher{
+		endpoint:   strings.TrimSuffix(proxyURL, "/") + "/topics/" + url.PathEscape(topic),
+		topic:      topic,
+		httpClient: &http.Client{Timeout: EventPublishTimeout},
+	}
+}
+
+// kafkaRecords is the REST Proxy produce request body
+type kafkaRecords struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+// kafkaRecord is a single record keyed by the analyzed URL
+type kafkaRecord struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Publish produces the payload as a record keyed by the analyzed URL
+func (p *KafkaRESTPublisher) Publish(ctx context.Context, key string, payload []byte) error {
+	body, err := json.Marshal(kafkaRecords{Records: []kafkaRecord{{Key: key, Value: payload}}})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("kafka produce to %s failed: HTTP %d", p.topic, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// errKnownDeadHost reports a link check skipped because its host failed its
+// recent checks
+var errKnownDeadHost = errors.New("host failed its recent link checks")
+
+// HostReputation summarizes the recent link checks against a host, across analyses
+type HostReputation struct {
+	Host   string `json:"host"`
+	Checks int    `json:"checks"` // checks in the rolling window
+	// SuccessRate is the percentage of checks the host answered without a 5xx
+	SuccessRate     float64    `json:"success_rate"`
+	MedianLatencyMs int64      `json:"median_latency_ms,omitempty"` // of the successful checks
+	LastCheckedAt   time.Time  `json:"last_checked_at"`
+	LastSuccessAt   *time.Time `json:"last_success_at,omitempty"`
+	// Dead hosts have their links marked inaccessible without a request until
+	// ReputationRecheckAfter has passed since their last check
+	Dead bool `json:"dead"`
+	// TimeoutMs is the link check timeout applied to the host
+	TimeoutMs int64 `json:"timeout_ms"`
+}
+
+// reputationSample is the outcome of one link check
+type reputationSample struct {
+	OK        bool      `json:"ok"`
+	LatencyMs int64     `json:"latency_ms"`
+	At        time.Time `json:"at"`
+}
+
+// reputationTracker keeps a rolling window of link check outcomes per host,
+// optionally persisted to a JSON file so they survive restarts
+type reputationTracker struct {
+	mu      sync.Mutex
+	path    string
+	hosts   map[string][]reputationSample
+	dirty   bool
+	savedAt time.Time
+}
+
+func newReputationTracker() *reputationTracker {
+	return &reputationTracker{hosts: make(map[string][]reputationSample)}
+}
+
+// LoadHostReputation keeps host reputation in the JSON file at path, loading the
+// hosts recorded there; a missing file starts an empty table
+func (a *Analyzer) LoadHostReputation(path string) error {
+	tracker := newReputationTracker()
+	tracker.path = path
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tracker.hosts); err != nil {
+			return err
+		}
+		if tracker.hosts == nil {
+			tracker.hosts = make(map[string][]reputationSample)
+		}
+		for host, samples := range tracker.hosts {
+			if len(samples) == 0 {
+				delete(tracker.hosts, host)
+			}
+		}
+	}
+	a.reputation = tracker
+	return nil
+}
+
+// SaveHostReputation writes pending host reputation changes to the file given
+// to LoadHostReputation, if any
+func (a *Analyzer) SaveHostReputation() error {
+	return a.reputation.save(true)
+}
+
+// HostReputations returns the reputation of every tracked host, sorted by host
+func (a *Analyzer) HostReputations() []HostReputation {
+	t := a.reputation
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	reputations := make([]HostReputation, 0, len(t.hosts))
+	for host, samples := range t.hosts {
+		reputations = append(reputations, summarizeReputation(host, samples, now))
+	}
+	sort.Slice(reputations, func(i, j int) bool { return reputations[i].Host < reputations[j].Host })
+	return reputations
+}
+
+// record adds the outcome of a check against host, evicting the least recently
+// checked host when the table is full
+func (t *reputationTracker) record(host string, ok bool, latency time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	samples, known := t.hosts[host]
+	if !known && len(t.hosts) >= MaxReputationHosts {
+		var oldest string
+		var oldestAt time.Time
+		for candidate, s := range t.hosts {
+			if at := s[len(s)-1].At; oldest == "" || at.Before(oldestAt) {
+				oldest, oldestAt = candidate, at
+			}
+		}
+		delete(t.hosts, oldest)
+	}
+	samples = append(samples, reputationSample{OK: ok, LatencyMs: latency.Milliseconds(), At: time.Now().UTC()})
+	if len(samples) > ReputationWindow {
+		samples = append([]reputationSample(nil), samples[len(samples)-ReputationWindow:]...)
+	}
+	t.hosts[host] = samples
+	t.dirty = true
+}
+
+// dead reports whether links to host should be marked inaccessible without a check
+func (t *reputationTracker) dead(host string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return hostDead(t.hosts[host], time.Now())
+}
+
+// timeout returns the link check timeout for host: a multiple of its median
+// latency once enough checks succeeded, LinkCheckTimeout until then
+func (t *reputationTracker) timeout(host string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return hostTimeout(t.hosts[host])
+}
+
+// save writes the table to its file when it changed, at most once per
+// ReputationSaveInterval unless force is set
+func (t *reputationTracker) save(force bool) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.path == "" || !t.dirty || (!force && time.Since(t.savedAt) < ReputationSaveInterval) {
+		return nil
+	}
+	data, err := json.Marshal(t.hosts)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated table
+	tmp := t.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, t.path); err != nil {
+		return err
+	}
+	t.dirty = false
+	t.savedAt = time.Now()
+	return nil
+}
+
+// hostDead reports whether the last ReputationDeadChecks checks all failed and
+// the host is not yet due for another check
+func hostDead(samples []reputationSample, now time.Time) bool {
+	if len(samples) < ReputationDeadChecks {
+		return false
+	}
+	for _, sample := range samples[len(samples)-ReputationDeadChecks:] {
+		if sample.OK {
+			return false
+		}
+	}
+	return now.Sub(samples[len(samples)-1].At) < ReputationRecheckAfter
+}
+
+// hostTimeout scales the median latency of the successful checks, bounded by
+// ReputationMinTimeout and ReputationMaxTimeout
+func hostTimeout(samples []reputationSample) time.Duration {
+	median, successes := medianLatency(samples)
+	if successes < ReputationMinSamples {
+		return LinkCheckTimeout
+	}
+	timeout := median * ReputationTimeoutScale
+	if timeout < ReputationMinTimeout {
+		return ReputationMinTimeout
+	}
+	if timeout > ReputationMaxTimeout {
+		return ReputationMaxTimeout
+	}
+	return timeout
+}
+
+// medianLatency returns the median latency of the successful checks and their count
+func medianLatency(samples []reputationSample) (time.Duration, int) {
+	var latencies []int64
+	for _, sample := range samples {
+		if sample.OK {
+			latencies = append(latencies, sample.LatencyMs)
+		}
+	}
+	if len(latencies) == 0 {
+		return 0, 0
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return time.Duration(latencies[len(latencies)/2]) * time.Millisecond, len(latencies)
+}
+
+// summarizeReputation reports a host's checks as of now
+func summarizeReputation(host string, samples []reputationSample, now time.Time) HostReputation {
+	reputation := HostReputation{
+		Host:          host,
+		Checks:        len(samples),
+		LastCheckedAt: samples[len(samples)-1].At,
+		Dead:          hostDead(samples, now),
+		TimeoutMs:     hostTimeout(samples).Milliseconds(),
+	}
+	successes := 0
+	for _, sample := range samples {
+		if sample.OK {
+			successes++
+			at := sample.At
+			reputation.LastSuccessAt = &at
+		}
+	}
+	reputation.SuccessRate = math.Round(float64(successes)/float64(len(samples))*1000) / 10
+	if median, n := medianLatency(samples); n > 0 {
+		reputation.MedianLatencyMs = median.Milliseconds()
+	}
+	return reputation
+}
@@ -0,0 +1,195 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+)
+
+// Hreflang issue types
+const (
+	HreflangMissingSelfReference = "missing_self_reference"
+	HreflangMissingReturnLink    = "missing_return_link"
+	HreflangLanguageMismatch     = "language_mismatch"
+)
+
+// extractHreflang returns the language alternates declared with
+// <link rel="alternate" hreflang="..." href="...">, resolved against baseURL
+func (a *Analyzer) extractHreflang(doc *html.Node, baseURL *url.URL) []HreflangLink {
+	var alternates []HreflangLink
+	traverser := NewHTMLTraverser()
+	traverser.TraverseElements(doc, "link", func(node *html.Node) {
+		lang := strings.TrimSpace(traverser.GetAttributeValue(node, "hreflang"))
+		href := strings.TrimSpace(traverser.GetAttributeValue(node, "href"))
+		if lang == "" || href == "" {
+			return
+		}
+		rels := strings.Fields(strings.ToLower(traverser.GetAttributeValue(node, "rel")))
+		isAlternate := false
+		for _, rel := range rels {
+			isAlternate = isAlternate || rel == "alternate"
+		}
+		if !isAlternate {
+			return
+		}
+		target, err := baseURL.Parse(href)
+		if err != nil {
+			return
+		}
+		alternates = append(alternates, HreflangLink{Lang: strings.ToLower(lang), URL: target.String()})
+	})
+	return alternates
+}
+
+// CheckHreflang analyzes each URL and checks the hreflang annotations of the set
+// for reciprocity with CheckHreflangReciprocity
+func (a *Analyzer) CheckHreflang(ctx context.Context, urls []string) *HreflangReport {
+	return a.CheckHreflangStreaming(ctx, urls, nil)
+}
+
+// CheckHreflangStreaming is CheckHreflang calling each, when set, with every
+// analysis as soon as it completes; calls are made one at a time
+func (a *Analyzer) CheckHreflangStreaming(ctx context.Context, urls []string, each func(*AnalysisResult)) *HreflangReport {
+	emit := serialize(each)
+	pages := make([]HreflangPage, len(urls))
+	failed := make([]bool, len(urls))
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, MinWorkers)
+	for i, target := range urls {
+		wg.Add(1)
+		go func(i int, target string) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			result := a.AnalyzeURLWithOptions(ctx, target, AnalysisOptions{SkipLinkCheck: true, Priority: PriorityBatch})
+			emit(result)
+			failed[i] = result.Error != nil
+			pages[i] = HreflangPage{URL: target, FinalURL: result.FinalURL, Alternates: result.Hreflang}
+		}(i, target)
+	}
+	wg.Wait()
+
+	// Pages that could not be analyzed are left out, so links to them count as unverified
+	var analyzed []HreflangPage
+	var failedURLs []string
+	for i, page := range pages {
+		if failed[i] {
+			failedURLs = append(failedURLs, page.URL)
+			continue
+		}
+		analyzed = append(analyzed, page)
+	}
+	report := CheckHreflangReciprocity(analyzed)
+	report.Failed = failedURLs
+	return report
+}
+
+// CheckHreflangReciprocity verifies that every page declaring hreflang alternates
+// references itself, and that every alternate within the set links back to the
+// page with the language the alternate declares for itself. Alternates outside
+// the set cannot be verified and are only counted.
+func CheckHreflangReciprocity(pages []HreflangPage) *HreflangReport {
+	report := &HreflangReport{Pages: len(pages)}
+
+	// Pages are found under the URL they were requested with and the one they were served from
+	index := make(map[string]int, len(pages))
+	for i, page := range pages {
+		index[sitemapKey(page.URL)] = i
+		if page.FinalURL != "" {
+			index[sitemapKey(page.FinalURL)] = i
+		}
+	}
+	pageOf := func(link string) (int, bool) {
+		i, ok := index[sitemapKey(link)]
+		return i, ok
+	}
+	// selfLang returns the language a page declares for itself, if any
+	selfLang := func(i int) (string, bool) {
+		for _, alternate := range pages[i].Alternates {
+			if j, ok := pageOf(alternate.URL); ok && j == i {
+				return alternate.Lang, true
+			}
+		}
+		return "", false
+	}
+
+	for i, page := range pages {
+		if len(page.Alternates) == 0 {
+			continue
+		}
+		report.Annotated++
+		pageURL := page.URL
+		if page.FinalURL != "" {
+			pageURL = page.FinalURL
+		}
+
+		if _, ok := selfLang(i); !ok {
+			report.Issues = append(report.Issues, HreflangIssue{
+				Type:    HreflangMissingSelfReference,
+				URL:     pageURL,
+				Message: "Page declares hreflang alternates but none for itself",
+			})
+		}
+
+		for _, alternate := range page.Alternates {
+			j, ok := pageOf(alternate.URL)
+			if !ok {
+				report.Unverified++
+				continue
+			}
+			if j == i {
+				continue
+			}
+
+			linksBack := false
+			for _, back := range pages[j].Alternates {
+				if k, ok := pageOf(back.URL); ok && k == i {
+					linksBack = true
+					break
+				}
+			}
+			if !linksBack {
+				report.Issues = append(report.Issues, HreflangIssue{
+					Type:    HreflangMissingReturnLink,
+					URL:     pageURL,
+					Target:  alternate.URL,
+					Lang:    alternate.Lang,
+					Message: fmt.Sprintf("%s does not link back to this page", alternate.URL),
+				})
+				continue
+			}
+			if lang, ok := selfLang(j); ok && lang != alternate.Lang {
+				report.Issues = append(report.Issues, HreflangIssue{
+					Type:    HreflangLanguageMismatch,
+					URL:     pageURL,
+					Target:  alternate.URL,
+					Lang:    alternate.Lang,
+					Message: fmt.Sprintf("Annotated as %q but declares itself %q", alternate.Lang, lang),
+				})
+			}
+		}
+	}
+
+	report.Consistent = len(report.Issues) == 0
+	return report
+}
+
+// serialize wraps each so concurrent analyses call it one at a time; a nil each
+// becomes a no-op
+func serialize(each func(*AnalysisResult)) func(*AnalysisResult) {
+	if each == nil {
+		return func(*AnalysisResult) {}
+	}
+	var mu sync.Mutex
+	return func(result *AnalysisResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		each(result)
+	}
+}
@@ -4,46 +4,149 @@ import (
 	"context"
 	"net/url"
 	"strings"
-	"time"
+
+	"web-page-analyzer/tracing"
 
 	"golang.org/x/net/html"
 )
 
 // analyzeDocument analyzes the HTML document and populates the result
-func (a *Analyzer) analyzeDocument(doc *html.Node, result *AnalysisResult, baseURL *url.URL, htmlContent string) {
+func (a *Analyzer) analyzeDocument(ctx context.Context, doc *html.Node, result *AnalysisResult, baseURL *url.URL, htmlContent string, opts AnalysisOptions) {
 	// Detect HTML version
 	result.HTMLVersion = a.detectHTMLVersion(htmlContent)
 
+	// Report structural problems repaired by the parser
+	result.ValidationIssues = a.validateHTML(htmlContent)
+
+	// Measure DOM size and shape
+	result.DOM = a.measureDOM(doc)
+
 	// Extract page title
-	result.PageTitle = a.extractPageTitle(doc)
+	result.PageTitle, result.TitleCount = a.extractPageTitle(doc)
 
 	// Count headings
 	result.HeadingCounts = a.countHeadings(doc)
+	if opts.HeadingsTextLimit > 0 {
+		result.HeadingsText = a.extractHeadingsText(doc, opts.HeadingsTextLimit)
+	}
+	reportProgress(ctx, Progress{
+		Stage:         ProgressDocument,
+		PageTitle:     result.PageTitle,
+		HTMLVersion:   result.HTMLVersion,
+		HeadingCounts: result.HeadingCounts,
+	})
 
 	// Extract and analyze links
-	links := a.extractLinks(doc)
-	a.analyzeLinksConcurrent(links, baseURL, result)
+	links := a.extractLinks(doc, baseURL)
+	if opts.ExpandShortLinks {
+		links, result.ShortLinks = a.expandShortLinks(ctx, links, baseURL)
+	}
+	if opts.CollectLinks {
+		result.Links = resolveLinks(links, baseURL)
+	}
+	var details []LinkDetail
+	if opts.SkipLinkCheck {
+		details = a.classifyLinks(links, baseURL, result)
+	} else {
+		details = a.analyzeLinksConcurrent(ctx, links, baseURL, result)
+	}
+	if opts.IncludeLinks {
+		result.LinkDetails = details
+	}
+
+	// Verify in-page fragment links point at existing targets
+	result.DeadAnchors = a.findDeadAnchors(doc, baseURL)
 
 	// Check for login forms
 	result.HasLoginForm = a.hasLoginForm(doc)
+	if result.HasLoginForm {
+		result.LoginForms = a.analyzeLoginForms(doc, baseURL)
+	}
+
+	// Check for payment forms and provider embeds
+	result.Payment = a.detectPaymentForms(doc, baseURL)
+
+	// Detect cookie-consent banners and platforms
+	result.Consent = a.detectConsent(doc)
+
+	// Detect ad networks and count ad slots
+	result.Ads = a.detectAds(doc)
+
+	// Detect paywalls, registration walls and metered content
+	result.Paywall = a.detectPaywall(doc)
+
+	// Validate schema.org structured data for rich results
+	result.StructuredData = a.validateStructuredData(doc)
+
+	// Count images and alt text, checking them for broken ones and sizes when asked
+	result.Images = a.auditImages(ctx, doc, baseURL, opts.CheckImages)
+
+	// Audit srcset, sizes and <picture> usage
+	result.ResponsiveImages = a.auditResponsiveImages(doc)
+
+	// Count links opening new tabs and those exposing window.opener
+	result.NewTabLinks = a.auditNewTabLinks(doc)
+
+	// List social preview images, checking they load along with the links
+	result.SocialImages = a.auditSocialImages(ctx, doc, baseURL, !opts.SkipLinkCheck)
+
+	// Verify AMP and canonical pages point at each other, fetching the other page along with the links
+	result.AMP = a.checkAMPPair(ctx, doc, baseURL, result.FinalURL, !opts.SkipLinkCheck)
+
+	// Flag redirects and content rendered in the browser
+	result.ClientSide = a.detectClientSideRendering(doc, baseURL)
+
+	// Flag age gates, cookie walls and overlays standing in for the content
+	result.Interstitial = a.detectInterstitials(doc)
+
+	// Judge the title and meta description lengths against SEO thresholds
+	result.Snippet = a.measureSnippet(doc, result.PageTitle)
+
+	// Extract the description, keywords, canonical, robots and viewport metadata
+	result.SEO = a.extractSEOMetadata(doc, baseURL)
+
+	// Collect hreflang alternates for reciprocity checks across pages
+	result.Hreflang = a.extractHreflang(doc, baseURL)
+
+	// Extract the readable main content when requested
+	if opts.ExtractContent {
+		result.MainContent = a.extractMainContent(doc)
+	}
+
+	// Extract custom fields from the configured and requested rules
+	result.CustomFields = a.extractCustomFields(doc, opts.ExtractionRules)
+
+	// Fingerprint the main content for duplicate detection
+	if root := findContentRoot(doc); root != nil {
+		result.ContentFingerprint = contentFingerprint(contentText(root))
+	}
 }
 
 // analyzeDocumentWithContext analyzes the HTML document with context support
-func (a *Analyzer) analyzeDocumentWithContext(ctx context.Context, doc *html.Node, result *AnalysisResult, baseURL *url.URL, htmlContent string) {
+func (a *Analyzer) analyzeDocumentWithContext(ctx context.Context, doc *html.Node, result *AnalysisResult, baseURL *url.URL, htmlContent string, opts AnalysisOptions) {
 	// Create a child context with a shorter timeout for HTML analysis
-	analysisCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	analysisCtx, cancel := context.WithTimeout(ctx, HTMLAnalysisTimeout)
 	defer cancel()
 
 	// Check if context is cancelled before starting analysis
 	select {
 	case <-analysisCtx.Done():
-		result.Error = NewTimeoutError("HTML analysis timeout", 10*time.Second)
+		result.Error = NewTimeoutError(baseURL.String(), HTMLAnalysisTimeout).
+			WithSuggestion("The analysis ran out of time; retry with check_links=false to skip link accessibility checks")
 		return
 	default:
 	}
 
 	// Perform the analysis
-	a.analyzeDocument(doc, result, baseURL, htmlContent)
+	documentCtx, span := tracing.Start(ctx, "analyzeDocument", tracing.KindInternal)
+	a.analyzeDocument(documentCtx, doc, result, baseURL, htmlContent, opts)
+	span.End()
+
+	// Look up the page and its external links in the configured threat lists;
+	// the lookup's timeout starts now, as link checks may outlast HTMLAnalysisTimeout
+	threatCtx, cancelThreats := context.WithTimeout(ctx, ThreatCheckTimeout)
+	defer cancelThreats()
+	a.checkThreats(threatCtx, doc, baseURL, result)
 }
 
 // detectHTMLVersion detects the HTML version from the document content
@@ -95,18 +198,65 @@ func (a *Analyzer) detectHTMLVersion(htmlContent string) string {
 	return "Unknown"
 }
 
-// extractPageTitle extracts the page title from the HTML document
-func (a *Analyzer) extractPageTitle(doc *html.Node) string {
+// extractPageTitle returns the page title as browsers show it, from the first
+// <title> element, along with the number of <title> elements in the document.
+// Titles inside inline SVG describe graphics rather than the page and are skipped.
+func (a *Analyzer) extractPageTitle(doc *html.Node) (string, int) {
 	var title string
+	count := 0
 	traverser := NewHTMLTraverser()
 
 	traverser.TraverseElements(doc, "title", func(n *html.Node) {
-		if n.FirstChild != nil {
-			title = strings.TrimSpace(n.FirstChild.Data)
+		if n.Namespace != "" {
+			return
+		}
+		if count == 0 {
+			// The parser decodes entities; the text may still span several nodes.
+			// Browsers collapse ASCII whitespace only, so &nbsp; is kept.
+			title = strings.Join(strings.FieldsFunc(nodeText(n), isASCIISpace), " ")
 		}
+		count++
 	})
 
-	return title
+	return title, count
+}
+
+// isASCIISpace reports whether r is whitespace as defined by the HTML standard
+func isASCIISpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\f' || r == '\r'
+}
+
+// extractSEOMetadata reads the metadata search engines use beyond the title.
+// The first <meta> of each name counts, except for robots directives, which
+// are combined from every robots meta tag as crawlers do.
+func (a *Analyzer) extractSEOMetadata(doc *html.Node, baseURL *url.URL) *SEOMetadata {
+	seo := &SEOMetadata{
+		Description: metaDescription(doc),
+		Canonical:   linkWithRel(doc, "canonical", baseURL),
+		Robots:      metaRobotsDirectives(doc),
+		Viewport:    strings.Join(strings.Fields(metaContent(doc, "viewport")), " "),
+	}
+	for _, keyword := range strings.Split(metaContent(doc, "keywords"), ",") {
+		if keyword = strings.Join(strings.Fields(keyword), " "); keyword != "" {
+			seo.Keywords = append(seo.Keywords, keyword)
+		}
+	}
+	return seo
+}
+
+// metaContent returns the content of the first <meta> with the given name,
+// compared case-insensitively
+func metaContent(doc *html.Node, name string) string {
+	var content string
+	found := false
+	traverser := NewHTMLTraverser()
+	traverser.TraverseElements(doc, "meta", func(n *html.Node) {
+		if !found && strings.EqualFold(strings.TrimSpace(traverser.GetAttributeValue(n, "name")), name) {
+			content = traverser.GetAttributeValue(n, "content")
+			found = true
+		}
+	})
+	return content
 }
 
 // countHeadings counts the occurrences of each heading level
@@ -126,21 +276,88 @@ func (a *Analyzer) countHeadings(doc *html.Node) map[string]int {
 	return headings
 }
 
-// extractLinks extracts all links from the HTML document
-func (a *Analyzer) extractLinks(doc *html.Node) []string {
+// extractHeadingsText returns the text of up to limit headings per level, in
+// document order with whitespace collapsed
+func (a *Analyzer) extractHeadingsText(doc *html.Node, limit int) map[string][]string {
+	headings := make(map[string][]string)
+	traverser := NewHTMLTraverser()
+
+	traverser.TraverseAllElements(doc, func(n *html.Node) {
+		if len(n.Data) != 2 || n.Data[0] != 'h' || n.Data[1] < '1' || n.Data[1] > '6' {
+			return
+		}
+		if len(headings[n.Data]) < limit {
+			headings[n.Data] = append(headings[n.Data], strings.Join(strings.Fields(nodeText(n)), " "))
+		}
+	})
+
+	return headings
+}
+
+// navigationLinkRels are <link> relations pointing at other documents rather
+// than at resources of the page such as stylesheets or icons
+var navigationLinkRels = map[string]bool{
+	"alternate": true, "author": true, "help": true, "license": true,
+	"next": true, "prev": true, "search": true,
+}
+
+// extractLinks extracts the links of <a> and <area> elements and navigation
+// <link> elements. When the document sets <base href>, links are resolved
+// against it, as browsers do.
+func (a *Analyzer) extractLinks(doc *html.Node, pageURL *url.URL) []string {
 	var links []string
 	traverser := NewHTMLTraverser()
+	base := documentBase(doc, pageURL)
+
+	traverser.TraverseAllElements(doc, func(n *html.Node) {
+		switch n.Data {
+		case "a", "area":
+		case "link":
+			isNavigation := false
+			for _, rel := range strings.Fields(strings.ToLower(traverser.GetAttributeValue(n, "rel"))) {
+				isNavigation = isNavigation || navigationLinkRels[rel]
+			}
+			if !isNavigation {
+				return
+			}
+		default:
+			return
+		}
 
-	traverser.TraverseElements(doc, "a", func(n *html.Node) {
-		href := traverser.GetAttributeValue(n, "href")
-		if href != "" && !strings.HasPrefix(href, "#") {
-			links = append(links, href)
+		href := strings.TrimSpace(traverser.GetAttributeValue(n, "href"))
+		if href == "" || strings.HasPrefix(href, "#") {
+			return
 		}
+		if base != nil {
+			resolved, err := base.Parse(href)
+			if err != nil {
+				return
+			}
+			href = resolved.String()
+		}
+		links = append(links, href)
 	})
 
 	return links
 }
 
+// documentBase returns the URL set by the document's first <base href>,
+// resolved against pageURL, or nil when there is none
+func documentBase(doc *html.Node, pageURL *url.URL) *url.URL {
+	traverser := NewHTMLTraverser()
+	var base *url.URL
+	traverser.TraverseElements(doc, "base", func(n *html.Node) {
+		href := strings.TrimSpace(traverser.GetAttributeValue(n, "href"))
+		if base != nil || href == "" {
+			return
+		}
+		if resolved, err := pageURL.Parse(href); err == nil {
+			base = resolved
+		}
+	})
+	return base
+}
+
 // hasLoginForm checks if the document contains a login form
 func (a *Analyzer) hasLoginForm(doc *html.Node) bool {
 	var hasLoginForm bool
@@ -6,12 +6,15 @@ import (
 	"golang.org/x/net/html"
 )
 
-// HTMLTraverser provides common HTML traversal functionality
+// HTMLTraverser provides common HTML traversal functionality. It holds no state,
+// so a single instance is shared by all callers.
 type HTMLTraverser struct{}
 
-// NewHTMLTraverser creates a new HTML traverser
+var sharedHTMLTraverser = &HTMLTraverser{}
+
+// NewHTMLTraverser returns the shared HTML traverser
 func NewHTMLTraverser() *HTMLTraverser {
-	return &HTMLTraverser{}
+	return sharedHTMLTraverser
 }
 
 // TraverseElements traverses HTML nodes and calls the provided function for each element
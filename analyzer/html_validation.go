@@ -0,0 +1,201 @@
+package analyzer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Validation issue types
+const (
+	ValidationUnclosedElement  = "unclosed_element"
+	ValidationMisnestedElement = "misnested_element"
+	ValidationStrayEndTag      = "stray_end_tag"
+	ValidationInvalidContext   = "invalid_context"
+)
+
+// voidElements never have content or an end tag
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"param": true, "source": true, "track": true, "wbr": true,
+}
+
+// optionalEndTagElements may legitimately be closed implicitly by the parser
+var optionalEndTagElements = map[string]bool{
+	"html": true, "head": true, "body": true, "p": true, "li": true,
+	"dt": true, "dd": true, "option": true, "optgroup": true, "tr": true,
+	"td": true, "th": true, "thead": true, "tbody": true, "tfoot": true,
+	"colgroup": true, "caption": true, "rb": true, "rt": true, "rp": true,
+}
+
+// blockElements implicitly close an open paragraph when they start
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"div": true, "dl": true, "fieldset": true, "footer": true, "form": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"header": true, "hr": true, "main": true, "nav": true, "ol": true,
+	"pre": true, "section": true, "table": true, "ul": true,
+}
+
+// requiredAncestors lists the elements one of which must enclose a given element
+var requiredAncestors = map[string][]string{
+	"li":     {"ul", "ol", "menu"},
+	"td":     {"tr"},
+	"th":     {"tr"},
+	"tr":     {"table", "thead", "tbody", "tfoot"},
+	"option": {"select", "datalist", "optgroup"},
+	"dt":     {"dl"},
+	"dd":     {"dl"},
+}
+
+// openElement tracks an element on the validator stack
+type openElement struct {
+	name string
+	line int
+}
+
+// validateHTML reports structural problems that the HTML parser silently repairs.
+// Line numbers refer to the start of the offending tag in the raw document.
+func (a *Analyzer) validateHTML(htmlContent string) []ValidationIssue {
+	var issues []ValidationIssue
+	var stack []openElement
+	line := 1
+
+	report := func(issue ValidationIssue) {
+		if len(issues) < MaxValidationIssues {
+			issues = append(issues, issue)
+		}
+	}
+
+	tokenizer := html.NewTokenizer(strings.NewReader(htmlContent))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			if tokenizer.Err() != io.EOF {
+				break
+			}
+			for i := len(stack) - 1; i >= 0; i-- {
+				if !optionalEndTagElements[stack[i].name] {
+					report(ValidationIssue{
+						Type:    ValidationUnclosedElement,
+						Element: stack[i].name,
+						Line:    stack[i].line,
+						Message: fmt.Sprintf("<%s> is never closed", stack[i].name),
+					})
+				}
+			}
+			break
+		}
+
+		tokenLine := line
+		line += bytes.Count(tokenizer.Raw(), []byte("\n"))
+
+		switch tokenType {
+		case html.StartTagToken:
+			name, _ := tokenizer.TagName()
+			tag := string(name)
+			if voidElements[tag] {
+				continue
+			}
+
+			for _, issue := range checkElementContext(tag, stack) {
+				issue.Line = tokenLine
+				report(issue)
+			}
+			stack = append(stack, openElement{name: tag, line: tokenLine})
+
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			tag := string(name)
+			if voidElements[tag] {
+				continue
+			}
+
+			idx := -1
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i].name == tag {
+					idx = i
+					break
+				}
+			}
+
+			if idx == -1 {
+				report(ValidationIssue{
+					Type:    ValidationStrayEndTag,
+					Element: tag,
+					Line:    tokenLine,
+					Message: fmt.Sprintf("</%s> has no matching start tag", tag),
+				})
+				continue
+			}
+
+			// Anything still open above the matching element was misnested,
+			// or simply never closed when the document body ends
+			for i := len(stack) - 1; i > idx; i-- {
+				if optionalEndTagElements[stack[i].name] {
+					continue
+				}
+				issue := ValidationIssue{
+					Type:    ValidationMisnestedElement,
+					Element: stack[i].name,
+					Line:    stack[i].line,
+					Message: fmt.Sprintf("<%s> is closed implicitly by </%s> on line %d", stack[i].name, tag, tokenLine),
+				}
+				if tag == "body" || tag == "html" {
+					issue.Type = ValidationUnclosedElement
+					issue.Message = fmt.Sprintf("<%s> is never closed", stack[i].name)
+				}
+				report(issue)
+			}
+			stack = stack[:idx]
+		}
+	}
+
+	return issues
+}
+
+// checkElementContext reports elements that appear where the content model does not allow them
+func checkElementContext(tag string, stack []openElement) []ValidationIssue {
+	var issues []ValidationIssue
+
+	isOpen := func(names ...string) bool {
+		for i := len(stack) - 1; i >= 0; i-- {
+			for _, name := range names {
+				if stack[i].name == name {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	if ancestors, ok := requiredAncestors[tag]; ok && !isOpen(ancestors...) {
+		issues = append(issues, ValidationIssue{
+			Type:    ValidationInvalidContext,
+			Element: tag,
+			Message: fmt.Sprintf("<%s> must be inside <%s>", tag, strings.Join(ancestors, ">, <")),
+		})
+	}
+
+	if blockElements[tag] && len(stack) > 0 && stack[len(stack)-1].name == "p" {
+		issues = append(issues, ValidationIssue{
+			Type:    ValidationInvalidContext,
+			Element: tag,
+			Message: fmt.Sprintf("<%s> cannot be nested inside <p>; the paragraph is closed implicitly", tag),
+		})
+	}
+
+	if (tag == "a" || tag == "form") && isOpen(tag) {
+		issues = append(issues, ValidationIssue{
+			Type:    ValidationInvalidContext,
+			Element: tag,
+			Message: fmt.Sprintf("<%s> cannot be nested inside another <%s>", tag, tag),
+		})
+	}
+
+	return issues
+}
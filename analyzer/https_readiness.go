@@ -0,0 +1,168 @@
+package analyzer
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"web-page-analyzer/logger"
+)
+
+// HTTPS readiness grades
+const (
+	GradeAPlus = "A+"
+	GradeA     = "A"
+	GradeB     = "B"
+	GradeC     = "C"
+	GradeF     = "F"
+)
+
+// HSTSMinMaxAge is the minimum max-age (one year) recommended for HSTS and required for preloading
+const HSTSMinMaxAge = 365 * 24 * 60 * 60
+
+// checkHTTPSReadiness checks HTTPS availability, the http-to-https redirect and the HSTS policy.
+// resp is the response of the main page fetch.
+func (a *Analyzer) checkHTTPSReadiness(ctx context.Context, targetURL *url.URL, resp *http.Response) *HTTPSReadiness {
+	readiness := &HTTPSReadiness{}
+
+	// HSTS is only honoured when delivered over HTTPS
+	if resp != nil && resp.Request != nil && resp.Request.URL.Scheme == "https" {
+		readiness.HTTPSAvailable = true
+		readiness.HSTS = parseHSTSHeader(resp.Header.Get("Strict-Transport-Security"))
+	}
+
+	if !readiness.HTTPSAvailable {
+		httpsURL := *targetURL
+		httpsURL.Scheme = "https"
+		if finalURL, header, ok := a.probeURL(ctx, httpsURL.String()); ok && finalURL.Scheme == "https" {
+			readiness.HTTPSAvailable = true
+			readiness.HSTS = parseHSTSHeader(header.Get("Strict-Transport-Security"))
+		}
+	}
+
+	httpURL := *targetURL
+	httpURL.Scheme = "http"
+	if finalURL, _, ok := a.probeURL(ctx, httpURL.String()); ok {
+		readiness.RedirectsToHTTPS = finalURL.Scheme == "https"
+	}
+
+	readiness.Grade, readiness.Findings = gradeHTTPSReadiness(readiness)
+	return readiness
+}
+
+// probeURL fetches a URL following redirects and returns the final URL and response headers
+func (a *Analyzer) probeURL(ctx context.Context, target string) (*url.URL, http.Header, bool) {
+	probeCtx, cancel := context.WithTimeout(ctx, LinkCheckTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(probeCtx, "GET", target, nil)
+	if err != nil {
+		return nil, nil, false
+	}
+	setBrowserHeaders(req)
+
+	client := a.getHTTPClient()
+	defer a.putHTTPClient(client)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.WithAnalysis(target).Debugw("Probe request failed", "error", err)
+		return nil, nil, false
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			logger.WithAnalysis(target).Debugw("Failed to close response body", "error", closeErr)
+		}
+	}()
+
+	return resp.Request.URL, resp.Header, true
+}
+
+// parseHSTSHeader parses a Strict-Transport-Security header value
+func parseHSTSHeader(value string) *HSTSPolicy {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+
+	policy := &HSTSPolicy{}
+	for _, part := range strings.Split(value, ";") {
+		directive := strings.TrimSpace(part)
+		lower := strings.ToLower(directive)
+		switch {
+		case strings.HasPrefix(lower, "max-age="):
+			maxAge, err := strconv.ParseInt(strings.Trim(directive[len("max-age="):], `"`), 10, 64)
+			if err == nil {
+				policy.MaxAge = maxAge
+			}
+		case lower == "includesubdomains":
+			policy.IncludeSubDomains = true
+		case lower == "preload":
+			policy.Preload = true
+		}
+	}
+
+	return policy
+}
+
+// gradeHTTPSReadiness assigns a grade and explains what keeps the site from the next grade
+func gradeHTTPSReadiness(readiness *HTTPSReadiness) (string, []Finding) {
+	var findings []Finding
+
+	if !readiness.HTTPSAvailable {
+		return GradeF, append(findings, Finding{
+			Severity: SeverityHigh,
+			Message:  "The site is not available over HTTPS",
+		})
+	}
+
+	if !readiness.RedirectsToHTTPS {
+		findings = append(findings, Finding{
+			Severity: SeverityMedium,
+			Message:  "The http:// variant does not redirect to https://",
+		})
+	}
+
+	hsts := readiness.HSTS
+	if hsts == nil {
+		findings = append(findings, Finding{
+			Severity: SeverityMedium,
+			Subject:  "Strict-Transport-Security",
+			Message:  "HSTS is not set",
+		})
+	} else {
+		if hsts.MaxAge < HSTSMinMaxAge {
+			findings = append(findings, Finding{
+				Severity: SeverityLow,
+				Subject:  "Strict-Transport-Security",
+				Message:  "HSTS max-age is shorter than one year",
+			})
+		}
+		if !hsts.IncludeSubDomains {
+			findings = append(findings, Finding{
+				Severity: SeverityInfo,
+				Subject:  "Strict-Transport-Security",
+				Message:  "HSTS does not include subdomains",
+			})
+		}
+		if !hsts.Preload {
+			findings = append(findings, Finding{
+				Severity: SeverityInfo,
+				Subject:  "Strict-Transport-Security",
+				Message:  "HSTS is not marked for preloading",
+			})
+		}
+	}
+
+	switch {
+	case hsts == nil && !readiness.RedirectsToHTTPS:
+		return GradeC, findings
+	case hsts == nil || !readiness.RedirectsToHTTPS || hsts.MaxAge < HSTSMinMaxAge:
+		return GradeB, findings
+	case hsts.IncludeSubDomains && hsts.Preload:
+		return GradeAPlus, findings
+	default:
+		return GradeA, findings
+	}
+}
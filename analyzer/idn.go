@@ -0,0 +1,40 @@
+package analyzer
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// HostToASCII converts an internationalized host name to its ASCII (punycode) form
+// using the IDNA lookup profile, which also maps ideographic full stops to dots.
+// ASCII-only hosts, including IP literals, are only lowercased.
+func HostToASCII(host string) (string, error) {
+	if isASCII(host) {
+		return strings.ToLower(host), nil
+	}
+	return idna.Lookup.ToASCII(host)
+}
+
+// HostToUnicode converts a punycode host name to its Unicode display form.
+// Labels that fail to decode are left as they are.
+func HostToUnicode(host string) string {
+	labels := strings.Split(host, ".")
+	for i, label := range labels {
+		if decoded, err := idna.Lookup.ToUnicode(label); err == nil {
+			labels[i] = decoded
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+// isASCII reports whether s contains only ASCII characters
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/url"
+	"sort"
+
+	"golang.org/x/net/html"
+)
+
+// auditImages counts the page's <img> elements and their alt text and, when
+// check is set, HEAD-checks each distinct image URL on a link-check pool to
+// report broken images and the largest ones by Content-Length; it returns nil
+// when the page has no images
+func (a *Analyzer) auditImages(ctx context.Context, doc *html.Node, baseURL *url.URL, check bool) *ImageReport {
+	var report *ImageReport
+	var targets []string
+	seen := make(map[string]bool)
+	traverser := NewHTMLTraverser()
+	traverser.TraverseElements(doc, "img", func(n *html.Node) {
+		if report == nil {
+			report = &ImageReport{}
+		}
+		report.Images++
+
+		// alt="" marks a decorative image, which is fine; a missing alt is not
+		switch {
+		case !traverser.HasAttribute(n, "alt"):
+			report.MissingAlt++
+		case traverser.GetAttributeValue(n, "alt") == "":
+			report.EmptyAlt++
+		}
+
+		src := traverser.GetAttributeValue(n, "src")
+		if src == "" {
+			return
+		}
+		target, err := baseURL.Parse(src)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+			return
+		}
+		target.Fragment = ""
+		if link := target.String(); !seen[link] && len(targets) < MaxImageChecks {
+			seen[link] = true
+			targets = append(targets, link)
+		}
+	})
+	if report == nil {
+		return nil
+	}
+
+	// Percentage of images with an alt attribute, to one decimal
+	report.AltCoverage = math.Round(float64(report.Images-report.MissingAlt)/float64(report.Images)*1000) / 10
+	if check && len(targets) > 0 {
+		a.checkImages(ctx, targets, report)
+	}
+	return report
+}
+
+// checkImages HEAD-checks the image URLs, recording the broken ones and the
+// largest that declare a Content-Length in report
+func (a *Analyzer) checkImages(ctx context.Context, targets []string, report *ImageReport) {
+	pool := a.newLinkCheckPool(len(targets), func(ctx context.Context, job AnalysisJob) LinkResult {
+		statusCode, contentLength, latency, err := a.headLink(ctx, job.Link)
+		// Images left unchecked once the analysis is out of outbound budget are not reported
+		if errors.Is(err, errOutboundBudgetExhausted) {
+			return LinkResult{Link: job.Link, Skipped: true}
+		}
+		return LinkResult{Link: job.Link, StatusCode: statusCode, Latency: latency, ContentLength: contentLength, CheckError: err}
+	})
+
+	checkCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	pool.Start(checkCtx)
+	go func() {
+		defer pool.Close()
+		for _, target := range targets {
+			if pool.Submit(checkCtx, AnalysisJob{Link: target}) != nil {
+				return
+			}
+		}
+	}()
+
+	var sizes []ImageSize
+	results := pool.Results()
+collect:
+	for range targets {
+		select {
+		case result := <-results:
+			if result.Skipped {
+				continue
+			}
+			report.Checked++
+			if !linkAccessible(result.StatusCode) {
+				broken := BrokenImage{URL: result.Link, StatusCode: result.StatusCode}
+				if result.CheckError != nil {
+					broken.Error = result.CheckError.Error()
+				}
+				report.Broken = append(report.Broken, broken)
+			} else if result.ContentLength >= 0 {
+				sizes = append(sizes, ImageSize{URL: result.Link, Bytes: result.ContentLength})
+			}
+		case <-checkCtx.Done():
+			break collect
+		}
+	}
+
+	// Abort in-flight checks and wait for workers to exit
+	cancel()
+	pool.Wait()
+
+	// Results arrive in completion order; sort them for stable reports
+	sort.Slice(report.Broken, func(i, j int) bool { return report.Broken[i].URL < report.Broken[j].URL })
+	sort.Slice(sizes, func(i, j int) bool {
+		if sizes[i].Bytes != sizes[j].Bytes {
+			return sizes[i].Bytes > sizes[j].Bytes
+		}
+		return sizes[i].URL < sizes[j].URL
+	})
+	if len(sizes) > LargestImages {
+		sizes = sizes[:LargestImages]
+	}
+	report.Largest = sizes
+}
@@ -0,0 +1,101 @@
+package analyzer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// evalPattern matches dynamic code evaluation in inline scripts
+var evalPattern = regexp.MustCompile(`\beval\s*\(|\bnew\s+Function\s*\(|\bset(?:Timeout|Interval)\s*\(\s*["'` + "`" + `]`)
+
+// urlAttributes are the attributes that may carry javascript: URLs
+var urlAttributes = []string{"href", "src", "action", "formaction"}
+
+// findInlineScripts reports inline on* event handlers, javascript: URLs and eval-style
+// calls in inline scripts, all of which prevent adopting a strict CSP
+func (a *Analyzer) findInlineScripts(doc *html.Node) *InlineScriptReport {
+	report := &InlineScriptReport{
+		EventHandlers: make(map[string]int),
+	}
+	traverser := NewHTMLTraverser()
+
+	addExample := func(kind, element, attribute, value string) {
+		if len(report.Examples) >= MaxInlineScriptExamples {
+			return
+		}
+		value = strings.TrimSpace(value)
+		if len(value) > MaxInlineScriptSnippet {
+			value = value[:MaxInlineScriptSnippet] + "..."
+		}
+		report.Examples = append(report.Examples, InlineScriptExample{
+			Type:      kind,
+			Element:   element,
+			Attribute: attribute,
+			Value:     value,
+		})
+	}
+
+	traverser.TraverseAllElements(doc, func(n *html.Node) {
+		for _, attr := range n.Attr {
+			name := strings.ToLower(attr.Key)
+			if strings.HasPrefix(name, "on") && len(name) > 2 {
+				report.EventHandlerCount++
+				report.EventHandlers[name]++
+				addExample("event_handler", n.Data, name, attr.Val)
+			}
+		}
+
+		for _, name := range urlAttributes {
+			value := strings.ToLower(strings.TrimSpace(traverser.GetAttributeValue(n, name)))
+			if strings.HasPrefix(value, "javascript:") {
+				report.JavaScriptURLCount++
+				addExample("javascript_url", n.Data, name, traverser.GetAttributeValue(n, name))
+			}
+		}
+
+		if n.Data == "script" && traverser.GetAttributeValue(n, "src") == "" {
+			if matches := evalPattern.FindAllString(nodeText(n), -1); len(matches) > 0 {
+				report.EvalCount += len(matches)
+				addExample("eval", n.Data, "", matches[0])
+			}
+		}
+	})
+
+	if len(report.EventHandlers) == 0 {
+		report.EventHandlers = nil
+	}
+	report.Findings = inlineScriptFindings(report)
+	return report
+}
+
+// inlineScriptFindings explains how the detected inline code affects CSP adoption
+func inlineScriptFindings(report *InlineScriptReport) []Finding {
+	var findings []Finding
+
+	if report.EventHandlerCount > 0 {
+		findings = append(findings, Finding{
+			Severity: SeverityMedium,
+			Subject:  "event_handlers",
+			Message:  fmt.Sprintf("%d inline event handler attributes require 'unsafe-inline' or 'unsafe-hashes' in script-src", report.EventHandlerCount),
+		})
+	}
+	if report.JavaScriptURLCount > 0 {
+		findings = append(findings, Finding{
+			Severity: SeverityMedium,
+			Subject:  "javascript_urls",
+			Message:  fmt.Sprintf("%d javascript: URLs are blocked by any CSP without 'unsafe-inline'", report.JavaScriptURLCount),
+		})
+	}
+	if report.EvalCount > 0 {
+		findings = append(findings, Finding{
+			Severity: SeverityHigh,
+			Subject:  "eval",
+			Message:  fmt.Sprintf("%d eval-style calls in inline scripts require 'unsafe-eval' and enable code injection", report.EvalCount),
+		})
+	}
+
+	return findings
+}
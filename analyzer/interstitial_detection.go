@@ -0,0 +1,199 @@
+package analyzer
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Interstitial kinds
+const (
+	InterstitialAgeGate    = "age_gate"
+	InterstitialCookieWall = "cookie_wall"
+	InterstitialOverlay    = "overlay"
+)
+
+// interstitialSignature describes how an interstitial kind is recognized
+type interstitialSignature struct {
+	kind string
+	// tokens are substrings of the id and class names of its element
+	tokens []string
+	// phrases are lowercase phrases of its prompt
+	phrases []string
+}
+
+// interstitialSignatures are checked in order; the first kind an element matches wins
+var interstitialSignatures = []interstitialSignature{
+	{
+		kind:   InterstitialAgeGate,
+		tokens: []string{"age-gate", "agegate", "age_gate", "age-verification", "ageverification", "age_verification", "age-check", "agecheck"},
+		phrases: []string{
+			"are you 18", "are you over 18", "are you 21", "are you over 21", "are you of legal",
+			"legal drinking age", "you must be 18", "you must be 21", "verify your age", "confirm your age",
+			"enter your date of birth",
+		},
+	},
+	{
+		kind:   InterstitialCookieWall,
+		tokens: []string{"cookie-wall", "cookiewall", "cookie_wall", "consent-wall", "consentwall", "consent_wall"},
+		phrases: []string{
+			"accept cookies to continue", "accept all cookies to continue", "consent to continue",
+			"accept cookies to access", "pay or accept", "pay or consent", "accept or subscribe",
+		},
+	},
+	{
+		kind:   InterstitialOverlay,
+		tokens: []string{"interstitial", "fullscreen-overlay", "full-screen-overlay", "splash-screen", "splash-overlay"},
+	},
+}
+
+// interstitialPromptElements are the elements whose text is matched against
+// the prompt phrases, so pages merely mentioning them are not flagged
+var interstitialPromptElements = map[string]bool{
+	"title": true, "h1": true, "h2": true, "h3": true, "label": true, "legend": true, "button": true,
+}
+
+// detectInterstitials reports age gates, cookie walls and full-screen overlays,
+// and whether the page has so little content besides them that the analysis
+// likely reflects the interstitial rather than the page; it returns nil when
+// there are none. Hidden elements, such as modals shown later, are ignored.
+func (a *Analyzer) detectInterstitials(doc *html.Node) *InterstitialReport {
+	report := &InterstitialReport{}
+	traverser := NewHTMLTraverser()
+	roots := make(map[*html.Node]bool)
+	var body *html.Node
+
+	var visit func(*html.Node)
+	visit = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if isHiddenElement(traverser, n) {
+				return
+			}
+			if n.Data == "body" {
+				body = n
+			}
+			names := strings.Fields(strings.ToLower(traverser.GetAttributeValue(n, "id") + " " + traverser.GetAttributeValue(n, "class")))
+			if kind, evidence := matchInterstitial(names, traverser.GetAttributeValue(n, "style")); kind != "" {
+				report.Kinds = appendUnique(report.Kinds, kind)
+				report.Evidence = appendUnique(report.Evidence, evidence)
+				roots[n] = true
+				// The interstitial's own elements are not checked again
+				return
+			}
+			if interstitialPromptElements[n.Data] {
+				text := strings.ToLower(strings.Join(strings.Fields(nodeText(n)), " "))
+				for _, signature := range interstitialSignatures {
+					for _, phrase := range signature.phrases {
+						if strings.Contains(text, phrase) {
+							report.Kinds = appendUnique(report.Kinds, signature.kind)
+							report.Evidence = appendUnique(report.Evidence, n.Data+":"+phrase)
+						}
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(doc)
+	if len(report.Kinds) == 0 {
+		return nil
+	}
+
+	report.ReplacesContent = body == nil || visibleTextLength(body, roots) < MinServerRenderedText
+	subject := strings.Join(report.Kinds, ", ")
+	if report.ReplacesContent {
+		report.Findings = append(report.Findings, Finding{Severity: SeverityMedium, Subject: subject,
+			Message: "Page content is replaced by an interstitial; the analysis may reflect the interstitial rather than the page"})
+	} else {
+		report.Findings = append(report.Findings, Finding{Severity: SeverityInfo, Subject: subject,
+			Message: "Page shows an interstitial over its content"})
+	}
+	return report
+}
+
+// matchInterstitial returns the interstitial kind an element's id and class
+// names or inline style mark it as, and the evidence
+func matchInterstitial(names []string, style string) (string, string) {
+	for _, signature := range interstitialSignatures {
+		for _, name := range names {
+			for _, token := range signature.tokens {
+				if strings.Contains(name, token) {
+					return signature.kind, "element:" + token
+				}
+			}
+		}
+	}
+	if isFullScreenStyle(style) {
+		return InterstitialOverlay, "style:fixed_fullscreen"
+	}
+	return "", ""
+}
+
+// isFullScreenStyle reports whether an inline style fixes an element over the
+// whole viewport
+func isFullScreenStyle(style string) bool {
+	style = strings.ReplaceAll(strings.ToLower(style), " ", "")
+	if !strings.Contains(style, "position:fixed") {
+		return false
+	}
+	declarations := make(map[string]string)
+	for _, declaration := range strings.Split(style, ";") {
+		if property, value, ok := strings.Cut(declaration, ":"); ok {
+			declarations[property] = strings.TrimSuffix(value, "!important")
+		}
+	}
+	full := func(property string, values ...string) bool {
+		for _, value := range values {
+			if declarations[property] == value {
+				return true
+			}
+		}
+		return false
+	}
+	if full("inset", "0", "0px") {
+		return true
+	}
+	if full("width", "100%", "100vw") && full("height", "100%", "100vh") {
+		return true
+	}
+	return full("top", "0", "0px") && full("left", "0", "0px") && full("right", "0", "0px") && full("bottom", "0", "0px")
+}
+
+// isHiddenElement reports whether an element is hidden by its hidden attribute
+// or an inline display:none
+func isHiddenElement(traverser *HTMLTraverser, n *html.Node) bool {
+	if traverser.HasAttribute(n, "hidden") {
+		return true
+	}
+	style := strings.ReplaceAll(strings.ToLower(traverser.GetAttributeValue(n, "style")), " ", "")
+	return strings.Contains(style, "display:none")
+}
+
+// visibleTextLength counts the characters of text under root outside the
+// excluded elements, scripts and styles
+func visibleTextLength(root *html.Node, excluded map[*html.Node]bool) int {
+	length := 0
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			length += len(strings.Join(strings.Fields(n.Data), " "))
+			return
+		case html.ElementNode:
+			if excluded[n] {
+				return
+			}
+			switch n.Data {
+			case "script", "style", "noscript", "template":
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			collect(c)
+		}
+	}
+	collect(root)
+	return length
+}
@@ -2,82 +2,97 @@ package analyzer
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"net/url"
+	"sort"
+	"strings"
 	"time"
 
-	"sync"
 	"web-page-analyzer/logger"
+	"web-page-analyzer/tracing"
 )
 
-// analyzeLinksConcurrent analyzes links concurrently using a worker pool
-func (a *Analyzer) analyzeLinksConcurrent(links []string, baseURL *url.URL, result *AnalysisResult) {
+// analyzeLinksConcurrent analyzes links concurrently using a worker pool and
+// returns the details of the links processed, sorted by absolute URL.
+// Link checks share a context that is cancelled when the link check deadline passes or
+// the request goes away, so outstanding HEAD requests are aborted rather than abandoned;
+// the links left unchecked are counted in result.UncheckedLinks.
+func (a *Analyzer) analyzeLinksConcurrent(ctx context.Context, links []string, baseURL *url.URL, result *AnalysisResult) []LinkDetail {
 	if len(links) == 0 {
-		return
+		return nil
 	}
+	ctx, span := tracing.Start(ctx, "analyzeLinksConcurrent", tracing.KindInternal, tracing.Int("links.total", len(links)))
+	defer span.End()
+	defer timePhase(ctx, phaseLinkChecks)()
+
+	// Hosts that keep failing have their remaining checks skipped
+	budget := newHostFailureBudget(LinkHostFailureBudget)
 
 	// For high-link sites like GitHub, use ultra-aggressive parallel processing
-	workers := a.calculateOptimalWorkers(len(links))
+	pool := a.newLinkCheckPool(len(links), func(ctx context.Context, job AnalysisJob) LinkResult {
+		return a.processLinkParallel(ctx, job.Link, job.BaseURL, budget)
+	})
+	workers := pool.workers
 
 	logger.WithAnalysis(baseURL.String()).Infow("Starting parallel link analysis",
 		"total_links", len(links),
 		"workers", workers,
 	)
 
-	// Create channels for parallel processing
-	jobs := make(chan string, len(links))
-	results := make(chan LinkResult, len(links))
-
-	// Start worker goroutines
-	var wg sync.WaitGroup
-	for i := 0; i < workers; i++ {
-		wg.Add(1)
-		go func(workerID int) {
-			defer wg.Done()
-			for link := range jobs {
-				// Process link in parallel
-				result := a.processLinkParallel(link, baseURL)
-				results <- result
-			}
-		}(i)
+	// Checks stop at the configured deadline, or earlier when the caller's own
+	// deadline leaves less time, keeping a reserve to report what was checked
+	deadline := time.Now().Add(a.linkCheckDeadline)
+	if callerDeadline, ok := ctx.Deadline(); ok {
+		reserve := LinkCheckDeadlineReserve
+		if remaining := time.Until(callerDeadline); remaining < 10*reserve {
+			reserve = remaining / 10
+		}
+		if callerDeadline.Add(-reserve).Before(deadline) {
+			deadline = callerDeadline.Add(-reserve)
+		}
 	}
+	linkCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	logger.WithAnalysis(baseURL.String()).Infow("Link analysis deadline configured",
+		"deadline_in", time.Until(deadline),
+		"total_links", len(links),
+	)
+
+	// Workers stop picking up work once the context is done
+	pool.Start(linkCtx)
 
-	// Submit all jobs
+	// Submit jobs until all are queued or the context is done
 	go func() {
+		defer pool.Close()
 		for _, link := range links {
-			jobs <- link
+			if pool.Submit(linkCtx, AnalysisJob{Link: link, BaseURL: baseURL}) != nil {
+				return
+			}
 		}
-		close(jobs)
 	}()
+	results := pool.Results()
+	reportProgress(ctx, Progress{Stage: ProgressLinks, LinksTotal: len(links)})
 
-	// Collect results with optimized timeout
+	// Collect results until every link is processed or the context is done
 	startTime := time.Now()
 	internalCount := 0
 	externalCount := 0
 	inaccessibleCount := 0
-
-	// Dynamic timeout based on link count - capped at 45 seconds for high-link sites
-	timeoutDuration := time.Duration(len(links)/3) * time.Second
-	if timeoutDuration < 30*time.Second {
-		timeoutDuration = 30 * time.Second
-	}
-	if timeoutDuration > 45*time.Second {
-		timeoutDuration = 45 * time.Second
-	}
-
-	timeout := time.After(timeoutDuration)
+	skippedCount := 0
 	resultsReceived := 0
+	var inaccessible []string
+	details := make([]LinkDetail, 0, len(links))
 
-	logger.WithAnalysis(baseURL.String()).Infow("Link analysis timeout configured",
-		"timeout_duration", timeoutDuration,
-		"total_links", len(links),
-	)
-
-	// Process results with early completion for high-link sites
+collect:
 	for resultsReceived < len(links) {
 		select {
 		case linkResult := <-results:
 			resultsReceived++
+			if resultsReceived%LinkProgressInterval == 0 || resultsReceived == len(links) {
+				reportProgress(ctx, Progress{Stage: ProgressLinks, LinksChecked: resultsReceived, LinksTotal: len(links)})
+			}
 
 			if linkResult.Error != nil {
 				logger.WithAnalysis(baseURL.String()).Errorw("Link analysis error",
@@ -86,18 +101,22 @@ func (a *Analyzer) analyzeLinksConcurrent(links []string, baseURL *url.URL, resu
 				)
 				continue
 			}
+			details = append(details, linkDetail(linkResult, baseURL))
 
 			if linkResult.IsInternal {
 				internalCount++
 			} else {
 				externalCount++
-				if !linkResult.IsAccessible {
+				if linkResult.Skipped {
+					skippedCount++
+				} else if !linkResult.IsAccessible {
 					inaccessibleCount++
+					inaccessible = append(inaccessible, linkResult.Link)
 				}
 			}
 
-			// For high-link sites, log progress every 20 links
-			if len(links) > 50 && resultsReceived%20 == 0 {
+			// For high-link sites, log progress every LinkProgressInterval links
+			if len(links) > 50 && resultsReceived%LinkProgressInterval == 0 {
 				logger.WithAnalysis(baseURL.String()).Infow("Link analysis progress",
 					"processed", resultsReceived,
 					"total", len(links),
@@ -107,20 +126,19 @@ func (a *Analyzer) analyzeLinksConcurrent(links []string, baseURL *url.URL, resu
 				)
 			}
 
-		case <-timeout:
-			logger.WithAnalysis(baseURL.String()).Warnw("Link analysis timeout",
+		case <-linkCtx.Done():
+			logger.WithAnalysis(baseURL.String()).Warnw("Link analysis stopped",
+				"reason", linkCtx.Err(),
 				"links_processed", resultsReceived,
 				"total_links", len(links),
-				"timeout_duration", timeoutDuration,
 			)
-			goto done
+			break collect
 		}
 	}
 
-done:
-	// Wait for all workers to finish
-	wg.Wait()
-	close(results)
+	// Abort in-flight checks and wait for workers to exit
+	cancel()
+	pool.Wait()
 
 	duration := time.Since(startTime)
 
@@ -128,63 +146,199 @@ done:
 	result.InternalLinks = internalCount
 	result.ExternalLinks = externalCount
 	result.InaccessibleLinks = inaccessibleCount
+	result.InaccessibleURLs = resolveLinks(inaccessible, baseURL)
+	result.SkippedLinks = skippedCount
+	result.UncheckedLinks = len(links) - resultsReceived
+	result.FailingHosts = budget.failingHosts()
+	span.SetAttributes(
+		tracing.Int("links.checked", resultsReceived),
+		tracing.Int("links.internal", internalCount),
+		tracing.Int("links.external", externalCount),
+		tracing.Int("links.inaccessible", inaccessibleCount),
+		tracing.Int("links.skipped", skippedCount),
+		tracing.Int("links.unchecked", result.UncheckedLinks),
+		tracing.Int("links.workers", workers),
+	)
 
 	logger.WithAnalysis(baseURL.String()).Infow("Links analysis completed",
 		"total", len(links),
-		"skipped", len(links)-resultsReceived,
+		"unchecked", result.UncheckedLinks,
 		"internal", internalCount,
 		"external", externalCount,
 		"inaccessible", inaccessibleCount,
+		"skipped_failing_hosts", skippedCount,
 		"duration_ms", duration.Milliseconds(),
 		"workers", workers,
-		"timeout_duration", timeoutDuration,
 	)
+	sortLinkDetails(details)
+	return details
 }
 
-// processLinkParallel processes a single link in parallel
-func (a *Analyzer) processLinkParallel(link string, baseURL *url.URL) LinkResult {
+// classifyLinks counts internal and external links without checking their
+// accessibility, returning their details sorted by absolute URL
+func (a *Analyzer) classifyLinks(links []string, baseURL *url.URL, result *AnalysisResult) []LinkDetail {
 	linkProcessor := NewLinkProcessor()
-	return linkProcessor.ProcessLink(link, baseURL, a.isLinkAccessible)
+	assumeAccessible := func(string) bool { return true }
+
+	details := make([]LinkDetail, 0, len(links))
+	for _, link := range links {
+		linkResult := linkProcessor.ProcessLink(link, baseURL, assumeAccessible)
+		if linkResult.Error != nil {
+			continue
+		}
+		details = append(details, linkDetail(linkResult, baseURL))
+		if linkResult.IsInternal {
+			result.InternalLinks++
+		} else {
+			result.ExternalLinks++
+		}
+	}
+	sortLinkDetails(details)
+	return details
 }
 
-// calculateOptimalWorkers calculates the optimal number of workers based on link count
-func (a *Analyzer) calculateOptimalWorkers(linkCount int) int {
-	// Ultra-aggressive scaling for high-link sites like GitHub
-	// This ensures maximum parallelization for complex sites
-	switch {
-	case linkCount <= 10:
-		return MinWorkers
-	case linkCount <= 25:
-		return 12
-	case linkCount <= 50:
-		return 24
-	case linkCount <= 100:
-		return 48
-	case linkCount <= 150:
-		return 64
-	case linkCount <= 200:
-		return 80
-	default:
-		return MaxWorkers // Maximum workers for ultra-high-link sites
+// linkDetail reports a processed link, resolving it against the page URL
+func linkDetail(linkResult LinkResult, baseURL *url.URL) LinkDetail {
+	detail := LinkDetail{
+		URL:        linkResult.Link,
+		Internal:   linkResult.IsInternal,
+		Accessible: linkResult.IsAccessible,
+		Skipped:    linkResult.Skipped,
+		StatusCode: linkResult.StatusCode,
+		LatencyMs:  linkResult.Latency.Milliseconds(),
+	}
+	if linkURL, err := baseURL.Parse(linkResult.Link); err == nil {
+		detail.AbsoluteURL = linkURL.String()
+	}
+	if linkResult.CheckError != nil {
+		detail.Error = linkResult.CheckError.Error()
 	}
+	return detail
+}
+
+// sortLinkDetails orders details by absolute URL, then as written, since
+// checks finish in any order
+func sortLinkDetails(details []LinkDetail) {
+	sort.SliceStable(details, func(i, j int) bool {
+		if details[i].AbsoluteURL != details[j].AbsoluteURL {
+			return details[i].AbsoluteURL < details[j].AbsoluteURL
+		}
+		return details[i].URL < details[j].URL
+	})
 }
 
-// isLinkAccessible checks if a link is accessible by making a HEAD request
-func (a *Analyzer) isLinkAccessible(link string) bool {
+// resolveLinks returns the page's links as sorted, de-duplicated absolute URLs,
+// dropping empty, fragment-only and unparseable links
+func resolveLinks(links []string, baseURL *url.URL) []string {
+	seen := make(map[string]bool, len(links))
+	var resolved []string
+	for _, link := range links {
+		if link == "" || strings.HasPrefix(link, "#") {
+			continue
+		}
+		linkURL, err := baseURL.Parse(link)
+		if err != nil {
+			continue
+		}
+		absolute := linkURL.String()
+		if !seen[absolute] {
+			seen[absolute] = true
+			resolved = append(resolved, absolute)
+		}
+	}
+	sort.Strings(resolved)
+	return resolved
+}
+
+// processLinkParallel processes a single link in parallel. Links to hosts that have
+// exhausted their failure budget, or found once the analysis is out of outbound
+// budget, are skipped rather than checked.
+func (a *Analyzer) processLinkParallel(ctx context.Context, link string, baseURL *url.URL, budget *hostFailureBudget) LinkResult {
+	linkProcessor := NewLinkProcessor()
+	skipped := false
+	var statusCode int
+	var latency time.Duration
+	var checkErr error
+
+	linkResult := linkProcessor.ProcessLink(link, baseURL, func(target string) bool {
+		host := linkHost(target)
+		if budget.exhausted(host) {
+			skipped = true
+			return false
+		}
+
+		statusCode, latency, checkErr = a.checkLinkStatus(ctx, target)
+		// Links left unchecked once the analysis is out of outbound budget are skipped
+		if errors.Is(checkErr, errOutboundBudgetExhausted) {
+			skipped, checkErr = true, nil
+			return false
+		}
+		// Failures caused by our own cancellation say nothing about the host
+		if checkErr != nil && ctx.Err() == nil {
+			budget.recordFailure(host)
+		}
+		return linkAccessible(statusCode)
+	})
+	linkResult.Skipped = skipped
+	linkResult.StatusCode = statusCode
+	linkResult.Latency = latency
+	linkResult.CheckError = checkErr
+
+	return linkResult
+}
+
+// checkLink makes a HEAD request to a link and reports whether it is accessible,
+// along with the transport error when the host could not be reached at all
+func (a *Analyzer) checkLink(ctx context.Context, link string) (bool, error) {
+	statusCode, _, err := a.checkLinkStatus(ctx, link)
+	return linkAccessible(statusCode), err
+}
+
+// linkAccessible reports whether a link check status counts as accessible;
+// 2xx and 3xx do, and zero means no response
+func linkAccessible(statusCode int) bool {
+	return statusCode >= 200 && statusCode < 400
+}
+
+// checkLinkStatus makes a HEAD request to a link and returns the response status
+// and round-trip time, or zero with the transport error when the host could not
+// be reached at all
+func (a *Analyzer) checkLinkStatus(ctx context.Context, link string) (int, time.Duration, error) {
+	statusCode, _, latency, err := a.headLink(ctx, link)
+	return statusCode, latency, err
+}
+
+// headLink makes the HEAD request of a link check and returns the response
+// status and Content-Length, which is -1 when the response does not declare it,
+// and the request's round-trip time, which leaves out the wait for a turn.
+// The outcome counts toward the host's reputation, which sets the check's
+// timeout; hosts known to be dead fail with errKnownDeadHost without a request.
+func (a *Analyzer) headLink(ctx context.Context, link string) (int, int64, time.Duration, error) {
 	linkProcessor := NewLinkProcessor()
 
 	// Skip special protocols
 	if linkProcessor.IsSpecialProtocol(link) {
-		return false
+		return 0, -1, 0, nil
 	}
 
+	// Batch analyses wait for a turn while interactive ones run
+	release, err := a.priorities.admit(ctx)
+	if err != nil {
+		return 0, -1, 0, err
+	}
+	defer release()
+
 	// Create HTTP request with timeout
 	client := a.getHTTPClient()
 	defer a.putHTTPClient(client)
 
 	req, err := http.NewRequest("HEAD", link, nil)
 	if err != nil {
-		return false
+		return 0, -1, 0, nil
+	}
+	host := req.URL.Host
+	if a.reputation.dead(host) {
+		return 0, -1, 0, errKnownDeadHost
 	}
 
 	// Set realistic headers to avoid bot detection
@@ -193,18 +347,32 @@ func (a *Analyzer) isLinkAccessible(link string) bool {
 	req.Header.Set("Accept-Language", "en-US,en;q=0.5")
 	req.Header.Set("Connection", "keep-alive")
 
-	// Make request with optimized timeout (3 seconds for faster response)
-	ctx, cancel := context.WithTimeout(context.Background(), LinkCheckTimeout)
+	ctx, span := tracing.Start(ctx, "checkLink", tracing.KindClient,
+		tracing.String("http.request.method", http.MethodHead),
+		tracing.String("url.full", link),
+	)
+	defer span.End()
+
+	// Hosts with a track record get a timeout matched to their latency
+	timeout := a.reputation.timeout(host)
+	checkCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
-	req = req.WithContext(ctx)
+	req = req.WithContext(checkCtx)
 
+	start := time.Now()
 	resp, err := client.Do(req)
+	latency := time.Since(start)
+	// Neither our own cancellation nor an exhausted outbound budget says anything about the host
+	if ctx.Err() == nil && !errors.Is(err, errOutboundBudgetExhausted) {
+		a.reputation.record(host, err == nil && resp.StatusCode < 500, latency)
+	}
 	if err != nil {
+		span.SetError(err.Error())
 		// Log timeout or connection errors for debugging
-		if ctx.Err() == context.DeadlineExceeded {
-			logger.WithAnalysis(link).Debugw("Link check timeout", "timeout", "3s")
+		if checkCtx.Err() == context.DeadlineExceeded {
+			logger.WithAnalysis(link).Debugw("Link check timeout", "timeout", timeout)
 		}
-		return false
+		return 0, -1, latency, err
 	}
 	defer func() {
 		if closeErr := resp.Body.Close(); closeErr != nil {
@@ -212,9 +380,10 @@ func (a *Analyzer) isLinkAccessible(link string) bool {
 		}
 	}()
 
-	// Consider 2xx and 3xx status codes as accessible
+	span.SetAttributes(tracing.Int("http.response.status_code", resp.StatusCode))
+
 	// Early success detection - no need to wait longer once we get a response
-	return resp.StatusCode >= 200 && resp.StatusCode < 400
+	return resp.StatusCode, resp.ContentLength, latency, nil
 }
 
 // getHTTPClient gets an HTTP client from the pool
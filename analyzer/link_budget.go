@@ -0,0 +1,60 @@
+package analyzer
+
+import (
+	"net/url"
+	"sort"
+	"sync"
+)
+
+// hostFailureBudget tracks link-check failures per host during one analysis so that
+// checks against a host that keeps failing are short-circuited instead of timing out
+type hostFailureBudget struct {
+	mu       sync.Mutex
+	limit    int
+	failures map[string]int
+}
+
+// newHostFailureBudget creates a budget allowing limit failures per host
+func newHostFailureBudget(limit int) *hostFailureBudget {
+	return &hostFailureBudget{
+		limit:    limit,
+		failures: make(map[string]int),
+	}
+}
+
+// exhausted reports whether a host has used up its failure budget
+func (b *hostFailureBudget) exhausted(host string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures[host] >= b.limit
+}
+
+// recordFailure charges a failed check against a host's budget
+func (b *hostFailureBudget) recordFailure(host string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures[host]++
+}
+
+// failingHosts returns the hosts whose budget is exhausted, sorted
+func (b *hostFailureBudget) failingHosts() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var hosts []string
+	for host, count := range b.failures {
+		if count >= b.limit {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// linkHost returns the host of an absolute link, or the link itself if it cannot be parsed
+func linkHost(link string) string {
+	if parsed, err := url.Parse(link); err == nil && parsed.Host != "" {
+		return parsed.Host
+	}
+	return link
+}
@@ -5,12 +5,28 @@ import (
 	"strings"
 )
 
-// LinkProcessor provides common link processing functionality
+// LinkProcessor provides common link processing functionality. It holds no state,
+// so a single instance is shared by all link checks.
 type LinkProcessor struct{}
 
-// NewLinkProcessor creates a new link processor
+var sharedLinkProcessor = &LinkProcessor{}
+
+// specialProtocols lists link schemes that are never fetched
+var specialProtocols = []string{
+	"javascript:",
+	"mailto:",
+	"tel:",
+	"ftp:",
+	"file:",
+	"data:",
+	"blob:",
+	"chrome:",
+	"moz-extension:",
+}
+
+// NewLinkProcessor returns the shared link processor
 func NewLinkProcessor() *LinkProcessor {
-	return &LinkProcessor{}
+	return sharedLinkProcessor
 }
 
 // ProcessLink processes a single link and returns the result
@@ -62,18 +78,6 @@ func (lp *LinkProcessor) ProcessLink(link string, baseURL *url.URL, isAccessible
 
 // IsSpecialProtocol checks if a link uses a special protocol that should be skipped
 func (lp *LinkProcessor) IsSpecialProtocol(link string) bool {
-	specialProtocols := []string{
-		"javascript:",
-		"mailto:",
-		"tel:",
-		"ftp:",
-		"file:",
-		"data:",
-		"blob:",
-		"chrome:",
-		"moz-extension:",
-	}
-
 	for _, protocol := range specialProtocols {
 		if strings.HasPrefix(link, protocol) {
 			return true
@@ -1,6 +1,8 @@
 package analyzer
 
 import (
+	"net/http"
+	"net/url"
 	"strings"
 
 	"golang.org/x/net/html"
@@ -103,3 +105,124 @@ func (a *Analyzer) isLoginForm(formNode *html.Node) bool {
 	// A form is considered a login form if it has both password and username fields
 	return hasPasswordField && hasUsernameField
 }
+
+// csrfTokenNames are substrings of hidden input names that carry anti-CSRF tokens
+var csrfTokenNames = []string{"csrf", "xsrf", "authenticity_token", "requestverificationtoken", "_token", "nonce"}
+
+// analyzeLoginForms reports the security properties of each login form on the page
+func (a *Analyzer) analyzeLoginForms(doc *html.Node, baseURL *url.URL) []LoginFormSecurity {
+	var forms []LoginFormSecurity
+	traverser := NewHTMLTraverser()
+
+	// Frameworks such as Rails and Laravel expose the token in a meta tag for scripted submits
+	pageToken := false
+	traverser.TraverseElements(doc, "meta", func(n *html.Node) {
+		if isCSRFTokenName(traverser.GetAttributeValue(n, "name")) {
+			pageToken = true
+		}
+	})
+
+	traverser.TraverseElements(doc, "form", func(n *html.Node) {
+		if !a.isLoginForm(n) {
+			return
+		}
+
+		action := baseURL
+		if value := strings.TrimSpace(traverser.GetAttributeValue(n, "action")); value != "" {
+			if parsed, err := url.Parse(value); err == nil {
+				action = baseURL.ResolveReference(parsed)
+			}
+		}
+
+		form := LoginFormSecurity{
+			Action:       action.String(),
+			Method:       strings.ToUpper(traverser.GetAttributeValue(n, "method")),
+			ActionHTTPS:  action.Scheme == "https",
+			PageHTTPS:    baseURL.Scheme == "https",
+			HasCSRFToken: pageToken,
+		}
+		if form.Method == "" {
+			form.Method = http.MethodGet
+		}
+
+		traverser.TraverseElements(n, "input", func(input *html.Node) {
+			inputType := strings.ToLower(traverser.GetAttributeValue(input, "type"))
+			switch {
+			case inputType == "password" && form.PasswordAutocomplete == "":
+				form.PasswordAutocomplete = strings.ToLower(strings.TrimSpace(traverser.GetAttributeValue(input, "autocomplete")))
+				if form.PasswordAutocomplete == "" {
+					form.PasswordAutocomplete = strings.ToLower(strings.TrimSpace(traverser.GetAttributeValue(n, "autocomplete")))
+				}
+			case inputType == "hidden" && isCSRFTokenName(traverser.GetAttributeValue(input, "name")):
+				form.HasCSRFToken = true
+			}
+		})
+
+		form.Findings = loginFormFindings(form)
+		forms = append(forms, form)
+	})
+
+	return forms
+}
+
+// isCSRFTokenName reports whether a field name looks like an anti-CSRF token
+func isCSRFTokenName(name string) bool {
+	name = strings.ToLower(name)
+	for _, token := range csrfTokenNames {
+		if strings.Contains(name, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// loginFormFindings turns the security properties of a login form into actionable findings
+func loginFormFindings(form LoginFormSecurity) []Finding {
+	var findings []Finding
+
+	if !form.PageHTTPS {
+		findings = append(findings, Finding{
+			Severity: SeverityHigh,
+			Subject:  "page",
+			Message:  "Login form is served over plain HTTP and can be modified in transit",
+		})
+	}
+	if !form.ActionHTTPS {
+		findings = append(findings, Finding{
+			Severity: SeverityHigh,
+			Subject:  "action",
+			Message:  "Credentials are submitted over plain HTTP to " + form.Action,
+		})
+	}
+	if form.Method == http.MethodGet {
+		findings = append(findings, Finding{
+			Severity: SeverityMedium,
+			Subject:  "method",
+			Message:  "Credentials are submitted with GET and end up in URLs, logs and browser history",
+		})
+	}
+	if !form.HasCSRFToken {
+		findings = append(findings, Finding{
+			Severity: SeverityMedium,
+			Subject:  "csrf",
+			Message:  "No anti-CSRF token found; the form may be vulnerable to login CSRF",
+		})
+	}
+	switch form.PasswordAutocomplete {
+	case "current-password", "new-password":
+	case "off":
+		findings = append(findings, Finding{
+			Severity: SeverityLow,
+			Subject:  "autocomplete",
+			Message:  "autocomplete=off on the password field hinders password managers; use autocomplete=current-password",
+		})
+	default:
+		findings = append(findings, Finding{
+			Severity: SeverityInfo,
+			Subject:  "autocomplete",
+			Message:  "Set autocomplete=current-password on the password field so password managers fill it reliably",
+		})
+	}
+
+	return findings
+}
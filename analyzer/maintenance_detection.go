@@ -0,0 +1,118 @@
+package analyzer
+
+import (
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// maintenancePhrases are common phrases found on maintenance and holding pages
+var maintenancePhrases = []string{
+	"we'll be back",
+	"we will be back",
+	"we’ll be back",
+	"be right back",
+	"under maintenance",
+	"down for maintenance",
+	"scheduled maintenance",
+	"maintenance mode",
+	"temporarily unavailable",
+	"site is currently unavailable",
+	"back online shortly",
+	"coming soon",
+}
+
+// detectMaintenancePage checks whether a response is a maintenance or holding page.
+// It returns nil when the page looks like regular content. A 503, or a success
+// with a Retry-After header, maintenance phrases in both its title and a
+// heading, or almost no content besides them, is a holding page; otherwise the
+// phrases are reported without HoldingPage, as regular pages use them too.
+func (a *Analyzer) detectMaintenancePage(statusCode int, header http.Header, doc *html.Node) *MaintenanceInfo {
+	info := &MaintenanceInfo{
+		RetryAfter: strings.TrimSpace(header.Get("Retry-After")),
+	}
+
+	if statusCode == http.StatusServiceUnavailable {
+		info.Indicators = append(info.Indicators, "status_503")
+	}
+	if info.RetryAfter != "" {
+		info.Indicators = append(info.Indicators, "retry_after_header")
+	}
+
+	// Only the prominent parts of the page are inspected so that regular pages
+	// merely mentioning maintenance in their body text are not flagged
+	inTitle, inHeading := false, false
+	var body *html.Node
+	if doc != nil {
+		traverser := NewHTMLTraverser()
+		traverser.TraverseAllElements(doc, func(n *html.Node) {
+			switch n.Data {
+			case "body":
+				body = n
+				return
+			case "title", "h1", "h2":
+			default:
+				return
+			}
+			if phrase := matchMaintenancePhrase(nodeText(n)); phrase != "" {
+				info.Indicators = appendUnique(info.Indicators, n.Data+":"+phrase)
+				if n.Data == "title" {
+					inTitle = true
+				} else {
+					inHeading = true
+				}
+			}
+		})
+	}
+	if !inTitle && !inHeading {
+		// A 503 is only treated as maintenance when it carries a Retry-After hint
+		// or a maintenance template; a bare 503 remains a regular HTTP error
+		if statusCode != http.StatusServiceUnavailable || info.RetryAfter == "" {
+			return nil
+		}
+	}
+
+	info.HoldingPage = statusCode == http.StatusServiceUnavailable ||
+		info.RetryAfter != "" ||
+		(inTitle && inHeading) ||
+		body == nil || visibleTextLength(body, nil) < MaintenanceMaxContentText
+	return info
+}
+
+// matchMaintenancePhrase returns the first maintenance phrase contained in text
+func matchMaintenancePhrase(text string) string {
+	text = strings.ToLower(text)
+	for _, phrase := range maintenancePhrases {
+		if strings.Contains(text, phrase) {
+			return phrase
+		}
+	}
+	return ""
+}
+
+// nodeText returns the concatenated text content of a node and its descendants
+func nodeText(n *html.Node) string {
+	var sb strings.Builder
+	var collect func(*html.Node)
+	collect = func(node *html.Node) {
+		if node.Type == html.TextNode {
+			sb.WriteString(node.Data)
+		}
+		for c := node.FirstChild; c != nil; c = c.NextSibling {
+			collect(c)
+		}
+	}
+	collect(n)
+	return strings.TrimSpace(sb.String())
+}
+
+// appendUnique appends value to values if it is not already present
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
@@ -1,7 +1,9 @@
 package analyzer
 
 import (
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -14,6 +16,60 @@ type MetricsManager struct {
 	AvgDuration    time.Duration
 	CacheHits      int64
 	CacheMisses    int64
+	FailedRequests int64
+
+	// Outbound requests, response bytes and time per phase summed over the
+	// analyses that ran, i.e. not cache hits or coalesced requests
+	OutboundRequests int64
+	OutboundBytes    int64
+	FetchTime        time.Duration
+	ParseTime        time.Duration
+	LinkCheckTime    time.Duration
+
+	// Latency percentiles over the last LatencyWindowSize analyses
+	LatencyP50 time.Duration
+	LatencyP95 time.Duration
+
+	// Cache and circuit breaker state, sampled when metrics are read
+	CacheEntries           int
+	CacheExpired           int
+	CacheEvictions         int64
+	CircuitBreakerState    string
+	CircuitBreakerFailures int
+	CircuitBreakerTrips    int64
+
+	// Target hosts that answered 429, most throttled first
+	ThrottledHosts []HostThrottleStats
+
+	// Link-check worker pools across running analyses
+	WorkerPool WorkerPoolStats
+
+	cache        *CacheManager
+	breaker      *CircuitBreaker
+	throttle     *throttleTracker
+	workers      *workerPoolCounters
+	workerConfig *atomic.Pointer[WorkerPoolConfig]
+
+	// Ring buffer of recent durations; next is the slot written next
+	recent []time.Duration
+	next   int
+}
+
+// ErrorRate returns the fraction of analyses that ended with an error
+func (mm *MetricsManager) ErrorRate() float64 {
+	if mm.TotalRequests == 0 {
+		return 0
+	}
+	return float64(mm.FailedRequests) / float64(mm.TotalRequests)
+}
+
+// CacheHitRatio returns the fraction of lookups served from the cache
+func (mm *MetricsManager) CacheHitRatio() float64 {
+	lookups := mm.CacheHits + mm.CacheMisses
+	if lookups == 0 {
+		return 0
+	}
+	return float64(mm.CacheHits) / float64(lookups)
 }
 
 // NewMetricsManager creates a new metrics manager
@@ -21,18 +77,62 @@ func NewMetricsManager() *MetricsManager {
 	return &MetricsManager{}
 }
 
-// GetMetrics returns a copy of current metrics
+// GetMetrics returns a copy of current metrics, including cache and circuit
+// breaker state when those components are attached
 func (mm *MetricsManager) GetMetrics() MetricsManager {
+	var entries, expired int
+	var evictions int64
+	if mm.cache != nil {
+		entries, expired = mm.cache.GetStats()
+		evictions = mm.cache.Evictions()
+	}
+
+	breakerState := ""
+	var failures int
+	var trips int64
+	if mm.breaker != nil {
+		var state int
+		state, failures, trips = mm.breaker.Stats()
+		breakerState = StateName(state)
+	}
+
+	var throttled []HostThrottleStats
+	if mm.throttle != nil {
+		throttled = mm.throttle.Stats()
+	}
+
+	var workerPool WorkerPoolStats
+	if mm.workers != nil && mm.workerConfig != nil {
+		workerPool = mm.workers.snapshot(*mm.workerConfig.Load())
+	}
+
 	mm.mu.RLock()
 	defer mm.mu.RUnlock()
 
+	p50, p95 := latencyPercentiles(mm.recent)
 	return MetricsManager{
-		TotalRequests:  mm.TotalRequests,
-		ActiveRequests: mm.ActiveRequests,
-		TotalDuration:  mm.TotalDuration,
-		AvgDuration:    mm.AvgDuration,
-		CacheHits:      mm.CacheHits,
-		CacheMisses:    mm.CacheMisses,
+		TotalRequests:          mm.TotalRequests,
+		ActiveRequests:         mm.ActiveRequests,
+		TotalDuration:          mm.TotalDuration,
+		AvgDuration:            mm.AvgDuration,
+		CacheHits:              mm.CacheHits,
+		CacheMisses:            mm.CacheMisses,
+		FailedRequests:         mm.FailedRequests,
+		OutboundRequests:       mm.OutboundRequests,
+		OutboundBytes:          mm.OutboundBytes,
+		FetchTime:              mm.FetchTime,
+		ParseTime:              mm.ParseTime,
+		LinkCheckTime:          mm.LinkCheckTime,
+		LatencyP50:             p50,
+		LatencyP95:             p95,
+		CacheEntries:           entries,
+		CacheExpired:           expired,
+		CacheEvictions:         evictions,
+		CircuitBreakerState:    breakerState,
+		CircuitBreakerFailures: failures,
+		CircuitBreakerTrips:    trips,
+		ThrottledHosts:         throttled,
+		WorkerPool:             workerPool,
 	}
 }
 
@@ -48,6 +148,41 @@ func (mm *MetricsManager) updateMetrics(duration time.Duration) {
 	if mm.TotalRequests > 0 {
 		mm.AvgDuration = mm.TotalDuration / time.Duration(mm.TotalRequests)
 	}
+
+	if len(mm.recent) < LatencyWindowSize {
+		mm.recent = append(mm.recent, duration)
+	} else {
+		mm.recent[mm.next] = duration
+	}
+	mm.next = (mm.next + 1) % LatencyWindowSize
+}
+
+// recordFailure counts an analysis that ended with an error
+func (mm *MetricsManager) recordFailure() {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	mm.FailedRequests++
+}
+
+// recordCost adds the outbound usage and phase timings of an analysis that ran
+func (mm *MetricsManager) recordCost(usage *OutboundUsage, timings *AnalysisTimings) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	mm.OutboundRequests += int64(usage.Requests)
+	mm.OutboundBytes += usage.Bytes
+	mm.FetchTime += time.Duration(timings.FetchMs) * time.Millisecond
+	mm.ParseTime += time.Duration(timings.ParseMs) * time.Millisecond
+	mm.LinkCheckTime += time.Duration(timings.LinkChecksMs) * time.Millisecond
+}
+
+// latencyPercentiles returns the median and 95th percentile of durations
+func latencyPercentiles(durations []time.Duration) (p50, p95 time.Duration) {
+	if len(durations) == 0 {
+		return 0, 0
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[(len(sorted)-1)*50/100], sorted[(len(sorted)-1)*95/100]
 }
 
 // incrementActiveRequests increments the active requests counter
@@ -89,4 +224,12 @@ func (mm *MetricsManager) Reset() {
 	mm.AvgDuration = 0
 	mm.CacheHits = 0
 	mm.CacheMisses = 0
+	mm.FailedRequests = 0
+	mm.OutboundRequests = 0
+	mm.OutboundBytes = 0
+	mm.FetchTime = 0
+	mm.ParseTime = 0
+	mm.LinkCheckTime = 0
+	mm.recent = nil
+	mm.next = 0
 }
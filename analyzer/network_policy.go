@@ -0,0 +1,39 @@
+package analyzer
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// SetBlockPrivateNetworks enables or disables refusing connections to private,
+// loopback and link-local addresses, protecting internal services from being
+// probed through the analyzer
+func (a *Analyzer) SetBlockPrivateNetworks(block bool) {
+	a.blockPrivateNetworks.Store(block)
+}
+
+// dialControl is invoked for every outbound connection after DNS resolution,
+// so it sees the actual IP address being dialed
+func (a *Analyzer) dialControl(network, address string, _ syscall.RawConn) error {
+	if !a.blockPrivateNetworks.Load() {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || isPrivateIP(ip) {
+		return fmt.Errorf("%w: %s", errBlockedByPolicy, host)
+	}
+	return nil
+}
+
+// isPrivateIP reports whether an IP address belongs to a non-public network
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.IsInterfaceLocalMulticast()
+}
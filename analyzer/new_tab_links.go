@@ -0,0 +1,83 @@
+package analyzer
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// auditNewTabLinks counts the <a> and <area> links that open in a new browsing
+// context, through their own target or the document's <base target>, and those
+// that give the opened page access to window.opener. It returns nil when no
+// link opens a new tab.
+func (a *Analyzer) auditNewTabLinks(doc *html.Node) *NewTabLinkReport {
+	report := &NewTabLinkReport{}
+	traverser := NewHTMLTraverser()
+
+	traverser.TraverseElements(doc, "base", func(n *html.Node) {
+		if report.BaseTarget == "" {
+			report.BaseTarget = strings.TrimSpace(traverser.GetAttributeValue(n, "target"))
+		}
+	})
+
+	traverser.TraverseAllElements(doc, func(n *html.Node) {
+		if n.Data != "a" && n.Data != "area" {
+			return
+		}
+		href := strings.TrimSpace(traverser.GetAttributeValue(n, "href"))
+		if href == "" {
+			return
+		}
+
+		// A link's own target overrides the base target, even when empty
+		target, hasTarget := lookupAttribute(n, "target")
+		if !hasTarget {
+			target = report.BaseTarget
+		}
+		if !opensNewContext(target) {
+			return
+		}
+		report.NewTabLinks++
+		if !hasTarget {
+			report.FromBaseTarget++
+		}
+
+		// noreferrer implies noopener
+		rels := strings.Fields(strings.ToLower(traverser.GetAttributeValue(n, "rel")))
+		protected := false
+		for _, rel := range rels {
+			protected = protected || rel == "noopener" || rel == "noreferrer"
+		}
+		if !protected {
+			report.MissingNoopener++
+			if len(report.Examples) < MaxNewTabExamples {
+				report.Examples = append(report.Examples, href)
+			}
+		}
+	})
+
+	if report.NewTabLinks == 0 {
+		return nil
+	}
+	return report
+}
+
+// opensNewContext reports whether a link target opens a new tab or window:
+// _blank, or a named context that does not exist yet
+func opensNewContext(target string) bool {
+	switch strings.ToLower(strings.TrimSpace(target)) {
+	case "", "_self", "_parent", "_top":
+		return false
+	}
+	return true
+}
+
+// lookupAttribute returns an attribute's value and whether it is present
+func lookupAttribute(n *html.Node, name string) (string, bool) {
+	for _, attr := range n.Attr {
+		if attr.Namespace == "" && attr.Key == name {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
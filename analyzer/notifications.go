@@ -0,0 +1,261 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"web-page-analyzer/logger"
+)
+
+// Notification conditions
+const (
+	ConditionAnalysisFailed   = "analysis_failed"
+	ConditionBrokenLinks      = "broken_links"
+	ConditionLoginFormRemoved = "login_form_removed"
+	ConditionTitleChanged     = "title_changed"
+	// ConditionPageChanged fires when a scheduled run differs from the previous run of its URL
+	ConditionPageChanged = "page_changed"
+)
+
+// Webhook formats
+const (
+	WebhookFormatSlack   = "slack"
+	WebhookFormatTeams   = "teams"
+	WebhookFormatGeneric = "generic"
+)
+
+// NotificationRule is a condition checked after every analysis
+type NotificationRule struct {
+	Name      string `json:"name"`
+	Condition string `json:"condition"`
+	// Threshold is the number of broken links tolerated by the broken_links condition
+	Threshold int `json:"threshold,omitempty"`
+}
+
+// Webhook is a destination notified when a rule fires
+type Webhook struct {
+	URL    string `json:"url"`
+	Format string `json:"format"`
+}
+
+// NotificationConfig is the notification file format
+type NotificationConfig struct {
+	Webhooks []Webhook          `json:"webhooks"`
+	Rules    []NotificationRule `json:"rules"`
+}
+
+// pageState is what the notifier remembers about a page's previous analysis
+type pageState struct {
+	title        string
+	hasLoginForm bool
+}
+
+// Notifier evaluates notification rules against completed analyses and posts
+// the notifications that fire to the configured webhooks
+type Notifier struct {
+	rules      []NotificationRule
+	webhooks   []Webhook
+	httpClient *http.Client
+
+	mu       sync.Mutex
+	previous map[string]pageState
+}
+
+// NewNotifier creates a notifier, validating its rules and webhooks
+func NewNotifier(config NotificationConfig) (*Notifier, error) {
+	for i, rule := range config.Rules {
+		switch rule.Condition {
+		case ConditionAnalysisFailed, ConditionBrokenLinks, ConditionLoginFormRemoved, ConditionTitleChanged, ConditionPageChanged:
+		default:
+			return nil, fmt.Errorf("rule %d: unknown condition %q", i, rule.Condition)
+		}
+		if config.Rules[i].Name == "" {
+			config.Rules[i].Name = rule.Condition
+		}
+	}
+	for i, webhook := range config.Webhooks {
+		if webhook.URL == "" {
+			return nil, fmt.Errorf("webhook %d: url is required", i)
+		}
+		switch webhook.Format {
+		case WebhookFormatSlack, WebhookFormatTeams, WebhookFormatGeneric:
+		case "":
+			config.Webhooks[i].Format = WebhookFormatGeneric
+		default:
+			return nil, fmt.Errorf("webhook %d: unknown format %q", i, webhook.Format)
+		}
+	}
+
+	return &Notifier{
+		rules:      config.Rules,
+		webhooks:   config.Webhooks,
+		httpClient: &http.Client{Timeout: NotificationTimeout},
+		previous:   make(map[string]pageState),
+	}, nil
+}
+
+// LoadNotifier reads a notification config from a JSON file
+func LoadNotifier(path string) (*Notifier, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config NotificationConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return NewNotifier(config)
+}
+
+// SetNotifier registers the notifier evaluated after every analysis
+func (a *Analyzer) SetNotifier(notifier *Notifier) {
+	a.notifier = notifier
+}
+
+// Notifier returns the registered notifier, or nil when notifications are disabled
+func (a *Analyzer) Notifier() *Notifier {
+	return a.notifier
+}
+
+// Evaluate checks the rules against a result and the page's previous analysis,
+// returning the notifications that fire
+func (n *Notifier) Evaluate(result *AnalysisResult) []Notification {
+	key := result.NormalizedURL
+	if key == "" {
+		key = result.URL
+	}
+
+	// Comparisons are only meaningful between successful analyses
+	n.mu.Lock()
+	previous, seen := n.previous[key]
+	if result.Error == nil {
+		n.previous[key] = pageState{title: result.PageTitle, hasLoginForm: result.HasLoginForm}
+	}
+	n.mu.Unlock()
+	comparable := seen && result.Error == nil
+
+	var notifications []Notification
+	fire := func(rule NotificationRule, message string) {
+		notifications = append(notifications, Notification{
+			Rule:      rule.Name,
+			Condition: rule.Condition,
+			URL:       result.URL,
+			Message:   message,
+			Timestamp: time.Now().UTC(),
+		})
+	}
+
+	for _, rule := range n.rules {
+		switch rule.Condition {
+		case ConditionAnalysisFailed:
+			if result.Error != nil {
+				fire(rule, fmt.Sprintf("Analysis of %s failed: %s", result.URL, result.Error.Message))
+			}
+		case ConditionBrokenLinks:
+			if result.Error == nil && result.InaccessibleLinks > rule.Threshold {
+				fire(rule, fmt.Sprintf("%s has %d broken links (threshold %d)", result.URL, result.InaccessibleLinks, rule.Threshold))
+			}
+		case ConditionLoginFormRemoved:
+			if comparable && previous.hasLoginForm && !result.HasLoginForm {
+				fire(rule, fmt.Sprintf("The login form on %s has disappeared", result.URL))
+			}
+		case ConditionTitleChanged:
+			if comparable && previous.title != result.PageTitle {
+				fire(rule, fmt.Sprintf("The title of %s changed from %q to %q", result.URL, previous.title, result.PageTitle))
+			}
+		}
+	}
+	return notifications
+}
+
+// NotifyChange fires the page_changed rules for a change detected between consecutive
+// scheduled runs, delivering them in the background
+func (n *Notifier) NotifyChange(url, summary string) []Notification {
+	var notifications []Notification
+	for _, rule := range n.rules {
+		if rule.Condition == ConditionPageChanged {
+			notifications = append(notifications, Notification{
+				Rule:      rule.Name,
+				Condition: rule.Condition,
+				URL:       url,
+				Message:   fmt.Sprintf("%s changed since the last scheduled run: %s", url, summary),
+				Timestamp: time.Now().UTC(),
+			})
+		}
+	}
+	n.deliver(url, notifications)
+	return notifications
+}
+
+// notify evaluates the rules for a completed analysis and delivers what fires in the background
+func (n *Notifier) notify(result *AnalysisResult) {
+	n.deliver(result.URL, n.Evaluate(result))
+}
+
+// deliver posts notifications to every webhook in the background
+func (n *Notifier) deliver(url string, notifications []Notification) {
+	if len(notifications) == 0 || len(n.webhooks) == 0 {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), NotificationTimeout)
+		defer cancel()
+
+		for _, notification := range notifications {
+			for _, webhook := range n.webhooks {
+				if err := n.post(ctx, webhook, notification); err != nil {
+					logger.WithAnalysis(url).Warnw("Failed to deliver notification",
+						"rule", notification.Rule, "format", webhook.Format, "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// post delivers a notification in the webhook's format
+func (n *Notifier) post(ctx context.Context, webhook Webhook, notification Notification) error {
+	var body interface{}
+	switch webhook.Format {
+	case WebhookFormatSlack:
+		body = map[string]string{"text": ":warning: " + notification.Message}
+	case WebhookFormatTeams:
+		body = map[string]string{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"summary":    notification.Rule,
+			"themeColor": "D70000",
+			"title":      "Web page analyzer: " + notification.Rule,
+			"text":       notification.Message,
+		}
+	default:
+		body = notification
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
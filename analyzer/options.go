@@ -0,0 +1,67 @@
+package analyzer
+
+import (
+	"strconv"
+	"strings"
+)
+
+// cacheKeySuffix returns a cache key suffix identifying the enabled options
+func (o AnalysisOptions) cacheKeySuffix() string {
+	var flags []string
+	if o.CompareVariants {
+		flags = append(flags, "variants")
+	}
+	if o.SkipLinkCheck {
+		flags = append(flags, "nolinkcheck")
+	}
+	if o.ExpandShortLinks {
+		flags = append(flags, "expandshort")
+	}
+	if o.QuickCheck {
+		flags = append(flags, "quick")
+	}
+	if o.ExtractContent {
+		flags = append(flags, "content")
+	}
+	if o.LookupDomain {
+		flags = append(flags, "domain")
+	}
+	if o.PageSpeed {
+		flags = append(flags, "pagespeed")
+	}
+	if o.IncludeHeaders {
+		flags = append(flags, "headers")
+	}
+	if o.CollectLinks {
+		flags = append(flags, "links")
+	}
+	if o.IncludeLinks {
+		flags = append(flags, "linkdetails")
+	}
+	if o.CheckImages {
+		flags = append(flags, "images")
+	}
+	if o.CheckRobots {
+		flags = append(flags, "robots")
+	}
+	if !o.ArchiveDate.IsZero() {
+		flags = append(flags, "wayback:"+o.ArchiveDate.UTC().Format(waybackTimestamp))
+	}
+	if o.SnapshotLimit > 0 {
+		flags = append(flags, "snapshot:"+strconv.FormatInt(o.SnapshotLimit, 10))
+	}
+	if o.HeadingsTextLimit > 0 {
+		flags = append(flags, "headings:"+strconv.Itoa(o.HeadingsTextLimit))
+	}
+	if len(o.ExtractionRules) > 0 {
+		flags = append(flags, extractionKey(o.ExtractionRules))
+	}
+	if len(o.Assertions) > 0 {
+		flags = append(flags, assertionKey(o.Assertions))
+	}
+
+	if len(flags) == 0 {
+		return ""
+	}
+	return "|" + strings.Join(flags, ",")
+}
@@ -0,0 +1,121 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// errOutboundBudgetExhausted is returned for requests made after an analysis
+// has used up its outbound budget
+var errOutboundBudgetExhausted = errors.New("outbound request budget exhausted")
+
+// OutboundUsage reports the outbound requests one analysis made against its budget.
+// Limits of zero are unlimited.
+type OutboundUsage struct {
+	MaxRequests int      `json:"max_requests,omitempty"`
+	MaxSeconds  float64  `json:"max_seconds,omitempty"`
+	Requests    int      `json:"requests"`
+	Bytes       int64    `json:"bytes"`   // response bodies read
+	Seconds     float64  `json:"seconds"` // summed over requests, including concurrent ones
+	Exhausted   bool     `json:"exhausted,omitempty"`
+	Skipped     int      `json:"skipped,omitempty"`
+	SkippedURLs []string `json:"skipped_urls,omitempty"`
+}
+
+// outboundBudget counts the requests and request time of one analysis. Checks
+// already in flight when the budget runs out are allowed to finish.
+type outboundBudget struct {
+	mu          sync.Mutex
+	maxRequests int
+	maxTime     time.Duration
+	requests    int
+	bytes       int64
+	spent       time.Duration
+	skipped     int
+	skippedURLs []string
+}
+
+type outboundBudgetKey struct{}
+
+// withOutboundBudget attaches a budget to the context of an analysis
+func withOutboundBudget(ctx context.Context, budget *outboundBudget) context.Context {
+	return context.WithValue(ctx, outboundBudgetKey{}, budget)
+}
+
+// outboundBudgetFrom returns the budget of the analysis a request belongs to, if any
+func outboundBudgetFrom(ctx context.Context) *outboundBudget {
+	budget, _ := ctx.Value(outboundBudgetKey{}).(*outboundBudget)
+	return budget
+}
+
+// exhaustedLocked reports whether either limit has been reached; the caller must hold the lock
+func (b *outboundBudget) exhaustedLocked() bool {
+	return (b.maxRequests > 0 && b.requests >= b.maxRequests) ||
+		(b.maxTime > 0 && b.spent >= b.maxTime)
+}
+
+// acquire charges one request to the budget, or records target as skipped and
+// returns errOutboundBudgetExhausted when the budget is used up
+func (b *outboundBudget) acquire(target string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.exhaustedLocked() {
+		b.skipped++
+		if len(b.skippedURLs) < MaxReportedSkippedURLs {
+			b.skippedURLs = append(b.skippedURLs, target)
+		}
+		return errOutboundBudgetExhausted
+	}
+	b.requests++
+	return nil
+}
+
+// record charges the time a request took
+func (b *outboundBudget) record(elapsed time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.spent += elapsed
+}
+
+// addBytes charges response body bytes read
+func (b *outboundBudget) addBytes(n int) {
+	if n <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bytes += int64(n)
+}
+
+// usage reports what the analysis used of its budget
+func (b *outboundBudget) usage() *OutboundUsage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return &OutboundUsage{
+		MaxRequests: b.maxRequests,
+		MaxSeconds:  b.maxTime.Seconds(),
+		Requests:    b.requests,
+		Bytes:       b.bytes,
+		Seconds:     b.spent.Seconds(),
+		Exhausted:   b.skipped > 0,
+		Skipped:     b.skipped,
+		SkippedURLs: append([]string(nil), b.skippedURLs...),
+	}
+}
+
+// SetOutboundBudget caps the outbound requests a single analysis may make, by
+// count and by summed request time, covering the page fetch, link checks and
+// probes. Zero leaves a limit off.
+func (a *Analyzer) SetOutboundBudget(maxRequests int, maxTime time.Duration) {
+	a.maxOutboundRequests = maxRequests
+	a.maxOutboundTime = maxTime
+}
+
+// newOutboundBudget creates a budget with the analyzer's limits
+func (a *Analyzer) newOutboundBudget() *outboundBudget {
+	return &outboundBudget{maxRequests: a.maxOutboundRequests, maxTime: a.maxOutboundTime}
+}
@@ -0,0 +1,206 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// PageSpeedEndpoint is the PageSpeed Insights v5 API
+const PageSpeedEndpoint = "https://www.googleapis.com/pagespeedonline/v5/runPagespeed"
+
+// PageSpeedStrategy is the device PageSpeed Insights is queried for; Google
+// ranks pages by their mobile experience
+const PageSpeedStrategy = "mobile"
+
+// PageSpeedReport merges PageSpeed Insights data for the analyzed URL: the
+// Chrome UX Report field data of real visits and the Lighthouse lab score
+type PageSpeedReport struct {
+	Strategy         string `json:"strategy"`
+	PerformanceScore *int   `json:"performance_score,omitempty"` // Lighthouse lab score, 0-100
+	// FieldData is the URL's own field data, OriginFieldData that of the whole
+	// origin; either is omitted when too few visits were recorded
+	FieldData       *CoreWebVitals `json:"field_data,omitempty"`
+	OriginFieldData *CoreWebVitals `json:"origin_field_data,omitempty"`
+	Error           string         `json:"error,omitempty"`
+}
+
+// CoreWebVitals are the 75th percentile values of real visits over the last 28 days
+type CoreWebVitals struct {
+	OverallCategory string          `json:"overall_category,omitempty"` // FAST, AVERAGE or SLOW
+	LCP             *WebVitalMetric `json:"lcp,omitempty"`              // largest contentful paint, ms
+	INP             *WebVitalMetric `json:"inp,omitempty"`              // interaction to next paint, ms
+	CLS             *WebVitalMetric `json:"cls,omitempty"`              // cumulative layout shift
+	FCP             *WebVitalMetric `json:"fcp,omitempty"`              // first contentful paint, ms
+	TTFB            *WebVitalMetric `json:"ttfb,omitempty"`             // time to first byte, ms
+}
+
+// WebVitalMetric is a metric's 75th percentile and how Google rates it
+type WebVitalMetric struct {
+	P75      float64 `json:"p75"`
+	Category string  `json:"category"` // FAST, AVERAGE or SLOW
+}
+
+// PageSpeedClient queries PageSpeed Insights and caches the reports, as field
+// data is updated daily and Lighthouse runs take many seconds
+type PageSpeedClient struct {
+	endpoint   string
+	key        string
+	httpClient *http.Client
+	cacheTTL   time.Duration
+
+	mu    sync.Mutex
+	cache map[string]pageSpeedCacheEntry
+}
+
+// pageSpeedCacheEntry holds a cached report
+type pageSpeedCacheEntry struct {
+	report    *PageSpeedReport
+	expiresAt time.Time
+}
+
+// NewPageSpeedClient creates a PageSpeed Insights client using the given API key
+func NewPageSpeedClient(endpoint, key string) *PageSpeedClient {
+	return &PageSpeedClient{
+		endpoint:   endpoint,
+		key:        key,
+		httpClient: &http.Client{Timeout: PageSpeedTimeout},
+		cacheTTL:   PageSpeedCacheTTL,
+		cache:      make(map[string]pageSpeedCacheEntry),
+	}
+}
+
+// SetPageSpeedKey enables PageSpeed Insights lookups with the given API key;
+// an empty key disables them
+func (a *Analyzer) SetPageSpeedKey(key string) {
+	if key == "" {
+		a.pageSpeed = nil
+		return
+	}
+	a.pageSpeed = NewPageSpeedClient(PageSpeedEndpoint, key)
+}
+
+// PageSpeedEnabled reports whether PageSpeed Insights lookups are configured
+func (a *Analyzer) PageSpeedEnabled() bool {
+	return a.pageSpeed != nil
+}
+
+// pageSpeedMetric is a field data metric in a PageSpeed Insights response
+type pageSpeedMetric struct {
+	Percentile float64 `json:"percentile"`
+	Category   string  `json:"category"`
+}
+
+// pageSpeedExperience is the field data of a URL or origin
+type pageSpeedExperience struct {
+	Metrics         map[string]pageSpeedMetric `json:"metrics"`
+	OverallCategory string                     `json:"overall_category"`
+}
+
+// pageSpeedResponse is the subset of a PageSpeed Insights response used by the analyzer
+type pageSpeedResponse struct {
+	LoadingExperience       *pageSpeedExperience `json:"loadingExperience"`
+	OriginLoadingExperience *pageSpeedExperience `json:"originLoadingExperience"`
+	LighthouseResult        struct {
+		Categories struct {
+			Performance *struct {
+				Score *float64 `json:"score"`
+			} `json:"performance"`
+		} `json:"categories"`
+	} `json:"lighthouseResult"`
+}
+
+// Lookup returns the PageSpeed Insights report for pageURL. Failed lookups are
+// reported in the report's Error and not cached, so they are retried next time.
+func (c *PageSpeedClient) Lookup(ctx context.Context, pageURL string) *PageSpeedReport {
+	c.mu.Lock()
+	entry, ok := c.cache[pageURL]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.report
+	}
+
+	report, err := c.fetch(ctx, pageURL)
+	if err != nil {
+		return &PageSpeedReport{Strategy: PageSpeedStrategy, Error: err.Error()}
+	}
+
+	c.mu.Lock()
+	c.cache[pageURL] = pageSpeedCacheEntry{report: report, expiresAt: time.Now().Add(c.cacheTTL)}
+	c.mu.Unlock()
+	return report
+}
+
+// fetch runs PageSpeed Insights for pageURL
+func (c *PageSpeedClient) fetch(ctx context.Context, pageURL string) (*PageSpeedReport, error) {
+	query := url.Values{
+		"url":      {pageURL},
+		"category": {"performance"},
+		"strategy": {PageSpeedStrategy},
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", c.endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	// The key is sent as a header so it never appears in reported request errors
+	req.Header.Set("X-Goog-Api-Key", c.key)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("PageSpeed Insights lookup failed: HTTP %d", resp.StatusCode)
+	}
+
+	var data pageSpeedResponse
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+	return parsePageSpeed(&data), nil
+}
+
+// parsePageSpeed converts a PageSpeed Insights response into a report
+func parsePageSpeed(data *pageSpeedResponse) *PageSpeedReport {
+	report := &PageSpeedReport{
+		Strategy:        PageSpeedStrategy,
+		FieldData:       coreWebVitals(data.LoadingExperience),
+		OriginFieldData: coreWebVitals(data.OriginLoadingExperience),
+	}
+	if performance := data.LighthouseResult.Categories.Performance; performance != nil && performance.Score != nil {
+		score := int(math.Round(*performance.Score * 100))
+		report.PerformanceScore = &score
+	}
+	return report
+}
+
+// coreWebVitals extracts the Core Web Vitals from field data, or returns nil
+// when there is none
+func coreWebVitals(experience *pageSpeedExperience) *CoreWebVitals {
+	if experience == nil || len(experience.Metrics) == 0 {
+		return nil
+	}
+	metric := func(name string, scale float64) *WebVitalMetric {
+		m, ok := experience.Metrics[name]
+		if !ok {
+			return nil
+		}
+		return &WebVitalMetric{P75: m.Percentile / scale, Category: m.Category}
+	}
+	// Layout shift is reported multiplied by 100
+	return &CoreWebVitals{
+		OverallCategory: experience.OverallCategory,
+		LCP:             metric("LARGEST_CONTENTFUL_PAINT_MS", 1),
+		INP:             metric("INTERACTION_TO_NEXT_PAINT", 1),
+		CLS:             metric("CUMULATIVE_LAYOUT_SHIFT_SCORE", 100),
+		FCP:             metric("FIRST_CONTENTFUL_PAINT_MS", 1),
+		TTFB:            metric("EXPERIMENTAL_TIME_TO_FIRST_BYTE", 1),
+	}
+}
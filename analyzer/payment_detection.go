@@ -0,0 +1,138 @@
+package analyzer
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Payment card field kinds
+const (
+	CardFieldNumber = "card_number"
+	CardFieldExpiry = "expiry"
+	CardFieldCVC    = "cvc"
+	CardFieldHolder = "cardholder"
+)
+
+// paymentProviders lists embedded payment providers
+var paymentProviders = []thirdPartySignature{
+	{name: "Stripe", sources: []string{"js.stripe.com"}},
+	{name: "PayPal", sources: []string{"paypal.com/sdk/js", "paypalobjects.com"}},
+	{name: "Braintree", sources: []string{"js.braintreegateway.com"}},
+	{name: "Square", sources: []string{"web.squarecdn.com", "js.squareup.com"}},
+	{name: "Adyen", sources: []string{"checkoutshopper-live.adyen.com", "checkoutshopper-test.adyen.com"}},
+	{name: "Checkout.com", sources: []string{"cdn.checkout.com"}},
+}
+
+// cardFieldAutocomplete maps autocomplete tokens to card field kinds
+var cardFieldAutocomplete = map[string]string{
+	"cc-number": CardFieldNumber,
+	"cc-exp":    CardFieldExpiry, "cc-exp-month": CardFieldExpiry, "cc-exp-year": CardFieldExpiry,
+	"cc-csc":  CardFieldCVC,
+	"cc-name": CardFieldHolder,
+}
+
+// cardFieldPatterns maps substrings of input names and ids to card field kinds
+var cardFieldPatterns = []struct {
+	pattern string
+	kind    string
+}{
+	{"cardnumber", CardFieldNumber}, {"card_number", CardFieldNumber}, {"card-number", CardFieldNumber},
+	{"ccnumber", CardFieldNumber}, {"cc_number", CardFieldNumber}, {"ccnum", CardFieldNumber},
+	{"cvc", CardFieldCVC}, {"cvv", CardFieldCVC}, {"csc", CardFieldCVC}, {"securitycode", CardFieldCVC},
+	{"expiry", CardFieldExpiry}, {"expdate", CardFieldExpiry}, {"exp_date", CardFieldExpiry}, {"exp-date", CardFieldExpiry},
+	{"cardholder", CardFieldHolder}, {"nameoncard", CardFieldHolder}, {"name_on_card", CardFieldHolder},
+}
+
+// detectPaymentForms finds credit-card forms and payment provider embeds and flags
+// any that would send card data over plain HTTP
+func (a *Analyzer) detectPaymentForms(doc *html.Node, baseURL *url.URL) *PaymentInfo {
+	info := &PaymentInfo{}
+	for _, match := range matchThirdParties(doc, paymentProviders) {
+		info.Providers = append(info.Providers, match.name)
+	}
+
+	traverser := NewHTMLTraverser()
+	traverser.TraverseElements(doc, "form", func(n *html.Node) {
+		fields := cardFields(traverser, n)
+		if !isPaymentForm(fields) {
+			return
+		}
+
+		action := baseURL
+		if value := strings.TrimSpace(traverser.GetAttributeValue(n, "action")); value != "" {
+			if parsed, err := url.Parse(value); err == nil {
+				action = baseURL.ResolveReference(parsed)
+			}
+		}
+
+		info.Forms = append(info.Forms, PaymentForm{
+			Action: action.String(),
+			Fields: fields,
+			Secure: action.Scheme == "https",
+		})
+	})
+
+	if len(info.Forms) == 0 && len(info.Providers) == 0 {
+		return nil
+	}
+	info.Findings = paymentFindings(info, baseURL)
+	return info
+}
+
+// cardFields returns the card field kinds present in a form
+func cardFields(traverser *HTMLTraverser, form *html.Node) []string {
+	var fields []string
+	traverser.TraverseElements(form, "input", func(n *html.Node) {
+		for _, token := range strings.Fields(strings.ToLower(traverser.GetAttributeValue(n, "autocomplete"))) {
+			if kind, ok := cardFieldAutocomplete[token]; ok {
+				fields = appendUnique(fields, kind)
+			}
+		}
+
+		names := strings.ToLower(traverser.GetAttributeValue(n, "name") + " " + traverser.GetAttributeValue(n, "id"))
+		for _, p := range cardFieldPatterns {
+			if strings.Contains(names, p.pattern) {
+				fields = appendUnique(fields, p.kind)
+			}
+		}
+	})
+	return fields
+}
+
+// isPaymentForm reports whether the detected fields amount to a card form
+func isPaymentForm(fields []string) bool {
+	hasNumber := false
+	for _, field := range fields {
+		if field == CardFieldNumber {
+			hasNumber = true
+		}
+	}
+	return hasNumber || len(fields) >= 2
+}
+
+// paymentFindings flags card data collected or submitted without TLS
+func paymentFindings(info *PaymentInfo, baseURL *url.URL) []Finding {
+	var findings []Finding
+
+	if baseURL.Scheme != "https" {
+		findings = append(findings, Finding{
+			Severity: SeverityHigh,
+			Subject:  baseURL.String(),
+			Message:  "Payment details are collected on a page served over plain HTTP",
+		})
+	}
+	for _, form := range info.Forms {
+		if !form.Secure {
+			findings = append(findings, Finding{
+				Severity: SeverityHigh,
+				Subject:  form.Action,
+				Message:  fmt.Sprintf("Payment form submits card data (%s) over plain HTTP", strings.Join(form.Fields, ", ")),
+			})
+		}
+	}
+
+	return findings
+}
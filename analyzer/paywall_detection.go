@@ -0,0 +1,157 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"mime"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// paywallVendors lists common paywall, metering and subscription services
+var paywallVendors = []thirdPartySignature{
+	{
+		name:    "Piano",
+		sources: []string{"cdn.tinypass.com", "experience.tinypass.com", "cdn.piano.io"},
+		inline:  []string{"tp.push(", "window.tp ="},
+	},
+	{
+		name:    "Zephr",
+		sources: []string{"zephr"},
+		markers: []string{"zephr-feature"},
+	},
+	{
+		name:    "Poool",
+		sources: []string{"assets.poool.fr"},
+		markers: []string{"poool-widget"},
+	},
+	{
+		name:    "Pelcro",
+		sources: []string{"js.pelcro.com"},
+	},
+	{
+		name:    "Memberful",
+		sources: []string{"memberful.com/embed.js"},
+	},
+	{
+		name:    "LaterPay",
+		sources: []string{"laterpay.net"},
+	},
+	{
+		name:    "Steady",
+		sources: []string{"steadyhq.com"},
+	},
+	{
+		name:    "Leaky Paywall",
+		markers: []string{"leaky_paywall_message_wrap"},
+	},
+	{
+		name:    "Subscribe with Google",
+		sources: []string{"news.google.com/swg/"},
+	},
+}
+
+// paywallTokens are id and class tokens of paywall and registration-wall markup
+var paywallTokens = []string{
+	"paywall", "regwall", "registration-wall", "register-wall", "subscriber-only", "subscribers-only",
+	"premium-content", "locked-content", "meter-wall", "article-gate",
+}
+
+// detectPaywall reports paywall and registration-wall markup, paywall vendors
+// and the schema.org isAccessibleForFree markers of the page, and whether its
+// content is likely gated. isAccessibleForFree is the publisher's own statement
+// and decides when present; otherwise a paywall element or vendor marks the
+// content as gated. It returns nil when none are found.
+func (a *Analyzer) detectPaywall(doc *html.Node) *PaywallInfo {
+	info := &PaywallInfo{}
+	for _, match := range matchThirdParties(doc, paywallVendors) {
+		info.Vendors = append(info.Vendors, match.name)
+		info.Evidence = append(info.Evidence, match.evidence...)
+	}
+
+	markup := false
+	traverser := NewHTMLTraverser()
+	traverser.TraverseAllElements(doc, func(n *html.Node) {
+		names := strings.ToLower(traverser.GetAttributeValue(n, "id") + " " + traverser.GetAttributeValue(n, "class"))
+		for _, name := range strings.Fields(names) {
+			for _, token := range paywallTokens {
+				if strings.Contains(name, token) {
+					markup = true
+					info.Evidence = appendUnique(info.Evidence, "element:"+token)
+				}
+			}
+		}
+	})
+
+	for _, item := range schemaItems(doc) {
+		if free, ok := schemaBool(item["isAccessibleForFree"]); ok {
+			info.setAccessibleForFree(free)
+		}
+		// Gated parts of free-to-read pages name their elements by CSS selector
+		for _, part := range objects(item["hasPart"]) {
+			if free, ok := schemaBool(part["isAccessibleForFree"]); ok && !free {
+				info.setAccessibleForFree(false)
+				if selector, ok := part["cssSelector"].(string); ok && selector != "" {
+					info.GatedSections = appendUnique(info.GatedSections, selector)
+				}
+			}
+		}
+	}
+
+	if info.AccessibleForFree == nil && len(info.Evidence) == 0 {
+		return nil
+	}
+	if info.AccessibleForFree != nil {
+		info.Evidence = appendUnique(info.Evidence, "schema:isAccessibleForFree")
+		info.LikelyGated = !*info.AccessibleForFree
+	} else {
+		info.LikelyGated = markup || len(info.Vendors) > 0
+	}
+	return info
+}
+
+// setAccessibleForFree records an isAccessibleForFree value; any gated item or
+// part makes the page gated
+func (info *PaywallInfo) setAccessibleForFree(free bool) {
+	if info.AccessibleForFree == nil || !free {
+		info.AccessibleForFree = &free
+	}
+}
+
+// schemaItems returns the schema.org items of the page's JSON-LD blocks and
+// microdata and RDFa markup, skipping blocks that fail to parse
+func schemaItems(doc *html.Node) []map[string]any {
+	var items []map[string]any
+	traverser := NewHTMLTraverser()
+	traverser.TraverseElements(doc, "script", func(node *html.Node) {
+		mediaType, _, _ := mime.ParseMediaType(traverser.GetAttributeValue(node, "type"))
+		if mediaType != "application/ld+json" || node.FirstChild == nil {
+			return
+		}
+		var value any
+		if json.Unmarshal([]byte(strings.TrimSpace(node.FirstChild.Data)), &value) == nil {
+			items = append(items, jsonLDItems(value)...)
+		}
+	})
+	for _, format := range markupFormats {
+		items = append(items, format.items(doc)...)
+	}
+	return items
+}
+
+// schemaBool reads a schema.org Boolean, given as a JSON boolean or as the text
+// True or False, with or without the schema.org vocabulary
+func schemaBool(value any) (bool, bool) {
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	case string:
+		switch strings.ToLower(schemaName(strings.TrimSpace(v))) {
+		case "true":
+			return true, true
+		case "false":
+			return false, true
+		}
+	}
+	return false, false
+}
@@ -0,0 +1,147 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"plugin"
+	"sort"
+	"sync"
+	"time"
+
+	"web-page-analyzer/logger"
+
+	"golang.org/x/net/html"
+)
+
+// PluginSymbol is the exported variable a plugin shared object must define,
+// of type AnalysisPlugin or *AnalysisPlugin
+const PluginSymbol = "Plugin"
+
+// AnalysisPlugin is a custom check run against every successfully fetched page.
+// Plugins must treat doc, resp and result as read-only; the response body has
+// already been consumed, so work from doc. Findings are reported under the
+// plugin's name in AnalysisResult.Plugins.
+type AnalysisPlugin interface {
+	Name() string
+	Analyze(ctx context.Context, doc *html.Node, resp *http.Response, result *AnalysisResult) ([]PluginFinding, error)
+}
+
+var (
+	pluginsMu         sync.Mutex
+	registeredPlugins = make(map[string]AnalysisPlugin)
+)
+
+// RegisterPlugin makes a compiled-in plugin available to every analyzer created
+// afterwards, typically from the plugin package's init function. It panics if
+// the name is empty or already registered.
+func RegisterPlugin(p AnalysisPlugin) {
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+
+	name := p.Name()
+	if name == "" {
+		panic("analyzer: plugin name is empty")
+	}
+	if _, dup := registeredPlugins[name]; dup {
+		panic("analyzer: RegisterPlugin called twice for plugin " + name)
+	}
+	registeredPlugins[name] = p
+}
+
+// registered returns the registered plugins sorted by name
+func registered() []AnalysisPlugin {
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+
+	plugins := make([]AnalysisPlugin, 0, len(registeredPlugins))
+	for _, p := range registeredPlugins {
+		plugins = append(plugins, p)
+	}
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].Name() < plugins[j].Name() })
+	return plugins
+}
+
+// AddPlugin adds a plugin to this analyzer only
+func (a *Analyzer) AddPlugin(p AnalysisPlugin) {
+	a.plugins = append(a.plugins, p)
+}
+
+// Plugins returns the names of the plugins this analyzer runs
+func (a *Analyzer) Plugins() []string {
+	names := make([]string, len(a.plugins))
+	for i, p := range a.plugins {
+		names[i] = p.Name()
+	}
+	return names
+}
+
+// LoadPlugins opens every .so file in dir built with `go build -buildmode=plugin`
+// and returns the AnalysisPlugin each exports as PluginSymbol. Plugins must be
+// built with the same Go version and module versions as the server.
+func LoadPlugins(dir string) ([]AnalysisPlugin, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.so"))
+	if err != nil {
+		return nil, err
+	}
+
+	var plugins []AnalysisPlugin
+	for _, path := range paths {
+		lib, err := plugin.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("opening plugin %s: %w", path, err)
+		}
+		symbol, err := lib.Lookup(PluginSymbol)
+		if err != nil {
+			return nil, fmt.Errorf("plugin %s: %w", path, err)
+		}
+
+		switch p := symbol.(type) {
+		case AnalysisPlugin:
+			plugins = append(plugins, p)
+		case *AnalysisPlugin:
+			plugins = append(plugins, *p)
+		default:
+			return nil, fmt.Errorf("plugin %s: %s does not implement AnalysisPlugin", path, PluginSymbol)
+		}
+	}
+	return plugins, nil
+}
+
+// runPlugins runs each plugin with its own timeout, isolating failures and panics
+func (a *Analyzer) runPlugins(ctx context.Context, doc *html.Node, resp *http.Response, result *AnalysisResult) {
+	for _, p := range a.plugins {
+		result.Plugins = append(result.Plugins, a.runPlugin(ctx, p, doc, resp, result))
+	}
+}
+
+// runPlugin runs a single plugin and reports its findings or error
+func (a *Analyzer) runPlugin(ctx context.Context, p AnalysisPlugin, doc *html.Node, resp *http.Response, result *AnalysisResult) (report PluginReport) {
+	report.Plugin = p.Name()
+	start := time.Now()
+
+	pluginCtx, cancel := context.WithTimeout(ctx, PluginTimeout)
+	defer cancel()
+
+	defer func() {
+		if r := recover(); r != nil {
+			report.Findings = nil
+			report.Error = fmt.Sprintf("plugin panicked: %v", r)
+			logger.WithAnalysis(result.URL).Errorw("Analysis plugin panicked", "plugin", report.Plugin, "panic", r)
+		}
+		report.DurationMs = time.Since(start).Milliseconds()
+	}()
+
+	findings, err := p.Analyze(pluginCtx, doc, resp, result)
+	if err != nil {
+		report.Error = err.Error()
+		logger.WithAnalysis(result.URL).Warnw("Analysis plugin failed", "plugin", report.Plugin, "error", err)
+	}
+	report.Findings = findings
+	return report
+}
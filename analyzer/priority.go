@@ -0,0 +1,141 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Priority orders analyses competing for link-check capacity
+type Priority int
+
+// Analysis priorities; the zero value is interactive
+const (
+	// PriorityInteractive is for requests someone is waiting on, such as the UI
+	PriorityInteractive Priority = iota
+	// PriorityBatch is for crawls, schedules and bulk API work, which yield
+	// link-check capacity to interactive analyses
+	PriorityBatch
+)
+
+// String returns the name of the priority as used in request parameters
+func (p Priority) String() string {
+	if p == PriorityBatch {
+		return "batch"
+	}
+	return "interactive"
+}
+
+// ParsePriority parses a priority parameter; empty means interactive
+func ParsePriority(value string) (Priority, error) {
+	switch value {
+	case "", "interactive":
+		return PriorityInteractive, nil
+	case "batch":
+		return PriorityBatch, nil
+	}
+	return PriorityInteractive, fmt.Errorf("priority must be interactive or batch")
+}
+
+type priorityKey struct{}
+
+// withPriority returns a context whose link checks run at priority
+func withPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// priorityFrom returns the priority of the analysis ctx belongs to
+func priorityFrom(ctx context.Context) Priority {
+	priority, _ := ctx.Value(priorityKey{}).(Priority)
+	return priority
+}
+
+// priorityGate lets interactive analyses take link-check capacity from batch
+// ones: while any interactive analysis runs, batch link checks across all
+// analyses are limited to BatchLinkChecksWhileInteractive at once, and batch
+// workers wait for a turn instead of competing for connections and host rate
+// limits. Checks already under way are not interrupted.
+type priorityGate struct {
+	mu          sync.Mutex
+	interactive int           // interactive analyses running
+	batch       int           // batch link checks running
+	changed     chan struct{} // closed whenever a batch check may be admitted
+}
+
+// newPriorityGate creates a gate with no analyses running
+func newPriorityGate() *priorityGate {
+	return &priorityGate{changed: make(chan struct{})}
+}
+
+// enter records an analysis starting at priority and returns the func to call
+// when it finishes
+func (g *priorityGate) enter(priority Priority) func() {
+	if priority != PriorityInteractive {
+		return func() {}
+	}
+	g.mu.Lock()
+	g.interactive++
+	g.mu.Unlock()
+	return func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		g.interactive--
+		g.notify()
+	}
+}
+
+// admit waits until a link check of the analysis ctx belongs to may run, and
+// returns the func to call once it has
+func (g *priorityGate) admit(ctx context.Context) (func(), error) {
+	if priorityFrom(ctx) != PriorityBatch {
+		return func() {}, nil
+	}
+	for {
+		g.mu.Lock()
+		if g.interactive == 0 || g.batch < BatchLinkChecksWhileInteractive {
+			g.batch++
+			g.mu.Unlock()
+			return g.release, nil
+		}
+		changed := g.changed
+		g.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// release ends a batch link check
+func (g *priorityGate) release() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.batch--
+	g.notify()
+}
+
+// notify wakes the batch checks waiting for a turn; the caller must hold the lock
+func (g *priorityGate) notify() {
+	close(g.changed)
+	g.changed = make(chan struct{})
+}
+
+// PriorityStats reports how analyses are sharing link-check capacity
+type PriorityStats struct {
+	InteractiveAnalyses int `json:"interactive_analyses"`
+	BatchLinkChecks     int `json:"batch_link_checks"`
+}
+
+// stats returns the current gate state
+func (g *priorityGate) stats() PriorityStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return PriorityStats{InteractiveAnalyses: g.interactive, BatchLinkChecks: g.batch}
+}
+
+// PriorityStats reports the interactive analyses running and the batch link checks under way
+func (a *Analyzer) PriorityStats() PriorityStats {
+	return a.priorities.stats()
+}
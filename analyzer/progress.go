@@ -0,0 +1,45 @@
+package analyzer
+
+import "context"
+
+// Progress stages reported while a page is analyzed
+const (
+	ProgressFetched  = "fetched"
+	ProgressParsed   = "parsed"
+	ProgressDocument = "document"
+	ProgressLinks    = "links"
+)
+
+// Progress is one step of an analysis in flight
+type Progress struct {
+	Stage string `json:"stage"`
+	// StatusCode and FinalURL describe the response once fetched
+	StatusCode int    `json:"status_code,omitempty"`
+	FinalURL   string `json:"final_url,omitempty"`
+	// ContentLength is the size of the parsed document
+	ContentLength int64 `json:"content_length,omitempty"`
+	// PageTitle, HTMLVersion and HeadingCounts are known before links are checked
+	PageTitle     string         `json:"page_title,omitempty"`
+	HTMLVersion   string         `json:"html_version,omitempty"`
+	HeadingCounts map[string]int `json:"heading_counts,omitempty"`
+	// LinksChecked of LinksTotal links have been checked
+	LinksChecked int `json:"links_checked"`
+	LinksTotal   int `json:"links_total"`
+}
+
+type progressKey struct{}
+
+// WithProgress returns a context whose analysis reports its progress to report.
+// Analyses answered from the cache or shared with a concurrent request for the
+// same page report no progress. report may be called after the request has gone
+// away, and should return quickly, as link checking waits for it.
+func WithProgress(ctx context.Context, report func(Progress)) context.Context {
+	return context.WithValue(ctx, progressKey{}, report)
+}
+
+// reportProgress passes progress to the reporter of the analysis ctx belongs to, if any
+func reportProgress(ctx context.Context, progress Progress) {
+	if report, ok := ctx.Value(progressKey{}).(func(Progress)); ok {
+		report(progress)
+	}
+}
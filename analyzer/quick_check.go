@@ -0,0 +1,64 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"web-page-analyzer/logger"
+)
+
+// MaxRedirects is the maximum number of redirects followed before giving up
+const MaxRedirects = 10
+
+// performQuickCheck issues a single HEAD request and records reachability, the redirect
+// chain, response headers and TLS details without downloading or parsing the body
+func (a *Analyzer) performQuickCheck(ctx context.Context, parsedURL *url.URL, result *AnalysisResult) error {
+	check := &QuickCheckResult{}
+	result.QuickCheck = check
+
+	req, err := http.NewRequestWithContext(ctx, "HEAD", parsedURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	setBrowserHeaders(req)
+
+	client := &http.Client{
+		Timeout:   a.timeout,
+		Transport: a.httpClient.Transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			check.RedirectChain = append(check.RedirectChain, RedirectHop{
+				URL:        via[len(via)-1].URL.String(),
+				StatusCode: req.Response.StatusCode,
+			})
+			if len(via) >= MaxRedirects {
+				return errors.New("stopped after too many redirects")
+			}
+			return nil
+		},
+	}
+
+	result.FetchedAt = time.Now().UTC()
+	stopFetch := timePhase(ctx, phaseFetch)
+	resp, err := client.Do(req)
+	stopFetch()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			logger.WithAnalysis(parsedURL.String()).Warnw("Failed to close response body", "error", closeErr)
+		}
+	}()
+
+	result.FinalURL = resp.Request.URL.String()
+	result.StatusCode = resp.StatusCode
+	check.Reachable = resp.StatusCode < 400
+	check.Headers = resp.Header
+	check.TLS = tlsInfo(resp.TLS)
+	result.CDN = a.detectCDN(ctx, resp.Request.URL.Hostname(), resp.Header)
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"web-page-analyzer/tracing"
+)
+
+// ReanalyzeSnapshot runs the current content checks and plugins over the HTML
+// stored with previous, the result of an earlier analysis, without fetching the
+// page again. header is the response header stored with the HTML; when nil, as
+// for snapshots stored without one, the headers kept in previous are used. What was learned from the response and the live site (status,
+// final URL, headers, TLS, HTTPS readiness, CDN, variants, domain and
+// robots.txt findings) is carried over from previous; everything read from the
+// HTML is analyzed anew. Quick mode and the options querying the live site are
+// ignored. Links are still checked unless SkipLinkCheck is set.
+//
+// The result is neither cached nor published, since it does not describe a
+// fresh fetch of the page.
+func (a *Analyzer) ReanalyzeSnapshot(ctx context.Context, previous *AnalysisResult, snapshot []byte, header http.Header, opts AnalysisOptions) *AnalysisResult {
+	startTime := time.Now()
+	ctx, span := tracing.Start(ctx, "ReanalyzeSnapshot", tracing.KindInternal,
+		tracing.String("url.full", previous.URL),
+		tracing.String("analysis.priority", opts.Priority.String()),
+	)
+	defer span.End()
+	ctx = withPriority(ctx, opts.Priority)
+	defer a.priorities.enter(opts.Priority)()
+
+	result := &AnalysisResult{
+		URL:             previous.URL,
+		NormalizedURL:   previous.NormalizedURL,
+		HostUnicode:     previous.HostUnicode,
+		HostASCII:       previous.HostASCII,
+		FinalURL:        previous.FinalURL,
+		FetchedAt:       previous.FetchedAt,
+		ContentLength:   previous.ContentLength,
+		HeadingCounts:   make(map[string]int),
+		StatusCode:      previous.StatusCode,
+		RequestHeaders:  previous.RequestHeaders,
+		ResponseHeaders: previous.ResponseHeaders,
+		TLS:             previous.TLS,
+		HTTPSReadiness:  previous.HTTPSReadiness,
+		CDN:             previous.CDN,
+		Variants:        previous.Variants,
+		Domain:          previous.Domain,
+		Robots:          previous.Robots,
+	}
+
+	// Link checks are charged to the budget like those of a fresh analysis
+	budget := a.newOutboundBudget()
+	ctx = withOutboundBudget(ctx, budget)
+	timer := &phaseTimer{}
+	ctx = withPhaseTimer(ctx, timer)
+
+	if header == nil {
+		header = http.Header(previous.ResponseHeaders)
+	}
+	if err := a.analyzeSnapshot(ctx, snapshot, header, result, opts); err != nil && result.Error == nil {
+		result.Error = NewAnalysisError(ErrCodeParseError, "Failed to parse stored HTML").WithDetails(err.Error())
+	}
+	if result.Error != nil {
+		span.SetError(result.Error.Code + ": " + result.Error.Message)
+	}
+
+	result.Outbound = budget.usage()
+	result.AnalysisDurationMs = time.Since(startTime).Milliseconds()
+	result.Timings = timer.timings(time.Since(startTime))
+	a.metricsManager.recordCost(result.Outbound, result.Timings)
+	recordCost(ctx, result.Outbound)
+	return result
+}
+
+// analyzeSnapshot parses stored HTML and analyzes it as a response with the
+// status kept in result and the given headers
+func (a *Analyzer) analyzeSnapshot(ctx context.Context, snapshot []byte, header http.Header, result *AnalysisResult, opts AnalysisOptions) error {
+	parsedURL, err := a.normalizeURL(result.URL)
+	if err != nil {
+		return err
+	}
+	resp := &http.Response{
+		StatusCode: result.StatusCode,
+		Header:     header.Clone(),
+		Request:    &http.Request{Method: http.MethodGet, URL: parsedURL, Header: make(http.Header)},
+	}
+	if resp.Header == nil {
+		resp.Header = make(http.Header)
+	}
+	if finalURL, err := parsedURL.Parse(result.FinalURL); err == nil && result.FinalURL != "" {
+		resp.Request.URL = finalURL
+	}
+
+	stopParse := timePhase(ctx, phaseParse)
+	doc, err := html.Parse(bytes.NewReader(snapshot))
+	stopParse()
+	if err != nil {
+		return err
+	}
+	if doc == nil {
+		return fmt.Errorf("HTML parsing returned nil document")
+	}
+	source := string(snapshot)
+
+	if len(opts.Assertions) > 0 {
+		defer func() {
+			result.Assertions = evaluateAssertions(opts.Assertions, resp, doc, source)
+		}()
+	}
+	if a.reportMaintenancePage(parsedURL, resp, doc, result) {
+		return nil
+	}
+	a.analyzeContent(ctx, parsedURL, resp, doc, source, result, opts)
+	a.runPlugins(ctx, doc, resp, result)
+	return nil
+}
@@ -0,0 +1,248 @@
+package analyzer
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedisClient is a minimal Redis client speaking RESP over TCP. It implements
+// SharedStore so replicas can share rate limits and circuit breaker state.
+type RedisClient struct {
+	addr     string
+	password string
+	db       int
+	pool     chan *redisConn
+}
+
+// redisConn is a pooled connection with its buffered reader
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// redisError is an error reply from the server; the connection remains usable
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// NewRedisClient creates a client from a redis://[:password@]host[:port][/db] URL.
+// Connections are opened lazily, so an unreachable server surfaces on first use.
+func NewRedisClient(redisURL string) (*RedisClient, error) {
+	parsed, err := url.Parse(redisURL)
+	if err != nil || parsed.Scheme != "redis" || parsed.Hostname() == "" {
+		return nil, fmt.Errorf("invalid Redis URL %q, expected redis://[:password@]host[:port][/db]", redisURL)
+	}
+
+	addr := parsed.Host
+	if parsed.Port() == "" {
+		addr = net.JoinHostPort(parsed.Hostname(), "6379")
+	}
+	client := &RedisClient{addr: addr, pool: make(chan *redisConn, RedisPoolSize)}
+	if password, ok := parsed.User.Password(); ok {
+		client.password = password
+	}
+	if path := strings.Trim(parsed.Path, "/"); path != "" {
+		db, err := strconv.Atoi(path)
+		if err != nil || db < 0 {
+			return nil, fmt.Errorf("invalid Redis database %q", path)
+		}
+		client.db = db
+	}
+	return client, nil
+}
+
+// Do sends a command and returns its reply: a string, int64, nil, or []interface{}
+func (c *RedisClient) Do(ctx context.Context, args ...string) (interface{}, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, RedisTimeout)
+		defer cancel()
+	}
+
+	rc, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	deadline, _ := ctx.Deadline()
+	rc.conn.SetDeadline(deadline)
+
+	reply, err := rc.do(args...)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		// The connection is in an unknown state after an I/O error
+		rc.conn.Close()
+		return nil, err
+	}
+	c.put(rc)
+	return reply, err
+}
+
+// get takes an idle connection from the pool or dials a new one
+func (c *RedisClient) get(ctx context.Context) (*redisConn, error) {
+	select {
+	case rc := <-c.pool:
+		return rc, nil
+	default:
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+	rc := &redisConn{conn: conn, reader: bufio.NewReader(conn)}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	if c.password != "" {
+		if _, err := rc.do("AUTH", c.password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if c.db != 0 {
+		if _, err := rc.do("SELECT", strconv.Itoa(c.db)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return rc, nil
+}
+
+// put returns a connection to the pool, closing it when the pool is full
+func (c *RedisClient) put(rc *redisConn) {
+	select {
+	case c.pool <- rc:
+	default:
+		rc.conn.Close()
+	}
+}
+
+// Close closes the idle connections
+func (c *RedisClient) Close() {
+	for {
+		select {
+		case rc := <-c.pool:
+			rc.conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+// do writes a command as a RESP array of bulk strings and reads the reply
+func (rc *redisConn) do(args ...string) (interface{}, error) {
+	var command strings.Builder
+	fmt.Fprintf(&command, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&command, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(rc.conn, command.String()); err != nil {
+		return nil, err
+	}
+	return readRESP(rc.reader)
+}
+
+// readRESP reads one RESP reply
+func readRESP(reader *bufio.Reader) (interface{}, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		return string(data[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, count)
+		for i := range items {
+			if items[i], err = readRESP(reader); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
+
+// incrScript increments a counter and starts its expiry when the increment
+// created it in one step, so a failure in between cannot leave a counter that
+// never expires
+const incrScript = `local count = redis.call("INCR", KEYS[1]) if count == 1 then redis.call("PEXPIRE", KEYS[1], ARGV[1]) end return count`
+
+// Incr increments a counter, starting its expiry when the counter is created
+func (c *RedisClient) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	reply, err := c.Do(ctx, "EVAL", incrScript, "1", key, strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return 0, err
+	}
+	count, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected INCR reply %v", reply)
+	}
+	return count, nil
+}
+
+// Get returns a counter's value, or 0 when it does not exist
+func (c *RedisClient) Get(ctx context.Context, key string) (int64, error) {
+	reply, err := c.Do(ctx, "GET", key)
+	if err != nil || reply == nil {
+		return 0, err
+	}
+	value, ok := reply.(string)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected GET reply %v", reply)
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// Set stores a value that expires after ttl
+func (c *RedisClient) Set(ctx context.Context, key string, value int64, ttl time.Duration) error {
+	_, err := c.Do(ctx, "SET", key, strconv.FormatInt(value, 10), "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+// Delete removes a key
+func (c *RedisClient) Delete(ctx context.Context, key string) error {
+	_, err := c.Do(ctx, "DEL", key)
+	return err
+}
@@ -0,0 +1,116 @@
+package analyzer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// auditResponsiveImages reports srcset, sizes and <picture> usage, flagging
+// wide images without responsive variants and images without dimensions; it
+// returns nil when the page has no images
+func (a *Analyzer) auditResponsiveImages(doc *html.Node) *ResponsiveImageReport {
+	report := &ResponsiveImageReport{}
+	traverser := NewHTMLTraverser()
+
+	addFinding := func(severity, subject, message string) {
+		if len(report.Findings) < MaxResponsiveImageFindings {
+			report.Findings = append(report.Findings, Finding{Severity: severity, Subject: subject, Message: message})
+		}
+	}
+
+	traverser.TraverseElements(doc, "img", func(img *html.Node) {
+		src := strings.TrimSpace(traverser.GetAttributeValue(img, "src"))
+		srcset := strings.TrimSpace(traverser.GetAttributeValue(img, "srcset"))
+		if src == "" && srcset == "" {
+			return
+		}
+		report.Images++
+		subject := src
+		if subject == "" {
+			subject = srcset
+		}
+
+		// A <picture> offers variants through its <source srcset> elements
+		var sources []*html.Node
+		if picture := img.Parent; picture != nil && picture.Type == html.ElementNode && picture.Data == "picture" {
+			report.InPicture++
+			for c := picture.FirstChild; c != nil; c = c.NextSibling {
+				if c.Type == html.ElementNode && c.Data == "source" && traverser.GetAttributeValue(c, "srcset") != "" {
+					sources = append(sources, c)
+				}
+			}
+		}
+		if srcset != "" {
+			report.WithSrcset++
+		}
+
+		// Every srcset of the image and its sources needs valid descriptors, and sizes for width descriptors
+		for _, node := range append([]*html.Node{img}, sources...) {
+			set := traverser.GetAttributeValue(node, "srcset")
+			if set == "" {
+				continue
+			}
+			widths, err := parseSrcset(set)
+			if err != nil {
+				addFinding(SeverityMedium, subject, fmt.Sprintf("Invalid srcset: %v", err))
+				continue
+			}
+			if widths && strings.TrimSpace(traverser.GetAttributeValue(node, "sizes")) == "" {
+				addFinding(SeverityLow, subject, "srcset uses width descriptors without sizes, so browsers assume the image fills the viewport")
+			}
+		}
+
+		width, widthErr := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(traverser.GetAttributeValue(img, "width")), "px"))
+		_, heightErr := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(traverser.GetAttributeValue(img, "height")), "px"))
+		if widthErr != nil || heightErr != nil {
+			report.MissingDimensions++
+			addFinding(SeverityLow, subject, "Image has no width and height attributes, so no space is reserved and the layout shifts when it loads")
+		}
+		if widthErr == nil && width >= ResponsiveImageMinWidth && srcset == "" && len(sources) == 0 {
+			report.LargeWithoutVariants++
+			addFinding(SeverityMedium, subject, fmt.Sprintf("Image is %dpx wide but offers no srcset or <picture> variants for smaller screens", width))
+		}
+	})
+
+	if report.Images == 0 {
+		return nil
+	}
+	return report
+}
+
+// parseSrcset validates the candidates of a srcset attribute and reports
+// whether they use width (w) rather than pixel density (x) descriptors
+func parseSrcset(srcset string) (bool, error) {
+	widths, densities := 0, 0
+	for _, candidate := range strings.Split(srcset, ",") {
+		fields := strings.Fields(candidate)
+		switch len(fields) {
+		case 0:
+			continue // stray commas are ignored
+		case 1:
+			densities++ // a missing descriptor means 1x
+			continue
+		case 2:
+		default:
+			return false, fmt.Errorf("candidate %q has more than one descriptor", strings.TrimSpace(candidate))
+		}
+
+		descriptor := fields[1]
+		value, err := strconv.ParseFloat(descriptor[:len(descriptor)-1], 64)
+		switch {
+		case strings.HasSuffix(descriptor, "w") && err == nil && value > 0:
+			widths++
+		case strings.HasSuffix(descriptor, "x") && err == nil && value > 0:
+			densities++
+		default:
+			return false, fmt.Errorf("descriptor %q is neither a width nor a density", descriptor)
+		}
+	}
+	if widths > 0 && densities > 0 {
+		return false, fmt.Errorf("width and density descriptors are mixed")
+	}
+	return widths > 0, nil
+}
@@ -0,0 +1,104 @@
+package analyzer
+
+import (
+	"sort"
+	"strconv"
+)
+
+// FieldDiff is one field of two results, side by side
+type FieldDiff struct {
+	Field   string `json:"field"`
+	Before  string `json:"before"`
+	After   string `json:"after"`
+	Changed bool   `json:"changed"`
+}
+
+// ResultDiff compares two analysis results. Fields and Headings list every
+// compared value, changed or not, so they can be shown side by side.
+type ResultDiff struct {
+	Fields       []FieldDiff `json:"fields"`
+	Headings     []FieldDiff `json:"headings"`
+	LinksAdded   []string    `json:"links_added,omitempty"`
+	LinksRemoved []string    `json:"links_removed,omitempty"`
+	// LinksCompared is false unless both results list their links (collect_links)
+	LinksCompared bool `json:"links_compared"`
+}
+
+// Changes returns the number of changed fields, headings and links
+func (d *ResultDiff) Changes() int {
+	changes := len(d.LinksAdded) + len(d.LinksRemoved)
+	for _, fields := range [][]FieldDiff{d.Fields, d.Headings} {
+		for _, field := range fields {
+			if field.Changed {
+				changes++
+			}
+		}
+	}
+	return changes
+}
+
+// DiffResults compares two results field by field, heading level by heading
+// level, and by the links they list when both list them
+func DiffResults(before, after *AnalysisResult) ResultDiff {
+	var diff ResultDiff
+	add := func(fields *[]FieldDiff, field, old, current string) {
+		*fields = append(*fields, FieldDiff{Field: field, Before: old, After: current, Changed: old != current})
+	}
+	add(&diff.Fields, "url", before.URL, after.URL)
+	add(&diff.Fields, "final_url", before.FinalURL, after.FinalURL)
+	add(&diff.Fields, "status_code", strconv.Itoa(before.StatusCode), strconv.Itoa(after.StatusCode))
+	add(&diff.Fields, "error", errorCode(before), errorCode(after))
+	add(&diff.Fields, "page_title", before.PageTitle, after.PageTitle)
+	add(&diff.Fields, "html_version", before.HTMLVersion, after.HTMLVersion)
+	add(&diff.Fields, "content_length", strconv.FormatInt(before.ContentLength, 10), strconv.FormatInt(after.ContentLength, 10))
+	add(&diff.Fields, "has_login_form", strconv.FormatBool(before.HasLoginForm), strconv.FormatBool(after.HasLoginForm))
+	add(&diff.Fields, "internal_links", strconv.Itoa(before.InternalLinks), strconv.Itoa(after.InternalLinks))
+	add(&diff.Fields, "external_links", strconv.Itoa(before.ExternalLinks), strconv.Itoa(after.ExternalLinks))
+	add(&diff.Fields, "inaccessible_links", strconv.Itoa(before.InaccessibleLinks), strconv.Itoa(after.InaccessibleLinks))
+
+	levels := make(map[string]bool)
+	for level := range before.HeadingCounts {
+		levels[level] = true
+	}
+	for level := range after.HeadingCounts {
+		levels[level] = true
+	}
+	sortedLevels := make([]string, 0, len(levels))
+	for level := range levels {
+		sortedLevels = append(sortedLevels, level)
+	}
+	sort.Strings(sortedLevels)
+	for _, level := range sortedLevels {
+		add(&diff.Headings, level, strconv.Itoa(before.HeadingCounts[level]), strconv.Itoa(after.HeadingCounts[level]))
+	}
+
+	if before.Links != nil && after.Links != nil {
+		diff.LinksCompared = true
+		diff.LinksAdded = difference(after.Links, before.Links)
+		diff.LinksRemoved = difference(before.Links, after.Links)
+	}
+	return diff
+}
+
+// errorCode returns the code of a result's error, or "" when it succeeded
+func errorCode(result *AnalysisResult) string {
+	if result.Error == nil {
+		return ""
+	}
+	return result.Error.Code
+}
+
+// difference returns the entries of a that are not in b, in a's order
+func difference(a, b []string) []string {
+	present := make(map[string]bool, len(b))
+	for _, entry := range b {
+		present[entry] = true
+	}
+	var missing []string
+	for _, entry := range a {
+		if !present[entry] {
+			missing = append(missing, entry)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,232 @@
+package analyzer
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"web-page-analyzer/logger"
+)
+
+// HostThrottleStats reports how often a target host has rate limited our requests
+type HostThrottleStats struct {
+	Host            string    `json:"host"`
+	Throttled       int64     `json:"throttled"` // 429 responses received
+	Retried         int64     `json:"retried"`   // requests retried after waiting out Retry-After
+	GaveUp          int64     `json:"gave_up"`   // 429s returned because the wait did not fit the budget
+	WaitedMs        int64     `json:"waited_ms"`
+	LastRetryAfter  int64     `json:"last_retry_after_seconds"`
+	LastThrottledAt time.Time `json:"last_throttled_at"`
+}
+
+// hostThrottle is a host's throttling counters and the time its last Retry-After ends
+type hostThrottle struct {
+	stats HostThrottleStats
+	until time.Time
+}
+
+// throttleTracker records 429 responses per host and holds requests to a host
+// back until the Retry-After it sent has passed
+type throttleTracker struct {
+	mu     sync.Mutex
+	budget time.Duration
+	hosts  map[string]*hostThrottle
+}
+
+// newThrottleTracker creates a tracker letting each request wait up to budget
+func newThrottleTracker(budget time.Duration) *throttleTracker {
+	return &throttleTracker{budget: budget, hosts: make(map[string]*hostThrottle)}
+}
+
+// Budget returns the longest a single request may wait on Retry-After
+func (t *throttleTracker) Budget() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.budget
+}
+
+// SetBudget changes the longest a single request may wait on Retry-After
+func (t *throttleTracker) SetBudget(budget time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.budget = budget
+}
+
+// cooldown returns when requests to host may resume; the zero time means now
+func (t *throttleTracker) cooldown(host string) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if h, ok := t.hosts[host]; ok {
+		return h.until
+	}
+	return time.Time{}
+}
+
+// host returns a host's entry, creating it and evicting the least recently
+// throttled host when the table is full; the caller must hold the lock
+func (t *throttleTracker) host(name string) *hostThrottle {
+	if h, ok := t.hosts[name]; ok {
+		return h
+	}
+	if len(t.hosts) >= MaxThrottledHosts {
+		var oldest string
+		for candidate, h := range t.hosts {
+			if oldest == "" || h.stats.LastThrottledAt.Before(t.hosts[oldest].stats.LastThrottledAt) {
+				oldest = candidate
+			}
+		}
+		delete(t.hosts, oldest)
+	}
+	h := &hostThrottle{stats: HostThrottleStats{Host: name}}
+	t.hosts[name] = h
+	return h
+}
+
+// recordThrottle counts a 429 response and holds the host back for wait
+func (t *throttleTracker) recordThrottle(host string, wait time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	h := t.host(host)
+	h.stats.Throttled++
+	h.stats.LastRetryAfter = int64(wait / time.Second)
+	h.stats.LastThrottledAt = now.UTC()
+	if until := now.Add(wait); until.After(h.until) {
+		h.until = until
+	}
+}
+
+// recordWait counts time spent waiting for a host, and a retry when retried is set
+func (t *throttleTracker) recordWait(host string, waited time.Duration, retried bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h := t.host(host)
+	h.stats.WaitedMs += waited.Milliseconds()
+	if retried {
+		h.stats.Retried++
+	}
+}
+
+// recordGaveUp counts a 429 passed back to the caller without retrying
+func (t *throttleTracker) recordGaveUp(host string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.host(host).stats.GaveUp++
+}
+
+// Stats returns the throttled hosts, most throttled first
+func (t *throttleTracker) Stats() []HostThrottleStats {
+	t.mu.Lock()
+	stats := make([]HostThrottleStats, 0, len(t.hosts))
+	for _, h := range t.hosts {
+		stats = append(stats, h.stats)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Throttled != stats[j].Throttled {
+			return stats[i].Throttled > stats[j].Throttled
+		}
+		return stats[i].Host < stats[j].Host
+	})
+	return stats
+}
+
+// SetRetryAfterBudget sets the longest a single outbound request waits on 429
+// responses before the 429 is reported; zero never waits
+func (a *Analyzer) SetRetryAfterBudget(budget time.Duration) {
+	a.throttle.SetBudget(budget)
+}
+
+// retryAfterWait returns how long a 429 response asks us to wait
+func retryAfterWait(resp *http.Response) time.Duration {
+	if seconds, ok := ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+		return time.Duration(seconds) * time.Second
+	}
+	return DefaultRetryAfterWait
+}
+
+// canRetry reports whether the request may be resent after waiting: it must be
+// a bodiless GET or HEAD whose deadline leaves room for the wait
+func canRetry(req *http.Request, wait time.Duration) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		return false
+	}
+	if deadline, ok := req.Context().Deadline(); ok && time.Now().Add(wait).After(deadline) {
+		return false
+	}
+	return true
+}
+
+// sleepContext waits for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// roundTripHonoringRetryAfter sends req, waiting out any Retry-After the host is
+// under and retrying 429 responses while the waits fit the budget
+func (t *throttledTransport) roundTripHonoringRetryAfter(req *http.Request) (*http.Response, error) {
+	throttle := t.analyzer.throttle
+	host := req.URL.Hostname()
+	budget := throttle.Budget()
+	outbound := outboundBudgetFrom(req.Context())
+	var waited time.Duration
+
+	for attempt := 0; ; attempt++ {
+		// Requests started while the host's Retry-After is in force wait for it too
+		if wait := time.Until(throttle.cooldown(host)); wait > 0 && waited+wait <= budget && canRetry(req, wait) {
+			if err := sleepContext(req.Context(), wait); err != nil {
+				return nil, err
+			}
+			waited += wait
+			throttle.recordWait(host, wait, false)
+		}
+
+		if outbound != nil {
+			if err := outbound.acquire(req.URL.String()); err != nil {
+				return nil, err
+			}
+		}
+		sent := time.Now()
+		resp, err := t.next.RoundTrip(req)
+		if outbound != nil {
+			outbound.record(time.Since(sent))
+			if err == nil {
+				resp.Body = &countingBody{ReadCloser: resp.Body, budget: outbound}
+			}
+		}
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+			return resp, err
+		}
+
+		wait := retryAfterWait(resp)
+		throttle.recordThrottle(host, wait)
+		if attempt >= MaxRetryAfterAttempts || waited+wait > budget || !canRetry(req, wait) {
+			throttle.recordGaveUp(host)
+			logger.WithComponent("rate_limiter").Infow("Target host is rate limiting requests",
+				"host", host, "retry_after", wait, "waited", waited)
+			return resp, nil
+		}
+
+		resp.Body.Close()
+		if err := sleepContext(req.Context(), wait); err != nil {
+			return nil, err
+		}
+		waited += wait
+		throttle.recordWait(host, wait, true)
+	}
+}
@@ -0,0 +1,413 @@
+package analyzer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"web-page-analyzer/logger"
+
+	"golang.org/x/net/html"
+)
+
+// RobotsUserAgent is the crawler whose robots.txt group, meta tag and
+// X-Robots-Tag directives are checked; rules for * apply when it has none
+const RobotsUserAgent = "googlebot"
+
+// checkRobotsConsistency cross-checks the page's indexing directives against
+// robots.txt and the sitemaps it lists, reporting contradictions between them
+func (a *Analyzer) checkRobotsConsistency(ctx context.Context, parsedURL *url.URL, resp *http.Response, doc *html.Node) *RobotsReport {
+	pageURL := resp.Request.URL
+	report := &RobotsReport{
+		MetaRobots: metaRobotsDirectives(doc),
+		XRobotsTag: xRobotsTagDirectives(resp.Header),
+	}
+	report.Indexable = !hasNoindex(report.MetaRobots) && !hasNoindex(report.XRobotsTag)
+
+	// robots.txt applies per scheme and host
+	robotsURL := &url.URL{Scheme: pageURL.Scheme, Host: pageURL.Host, Path: "/robots.txt"}
+	report.RobotsTxtURL = robotsURL.String()
+	content, status, err := a.fetchRobotsResource(ctx, report.RobotsTxtURL, RobotsTxtBodyLimit)
+	report.RobotsTxtStatus = status
+
+	var sitemaps []string
+	switch {
+	case err != nil:
+		report.RobotsTxtError = err.Error()
+	case status >= 200 && status < 300:
+		robots := parseRobotsTxt(string(content))
+		allowed, rule := robots.allowed(RobotsUserAgent, robotsPath(pageURL))
+		report.BlockedByRobotsTxt = !allowed
+		report.MatchedRule = rule
+		sitemaps = robots.sitemaps
+	case status >= 500:
+		// Crawlers treat an unavailable robots.txt as disallowing the whole site
+		report.RobotsTxtError = fmt.Sprintf("robots.txt returned HTTP %d", status)
+	}
+	if len(sitemaps) == 0 {
+		sitemaps = []string{(&url.URL{Scheme: pageURL.Scheme, Host: pageURL.Host, Path: "/sitemap.xml"}).String()}
+	}
+
+	// The page may be listed under the requested URL or the one it redirected to
+	a.findInSitemaps(ctx, sitemaps, []string{parsedURL.String(), pageURL.String()}, report)
+
+	// Findings describe contradictions between the signals
+	switch {
+	case report.BlockedByRobotsTxt && !report.Indexable:
+		report.Contradictions = append(report.Contradictions, Finding{
+			Severity: SeverityHigh,
+			Subject:  report.MatchedRule,
+			Message:  "Page is marked noindex but robots.txt blocks crawling it, so crawlers never see the noindex and may still index the URL",
+		})
+	case report.BlockedByRobotsTxt:
+		report.Contradictions = append(report.Contradictions, Finding{
+			Severity: SeverityMedium,
+			Subject:  report.MatchedRule,
+			Message:  "Page is indexable but robots.txt blocks crawling it; search engines may index the URL without its content",
+		})
+	}
+	if report.InSitemap && !report.Indexable {
+		report.Contradictions = append(report.Contradictions, Finding{
+			Severity: SeverityMedium,
+			Subject:  report.SitemapURL,
+			Message:  "Sitemap lists a page marked noindex",
+		})
+	}
+	if report.InSitemap && report.BlockedByRobotsTxt {
+		report.Contradictions = append(report.Contradictions, Finding{
+			Severity: SeverityMedium,
+			Subject:  report.SitemapURL,
+			Message:  "Sitemap lists a page robots.txt blocks",
+		})
+	}
+	report.Consistent = len(report.Contradictions) == 0
+	return report
+}
+
+// fetchRobotsResource fetches robots.txt or a sitemap, returning at most limit bytes
+// of the body of successful responses
+func (a *Analyzer) fetchRobotsResource(ctx context.Context, resourceURL string, limit int64) ([]byte, int, error) {
+	fetchCtx, cancel := context.WithTimeout(ctx, RobotsFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(fetchCtx, "GET", resourceURL, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	setBrowserHeaders(req)
+	req.Header.Set("Accept", "text/plain,application/xml,text/xml;q=0.9,*/*;q=0.8")
+
+	client := a.getHTTPClient()
+	defer a.putHTTPClient(client)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			logger.WithAnalysis(resourceURL).Debugw("Failed to close response body", "error", closeErr)
+		}
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, resp.StatusCode, nil
+	}
+
+	body, err := readBody(resp.Body, limit)
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+	defer releaseBuffer(body)
+	content := append([]byte(nil), body.Bytes()...)
+
+	// Sitemaps are often served gzipped as .xml.gz
+	if bytes.HasPrefix(content, []byte{0x1f, 0x8b}) {
+		reader, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return nil, resp.StatusCode, err
+		}
+		content, err = io.ReadAll(io.LimitReader(reader, limit))
+		if err != nil {
+			return nil, resp.StatusCode, err
+		}
+	}
+	return content, resp.StatusCode, nil
+}
+
+// findInSitemaps looks for any of pageURLs in the sitemaps, recording the
+// sitemaps read and the one listing the page
+func (a *Analyzer) findInSitemaps(ctx context.Context, sitemaps []string, pageURLs []string, report *RobotsReport) {
+	wanted := make(map[string]bool, len(pageURLs))
+	for _, pageURL := range pageURLs {
+		wanted[sitemapKey(pageURL)] = true
+	}
+
+	report.Sitemaps = a.walkSitemaps(ctx, sitemaps, func(sitemapURL, loc string) bool {
+		if wanted[sitemapKey(loc)] {
+			report.InSitemap = true
+			report.SitemapURL = sitemapURL
+			return false
+		}
+		return true
+	})
+}
+
+// SitemapURLs returns the page URLs listed in the sitemaps robots.txt names for
+// the site of siteURL, or in its /sitemap.xml when robots.txt names none, up to
+// MaxSitemapURLs. Sitemaps that cannot be fetched or parsed are skipped.
+func (a *Analyzer) SitemapURLs(ctx context.Context, siteURL *url.URL) []string {
+	var sitemaps []string
+	robotsURL := &url.URL{Scheme: siteURL.Scheme, Host: siteURL.Host, Path: "/robots.txt"}
+	if content, status, err := a.fetchRobotsResource(ctx, robotsURL.String(), RobotsTxtBodyLimit); err == nil && status >= 200 && status < 300 {
+		sitemaps = parseRobotsTxt(string(content)).sitemaps
+	}
+	if len(sitemaps) == 0 {
+		sitemaps = []string{(&url.URL{Scheme: siteURL.Scheme, Host: siteURL.Host, Path: "/sitemap.xml"}).String()}
+	}
+
+	var urls []string
+	a.walkSitemaps(ctx, sitemaps, func(_, loc string) bool {
+		urls = append(urls, loc)
+		return len(urls) < MaxSitemapURLs
+	})
+	return urls
+}
+
+// walkSitemaps reads sitemaps breadth first, following sitemap indexes, and calls
+// visit with every listed page URL until visit returns false or MaxSitemapFetches
+// sitemaps were read. It returns the sitemaps read.
+func (a *Analyzer) walkSitemaps(ctx context.Context, sitemaps []string, visit func(sitemapURL, loc string) bool) []string {
+	var read []string
+	queue := append([]string(nil), sitemaps...)
+	seen := make(map[string]bool)
+	for len(queue) > 0 && len(read) < MaxSitemapFetches {
+		sitemapURL := queue[0]
+		queue = queue[1:]
+		if seen[sitemapURL] {
+			continue
+		}
+		seen[sitemapURL] = true
+
+		content, status, err := a.fetchRobotsResource(ctx, sitemapURL, SitemapBodyLimit)
+		if err != nil || status < 200 || status >= 300 {
+			continue
+		}
+		var sitemap sitemapDocument
+		if err := xml.Unmarshal(content, &sitemap); err != nil {
+			logger.WithAnalysis(sitemapURL).Debugw("Failed to parse sitemap", "error", err)
+			continue
+		}
+		read = append(read, sitemapURL)
+
+		for _, entry := range sitemap.URLs {
+			if !visit(sitemapURL, strings.TrimSpace(entry.Loc)) {
+				return read
+			}
+		}
+		for _, child := range sitemap.Sitemaps {
+			queue = append(queue, strings.TrimSpace(child.Loc))
+		}
+	}
+	return read
+}
+
+// sitemapDocument covers both a urlset and a sitemapindex
+type sitemapDocument struct {
+	URLs []struct {
+		Loc string `xml:"loc"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// sitemapKey normalizes a URL for comparison with sitemap entries
+func sitemapKey(rawURL string) string {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return rawURL
+	}
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	parsed.Host = strings.ToLower(parsed.Host)
+	parsed.Fragment = ""
+	if parsed.Path == "" {
+		parsed.Path = "/"
+	}
+	return parsed.String()
+}
+
+// metaRobotsDirectives returns the directives of robots and crawler-specific meta tags
+func metaRobotsDirectives(doc *html.Node) []string {
+	var directives []string
+	traverser := NewHTMLTraverser()
+	traverser.TraverseElements(doc, "meta", func(node *html.Node) {
+		name := strings.ToLower(strings.TrimSpace(traverser.GetAttributeValue(node, "name")))
+		if name == "robots" || name == RobotsUserAgent {
+			directives = append(directives, splitDirectives(traverser.GetAttributeValue(node, "content"))...)
+		}
+	})
+	return directives
+}
+
+// robotsDirectiveParams are directives taking a value after a colon, which must
+// not be mistaken for a user agent prefix
+var robotsDirectiveParams = map[string]bool{
+	"unavailable_after": true, "max-snippet": true, "max-image-preview": true, "max-video-preview": true,
+}
+
+// xRobotsTagDirectives returns the X-Robots-Tag directives that apply to every
+// crawler or to RobotsUserAgent, e.g. "noindex" or "googlebot: nofollow"
+func xRobotsTagDirectives(header http.Header) []string {
+	var directives []string
+	for _, value := range header.Values("X-Robots-Tag") {
+		if agent, rest, found := strings.Cut(value, ":"); found {
+			agent = strings.ToLower(strings.TrimSpace(agent))
+			if !robotsDirectiveParams[agent] && !strings.Contains(agent, ",") {
+				if agent != RobotsUserAgent {
+					continue
+				}
+				value = rest
+			}
+		}
+		directives = append(directives, splitDirectives(value)...)
+	}
+	return directives
+}
+
+func splitDirectives(value string) []string {
+	var directives []string
+	for _, directive := range strings.Split(value, ",") {
+		if directive = strings.ToLower(strings.TrimSpace(directive)); directive != "" {
+			directives = append(directives, directive)
+		}
+	}
+	return directives
+}
+
+func hasNoindex(directives []string) bool {
+	for _, directive := range directives {
+		if directive == "noindex" || directive == "none" {
+			return true
+		}
+	}
+	return false
+}
+
+// robotsRule is one Allow or Disallow line
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// robotsTxt holds the rules of each user agent group and the listed sitemaps
+type robotsTxt struct {
+	groups   map[string][]robotsRule
+	sitemaps []string
+}
+
+// parseRobotsTxt parses robots.txt; consecutive User-agent lines share the rules that follow
+func parseRobotsTxt(content string) *robotsTxt {
+	robots := &robotsTxt{groups: make(map[string][]robotsRule)}
+	var agents []string
+	inRules := false
+	for _, line := range strings.Split(content, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if inRules {
+				agents, inRules = nil, false
+			}
+			agent := strings.ToLower(value)
+			agents = append(agents, agent)
+			if _, ok := robots.groups[agent]; !ok {
+				robots.groups[agent] = nil
+			}
+		case "allow", "disallow":
+			inRules = true
+			if value == "" {
+				// An empty Disallow allows everything and an empty Allow means nothing
+				continue
+			}
+			for _, agent := range agents {
+				robots.groups[agent] = append(robots.groups[agent], robotsRule{allow: key == "allow", pattern: value})
+			}
+		case "sitemap":
+			robots.sitemaps = append(robots.sitemaps, value)
+		}
+	}
+	return robots
+}
+
+// allowed reports whether agent may crawl path and which rule decided it. The
+// longest matching pattern wins; on a tie Allow wins.
+func (r *robotsTxt) allowed(agent, path string) (bool, string) {
+	rules, ok := r.groups[agent]
+	if !ok {
+		rules = r.groups["*"]
+	}
+	if path == "/robots.txt" {
+		return true, ""
+	}
+
+	var best *robotsRule
+	for i, rule := range rules {
+		if !robotsPatternMatch(rule.pattern, path) {
+			continue
+		}
+		if best == nil || len(rule.pattern) > len(best.pattern) || (len(rule.pattern) == len(best.pattern) && rule.allow) {
+			best = &rules[i]
+		}
+	}
+	if best == nil {
+		return true, ""
+	}
+	if best.allow {
+		return true, "Allow: " + best.pattern
+	}
+	return false, "Disallow: " + best.pattern
+}
+
+// robotsPatternMatch matches a robots.txt path pattern, where * matches any
+// sequence and a trailing $ anchors the end
+func robotsPatternMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	expr := "^" + strings.Join(parts, ".*")
+	if anchored {
+		expr += "$"
+	}
+	matched, err := regexp.MatchString(expr, path)
+	return err == nil && matched
+}
+
+// robotsPath returns the path and query robots.txt rules are matched against
+func robotsPath(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return path
+}
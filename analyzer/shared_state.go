@@ -0,0 +1,172 @@
+package analyzer
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"web-page-analyzer/logger"
+)
+
+// SharedStore holds expiring counters. The in-memory store limits a single
+// instance; a RedisClient shares the counters between replicas.
+type SharedStore interface {
+	// Incr increments a counter, starting its expiry when the counter is created
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	// Get returns a counter's value, or 0 when it does not exist
+	Get(ctx context.Context, key string) (int64, error)
+	// Set stores a value that expires after ttl
+	Set(ctx context.Context, key string, value int64, ttl time.Duration) error
+	// Delete removes a key
+	Delete(ctx context.Context, key string) error
+}
+
+// memoryEntry is a counter and the time it expires
+type memoryEntry struct {
+	value   int64
+	expires time.Time
+}
+
+// memoryStore is a SharedStore local to this instance
+type memoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+// newMemoryStore creates an empty in-memory store
+func newMemoryStore() *memoryStore {
+	return &memoryStore{entries: make(map[string]memoryEntry)}
+}
+
+// live returns a key's entry if it has not expired; the caller must hold the lock
+func (s *memoryStore) live(key string, now time.Time) (memoryEntry, bool) {
+	entry, ok := s.entries[key]
+	if ok && now.After(entry.expires) {
+		delete(s.entries, key)
+		return memoryEntry{}, false
+	}
+	return entry, ok
+}
+
+func (s *memoryStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	entry, ok := s.live(key, now)
+	if !ok {
+		entry.expires = now.Add(ttl)
+	}
+	entry.value++
+	s.entries[key] = entry
+
+	// Windowed counters are never deleted explicitly, so sweep expired ones as they accumulate
+	if len(s.entries) > 1000 {
+		for k, e := range s.entries {
+			if now.After(e.expires) {
+				delete(s.entries, k)
+			}
+		}
+	}
+	return entry.value, nil
+}
+
+func (s *memoryStore) Get(ctx context.Context, key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, _ := s.live(key, time.Now())
+	return entry.value, nil
+}
+
+func (s *memoryStore) Set(ctx context.Context, key string, value int64, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = memoryEntry{value: value, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *memoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// hostRateLimiter caps outbound requests per target host per second using
+// fixed one-second windows counted in a SharedStore
+type hostRateLimiter struct {
+	store SharedStore
+	limit int
+}
+
+// wait blocks until the host has capacity in the current window. Store errors
+// let the request through: an unavailable Redis must not stop all analyses.
+func (l *hostRateLimiter) wait(ctx context.Context, host string) error {
+	for {
+		window := time.Now().Truncate(time.Second)
+		key := SharedKeyPrefix + "ratelimit:" + host + ":" + strconv.FormatInt(window.Unix(), 10)
+
+		count, err := l.store.Incr(ctx, key, 2*time.Second)
+		if err != nil {
+			logger.WithComponent("rate_limiter").Warnw("Shared rate limit unavailable", "host", host, "error", err)
+			return nil
+		}
+		if count <= int64(l.limit) {
+			return nil
+		}
+
+		timer := time.NewTimer(time.Until(window.Add(time.Second)))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// throttledTransport applies the analyzer's per-host rate limit to every outbound
+// request and honors the Retry-After of hosts answering 429
+type throttledTransport struct {
+	next     http.RoundTripper
+	analyzer *Analyzer
+}
+
+func (t *throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if limiter := t.analyzer.hostLimiter.Load(); limiter != nil {
+		if err := limiter.wait(req.Context(), req.URL.Hostname()); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := t.roundTripHonoringRetryAfter(t.analyzer.identify(req))
+	if err != nil {
+		return nil, err
+	}
+	// Decompress outside the outbound budget, which counts bytes as sent
+	return decodeContentEncoding(resp), nil
+}
+
+// SetSharedStore shares the per-host rate limit and circuit breaker state through
+// store, typically a RedisClient, so limits hold across all replicas
+func (a *Analyzer) SetSharedStore(store SharedStore) {
+	a.sharedStore = store
+	a.circuitBreaker.SetSharedStore(store)
+	if limiter := a.hostLimiter.Load(); limiter != nil {
+		a.hostLimiter.Store(&hostRateLimiter{store: store, limit: limiter.limit})
+	}
+}
+
+// SetHostRateLimit caps outbound requests to any one host at perSecond; zero removes the cap
+func (a *Analyzer) SetHostRateLimit(perSecond int) {
+	if perSecond <= 0 {
+		a.hostLimiter.Store(nil)
+		return
+	}
+	store := a.sharedStore
+	if store == nil {
+		store = newMemoryStore()
+	}
+	a.hostLimiter.Store(&hostRateLimiter{store: store, limit: perSecond})
+}
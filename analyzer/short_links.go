@@ -0,0 +1,138 @@
+package analyzer
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"web-page-analyzer/logger"
+	"web-page-analyzer/tracing"
+)
+
+// urlShorteners are hosts of well-known URL shortening services
+var urlShorteners = map[string]bool{
+	"bit.ly":      true,
+	"bitly.com":   true,
+	"t.co":        true,
+	"goo.gl":      true,
+	"tinyurl.com": true,
+	"ow.ly":       true,
+	"buff.ly":     true,
+	"is.gd":       true,
+	"rebrand.ly":  true,
+	"lnkd.in":     true,
+	"t.ly":        true,
+	"cutt.ly":     true,
+	"shorturl.at": true,
+	"tiny.cc":     true,
+}
+
+// isShortURL reports whether a resolved link points at a known URL shortener
+func isShortURL(linkURL *url.URL) bool {
+	return urlShorteners[strings.TrimPrefix(strings.ToLower(linkURL.Hostname()), "www.")]
+}
+
+// expandShortLinks resolves links pointing at URL shorteners to their final destination.
+// It returns the link list with shortened links replaced by their destinations, so that
+// classification and accessibility checks apply to the real target, plus the expansions made.
+// The requests are made under ctx, so they count against the analysis's outbound budget.
+func (a *Analyzer) expandShortLinks(ctx context.Context, links []string, baseURL *url.URL) ([]string, []ShortLinkExpansion) {
+	type pending struct {
+		index    int
+		shortURL string
+	}
+
+	var toExpand []pending
+	for i, link := range links {
+		linkURL, err := url.Parse(link)
+		if err != nil {
+			continue
+		}
+		resolved := baseURL.ResolveReference(linkURL)
+		if isShortURL(resolved) {
+			toExpand = append(toExpand, pending{index: i, shortURL: resolved.String()})
+		}
+	}
+	if len(toExpand) == 0 {
+		return links, nil
+	}
+
+	ctx, span := tracing.Start(ctx, "expandShortLinks", tracing.KindInternal, tracing.Int("links.short", len(toExpand)))
+	defer span.End()
+	defer timePhase(ctx, phaseLinkChecks)()
+
+	expanded := make([]string, len(links))
+	copy(expanded, links)
+	expansions := make([]ShortLinkExpansion, len(toExpand))
+
+	// Bound concurrency so pages full of short links don't hammer the shortener
+	semaphore := make(chan struct{}, MinWorkers)
+	var wg sync.WaitGroup
+	for i, p := range toExpand {
+		wg.Add(1)
+		go func(i int, p pending) {
+			defer wg.Done()
+			expansion := ShortLinkExpansion{ShortURL: p.shortURL}
+			select {
+			case semaphore <- struct{}{}:
+				defer func() { <-semaphore }()
+			case <-ctx.Done():
+				expansion.Error = ctx.Err().Error()
+				expansions[i] = expansion
+				return
+			}
+
+			if finalURL, err := a.resolveRedirects(ctx, p.shortURL); err != nil {
+				expansion.Error = err.Error()
+			} else {
+				expansion.FinalURL = finalURL
+				expanded[p.index] = finalURL
+			}
+			expansions[i] = expansion
+		}(i, p)
+	}
+	wg.Wait()
+
+	return expanded, expansions
+}
+
+// resolveRedirects follows redirects from a URL and returns the final location
+func (a *Analyzer) resolveRedirects(ctx context.Context, target string) (string, error) {
+	ctx, span := tracing.Start(ctx, "resolveRedirects", tracing.KindClient, tracing.String("url.full", target))
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, LinkCheckTimeout)
+	defer cancel()
+
+	client := a.getHTTPClient()
+	defer a.putHTTPClient(client)
+
+	var finalURL string
+	for _, method := range []string{"HEAD", "GET"} {
+		req, err := http.NewRequestWithContext(ctx, method, target, nil)
+		if err != nil {
+			return "", err
+		}
+		setBrowserHeaders(req)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			span.SetError(err.Error())
+			return "", err
+		}
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			logger.WithAnalysis(target).Debugw("Failed to close response body", "error", closeErr)
+		}
+
+		finalURL = resp.Request.URL.String()
+		// Some shorteners reject HEAD; retry those with GET
+		if resp.StatusCode != http.StatusMethodNotAllowed && resp.StatusCode != http.StatusNotImplemented {
+			break
+		}
+	}
+
+	span.SetAttributes(tracing.String("url.final", finalURL))
+	return finalURL, nil
+}
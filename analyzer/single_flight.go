@@ -0,0 +1,96 @@
+package analyzer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"web-page-analyzer/logger"
+)
+
+// flightCall is an analysis in progress that concurrent callers wait on
+type flightCall struct {
+	done    chan struct{}
+	result  *AnalysisResult
+	waiters int                // callers still waiting, guarded by singleFlight.mu
+	cancel  context.CancelFunc // stops the analysis once no caller waits for it
+}
+
+// singleFlight coalesces concurrent analyses of the same cache key so that
+// duplicate requests share one fetch and link-check fan-out
+type singleFlight struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// newSingleFlight creates an empty single-flight group
+func newSingleFlight() *singleFlight {
+	return &singleFlight{calls: make(map[string]*flightCall)}
+}
+
+// Do runs fn once per key at a time and hands every concurrent caller its result.
+// The analysis keeps the first caller's context values but not its cancellation,
+// bounded by timeout, so one client disconnecting does not fail the others; each
+// caller stops waiting when its own context is done, and the analysis is cancelled
+// once the last one has. shared reports whether another caller started it.
+func (sf *singleFlight) Do(ctx context.Context, key string, timeout time.Duration, fn func(context.Context) *AnalysisResult) (result *AnalysisResult, shared bool, err error) {
+	sf.mu.Lock()
+	call, shared := sf.calls[key]
+	if !shared {
+		flightCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+		call = &flightCall{done: make(chan struct{}), cancel: cancel}
+		sf.calls[key] = call
+
+		go func() {
+			defer cancel()
+			defer func() {
+				if r := recover(); r != nil {
+					logger.WithComponent("analyzer").Errorw("Analysis panicked", "key", key, "panic", r)
+					call.result = &AnalysisResult{
+						Error: NewAnalysisError(ErrCodeInternalError, "Analysis failed unexpectedly"),
+					}
+				}
+
+				sf.mu.Lock()
+				sf.forget(key, call)
+				sf.mu.Unlock()
+				close(call.done)
+			}()
+
+			call.result = fn(flightCtx)
+		}()
+	}
+	call.waiters++
+	sf.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.result, shared, nil
+	case <-ctx.Done():
+		sf.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			// Nobody wants the result any more; later callers start afresh
+			sf.forget(key, call)
+			call.cancel()
+		}
+		sf.mu.Unlock()
+		return nil, shared, ctx.Err()
+	}
+}
+
+// forget removes call from the group unless a newer analysis of key replaced it.
+// The caller must hold sf.mu.
+func (sf *singleFlight) forget(key string, call *flightCall) {
+	if sf.calls[key] == call {
+		delete(sf.calls, key)
+	}
+}
+
+// pending reports whether an analysis of key is in progress
+func (sf *singleFlight) pending(key string) bool {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	_, ok := sf.calls[key]
+	return ok
+}
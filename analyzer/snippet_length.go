@@ -0,0 +1,139 @@
+package analyzer
+
+import (
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// Snippet length verdicts
+const (
+	SnippetMissing  = "missing"
+	SnippetTooShort = "too_short"
+	SnippetTooLong  = "too_long"
+	SnippetOK       = "ok"
+)
+
+// Search results render titles in 20px and descriptions in 14px Arial
+const (
+	titleFontSize       = 20
+	descriptionFontSize = 14
+)
+
+// SnippetThresholds bounds the title and meta description lengths judged ok.
+// Pixel limits approximate where search results truncate the text.
+type SnippetThresholds struct {
+	TitleMinChars        int `json:"title_min_chars"`
+	TitleMaxChars        int `json:"title_max_chars"`
+	TitleMaxPixels       int `json:"title_max_pixels"`
+	DescriptionMinChars  int `json:"description_min_chars"`
+	DescriptionMaxChars  int `json:"description_max_chars"`
+	DescriptionMaxPixels int `json:"description_max_pixels"`
+}
+
+// DefaultSnippetThresholds returns common SEO guidance: titles of 50-60 characters
+// and descriptions of 120-160 characters
+func DefaultSnippetThresholds() SnippetThresholds {
+	return SnippetThresholds{
+		TitleMinChars:        50,
+		TitleMaxChars:        60,
+		TitleMaxPixels:       600,
+		DescriptionMinChars:  120,
+		DescriptionMaxChars:  160,
+		DescriptionMaxPixels: 960,
+	}
+}
+
+// SetSnippetThresholds sets the title and meta description length thresholds;
+// zero values keep the defaults
+func (a *Analyzer) SetSnippetThresholds(thresholds SnippetThresholds) {
+	defaults := DefaultSnippetThresholds()
+	for _, field := range []struct{ value, def *int }{
+		{&thresholds.TitleMinChars, &defaults.TitleMinChars},
+		{&thresholds.TitleMaxChars, &defaults.TitleMaxChars},
+		{&thresholds.TitleMaxPixels, &defaults.TitleMaxPixels},
+		{&thresholds.DescriptionMinChars, &defaults.DescriptionMinChars},
+		{&thresholds.DescriptionMaxChars, &defaults.DescriptionMaxChars},
+		{&thresholds.DescriptionMaxPixels, &defaults.DescriptionMaxPixels},
+	} {
+		if *field.value <= 0 {
+			*field.value = *field.def
+		}
+	}
+	a.snippetThresholds = thresholds
+}
+
+// SnippetThresholds returns the title and meta description length thresholds
+func (a *Analyzer) SnippetThresholds() SnippetThresholds {
+	return a.snippetThresholds
+}
+
+// measureSnippet reports the length of the title and meta description shown in
+// search results, with a verdict against the analyzer's thresholds
+func (a *Analyzer) measureSnippet(doc *html.Node, title string) *SnippetReport {
+	t := a.snippetThresholds
+	return &SnippetReport{
+		Title:           measureText(title, titleFontSize, t.TitleMinChars, t.TitleMaxChars, t.TitleMaxPixels),
+		MetaDescription: measureText(metaDescription(doc), descriptionFontSize, t.DescriptionMinChars, t.DescriptionMaxChars, t.DescriptionMaxPixels),
+	}
+}
+
+// metaDescription returns the content of the first <meta name="description">
+func metaDescription(doc *html.Node) string {
+	return strings.Join(strings.Fields(metaContent(doc, "description")), " ")
+}
+
+// measureText measures text and judges it against the thresholds
+func measureText(text string, fontSize, minChars, maxChars, maxPixels int) TextLength {
+	length := TextLength{
+		Text:       text,
+		Characters: utf8.RuneCountInString(text),
+		Pixels:     textWidth(text, fontSize),
+		MinChars:   minChars,
+		MaxChars:   maxChars,
+		MaxPixels:  maxPixels,
+	}
+	switch {
+	case length.Characters == 0:
+		length.Verdict = SnippetMissing
+	case length.Characters > maxChars || length.Pixels > maxPixels:
+		length.Verdict = SnippetTooLong
+	case length.Characters < minChars:
+		length.Verdict = SnippetTooShort
+	default:
+		length.Verdict = SnippetOK
+	}
+	return length
+}
+
+// arialWidths are Arial advance widths of printable ASCII in 1/1000 em, from space to tilde
+var arialWidths = [...]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278, // space to /
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, // 0 to 9
+	278, 278, 584, 584, 584, 556, 1015, // : to @
+	667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, // A to M
+	722, 778, 667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, // N to Z
+	278, 278, 278, 469, 556, 333, // [ to `
+	556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, // a to m
+	556, 556, 556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, // n to z
+	334, 260, 334, 584, // { to ~
+}
+
+// textWidth estimates the rendered width of text in pixels at fontSize
+func textWidth(text string, fontSize int) int {
+	units := 0
+	for _, r := range text {
+		switch {
+		case r >= ' ' && r <= '~':
+			units += arialWidths[r-' ']
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			units += 1000 // full-width characters
+		default:
+			units += 556
+		}
+	}
+	return int(math.Round(float64(units*fontSize) / 1000))
+}
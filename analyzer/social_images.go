@@ -0,0 +1,155 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Social image properties
+const (
+	SocialImageOpenGraph = "og:image"
+	SocialImageTwitter   = "twitter:image"
+)
+
+// auditSocialImages lists the og:image and twitter:image previews of the page and,
+// when check is set, HEAD-checks them on a link-check pool; it returns nil when
+// the page declares none
+func (a *Analyzer) auditSocialImages(ctx context.Context, doc *html.Node, baseURL *url.URL, check bool) *SocialImageReport {
+	images := extractSocialImages(doc, baseURL)
+	if len(images) == 0 {
+		return nil
+	}
+
+	report := &SocialImageReport{Images: images}
+	if check {
+		accessible := a.checkSocialImages(ctx, images)
+		for i := range report.Images {
+			if ok, checked := accessible[report.Images[i].URL]; checked {
+				report.Images[i].Accessible = &ok
+				if !ok {
+					report.Broken++
+				}
+			}
+		}
+	}
+	// Open Graph declares dimensions so previews render before the image is fetched
+	for _, image := range report.Images {
+		if image.Property == SocialImageOpenGraph && (image.Width == 0 || image.Height == 0) {
+			report.MissingDimensions++
+		}
+	}
+	return report
+}
+
+// extractSocialImages returns the og:image and twitter:image URLs resolved against
+// baseURL, with the og:image:width and og:image:height following each og:image
+func extractSocialImages(doc *html.Node, baseURL *url.URL) []SocialImage {
+	var images []SocialImage
+	lastOpenGraph := -1
+	traverser := NewHTMLTraverser()
+	traverser.TraverseElements(doc, "meta", func(n *html.Node) {
+		// Open Graph uses property and Twitter uses name, but sites mix them up
+		property := strings.ToLower(strings.TrimSpace(traverser.GetAttributeValue(n, "property")))
+		if property == "" {
+			property = strings.ToLower(strings.TrimSpace(traverser.GetAttributeValue(n, "name")))
+		}
+		content := strings.TrimSpace(traverser.GetAttributeValue(n, "content"))
+		if content == "" {
+			return
+		}
+
+		switch property {
+		case "og:image:width", "og:image:height":
+			size, err := strconv.Atoi(content)
+			if lastOpenGraph < 0 || err != nil || size <= 0 {
+				return
+			}
+			if property == "og:image:width" {
+				images[lastOpenGraph].Width = size
+			} else {
+				images[lastOpenGraph].Height = size
+			}
+			return
+		case "og:image", "og:image:url":
+			property = SocialImageOpenGraph
+		case "twitter:image", "twitter:image:src":
+			property = SocialImageTwitter
+		default:
+			return
+		}
+
+		if len(images) >= MaxSocialImages {
+			return
+		}
+		target, err := baseURL.Parse(content)
+		if err != nil {
+			return
+		}
+		images = append(images, SocialImage{Property: property, URL: target.String()})
+		if property == SocialImageOpenGraph {
+			lastOpenGraph = len(images) - 1
+		}
+	})
+	return images
+}
+
+// checkSocialImages HEAD-checks each distinct HTTP(S) image URL and returns
+// whether it is accessible; URLs left unchecked are absent from the map
+func (a *Analyzer) checkSocialImages(ctx context.Context, images []SocialImage) map[string]bool {
+	var targets []string
+	seen := make(map[string]bool)
+	for _, image := range images {
+		if (strings.HasPrefix(image.URL, "http://") || strings.HasPrefix(image.URL, "https://")) && !seen[image.URL] {
+			seen[image.URL] = true
+			targets = append(targets, image.URL)
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	pool := a.newLinkCheckPool(len(targets), func(ctx context.Context, job AnalysisJob) LinkResult {
+		accessible, err := a.checkLink(ctx, job.Link)
+		// Images left unchecked once the analysis is out of outbound budget are not reported
+		if errors.Is(err, errOutboundBudgetExhausted) {
+			return LinkResult{Link: job.Link, Skipped: true}
+		}
+		return LinkResult{Link: job.Link, IsAccessible: accessible}
+	})
+
+	checkCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	pool.Start(checkCtx)
+	go func() {
+		defer pool.Close()
+		for _, target := range targets {
+			if pool.Submit(checkCtx, AnalysisJob{Link: target}) != nil {
+				return
+			}
+		}
+	}()
+
+	accessible := make(map[string]bool, len(targets))
+	results := pool.Results()
+collect:
+	for range targets {
+		select {
+		case result := <-results:
+			if !result.Skipped {
+				accessible[result.Link] = result.IsAccessible
+			}
+		case <-checkCtx.Done():
+			break collect
+		}
+	}
+
+	// Abort in-flight checks and wait for workers to exit
+	cancel()
+	pool.Wait()
+	return accessible
+}
@@ -0,0 +1,402 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Structured data issue severities, as in Google's Rich Results Test
+const (
+	StructuredDataError   = "error"
+	StructuredDataWarning = "warning"
+)
+
+// Structured data formats: items found in <script type="application/ld+json">,
+// and items marked up with microdata or RDFa attributes
+const (
+	StructuredDataFormatJSONLD    = "json-ld"
+	StructuredDataFormatMicrodata = "microdata"
+	StructuredDataFormatRDFa      = "rdfa"
+)
+
+// schemaRule lists the properties a schema.org type needs to be eligible for
+// rich results (required) and those that improve it (recommended)
+type schemaRule struct {
+	required    []string
+	recommended []string
+	// check validates nested values such as offers or list items
+	check func(item map[string]any, issues *structuredDataIssues)
+}
+
+var articleRule = schemaRule{
+	required:    []string{"headline"},
+	recommended: []string{"image", "author", "datePublished", "dateModified"},
+}
+
+// schemaRules holds the validated types; items of other types are listed unchecked
+var schemaRules = map[string]schemaRule{
+	"Article":     articleRule,
+	"NewsArticle": articleRule,
+	"BlogPosting": articleRule,
+	"Product": {
+		required:    []string{"name"},
+		recommended: []string{"image", "description", "brand", "sku"},
+		check:       checkProduct,
+	},
+	"FAQPage": {
+		required: []string{"mainEntity"},
+		check:    checkFAQPage,
+	},
+	"BreadcrumbList": {
+		required: []string{"itemListElement"},
+		check:    checkBreadcrumbList,
+	},
+}
+
+// validateStructuredData parses the page's JSON-LD blocks and microdata and RDFa
+// items and validates each schema.org item against schemaRules; it returns nil
+// when there are none
+func (a *Analyzer) validateStructuredData(doc *html.Node) *StructuredDataReport {
+	var report *StructuredDataReport
+	traverser := NewHTMLTraverser()
+	traverser.TraverseElements(doc, "script", func(node *html.Node) {
+		mediaType, _, _ := mime.ParseMediaType(traverser.GetAttributeValue(node, "type"))
+		if mediaType != "application/ld+json" {
+			return
+		}
+		if report == nil {
+			report = &StructuredDataReport{}
+		}
+		report.Blocks++
+
+		var content string
+		if node.FirstChild != nil {
+			content = node.FirstChild.Data
+		}
+		var value any
+		if err := json.Unmarshal([]byte(strings.TrimSpace(content)), &value); err != nil {
+			report.ParseErrors = append(report.ParseErrors, fmt.Sprintf("JSON-LD block %d: %v", report.Blocks, err))
+			return
+		}
+		for _, item := range jsonLDItems(value) {
+			report.Items = append(report.Items, validateSchemaItem(item, StructuredDataFormatJSONLD))
+		}
+	})
+	for _, format := range markupFormats {
+		for _, item := range format.items(doc) {
+			if report == nil {
+				report = &StructuredDataReport{}
+			}
+			report.Items = append(report.Items, validateSchemaItem(item, format.name))
+		}
+	}
+	if report == nil {
+		return nil
+	}
+
+	report.Errors = len(report.ParseErrors)
+	for _, item := range report.Items {
+		for _, schemaType := range strings.Split(item.Type, ",") {
+			if schemaType != "" {
+				report.Types = appendUnique(report.Types, schemaType)
+			}
+		}
+		for _, issue := range item.Issues {
+			if issue.Severity == StructuredDataError {
+				report.Errors++
+			} else {
+				report.Warnings++
+			}
+		}
+	}
+	sort.Strings(report.Types)
+	report.Valid = report.Errors == 0
+	return report
+}
+
+// jsonLDItems returns the top-level items of a JSON-LD value, flattening arrays and @graph
+func jsonLDItems(value any) []map[string]any {
+	switch v := value.(type) {
+	case []any:
+		var items []map[string]any
+		for _, entry := range v {
+			items = append(items, jsonLDItems(entry)...)
+		}
+		return items
+	case map[string]any:
+		if graph, ok := v["@graph"]; ok {
+			return jsonLDItems(graph)
+		}
+		return []map[string]any{v}
+	}
+	return nil
+}
+
+// validateSchemaItem checks one item against the rule of its first known type
+func validateSchemaItem(item map[string]any, format string) StructuredDataItem {
+	types := schemaTypes(item)
+	result := StructuredDataItem{Type: strings.Join(types, ","), Format: format}
+	if len(types) == 0 {
+		result.Issues = []StructuredDataIssue{{Severity: StructuredDataWarning, Property: "@type", Message: "Item has no @type"}}
+		return result
+	}
+
+	for _, schemaType := range types {
+		rule, ok := schemaRules[schemaType]
+		if !ok {
+			continue
+		}
+		result.Checked = true
+		issues := &structuredDataIssues{}
+		issues.requireAll(item, "", rule.required)
+		issues.recommendAll(item, "", rule.recommended)
+		if rule.check != nil {
+			rule.check(item, issues)
+		}
+		result.Issues = issues.list
+		break
+	}
+	return result
+}
+
+// schemaTypes returns the item's @type values without a schema.org prefix
+func schemaTypes(item map[string]any) []string {
+	var types []string
+	switch v := item["@type"].(type) {
+	case string:
+		types = []string{v}
+	case []any:
+		for _, entry := range v {
+			if s, ok := entry.(string); ok {
+				types = append(types, s)
+			}
+		}
+	}
+	for i, schemaType := range types {
+		types[i] = schemaName(schemaType)
+	}
+	return types
+}
+
+// schemaName strips the schema.org vocabulary from a type or property name
+func schemaName(name string) string {
+	for _, prefix := range []string{"https://schema.org/", "http://schema.org/", "schema:"} {
+		name = strings.TrimPrefix(name, prefix)
+	}
+	return name
+}
+
+// markupFormat describes how a markup syntax embeds items in HTML attributes
+type markupFormat struct {
+	name     string
+	scope    string // attribute making an element an item
+	itemType string // attribute listing the item's types
+	property string // attribute naming the properties an element sets on the enclosing item
+}
+
+// markupFormats are the attribute syntaxes items are read from; only the RDFa
+// Lite attributes schema.org documents are supported
+var markupFormats = []markupFormat{
+	{name: StructuredDataFormatMicrodata, scope: "itemscope", itemType: "itemtype", property: "itemprop"},
+	{name: StructuredDataFormatRDFa, scope: "typeof", itemType: "typeof", property: "property"},
+}
+
+// items returns the top-level items marked up in doc, converted to the shape
+// of JSON-LD items so the same rules validate them. Items that are the value of
+// a property belong to the enclosing item instead.
+func (f markupFormat) items(doc *html.Node) []map[string]any {
+	traverser := NewHTMLTraverser()
+	var items []map[string]any
+	traverser.TraverseAllElements(doc, func(n *html.Node) {
+		if traverser.HasAttribute(n, f.scope) && !traverser.HasAttribute(n, f.property) {
+			items = append(items, f.item(n))
+		}
+	})
+	return items
+}
+
+// item converts the item rooted at n, with the properties set by its descendants
+func (f markupFormat) item(n *html.Node) map[string]any {
+	traverser := NewHTMLTraverser()
+	item := make(map[string]any)
+	if types := strings.Fields(traverser.GetAttributeValue(n, f.itemType)); len(types) > 0 {
+		values := make([]any, len(types))
+		for i, schemaType := range types {
+			values[i] = schemaType
+		}
+		item["@type"] = values
+	}
+
+	var collect func(*html.Node)
+	collect = func(parent *html.Node) {
+		for c := parent.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			if names := strings.Fields(traverser.GetAttributeValue(c, f.property)); len(names) > 0 {
+				value := f.value(c)
+				for _, name := range names {
+					addProperty(item, schemaName(name), value)
+				}
+			}
+			// The properties inside a nested item are its own
+			if !traverser.HasAttribute(c, f.scope) {
+				collect(c)
+			}
+		}
+	}
+	collect(n)
+	return item
+}
+
+// value returns the value an element gives its property: a nested item, the
+// content attribute, the URL or machine-readable value of the element, or its text
+func (f markupFormat) value(n *html.Node) any {
+	traverser := NewHTMLTraverser()
+	if traverser.HasAttribute(n, f.scope) {
+		return f.item(n)
+	}
+	if traverser.HasAttribute(n, "content") {
+		return traverser.GetAttributeValue(n, "content")
+	}
+	attribute := ""
+	switch n.Data {
+	case "a", "area", "link":
+		attribute = "href"
+	case "img", "audio", "video", "source", "track", "iframe", "embed":
+		attribute = "src"
+	case "object":
+		attribute = "data"
+	case "data", "meter":
+		attribute = "value"
+	case "time":
+		attribute = "datetime"
+	}
+	if attribute != "" && traverser.HasAttribute(n, attribute) {
+		return traverser.GetAttributeValue(n, attribute)
+	}
+	return strings.Join(strings.Fields(nodeText(n)), " ")
+}
+
+// addProperty sets property on item, collecting repeated properties in a list
+func addProperty(item map[string]any, property string, value any) {
+	switch existing := item[property].(type) {
+	case nil:
+		item[property] = value
+	case []any:
+		item[property] = append(existing, value)
+	default:
+		item[property] = []any{existing, value}
+	}
+}
+
+// structuredDataIssues collects the issues of one item
+type structuredDataIssues struct {
+	list []StructuredDataIssue
+}
+
+func (s *structuredDataIssues) add(severity, property, message string) {
+	s.list = append(s.list, StructuredDataIssue{Severity: severity, Property: property, Message: message})
+}
+
+// requireAll reports an error for each property missing from item; path prefixes nested properties
+func (s *structuredDataIssues) requireAll(item map[string]any, path string, properties []string) {
+	for _, property := range properties {
+		if !hasProperty(item, property) {
+			s.add(StructuredDataError, path+property, fmt.Sprintf("Missing required property %q", property))
+		}
+	}
+}
+
+// recommendAll reports a warning for each property missing from item
+func (s *structuredDataIssues) recommendAll(item map[string]any, path string, properties []string) {
+	for _, property := range properties {
+		if !hasProperty(item, property) {
+			s.add(StructuredDataWarning, path+property, fmt.Sprintf("Missing recommended property %q", property))
+		}
+	}
+}
+
+// hasProperty reports whether item has a non-empty value for property
+func hasProperty(item map[string]any, property string) bool {
+	switch v := item[property].(type) {
+	case nil:
+		return false
+	case string:
+		return strings.TrimSpace(v) != ""
+	case []any:
+		return len(v) > 0
+	}
+	return true
+}
+
+// objects returns the objects of a property that may hold one object or a list of them
+func objects(value any) []map[string]any {
+	switch v := value.(type) {
+	case map[string]any:
+		return []map[string]any{v}
+	case []any:
+		var list []map[string]any
+		for _, entry := range v {
+			if object, ok := entry.(map[string]any); ok {
+				list = append(list, object)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// checkProduct requires offers, a review or a rating, and a price on every offer
+func checkProduct(item map[string]any, issues *structuredDataIssues) {
+	if !hasProperty(item, "offers") && !hasProperty(item, "review") && !hasProperty(item, "aggregateRating") {
+		issues.add(StructuredDataError, "offers", `Product needs one of "offers", "review" or "aggregateRating"`)
+	}
+	for i, offer := range objects(item["offers"]) {
+		path := fmt.Sprintf("offers[%d].", i)
+		if types := schemaTypes(offer); len(types) > 0 && types[0] == "AggregateOffer" {
+			issues.requireAll(offer, path, []string{"lowPrice", "priceCurrency"})
+			continue
+		}
+		if !hasProperty(offer, "price") && !hasProperty(offer, "priceSpecification") {
+			issues.add(StructuredDataError, path+"price", `Missing required property "price"`)
+		}
+		issues.requireAll(offer, path, []string{"priceCurrency"})
+		issues.recommendAll(offer, path, []string{"availability"})
+	}
+}
+
+// checkFAQPage requires every question to have a name and an answer with text
+func checkFAQPage(item map[string]any, issues *structuredDataIssues) {
+	for i, question := range objects(item["mainEntity"]) {
+		path := fmt.Sprintf("mainEntity[%d].", i)
+		issues.requireAll(question, path, []string{"name", "acceptedAnswer"})
+		for j, answer := range objects(question["acceptedAnswer"]) {
+			issues.requireAll(answer, fmt.Sprintf("%sacceptedAnswer[%d].", path, j), []string{"text"})
+		}
+	}
+}
+
+// checkBreadcrumbList requires every crumb to have a position and a name, and
+// all but the last, which is the current page, to link to an item
+func checkBreadcrumbList(item map[string]any, issues *structuredDataIssues) {
+	crumbs := objects(item["itemListElement"])
+	for i, crumb := range crumbs {
+		path := fmt.Sprintf("itemListElement[%d].", i)
+		issues.requireAll(crumb, path, []string{"position"})
+		// The name may also be given on the linked item
+		if !hasProperty(crumb, "name") {
+			if linked, ok := crumb["item"].(map[string]any); !ok || !hasProperty(linked, "name") {
+				issues.add(StructuredDataError, path+"name", `Missing required property "name"`)
+			}
+		}
+		if i < len(crumbs)-1 {
+			issues.requireAll(crumb, path, []string{"item"})
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package analyzer
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// thirdPartySignature describes how an embedded third-party service can be recognized
+type thirdPartySignature struct {
+	name string
+	// sources are substrings of script or iframe src URLs served by the service
+	sources []string
+	// markers are element ids or class names the service injects into the page
+	markers []string
+	// inline are substrings found in inline scripts that load or configure the service
+	inline []string
+	// attributes are attribute names the service adds to elements
+	attributes []string
+}
+
+// thirdPartyMatch records the evidence found for a detected service
+type thirdPartyMatch struct {
+	name     string
+	evidence []string
+}
+
+// matchThirdParties returns the services whose signatures match the document,
+// in signature order
+func matchThirdParties(doc *html.Node, signatures []thirdPartySignature) []thirdPartyMatch {
+	traverser := NewHTMLTraverser()
+	evidence := make(map[string][]string)
+
+	traverser.TraverseAllElements(doc, func(n *html.Node) {
+		src := strings.ToLower(traverser.GetAttributeValue(n, "src"))
+		var inline string
+		if n.Data == "script" && src == "" {
+			inline = nodeText(n)
+		}
+		ids := strings.Fields(traverser.GetAttributeValue(n, "id") + " " + traverser.GetAttributeValue(n, "class"))
+
+		for _, signature := range signatures {
+			if src != "" && (n.Data == "script" || n.Data == "iframe") {
+				for _, source := range signature.sources {
+					if strings.Contains(src, source) {
+						evidence[signature.name] = appendUnique(evidence[signature.name], n.Data+":"+source)
+					}
+				}
+			}
+			for _, marker := range signature.markers {
+				for _, id := range ids {
+					if id == marker {
+						evidence[signature.name] = appendUnique(evidence[signature.name], "element:"+marker)
+					}
+				}
+			}
+			for _, attribute := range signature.attributes {
+				if _, ok := lookupAttribute(n, attribute); ok {
+					evidence[signature.name] = appendUnique(evidence[signature.name], "attribute:"+attribute)
+				}
+			}
+			for _, snippet := range signature.inline {
+				if inline != "" && strings.Contains(inline, snippet) {
+					evidence[signature.name] = appendUnique(evidence[signature.name], "inline:"+snippet)
+				}
+			}
+		}
+	})
+
+	var matches []thirdPartyMatch
+	for _, signature := range signatures {
+		if found := evidence[signature.name]; len(found) > 0 {
+			matches = append(matches, thirdPartyMatch{name: signature.name, evidence: found})
+		}
+	}
+	return matches
+}
@@ -0,0 +1,286 @@
+package analyzer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"web-page-analyzer/logger"
+
+	"golang.org/x/net/html"
+)
+
+// Threat sources
+const (
+	ThreatSourceBlocklist    = "blocklist"
+	ThreatSourceSafeBrowsing = "safe_browsing"
+)
+
+// SafeBrowsingEndpoint is the Google Safe Browsing v4 lookup API
+const SafeBrowsingEndpoint = "https://safebrowsing.googleapis.com/v4/threatMatches:find"
+
+// ThreatChecker looks up URLs in a list of known-malicious destinations
+type ThreatChecker interface {
+	CheckURLs(ctx context.Context, urls []string) ([]FlaggedURL, error)
+}
+
+// AddThreatChecker registers a checker consulted for the analyzed URL and its external links
+func (a *Analyzer) AddThreatChecker(checker ThreatChecker) {
+	a.threatCheckers = append(a.threatCheckers, checker)
+}
+
+// checkThreats runs the registered threat checkers against the page URL and its external links
+func (a *Analyzer) checkThreats(ctx context.Context, doc *html.Node, baseURL *url.URL, result *AnalysisResult) {
+	if len(a.threatCheckers) == 0 {
+		return
+	}
+
+	urls := []string{baseURL.String()}
+	seen := map[string]bool{baseURL.String(): true}
+	addURL := func(target *url.URL) {
+		if target.Host == "" || target.Host == baseURL.Host || seen[target.String()] {
+			return
+		}
+		if target.Scheme != "http" && target.Scheme != "https" {
+			return
+		}
+		seen[target.String()] = true
+		urls = append(urls, target.String())
+	}
+
+	for _, link := range a.extractLinks(doc, baseURL) {
+		if linkURL, err := url.Parse(link); err == nil {
+			addURL(baseURL.ResolveReference(linkURL))
+		}
+	}
+	for _, expansion := range result.ShortLinks {
+		if finalURL, err := url.Parse(expansion.FinalURL); err == nil && expansion.FinalURL != "" {
+			addURL(finalURL)
+		}
+	}
+
+	for _, checker := range a.threatCheckers {
+		flagged, err := checker.CheckURLs(ctx, urls)
+		if err != nil {
+			logger.WithAnalysis(baseURL.String()).Warnw("Threat check failed", "error", err)
+			continue
+		}
+		result.FlaggedURLs = append(result.FlaggedURLs, flagged...)
+	}
+}
+
+// Blocklist is a local list of blocked hosts and URL prefixes
+type Blocklist struct {
+	hosts map[string]string
+	// prefixes are sorted longest first, so the most specific entry matches
+	prefixes []blocklistPrefix
+}
+
+// blocklistPrefix is a blocked URL prefix and its threat
+type blocklistPrefix struct {
+	prefix string
+	threat string
+}
+
+// NewBlocklist creates a blocklist from entries of the form "host-or-url [threat]"
+func NewBlocklist(entries []string) *Blocklist {
+	b := &Blocklist{hosts: make(map[string]string)}
+	prefixes := make(map[string]string)
+	for _, entry := range entries {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		threat := "BLOCKLISTED"
+		if len(fields) > 1 {
+			threat = fields[1]
+		}
+		target := strings.ToLower(fields[0])
+		if strings.Contains(target, "://") {
+			prefixes[target] = threat
+		} else {
+			b.hosts[strings.TrimSuffix(target, ".")] = threat
+		}
+	}
+	for prefix, threat := range prefixes {
+		b.prefixes = append(b.prefixes, blocklistPrefix{prefix: prefix, threat: threat})
+	}
+	sort.Slice(b.prefixes, func(i, j int) bool {
+		if len(b.prefixes[i].prefix) != len(b.prefixes[j].prefix) {
+			return len(b.prefixes[i].prefix) > len(b.prefixes[j].prefix)
+		}
+		return b.prefixes[i].prefix < b.prefixes[j].prefix
+	})
+	return b
+}
+
+// LoadBlocklist reads a blocklist file with one entry per line; lines starting with # are ignored
+func LoadBlocklist(path string) (*Blocklist, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entries = append(entries, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewBlocklist(entries), nil
+}
+
+// CheckURLs flags URLs whose host, or any parent domain, or URL prefix is blocklisted
+func (b *Blocklist) CheckURLs(ctx context.Context, urls []string) ([]FlaggedURL, error) {
+	var flagged []FlaggedURL
+	for _, target := range urls {
+		if threat, ok := b.match(target); ok {
+			flagged = append(flagged, FlaggedURL{URL: target, Threat: threat, Source: ThreatSourceBlocklist})
+		}
+	}
+	return flagged, nil
+}
+
+// match returns the threat recorded for the longest matching URL prefix, or
+// else for the most specific matching host
+func (b *Blocklist) match(target string) (string, bool) {
+	lower := strings.ToLower(target)
+	for _, entry := range b.prefixes {
+		if strings.HasPrefix(lower, entry.prefix) {
+			return entry.threat, true
+		}
+	}
+
+	parsed, err := url.Parse(lower)
+	if err != nil {
+		return "", false
+	}
+	host := parsed.Hostname()
+	for host != "" {
+		if threat, ok := b.hosts[host]; ok {
+			return threat, true
+		}
+		dot := strings.Index(host, ".")
+		if dot == -1 {
+			break
+		}
+		host = host[dot+1:]
+	}
+	return "", false
+}
+
+// SafeBrowsingClient looks up URLs with the Google Safe Browsing v4 API
+type SafeBrowsingClient struct {
+	apiKey     string
+	endpoint   string
+	httpClient *http.Client
+}
+
+// NewSafeBrowsingClient creates a Safe Browsing client using the given API key
+func NewSafeBrowsingClient(apiKey string) *SafeBrowsingClient {
+	return &SafeBrowsingClient{
+		apiKey:     apiKey,
+		endpoint:   SafeBrowsingEndpoint,
+		httpClient: &http.Client{Timeout: ThreatCheckTimeout},
+	}
+}
+
+// safeBrowsingRequest is the threatMatches:find request body
+type safeBrowsingRequest struct {
+	Client struct {
+		ClientID      string `json:"clientId"`
+		ClientVersion string `json:"clientVersion"`
+	} `json:"client"`
+	ThreatInfo struct {
+		ThreatTypes      []string            `json:"threatTypes"`
+		PlatformTypes    []string            `json:"platformTypes"`
+		ThreatEntryTypes []string            `json:"threatEntryTypes"`
+		ThreatEntries    []map[string]string `json:"threatEntries"`
+	} `json:"threatInfo"`
+}
+
+// safeBrowsingResponse is the threatMatches:find response body
+type safeBrowsingResponse struct {
+	Matches []struct {
+		ThreatType string `json:"threatType"`
+		Threat     struct {
+			URL string `json:"url"`
+		} `json:"threat"`
+	} `json:"matches"`
+}
+
+// CheckURLs flags URLs that Safe Browsing reports as malware, phishing or unwanted software
+func (c *SafeBrowsingClient) CheckURLs(ctx context.Context, urls []string) ([]FlaggedURL, error) {
+	var flagged []FlaggedURL
+	for start := 0; start < len(urls); start += MaxSafeBrowsingEntries {
+		end := start + MaxSafeBrowsingEntries
+		if end > len(urls) {
+			end = len(urls)
+		}
+		batch, err := c.lookup(ctx, urls[start:end])
+		if err != nil {
+			return flagged, err
+		}
+		flagged = append(flagged, batch...)
+	}
+	return flagged, nil
+}
+
+// lookup sends a single threatMatches:find request
+func (c *SafeBrowsingClient) lookup(ctx context.Context, urls []string) ([]FlaggedURL, error) {
+	var body safeBrowsingRequest
+	body.Client.ClientID = "web-page-analyzer"
+	body.Client.ClientVersion = "1.0"
+	body.ThreatInfo.ThreatTypes = []string{"MALWARE", "SOCIAL_ENGINEERING", "UNWANTED_SOFTWARE", "POTENTIALLY_HARMFUL_APPLICATION"}
+	body.ThreatInfo.PlatformTypes = []string{"ANY_PLATFORM"}
+	body.ThreatInfo.ThreatEntryTypes = []string{"URL"}
+	for _, target := range urls {
+		body.ThreatInfo.ThreatEntries = append(body.ThreatInfo.ThreatEntries, map[string]string{"url": target})
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.endpoint+"?key="+url.QueryEscape(c.apiKey), bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("safe browsing lookup failed: HTTP %d", resp.StatusCode)
+	}
+
+	var decoded safeBrowsingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return nil, err
+	}
+
+	flagged := make([]FlaggedURL, 0, len(decoded.Matches))
+	for _, match := range decoded.Matches {
+		flagged = append(flagged, FlaggedURL{
+			URL:    match.Threat.URL,
+			Threat: match.ThreatType,
+			Source: ThreatSourceSafeBrowsing,
+		})
+	}
+	return flagged, nil
+}
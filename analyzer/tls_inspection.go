@@ -0,0 +1,172 @@
+package analyzer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"time"
+
+	"web-page-analyzer/logger"
+)
+
+// insecureCipherSuites are the cipher suites Go considers insecure, such as
+// those using RC4 or 3DES
+var insecureCipherSuites = func() map[uint16]bool {
+	suites := make(map[uint16]bool)
+	for _, suite := range tls.InsecureCipherSuites() {
+		suites[suite.ID] = true
+	}
+	return suites
+}()
+
+// inspectionCipherSuites are offered by inspection handshakes, so that servers
+// supporting only insecure cipher suites can still be reported on
+var inspectionCipherSuites = func() []uint16 {
+	var suites []uint16
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		suites = append(suites, suite.ID)
+	}
+	return suites
+}()
+
+// inspectTLS runs a handshake of its own with the host of target, accepting
+// deprecated protocols, insecure cipher suites and certificates failing
+// verification, so that a fetch refused over them can report why. The
+// certificate chain is verified separately and its problems reported as
+// findings. It returns nil when the handshake fails regardless.
+func (a *Analyzer) inspectTLS(ctx context.Context, target *url.URL) *TLSInfo {
+	if target.Scheme != "https" {
+		return nil
+	}
+	if budget := outboundBudgetFrom(ctx); budget != nil {
+		if err := budget.acquire(target.String()); err != nil {
+			return nil
+		}
+		defer func(start time.Time) { budget.record(time.Since(start)) }(time.Now())
+	}
+
+	host := target.Hostname()
+	port := target.Port()
+	if port == "" {
+		port = "443"
+	}
+	ctx, cancel := context.WithTimeout(ctx, TLSInspectionTimeout)
+	defer cancel()
+
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Control: a.dialControl},
+		Config: &tls.Config{
+			ServerName:         host,
+			MinVersion:         tls.VersionTLS10,
+			CipherSuites:       inspectionCipherSuites,
+			InsecureSkipVerify: true, // the chain is verified below, to report rather than refuse
+		},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		logger.WithAnalysis(target.String()).Debugw("TLS inspection handshake failed", "error", err)
+		return nil
+	}
+	defer conn.Close()
+
+	state := conn.(*tls.Conn).ConnectionState()
+	info := tlsInfo(&state)
+	if len(state.PeerCertificates) > 0 {
+		if err := verifyCertificateChain(host, state.PeerCertificates); err != nil {
+			info.Findings = append(info.Findings, Finding{Severity: SeverityHigh, Subject: "certificate",
+				Message: "Certificate is not trusted: " + err.Error()})
+		}
+	}
+	return info
+}
+
+// verifyCertificateChain verifies the certificates a server presented for host
+// against the system roots; expiry is left out, as tlsInfo reports it
+func verifyCertificateChain(host string, certs []*x509.Certificate) error {
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	leaf := certs[0]
+	_, err := leaf.Verify(x509.VerifyOptions{
+		DNSName:       host,
+		Intermediates: intermediates,
+		// Verifying at a time the leaf is valid leaves out its expiry
+		CurrentTime: clampTime(time.Now(), leaf.NotBefore, leaf.NotAfter),
+	})
+	return err
+}
+
+// clampTime returns t limited to the range from earliest to latest
+func clampTime(t, earliest, latest time.Time) time.Time {
+	if t.Before(earliest) {
+		return earliest
+	}
+	if t.After(latest) {
+		return latest
+	}
+	return t
+}
+
+// failedTLSURL returns the URL whose handshake failed with err, which is the
+// last redirect target rather than the requested URL when redirects were followed
+func failedTLSURL(err error, requested *url.URL) *url.URL {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		if failed, parseErr := url.Parse(urlErr.URL); parseErr == nil {
+			return failed
+		}
+	}
+	return requested
+}
+
+// tlsInfo summarizes the negotiated TLS connection state, flagging weak
+// protocols and ciphers and certificates that expired or expire within
+// CertExpiryWarningDays
+func tlsInfo(state *tls.ConnectionState) *TLSInfo {
+	if state == nil {
+		return nil
+	}
+
+	info := &TLSInfo{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ServerName:  state.ServerName,
+	}
+	if state.Version < tls.VersionTLS12 {
+		info.Findings = append(info.Findings, Finding{Severity: SeverityHigh, Subject: info.Version,
+			Message: "Connection negotiated a deprecated protocol; TLS 1.2 or later is required by current browsers"})
+	}
+	if insecureCipherSuites[state.CipherSuite] {
+		info.Findings = append(info.Findings, Finding{Severity: SeverityHigh, Subject: info.CipherSuite,
+			Message: "Connection negotiated an insecure cipher suite"})
+	}
+
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		info.Subject = cert.Subject.CommonName
+		info.Issuer = cert.Issuer.CommonName
+		info.NotBefore = cert.NotBefore.UTC()
+		info.NotAfter = cert.NotAfter.UTC()
+		info.SANs = append(info.SANs, cert.DNSNames...)
+		for _, ip := range cert.IPAddresses {
+			info.SANs = append(info.SANs, ip.String())
+		}
+
+		info.DaysUntilExpiry = int(math.Floor(time.Until(cert.NotAfter).Hours() / 24))
+		switch {
+		case time.Now().After(cert.NotAfter):
+			info.Findings = append(info.Findings, Finding{Severity: SeverityHigh, Subject: "certificate",
+				Message: fmt.Sprintf("Certificate expired on %s", info.NotAfter.Format(time.DateOnly))})
+		case info.DaysUntilExpiry < CertExpiryWarningDays:
+			info.Findings = append(info.Findings, Finding{Severity: SeverityMedium, Subject: "certificate",
+				Message: fmt.Sprintf("Certificate expires in %d days, on %s", info.DaysUntilExpiry, info.NotAfter.Format(time.DateOnly))})
+		}
+	}
+	return info
+}
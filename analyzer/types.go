@@ -1,22 +1,639 @@
 package analyzer
 
 import (
+	"context"
+	"net/http"
+	"net/url"
 	"sync"
 	"time"
 )
 
+// AnalysisOptions controls optional analysis features
+type AnalysisOptions struct {
+	// CompareVariants fetches the http/https and www/non-www variants and compares where they land
+	CompareVariants bool
+	// SkipLinkCheck classifies links without checking whether external links are accessible
+	SkipLinkCheck bool
+	// ExpandShortLinks resolves links to known URL shorteners and classifies their destinations
+	ExpandShortLinks bool
+	// QuickCheck only issues a HEAD request and reports reachability without parsing the body
+	QuickCheck bool
+	// ExtractContent isolates the main article text and estimates its reading time
+	ExtractContent bool
+	// LookupDomain reports domain registration details via RDAP
+	LookupDomain bool
+	// PageSpeed adds Core Web Vitals field data from PageSpeed Insights
+	PageSpeed bool
+	// IncludeHeaders returns the raw response headers and selected request headers
+	IncludeHeaders bool
+	// CollectLinks lists every resolved link on the page, e.g. for diffing consecutive runs
+	CollectLinks bool
+	// IncludeLinks reports each link with its classification and check outcome
+	IncludeLinks bool
+	// ArchiveDate analyzes the Wayback Machine capture closest to it instead of the live page
+	ArchiveDate time.Time
+	// BypassCache always fetches the page; the fresh result still refreshes the cache
+	BypassCache bool
+	// ExtractionRules extract values into custom_fields in addition to the configured rules
+	ExtractionRules []ExtractionRule
+	// Assertions are checked against the response and reported as pass/fail findings
+	Assertions []Assertion
+	// CheckImages HEAD-checks the page's images for broken ones and their sizes
+	CheckImages bool
+	// CheckRobots cross-checks meta robots and X-Robots-Tag against robots.txt and the sitemap
+	CheckRobots bool
+	// HeadingsTextLimit returns the text of up to this many headings per level; 0 returns none
+	HeadingsTextLimit int
+	// SnapshotLimit keeps up to this many bytes of the fetched HTML in the
+	// result's Snapshot, e.g. to store it with the result; 0 keeps none
+	SnapshotLimit int64
+	// Priority decides whether link checks yield to interactive analyses; it
+	// does not change the result, so it is not part of the cache key
+	Priority Priority
+}
+
+// HTMLSnapshot is the HTML an analysis fetched, kept to be stored with its result
+type HTMLSnapshot struct {
+	HTML []byte
+	// Header holds the response headers the HTML was served with, so that
+	// reanalysis sees the same headers as the original analysis
+	Header http.Header
+	// Truncated reports that the page was longer than the snapshot limit
+	Truncated bool
+}
+
 // AnalysisResult represents the result of analyzing a web page
 type AnalysisResult struct {
-	URL               string         `json:"url"`
-	HTMLVersion       string         `json:"html_version"`
-	PageTitle         string         `json:"page_title"`
-	HeadingCounts     map[string]int `json:"heading_counts"`
-	InternalLinks     int            `json:"internal_links"`
-	ExternalLinks     int            `json:"external_links"`
-	InaccessibleLinks int            `json:"inaccessible_links"`
-	HasLoginForm      bool           `json:"has_login_form"`
-	Error             *AnalysisError `json:"error,omitempty"`
-	StatusCode        int            `json:"status_code,omitempty"`
+	// ID and Permalink identify the stored copy of the result when a result store is configured
+	ID                 string              `json:"id,omitempty"`
+	Permalink          string              `json:"permalink,omitempty"`
+	URL                string              `json:"url"`
+	NormalizedURL      string              `json:"normalized_url,omitempty"`
+	HostUnicode        string              `json:"host_unicode,omitempty"`
+	HostASCII          string              `json:"host_ascii,omitempty"`
+	FinalURL           string              `json:"final_url,omitempty"`
+	FetchedAt          time.Time           `json:"fetched_at"`
+	AnalysisDurationMs int64               `json:"analysis_duration_ms"`
+	ContentLength      int64               `json:"content_length"`
+	CacheHit           bool                `json:"cache_hit"`
+	Coalesced          bool                `json:"coalesced,omitempty"`
+	HTMLVersion        string              `json:"html_version"`
+	PageTitle          string              `json:"page_title"`
+	TitleCount         int                 `json:"title_count"`
+	HeadingCounts      map[string]int      `json:"heading_counts"`
+	HeadingsText       map[string][]string `json:"headings_text,omitempty"`
+	InternalLinks      int                 `json:"internal_links"`
+	ExternalLinks      int                 `json:"external_links"`
+	InaccessibleLinks  int                 `json:"inaccessible_links"`
+	SkippedLinks       int                 `json:"skipped_links,omitempty"`
+	// UncheckedLinks counts the links left unchecked when the link check deadline passed
+	UncheckedLinks     int                  `json:"unchecked_links,omitempty"`
+	FailingHosts       []string             `json:"failing_hosts,omitempty"`
+	HasLoginForm       bool                 `json:"has_login_form"`
+	LoginForms         []LoginFormSecurity  `json:"login_forms,omitempty"`
+	Payment            *PaymentInfo         `json:"payment,omitempty"`
+	Consent            *ConsentInfo         `json:"consent,omitempty"`
+	Ads                *AdInfo              `json:"ads,omitempty"`
+	Paywall            *PaywallInfo         `json:"paywall,omitempty"`
+	MainContent        *MainContent         `json:"main_content,omitempty"`
+	ContentFingerprint string               `json:"content_fingerprint,omitempty"`
+	DeadAnchors        []string             `json:"dead_anchors,omitempty"`
+	Links              []string             `json:"links,omitempty"`
+	LinkDetails        []LinkDetail         `json:"link_details,omitempty"`
+	InaccessibleURLs   []string             `json:"inaccessible_urls,omitempty"`
+	ShortLinks         []ShortLinkExpansion `json:"short_links,omitempty"`
+	FlaggedURLs        []FlaggedURL         `json:"flagged_urls,omitempty"`
+	QuickCheck         *QuickCheckResult    `json:"quick_check,omitempty"`
+	CSP                *CSPAnalysis         `json:"csp,omitempty"`
+	InlineScripts      *InlineScriptReport  `json:"inline_scripts,omitempty"`
+	HTTPSReadiness     *HTTPSReadiness      `json:"https_readiness,omitempty"`
+	CDN                *CDNInfo             `json:"cdn,omitempty"`
+	Variants           *VariantComparison   `json:"variants,omitempty"`
+	Domain             *DomainInfo          `json:"domain,omitempty"`
+	PageSpeed          *PageSpeedReport     `json:"pagespeed,omitempty"`
+	ValidationIssues   []ValidationIssue    `json:"validation_issues,omitempty"`
+	DOM                *DOMMetrics          `json:"dom,omitempty"`
+	Maintenance        *MaintenanceInfo     `json:"maintenance,omitempty"`
+	Plugins            []PluginReport       `json:"plugins,omitempty"`
+	CustomFields       map[string]string    `json:"custom_fields,omitempty"`
+	Assertions         *AssertionReport     `json:"assertions,omitempty"`
+	Outbound           *OutboundUsage       `json:"outbound,omitempty"`
+	Timings            *AnalysisTimings     `json:"timings,omitempty"`
+	Snapshot           *HTMLSnapshot        `json:"-"` // kept when SnapshotLimit is set
+	Archive            *ArchivedSnapshot    `json:"archive,omitempty"`
+	Noindex            bool                 `json:"noindex,omitempty"`
+	Robots             *RobotsReport        `json:"robots,omitempty"`
+	Error              *AnalysisError       `json:"error,omitempty"`
+	StatusCode         int                  `json:"status_code,omitempty"`
+	RequestHeaders     map[string][]string  `json:"request_headers,omitempty"`
+	ResponseHeaders    map[string][]string  `json:"response_headers,omitempty"`
+
+	// StructuredData is the page's JSON-LD, microdata and RDFa, validated against rich result requirements
+	StructuredData   *StructuredDataReport  `json:"structured_data,omitempty"`
+	Hreflang         []HreflangLink         `json:"hreflang,omitempty"`
+	Images           *ImageReport           `json:"images,omitempty"`
+	ResponsiveImages *ResponsiveImageReport `json:"responsive_images,omitempty"`
+	NewTabLinks      *NewTabLinkReport      `json:"new_tab_links,omitempty"`
+	Snippet          *SnippetReport         `json:"snippet,omitempty"`
+	SEO              *SEOMetadata           `json:"seo,omitempty"`
+	SocialImages     *SocialImageReport     `json:"social_images,omitempty"`
+	AMP              *AMPReport             `json:"amp,omitempty"`
+	ClientSide       *ClientSideReport      `json:"client_side,omitempty"`
+	Interstitial     *InterstitialReport    `json:"interstitial,omitempty"`
+	TLS              *TLSInfo               `json:"tls,omitempty"`
+}
+
+// RobotsReport compares the page's indexing directives with robots.txt and the sitemap
+type RobotsReport struct {
+	Indexable          bool      `json:"indexable"`
+	MetaRobots         []string  `json:"meta_robots,omitempty"`
+	XRobotsTag         []string  `json:"x_robots_tag,omitempty"`
+	RobotsTxtURL       string    `json:"robots_txt_url"`
+	RobotsTxtStatus    int       `json:"robots_txt_status,omitempty"`
+	RobotsTxtError     string    `json:"robots_txt_error,omitempty"`
+	BlockedByRobotsTxt bool      `json:"blocked_by_robots_txt"`
+	MatchedRule        string    `json:"matched_rule,omitempty"`
+	Sitemaps           []string  `json:"sitemaps_checked,omitempty"`
+	InSitemap          bool      `json:"in_sitemap"`
+	SitemapURL         string    `json:"sitemap_url,omitempty"`
+	Contradictions     []Finding `json:"contradictions,omitempty"`
+	Consistent         bool      `json:"consistent"`
+}
+
+// PluginReport holds one plugin's findings for the page
+type PluginReport struct {
+	Plugin     string          `json:"plugin"`
+	Findings   []PluginFinding `json:"findings,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	DurationMs int64           `json:"duration_ms"`
+}
+
+// PluginFinding is the outcome of one check performed by a plugin
+type PluginFinding struct {
+	Check    string `json:"check"`
+	Passed   bool   `json:"passed"`
+	Severity string `json:"severity,omitempty"` // e.g. info, warning, error
+	Message  string `json:"message,omitempty"`
+}
+
+// MainContent holds the readable main content extracted from the page
+type MainContent struct {
+	Text               string `json:"text"`
+	WordCount          int    `json:"word_count"`
+	ReadingTimeMinutes int    `json:"reading_time_minutes"`
+}
+
+// LoginFormSecurity describes the security properties of a login form
+type LoginFormSecurity struct {
+	Action               string    `json:"action"`
+	Method               string    `json:"method"`
+	ActionHTTPS          bool      `json:"action_https"`
+	PageHTTPS            bool      `json:"page_https"`
+	PasswordAutocomplete string    `json:"password_autocomplete,omitempty"`
+	HasCSRFToken         bool      `json:"has_csrf_token"`
+	Findings             []Finding `json:"findings,omitempty"`
+}
+
+// PaymentInfo describes payment forms and payment provider embeds on the page
+type PaymentInfo struct {
+	Forms     []PaymentForm `json:"forms,omitempty"`
+	Providers []string      `json:"providers,omitempty"`
+	Findings  []Finding     `json:"findings,omitempty"`
+}
+
+// PaymentForm describes a form collecting payment card details
+type PaymentForm struct {
+	Action string   `json:"action"`
+	Fields []string `json:"fields"`
+	Secure bool     `json:"secure"`
+}
+
+// AdInfo describes the advertising present on the page
+type AdInfo struct {
+	Networks  []string `json:"networks,omitempty"`
+	SlotCount int      `json:"slot_count"`
+}
+
+// PaywallInfo describes paywall and registration-wall signals found on the page
+type PaywallInfo struct {
+	// LikelyGated is set when the content is likely behind a paywall or registration wall
+	LikelyGated bool `json:"likely_gated"`
+	// AccessibleForFree is the page's schema.org isAccessibleForFree, false when any item or part is gated
+	AccessibleForFree *bool    `json:"accessible_for_free,omitempty"`
+	GatedSections     []string `json:"gated_sections,omitempty"` // CSS selectors of the gated parts
+	Vendors           []string `json:"vendors,omitempty"`
+	Evidence          []string `json:"evidence,omitempty"`
+}
+
+// StructuredDataReport validates the schema.org items of the page against the
+// properties rich results require and recommend
+type StructuredDataReport struct {
+	Blocks      int                  `json:"blocks"` // JSON-LD blocks
+	Types       []string             `json:"types,omitempty"`
+	Items       []StructuredDataItem `json:"items,omitempty"`
+	ParseErrors []string             `json:"parse_errors,omitempty"`
+	Errors      int                  `json:"errors"`
+	Warnings    int                  `json:"warnings"`
+	// Valid is false when a block fails to parse or an item misses a required property
+	Valid bool `json:"valid"`
+}
+
+// StructuredDataItem is one top-level schema.org item
+type StructuredDataItem struct {
+	Type   string `json:"type"`
+	Format string `json:"format"`
+	// Checked is false for types without validation rules
+	Checked bool                  `json:"checked"`
+	Issues  []StructuredDataIssue `json:"issues,omitempty"`
+}
+
+// StructuredDataIssue is a missing or invalid property of a structured data item
+type StructuredDataIssue struct {
+	Severity string `json:"severity"`
+	Property string `json:"property,omitempty"`
+	Message  string `json:"message"`
+}
+
+// ResponsiveImageReport describes how the page's images adapt to screen sizes
+type ResponsiveImageReport struct {
+	Images               int       `json:"images"`
+	WithSrcset           int       `json:"with_srcset"`
+	InPicture            int       `json:"in_picture"`
+	MissingDimensions    int       `json:"missing_dimensions"`
+	LargeWithoutVariants int       `json:"large_without_variants"`
+	Findings             []Finding `json:"findings,omitempty"`
+}
+
+// NewTabLinkReport counts links opening in a new tab or window
+type NewTabLinkReport struct {
+	NewTabLinks int `json:"new_tab_links"`
+	// FromBaseTarget counts the links opening in a new tab only because of <base target>
+	FromBaseTarget int    `json:"from_base_target"`
+	BaseTarget     string `json:"base_target,omitempty"`
+	// MissingNoopener counts links without rel="noopener" or "noreferrer", whose
+	// opened page can navigate this one through window.opener
+	MissingNoopener int      `json:"missing_noopener"`
+	Examples        []string `json:"examples,omitempty"`
+}
+
+// ImageReport counts the page's <img> elements and their alt text. Broken and
+// Largest are set when the images were checked.
+type ImageReport struct {
+	Images     int `json:"images"`
+	MissingAlt int `json:"missing_alt"`
+	// EmptyAlt counts alt="", which marks decorative images
+	EmptyAlt int `json:"empty_alt"`
+	// AltCoverage is the percentage of images with an alt attribute
+	AltCoverage float64       `json:"alt_coverage"`
+	Checked     int           `json:"checked,omitempty"`
+	Broken      []BrokenImage `json:"broken,omitempty"`
+	Largest     []ImageSize   `json:"largest,omitempty"`
+}
+
+// BrokenImage is an image whose HEAD check failed
+type BrokenImage struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ImageSize is an image's Content-Length
+type ImageSize struct {
+	URL   string `json:"url"`
+	Bytes int64  `json:"bytes"`
+}
+
+// SocialImageReport lists the Open Graph and Twitter card images shown in social previews
+type SocialImageReport struct {
+	Images []SocialImage `json:"images"`
+	// Broken counts images whose HEAD check failed
+	Broken int `json:"broken"`
+	// MissingDimensions counts og:image entries without og:image:width and og:image:height
+	MissingDimensions int `json:"missing_dimensions"`
+}
+
+// SocialImage is one og:image or twitter:image
+type SocialImage struct {
+	Property string `json:"property"`
+	URL      string `json:"url"`
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+	// Accessible is omitted when the image was not checked
+	Accessible *bool `json:"accessible,omitempty"`
+}
+
+// AMPReport checks that an AMP page and its canonical page point at each other
+type AMPReport struct {
+	IsAMP     bool   `json:"is_amp"`
+	Canonical string `json:"canonical,omitempty"`
+	AMPURL    string `json:"amp_url,omitempty"`
+	// Counterpart is the other page of the pair when it was fetched
+	Counterpart       string     `json:"counterpart,omitempty"`
+	CounterpartStatus int        `json:"counterpart_status,omitempty"`
+	Issues            []AMPIssue `json:"issues,omitempty"`
+	Consistent        bool       `json:"consistent"`
+}
+
+// AMPIssue is one inconsistency between an AMP page and its canonical page
+type AMPIssue struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// ClientSideReport flags redirects and rendering done in the browser, which
+// analysis of the served HTML cannot see
+type ClientSideReport struct {
+	Redirects  []ClientRedirect `json:"redirects,omitempty"`
+	Frameworks []string         `json:"frameworks,omitempty"`
+	Evidence   []string         `json:"evidence,omitempty"`
+	// EmptyShell is set when content is rendered into an empty app root
+	EmptyShell bool `json:"empty_shell"`
+	// RenderingRecommended is set when the page should be analyzed after JavaScript runs
+	RenderingRecommended bool      `json:"rendering_recommended"`
+	Findings             []Finding `json:"findings,omitempty"`
+}
+
+// InterstitialReport flags age gates, cookie walls and full-screen overlays,
+// which may stand in for the content the analysis is meant to describe
+type InterstitialReport struct {
+	Kinds    []string `json:"kinds"` // age_gate, cookie_wall or overlay
+	Evidence []string `json:"evidence,omitempty"`
+	// ReplacesContent is set when the page has little text besides the
+	// interstitial, so the results likely describe the interstitial
+	ReplacesContent bool      `json:"replaces_content"`
+	Findings        []Finding `json:"findings,omitempty"`
+}
+
+// ClientRedirect is a redirect performed by a script or <meta http-equiv="refresh">
+type ClientRedirect struct {
+	Method string `json:"method"`
+	// Target is omitted when a script computes it
+	Target       string  `json:"target,omitempty"`
+	DelaySeconds float64 `json:"delay_seconds,omitempty"`
+	Code         string  `json:"code,omitempty"`
+}
+
+// SnippetReport measures the title and meta description shown in search results
+type SnippetReport struct {
+	Title           TextLength `json:"title"`
+	MetaDescription TextLength `json:"meta_description"`
+}
+
+// SEOMetadata is the page metadata read by search engines; fields the page
+// does not declare are empty
+type SEOMetadata struct {
+	Description string   `json:"description,omitempty"`
+	Keywords    []string `json:"keywords,omitempty"`
+	Canonical   string   `json:"canonical,omitempty"` // resolved against the page URL
+	Robots      []string `json:"robots,omitempty"`    // meta robots and googlebot directives, lowercased
+	Viewport    string   `json:"viewport,omitempty"`
+}
+
+// TextLength is the character count and estimated pixel width of a text, with
+// the thresholds it was judged against
+type TextLength struct {
+	Text       string `json:"text,omitempty"`
+	Characters int    `json:"characters"`
+	Pixels     int    `json:"pixels"`
+	MinChars   int    `json:"min_chars"`
+	MaxChars   int    `json:"max_chars"`
+	MaxPixels  int    `json:"max_pixels"`
+	// Verdict is missing, too_short, too_long or ok
+	Verdict string `json:"verdict"`
+}
+
+// ConsentInfo describes cookie-consent tooling found on the page
+type ConsentInfo struct {
+	BannerPresent bool     `json:"banner_present"`
+	Platforms     []string `json:"platforms,omitempty"`
+	Evidence      []string `json:"evidence,omitempty"`
+}
+
+// InlineScriptReport summarizes inline JavaScript that blocks a strict CSP
+type InlineScriptReport struct {
+	EventHandlerCount  int                   `json:"event_handler_count"`
+	EventHandlers      map[string]int        `json:"event_handlers,omitempty"`
+	JavaScriptURLCount int                   `json:"javascript_url_count"`
+	EvalCount          int                   `json:"eval_count"`
+	Examples           []InlineScriptExample `json:"examples,omitempty"`
+	Findings           []Finding             `json:"findings,omitempty"`
+}
+
+// InlineScriptExample is a sample of detected inline JavaScript
+type InlineScriptExample struct {
+	Type      string `json:"type"`
+	Element   string `json:"element"`
+	Attribute string `json:"attribute,omitempty"`
+	Value     string `json:"value"`
+}
+
+// DOMMetrics describes the size and shape of the parsed document tree
+type DOMMetrics struct {
+	NodeCount          int       `json:"node_count"`
+	MaxDepth           int       `json:"max_depth"`
+	MaxChildren        int       `json:"max_children"`
+	MaxChildrenElement string    `json:"max_children_element,omitempty"`
+	Findings           []Finding `json:"findings,omitempty"`
+}
+
+// CDNInfo identifies the content delivery network serving the page
+type CDNInfo struct {
+	Provider string   `json:"provider"`
+	Evidence []string `json:"evidence"`
+}
+
+// DomainInfo describes the registration of the analyzed domain
+type DomainInfo struct {
+	Domain          string     `json:"domain"`
+	Registrar       string     `json:"registrar,omitempty"`
+	CreatedAt       *time.Time `json:"created_at,omitempty"`
+	UpdatedAt       *time.Time `json:"updated_at,omitempty"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	AgeDays         int        `json:"age_days,omitempty"`
+	DaysUntilExpiry int        `json:"days_until_expiry,omitempty"`
+	Status          []string   `json:"status,omitempty"`
+	Nameservers     []string   `json:"nameservers,omitempty"`
+	Error           string     `json:"error,omitempty"`
+}
+
+// AnalysisEvent is the message published for each completed analysis
+type AnalysisEvent struct {
+	Type      string          `json:"type"`
+	Timestamp time.Time       `json:"timestamp"`
+	Result    *AnalysisResult `json:"result"`
+}
+
+// Notification is raised when a notification rule fires for an analysis
+type Notification struct {
+	Rule      string    `json:"rule"`
+	Condition string    `json:"condition"`
+	URL       string    `json:"url"`
+	Message   string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// FlaggedURL is a URL reported as malicious by a threat checker
+type FlaggedURL struct {
+	URL    string `json:"url"`
+	Threat string `json:"threat"`
+	Source string `json:"source"`
+}
+
+// DuplicateReport lists near-duplicate pages among a set of analyzed URLs
+type DuplicateReport struct {
+	Threshold  int               `json:"threshold"`
+	Pages      []PageFingerprint `json:"pages"`
+	Duplicates []DuplicatePair   `json:"duplicates"`
+}
+
+// PageFingerprint holds the content fingerprint computed for a single URL
+type PageFingerprint struct {
+	URL         string `json:"url"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// DuplicatePair describes two pages with near-identical content
+type DuplicatePair struct {
+	URLA       string  `json:"url_a"`
+	URLB       string  `json:"url_b"`
+	Distance   int     `json:"distance"`
+	Similarity float64 `json:"similarity"`
+}
+
+// HreflangLink is a language alternate declared by a page
+type HreflangLink struct {
+	Lang string `json:"lang"`
+	URL  string `json:"url"`
+}
+
+// HreflangPage is an analyzed page with the hreflang alternates it declares
+type HreflangPage struct {
+	URL        string
+	FinalURL   string
+	Alternates []HreflangLink
+}
+
+// HreflangReport checks the hreflang annotations of a set of pages for reciprocity
+type HreflangReport struct {
+	Pages     int             `json:"pages"`
+	Annotated int             `json:"annotated"`
+	Issues    []HreflangIssue `json:"issues,omitempty"`
+	// Unverified counts alternates pointing outside the analyzed pages
+	Unverified int      `json:"unverified"`
+	Failed     []string `json:"failed,omitempty"`
+	Consistent bool     `json:"consistent"`
+}
+
+// HreflangIssue is a broken hreflang pair or a missing self-reference
+type HreflangIssue struct {
+	Type    string `json:"type"`
+	URL     string `json:"url"`
+	Target  string `json:"target,omitempty"`
+	Lang    string `json:"lang,omitempty"`
+	Message string `json:"message"`
+}
+
+// QuickCheckResult describes the outcome of a HEAD-only reachability check
+type QuickCheckResult struct {
+	Reachable     bool                `json:"reachable"`
+	RedirectChain []RedirectHop       `json:"redirect_chain,omitempty"`
+	Headers       map[string][]string `json:"headers,omitempty"`
+	TLS           *TLSInfo            `json:"tls,omitempty"`
+}
+
+// RedirectHop represents a single redirect response on the way to the final URL
+type RedirectHop struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code"`
+}
+
+// TLSInfo describes the negotiated TLS connection and the leaf certificate
+type TLSInfo struct {
+	Version     string    `json:"version"`
+	CipherSuite string    `json:"cipher_suite"`
+	ServerName  string    `json:"server_name,omitempty"`
+	Subject     string    `json:"subject,omitempty"`
+	Issuer      string    `json:"issuer,omitempty"`
+	NotBefore   time.Time `json:"not_before"`
+	NotAfter    time.Time `json:"not_after"`
+	// DaysUntilExpiry is negative once the certificate has expired
+	DaysUntilExpiry int       `json:"days_until_expiry"`
+	SANs            []string  `json:"sans,omitempty"` // DNS names and IP addresses the certificate covers
+	Findings        []Finding `json:"findings,omitempty"`
+}
+
+// MaintenanceInfo describes a detected maintenance or holding page
+type MaintenanceInfo struct {
+	RetryAfter string   `json:"retry_after,omitempty"`
+	Indicators []string `json:"indicators"`
+	// HoldingPage is set when the page stands in for the site's content, which
+	// fails the analysis with ErrCodeMaintenance; otherwise the page is analyzed
+	HoldingPage bool `json:"holding_page"`
+}
+
+// ValidationIssue represents a structural HTML problem found during validation
+type ValidationIssue struct {
+	Type    string `json:"type"`
+	Element string `json:"element"`
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// Finding represents a single structured observation produced by an analysis check
+type Finding struct {
+	Severity string `json:"severity"`
+	Subject  string `json:"subject,omitempty"`
+	Message  string `json:"message"`
+}
+
+// CSPAnalysis describes the Content-Security-Policy applied to the page
+type CSPAnalysis struct {
+	Present bool     `json:"present"`
+	Sources []string `json:"sources,omitempty"`
+	// Directives holds the first declaration of each directive across the policies
+	Directives map[string][]string `json:"directives,omitempty"`
+	Findings   []Finding           `json:"findings,omitempty"`
+}
+
+// HTTPSReadiness describes how well the site enforces HTTPS
+type HTTPSReadiness struct {
+	HTTPSAvailable   bool        `json:"https_available"`
+	RedirectsToHTTPS bool        `json:"redirects_to_https"`
+	HSTS             *HSTSPolicy `json:"hsts,omitempty"`
+	Grade            string      `json:"grade"`
+	Findings         []Finding   `json:"findings,omitempty"`
+}
+
+// HSTSPolicy represents a parsed Strict-Transport-Security header
+type HSTSPolicy struct {
+	MaxAge            int64 `json:"max_age"`
+	IncludeSubDomains bool  `json:"include_subdomains"`
+	Preload           bool  `json:"preload"`
+}
+
+// VariantComparison describes how the http/https and www/non-www variants of a URL behave
+type VariantComparison struct {
+	Variants    []VariantResult `json:"variants"`
+	LandingURLs []string        `json:"landing_urls"`
+	Consistent  bool            `json:"consistent"`
+	Findings    []Finding       `json:"findings,omitempty"`
+}
+
+// VariantResult represents the outcome of fetching a single URL variant
+type VariantResult struct {
+	RequestURL string `json:"request_url"`
+	LandingURL string `json:"landing_url,omitempty"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Title      string `json:"title,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ShortLinkExpansion records the destination of a link to a URL shortener
+type ShortLinkExpansion struct {
+	ShortURL string `json:"short_url"`
+	FinalURL string `json:"final_url,omitempty"`
+	Error    string `json:"error,omitempty"`
 }
 
 // CacheEntry represents a cached analysis result
@@ -31,13 +648,34 @@ type LinkResult struct {
 	Link         string
 	IsInternal   bool
 	IsAccessible bool
+	Skipped      bool
 	Error        error
+	// StatusCode and Latency describe the check of an external link; a zero
+	// status means it was not checked or could not be reached (CheckError)
+	StatusCode int
+	Latency    time.Duration
+	CheckError error
+	// ContentLength is set by image checks, -1 when the response declared none
+	ContentLength int64
+}
+
+// LinkDetail describes one link on the page and the check made on it. Only
+// external links are checked; internal ones are assumed accessible.
+type LinkDetail struct {
+	URL         string `json:"url"` // as written in the page
+	AbsoluteURL string `json:"absolute_url"`
+	Internal    bool   `json:"internal"`
+	Accessible  bool   `json:"accessible"`
+	Skipped     bool   `json:"skipped,omitempty"`
+	StatusCode  int    `json:"status_code,omitempty"`
+	LatencyMs   int64  `json:"latency_ms,omitempty"`
+	Error       string `json:"error,omitempty"` // why the link could not be reached
 }
 
 // AnalysisJob represents a job for the worker pool
 type AnalysisJob struct {
 	Link    string
-	BaseURL string
+	BaseURL *url.URL
 }
 
 // AnalysisWorkerPool manages concurrent link analysis
@@ -45,7 +683,8 @@ type AnalysisWorkerPool struct {
 	workers  int
 	jobQueue chan AnalysisJob
 	results  chan LinkResult
-	stopChan chan struct{}
-	analyzer *Analyzer
+	handle   func(context.Context, AnalysisJob) LinkResult
+	counters *workerPoolCounters
+	limit    *adaptiveLimit // nil runs all workers at once
 	workerWg sync.WaitGroup
 }
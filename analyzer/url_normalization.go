@@ -0,0 +1,97 @@
+package analyzer
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// trackingParamPrefixes are query parameter prefixes used purely for campaign tracking
+var trackingParamPrefixes = []string{"utm_"}
+
+// trackingParams are query parameters used purely for click and campaign tracking
+var trackingParams = map[string]bool{
+	"gclid":   true,
+	"dclid":   true,
+	"fbclid":  true,
+	"msclkid": true,
+	"yclid":   true,
+	"igshid":  true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"_ga":     true,
+	"_gl":     true,
+}
+
+// CanonicalizeURL returns a normalized form of a parsed URL so that equivalent spellings
+// compare equal: the scheme and host are lowercased, default ports and the fragment are
+// removed, an empty path becomes "/" and query parameters are sorted. Tracking parameters
+// are dropped when stripTracking is set.
+func CanonicalizeURL(parsedURL *url.URL, stripTracking bool) string {
+	canonical := *parsedURL
+	canonical.Scheme = strings.ToLower(canonical.Scheme)
+	canonical.Fragment = ""
+	canonical.RawFragment = ""
+
+	host := strings.ToLower(canonical.Hostname())
+	port := canonical.Port()
+	if (canonical.Scheme == "http" && port == "80") || (canonical.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	host = strings.TrimSuffix(host, ".")
+	if port != "" {
+		canonical.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		canonical.Host = "[" + host + "]"
+	} else {
+		canonical.Host = host
+	}
+
+	if canonical.Path == "" {
+		canonical.Path = "/"
+		canonical.RawPath = ""
+	}
+
+	query := canonical.Query()
+	if stripTracking {
+		for key := range query {
+			if isTrackingParam(key) {
+				query.Del(key)
+			}
+		}
+	}
+	// Encode sorts parameters by key
+	canonical.RawQuery = query.Encode()
+	canonical.ForceQuery = false
+
+	return canonical.String()
+}
+
+// isTrackingParam reports whether a query parameter only carries tracking information
+func isTrackingParam(key string) bool {
+	key = strings.ToLower(key)
+	if trackingParams[key] {
+		return true
+	}
+	for _, prefix := range trackingParamPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanonicalURL normalizes and canonicalizes a URL as entered, returning the form
+// results record as their NormalizedURL
+func (a *Analyzer) CanonicalURL(targetURL string) (string, error) {
+	parsedURL, err := a.normalizeURL(targetURL)
+	if err != nil {
+		return "", err
+	}
+	return CanonicalizeURL(parsedURL, a.stripTrackingParams), nil
+}
+
+// cacheKeyFor builds the cache and deduplication key for a parsed URL and option set
+func (a *Analyzer) cacheKeyFor(parsedURL *url.URL, opts AnalysisOptions) string {
+	return CanonicalizeURL(parsedURL, a.stripTrackingParams) + opts.cacheKeySuffix()
+}
@@ -0,0 +1,135 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"web-page-analyzer/logger"
+
+	"golang.org/x/net/html"
+)
+
+// compareVariants fetches every scheme and www/non-www variant of the URL and
+// reports inconsistent canonicalization between them
+func (a *Analyzer) compareVariants(ctx context.Context, parsedURL *url.URL) *VariantComparison {
+	variantURLs := buildVariantURLs(parsedURL)
+	comparison := &VariantComparison{
+		Variants: make([]VariantResult, len(variantURLs)),
+	}
+
+	var wg sync.WaitGroup
+	for i, variantURL := range variantURLs {
+		wg.Add(1)
+		go func(i int, variantURL string) {
+			defer wg.Done()
+			comparison.Variants[i] = a.fetchVariant(ctx, variantURL)
+		}(i, variantURL)
+	}
+	wg.Wait()
+
+	titles := make(map[string]bool)
+	reachable := 0
+	for _, variant := range comparison.Variants {
+		if variant.Error != "" {
+			comparison.Findings = append(comparison.Findings, Finding{
+				Severity: SeverityLow,
+				Subject:  variant.RequestURL,
+				Message:  fmt.Sprintf("%s could not be fetched: %s", variant.RequestURL, variant.Error),
+			})
+			continue
+		}
+		reachable++
+		comparison.LandingURLs = appendUnique(comparison.LandingURLs, variant.LandingURL)
+		titles[variant.Title] = true
+	}
+
+	if len(comparison.LandingURLs) > 1 {
+		comparison.Findings = append(comparison.Findings, Finding{
+			Severity: SeverityMedium,
+			Message:  fmt.Sprintf("Variants land on %d different URLs instead of a single canonical URL", len(comparison.LandingURLs)),
+		})
+	}
+	if len(titles) > 1 {
+		comparison.Findings = append(comparison.Findings, Finding{
+			Severity: SeverityLow,
+			Message:  "Variants serve pages with different titles",
+		})
+	}
+
+	comparison.Consistent = reachable == len(comparison.Variants) && len(comparison.LandingURLs) == 1 && len(titles) == 1
+	return comparison
+}
+
+// buildVariantURLs returns the http/https and www/non-www variants of a URL.
+// Hosts that are IP addresses or have no parent domain only get scheme variants.
+func buildVariantURLs(parsedURL *url.URL) []string {
+	hostname := parsedURL.Hostname()
+	hosts := []string{hostname}
+	if net.ParseIP(hostname) == nil && strings.Contains(hostname, ".") {
+		bare := strings.TrimPrefix(hostname, "www.")
+		hosts = []string{bare, "www." + bare}
+	}
+
+	var variants []string
+	for _, scheme := range []string{"http", "https"} {
+		for _, host := range hosts {
+			variant := *parsedURL
+			variant.Scheme = scheme
+			variant.Host = host
+			if port := parsedURL.Port(); port != "" {
+				variant.Host = net.JoinHostPort(host, port)
+			}
+			variant.Fragment = ""
+			variants = append(variants, variant.String())
+		}
+	}
+	return variants
+}
+
+// fetchVariant fetches a single variant and records where it lands and its title
+func (a *Analyzer) fetchVariant(ctx context.Context, variantURL string) VariantResult {
+	variant := VariantResult{RequestURL: variantURL}
+
+	fetchCtx, cancel := context.WithTimeout(ctx, VariantFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(fetchCtx, "GET", variantURL, nil)
+	if err != nil {
+		variant.Error = err.Error()
+		return variant
+	}
+	setBrowserHeaders(req)
+
+	client := a.getHTTPClient()
+	defer a.putHTTPClient(client)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		variant.Error = err.Error()
+		return variant
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			logger.WithAnalysis(variantURL).Debugw("Failed to close response body", "error", closeErr)
+		}
+	}()
+
+	variant.LandingURL = resp.Request.URL.String()
+	variant.StatusCode = resp.StatusCode
+
+	body, err := readBody(resp.Body, VariantBodyLimit)
+	if err == nil {
+		if doc, parseErr := html.Parse(bytes.NewReader(body.Bytes())); parseErr == nil {
+			variant.Title, _ = a.extractPageTitle(doc)
+		}
+		releaseBuffer(body)
+	}
+
+	return variant
+}
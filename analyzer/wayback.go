@@ -0,0 +1,200 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"web-page-analyzer/logger"
+)
+
+// Internet Archive endpoints: the availability API finds the snapshot closest
+// to a date, and the archive serves it
+const (
+	WaybackAvailabilityEndpoint = "https://archive.org/wayback/available"
+	WaybackArchiveEndpoint      = "https://web.archive.org/web/"
+)
+
+// waybackTimestamp is the layout of Wayback Machine timestamps
+const waybackTimestamp = "20060102150405"
+
+// ArchivedSnapshot identifies the Wayback Machine capture an analysis ran on
+type ArchivedSnapshot struct {
+	RequestedAt time.Time `json:"requested_at"` // the date asked for
+	CapturedAt  time.Time `json:"captured_at"`  // when the closest capture was made
+	URL         string    `json:"url"`          // the capture as shown by the Wayback Machine
+}
+
+// WaybackClient finds archived captures of pages in the Wayback Machine
+type WaybackClient struct {
+	availability string
+	archive      string
+	httpClient   *http.Client
+}
+
+// NewWaybackClient creates a client using the given availability API and
+// archive endpoints
+func NewWaybackClient(availability, archive string) *WaybackClient {
+	return &WaybackClient{
+		availability: availability,
+		archive:      archive,
+		httpClient:   &http.Client{Timeout: WaybackLookupTimeout},
+	}
+}
+
+// waybackAvailability is the availability API response
+type waybackAvailability struct {
+	ArchivedSnapshots struct {
+		Closest *struct {
+			Available bool   `json:"available"`
+			Timestamp string `json:"timestamp"`
+		} `json:"closest"`
+	} `json:"archived_snapshots"`
+}
+
+// Closest returns the capture of pageURL closest to at, or nil when the page
+// was never archived
+func (c *WaybackClient) Closest(ctx context.Context, pageURL string, at time.Time) (*ArchivedSnapshot, error) {
+	query := url.Values{"url": {pageURL}, "timestamp": {at.UTC().Format(waybackTimestamp)}}
+	req, err := http.NewRequestWithContext(ctx, "GET", c.availability+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("availability lookup failed: HTTP %d", resp.StatusCode)
+	}
+
+	var data waybackAvailability
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+	closest := data.ArchivedSnapshots.Closest
+	if closest == nil || !closest.Available {
+		return nil, nil
+	}
+	captured, err := time.Parse(waybackTimestamp, closest.Timestamp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid capture timestamp %q", closest.Timestamp)
+	}
+	return &ArchivedSnapshot{
+		RequestedAt: at.UTC(),
+		CapturedAt:  captured,
+		URL:         c.archive + closest.Timestamp + "/" + pageURL,
+	}, nil
+}
+
+// rawURL returns the URL serving a capture as it was archived, without the
+// Wayback Machine's banner and link rewriting
+func (c *WaybackClient) rawURL(snapshot *ArchivedSnapshot, pageURL string) string {
+	return c.archive + snapshot.CapturedAt.Format(waybackTimestamp) + "id_/" + pageURL
+}
+
+// ParseArchiveDate parses the date of a capture to analyze: a date such as
+// 2024-01-15, an RFC 3339 time, or a Wayback Machine timestamp of 4 to 14
+// digits such as 20240115 or 20240115093000
+func ParseArchiveDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date, nil
+	}
+	if date, err := time.Parse(time.RFC3339, value); err == nil {
+		return date.UTC(), nil
+	}
+	if len(value) >= 4 && len(value) <= len(waybackTimestamp) && len(value)%2 == 0 {
+		if date, err := time.Parse(waybackTimestamp[:len(value)], value); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid archive date %q: use YYYY-MM-DD, RFC 3339 or a Wayback timestamp", value)
+}
+
+// archivedHeaders returns the original response headers the Wayback Machine
+// sends with a raw capture under an X-Archive-Orig- prefix
+func archivedHeaders(header http.Header) http.Header {
+	original := make(http.Header)
+	for name, values := range header {
+		if name, ok := strings.CutPrefix(name, "X-Archive-Orig-"); ok {
+			original[http.CanonicalHeaderKey(name)] = values
+		}
+	}
+	return original
+}
+
+// performArchivedAnalysis analyzes the Wayback Machine capture of the page
+// closest to opts.ArchiveDate instead of the live page. The capture is fetched
+// like a page, and analyzed with the headers and status it was archived with.
+func (a *Analyzer) performArchivedAnalysis(ctx context.Context, parsedURL *url.URL, result *AnalysisResult, opts AnalysisOptions) error {
+	pageURL := parsedURL.String()
+	snapshot, err := a.wayback.Closest(ctx, pageURL, opts.ArchiveDate)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		result.Error = NewAnalysisError(ErrCodeArchiveError, "Internet Archive lookup failed").
+			WithURL(pageURL).
+			WithDetails(err.Error())
+		return nil
+	}
+	if snapshot == nil {
+		result.Error = NewAnalysisError(ErrCodeNotArchived, "The Internet Archive has no capture of this page").
+			WithURL(pageURL)
+		return nil
+	}
+	result.Archive = snapshot
+
+	req, err := http.NewRequestWithContext(ctx, "GET", a.wayback.rawURL(snapshot, pageURL), nil)
+	if err != nil {
+		return err
+	}
+	setBrowserHeaders(req)
+	client := a.httpClientPool.Get().(*http.Client)
+	defer a.httpClientPool.Put(client)
+
+	stopFetch := timePhase(ctx, phaseFetch)
+	defer stopFetch()
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// The archive answers with the status of the capture
+	result.StatusCode = resp.StatusCode
+	result.FinalURL = pageURL
+	result.FetchedAt = snapshot.CapturedAt
+	header := archivedHeaders(resp.Header)
+	if opts.IncludeHeaders {
+		result.ResponseHeaders = header
+	}
+	if resp.StatusCode >= 400 {
+		result.Error = NewAnalysisError(ErrCodeHTTPError, "Archived capture is an error response").WithStatusCode(resp.StatusCode)
+		return nil
+	}
+
+	body, err := readBody(resp.Body, a.maxBodySize+1)
+	if err != nil {
+		return err
+	}
+	defer releaseBuffer(body)
+	if int64(body.Len()) > a.maxBodySize {
+		return &contentTooLargeError{limit: a.maxBodySize}
+	}
+	result.ContentLength = int64(body.Len())
+	stopFetch()
+
+	logger.WithAnalysis(pageURL).Infow("Analyzing archived capture",
+		"captured_at", snapshot.CapturedAt,
+		"requested_at", snapshot.RequestedAt,
+		"status", resp.StatusCode,
+	)
+	return a.analyzeSnapshot(ctx, body.Bytes(), header, result, opts)
+}
@@ -1,92 +1,334 @@
 package analyzer
 
 import (
-	"net/url"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// NewAnalysisWorkerPool creates a new worker pool for link analysis
-func NewAnalysisWorkerPool(workers int, analyzer *Analyzer) *AnalysisWorkerPool {
-	// Increase buffer sizes for high-throughput processing
-	bufferSize := workers * BufferMultiplier // 4x buffer for better throughput
+// WorkerPoolConfig sizes the worker pool each analysis uses to check its links
+type WorkerPoolConfig struct {
+	// MinWorkers and MaxWorkers bound the concurrent checks of a page: each pool
+	// starts at MinWorkers and adapts between them as its checks come back
+	MinWorkers int `json:"min_workers"`
+	MaxWorkers int `json:"max_workers"`
+	// QueueMultiplier is the job queue capacity per worker
+	QueueMultiplier int `json:"queue_multiplier"`
+}
+
+// DefaultWorkerPoolConfig returns the built-in worker pool sizing
+func DefaultWorkerPoolConfig() WorkerPoolConfig {
+	return WorkerPoolConfig{MinWorkers: MinWorkers, MaxWorkers: MaxWorkers, QueueMultiplier: BufferMultiplier}
+}
+
+// WorkerPoolStats reports link-check worker pools across all running analyses
+type WorkerPoolStats struct {
+	WorkerPoolConfig
+	ActivePools   int64   `json:"active_pools"`
+	Workers       int64   `json:"workers"`
+	BusyWorkers   int64   `json:"busy_workers"`
+	QueueDepth    int64   `json:"queue_depth"`
+	QueueCapacity int64   `json:"queue_capacity"`
+	Utilization   float64 `json:"utilization"` // busy workers / workers
+	JobsProcessed int64   `json:"jobs_processed"`
+	// ConcurrencyLimit sums the current adaptive limits of the active pools, and
+	// Backoffs counts the times a pool halved its limit
+	ConcurrencyLimit int64 `json:"concurrency_limit"`
+	Backoffs         int64 `json:"backoffs"`
+}
+
+// workerPoolCounters aggregates the state of every pool an analyzer starts
+type workerPoolCounters struct {
+	activePools   atomic.Int64
+	workers       atomic.Int64
+	busy          atomic.Int64
+	queued        atomic.Int64
+	queueCapacity atomic.Int64
+	processed     atomic.Int64
+	limit         atomic.Int64
+	backoffs      atomic.Int64
+}
+
+// snapshot returns the current counters for the given configuration
+func (c *workerPoolCounters) snapshot(config WorkerPoolConfig) WorkerPoolStats {
+	stats := WorkerPoolStats{
+		WorkerPoolConfig: config,
+		ActivePools:      c.activePools.Load(),
+		Workers:          c.workers.Load(),
+		BusyWorkers:      c.busy.Load(),
+		QueueDepth:       c.queued.Load(),
+		QueueCapacity:    c.queueCapacity.Load(),
+		JobsProcessed:    c.processed.Load(),
+		ConcurrencyLimit: c.limit.Load(),
+		Backoffs:         c.backoffs.Load(),
+	}
+	if stats.Workers > 0 {
+		stats.Utilization = float64(stats.BusyWorkers) / float64(stats.Workers)
+	}
+	return stats
+}
 
+// NewAnalysisWorkerPool creates a pool of workers running handle for each submitted
+// job, with a job queue of queueSize. Counters may be nil.
+func NewAnalysisWorkerPool(workers, queueSize int, handle func(context.Context, AnalysisJob) LinkResult, counters *workerPoolCounters) *AnalysisWorkerPool {
+	if counters == nil {
+		counters = &workerPoolCounters{}
+	}
 	return &AnalysisWorkerPool{
 		workers:  workers,
-		jobQueue: make(chan AnalysisJob, bufferSize),
-		results:  make(chan LinkResult, bufferSize),
-		stopChan: make(chan struct{}),
-		analyzer: analyzer,
+		jobQueue: make(chan AnalysisJob, queueSize),
+		results:  make(chan LinkResult, queueSize),
+		handle:   handle,
+		counters: counters,
 	}
 }
 
-// Starts the worker pool and begins processing jobs
-func (wp *AnalysisWorkerPool) Start() {
+// Start launches the workers; they stop once the queue is closed and drained or ctx is done
+func (wp *AnalysisWorkerPool) Start(ctx context.Context) {
+	wp.counters.activePools.Add(1)
+	wp.counters.workers.Add(int64(wp.workers))
+	wp.counters.queueCapacity.Add(int64(cap(wp.jobQueue)))
+
 	for i := 0; i < wp.workers; i++ {
 		wp.workerWg.Add(1)
-		go wp.worker()
+		go wp.worker(ctx)
 	}
 }
 
-// Stops the worker pool gracefully and waits for all workers to finish
-func (wp *AnalysisWorkerPool) Stop() {
-	close(wp.stopChan)
-	close(wp.jobQueue)
-	wp.workerWg.Wait()
-	close(wp.results)
-}
-
-// SubmitJob submits a job to the worker pool for processing
-func (wp *AnalysisWorkerPool) SubmitJob(job AnalysisJob) {
+// Submit queues a job, blocking while the queue is full, until ctx is done
+func (wp *AnalysisWorkerPool) Submit(ctx context.Context, job AnalysisJob) error {
 	select {
 	case wp.jobQueue <- job:
-		// Job submitted successfully
-	default:
-		// Job queue is full, process synchronously for high-throughput
-		// This prevents blocking when processing many links
-		wp.processJob(job)
+		wp.counters.queued.Add(1)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
-// GetResults returns the results channel
-func (wp *AnalysisWorkerPool) GetResults() <-chan LinkResult {
+// Close signals that no more jobs will be submitted
+func (wp *AnalysisWorkerPool) Close() {
+	close(wp.jobQueue)
+}
+
+// Wait waits for the workers to exit and releases the pool's counters. Jobs
+// left in the queue when ctx ended are discarded.
+func (wp *AnalysisWorkerPool) Wait() {
+	wp.workerWg.Wait()
+	wp.limit.close()
+	wp.counters.queued.Add(-int64(len(wp.jobQueue)))
+	wp.counters.activePools.Add(-1)
+	wp.counters.workers.Add(-int64(wp.workers))
+	wp.counters.queueCapacity.Add(-int64(cap(wp.jobQueue)))
+}
+
+// Results returns the channel workers deliver results on
+func (wp *AnalysisWorkerPool) Results() <-chan LinkResult {
 	return wp.results
 }
 
-// worker is the main worker goroutine
-func (wp *AnalysisWorkerPool) worker() {
+// worker processes jobs until the queue is closed or ctx is done; with an
+// adaptive limit it waits for a slot before taking each job
+func (wp *AnalysisWorkerPool) worker(ctx context.Context) {
 	defer wp.workerWg.Done()
 
 	for {
+		var started time.Time
+		if wp.limit != nil {
+			var err error
+			if started, err = wp.limit.acquire(ctx); err != nil {
+				return
+			}
+		}
+
+		var job AnalysisJob
 		select {
-		case job, ok := <-wp.jobQueue:
+		case next, ok := <-wp.jobQueue:
 			if !ok {
+				wp.limit.release(started, nil)
 				return
 			}
-			wp.processJob(job)
-		case <-wp.stopChan:
+			job = next
+		case <-ctx.Done():
+			wp.limit.release(started, nil)
+			return
+		}
+		wp.counters.queued.Add(-1)
+
+		wp.counters.busy.Add(1)
+		result := wp.handle(ctx, job)
+		wp.counters.busy.Add(-1)
+		wp.counters.processed.Add(1)
+		wp.limit.release(started, &result)
+
+		select {
+		case wp.results <- result:
+		case <-ctx.Done():
 			return
 		}
 	}
 }
 
-// processJob processes a single analysis job
-func (wp *AnalysisWorkerPool) processJob(job AnalysisJob) {
-	baseURL, err := url.Parse(job.BaseURL)
-	if err != nil {
-		wp.results <- LinkResult{
-			Link:         job.Link,
-			IsInternal:   false,
-			IsAccessible: false,
-			Error:        err,
+// SetWorkerPoolConfig sizes the link-check worker pools of later analyses.
+// Non-positive fields keep their defaults, and MaxWorkers is raised to MinWorkers.
+func (a *Analyzer) SetWorkerPoolConfig(config WorkerPoolConfig) {
+	defaults := DefaultWorkerPoolConfig()
+	if config.MinWorkers <= 0 {
+		config.MinWorkers = defaults.MinWorkers
+	}
+	if config.MaxWorkers <= 0 {
+		config.MaxWorkers = defaults.MaxWorkers
+	}
+	if config.MaxWorkers < config.MinWorkers {
+		config.MaxWorkers = config.MinWorkers
+	}
+	if config.QueueMultiplier <= 0 {
+		config.QueueMultiplier = defaults.QueueMultiplier
+	}
+	a.workerConfig.Store(&config)
+}
+
+// WorkerPoolConfig returns the current link-check worker pool sizing
+func (a *Analyzer) WorkerPoolConfig() WorkerPoolConfig {
+	return *a.workerConfig.Load()
+}
+
+// newLinkCheckPool creates a worker pool for a page with linkCount links: a
+// worker per link up to MaxWorkers, of which an adaptive limit starting at
+// MinWorkers lets as many run as the checks' latencies allow
+func (a *Analyzer) newLinkCheckPool(linkCount int, handle func(context.Context, AnalysisJob) LinkResult) *AnalysisWorkerPool {
+	config := a.WorkerPoolConfig()
+	workers := linkCount
+	if workers < config.MinWorkers {
+		workers = config.MinWorkers
+	}
+	if workers > config.MaxWorkers {
+		workers = config.MaxWorkers
+	}
+	pool := NewAnalysisWorkerPool(workers, workers*config.QueueMultiplier, handle, a.workerCounters)
+	pool.limit = newAdaptiveLimit(config.MinWorkers, workers, a.workerCounters)
+	return pool
+}
+
+// adaptiveLimit bounds the concurrent checks of a pool with AIMD: healthy
+// checks raise the limit, by one per check in slow start (doubling it every
+// round of checks) and by one per round after the first backoff, and a check
+// that times out, is rate limited or takes longer than AdaptiveSlowCheck
+// halves it. Only checks started after the last backoff can trigger another,
+// so a burst of slow checks halves the limit once.
+type adaptiveLimit struct {
+	mu          sync.Mutex
+	min, max    float64
+	limit       float64
+	threshold   float64 // slow start ends here
+	inFlight    int
+	backedOffAt time.Time
+	changed     chan struct{} // closed when a slot is released
+	counters    *workerPoolCounters
+	reported    int64 // the limit added to counters
+}
+
+func newAdaptiveLimit(min, max int, counters *workerPoolCounters) *adaptiveLimit {
+	if min > max {
+		min = max
+	}
+	l := &adaptiveLimit{
+		min:       float64(min),
+		max:       float64(max),
+		limit:     float64(min),
+		threshold: float64(max),
+		changed:   make(chan struct{}),
+		counters:  counters,
+	}
+	l.report()
+	return l
+}
+
+// acquire waits until a check may start and returns its start time
+func (l *adaptiveLimit) acquire(ctx context.Context) (time.Time, error) {
+	for {
+		l.mu.Lock()
+		if l.inFlight < int(l.limit) {
+			l.inFlight++
+			l.mu.Unlock()
+			return time.Now(), nil
 		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return time.Time{}, ctx.Err()
+		}
+	}
+}
+
+// release frees the slot of a check started at started, adapting the limit to
+// its result; a nil result frees the slot without adapting
+func (l *adaptiveLimit) release(started time.Time, result *LinkResult) {
+	if l == nil {
 		return
 	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
 
-	result := wp.analyzer.analyzeSingleLink(job.Link, baseURL)
-	wp.results <- result
+	l.inFlight--
+	switch {
+	case result == nil || result.Skipped:
+	case congested(result):
+		if started.After(l.backedOffAt) {
+			l.threshold = l.limit / 2
+			l.limit = l.threshold
+			if l.limit < l.min {
+				l.limit = l.min
+			}
+			l.backedOffAt = time.Now()
+			l.counters.backoffs.Add(1)
+		}
+	case l.limit < l.threshold:
+		l.limit++
+	default:
+		l.limit += 1 / l.limit
+	}
+	if l.limit > l.max {
+		l.limit = l.max
+	}
+	l.report()
+
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// report publishes the current limit to the pool counters; the caller must
+// hold the lock or own l
+func (l *adaptiveLimit) report() {
+	current := int64(l.limit)
+	l.counters.limit.Add(current - l.reported)
+	l.reported = current
+}
+
+// close withdraws the limit from the pool counters once the pool has finished
+func (l *adaptiveLimit) close() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.counters.limit.Add(-l.reported)
+	l.reported = 0
 }
 
-// analyzeSingleLink analyzes a single link for accessibility and type
-func (a *Analyzer) analyzeSingleLink(link string, baseURL *url.URL) LinkResult {
-	linkProcessor := NewLinkProcessor()
-	return linkProcessor.ProcessLink(link, baseURL, a.isLinkAccessible)
+// congested reports whether a check result signals overload: a timeout, a 429
+// or a response slower than AdaptiveSlowCheck
+func congested(result *LinkResult) bool {
+	var netErr net.Error
+	if errors.As(result.CheckError, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return result.StatusCode == http.StatusTooManyRequests || result.Latency > AdaptiveSlowCheck
 }
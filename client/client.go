@@ -0,0 +1,406 @@
+// Package client is a typed HTTP client for the web page analyzer API. It sends
+// the API key, bounds every request with a timeout and retries requests the
+// service refused while busy or that failed in transit.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"web-page-analyzer/analyzer"
+	"web-page-analyzer/crawler"
+	"web-page-analyzer/jobs"
+	"web-page-analyzer/scheduler"
+)
+
+// Client defaults
+const (
+	DefaultTimeout    = 90 * time.Second // analyses with many links take up to a minute
+	DefaultMaxRetries = 2
+	DefaultRetryWait  = 500 * time.Millisecond // doubled on every retry
+	MaxRetryWait      = 30 * time.Second       // longest wait between attempts, even when Retry-After asks for more
+	BatchConcurrency  = 4                      // analyses AnalyzeBatch runs at once
+	maxErrorBody      = 4096                   // bytes of an error response kept in APIError
+)
+
+var _ analyzer.Client = (*Client)(nil)
+
+// Options configures a Client; zero values take the defaults
+type Options struct {
+	// APIKey is sent in the X-API-Key header when set
+	APIKey string
+	// Timeout bounds each attempt of a request
+	Timeout time.Duration
+	// MaxRetries is the number of retries after the first attempt; negative disables retries
+	MaxRetries int
+	// RetryWait is the wait before the first retry when the response has no Retry-After
+	RetryWait time.Duration
+	// HTTPClient sends the requests; its Timeout is overridden by Timeout
+	HTTPClient *http.Client
+}
+
+// Client calls the analyzer API at a base URL. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+	maxRetries int
+	retryWait  time.Duration
+}
+
+// APIError is a response the service answered with an error status instead of a result
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("analyzer API returned %d: %s", e.StatusCode, e.Message)
+}
+
+// New creates a client for the service at baseURL, such as "http://localhost:8080"
+func New(baseURL string, opts Options) *Client {
+	httpClient := &http.Client{}
+	if opts.HTTPClient != nil {
+		copied := *opts.HTTPClient
+		httpClient = &copied
+	}
+	httpClient.Timeout = opts.Timeout
+	if httpClient.Timeout <= 0 {
+		httpClient.Timeout = DefaultTimeout
+	}
+
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		apiKey:     opts.APIKey,
+		httpClient: httpClient,
+		maxRetries: opts.MaxRetries,
+		retryWait:  opts.RetryWait,
+	}
+	if c.maxRetries == 0 {
+		c.maxRetries = DefaultMaxRetries
+	}
+	if c.maxRetries < 0 {
+		c.maxRetries = 0
+	}
+	if c.retryWait <= 0 {
+		c.retryWait = DefaultRetryWait
+	}
+	return c
+}
+
+// Analyze analyzes targetURL with POST /analyze. A page that could not be
+// analyzed is not an error: the result carries it in Error, as the service
+// reports it. The error is set when no result was returned.
+func (c *Client) Analyze(ctx context.Context, targetURL string, opts analyzer.AnalysisOptions) (*analyzer.AnalysisResult, error) {
+	form, err := analysisForm(targetURL, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Failed analyses come back with error statuses but carry a result, which is final
+	isResult := func(body []byte) bool {
+		var probe struct {
+			URL string `json:"url"`
+		}
+		return json.Unmarshal(body, &probe) == nil && probe.URL != ""
+	}
+	status, body, err := c.do(ctx, http.MethodPost, "/analyze", form, true, isResult)
+	if err != nil {
+		return nil, err
+	}
+	if !isResult(body) {
+		return nil, newAPIError(status, body)
+	}
+
+	var result analyzer.AnalysisResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("decoding analysis result: %w", err)
+	}
+	return &result, nil
+}
+
+// AnalyzeURLWithOptions implements analyzer.Client, reporting a failed API
+// call as an INTERNAL_ERROR result
+func (c *Client) AnalyzeURLWithOptions(ctx context.Context, targetURL string, opts analyzer.AnalysisOptions) *analyzer.AnalysisResult {
+	result, err := c.Analyze(ctx, targetURL, opts)
+	if err != nil {
+		analysisErr := analyzer.NewAnalysisError(analyzer.ErrCodeInternalError, "Analyzer API request failed").
+			WithURL(targetURL).WithDetails(err.Error()).WithCause(err)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			analysisErr = analysisErr.WithStatusCode(apiErr.StatusCode)
+		}
+		return &analyzer.AnalysisResult{URL: targetURL, FetchedAt: time.Now(), Error: analysisErr}
+	}
+	return result
+}
+
+// BatchResult is the outcome of one URL of AnalyzeBatch
+type BatchResult struct {
+	URL    string
+	Result *analyzer.AnalysisResult
+	Err    error
+}
+
+// AnalyzeBatch analyzes urls with up to BatchConcurrency requests at once and
+// returns their outcomes in the order of urls
+func (c *Client) AnalyzeBatch(ctx context.Context, urls []string, opts analyzer.AnalysisOptions) []BatchResult {
+	results := make([]BatchResult, len(urls))
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, BatchConcurrency)
+	for i, target := range urls {
+		wg.Add(1)
+		go func(i int, target string) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			result, err := c.Analyze(ctx, target, opts)
+			results[i] = BatchResult{URL: target, Result: result, Err: err}
+		}(i, target)
+	}
+	wg.Wait()
+	return results
+}
+
+// AnalyzeAsync queues an analysis of targetURL with POST /analyze/async and
+// returns the job at once; poll it with GetJob until it has finished
+func (c *Client) AnalyzeAsync(ctx context.Context, targetURL string, opts analyzer.AnalysisOptions) (*jobs.Job, error) {
+	form, err := analysisForm(targetURL, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// A job request lost in transit may have queued the job, so only refusals are retried
+	var job jobs.Job
+	if err := c.decode(ctx, http.MethodPost, "/analyze/async", form, false, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// GetJob returns the status of a background analysis with GET /jobs/{id},
+// including its result once it has finished
+func (c *Client) GetJob(ctx context.Context, id string) (*jobs.Job, error) {
+	var job jobs.Job
+	if err := c.decode(ctx, http.MethodGet, "/jobs/"+url.PathEscape(id), nil, true, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// StartCrawl starts a crawl from startURL with POST /crawl. The crawl runs in
+// the background; poll it with GetCrawl.
+func (c *Client) StartCrawl(ctx context.Context, startURL string, opts crawler.Options) (*crawler.Crawl, error) {
+	form := url.Values{"url": {startURL}}
+	if opts.CheckLinks {
+		form.Set("check_links", "true")
+	}
+	for name, value := range map[string]int{
+		"max_pages":           opts.MaxPages,
+		"max_depth":           opts.MaxDepth,
+		"deep_page_threshold": opts.DeepPageThreshold,
+	} {
+		if value > 0 {
+			form.Set(name, strconv.Itoa(value))
+		}
+	}
+
+	// A crawl request lost in transit may have started the crawl, so only refusals are retried
+	var crawl crawler.Crawl
+	if err := c.decode(ctx, http.MethodPost, "/crawl", form, false, &crawl); err != nil {
+		return nil, err
+	}
+	return &crawl, nil
+}
+
+// GetCrawl returns the progress or report of a crawl with GET /crawl/{id}
+func (c *Client) GetCrawl(ctx context.Context, id string) (*crawler.Crawl, error) {
+	var crawl crawler.Crawl
+	if err := c.decode(ctx, http.MethodGet, "/crawl/"+url.PathEscape(id), nil, true, &crawl); err != nil {
+		return nil, err
+	}
+	return &crawl, nil
+}
+
+// GetHistory returns the changes detected between scheduled analyses with GET
+// /changes, newest first, for pageURL or for all pages when it is empty
+func (c *Client) GetHistory(ctx context.Context, pageURL string) ([]scheduler.Change, error) {
+	path := "/changes"
+	if pageURL != "" {
+		path += "?" + url.Values{"url": {pageURL}}.Encode()
+	}
+	var response struct {
+		Changes []scheduler.Change `json:"changes"`
+	}
+	if err := c.decode(ctx, http.MethodGet, path, nil, true, &response); err != nil {
+		return nil, err
+	}
+	return response.Changes, nil
+}
+
+// decode sends a request and decodes a successful JSON response into target
+func (c *Client) decode(ctx context.Context, method, path string, form url.Values, idempotent bool, target any) error {
+	status, body, err := c.do(ctx, method, path, form, idempotent, nil)
+	if err != nil {
+		return err
+	}
+	if status < 200 || status >= 300 {
+		return newAPIError(status, body)
+	}
+	if err := json.Unmarshal(body, target); err != nil {
+		return fmt.Errorf("decoding %s response: %w", path, err)
+	}
+	return nil
+}
+
+// do sends a request and returns the status and body of the last attempt.
+// Responses with a retryable status are retried unless final reports that the
+// body is an answer; transport failures are retried for idempotent requests.
+func (c *Client) do(ctx context.Context, method, path string, form url.Values, idempotent bool, final func(body []byte) bool) (int, []byte, error) {
+	wait := c.retryWait
+	for attempt := 0; ; attempt++ {
+		status, header, body, err := c.send(ctx, method, path, form)
+		retry := attempt < c.maxRetries && ctx.Err() == nil
+		switch {
+		case err != nil && !(retry && idempotent):
+			return 0, nil, err
+		case err == nil && !(retry && retryableStatus(status) && (final == nil || !final(body))):
+			return status, body, nil
+		}
+
+		delay := wait
+		if err == nil {
+			if seconds, parseErr := strconv.Atoi(header.Get("Retry-After")); parseErr == nil && seconds >= 0 {
+				delay = time.Duration(seconds) * time.Second
+			}
+		}
+		if delay > MaxRetryWait {
+			delay = MaxRetryWait
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return 0, nil, ctx.Err()
+		}
+		wait *= 2
+	}
+}
+
+// send makes one attempt of a request
+func (c *Client) send(ctx context.Context, method, path string, form url.Values) (int, http.Header, []byte, error) {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	return resp.StatusCode, resp.Header, respBody, nil
+}
+
+// retryableStatus reports whether a status means the service was busy or
+// unreachable rather than that the request failed
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// newAPIError builds an APIError from a JSON {"error": ...} or plain text body
+func newAPIError(status int, body []byte) *APIError {
+	var response struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &response) == nil && response.Error != "" {
+		return &APIError{StatusCode: status, Message: response.Error}
+	}
+	if len(body) > maxErrorBody {
+		body = body[:maxErrorBody]
+	}
+	return &APIError{StatusCode: status, Message: string(bytes.TrimSpace(body))}
+}
+
+// analysisForm encodes targetURL and opts as the form parameters of POST /analyze.
+// BypassCache has no API parameter and is not sent.
+func analysisForm(targetURL string, opts analyzer.AnalysisOptions) (url.Values, error) {
+	form := url.Values{"url": {targetURL}}
+	for name, enabled := range map[string]bool{
+		"compare_variants":   opts.CompareVariants,
+		"expand_short_links": opts.ExpandShortLinks,
+		"extract_content":    opts.ExtractContent,
+		"whois":              opts.LookupDomain,
+		"include_headers":    opts.IncludeHeaders,
+		"collect_links":      opts.CollectLinks,
+		"include_links":      opts.IncludeLinks,
+		"check_images":       opts.CheckImages,
+		"check_robots":       opts.CheckRobots,
+		"pagespeed":          opts.PageSpeed,
+	} {
+		if enabled {
+			form.Set(name, "true")
+		}
+	}
+	if opts.SkipLinkCheck {
+		form.Set("check_links", "false")
+	}
+	if opts.QuickCheck {
+		form.Set("mode", "quick")
+	}
+	if opts.Priority != analyzer.PriorityInteractive {
+		form.Set("priority", opts.Priority.String())
+	}
+	if !opts.ArchiveDate.IsZero() {
+		form.Set("wayback_date", opts.ArchiveDate.UTC().Format(time.RFC3339))
+	}
+	if opts.HeadingsTextLimit > 0 {
+		form.Set("include_headings_text", "true")
+		form.Set("headings_text_limit", strconv.Itoa(opts.HeadingsTextLimit))
+	}
+	if len(opts.ExtractionRules) > 0 {
+		rules, err := json.Marshal(opts.ExtractionRules)
+		if err != nil {
+			return nil, fmt.Errorf("encoding extraction rules: %w", err)
+		}
+		form.Set("extract", string(rules))
+	}
+	if len(opts.Assertions) > 0 {
+		assertions, err := json.Marshal(opts.Assertions)
+		if err != nil {
+			return nil, fmt.Errorf("encoding assertions: %w", err)
+		}
+		form.Set("assert", string(assertions))
+	}
+	return form, nil
+}
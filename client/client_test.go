@@ -0,0 +1,260 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"web-page-analyzer/analyzer"
+	"web-page-analyzer/crawler"
+	"web-page-analyzer/jobs"
+	"web-page-analyzer/scheduler"
+)
+
+// newService serves handler and returns a client for it that retries without waiting long
+func newService(t *testing.T, opts Options, handler http.HandlerFunc) *Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	if opts.RetryWait == 0 {
+		opts.RetryWait = time.Millisecond
+	}
+	return New(server.URL+"/", opts)
+}
+
+func TestAnalyze(t *testing.T) {
+	var form map[string][]string
+	var apiKey string
+	client := newService(t, Options{APIKey: "secret"}, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/analyze" {
+			t.Errorf("Expected POST /analyze, got %s %s", r.Method, r.URL.Path)
+		}
+		r.ParseForm()
+		form, apiKey = r.PostForm, r.Header.Get("X-API-Key")
+		json.NewEncoder(w).Encode(analyzer.AnalysisResult{URL: r.FormValue("url"), PageTitle: "Example"})
+	})
+
+	result, err := client.Analyze(context.Background(), "https://example.com", analyzer.AnalysisOptions{
+		SkipLinkCheck:     true,
+		QuickCheck:        true,
+		CheckRobots:       true,
+		HeadingsTextLimit: 5,
+		ExtractionRules:   []analyzer.ExtractionRule{{Name: "price", Selector: ".price"}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.PageTitle != "Example" || result.URL != "https://example.com" {
+		t.Errorf("Expected the decoded result, got %+v", result)
+	}
+	if apiKey != "secret" {
+		t.Errorf("Expected the API key header, got %q", apiKey)
+	}
+
+	expected := map[string]string{
+		"url": "https://example.com", "check_links": "false", "mode": "quick", "check_robots": "true",
+		"include_headings_text": "true", "headings_text_limit": "5", "extract": `[{"name":"price","selector":".price"}]`,
+	}
+	for name, value := range expected {
+		if got := form[name]; len(got) != 1 || got[0] != value {
+			t.Errorf("Expected %s=%s, got %v", name, value, got)
+		}
+	}
+	if len(form) != len(expected) {
+		t.Errorf("Expected only %d form fields, got %v", len(expected), form)
+	}
+}
+
+func TestAnalyzeFailedPage(t *testing.T) {
+	var attempts atomic.Int32
+	client := newService(t, Options{}, func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(analyzer.AnalysisResult{
+			URL:   r.FormValue("url"),
+			Error: analyzer.NewAnalysisError(analyzer.ErrCodeDNSError, "Failed to resolve host"),
+		})
+	})
+
+	// A failed analysis is a result, not an error, and is not retried
+	result, err := client.Analyze(context.Background(), "https://missing.example", analyzer.AnalysisOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Error == nil || result.Error.Code != analyzer.ErrCodeDNSError {
+		t.Errorf("Expected a DNS_ERROR result, got %+v", result.Error)
+	}
+	if attempts.Load() != 1 {
+		t.Errorf("Expected 1 attempt, got %d", attempts.Load())
+	}
+}
+
+func TestRetries(t *testing.T) {
+	t.Run("busy then success", func(t *testing.T) {
+		var attempts atomic.Int32
+		client := newService(t, Options{}, func(w http.ResponseWriter, r *http.Request) {
+			if attempts.Add(1) == 1 {
+				w.Header().Set("Retry-After", "0")
+				http.Error(w, "Server is busy, retry later", http.StatusTooManyRequests)
+				return
+			}
+			json.NewEncoder(w).Encode(analyzer.AnalysisResult{URL: "https://example.com"})
+		})
+		if _, err := client.Analyze(context.Background(), "https://example.com", analyzer.AnalysisOptions{}); err != nil {
+			t.Fatalf("Expected the retry to succeed, got %v", err)
+		}
+		if attempts.Load() != 2 {
+			t.Errorf("Expected 2 attempts, got %d", attempts.Load())
+		}
+	})
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		var attempts atomic.Int32
+		client := newService(t, Options{MaxRetries: 3}, func(w http.ResponseWriter, r *http.Request) {
+			attempts.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `{"error":"Server is under memory pressure"}`)
+		})
+		_, err := client.GetCrawl(context.Background(), "abc")
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable || apiErr.Message != "Server is under memory pressure" {
+			t.Errorf("Expected a 503 APIError, got %v", err)
+		}
+		if attempts.Load() != 4 {
+			t.Errorf("Expected 4 attempts, got %d", attempts.Load())
+		}
+	})
+
+	t.Run("client errors are not retried", func(t *testing.T) {
+		var attempts atomic.Int32
+		client := newService(t, Options{}, func(w http.ResponseWriter, r *http.Request) {
+			attempts.Add(1)
+			http.Error(w, "URL parameter is required", http.StatusBadRequest)
+		})
+		_, err := client.StartCrawl(context.Background(), "", crawler.Options{})
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || apiErr.Message != "URL parameter is required" {
+			t.Errorf("Expected a 400 APIError, got %v", err)
+		}
+		if attempts.Load() != 1 {
+			t.Errorf("Expected 1 attempt, got %d", attempts.Load())
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		client := newService(t, Options{Timeout: 20 * time.Millisecond, MaxRetries: -1}, func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+		})
+		if _, err := client.GetHistory(context.Background(), ""); err == nil {
+			t.Error("Expected a timeout error")
+		}
+	})
+}
+
+func TestAnalyzeBatch(t *testing.T) {
+	client := newService(t, Options{}, func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("url") == "https://bad.example" {
+			http.Error(w, "Invalid URL format", http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(analyzer.AnalysisResult{URL: r.FormValue("url")})
+	})
+
+	urls := []string{"https://a.example", "https://bad.example", "https://c.example"}
+	results := client.AnalyzeBatch(context.Background(), urls, analyzer.AnalysisOptions{})
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	for i, result := range results {
+		if result.URL != urls[i] {
+			t.Errorf("Expected result %d for %s, got %s", i, urls[i], result.URL)
+		}
+	}
+	if results[0].Err != nil || results[0].Result.URL != "https://a.example" || results[1].Err == nil || results[2].Err != nil {
+		t.Errorf("Expected only the second URL to fail, got %+v", results)
+	}
+
+	// Through the analyzer.Client interface failures become error results
+	var analysisClient analyzer.Client = client
+	failed := analysisClient.AnalyzeURLWithOptions(context.Background(), "https://bad.example", analyzer.AnalysisOptions{})
+	if failed.Error == nil || failed.Error.Code != analyzer.ErrCodeInternalError || failed.Error.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected an INTERNAL_ERROR result, got %+v", failed.Error)
+	}
+}
+
+func TestCrawlAndHistory(t *testing.T) {
+	client := newService(t, Options{}, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/crawl":
+			if r.FormValue("max_pages") != "10" || r.FormValue("check_links") != "true" || r.FormValue("max_depth") != "" {
+				t.Errorf("Unexpected crawl form %v", r.Form)
+			}
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(crawler.Crawl{ID: "c1", Status: crawler.StatusRunning})
+		case r.URL.Path == "/crawl/c1":
+			json.NewEncoder(w).Encode(crawler.Crawl{ID: "c1", Status: crawler.StatusCompleted, Pages: []crawler.Page{{URL: "https://example.com/"}}})
+		case r.URL.Path == "/changes":
+			if r.URL.Query().Get("url") != "https://example.com/?a=1" {
+				t.Errorf("Expected the url query, got %q", r.URL.RawQuery)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"changes": []scheduler.Change{{ID: 7, URL: "https://example.com/?a=1"}}, "count": 1})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	ctx := context.Background()
+
+	crawl, err := client.StartCrawl(ctx, "https://example.com", crawler.Options{MaxPages: 10, CheckLinks: true})
+	if err != nil || crawl.ID != "c1" || crawl.Status != crawler.StatusRunning {
+		t.Fatalf("Expected a running crawl, got %+v and %v", crawl, err)
+	}
+	crawl, err = client.GetCrawl(ctx, "c1")
+	if err != nil || crawl.Status != crawler.StatusCompleted || len(crawl.Pages) != 1 {
+		t.Errorf("Expected a completed crawl, got %+v and %v", crawl, err)
+	}
+	if _, err := client.GetCrawl(ctx, "missing"); err == nil {
+		t.Error("Expected an error for an unknown crawl")
+	}
+
+	changes, err := client.GetHistory(ctx, "https://example.com/?a=1")
+	if err != nil || len(changes) != 1 || changes[0].ID != 7 {
+		t.Errorf("Expected one change, got %+v and %v", changes, err)
+	}
+}
+
+func TestAsyncJobs(t *testing.T) {
+	client := newService(t, Options{}, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/analyze/async":
+			if r.FormValue("url") != "https://example.com" || r.FormValue("mode") != "quick" {
+				t.Errorf("Unexpected job form %v", r.Form)
+			}
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(jobs.Job{ID: "j1", URL: r.FormValue("url"), Status: jobs.StatusQueued})
+		case r.URL.Path == "/jobs/j1":
+			json.NewEncoder(w).Encode(jobs.Job{ID: "j1", Status: jobs.StatusCompleted, Result: &analyzer.AnalysisResult{PageTitle: "Example"}})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	ctx := context.Background()
+
+	job, err := client.AnalyzeAsync(ctx, "https://example.com", analyzer.AnalysisOptions{QuickCheck: true})
+	if err != nil || job.ID != "j1" || job.Status != jobs.StatusQueued {
+		t.Fatalf("Expected a queued job, got %+v and %v", job, err)
+	}
+	job, err = client.GetJob(ctx, "j1")
+	if err != nil || job.Status != jobs.StatusCompleted || job.Result == nil || job.Result.PageTitle != "Example" {
+		t.Errorf("Expected a completed job with its result, got %+v and %v", job, err)
+	}
+	if _, err := client.GetJob(ctx, "missing"); err == nil {
+		t.Error("Expected an error for an unknown job")
+	}
+}
@@ -0,0 +1,64 @@
+package crawler
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// sourceIndex records which crawled pages link to each target, so failed
+// targets can be reported with the pages to fix
+type sourceIndex struct {
+	internal map[string][]string // page key to linking pages
+
+	external      map[string][]string // inaccessible external URL to linking pages
+	externalOrder []string
+}
+
+func newSourceIndex() *sourceIndex {
+	return &sourceIndex{internal: make(map[string][]string), external: make(map[string][]string)}
+}
+
+// add records that source links to the internal page with key
+func (s *sourceIndex) add(key, source string) {
+	s.internal[key] = appendSource(s.internal[key], source)
+}
+
+// addExternal records that source links to the inaccessible external link
+func (s *sourceIndex) addExternal(link, source string) {
+	if _, ok := s.external[link]; !ok {
+		s.externalOrder = append(s.externalOrder, link)
+	}
+	s.external[link] = appendSource(s.external[link], source)
+}
+
+// appendSource adds source once, up to MaxBrokenLinkSources; links from one page
+// are recorded together, so a repeat is always the last entry
+func appendSource(sources []string, source string) []string {
+	if len(sources) >= MaxBrokenLinkSources || (len(sources) > 0 && sources[len(sources)-1] == source) {
+		return sources
+	}
+	return append(sources, source)
+}
+
+// broken returns the failed crawled pages that other pages link to, in crawl
+// order, followed by the inaccessible external links
+func (s *sourceIndex) broken(pages []Page) []BrokenLink {
+	var broken []BrokenLink
+	for _, page := range pages {
+		if page.ErrorCode == "" && page.StatusCode < http.StatusBadRequest {
+			continue
+		}
+		parsed, err := url.Parse(page.URL)
+		if err != nil {
+			continue
+		}
+		// The start URL is broken too, but no page links to it
+		if sources := s.internal[pageKey(parsed)]; len(sources) > 0 {
+			broken = append(broken, BrokenLink{URL: page.URL, StatusCode: page.StatusCode, ErrorCode: page.ErrorCode, Sources: sources})
+		}
+	}
+	for _, link := range s.externalOrder {
+		broken = append(broken, BrokenLink{URL: link, External: true, Sources: s.external[link]})
+	}
+	return broken
+}
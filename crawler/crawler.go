@@ -0,0 +1,474 @@
+// Package crawler follows internal links from a start URL, analyzing every page
+// it reaches and reporting site-level findings such as orphan and deep pages.
+package crawler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"web-page-analyzer/analyzer"
+	"web-page-analyzer/logger"
+)
+
+// Crawl defaults and limits
+const (
+	DefaultMaxPages          = 50
+	MaxPages                 = 500
+	DefaultMaxDepth          = 5
+	DefaultDeepPageThreshold = 3
+	Concurrency              = 4                // pages analyzed at once per crawl
+	CrawlTimeout             = 15 * time.Minute // a crawl is cancelled after this long
+	MaxActiveCrawls          = 2
+	MaxCrawls                = 20   // finished crawls kept in memory, oldest dropped first
+	MaxReportedOrphans       = 1000 // orphan URLs listed in a report
+	MaxBrokenLinkSources     = 100  // linking pages listed per broken link
+)
+
+// Crawl statuses
+const (
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// ErrTooManyCrawls is returned when MaxActiveCrawls crawls are already running
+var ErrTooManyCrawls = errors.New("too many crawls running")
+
+// skippedExtensions are file types linked from pages that are not worth analyzing as pages
+var skippedExtensions = map[string]bool{
+	".pdf": true, ".zip": true, ".gz": true, ".jpg": true, ".jpeg": true, ".png": true, ".gif": true,
+	".svg": true, ".webp": true, ".ico": true, ".css": true, ".js": true, ".json": true, ".xml": true,
+	".mp3": true, ".mp4": true, ".webm": true, ".woff": true, ".woff2": true, ".doc": true, ".docx": true,
+	".xls": true, ".xlsx": true, ".ppt": true, ".pptx": true,
+}
+
+// Options bounds a crawl
+type Options struct {
+	MaxPages int `json:"max_pages"`
+	MaxDepth int `json:"max_depth"`
+	// DeepPageThreshold flags pages more clicks than this away from the start URL
+	DeepPageThreshold int `json:"deep_page_threshold"`
+	// CheckLinks also checks the accessibility of external links on every page
+	CheckLinks bool `json:"check_links"`
+}
+
+// normalize applies defaults and limits
+func (o *Options) normalize() {
+	if o.MaxPages <= 0 {
+		o.MaxPages = DefaultMaxPages
+	}
+	if o.MaxPages > MaxPages {
+		o.MaxPages = MaxPages
+	}
+	if o.MaxDepth <= 0 {
+		o.MaxDepth = DefaultMaxDepth
+	}
+	if o.DeepPageThreshold <= 0 {
+		o.DeepPageThreshold = DefaultDeepPageThreshold
+	}
+}
+
+// Page is one analyzed page of a crawl
+type Page struct {
+	URL string `json:"url"`
+	// Depth is the number of clicks from the start URL along the shortest path
+	Depth             int    `json:"depth"`
+	StatusCode        int    `json:"status_code,omitempty"`
+	Title             string `json:"title,omitempty"`
+	ErrorCode         string `json:"error_code,omitempty"`
+	InternalLinks     int    `json:"internal_links"`
+	ExternalLinks     int    `json:"external_links"`
+	InaccessibleLinks int    `json:"inaccessible_links"`
+	Noindex           bool   `json:"noindex,omitempty"`
+
+	// Result is the full analysis, kept for exports but left out of reports
+	Result *analyzer.AnalysisResult `json:"-"`
+}
+
+// Crawl is the progress and, once finished, the report of one crawl
+type Crawl struct {
+	ID         string    `json:"id"`
+	StartURL   string    `json:"start_url"`
+	Options    Options   `json:"options"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+	Pages      []Page    `json:"pages"`
+	// Truncated is true when MaxPages or MaxDepth left discovered pages unvisited
+	Truncated bool `json:"truncated"`
+	// SitemapURLs counts the site's sitemap entries compared against the crawl
+	SitemapURLs int `json:"sitemap_urls"`
+	// Orphans are sitemap URLs that no crawled page links to
+	Orphans []string `json:"orphans,omitempty"`
+	// DeepPages are pages deeper than Options.DeepPageThreshold
+	DeepPages []string `json:"deep_pages,omitempty"`
+	// BrokenLinks are failed link targets with the crawled pages linking to them
+	BrokenLinks []BrokenLink `json:"broken_links,omitempty"`
+	// Hreflang checks the hreflang annotations of the crawled pages for reciprocity
+	Hreflang *analyzer.HreflangReport `json:"hreflang,omitempty"`
+
+	// updated is closed and replaced whenever pages are added or the crawl finishes
+	updated chan struct{}
+}
+
+// BrokenLink is a link target that could not be loaded: a crawled page that
+// failed, or an inaccessible external link when links are checked
+type BrokenLink struct {
+	URL        string `json:"url"`
+	External   bool   `json:"external"`
+	StatusCode int    `json:"status_code,omitempty"`
+	ErrorCode  string `json:"error_code,omitempty"`
+	// Sources are the crawled pages linking to URL, up to MaxBrokenLinkSources
+	Sources []string `json:"sources"`
+}
+
+// Crawler runs crawls in the background and keeps their reports in memory
+type Crawler struct {
+	analyzer *analyzer.Analyzer
+	client   analyzer.Client // analyzes the crawled pages, through the limiter when one is set
+
+	mu     sync.RWMutex
+	crawls map[string]*Crawl
+	order  []string // crawl IDs, oldest first
+	active int
+}
+
+// New creates a crawler analyzing pages with a
+func New(a *analyzer.Analyzer) *Crawler {
+	return &Crawler{analyzer: a, client: a, crawls: make(map[string]*Crawl)}
+}
+
+// SetLimiter makes every page analysis take a batch slot of limiter first
+func (c *Crawler) SetLimiter(limiter analyzer.Limiter) {
+	c.client = analyzer.LimitedClient(c.analyzer, limiter)
+}
+
+// Start validates startURL and crawls it in the background, returning the new
+// crawl. The crawl keeps the values of ctx but not its cancellation, so it
+// outlives the request.
+func (c *Crawler) Start(ctx context.Context, startURL string, opts Options) (Crawl, error) {
+	parsed, err := c.analyzer.NormalizeURL(startURL)
+	if err != nil {
+		return Crawl{}, err
+	}
+	opts.normalize()
+	id, err := newID()
+	if err != nil {
+		return Crawl{}, err
+	}
+
+	crawl := &Crawl{
+		ID:        id,
+		StartURL:  parsed.String(),
+		Options:   opts,
+		Status:    StatusRunning,
+		StartedAt: time.Now().UTC(),
+		Pages:     []Page{},
+		updated:   make(chan struct{}),
+	}
+
+	c.mu.Lock()
+	if c.active >= MaxActiveCrawls {
+		c.mu.Unlock()
+		return Crawl{}, ErrTooManyCrawls
+	}
+	c.active++
+	c.crawls[id] = crawl
+	c.order = append(c.order, id)
+	c.prune()
+	snapshot := crawl.snapshot()
+	c.mu.Unlock()
+
+	go c.run(context.WithoutCancel(ctx), crawl, parsed)
+	return snapshot, nil
+}
+
+// Get returns a snapshot of a crawl
+func (c *Crawler) Get(id string) (Crawl, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	crawl, ok := c.crawls[id]
+	if !ok {
+		return Crawl{}, false
+	}
+	return crawl.snapshot(), true
+}
+
+// Follow calls each for every page of a crawl, in order, as the crawl analyzes
+// them, and returns the crawl once it has finished. When ctx ends first, the
+// crawl is returned as far as it has progressed. It returns false when there is
+// no crawl with the ID.
+func (c *Crawler) Follow(ctx context.Context, id string, each func(Page)) (Crawl, bool) {
+	sent := 0
+	for {
+		c.mu.RLock()
+		crawl, ok := c.crawls[id]
+		if !ok {
+			c.mu.RUnlock()
+			return Crawl{}, false
+		}
+		snapshot := crawl.snapshot()
+		c.mu.RUnlock()
+
+		for _, page := range snapshot.Pages[sent:] {
+			each(page)
+		}
+		sent = len(snapshot.Pages)
+		if snapshot.Status != StatusRunning {
+			return snapshot, true
+		}
+
+		select {
+		case <-snapshot.updated:
+		case <-ctx.Done():
+			return snapshot, true
+		}
+	}
+}
+
+// notify wakes the followers of a crawl; the caller must hold the write lock
+func (c *Crawl) notify() {
+	close(c.updated)
+	c.updated = make(chan struct{})
+}
+
+// snapshot copies a crawl so it can be read while the crawl continues; the
+// caller must hold the lock
+func (c *Crawl) snapshot() Crawl {
+	snapshot := *c
+	snapshot.Pages = append([]Page(nil), c.Pages...)
+	return snapshot
+}
+
+// prune drops the oldest finished crawls beyond MaxCrawls; the caller must hold the write lock
+func (c *Crawler) prune() {
+	for i := 0; len(c.order) > MaxCrawls && i < len(c.order); {
+		id := c.order[i]
+		if c.crawls[id].Status == StatusRunning {
+			i++
+			continue
+		}
+		delete(c.crawls, id)
+		c.order = append(c.order[:i], c.order[i+1:]...)
+	}
+}
+
+// run crawls breadth first so every page is reached along its shortest click path
+func (c *Crawler) run(ctx context.Context, crawl *Crawl, start *url.URL) {
+	ctx, cancel := context.WithTimeout(ctx, CrawlTimeout)
+	defer cancel()
+	log := logger.WithComponent("crawler")
+	opts := crawl.Options
+
+	host := strings.ToLower(start.Hostname())
+	startKeys := map[string]bool{pageKey(start): true}
+	seen := map[string]bool{pageKey(start): true}
+	linked := make(map[string]bool)
+	sources := newSourceIndex()
+	frontier := []string{start.String()}
+	queued := 1
+	truncated := false
+
+	for depth := 0; len(frontier) > 0 && depth <= opts.MaxDepth && ctx.Err() == nil; depth++ {
+		pages := c.analyzeLevel(ctx, crawl, frontier, depth)
+
+		// Links are resolved against the page the start URL redirected to, if any
+		if depth == 0 && pages[0].Result != nil && pages[0].Result.FinalURL != "" {
+			if final, err := url.Parse(pages[0].Result.FinalURL); err == nil {
+				host = strings.ToLower(final.Hostname())
+				startKeys[pageKey(final)] = true
+				seen[pageKey(final)] = true
+			}
+		}
+
+		var next []string
+		for _, page := range pages {
+			if page.Result == nil {
+				continue
+			}
+			for _, link := range page.Result.InaccessibleURLs {
+				sources.addExternal(link, page.URL)
+			}
+			for _, link := range page.Result.Links {
+				target, ok := internalPage(link, host)
+				if !ok {
+					continue
+				}
+				key := pageKey(target)
+				linked[key] = true
+				sources.add(key, page.URL)
+				if seen[key] {
+					continue
+				}
+				if queued >= opts.MaxPages {
+					truncated = true
+					continue
+				}
+				seen[key] = true
+				queued++
+				next = append(next, target.String())
+			}
+		}
+		frontier = next
+	}
+	truncated = truncated || len(frontier) > 0
+
+	// Sitemap entries nothing links to can only be found through the sitemap
+	sitemapURLs := c.analyzer.SitemapURLs(ctx, start)
+	var orphans []string
+	for _, sitemapURL := range sitemapURLs {
+		target, ok := internalPage(sitemapURL, host)
+		if !ok || linked[pageKey(target)] || startKeys[pageKey(target)] {
+			continue
+		}
+		if len(orphans) < MaxReportedOrphans {
+			orphans = append(orphans, target.String())
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	crawl.Truncated = truncated
+	crawl.SitemapURLs = len(sitemapURLs)
+	crawl.Orphans = orphans
+	for _, page := range crawl.Pages {
+		if page.Depth > opts.DeepPageThreshold {
+			crawl.DeepPages = append(crawl.DeepPages, page.URL)
+		}
+	}
+	crawl.BrokenLinks = sources.broken(crawl.Pages)
+	crawl.Hreflang = hreflangReport(crawl.Pages)
+	crawl.FinishedAt = time.Now().UTC()
+	crawl.Status = StatusCompleted
+	if err := ctx.Err(); err != nil {
+		crawl.Status = StatusFailed
+		crawl.Error = "crawl timed out after " + CrawlTimeout.String()
+	}
+	c.active--
+	crawl.notify()
+
+	log.Infow("Crawl finished",
+		"id", crawl.ID,
+		"start_url", crawl.StartURL,
+		"status", crawl.Status,
+		"pages", len(crawl.Pages),
+		"orphans", len(crawl.Orphans),
+		"deep_pages", len(crawl.DeepPages),
+		"broken_links", len(crawl.BrokenLinks),
+	)
+}
+
+// analyzeLevel analyzes the pages at one depth, Concurrency at a time, and
+// returns them in order; each page is added to the crawl as soon as it is done
+func (c *Crawler) analyzeLevel(ctx context.Context, crawl *Crawl, urls []string, depth int) []Page {
+	opts := crawl.Options
+	pages := make([]Page, len(urls))
+	semaphore := make(chan struct{}, Concurrency)
+	var wg sync.WaitGroup
+	for i, pageURL := range urls {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, pageURL string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			result := c.client.AnalyzeURLWithOptions(ctx, pageURL, analyzer.AnalysisOptions{
+				SkipLinkCheck: !opts.CheckLinks,
+				CollectLinks:  true,
+				Priority:      analyzer.PriorityBatch,
+			})
+			pages[i] = pageOf(pageURL, depth, result)
+
+			c.mu.Lock()
+			crawl.Pages = append(crawl.Pages, pages[i])
+			crawl.notify()
+			c.mu.Unlock()
+		}(i, pageURL)
+	}
+	wg.Wait()
+	return pages
+}
+
+// hreflangReport checks the hreflang annotations of the pages that loaded; it
+// returns nil when none declare alternates
+func hreflangReport(pages []Page) *analyzer.HreflangReport {
+	var checked []analyzer.HreflangPage
+	annotated := false
+	for _, page := range pages {
+		if page.Result == nil || page.Result.Error != nil {
+			continue
+		}
+		annotated = annotated || len(page.Result.Hreflang) > 0
+		checked = append(checked, analyzer.HreflangPage{URL: page.URL, FinalURL: page.Result.FinalURL, Alternates: page.Result.Hreflang})
+	}
+	if !annotated {
+		return nil
+	}
+	return analyzer.CheckHreflangReciprocity(checked)
+}
+
+// pageOf summarizes the analysis of a crawled page
+func pageOf(pageURL string, depth int, result *analyzer.AnalysisResult) Page {
+	page := Page{
+		URL:               pageURL,
+		Depth:             depth,
+		StatusCode:        result.StatusCode,
+		Title:             result.PageTitle,
+		InternalLinks:     result.InternalLinks,
+		ExternalLinks:     result.ExternalLinks,
+		InaccessibleLinks: result.InaccessibleLinks,
+		Noindex:           result.Noindex,
+		Result:            result,
+	}
+	if result.Error != nil {
+		page.ErrorCode = result.Error.Code
+	}
+	return page
+}
+
+// internalPage parses link and reports whether it is a page on host worth crawling
+func internalPage(link, host string) (*url.URL, bool) {
+	target, err := url.Parse(link)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+		return nil, false
+	}
+	if !strings.EqualFold(target.Hostname(), host) {
+		return nil, false
+	}
+	if skippedExtensions[strings.ToLower(path.Ext(target.Path))] {
+		return nil, false
+	}
+	target.Fragment = ""
+	target.RawFragment = ""
+	return target, true
+}
+
+// pageKey identifies a page regardless of the case of its scheme and host, its fragment and a missing root path
+func pageKey(u *url.URL) string {
+	key := *u
+	key.Scheme = strings.ToLower(key.Scheme)
+	key.Host = strings.ToLower(key.Host)
+	key.Fragment = ""
+	key.RawFragment = ""
+	if key.Path == "" {
+		key.Path = "/"
+	}
+	return key.String()
+}
+
+// newID returns a random crawl ID
+func newID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
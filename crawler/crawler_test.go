@@ -0,0 +1,361 @@
+package crawler
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"web-page-analyzer/analyzer"
+)
+
+// newSite serves pages linking to each other per links, plus a sitemap; pages
+// under /private are marked noindex
+func newSite(t *testing.T, links map[string][]string, sitemap []string) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sitemap.xml" {
+			fmt.Fprint(w, `<?xml version="1.0"?><urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`)
+			for _, path := range sitemap {
+				fmt.Fprintf(w, "<url><loc>%s%s</loc></url>", server.URL, path)
+			}
+			fmt.Fprint(w, `</urlset>`)
+			return
+		}
+		targets, ok := links[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		if strings.HasPrefix(r.URL.Path, "/private") {
+			w.Header().Set("X-Robots-Tag", "noindex")
+		}
+		fmt.Fprintf(w, "<html><head><title>%s</title></head><body>", r.URL.Path)
+		for _, target := range targets {
+			fmt.Fprintf(w, `<a href="%s">link</a>`, target)
+		}
+		fmt.Fprint(w, "</body></html>")
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// waitFor polls a crawl until it finishes
+func waitFor(t *testing.T, c *Crawler, id string) Crawl {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		crawl, ok := c.Get(id)
+		if !ok {
+			t.Fatalf("Expected crawl %s to exist", id)
+		}
+		if crawl.Status != StatusRunning {
+			return crawl
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("Crawl %s did not finish", id)
+	return Crawl{}
+}
+
+func TestCrawl(t *testing.T) {
+	site := newSite(t, map[string][]string{
+		"/":       {"/a", "/b#section", "/files/report.pdf", "https://external.example/"},
+		"/a":      {"/c", "/"},
+		"/b":      {"/c"},
+		"/c":      {"/d"},
+		"/d":      {"/e"},
+		"/e":      {},
+		"/orphan": {},
+	}, []string{"/", "/a", "/e", "/orphan"})
+
+	c := New(analyzer.NewAnalyzer(10 * time.Second))
+	started, err := c.Start(context.Background(), site.URL, Options{DeepPageThreshold: 2})
+	if err != nil {
+		t.Fatalf("Expected crawl to start, got %v", err)
+	}
+	crawl := waitFor(t, c, started.ID)
+
+	if crawl.Status != StatusCompleted {
+		t.Fatalf("Expected completed crawl, got %s: %s", crawl.Status, crawl.Error)
+	}
+	depths := make(map[string]int)
+	for _, page := range crawl.Pages {
+		depths[page.URL[len(site.URL):]] = page.Depth
+	}
+	expected := map[string]int{"": 0, "/a": 1, "/b": 1, "/c": 2, "/d": 3, "/e": 4}
+	if len(depths) != len(expected) {
+		t.Errorf("Expected %d pages, got %v", len(expected), depths)
+	}
+	for path, depth := range expected {
+		if got, ok := depths[path]; !ok || got != depth {
+			t.Errorf("Expected %q at depth %d, got %d (crawled: %v)", path, depth, got, ok)
+		}
+	}
+
+	if len(crawl.Orphans) != 1 || crawl.Orphans[0] != site.URL+"/orphan" {
+		t.Errorf("Expected /orphan to be the only orphan, got %v", crawl.Orphans)
+	}
+	if crawl.SitemapURLs != 4 {
+		t.Errorf("Expected 4 sitemap URLs, got %d", crawl.SitemapURLs)
+	}
+	if len(crawl.DeepPages) != 2 {
+		t.Errorf("Expected /d and /e to be deep pages, got %v", crawl.DeepPages)
+	}
+	if crawl.Truncated {
+		t.Error("Expected the crawl not to be truncated")
+	}
+}
+
+func TestCrawlLimits(t *testing.T) {
+	site := newSite(t, map[string][]string{
+		"/":  {"/a", "/b", "/c"},
+		"/a": {"/d"},
+		"/b": {}, "/c": {}, "/d": {},
+	}, nil)
+	c := New(analyzer.NewAnalyzer(10 * time.Second))
+
+	testCases := []struct {
+		name  string
+		opts  Options
+		pages int
+	}{
+		{"page limit", Options{MaxPages: 2}, 2},
+		{"depth limit", Options{MaxDepth: 1}, 4},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			started, err := c.Start(context.Background(), site.URL, tc.opts)
+			if err != nil {
+				t.Fatalf("Expected crawl to start, got %v", err)
+			}
+			crawl := waitFor(t, c, started.ID)
+			if len(crawl.Pages) != tc.pages || !crawl.Truncated {
+				t.Errorf("Expected %d pages and a truncated crawl, got %d pages (truncated %v)", tc.pages, len(crawl.Pages), crawl.Truncated)
+			}
+		})
+	}
+
+	if _, err := c.Start(context.Background(), "http://exa mple.com", Options{}); err == nil {
+		t.Error("Expected an invalid start URL to be rejected")
+	}
+	if _, ok := c.Get("missing"); ok {
+		t.Error("Expected unknown crawl IDs not to be found")
+	}
+}
+
+// countingLimiter admits every analysis and records the batch slots taken
+type countingLimiter struct {
+	mu       sync.Mutex
+	acquired int
+	batch    bool
+}
+
+func (l *countingLimiter) Acquire(ctx context.Context, batch bool) (func(), bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.acquired++
+	l.batch = batch
+	return func() {}, true
+}
+
+func TestCrawlLimiter(t *testing.T) {
+	site := newSite(t, map[string][]string{
+		"/":  {"/a", "/b"},
+		"/a": {}, "/b": {},
+	}, nil)
+	c := New(analyzer.NewAnalyzer(10 * time.Second))
+	limiter := &countingLimiter{}
+	c.SetLimiter(limiter)
+
+	started, err := c.Start(context.Background(), site.URL, Options{})
+	if err != nil {
+		t.Fatalf("Expected crawl to start, got %v", err)
+	}
+	crawl := waitFor(t, c, started.ID)
+
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	if limiter.acquired != len(crawl.Pages) || !limiter.batch {
+		t.Errorf("Expected a batch slot for each of the %d pages, got %d (batch %v)", len(crawl.Pages), limiter.acquired, limiter.batch)
+	}
+}
+
+func TestSitemap(t *testing.T) {
+	site := newSite(t, map[string][]string{
+		"/":        {"/a", "/private", "/missing", "/a#top"},
+		"/a":       {"/"},
+		"/private": {},
+	}, nil)
+
+	c := New(analyzer.NewAnalyzer(10 * time.Second))
+	started, err := c.Start(context.Background(), site.URL, Options{})
+	if err != nil {
+		t.Fatalf("Expected crawl to start, got %v", err)
+	}
+	crawl := waitFor(t, c, started.ID)
+
+	expected := []string{site.URL, site.URL + "/a"}
+	pages := crawl.SitemapPages()
+	if strings.Join(pages, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected sitemap pages %v, got %v", expected, pages)
+	}
+
+	body, err := crawl.Sitemap()
+	if err != nil {
+		t.Fatalf("Expected sitemap to render, got %v", err)
+	}
+	for _, want := range []string{`<?xml version="1.0" encoding="UTF-8"?>`, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`, "<loc>" + site.URL + "/a</loc>"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("Expected sitemap to contain %q, got %s", want, body)
+		}
+	}
+	if strings.Contains(string(body), "/private") || strings.Contains(string(body), "/missing") {
+		t.Errorf("Expected noindex and missing pages to be left out, got %s", body)
+	}
+}
+
+func TestBrokenLinks(t *testing.T) {
+	dead := httptest.NewServer(http.NotFoundHandler())
+	deadURL := strings.Replace(dead.URL, "127.0.0.1", "localhost", 1) + "/gone"
+	dead.Close()
+
+	site := newSite(t, map[string][]string{
+		"/":  {"/a", "/missing", deadURL},
+		"/a": {"/missing", "/missing#again", "/"},
+	}, nil)
+
+	c := New(analyzer.NewAnalyzer(10 * time.Second))
+	started, err := c.Start(context.Background(), site.URL, Options{CheckLinks: true})
+	if err != nil {
+		t.Fatalf("Expected crawl to start, got %v", err)
+	}
+	crawl := waitFor(t, c, started.ID)
+
+	if len(crawl.BrokenLinks) != 2 {
+		t.Fatalf("Expected 2 broken links, got %+v", crawl.BrokenLinks)
+	}
+	missing := crawl.BrokenLinks[0]
+	if missing.URL != site.URL+"/missing" || missing.External || missing.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected /missing to be broken with status 404, got %+v", missing)
+	}
+	if strings.Join(missing.Sources, " ") != site.URL+" "+site.URL+"/a" {
+		t.Errorf("Expected /missing to be linked from / and /a, got %v", missing.Sources)
+	}
+	external := crawl.BrokenLinks[1]
+	if external.URL != deadURL || !external.External || len(external.Sources) != 1 || external.Sources[0] != site.URL {
+		t.Errorf("Expected the dead external link to be linked from /, got %+v", external)
+	}
+}
+
+func TestFollow(t *testing.T) {
+	site := newSite(t, map[string][]string{
+		"/":  {"/a", "/b"},
+		"/a": {"/c"},
+		"/b": {}, "/c": {},
+	}, nil)
+
+	c := New(analyzer.NewAnalyzer(10 * time.Second))
+	started, err := c.Start(context.Background(), site.URL, Options{})
+	if err != nil {
+		t.Fatalf("Expected crawl to start, got %v", err)
+	}
+
+	var followed []Page
+	crawl, ok := c.Follow(context.Background(), started.ID, func(page Page) {
+		followed = append(followed, page)
+	})
+	if !ok || crawl.Status != StatusCompleted {
+		t.Fatalf("Expected to follow the crawl to completion, got %s (found %v)", crawl.Status, ok)
+	}
+	if len(followed) != 4 || len(crawl.Pages) != 4 {
+		t.Fatalf("Expected 4 pages followed and reported, got %d and %d", len(followed), len(crawl.Pages))
+	}
+	for i, page := range followed {
+		if page.URL != crawl.Pages[i].URL || page.Result == nil {
+			t.Errorf("Expected page %d to be %s with its analysis, got %s", i, crawl.Pages[i].URL, page.URL)
+		}
+		if i > 0 && page.Depth < followed[i-1].Depth {
+			t.Errorf("Expected pages in depth order, got %s at depth %d after depth %d", page.URL, page.Depth, followed[i-1].Depth)
+		}
+	}
+
+	// Following a finished crawl replays its pages
+	replayed := 0
+	c.Follow(context.Background(), started.ID, func(Page) { replayed++ })
+	if replayed != 4 {
+		t.Errorf("Expected 4 replayed pages, got %d", replayed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, ok := c.Follow(ctx, "missing", func(Page) {}); ok {
+		t.Error("Expected unknown crawl IDs not to be found")
+	}
+}
+
+func TestExport(t *testing.T) {
+	site := newSite(t, map[string][]string{
+		"/":  {"/a", "/missing"},
+		"/a": {},
+	}, nil)
+
+	c := New(analyzer.NewAnalyzer(10 * time.Second))
+	started, err := c.Start(context.Background(), site.URL, Options{})
+	if err != nil {
+		t.Fatalf("Expected crawl to start, got %v", err)
+	}
+	crawl := waitFor(t, c, started.ID)
+
+	body, err := crawl.Export()
+	if err != nil {
+		t.Fatalf("Unexpected export error: %v", err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("Expected a zip archive, got %v", err)
+	}
+	files := make(map[string]string)
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", file.Name, err)
+		}
+		content, _ := io.ReadAll(reader)
+		reader.Close()
+		files[file.Name] = string(content)
+	}
+
+	for _, name := range []string{"crawl.json", "pages.csv", "report.html", "sitemap.xml", "pages/0001.json", "pages/0002.json", "pages/0003.json"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("Expected %s in the export, got %d files", name, len(files))
+		}
+	}
+
+	var result analyzer.AnalysisResult
+	if err := json.Unmarshal([]byte(files["pages/0001.json"]), &result); err != nil || result.PageTitle != "/" {
+		t.Errorf("Expected the full analysis of the start page, got %q (%v)", result.PageTitle, err)
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(files["pages.csv"])).ReadAll()
+	if err != nil || len(rows) != 4 {
+		t.Fatalf("Expected a header and 3 rows, got %d (%v)", len(rows), err)
+	}
+	if rows[0][0] != "url" || rows[1][0] != site.URL || rows[1][5] != "/" {
+		t.Errorf("Expected the start page first, got %v", rows[1])
+	}
+
+	if !strings.Contains(files["report.html"], "<td>1</td></tr>") || !strings.Contains(files["report.html"], site.URL+"/missing") {
+		t.Errorf("Expected the summary to list the broken link, got %s", files["report.html"])
+	}
+}
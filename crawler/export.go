@@ -0,0 +1,173 @@
+package crawler
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"strconv"
+	"time"
+)
+
+// csvHeader names the columns of the per-page CSV in an export
+var csvHeader = []string{
+	"url", "final_url", "depth", "status_code", "error_code", "title", "html_version",
+	"internal_links", "external_links", "inaccessible_links", "noindex", "has_login_form",
+	"word_count", "h1", "h2", "h3",
+}
+
+// Export bundles a crawl's audit artifacts into a zip archive: crawl.json with
+// the report, pages.csv with one row per page, report.html summarizing the
+// crawl, sitemap.xml, and pages/ holding the full analysis of every page as
+// JSON, numbered in crawl order
+func (c *Crawl) Export() ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	modified := c.FinishedAt
+	if modified.IsZero() {
+		modified = time.Now().UTC()
+	}
+	add := func(name string, body []byte) error {
+		file, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+		if err != nil {
+			return err
+		}
+		_, err = file.Write(body)
+		return err
+	}
+
+	report, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := add("crawl.json", report); err != nil {
+		return nil, err
+	}
+
+	pagesCSV, err := c.pagesCSV()
+	if err != nil {
+		return nil, err
+	}
+	if err := add("pages.csv", pagesCSV); err != nil {
+		return nil, err
+	}
+
+	var summary bytes.Buffer
+	if err := exportTemplate.Execute(&summary, c); err != nil {
+		return nil, err
+	}
+	if err := add("report.html", summary.Bytes()); err != nil {
+		return nil, err
+	}
+
+	sitemap, err := c.Sitemap()
+	if err != nil {
+		return nil, err
+	}
+	if err := add("sitemap.xml", sitemap); err != nil {
+		return nil, err
+	}
+
+	for i, page := range c.Pages {
+		// A page without an analysis exports its summary
+		var body []byte
+		if page.Result != nil {
+			body, err = json.MarshalIndent(page.Result, "", "  ")
+		} else {
+			body, err = json.MarshalIndent(page, "", "  ")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := add(fmt.Sprintf("pages/%04d.json", i+1), body); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// pagesCSV renders one row per crawled page with the main figures of its analysis
+func (c *Crawl) pagesCSV() ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if err := writer.Write(csvHeader); err != nil {
+		return nil, err
+	}
+	for _, page := range c.Pages {
+		row := []string{
+			page.URL, "", strconv.Itoa(page.Depth), strconv.Itoa(page.StatusCode), page.ErrorCode, page.Title, "",
+			strconv.Itoa(page.InternalLinks), strconv.Itoa(page.ExternalLinks), strconv.Itoa(page.InaccessibleLinks),
+			strconv.FormatBool(page.Noindex), "", "", "", "", "",
+		}
+		if result := page.Result; result != nil {
+			row[1] = result.FinalURL
+			row[6] = result.HTMLVersion
+			row[11] = strconv.FormatBool(result.HasLoginForm)
+			if result.MainContent != nil {
+				row[12] = strconv.Itoa(result.MainContent.WordCount)
+			}
+			for i, level := range []string{"h1", "h2", "h3"} {
+				row[13+i] = strconv.Itoa(result.HeadingCounts[level])
+			}
+		}
+		if err := writer.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+var exportTemplate = template.Must(template.New("export").Funcs(template.FuncMap{
+	"date": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.Format(time.RFC1123)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Crawl of {{.StartURL}}</title></head>
+<body style="font-family: sans-serif">
+<h1>Crawl of <a href="{{.StartURL}}">{{.StartURL}}</a> &mdash; {{.Status}}</h1>
+<p>Started {{date .StartedAt}}<br>Finished {{date .FinishedAt}}{{if .Error}}<br><strong>Error:</strong> {{.Error}}{{end}}</p>
+<table border="1" cellpadding="6" cellspacing="0">
+<tr><th align="left">Pages crawled</th><td>{{len .Pages}}{{if .Truncated}} (truncated){{end}}</td></tr>
+<tr><th align="left">Sitemap URLs</th><td>{{.SitemapURLs}}</td></tr>
+<tr><th align="left">Orphan pages</th><td>{{len .Orphans}}</td></tr>
+<tr><th align="left">Deep pages</th><td>{{len .DeepPages}}</td></tr>
+<tr><th align="left">Broken links</th><td>{{len .BrokenLinks}}</td></tr>
+{{with .Hreflang}}<tr><th align="left">Hreflang issues</th><td>{{len .Issues}}</td></tr>
+{{end}}</table>
+{{if .BrokenLinks}}
+<h2>Broken links</h2>
+<ul>
+{{range .BrokenLinks}}<li><strong>{{.URL}}</strong>{{if .StatusCode}} ({{.StatusCode}}){{else if .ErrorCode}} ({{.ErrorCode}}){{end}} linked from {{len .Sources}} page(s)</li>
+{{end}}</ul>
+{{end}}
+{{if .Orphans}}
+<h2>Orphan pages</h2>
+<ul>
+{{range .Orphans}}<li>{{.}}</li>
+{{end}}</ul>
+{{end}}
+{{if .DeepPages}}
+<h2>Deep pages</h2>
+<ul>
+{{range .DeepPages}}<li>{{.}}</li>
+{{end}}</ul>
+{{end}}
+<h2>Pages</h2>
+<table border="1" cellpadding="6" cellspacing="0">
+<tr><th>URL</th><th>Depth</th><th>Status</th><th>Title</th><th>Internal</th><th>External</th><th>Inaccessible</th></tr>
+{{range .Pages}}<tr><td><a href="{{.URL}}">{{.URL}}</a></td><td>{{.Depth}}</td><td>{{if .ErrorCode}}{{.ErrorCode}}{{else}}{{.StatusCode}}{{end}}{{if .Noindex}} noindex{{end}}</td><td>{{.Title}}</td><td>{{.InternalLinks}}</td><td>{{.ExternalLinks}}</td><td>{{.InaccessibleLinks}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
@@ -0,0 +1,66 @@
+package crawler
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// sitemapNamespace is the XML namespace of the sitemaps.org protocol
+const sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// urlset is the root element of a generated sitemap
+type urlset struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc string `xml:"loc"`
+}
+
+// SitemapPages returns the crawled pages that belong in a sitemap: those served
+// with status 200 on the crawled host and not marked noindex. Pages are listed
+// under the URL they were served from, once each, in crawl order.
+func (c *Crawl) SitemapPages() []string {
+	var host string
+	seen := make(map[string]bool)
+	var pages []string
+	for i, page := range c.Pages {
+		loc := page.URL
+		if page.Result != nil && page.Result.FinalURL != "" {
+			loc = page.Result.FinalURL
+		}
+		parsed, err := url.Parse(loc)
+		if err != nil {
+			continue
+		}
+		// Redirects of the start URL decide which host the crawl covers
+		if i == 0 {
+			host = parsed.Hostname()
+		}
+		if page.StatusCode != http.StatusOK || page.ErrorCode != "" || page.Noindex || !strings.EqualFold(parsed.Hostname(), host) {
+			continue
+		}
+		if key := pageKey(parsed); !seen[key] {
+			seen[key] = true
+			pages = append(pages, parsed.String())
+		}
+	}
+	return pages
+}
+
+// Sitemap renders SitemapPages as a sitemaps.org XML document
+func (c *Crawl) Sitemap() ([]byte, error) {
+	set := urlset{Xmlns: sitemapNamespace}
+	for _, page := range c.SitemapPages() {
+		set.URLs = append(set.URLs, sitemapURL{Loc: page})
+	}
+	body, err := xml.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(body, '\n')...), nil
+}
@@ -3,8 +3,12 @@ module web-page-analyzer
 go 1.21
 
 require (
+	github.com/andybalholm/brotli v1.1.0
 	go.uber.org/zap v1.27.0
 	golang.org/x/net v0.17.0
 )
 
-require go.uber.org/multierr v1.11.0 // indirect
+require (
+	go.uber.org/multierr v1.11.0 // indirect
+	golang.org/x/text v0.13.0 // indirect
+)
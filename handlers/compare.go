@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+
+	"web-page-analyzer/analyzer"
+	"web-page-analyzer/history"
+	"web-page-analyzer/logger"
+)
+
+// compareTemplate renders two stored results side by side
+var compareTemplate = template.Must(template.New("compare").Parse(compareHTML))
+
+// compareFieldLabels maps diff fields to the message IDs of their labels
+var compareFieldLabels = map[string]string{
+	"url":                "field_url",
+	"final_url":          "field_final_url",
+	"status_code":        "field_status_code",
+	"error":              "field_error",
+	"page_title":         "field_page_title",
+	"html_version":       "field_html_version",
+	"content_length":     "field_content_length",
+	"has_login_form":     "field_login_form",
+	"internal_links":     "links_internal",
+	"external_links":     "links_external",
+	"inaccessible_links": "links_inaccessible",
+}
+
+// compareData is the data passed to the compare template; Diff is nil until two
+// results have been found
+type compareData struct {
+	Lang     string
+	T        map[string]string
+	A, B     string
+	NotFound bool
+	Diff     *history.Diff
+	Fields   []compareRow
+}
+
+// compareRow is a diff field with its localized label
+type compareRow struct {
+	Label string
+	analyzer.FieldDiff
+}
+
+// CompareHandler serves /compare?a={id}&b={id}, showing the differences between
+// two stored results; without both IDs it shows a form to enter them
+func (s *Server) CompareHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.results == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	lang := requestLanguage(r)
+	messages, _ := catalog(lang)
+	data := compareData{Lang: lang, T: messages, A: r.URL.Query().Get("a"), B: r.URL.Query().Get("b")}
+
+	statusCode := http.StatusOK
+	if data.A != "" && data.B != "" {
+		before, err := s.results.Get(data.A)
+		if err == nil {
+			var after *history.Record
+			after, err = s.results.Get(data.B)
+			if err == nil {
+				data.Diff = history.Compare(before, after)
+				for _, field := range data.Diff.Fields {
+					data.Fields = append(data.Fields, compareRow{Label: messages[compareFieldLabels[field.Field]], FieldDiff: field})
+				}
+			}
+		}
+		switch {
+		case errors.Is(err, history.ErrNotFound):
+			data.NotFound = true
+			statusCode = http.StatusNotFound
+		case err != nil:
+			logger.Sugar.Errorw("Failed to load stored result", "a", data.A, "b", data.B, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	w.Header().Set("Content-Language", lang)
+	w.Header().Set("Vary", "Accept-Language")
+	w.WriteHeader(statusCode)
+	if err := compareTemplate.Execute(w, data); err != nil {
+		logger.Sugar.Errorw("Template execution error", "error", err)
+	}
+}
+
+const compareHTML = `
+<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <meta name="robots" content="noindex">
+    <title>{{.T.compare_title}} - {{.T.app_title}}</title>
+    <link rel="stylesheet" href="/static/css/styles.css">
+</head>
+<body>
+    <div class="container">
+        <div class="main-content">
+            <div class="header">
+                <h1 class="title">{{.T.app_title}}</h1>
+                <p class="subtitle">{{.T.compare_title}}</p>
+            </div>
+
+            <div class="card">
+                <form method="get" action="/compare">
+                    <div class="form-group">
+                        <label for="a" class="form-label">{{.T.compare_before}}</label>
+                        <input type="text" id="a" name="a" class="form-input" required value="{{.A}}" placeholder="{{.T.result_id}}">
+                    </div>
+                    <div class="form-group">
+                        <label for="b" class="form-label">{{.T.compare_after}}</label>
+                        <input type="text" id="b" name="b" class="form-input" required value="{{.B}}" placeholder="{{.T.result_id}}">
+                    </div>
+                    <button type="submit" class="btn btn-primary">{{.T.compare_button}}</button>
+                </form>
+                {{- if .NotFound}}
+
+                <div class="error-state">
+                    <div class="error-icon">⚠️</div>
+                    <div class="error-message">{{.T.result_not_found}}</div>
+                </div>
+                {{- end}}
+                {{- with .Diff}}
+
+                <h2 class="results-header">{{$.T.compare_changes}}: {{.Changes}}</h2>
+                <table class="data-table">
+                    <thead>
+                        <tr>
+                            <th></th>
+                            <th><a href="/r/{{.Before.ID}}">{{$.T.compare_before}}</a> ({{.Before.CreatedAt.Format "2006-01-02 15:04"}})</th>
+                            <th><a href="/r/{{.After.ID}}">{{$.T.compare_after}}</a> ({{.After.CreatedAt.Format "2006-01-02 15:04"}})</th>
+                        </tr>
+                    </thead>
+                    <tbody>
+                        {{- range $.Fields}}
+                        <tr{{if .Changed}} class="changed"{{end}}>
+                            <th>{{.Label}}</th>
+                            <td>{{.Before}}</td>
+                            <td>{{.After}}</td>
+                        </tr>
+                        {{- end}}
+                    </tbody>
+                </table>
+
+                <h3 class="result-label">{{$.T.field_headings}}</h3>
+                {{- if .Headings}}
+                <table class="data-table">
+                    <tbody>
+                        {{- range .Headings}}
+                        <tr{{if .Changed}} class="changed"{{end}}>
+                            <th>{{.Field}}</th>
+                            <td>{{.Before}}</td>
+                            <td>{{.After}}</td>
+                        </tr>
+                        {{- end}}
+                    </tbody>
+                </table>
+                {{- else}}
+                <p class="form-help">{{$.T.no_headings}}</p>
+                {{- end}}
+
+                <h3 class="result-label">{{$.T.field_links}}</h3>
+                {{- if not .LinksCompared}}
+                <p class="form-help">{{$.T.links_not_compared}}</p>
+                {{- else if or .LinksAdded .LinksRemoved}}
+                <ul class="headings-list">
+                    {{- range .LinksAdded}}
+                    <li class="added">+ {{.}}</li>
+                    {{- end}}
+                    {{- range .LinksRemoved}}
+                    <li class="removed">&minus; {{.}}</li>
+                    {{- end}}
+                </ul>
+                {{- else}}
+                <p class="form-help">{{$.T.no_differences}}</p>
+                {{- end}}
+                {{- end}}
+
+                <p><a href="/dashboard" class="btn btn-primary">{{.T.dashboard_title}}</a></p>
+            </div>
+        </div>
+    </div>
+</body>
+</html>`
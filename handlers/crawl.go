@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"web-page-analyzer/crawler"
+	"web-page-analyzer/logger"
+)
+
+// crawlPrefix is the path under which crawl reports are served
+const crawlPrefix = "/crawl/"
+
+// crawlSitemapSuffix follows a crawl ID to request the sitemap generated from the crawl
+const crawlSitemapSuffix = "/sitemap.xml"
+
+// crawlExportSuffix follows a crawl ID to request the zip bundle of the crawl's artifacts
+const crawlExportSuffix = "/export.zip"
+
+// CrawlHandler starts a crawl from the url form parameter and returns it with
+// 202 Accepted; the report is then polled at /crawl/{id}
+func (s *Server) CrawlHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	startURL := r.FormValue("url")
+	if startURL == "" {
+		http.Error(w, "URL parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	opts := crawler.Options{CheckLinks: r.FormValue("check_links") == "true"}
+	for _, param := range []struct {
+		name   string
+		target *int
+		limit  int
+	}{
+		{"max_pages", &opts.MaxPages, crawler.MaxPages},
+		{"max_depth", &opts.MaxDepth, 0},
+		{"deep_page_threshold", &opts.DeepPageThreshold, 0},
+	} {
+		value := r.FormValue(param.name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || (param.limit > 0 && parsed > param.limit) {
+			message := fmt.Sprintf("%s must be a positive integer", param.name)
+			if param.limit > 0 {
+				message = fmt.Sprintf("%s must be between 1 and %d", param.name, param.limit)
+			}
+			http.Error(w, message, http.StatusBadRequest)
+			return
+		}
+		*param.target = parsed
+	}
+
+	crawl, err := s.crawls.Start(r.Context(), startURL, opts)
+	switch {
+	case errors.Is(err, crawler.ErrTooManyCrawls):
+		http.Error(w, "Too many crawls running, retry later", http.StatusTooManyRequests)
+		return
+	case err != nil:
+		http.Error(w, "Invalid URL format", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", crawlPrefix+crawl.ID)
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(crawl); err != nil {
+		logger.Sugar.Errorw("JSON encoding error", "error", err)
+	}
+}
+
+// CrawlReportHandler serves the progress or report of a crawl at /crawl/{id},
+// the sitemap generated from a finished crawl at /crawl/{id}/sitemap.xml, and
+// the bundle of its audit artifacts at /crawl/{id}/export.zip.
+// With Accept: application/x-ndjson the report follows the crawl, streaming
+// every page with its analysis as it completes and the report once it finishes.
+func (s *Server) CrawlReportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, crawlPrefix)
+	id, sitemap := strings.CutSuffix(id, crawlSitemapSuffix)
+	id, export := strings.CutSuffix(id, crawlExportSuffix)
+	crawl, ok := s.crawls.Get(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if sitemap {
+		s.serveCrawlSitemap(w, &crawl)
+		return
+	}
+	if export {
+		s.serveCrawlExport(w, &crawl)
+		return
+	}
+	if wantsNDJSON(r) {
+		stream := newNDJSONWriter(w)
+		if followed, ok := s.crawls.Follow(r.Context(), id, stream.page); ok {
+			crawl = followed
+		}
+		stream.report(crawl)
+		return
+	}
+
+	// A crawl report only changes when a page is added or the crawl finishes
+	if checkNotModified(w, r, versionETag(crawl.ID, crawl.Status, len(crawl.Pages)), crawl.FinishedAt) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(crawl); err != nil {
+		logger.Sugar.Errorw("JSON encoding error", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// serveCrawlSitemap writes the sitemap of a finished crawl
+func (s *Server) serveCrawlSitemap(w http.ResponseWriter, crawl *crawler.Crawl) {
+	if crawl.Status == crawler.StatusRunning {
+		http.Error(w, "Crawl is still running", http.StatusConflict)
+		return
+	}
+
+	body, err := crawl.Sitemap()
+	if err != nil {
+		logger.Sugar.Errorw("Sitemap encoding error", "crawl", crawl.ID, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write(body)
+}
+
+// serveCrawlExport writes the zip bundle of a finished crawl
+func (s *Server) serveCrawlExport(w http.ResponseWriter, crawl *crawler.Crawl) {
+	if crawl.Status == crawler.StatusRunning {
+		http.Error(w, "Crawl is still running", http.StatusConflict)
+		return
+	}
+
+	body, err := crawl.Export()
+	if err != nil {
+		logger.Sugar.Errorw("Crawl export error", "crawl", crawl.ID, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="crawl-%s.zip"`, crawl.ID))
+	w.Write(body)
+}
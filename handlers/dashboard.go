@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
+
+	"web-page-analyzer/history"
+	"web-page-analyzer/logger"
+)
+
+// Dashboard limits
+const (
+	dashboardRecentLimit  = 20 // analyses listed under recent analyses
+	dashboardHistoryLimit = 50 // runs of one URL shown in its history charts
+	chartWidth            = 600
+	chartHeight           = 120
+	chartBarGap           = 2
+)
+
+// dashboardTemplate renders the dashboard page
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(dashboardHTML))
+
+// dashboardData is the data passed to the dashboard template
+type dashboardData struct {
+	Lang    string
+	T       map[string]string
+	Summary dashboardSummary
+	// HistoryEnabled is false when no result store is configured
+	HistoryEnabled bool
+	Recent         []history.Entry
+	// URL selects the per-URL history shown below the summary
+	URL               string
+	History           []history.Entry
+	DurationChart     *chart
+	InaccessibleChart *chart
+}
+
+// dashboardSummary holds the analyzer metrics shown on the dashboard, formatted for display
+type dashboardSummary struct {
+	TotalRequests  int64
+	ActiveRequests int64
+	ErrorRate      string
+	AvgLatency     string
+	LatencyP50     string
+	LatencyP95     string
+	CacheHitRatio  string
+}
+
+// chart is a bar chart of one value across the runs of a URL, oldest first
+type chart struct {
+	Width  int
+	Height int
+	Max    int64
+	Bars   []chartBar
+}
+
+// chartBar is one run in a chart; failed runs are highlighted and every bar
+// links to the stored result
+type chartBar struct {
+	X, Y, Width, Height int
+	Value               int64
+	ID                  string
+	CreatedAt           time.Time
+	Failed              bool
+}
+
+// newChart plots value for entries, which must be ordered oldest first
+func newChart(entries []history.Entry, value func(history.Entry) int64) *chart {
+	c := &chart{Width: chartWidth, Height: chartHeight}
+	if len(entries) == 0 {
+		return c
+	}
+	for _, entry := range entries {
+		if v := value(entry); v > c.Max {
+			c.Max = v
+		}
+	}
+
+	slot := chartWidth / len(entries)
+	for i, entry := range entries {
+		v := value(entry)
+		height := 0
+		if c.Max > 0 {
+			height = int(v * chartHeight / c.Max)
+		}
+		// Keep zero values visible as a sliver so every run can be clicked
+		if height < 1 {
+			height = 1
+		}
+		c.Bars = append(c.Bars, chartBar{
+			X:         i * slot,
+			Y:         chartHeight - height,
+			Width:     max(slot-chartBarGap, 1),
+			Height:    height,
+			Value:     v,
+			ID:        entry.ID,
+			CreatedAt: entry.CreatedAt,
+			Failed:    entry.ErrorCode != "",
+		})
+	}
+	return c
+}
+
+// DashboardHandler serves /dashboard: analyzer metrics, recent analyses and, with
+// ?url=, the history of one URL
+func (s *Server) DashboardHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	lang := requestLanguage(r)
+	messages, _ := catalog(lang)
+	metrics := s.analyzer.GetMetrics()
+	data := dashboardData{
+		Lang: lang,
+		T:    messages,
+		Summary: dashboardSummary{
+			TotalRequests:  metrics.TotalRequests,
+			ActiveRequests: metrics.ActiveRequests,
+			ErrorRate:      formatPercent(metrics.ErrorRate()),
+			AvgLatency:     formatLatency(metrics.AvgDuration),
+			LatencyP50:     formatLatency(metrics.LatencyP50),
+			LatencyP95:     formatLatency(metrics.LatencyP95),
+			CacheHitRatio:  formatPercent(metrics.CacheHitRatio()),
+		},
+		HistoryEnabled: s.results != nil,
+		URL:            r.URL.Query().Get("url"),
+	}
+
+	// Results are stored under their normalized URL, so the filter is normalized
+	// the same way; one that is not a valid URL matches nothing
+	if data.URL != "" {
+		if canonical, err := s.analyzer.CanonicalURL(data.URL); err == nil {
+			data.URL = canonical
+		}
+	}
+
+	if s.results != nil {
+		data.Recent = s.results.List("", dashboardRecentLimit)
+		if data.URL != "" {
+			data.History = s.results.List(data.URL, dashboardHistoryLimit)
+
+			// Charts read left to right, oldest run first
+			runs := make([]history.Entry, len(data.History))
+			for i, entry := range data.History {
+				runs[len(runs)-1-i] = entry
+			}
+			data.DurationChart = newChart(runs, func(e history.Entry) int64 { return e.DurationMs })
+			data.InaccessibleChart = newChart(runs, func(e history.Entry) int64 { return int64(e.InaccessibleLinks) })
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	w.Header().Set("Content-Language", lang)
+	w.Header().Set("Vary", "Accept-Language")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := dashboardTemplate.Execute(w, data); err != nil {
+		logger.Sugar.Errorw("Template execution error", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func formatPercent(ratio float64) string {
+	return fmt.Sprintf("%.1f%%", ratio*100)
+}
+
+func formatLatency(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+const dashboardHTML = `
+<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <meta name="robots" content="noindex">
+    <title>{{.T.dashboard_title}} - {{.T.app_title}}</title>
+    <link rel="stylesheet" href="/static/css/styles.css">
+</head>
+<body>
+    <div class="container">
+        <div class="main-content">
+            <div class="header">
+                <h1 class="title">{{.T.app_title}}</h1>
+                <p class="subtitle">{{.T.dashboard_title}}</p>
+            </div>
+
+            <div class="card">
+                <div class="stats-grid">
+                    <div class="stat"><div class="stat-value">{{.Summary.TotalRequests}}</div><div class="stat-label">{{.T.stat_total}}</div></div>
+                    <div class="stat"><div class="stat-value">{{.Summary.ActiveRequests}}</div><div class="stat-label">{{.T.stat_active}}</div></div>
+                    <div class="stat"><div class="stat-value">{{.Summary.ErrorRate}}</div><div class="stat-label">{{.T.stat_error_rate}}</div></div>
+                    <div class="stat"><div class="stat-value">{{.Summary.AvgLatency}}</div><div class="stat-label">{{.T.stat_avg_latency}}</div></div>
+                    <div class="stat"><div class="stat-value">{{.Summary.LatencyP50}}</div><div class="stat-label">{{.T.stat_p50_latency}}</div></div>
+                    <div class="stat"><div class="stat-value">{{.Summary.LatencyP95}}</div><div class="stat-label">{{.T.stat_p95_latency}}</div></div>
+                    <div class="stat"><div class="stat-value">{{.Summary.CacheHitRatio}}</div><div class="stat-label">{{.T.stat_cache_hit_ratio}}</div></div>
+                </div>
+                {{- if not .HistoryEnabled}}
+
+                <p class="form-help">{{.T.history_disabled}}</p>
+                {{- else}}
+                {{- if .URL}}
+
+                <h2 class="results-header">{{.T.history_for}} {{.URL}}</h2>
+                {{- if .History}}
+                {{- if gt (len .History) 1}}
+                <p><a href="/compare?a={{(index .History 1).ID}}&amp;b={{(index .History 0).ID}}">{{.T.compare_latest}}</a></p>
+                {{- end}}
+                {{- with .DurationChart}}
+                <h3 class="result-label">{{$.T.chart_duration}} (0–{{.Max}})</h3>
+                <svg class="chart" viewBox="0 0 {{.Width}} {{.Height}}" role="img" aria-label="{{$.T.chart_duration}}">
+                    {{- range .Bars}}
+                    <a href="/r/{{.ID}}"><rect class="chart-bar{{if .Failed}} failed{{end}}" x="{{.X}}" y="{{.Y}}" width="{{.Width}}" height="{{.Height}}"><title>{{.CreatedAt.Format "2006-01-02 15:04"}}: {{.Value}}</title></rect></a>
+                    {{- end}}
+                </svg>
+                {{- end}}
+                {{- with .InaccessibleChart}}
+                <h3 class="result-label">{{$.T.chart_inaccessible}} (0–{{.Max}})</h3>
+                <svg class="chart" viewBox="0 0 {{.Width}} {{.Height}}" role="img" aria-label="{{$.T.chart_inaccessible}}">
+                    {{- range .Bars}}
+                    <a href="/r/{{.ID}}"><rect class="chart-bar{{if .Failed}} failed{{end}}" x="{{.X}}" y="{{.Y}}" width="{{.Width}}" height="{{.Height}}"><title>{{.CreatedAt.Format "2006-01-02 15:04"}}: {{.Value}}</title></rect></a>
+                    {{- end}}
+                </svg>
+                {{- end}}
+                {{- else}}
+                <p class="form-help">{{.T.no_analyses}}</p>
+                {{- end}}
+                {{- end}}
+
+                <h2 class="results-header">{{.T.recent_analyses}}</h2>
+                {{- if .Recent}}
+                <table class="data-table">
+                    <thead>
+                        <tr>
+                            <th>{{.T.field_analyzed_at}}</th>
+                            <th>{{.T.field_url}}</th>
+                            <th>{{.T.field_status_code}}</th>
+                            <th>{{.T.field_duration}}</th>
+                            <th>{{.T.links_internal}} / {{.T.links_external}} / {{.T.links_inaccessible}}</th>
+                            <th></th>
+                        </tr>
+                    </thead>
+                    <tbody>
+                        {{- range .Recent}}
+                        <tr>
+                            <td><a href="/r/{{.ID}}">{{.CreatedAt.Format "2006-01-02 15:04"}}</a></td>
+                            <td>{{.URL}}</td>
+                            <td{{if .ErrorCode}} class="failed"{{end}}>{{if .ErrorCode}}{{.ErrorCode}}{{else}}{{.StatusCode}}{{end}}</td>
+                            <td>{{.DurationMs}} ms</td>
+                            <td>{{.InternalLinks}} / {{.ExternalLinks}} / {{.InaccessibleLinks}}</td>
+                            <td><a href="/dashboard?url={{.URL}}">{{$.T.view_history}}</a></td>
+                        </tr>
+                        {{- end}}
+                    </tbody>
+                </table>
+                {{- else}}
+                <p class="form-help">{{.T.no_analyses}}</p>
+                {{- end}}
+                {{- end}}
+
+                <p><a href="/" class="btn btn-primary">{{.T.analyze_another}}</a></p>
+            </div>
+        </div>
+    </div>
+</body>
+</html>`
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"web-page-analyzer/analyzer"
+)
+
+// resultETag is a weak entity tag for an analysis result, hashed from the
+// result as cached. Fields that differ per request for the same cached analysis
+// are left out, so repeated requests answered from the cache share the tag; a
+// fresh analysis has a new fetched_at and therefore a new tag. variant names the
+// representation, such as JSON or HTML in one language, so each has its own tag.
+func resultETag(result *analyzer.AnalysisResult, variant string) string {
+	cached := *result
+	cached.CacheHit = false
+	cached.Coalesced = false
+	cached.AnalysisDurationMs = 0
+	cached.ID = ""
+	cached.Permalink = ""
+	data, err := json.Marshal(&cached)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(append(data, variant...))
+	return `W/"` + hex.EncodeToString(sum[:12]) + `"`
+}
+
+// versionETag is a strong entity tag naming one version of a resource
+func versionETag(parts ...interface{}) string {
+	values := make([]string, len(parts))
+	for i, part := range parts {
+		values[i] = fmt.Sprint(part)
+	}
+	return `"` + strings.Join(values, "-") + `"`
+}
+
+// checkNotModified sets the ETag and, when modified is set, Last-Modified of a
+// response, and answers 304 Not Modified when the request's If-None-Match lists
+// the tag, or without If-None-Match when If-Modified-Since is not older than
+// modified. It reports whether the 304 was sent.
+func checkNotModified(w http.ResponseWriter, r *http.Request, etag string, modified time.Time) bool {
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	notModified := false
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		notModified = etag != "" && etagListed(match, etag)
+	} else if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modified.IsZero() {
+		// HTTP dates have second precision
+		notModified = !modified.Truncate(time.Second).After(since)
+	}
+	if notModified {
+		w.WriteHeader(http.StatusNotModified)
+	}
+	return notModified
+}
+
+// etagListed reports whether an If-None-Match header matches etag, comparing
+// weakly as RFC 9110 requires for If-None-Match
+func etagListed(header, etag string) bool {
+	opaque := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == opaque {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"web-page-analyzer/analyzer"
+)
+
+// resultFields holds the JSON names of the top-level fields of a result, which
+// a fields parameter may select
+var resultFields = jsonFieldNames(reflect.TypeOf(analyzer.AnalysisResult{}))
+
+// jsonFieldNames returns the names a struct type's fields are encoded under
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names[name] = true
+	}
+	return names
+}
+
+// requestFields parses the fields parameter, a comma-separated list of result
+// fields to return such as page_title,heading_counts.h1; a dotted path selects
+// a key within an object. No fields selects the whole result.
+func requestFields(r *http.Request) ([]string, error) {
+	var fields []string
+	for _, field := range strings.Split(r.FormValue("fields"), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if top, _, _ := strings.Cut(field, "."); !resultFields[top] {
+			return nil, fmt.Errorf("Unknown field %q in fields", field)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// selectFields reduces a result to the given fields. The error is always kept,
+// so a failed analysis is never mistaken for an empty one.
+func selectFields(result *analyzer.AnalysisResult, fields []string) (interface{}, error) {
+	// A typed nil would defeat omitempty on an unfinished job's result
+	if result == nil {
+		return nil, nil
+	}
+	if len(fields) == 0 {
+		return result, nil
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	var full map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// Keep large integers such as content lengths exact
+	decoder.UseNumber()
+	if err := decoder.Decode(&full); err != nil {
+		return nil, err
+	}
+
+	selected := make(map[string]interface{}, len(fields)+1)
+	for _, field := range fields {
+		copyPath(full, selected, strings.Split(field, "."))
+	}
+	copyPath(full, selected, []string{"error"})
+	return selected, nil
+}
+
+// copyPath copies the value at path from src into dst, creating the objects
+// leading to it; a path missing from src is skipped
+func copyPath(src, dst map[string]interface{}, path []string) {
+	value, ok := src[path[0]]
+	if !ok {
+		return
+	}
+	if len(path) == 1 {
+		dst[path[0]] = value
+		return
+	}
+	nested, ok := value.(map[string]interface{})
+	if !ok {
+		return
+	}
+	child, ok := dst[path[0]].(map[string]interface{})
+	if !ok {
+		child = make(map[string]interface{})
+		dst[path[0]] = child
+	}
+	copyPath(nested, child, path[1:])
+}
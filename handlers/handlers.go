@@ -1,19 +1,39 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"html/template"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"web-page-analyzer/analyzer"
+	"web-page-analyzer/crawler"
+	"web-page-analyzer/history"
+	"web-page-analyzer/jobs"
 	"web-page-analyzer/logger"
+	"web-page-analyzer/middleware"
+	"web-page-analyzer/scheduler"
 )
 
 type Server struct {
 	analyzer *analyzer.Analyzer
 	template *template.Template
+	apiKeys  *middleware.APIKeyAuth
+	limiter  *middleware.ConcurrencyLimiter
+	memory   *middleware.MemoryGuard
+	schedule *scheduler.Scheduler
+	results  *history.Store
+	crawls   *crawler.Crawler
+	jobs     *jobs.Manager
+
+	// snapshotLimit caps the HTML stored with each result; zero stores none
+	snapshotLimit int64
 }
 
 // NewServer creates a new server instance
@@ -28,12 +48,368 @@ func NewServer() *Server {
 		analyzer.SetCacheVerbose(false)
 	}
 
+	// Optionally ignore tracking parameters such as utm_* when caching results
+	if os.Getenv("STRIP_TRACKING_PARAMS") == "true" {
+		analyzer.SetStripTrackingParams(true)
+	}
+
+	// Refuse to fetch private and loopback addresses when exposed publicly
+	if os.Getenv("BLOCK_PRIVATE_NETWORKS") == "true" {
+		analyzer.SetBlockPrivateNetworks(true)
+	}
+
+	// Flag known-malicious destinations from a local blocklist and/or Safe Browsing
+	configureThreatCheckers(analyzer)
+
+	// Keep failed analyses briefly, or not at all for selected error codes
+	configureNegativeCache(analyzer)
+
+	// Size link-check worker pools and bound the outbound requests of any one analysis
+	configureWorkerPool(analyzer)
+	configureOutboundBudget(analyzer)
+
+	// Keep the link check record of each host across restarts
+	if path := os.Getenv("HOST_REPUTATION_FILE"); path != "" {
+		if err := analyzer.LoadHostReputation(path); err != nil {
+			logger.Sugar.Errorw("Failed to load host reputation", "path", path, "error", err)
+		}
+	}
+
+	// Stop checking links after LINK_CHECK_DEADLINE_SECONDS; unset keeps the 45s default
+	analyzer.SetLinkCheckDeadline(time.Duration(envInt("LINK_CHECK_DEADLINE_SECONDS", 0)) * time.Second)
+
+	// Refuse pages larger than MAX_BODY_SIZE_MB; unset keeps the 10MB default
+	analyzer.SetMaxBodySize(int64(envInt("MAX_BODY_SIZE_MB", 0)) << 20)
+
+	// Merge Core Web Vitals from PageSpeed Insights into results that ask for them
+	analyzer.SetPageSpeedKey(os.Getenv("PAGESPEED_API_KEY"))
+
+	// Introduce the analyzer to target sites and honor their robots.txt opt-outs
+	configureBotIdentity(analyzer)
+
+	// Judge title and meta description lengths against configured SEO thresholds
+	configureSnippetThresholds(analyzer)
+
+	// Enforce outbound limits per host and share them across replicas via Redis
+	redis := configureSharedState(analyzer)
+
+	// Extract custom fields by CSS selector
+	configureExtractionRules(analyzer)
+
+	// Run custom checks from compiled-in and dynamically loaded plugins
+	configurePlugins(analyzer)
+
+	// Stream completed analyses to NATS and/or Kafka
+	configureEventPublishers(analyzer)
+
+	// Post Slack/Teams/webhook notifications when configured rules fire
+	configureNotifier(analyzer)
+
 	tmpl := template.Must(template.New("index").Parse(indexHTML))
 
-	return &Server{
+	server := &Server{
 		analyzer: analyzer,
 		template: tmpl,
+		apiKeys:  newAPIKeyAuth(),
+		limiter:  newConcurrencyLimiter(),
+		memory:   newMemoryGuard(),
+		schedule: newScheduler(analyzer, redis),
+		results:  newResultStore(),
+		crawls:   crawler.New(analyzer),
+	}
+	if server.results != nil {
+		server.snapshotLimit = int64(envInt("RESULTS_SNAPSHOT_KB", 0)) << 10
+	}
+
+	// Crawled pages and scheduled runs, like /analyze/async jobs, take batch
+	// slots of the limiter
+	server.crawls.SetLimiter(server.limiter)
+	server.schedule.SetLimiter(server.limiter)
+
+	// Run /analyze/async jobs in the background
+	server.jobs = newJobManager(server)
+	return server
+}
+
+// newResultStore keeps analysis results in RESULTS_DIR, pruning beyond RESULTS_MAX,
+// so they can be shared by permalink. Without RESULTS_DIR results are not stored.
+func newResultStore() *history.Store {
+	dir := os.Getenv("RESULTS_DIR")
+	if dir == "" {
+		return nil
+	}
+	store, err := history.Open(dir, envInt("RESULTS_MAX", history.DefaultMaxRecords))
+	if err != nil {
+		logger.Sugar.Fatalw("Failed to open result store", "dir", dir, "error", err)
+	}
+	return store
+}
+
+// newScheduler loads scheduled analyses from SCHEDULES_FILE and configures report
+// email through SMTP_ADDR, SMTP_FROM, SMTP_USERNAME and SMTP_PASSWORD. With Redis,
+// replicas elect a leader (SCHEDULER_LEASE_KEY) so each schedule runs once.
+func newScheduler(a *analyzer.Analyzer, redis *analyzer.RedisClient) *scheduler.Scheduler {
+	var schedules []*scheduler.Schedule
+	if path := os.Getenv("SCHEDULES_FILE"); path != "" {
+		loaded, err := scheduler.LoadSchedules(path)
+		if err != nil {
+			logger.Sugar.Fatalw("Failed to load schedules", "path", path, "error", err)
+		}
+		schedules = loaded
+	}
+
+	var mailer scheduler.Mailer
+	if addr := os.Getenv("SMTP_ADDR"); addr != "" {
+		smtpMailer, err := scheduler.NewSMTPMailer(addr, os.Getenv("SMTP_FROM"), os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"))
+		if err != nil {
+			logger.Sugar.Fatalw("Invalid SMTP configuration", "error", err)
+		}
+		mailer = smtpMailer
+	}
+
+	s := scheduler.New(a, schedules, mailer)
+	if path := os.Getenv("CHANGES_FILE"); path != "" {
+		changes, err := scheduler.LoadChangeLog(path)
+		if err != nil {
+			logger.Sugar.Fatalw("Failed to load change log", "path", path, "error", err)
+		}
+		s.SetChangeLog(changes)
+	}
+
+	// Replicas sharing Redis elect one instance to run the schedules
+	if redis != nil {
+		s.SetLease(scheduler.NewRedisLease(redis, os.Getenv("SCHEDULER_LEASE_KEY")))
+	}
+	return s
+}
+
+// newMemoryGuard sheds load under memory pressure, configured by MEMORY_SOFT_LIMIT_MB
+// (disable link checking) and MEMORY_HARD_LIMIT_MB (reject new analyses)
+func newMemoryGuard() *middleware.MemoryGuard {
+	softLimit := uint64(envInt("MEMORY_SOFT_LIMIT_MB", 0)) << 20
+	hardLimit := uint64(envInt("MEMORY_HARD_LIMIT_MB", 0)) << 20
+	if softLimit > 0 && hardLimit > 0 && softLimit >= hardLimit {
+		logger.Sugar.Warnw("MEMORY_SOFT_LIMIT_MB should be below MEMORY_HARD_LIMIT_MB",
+			"soft_limit_mb", softLimit>>20, "hard_limit_mb", hardLimit>>20)
+	}
+	return middleware.NewMemoryGuard(softLimit, hardLimit, middleware.DefaultMemorySampleInterval)
+}
+
+// newConcurrencyLimiter bounds simultaneous analyses, configured by MAX_CONCURRENT_ANALYSES,
+// ANALYSIS_QUEUE_SIZE and ANALYSIS_QUEUE_WAIT
+func newConcurrencyLimiter() *middleware.ConcurrencyLimiter {
+	maxConcurrent := envInt("MAX_CONCURRENT_ANALYSES", middleware.DefaultMaxConcurrent)
+	if maxConcurrent == 0 {
+		maxConcurrent = middleware.DefaultMaxConcurrent
+	}
+	maxQueued := envInt("ANALYSIS_QUEUE_SIZE", middleware.DefaultMaxQueued)
+
+	queueWait := middleware.DefaultQueueWait
+	if value := os.Getenv("ANALYSIS_QUEUE_WAIT"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+			queueWait = parsed
+		} else {
+			logger.Sugar.Warnw("Ignoring invalid ANALYSIS_QUEUE_WAIT", "value", value)
+		}
+	}
+
+	return middleware.NewConcurrencyLimiter(maxConcurrent, maxQueued, queueWait)
+}
+
+// envInt reads a non-negative integer from the environment, falling back to def
+func envInt(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 0 {
+		logger.Sugar.Warnw("Ignoring invalid integer setting", "name", name, "value", value)
+		return def
+	}
+	return parsed
+}
+
+// newAPIKeyAuth configures API key authentication and usage metering from the environment.
+// Authentication is disabled when API_KEYS is not set.
+func newAPIKeyAuth() *middleware.APIKeyAuth {
+	keys, err := middleware.ParseAPIKeys(os.Getenv("API_KEYS"))
+	if err != nil {
+		logger.Sugar.Fatalw("Invalid API_KEYS configuration", "error", err)
+	}
+
+	var store middleware.UsageStore = middleware.NewMemoryUsageStore()
+	if path := os.Getenv("USAGE_STORE_FILE"); path != "" {
+		fileStore, err := middleware.NewFileUsageStore(path)
+		if err != nil {
+			logger.Sugar.Fatalw("Failed to load API usage store", "path", path, "error", err)
+		}
+		store = fileStore
+	}
+
+	return middleware.NewAPIKeyAuth(keys, store)
+}
+
+// configureThreatCheckers registers the threat checkers enabled through the environment
+func configureThreatCheckers(a *analyzer.Analyzer) {
+	if path := os.Getenv("URL_BLOCKLIST_FILE"); path != "" {
+		if blocklist, err := analyzer.LoadBlocklist(path); err != nil {
+			logger.Sugar.Errorw("Failed to load URL blocklist", "path", path, "error", err)
+		} else {
+			a.AddThreatChecker(blocklist)
+		}
+	}
+	if apiKey := os.Getenv("SAFE_BROWSING_API_KEY"); apiKey != "" {
+		a.AddThreatChecker(analyzer.NewSafeBrowsingClient(apiKey))
+	}
+}
+
+// configureNegativeCache applies CACHE_NEGATIVE_TTL and CACHE_SKIP_ERROR_CODES
+func configureNegativeCache(a *analyzer.Analyzer) {
+	if value := os.Getenv("CACHE_NEGATIVE_TTL"); value != "" {
+		if ttl, err := time.ParseDuration(value); err == nil && ttl >= 0 {
+			a.SetNegativeCacheTTL(ttl)
+		} else {
+			logger.Sugar.Warnw("Ignoring invalid CACHE_NEGATIVE_TTL", "value", value)
+		}
+	}
+	if value := os.Getenv("CACHE_SKIP_ERROR_CODES"); value != "" {
+		var codes []string
+		for _, code := range strings.Split(value, ",") {
+			if code = strings.ToUpper(strings.TrimSpace(code)); code != "" {
+				codes = append(codes, code)
+			}
+		}
+		a.SetUncachedErrorCodes(codes...)
+	}
+}
+
+// configureWorkerPool applies LINK_WORKERS_MIN, LINK_WORKERS_MAX and LINK_QUEUE_MULTIPLIER
+func configureWorkerPool(a *analyzer.Analyzer) {
+	defaults := analyzer.DefaultWorkerPoolConfig()
+	a.SetWorkerPoolConfig(analyzer.WorkerPoolConfig{
+		MinWorkers:      envInt("LINK_WORKERS_MIN", defaults.MinWorkers),
+		MaxWorkers:      envInt("LINK_WORKERS_MAX", defaults.MaxWorkers),
+		QueueMultiplier: envInt("LINK_QUEUE_MULTIPLIER", defaults.QueueMultiplier),
+	})
+}
+
+// configureOutboundBudget applies OUTBOUND_MAX_REQUESTS and OUTBOUND_MAX_SECONDS,
+// the outbound requests and summed request time allowed per analysis
+func configureOutboundBudget(a *analyzer.Analyzer) {
+	a.SetOutboundBudget(envInt("OUTBOUND_MAX_REQUESTS", 0), time.Duration(envInt("OUTBOUND_MAX_SECONDS", 0))*time.Second)
+}
+
+// configureBotIdentity applies BOT_NAME, BOT_INFO_URL and BOT_CONTACT_EMAIL; unset
+// values keep the browser User-Agent and send no From header
+func configureBotIdentity(a *analyzer.Analyzer) {
+	a.SetBotIdentity(analyzer.BotIdentity{
+		Name:    os.Getenv("BOT_NAME"),
+		InfoURL: os.Getenv("BOT_INFO_URL"),
+		Contact: os.Getenv("BOT_CONTACT_EMAIL"),
+	})
+}
+
+// configureSnippetThresholds applies SEO_TITLE_MIN_CHARS, SEO_TITLE_MAX_CHARS,
+// SEO_TITLE_MAX_PIXELS and their SEO_DESCRIPTION_* counterparts; unset values keep the defaults
+func configureSnippetThresholds(a *analyzer.Analyzer) {
+	a.SetSnippetThresholds(analyzer.SnippetThresholds{
+		TitleMinChars:        envInt("SEO_TITLE_MIN_CHARS", 0),
+		TitleMaxChars:        envInt("SEO_TITLE_MAX_CHARS", 0),
+		TitleMaxPixels:       envInt("SEO_TITLE_MAX_PIXELS", 0),
+		DescriptionMinChars:  envInt("SEO_DESCRIPTION_MIN_CHARS", 0),
+		DescriptionMaxChars:  envInt("SEO_DESCRIPTION_MAX_CHARS", 0),
+		DescriptionMaxPixels: envInt("SEO_DESCRIPTION_MAX_PIXELS", 0),
+	})
+}
+
+// configureSharedState applies HOST_RATE_LIMIT (outbound requests per second per target
+// host) and RETRY_AFTER_BUDGET_SECONDS (how long a request waits on 429 responses),
+// and shares the limit and the circuit breaker between replicas through REDIS_URL,
+// returning the Redis client when one is configured
+func configureSharedState(a *analyzer.Analyzer) *analyzer.RedisClient {
+	var client *analyzer.RedisClient
+	if redisURL := os.Getenv("REDIS_URL"); redisURL != "" {
+		var err error
+		client, err = analyzer.NewRedisClient(redisURL)
+		if err != nil {
+			logger.Sugar.Fatalw("Invalid REDIS_URL", "error", err)
+		}
+		a.SetSharedStore(client)
+	}
+	if limit := envInt("HOST_RATE_LIMIT", 0); limit > 0 {
+		a.SetHostRateLimit(limit)
+	}
+	budget := envInt("RETRY_AFTER_BUDGET_SECONDS", int(analyzer.DefaultRetryAfterBudget/time.Second))
+	a.SetRetryAfterBudget(time.Duration(budget) * time.Second)
+	return client
+}
+
+// configureExtractionRules applies the custom extraction rules in EXTRACTION_RULES_FILE
+func configureExtractionRules(a *analyzer.Analyzer) {
+	path := os.Getenv("EXTRACTION_RULES_FILE")
+	if path == "" {
+		return
+	}
+	rules, err := analyzer.LoadExtractionRules(path)
+	if err == nil {
+		err = a.SetExtractionRules(rules)
+	}
+	if err != nil {
+		logger.Sugar.Fatalw("Failed to load extraction rules", "path", path, "error", err)
+	}
+}
+
+// configurePlugins loads the analysis plugins in PLUGINS_DIR, alongside any compiled in
+func configurePlugins(a *analyzer.Analyzer) {
+	if dir := os.Getenv("PLUGINS_DIR"); dir != "" {
+		plugins, err := analyzer.LoadPlugins(dir)
+		if err != nil {
+			logger.Sugar.Fatalw("Failed to load plugins", "dir", dir, "error", err)
+		}
+		for _, p := range plugins {
+			a.AddPlugin(p)
+		}
+	}
+	if names := a.Plugins(); len(names) > 0 {
+		logger.Sugar.Infow("Analysis plugins enabled", "plugins", names)
+	}
+}
+
+// configureEventPublishers registers the event publishers enabled through the environment:
+// NATS_URL/NATS_SUBJECT and KAFKA_REST_URL/KAFKA_TOPIC
+func configureEventPublishers(a *analyzer.Analyzer) {
+	if natsURL := os.Getenv("NATS_URL"); natsURL != "" {
+		subject := os.Getenv("NATS_SUBJECT")
+		if subject == "" {
+			subject = "analyses.completed"
+		}
+		if publisher, err := analyzer.NewNATSPublisher(natsURL, subject); err != nil {
+			logger.Sugar.Errorw("Invalid NATS configuration", "error", err)
+		} else {
+			a.AddEventPublisher(publisher)
+		}
+	}
+	if proxyURL := os.Getenv("KAFKA_REST_URL"); proxyURL != "" {
+		topic := os.Getenv("KAFKA_TOPIC")
+		if topic == "" {
+			topic = "analyses"
+		}
+		a.AddEventPublisher(analyzer.NewKafkaRESTPublisher(proxyURL, topic))
+	}
+}
+
+// configureNotifier loads notification rules and webhooks from NOTIFICATIONS_FILE
+func configureNotifier(a *analyzer.Analyzer) {
+	path := os.Getenv("NOTIFICATIONS_FILE")
+	if path == "" {
+		return
 	}
+	notifier, err := analyzer.LoadNotifier(path)
+	if err != nil {
+		logger.Sugar.Fatalw("Failed to load notification rules", "path", path, "error", err)
+	}
+	a.SetNotifier(notifier)
 }
 
 // GetAnalyzer returns the analyzer instance for metrics collection
@@ -41,14 +417,26 @@ func (s *Server) GetAnalyzer() *analyzer.Analyzer {
 	return s.analyzer
 }
 
+// indexData is the template data for the index page: its language and UI strings
+type indexData struct {
+	Lang string
+	T    map[string]string
+}
+
 func (s *Server) IndexHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	// Render the page in the client's preferred supported language
+	lang := requestLanguage(r)
+	messages, _ := catalog(lang)
+
 	w.Header().Set("Content-Type", "text/html")
-	if err := s.template.Execute(w, nil); err != nil {
+	w.Header().Set("Content-Language", lang)
+	w.Header().Set("Vary", "Accept-Language")
+	if err := s.template.Execute(w, indexData{Lang: lang, T: messages}); err != nil {
 		logger.Sugar.Errorw("Template execution error", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
@@ -67,8 +455,19 @@ func (s *Server) AnalyzeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	opts, err := s.analysisOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fields, err := requestFields(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Use context-aware analyzer
-	result := s.analyzer.AnalyzeURLWithContext(r.Context(), url)
+	result := s.analyzer.AnalyzeURLWithOptions(r.Context(), url, opts)
 
 	// Set appropriate HTTP status code based on result
 	statusCode := http.StatusOK
@@ -84,19 +483,474 @@ func (s *Server) AnalyzeHandler(w http.ResponseWriter, r *http.Request) {
 			}
 		case analyzer.ErrCodeNetworkError:
 			statusCode = http.StatusBadGateway
+		case analyzer.ErrCodeMaintenance:
+			statusCode = http.StatusServiceUnavailable
+		case analyzer.ErrCodeDNSError, analyzer.ErrCodeTLSError,
+			analyzer.ErrCodeConnRefused, analyzer.ErrCodeConnReset:
+			statusCode = http.StatusBadGateway
+		case analyzer.ErrCodeContentTooLarge:
+			statusCode = http.StatusUnprocessableEntity
+		case analyzer.ErrCodeBlockedByPolicy, analyzer.ErrCodeOptedOut:
+			statusCode = http.StatusForbidden
+		case analyzer.ErrCodeNotArchived:
+			statusCode = http.StatusNotFound
+		case analyzer.ErrCodeArchiveError:
+			statusCode = http.StatusBadGateway
 		case analyzer.ErrCodeParseError:
 			statusCode = http.StatusUnprocessableEntity
 		case analyzer.ErrCodeTimeoutError:
 			statusCode = http.StatusRequestTimeout
+		case analyzer.ErrCodeCircuitOpen:
+			statusCode = http.StatusServiceUnavailable
+		case analyzer.ErrCodeRateLimited:
+			statusCode = http.StatusTooManyRequests
 		default:
 			statusCode = http.StatusInternalServerError
 		}
+		if result.Error.RetryAfterSeconds > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(result.Error.RetryAfterSeconds))
+		}
+	}
+
+	// Browsers and curl asking for HTML get a readable report instead of JSON,
+	// in their language
+	format := negotiateContentType(r, "application/json", "text/html")
+	variant := "json-" + strings.Join(fields, ",")
+	if format == "text/html" {
+		variant = "html-" + requestLanguage(r)
+	}
+	w.Header().Set("Vary", "Accept, Accept-Language")
+
+	// Clients polling a page get 304 while it is answered from the same cached analysis
+	if statusCode == http.StatusOK && checkNotModified(w, r, resultETag(result, variant), result.FetchedAt) {
+		return
+	}
+
+	result = s.storeResult(result)
+
+	if format == "text/html" {
+		s.renderResult(w, r, result, statusCode)
+		return
+	}
+
+	body, err := selectFields(result, fields)
+	if err != nil {
+		logger.Sugar.Errorw("Field selection error", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 
-	if err := json.NewEncoder(w).Encode(result); err != nil {
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger.Sugar.Errorw("JSON encoding error", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// renderResult writes result as a read-only HTML report, like a permalink page
+func (s *Server) renderResult(w http.ResponseWriter, r *http.Request, result *analyzer.AnalysisResult, statusCode int) {
+	lang := requestLanguage(r)
+	messages, _ := catalog(lang)
+	data := permalinkData{
+		Lang:     lang,
+		T:        messages,
+		Subtitle: messages["results_label"],
+		Record: &history.Record{
+			Entry:  history.Entry{ID: result.ID, URL: result.URL, CreatedAt: result.FetchedAt},
+			Result: result,
+		},
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Language", lang)
+	w.WriteHeader(statusCode)
+	if err := permalinkTemplate.Execute(w, data); err != nil {
+		logger.Sugar.Errorw("Template execution error", "error", err)
+	}
+}
+
+// analysisOptions parses the analysis options of an /analyze request; the
+// error describes an invalid parameter for a 400 response. The fetched HTML is
+// kept for storage when snapshots are enabled.
+func (s *Server) analysisOptions(r *http.Request) (analyzer.AnalysisOptions, error) {
+	opts := analyzer.AnalysisOptions{
+		CompareVariants:  r.FormValue("compare_variants") == "true",
+		SkipLinkCheck:    r.FormValue("check_links") == "false",
+		ExpandShortLinks: r.FormValue("expand_short_links") == "true",
+		QuickCheck:       r.FormValue("mode") == "quick",
+		ExtractContent:   r.FormValue("extract_content") == "true",
+		LookupDomain:     r.FormValue("whois") == "true",
+		IncludeHeaders:   r.FormValue("include_headers") == "true",
+		CollectLinks:     r.FormValue("collect_links") == "true",
+		IncludeLinks:     r.FormValue("include_links") == "true",
+		CheckImages:      r.FormValue("check_images") == "true",
+		CheckRobots:      r.FormValue("check_robots") == "true",
+		PageSpeed:        r.FormValue("pagespeed") == "true",
+		SnapshotLimit:    s.snapshotLimit,
+	}
+
+	priority, err := analyzer.ParsePriority(r.FormValue("priority"))
+	if err != nil {
+		return opts, err
+	}
+	opts.Priority = priority
+
+	if opts.PageSpeed && !s.analyzer.PageSpeedEnabled() {
+		return opts, errors.New("pagespeed requires PAGESPEED_API_KEY to be configured")
+	}
+
+	// An archive date analyzes the page as the Wayback Machine captured it then
+	if value := r.FormValue("wayback_date"); value != "" {
+		date, err := analyzer.ParseArchiveDate(value)
+		if err != nil {
+			return opts, err
+		}
+		opts.ArchiveDate = date
+	}
+
+	// Heading text is returned for up to headings_text_limit headings per level
+	if r.FormValue("include_headings_text") == "true" {
+		opts.HeadingsTextLimit = analyzer.DefaultHeadingsTextLimit
+		if value := r.FormValue("headings_text_limit"); value != "" {
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit < 1 || limit > analyzer.MaxHeadingsTextLimit {
+				return opts, fmt.Errorf("headings_text_limit must be between 1 and %d", analyzer.MaxHeadingsTextLimit)
+			}
+			opts.HeadingsTextLimit = limit
+		}
+	}
+
+	// Per-request extraction rules arrive as a JSON array in the extract field
+	if extract := r.FormValue("extract"); extract != "" {
+		if err := json.Unmarshal([]byte(extract), &opts.ExtractionRules); err != nil {
+			return opts, errors.New("Invalid extract rules: expected a JSON array of {name, selector, attribute}")
+		}
+		if err := analyzer.ValidateExtractionRules(opts.ExtractionRules); err != nil {
+			return opts, errors.New("Invalid extract rules: " + err.Error())
+		}
+	}
+
+	// Content assertions arrive as a JSON array in the assert field
+	if assert := r.FormValue("assert"); assert != "" {
+		if err := json.Unmarshal([]byte(assert), &opts.Assertions); err != nil {
+			return opts, errors.New("Invalid assertions: expected a JSON array of {type, value, name, not}")
+		}
+		if err := analyzer.ValidateAssertions(opts.Assertions); err != nil {
+			return opts, errors.New("Invalid assertions: " + err.Error())
+		}
+	}
+
+	// Under memory pressure the guard asks for analyses without link checking
+	if middleware.LinkChecksShed(r.Context()) {
+		opts.SkipLinkCheck = true
+	}
+	return opts, nil
+}
+
+// storeResult saves result when a result store is configured and returns a copy
+// carrying its ID and permalink. Only fresh analyses are stored: results answered
+// from the cache or shared with a concurrent request were stored by the request
+// that produced them, and invalid URLs are never fetched. A storage failure is
+// logged and the result returned without an ID.
+func (s *Server) storeResult(result *analyzer.AnalysisResult) *analyzer.AnalysisResult {
+	if s.results == nil || result.CacheHit || result.Coalesced ||
+		(result.Error != nil && result.Error.Code == analyzer.ErrCodeInvalidURL) {
+		return result
+	}
+	entry, err := s.results.Save(result)
+	if err != nil {
+		logger.Sugar.Errorw("Failed to store analysis result", "url", result.URL, "error", err)
+		return result
+	}
+
+	// Fresh results are shared with the cache, so annotate a copy
+	stored := *result
+	stored.ID = entry.ID
+	stored.Permalink = permalinkPrefix + entry.ID
+	return &stored
+}
+
+// APIKeys returns the API key authenticator guarding metered endpoints
+func (s *Server) APIKeys() *middleware.APIKeyAuth {
+	return s.apiKeys
+}
+
+// Metered meters requests like APIKeys().Meter, and charges the outbound
+// requests and bytes of the analyses they run to the caller's key. It expects
+// to run inside APIKeys().Authenticate.
+func (s *Server) Metered(next http.Handler) http.Handler {
+	return s.apiKeys.Meter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		config, ok := middleware.APIKeyFromContext(r.Context())
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(s.chargeEgress(r.Context(), config)))
+	}))
+}
+
+// chargeEgress returns ctx charging the outbound requests and bytes of the
+// analyses run with it to config's key
+func (s *Server) chargeEgress(ctx context.Context, config middleware.APIKeyConfig) context.Context {
+	return analyzer.WithCostRecorder(ctx, func(usage *analyzer.OutboundUsage) {
+		s.apiKeys.RecordEgress(config, usage.Requests, usage.Bytes)
+	})
+}
+
+// Limiter returns the limiter bounding concurrent analyses
+func (s *Server) Limiter() *middleware.ConcurrencyLimiter {
+	return s.limiter
+}
+
+// Scheduler returns the scheduler running configured periodic analyses
+func (s *Server) Scheduler() *scheduler.Scheduler {
+	return s.schedule
+}
+
+// FlushResults waits until stored results still being written have reached the
+// disk, e.g. before the process exits
+func (s *Server) FlushResults() {
+	if s.results != nil {
+		s.results.Flush()
+	}
+}
+
+// MemoryGuard returns the guard shedding load under memory pressure
+func (s *Server) MemoryGuard() *middleware.MemoryGuard {
+	return s.memory
+}
+
+// UsageHandler reports the calling API key's usage and remaining quota
+func (s *Server) UsageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	config, ok := middleware.APIKeyFromContext(r.Context())
+	if !ok {
+		http.Error(w, "API keys are not enabled", http.StatusNotFound)
+		return
+	}
+
+	usage, err := s.apiKeys.Usage(config)
+	if err != nil {
+		logger.Sugar.Errorw("Failed to read API key usage", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(usage); err != nil {
+		logger.Sugar.Errorw("JSON encoding error", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// IncidentsHandler lists monitoring incidents, newest first, optionally filtered
+// by the schedule and url query parameters
+func (s *Server) IncidentsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	incidents := s.schedule.Incidents(r.URL.Query().Get("schedule"), r.URL.Query().Get("url"))
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"incidents": incidents,
+		"count":     len(incidents),
+	}); err != nil {
+		logger.Sugar.Errorw("JSON encoding error", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// ChangesHandler lists the changes detected between consecutive scheduled runs,
+// newest first, optionally filtered by the url query parameter
+func (s *Server) ChangesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	changes := s.schedule.Changes(r.URL.Query().Get("url"))
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"changes": changes,
+		"count":   len(changes),
+	}); err != nil {
+		logger.Sugar.Errorw("JSON encoding error", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// HostsHandler lists the link check reputation of external hosts, optionally
+// only the dead ones with dead=true or one host with the host query parameter
+func (s *Server) HostsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	host := r.URL.Query().Get("host")
+	deadOnly := r.URL.Query().Get("dead") == "true"
+	hosts := []analyzer.HostReputation{}
+	for _, reputation := range s.analyzer.HostReputations() {
+		if (host == "" || reputation.Host == host) && (!deadOnly || reputation.Dead) {
+			hosts = append(hosts, reputation)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"hosts": hosts,
+		"count": len(hosts),
+	}); err != nil {
+		logger.Sugar.Errorw("JSON encoding error", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// CapabilitiesResponse describes this deployment for API clients
+type CapabilitiesResponse struct {
+	APIVersion string `json:"api_version"`
+	analyzer.Capabilities
+	APIKeysRequired bool     `json:"api_keys_required"`
+	MaxConcurrent   int      `json:"max_concurrent"`
+	MaxQueued       int      `json:"max_queued"`
+	Schedules       int      `json:"schedules"`
+	Endpoints       []string `json:"endpoints"`
+}
+
+// CapabilitiesHandler reports the analysis features and limits of this deployment
+func (s *Server) CapabilitiesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	concurrency := s.limiter.Stats()
+	response := CapabilitiesResponse{
+		APIVersion:      "v1",
+		Capabilities:    s.analyzer.Capabilities(),
+		APIKeysRequired: s.apiKeys.Enabled(),
+		MaxConcurrent:   concurrency.MaxConcurrent,
+		MaxQueued:       concurrency.MaxQueued,
+		Schedules:       s.schedule.Stats().Schedules,
+		Endpoints: []string{
+			"POST /analyze", "GET /analyze/stream", "GET /ws", "POST /analyze/async", "GET /jobs/{id}", "POST /duplicates",
+			"POST /hreflang", "POST /crawl", "GET /crawl/{id}", "POST /validate", "GET /account/usage", "GET /incidents", "GET /changes", "GET /admin/hosts", "GET /metrics", "GET /health", "GET /api/v1/capabilities",
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Sugar.Errorw("JSON encoding error", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// DuplicatesHandler reports near-duplicate pages among the submitted URLs
+func (s *Server) DuplicatesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	// URLs may be repeated form values or a single whitespace-separated list
+	var urls []string
+	for _, value := range r.Form["urls"] {
+		urls = append(urls, strings.Fields(value)...)
+	}
+	if len(urls) < 2 {
+		http.Error(w, "At least two URLs are required", http.StatusBadRequest)
+		return
+	}
+	if len(urls) > analyzer.MaxDuplicateURLs {
+		http.Error(w, fmt.Sprintf("At most %d URLs are allowed", analyzer.MaxDuplicateURLs), http.StatusBadRequest)
+		return
+	}
+
+	threshold := analyzer.DefaultDuplicateThreshold
+	if value := r.FormValue("threshold"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 || parsed > 64 {
+			http.Error(w, "Threshold must be between 0 and 64", http.StatusBadRequest)
+			return
+		}
+		threshold = parsed
+	}
+
+	// With Accept: application/x-ndjson every analysis is streamed as it completes
+	if wantsNDJSON(r) {
+		stream := newNDJSONWriter(w)
+		stream.report(s.analyzer.FindDuplicatesStreaming(r.Context(), urls, threshold, stream.result))
+		return
+	}
+
+	report := s.analyzer.FindDuplicates(r.Context(), urls, threshold)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		logger.Sugar.Errorw("JSON encoding error", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// HreflangHandler checks the hreflang annotations of the submitted language
+// variants for reciprocity
+func (s *Server) HreflangHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	// URLs may be repeated form values or a single whitespace-separated list
+	var urls []string
+	for _, value := range r.Form["urls"] {
+		urls = append(urls, strings.Fields(value)...)
+	}
+	if len(urls) < 2 {
+		http.Error(w, "At least two URLs are required", http.StatusBadRequest)
+		return
+	}
+	if len(urls) > analyzer.MaxHreflangURLs {
+		http.Error(w, fmt.Sprintf("At most %d URLs are allowed", analyzer.MaxHreflangURLs), http.StatusBadRequest)
+		return
+	}
+
+	if wantsNDJSON(r) {
+		stream := newNDJSONWriter(w)
+		stream.report(s.analyzer.CheckHreflangStreaming(r.Context(), urls, stream.result))
+		return
+	}
+
+	report := s.analyzer.CheckHreflang(r.Context(), urls)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
 		logger.Sugar.Errorw("JSON encoding error", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
@@ -105,39 +959,40 @@ func (s *Server) AnalyzeHandler(w http.ResponseWriter, r *http.Request) {
 
 const indexHTML = `
 <!DOCTYPE html>
-<html lang="en">
+<html lang="{{.Lang}}">
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>Web Page Analyzer</title>
+    <title>{{.T.app_title}}</title>
     <link rel="stylesheet" href="/static/css/styles.css">
 </head>
 <body>
     <div class="container">
         <div class="main-content">
             <div class="header">
-                <h1 class="title">Web Page Analyzer</h1>
-                <p class="subtitle">Analyze web pages for HTML structure, content, and accessibility</p>
+                <h1 class="title">{{.T.app_title}}</h1>
+                <p class="subtitle">{{.T.app_subtitle}}</p>
+                <p><a href="/dashboard">{{.T.dashboard_title}}</a></p>
             </div>
             
             <div class="card">
-                <form id="analyzeForm" role="form" aria-label="URL Analysis Form">
+                <form id="analyzeForm" role="form" aria-label="{{.T.form_label}}">
                     <div class="form-group">
-                        <label for="url" class="form-label" id="url-label">Enter URL to analyze</label>
+                        <label for="url" class="form-label" id="url-label">{{.T.url_label}}</label>
                         <input type="url" id="url" name="url" class="form-input" required 
                                placeholder="https://example.com" 
                                aria-labelledby="url-label"
                                aria-describedby="url-help"
                                data-validation="url">
-                        <div id="url-help" class="form-help" data-default-text="Enter a valid web address to analyze">Enter a valid web address to analyze</div>
+                        <div id="url-help" class="form-help" data-default-text="{{.T.url_help}}">{{.T.url_help}}</div>
                     </div>
                     <button type="submit" id="submitBtn" class="btn btn-primary" 
                             aria-live="polite"
-                            data-loading-text="Analyzing..."
-                            data-default-text="Analyze Page">Analyze Page</button>
+                            data-loading-text="{{.T.analyzing_button}}"
+                            data-default-text="{{.T.analyze_button}}">{{.T.analyze_button}}</button>
                 </form>
                 
-                <div id="results" class="results" role="region" aria-live="polite" aria-label="Analysis Results"></div>
+                <div id="results" class="results" role="region" aria-live="polite" aria-label="{{.T.results_label}}"></div>
             </div>
         </div>
     </div>
@@ -145,35 +1000,35 @@ const indexHTML = `
     <!-- HTML Templates -->
     <div id="templates" style="display: none;">
         <template id="resultsTemplate">
-            <h2 class="results-header">Analysis Results</h2>
+            <h2 class="results-header">{{.T.results_label}}</h2>
             
             <div class="result-item">
-                <div class="result-label">URL</div>
+                <div class="result-label">{{.T.field_url}}</div>
                 <div class="result-value" data-field="url"></div>
             </div>
             
             <div class="result-item">
-                <div class="result-label">HTML Version</div>
+                <div class="result-label">{{.T.field_html_version}}</div>
                 <div class="result-value" data-field="html_version"></div>
             </div>
             
             <div class="result-item">
-                <div class="result-label">Page Title</div>
+                <div class="result-label">{{.T.field_page_title}}</div>
                 <div class="result-value" data-field="page_title"></div>
             </div>
             
             <div class="result-item">
-                <div class="result-label">Headings</div>
+                <div class="result-label">{{.T.field_headings}}</div>
                 <div class="result-value" data-field="headings"></div>
             </div>
             
             <div class="result-item">
-                <div class="result-label">Links</div>
+                <div class="result-label">{{.T.field_links}}</div>
                 <div class="result-value" data-field="links"></div>
             </div>
             
             <div class="result-item">
-                <div class="result-label">Login Form</div>
+                <div class="result-label">{{.T.field_login_form}}</div>
                 <div class="result-value" data-field="login_form"></div>
             </div>
         </template>
@@ -189,7 +1044,7 @@ const indexHTML = `
         <template id="loadingTemplate">
             <div class="loading-state">
                 <div class="loading-spinner"></div>
-                <div class="loading-message">Analyzing web page, please wait...</div>
+                <div class="loading-message">{{.T.loading_message}}</div>
             </div>
         </template>
 
@@ -202,6 +1057,7 @@ const indexHTML = `
     </div>
 
     <!-- JavaScript Files -->
+    <script src="/static/js/i18n.js"></script>
     <script src="/static/js/resultsRenderer.js"></script>
     <script src="/static/js/app.js"></script>
 </body>
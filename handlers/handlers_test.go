@@ -1,13 +1,25 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
 	"web-page-analyzer/analyzer"
+	"web-page-analyzer/crawler"
+	"web-page-analyzer/jobs"
+	"web-page-analyzer/middleware"
 )
 
 func TestNewServer(t *testing.T) {
@@ -194,9 +206,9 @@ func TestAnalyzeHandler_InvalidURL(t *testing.T) {
 	rr := httptest.NewRecorder()
 	server.AnalyzeHandler(rr, req)
 
-	// The URL gets normalized and fails at network level, so it's a 500 Internal Server Error
-	if rr.Code != http.StatusInternalServerError {
-		t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, rr.Code)
+	// The URL gets normalized and fails host resolution, so it's a 502 Bad Gateway
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("Expected status %d, got %d", http.StatusBadGateway, rr.Code)
 	}
 
 	var result analyzer.AnalysisResult
@@ -208,9 +220,9 @@ func TestAnalyzeHandler_InvalidURL(t *testing.T) {
 		t.Fatal("Expected error for invalid URL")
 	}
 
-	// The URL gets normalized to https://invalid-url, so it fails at network level
-	if result.Error.Code != analyzer.ErrCodeInternalError {
-		t.Errorf("Expected error code %s, got %s", analyzer.ErrCodeInternalError, result.Error.Code)
+	// The URL gets normalized to https://invalid-url, so it fails at DNS resolution
+	if result.Error.Code != analyzer.ErrCodeDNSError {
+		t.Errorf("Expected error code %s, got %s", analyzer.ErrCodeDNSError, result.Error.Code)
 	}
 }
 
@@ -258,6 +270,38 @@ func TestAnalyzeHandler_HTTPError(t *testing.T) {
 	}
 }
 
+func TestAnalyzeHandler_RateLimited(t *testing.T) {
+	// Create a test server that rate limits every request
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer testServer.Close()
+
+	server := NewServer()
+
+	form := url.Values{}
+	form.Add("url", testServer.URL)
+
+	req := httptest.NewRequest("POST", "/analyze", strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	server.AnalyzeHandler(rr, req)
+
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "30" {
+		t.Errorf("Expected 429 with Retry-After 30, got %d with %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+
+	var result analyzer.AnalysisResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to unmarshal JSON response: %v", err)
+	}
+	if result.Error == nil || result.Error.Code != analyzer.ErrCodeRateLimited {
+		t.Errorf("Expected error code %s, got %+v", analyzer.ErrCodeRateLimited, result.Error)
+	}
+}
+
 func TestAnalyzeHandler_LoginFormDetection(t *testing.T) {
 	// Create a test server that serves HTML with login form
 	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -309,3 +353,1918 @@ func TestAnalyzeHandler_LoginFormDetection(t *testing.T) {
 		t.Error("Expected login form to be detected")
 	}
 }
+
+func TestDuplicatesHandler(t *testing.T) {
+	article := strings.Repeat("Duplicate content hurts search rankings when pages repeat the same text. ", 20)
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		body := article
+		if r.URL.Path == "/other" {
+			body = strings.Repeat("An entirely different page talks about gardening, soil and tomatoes. ", 20)
+		}
+		w.Write([]byte(`<!DOCTYPE html><html><body><nav>` + r.URL.Path + `</nav><article><p>` + body + `</p></article></body></html>`))
+	}))
+	defer testServer.Close()
+
+	server := NewServer()
+
+	form := url.Values{}
+	form.Add("urls", testServer.URL+"/a "+testServer.URL+"/b")
+	form.Add("urls", testServer.URL+"/other")
+
+	req, err := http.NewRequest("POST", "/duplicates", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	server.DuplicatesHandler(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, status)
+	}
+
+	var report analyzer.DuplicateReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to unmarshal JSON response: %v", err)
+	}
+
+	if len(report.Pages) != 3 {
+		t.Errorf("Expected 3 pages, got %d", len(report.Pages))
+	}
+	if len(report.Duplicates) != 1 {
+		t.Fatalf("Expected 1 duplicate pair, got %d", len(report.Duplicates))
+	}
+	if report.Duplicates[0].URLA != testServer.URL+"/a" || report.Duplicates[0].URLB != testServer.URL+"/b" {
+		t.Errorf("Expected /a and /b to be duplicates, got %s and %s", report.Duplicates[0].URLA, report.Duplicates[0].URLB)
+	}
+}
+
+func TestValidateHandler(t *testing.T) {
+	var fetches atomic.Int32
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		http.NotFound(w, r)
+	}))
+	defer testServer.Close()
+
+	server := NewServer()
+
+	tests := []struct {
+		name   string
+		form   url.Values
+		status int
+	}{
+		{"no URL", url.Values{}, http.StatusBadRequest},
+		{"invalid priority", url.Values{"url": {testServer.URL}, "priority": {"urgent"}}, http.StatusBadRequest},
+		{"invalid wayback date", url.Values{"url": {testServer.URL}, "wayback_date": {"last week"}}, http.StatusBadRequest},
+		{"pagespeed without key", url.Values{"url": {testServer.URL}, "pagespeed": {"true"}}, http.StatusBadRequest},
+		{"too many URLs", url.Values{"urls": {strings.Repeat(testServer.URL+" ", analyzer.MaxDryRunURLs+1)}}, http.StatusBadRequest},
+		{"url and urls", url.Values{"url": {testServer.URL + "/a"}, "urls": {testServer.URL + "/b " + testServer.URL + "/c"}, "check_links": {"false"}}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/validate", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rr := httptest.NewRecorder()
+			server.ValidateHandler(rr, req)
+
+			if rr.Code != tt.status {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+			if rr.Code != http.StatusOK {
+				return
+			}
+			var report analyzer.DryRunReport
+			if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+				t.Fatalf("Failed to unmarshal JSON response: %v", err)
+			}
+			if len(report.Results) != 3 || report.Allowed != 3 || report.EstimatedRequests != 3 || report.LinkChecks != 0 {
+				t.Errorf("Expected 3 allowed URLs costing a request each, got %+v", report)
+			}
+		})
+	}
+
+	// Only robots.txt was read
+	if fetches.Load() != 1 {
+		t.Errorf("Expected a single robots.txt fetch, got %d requests", fetches.Load())
+	}
+}
+
+func TestDuplicatesHandler_TooFewURLs(t *testing.T) {
+	server := NewServer()
+
+	form := url.Values{}
+	form.Add("urls", "https://example.com")
+
+	req, err := http.NewRequest("POST", "/duplicates", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	server.DuplicatesHandler(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, status)
+	}
+}
+
+func TestAPIKeyQuotas(t *testing.T) {
+	t.Setenv("API_KEYS", "rate-limited-key:2:0,quota-key:0:2,metered-key:2:1")
+	server := NewServer()
+
+	// An empty URL fails fast with 400, which is enough to exercise metering
+	analyze := server.APIKeys().Authenticate(server.APIKeys().Meter(http.HandlerFunc(server.AnalyzeHandler)))
+	usage := server.APIKeys().Authenticate(http.HandlerFunc(server.UsageHandler))
+
+	request := func(handler http.Handler, method, path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := request(analyze, "POST", "/analyze", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d without a key, got %d", http.StatusUnauthorized, rr.Code)
+	}
+	if rr := request(analyze, "POST", "/analyze", "unknown"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d for an unknown key, got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	// Rate limit: two requests per minute
+	for i := 0; i < 2; i++ {
+		if rr := request(analyze, "POST", "/analyze", "rate-limited-key"); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected request %d to pass the rate limit, got %d", i+1, rr.Code)
+		}
+	}
+	rr := request(analyze, "POST", "/analyze", "rate-limited-key")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 429 with Retry-After, got %d", rr.Code)
+	}
+
+	// Monthly quota: two requests in total
+	for i := 0; i < 2; i++ {
+		request(analyze, "POST", "/analyze", "quota-key")
+	}
+	rr = request(analyze, "POST", "/analyze", "quota-key")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("X-Quota-Remaining") != "0" {
+		t.Errorf("Expected 429 with exhausted quota, got %d", rr.Code)
+	}
+
+	// Requests refused for the quota leave the rate limit's tokens alone
+	request(analyze, "POST", "/analyze", "metered-key")
+	for i := 0; i < 2; i++ {
+		rr = request(analyze, "POST", "/analyze", "metered-key")
+		if rr.Code != http.StatusTooManyRequests || !strings.Contains(rr.Body.String(), "quota") {
+			t.Errorf("Expected request %d to be refused for the quota, got %d: %s", i+2, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr = request(usage, "GET", "/account/usage", "quota-key")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+	var report middleware.Usage
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to unmarshal JSON response: %v", err)
+	}
+	if report.Used != 2 || report.Remaining != 0 || report.MonthlyQuota != 2 {
+		t.Errorf("Expected 2 used of 2 with none remaining, got %+v", report)
+	}
+	if report.KeyID != "*****-key" {
+		t.Errorf("Expected masked key id, got %s", report.KeyID)
+	}
+}
+
+func TestAPIKeyQuotaConcurrent(t *testing.T) {
+	t.Setenv("API_KEYS", "quota-key:0:5")
+	server := NewServer()
+	analyze := server.APIKeys().Authenticate(server.APIKeys().Meter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	var admitted atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest("POST", "/analyze", nil)
+			req.Header.Set("X-API-Key", "quota-key")
+			rr := httptest.NewRecorder()
+			analyze.ServeHTTP(rr, req)
+			if rr.Code == http.StatusOK {
+				admitted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if admitted.Load() != 5 {
+		t.Errorf("Expected exactly 5 of 20 concurrent requests within the quota, got %d", admitted.Load())
+	}
+	usage, err := server.APIKeys().Usage(middleware.APIKeyConfig{Key: "quota-key", MonthlyQuota: 5})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if usage.Used != 5 {
+		t.Errorf("Expected refused requests to be rolled back, got %d used", usage.Used)
+	}
+}
+
+func TestFileUsageStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+	store, err := middleware.NewFileUsageStore(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	current := time.Now().UTC().Format("2006-01")
+	store.Increment("team-key", current)
+	store.Add("team-key", "2001-01", 7)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected counters to be written in the background, not on each request")
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	reloaded, err := middleware.NewFileUsageStore(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer reloaded.Close()
+	if used, _ := reloaded.Get("team-key", current); used != 1 {
+		t.Errorf("Expected the current period to be persisted, got %d", used)
+	}
+	if used, _ := reloaded.Get("team-key", "2001-01"); used != 0 {
+		t.Errorf("Expected old periods to be pruned, got %d", used)
+	}
+}
+
+func TestMeteredEgress(t *testing.T) {
+	t.Setenv("API_KEYS", "team-key:0:0")
+	page := "<html><head><title>Egress</title></head><body></body></html>"
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(page))
+	}))
+	defer testServer.Close()
+
+	server := NewServer()
+	analyze := server.APIKeys().Authenticate(server.Metered(http.HandlerFunc(server.AnalyzeHandler)))
+	usage := server.APIKeys().Authenticate(http.HandlerFunc(server.UsageHandler))
+
+	request := func(handler http.Handler, method, path string) *httptest.ResponseRecorder {
+		form := url.Values{"url": {testServer.URL}}
+		req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-API-Key", "team-key")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// The second request is a cache hit and costs nothing
+	for i := 0; i < 2; i++ {
+		if rr := request(analyze, "POST", "/analyze"); rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+	}
+
+	var report middleware.Usage
+	if err := json.Unmarshal(request(usage, "GET", "/account/usage").Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to unmarshal JSON response: %v", err)
+	}
+	if report.Used != 2 || report.OutboundRequests < 1 || report.OutboundBytes != int64(len(page)) {
+		t.Errorf("Expected 2 requests charged one analysis reading %d bytes, got %+v", len(page), report)
+	}
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	t.Setenv("MAX_CONCURRENT_ANALYSES", "1")
+	t.Setenv("ANALYSIS_QUEUE_SIZE", "1")
+	t.Setenv("ANALYSIS_QUEUE_WAIT", "2s")
+	server := NewServer()
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	handler := server.Limiter().Limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	codes := make(chan int, 2)
+	serve := func() {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("POST", "/analyze", nil))
+		codes <- rr.Code
+	}
+
+	// The first request takes the only slot, the second waits in the queue
+	go serve()
+	<-started
+	go serve()
+	deadline := time.Now().Add(time.Second)
+	for server.Limiter().Stats().Queued != 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// With the slot and the queue full, the third request is rejected
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/analyze", nil))
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 429 with Retry-After, got %d", rr.Code)
+	}
+
+	stats := server.Limiter().Stats()
+	if stats.Active != 1 || stats.Queued != 1 || stats.Rejected != 1 {
+		t.Errorf("Expected 1 active, 1 queued and 1 rejected, got %+v", stats)
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if code := <-codes; code != http.StatusOK {
+			t.Errorf("Expected admitted requests to succeed, got %d", code)
+		}
+	}
+}
+
+func TestConcurrencyLimiter_BatchReserve(t *testing.T) {
+	t.Setenv("MAX_CONCURRENT_ANALYSES", "2")
+	t.Setenv("ANALYSIS_QUEUE_SIZE", "1")
+	t.Setenv("ANALYSIS_QUEUE_WAIT", "50ms")
+	server := NewServer()
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	handler := server.Limiter().Limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func(target string) int {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("POST", target, nil))
+		return rr.Code
+	}
+
+	// The first batch request takes the only batch slot
+	codes := make(chan int, 2)
+	go func() { codes <- serve("/analyze?priority=batch") }()
+	<-started
+
+	// A second batch request cannot take the slot reserved for interactive work
+	if code := serve("/analyze?priority=batch"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected the second batch request to be turned away, got %d", code)
+	}
+
+	// An interactive request still gets in
+	go func() { codes <- serve("/analyze") }()
+	<-started
+
+	stats := server.Limiter().Stats()
+	if stats.Active != 2 || stats.BatchActive != 1 || stats.ReservedInteractive != 1 {
+		t.Errorf("Expected 2 active with 1 batch and 1 reserved, got %+v", stats)
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if code := <-codes; code != http.StatusOK {
+			t.Errorf("Expected admitted requests to succeed, got %d", code)
+		}
+	}
+	if stats := server.Limiter().Stats(); stats.Active != 0 || stats.BatchActive != 0 || stats.Queued != 0 {
+		t.Errorf("Expected all slots released, got %+v", stats)
+	}
+}
+
+func TestMemoryGuard(t *testing.T) {
+	server := NewServer()
+
+	// A one-byte hard limit is always exceeded, so new analyses are rejected
+	critical := middleware.NewMemoryGuard(0, 1, time.Hour)
+	defer critical.Stop()
+
+	rr := httptest.NewRecorder()
+	critical.Shed(http.HandlerFunc(server.AnalyzeHandler)).ServeHTTP(rr, httptest.NewRequest("POST", "/analyze", nil))
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 503 with Retry-After, got %d", rr.Code)
+	}
+	if stats := critical.Stats(); stats.Pressure != "critical" || stats.Rejected != 1 {
+		t.Errorf("Expected critical pressure with 1 rejection, got %+v", stats)
+	}
+
+	// A one-byte soft limit keeps analyses running but without link checking
+	var linkChecks int32
+	var mu sync.Mutex
+	linked := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		linkChecks++
+		mu.Unlock()
+	}))
+	defer linked.Close()
+
+	external := strings.Replace(linked.URL, "127.0.0.1", "localhost", 1)
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Shed</title></head><body><a href="` + external + `/a">A</a></body></html>`))
+	}))
+	defer page.Close()
+
+	degraded := middleware.NewMemoryGuard(1, 0, time.Hour)
+	defer degraded.Stop()
+
+	form := url.Values{}
+	form.Add("url", page.URL)
+	req := httptest.NewRequest("POST", "/analyze", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr = httptest.NewRecorder()
+	degraded.Shed(http.HandlerFunc(server.AnalyzeHandler)).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+	if rr.Header().Get("X-Load-Shedding") != "link-checks-disabled" {
+		t.Errorf("Expected X-Load-Shedding header, got %q", rr.Header().Get("X-Load-Shedding"))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if linkChecks != 0 {
+		t.Errorf("Expected no link checks under memory pressure, got %d", linkChecks)
+	}
+}
+
+func TestIncidentsHandler(t *testing.T) {
+	server := NewServer()
+
+	rr := httptest.NewRecorder()
+	server.IncidentsHandler(rr, httptest.NewRequest("GET", "/incidents?schedule=home", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+
+	var response struct {
+		Incidents []interface{} `json:"incidents"`
+		Count     int           `json:"count"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Incidents == nil || response.Count != 0 {
+		t.Errorf("Expected an empty incident list, got %+v", response)
+	}
+
+	rr = httptest.NewRecorder()
+	server.IncidentsHandler(rr, httptest.NewRequest("POST", "/incidents", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405, got %d", rr.Code)
+	}
+}
+
+func TestChangesHandler(t *testing.T) {
+	server := NewServer()
+
+	rr := httptest.NewRecorder()
+	server.ChangesHandler(rr, httptest.NewRequest("GET", "/changes?url=https://example.com", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+
+	var response struct {
+		Changes []interface{} `json:"changes"`
+		Count   int           `json:"count"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Changes == nil || response.Count != 0 {
+		t.Errorf("Expected an empty change list, got %+v", response)
+	}
+
+	rr = httptest.NewRecorder()
+	server.ChangesHandler(rr, httptest.NewRequest("DELETE", "/changes", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405, got %d", rr.Code)
+	}
+}
+
+func TestAnalyzeHandler_ExtractRules(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Shop</title></head><body><p class="byline">By Ann</p></body></html>`))
+	}))
+	defer testServer.Close()
+
+	server := NewServer()
+
+	testCases := []struct {
+		name     string
+		extract  string
+		expected int
+	}{
+		{"valid rules", `[{"name":"byline","selector":"p.byline"}]`, http.StatusOK},
+		{"malformed json", `{"name":"byline"}`, http.StatusBadRequest},
+		{"unsupported selector", `[{"name":"byline","selector":"p:first-child"}]`, http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("url", testServer.URL)
+			form.Add("check_links", "false")
+			form.Add("extract", tc.extract)
+
+			req := httptest.NewRequest("POST", "/analyze", strings.NewReader(form.Encode()))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			rr := httptest.NewRecorder()
+			server.AnalyzeHandler(rr, req)
+
+			if rr.Code != tc.expected {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expected, rr.Code, rr.Body.String())
+			}
+			if tc.expected != http.StatusOK {
+				return
+			}
+			var result analyzer.AnalysisResult
+			if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+				t.Fatalf("Failed to unmarshal JSON response: %v", err)
+			}
+			if result.CustomFields["byline"] != "By Ann" {
+				t.Errorf("Expected byline 'By Ann', got %v", result.CustomFields)
+			}
+		})
+	}
+}
+
+func TestAnalyzeHandler_Assertions(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Shop</title></head><body><p>In stock</p></body></html>`))
+	}))
+	defer testServer.Close()
+
+	server := NewServer()
+
+	testCases := []struct {
+		name     string
+		assert   string
+		expected int
+	}{
+		{"valid assertions", `[{"type":"text","value":"In stock"},{"type":"status","value":"200"}]`, http.StatusOK},
+		{"malformed json", `{"type":"text"}`, http.StatusBadRequest},
+		{"invalid regex", `[{"type":"regex","value":"("}]`, http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("url", testServer.URL)
+			form.Add("check_links", "false")
+			form.Add("assert", tc.assert)
+
+			req := httptest.NewRequest("POST", "/analyze", strings.NewReader(form.Encode()))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			rr := httptest.NewRecorder()
+			server.AnalyzeHandler(rr, req)
+
+			if rr.Code != tc.expected {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expected, rr.Code, rr.Body.String())
+			}
+			if tc.expected != http.StatusOK {
+				return
+			}
+			var result analyzer.AnalysisResult
+			if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+				t.Fatalf("Failed to unmarshal JSON response: %v", err)
+			}
+			if result.Assertions == nil || !result.Assertions.Passed || len(result.Assertions.Results) != 2 {
+				t.Errorf("Expected 2 passing assertions, got %+v", result.Assertions)
+			}
+		})
+	}
+}
+
+func TestCapabilitiesHandler(t *testing.T) {
+	t.Setenv("OUTBOUND_MAX_REQUESTS", "150")
+	t.Setenv("LINK_WORKERS_MAX", "20")
+	server := NewServer()
+
+	rr := httptest.NewRecorder()
+	server.CapabilitiesHandler(rr, httptest.NewRequest("GET", "/api/v1/capabilities", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+
+	var response CapabilitiesResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.APIVersion != "v1" || response.Render {
+		t.Errorf("Expected api_version v1 without rendering, got %+v", response)
+	}
+	if response.Limits.MaxOutboundRequests != 150 || response.WorkerPool.MaxWorkers != 20 {
+		t.Errorf("Expected configured limits to be reported, got %+v and %+v", response.Limits, response.WorkerPool)
+	}
+	if response.Limits.MaxBodyBytes != analyzer.DefaultMaxBodySize || response.MaxConcurrent == 0 {
+		t.Errorf("Expected body and concurrency limits, got %+v", response)
+	}
+	if len(response.Options) == 0 || len(response.AssertionTypes) != 4 || response.Plugins == nil {
+		t.Errorf("Expected options, assertion types and a plugin list, got %+v", response.Capabilities)
+	}
+
+	rr = httptest.NewRecorder()
+	server.CapabilitiesHandler(rr, httptest.NewRequest("POST", "/api/v1/capabilities", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405, got %d", rr.Code)
+	}
+}
+
+func TestNegotiateLanguage(t *testing.T) {
+	testCases := []struct {
+		header   string
+		expected string
+	}{
+		{"", "en"},
+		{"de-DE,de;q=0.9,en;q=0.8", "de"},
+		{"en;q=0.5, fr;q=0.9", "fr"},
+		{"ES", "es"},
+		{"ja, pt-BR;q=0.9", "en"},
+		{"it, de;q=0.3", "de"},
+		{"fr;q=bogus, es;q=0.2", "es"},
+	}
+
+	for _, tc := range testCases {
+		if got := negotiateLanguage(tc.header); got != tc.expected {
+			t.Errorf("negotiateLanguage(%q): expected %q, got %q", tc.header, tc.expected, got)
+		}
+	}
+}
+
+func TestIndexHandler_Localized(t *testing.T) {
+	server := NewServer()
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Language", "de-AT,de;q=0.9")
+	rr := httptest.NewRecorder()
+	server.IndexHandler(rr, req)
+
+	body := rr.Body.String()
+	if !strings.Contains(body, `<html lang="de">`) || !strings.Contains(body, "Seite analysieren") {
+		t.Error("Expected the page rendered in German")
+	}
+	if rr.Header().Get("Content-Language") != "de" || rr.Header().Get("Vary") != "Accept-Language" {
+		t.Errorf("Expected Content-Language de and Vary: Accept-Language, got %v", rr.Header())
+	}
+
+	// The lang query parameter overrides Accept-Language
+	req = httptest.NewRequest("GET", "/?lang=fr", nil)
+	req.Header.Set("Accept-Language", "de")
+	rr = httptest.NewRecorder()
+	server.IndexHandler(rr, req)
+	if !strings.Contains(rr.Body.String(), "Analyser la page") {
+		t.Error("Expected the page rendered in French")
+	}
+}
+
+func TestI18nHandler(t *testing.T) {
+	server := NewServer()
+	english := translations[DefaultLanguage]
+
+	for _, lang := range SupportedLanguages() {
+		rr := httptest.NewRecorder()
+		server.I18nHandler(rr, httptest.NewRequest("GET", "/i18n/"+lang+".json", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", lang, rr.Code)
+		}
+
+		var messages map[string]string
+		if err := json.Unmarshal(rr.Body.Bytes(), &messages); err != nil {
+			t.Fatalf("%s: failed to decode catalog: %v", lang, err)
+		}
+		// Every catalog translates every English key
+		for key := range english {
+			if translations[lang][key] == "" {
+				t.Errorf("%s: missing translation for %q", lang, key)
+			}
+		}
+		if len(messages) != len(english) {
+			t.Errorf("%s: expected %d messages, got %d", lang, len(english), len(messages))
+		}
+	}
+
+	for _, path := range []string{"/i18n/xx.json", "/i18n/de", "/i18n/"} {
+		rr := httptest.NewRecorder()
+		server.I18nHandler(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("%s: expected status 404, got %d", path, rr.Code)
+		}
+	}
+}
+
+func TestPermalink(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<!DOCTYPE html><html><head><title>Shared Page</title></head><body><h1>Hello</h1></body></html>`))
+	}))
+	defer testServer.Close()
+
+	t.Setenv("RESULTS_DIR", t.TempDir())
+	t.Setenv("RESULTS_SNAPSHOT_KB", "64")
+	server := NewServer()
+
+	form := url.Values{}
+	form.Add("url", testServer.URL)
+	form.Add("check_links", "false")
+	req := httptest.NewRequest("POST", "/analyze", strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	server.AnalyzeHandler(rr, req)
+
+	var result analyzer.AnalysisResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to unmarshal JSON response: %v", err)
+	}
+	if result.ID == "" || result.Permalink != "/r/"+result.ID {
+		t.Fatalf("Expected a result ID and permalink, got %q and %q", result.ID, result.Permalink)
+	}
+
+	testCases := []struct {
+		name     string
+		path     string
+		lang     string
+		expected int
+		contains string
+	}{
+		{"stored result", result.Permalink, "en", http.StatusOK, "Shared Page"},
+		{"localized", result.Permalink, "de", http.StatusOK, "Geteiltes Analyseergebnis"},
+		{"unknown id", "/r/0123456789abcdef", "en", http.StatusNotFound, "This result was not found"},
+		{"malformed id", "/r/../secrets", "en", http.StatusNotFound, "This result was not found"},
+		{"snapshot", result.Permalink + "/snapshot", "en", http.StatusOK, "<h1>Hello</h1>"},
+		{"unknown snapshot", "/r/0123456789abcdef/snapshot", "en", http.StatusNotFound, "not found"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tc.path, nil)
+			req.Header.Set("Accept-Language", tc.lang)
+			rr := httptest.NewRecorder()
+			server.PermalinkHandler(rr, req)
+
+			if rr.Code != tc.expected {
+				t.Fatalf("Expected status %d, got %d", tc.expected, rr.Code)
+			}
+			if !strings.Contains(rr.Body.String(), tc.contains) {
+				t.Errorf("Expected page to contain %q", tc.contains)
+			}
+		})
+	}
+
+	// A cache hit is not stored again
+	req = httptest.NewRequest("POST", "/analyze", strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	server.AnalyzeHandler(rr, req)
+	var hit analyzer.AnalysisResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &hit); err != nil {
+		t.Fatalf("Failed to unmarshal JSON response: %v", err)
+	}
+	if !hit.CacheHit || hit.ID != "" || server.results.Len() != 1 {
+		t.Errorf("Expected the cache hit not to be stored, got ID %q and %d stored", hit.ID, server.results.Len())
+	}
+
+	// Without a result store nothing is stored and permalinks are not served
+	t.Setenv("RESULTS_DIR", "")
+	rr = httptest.NewRecorder()
+	NewServer().PermalinkHandler(rr, httptest.NewRequest("GET", result.Permalink, nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 without a result store, got %d", rr.Code)
+	}
+}
+
+func TestReanalyzeHandler(t *testing.T) {
+	var fetches int32
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		title := "Original"
+		if atomic.AddInt32(&fetches, 1) > 1 {
+			title = "Changed"
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("X-Robots-Tag", "noindex")
+		w.Write([]byte(`<!DOCTYPE html><html><head><title>` + title + `</title></head><body><h1>Hello</h1></body></html>`))
+	}))
+	defer testServer.Close()
+
+	t.Setenv("RESULTS_DIR", t.TempDir())
+	t.Setenv("RESULTS_SNAPSHOT_KB", "64")
+	server := NewServer()
+
+	post := func(path string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		if path == "/analyze" {
+			server.AnalyzeHandler(rr, req)
+		} else {
+			server.ReanalyzeHandler(rr, req)
+		}
+		return rr
+	}
+
+	var stored analyzer.AnalysisResult
+	rr := post("/analyze", url.Values{"url": {testServer.URL}, "check_links": {"false"}})
+	if err := json.Unmarshal(rr.Body.Bytes(), &stored); err != nil || stored.ID == "" {
+		t.Fatalf("Expected a stored result, got %s", rr.Body.String())
+	}
+	fetched := atomic.LoadInt32(&fetches)
+	permalink := httptest.NewRecorder()
+	server.PermalinkHandler(permalink, httptest.NewRequest("GET", stored.Permalink, nil))
+	if cacheControl := permalink.Header().Get("Cache-Control"); cacheControl != "public, max-age=60" {
+		t.Errorf("Expected the permalink page to be cached briefly, got %q", cacheControl)
+	}
+
+	// The snapshot is analyzed with options the original analysis did not use
+	rr = post("/history/"+stored.ID+"/reanalyze", url.Values{"include_headings_text": {"true"}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var result analyzer.AnalysisResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to unmarshal JSON response: %v", err)
+	}
+	if after := atomic.LoadInt32(&fetches); after != fetched {
+		t.Errorf("Expected the page not to be fetched again, got %d more requests", after-fetched)
+	}
+	if result.ID != stored.ID || result.PageTitle != "Original" || result.StatusCode != http.StatusOK {
+		t.Errorf("Expected the stored page to be reanalyzed, got %+v", result)
+	}
+	if len(result.HeadingsText["h1"]) != 1 || result.HeadingsText["h1"][0] != "Hello" {
+		t.Errorf("Expected headings text from the snapshot, got %v", result.HeadingsText)
+	}
+	// The headers stored with the snapshot apply even though include_headers was not set
+	if !stored.Noindex || !result.Noindex {
+		t.Errorf("Expected the X-Robots-Tag header to mark both results noindex, got %v and %v", stored.Noindex, result.Noindex)
+	}
+	if !result.FetchedAt.Equal(stored.FetchedAt) {
+		t.Errorf("Expected the original fetch time %v, got %v", stored.FetchedAt, result.FetchedAt)
+	}
+
+	// The stored result is replaced in place
+	record, err := server.results.Get(stored.ID)
+	if err != nil || record.ReanalyzedAt == nil || record.Result.HeadingsText == nil {
+		t.Errorf("Expected the reanalyzed result to be stored, got %+v and %v", record, err)
+	}
+	if entries := server.results.List("", 0); len(entries) != 1 {
+		t.Errorf("Expected one stored result, got %d", len(entries))
+	}
+
+	// Caches revalidating the permalink page get the reanalyzed version
+	req := httptest.NewRequest("GET", stored.Permalink, nil)
+	req.Header.Set("If-None-Match", permalink.Header().Get("ETag"))
+	rr = httptest.NewRecorder()
+	server.PermalinkHandler(rr, req)
+	if rr.Code != http.StatusOK || rr.Header().Get("ETag") == permalink.Header().Get("ETag") {
+		t.Errorf("Expected the reanalyzed permalink page under a new ETag, got %d with %s", rr.Code, rr.Header().Get("ETag"))
+	}
+
+	plain, _ := server.results.Save(&analyzer.AnalysisResult{URL: testServer.URL})
+	testCases := []struct {
+		name     string
+		method   string
+		path     string
+		expected int
+	}{
+		{"no snapshot", "POST", "/history/" + plain.ID + "/reanalyze", http.StatusConflict},
+		{"unknown id", "POST", "/history/0123456789abcdef/reanalyze", http.StatusNotFound},
+		{"malformed id", "POST", "/history/../secrets/reanalyze", http.StatusNotFound},
+		{"other path", "POST", "/history/" + stored.ID, http.StatusNotFound},
+		{"wrong method", "GET", "/history/" + stored.ID + "/reanalyze", http.StatusMethodNotAllowed},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			server.ReanalyzeHandler(rr, httptest.NewRequest(tc.method, tc.path, nil))
+			if rr.Code != tc.expected {
+				t.Errorf("Expected status %d, got %d", tc.expected, rr.Code)
+			}
+		})
+	}
+}
+
+func TestDashboardHandler(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<!DOCTYPE html><html><head><title>Tracked</title></head><body></body></html>`))
+	}))
+	defer testServer.Close()
+
+	t.Setenv("RESULTS_DIR", t.TempDir())
+	server := NewServer()
+
+	var result analyzer.AnalysisResult
+	for i := 0; i < 2; i++ {
+		form := url.Values{}
+		form.Add("url", testServer.URL)
+		form.Add("check_links", "false")
+		req := httptest.NewRequest("POST", "/analyze", strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		server.AnalyzeHandler(rr, req)
+		if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+			t.Fatalf("Failed to unmarshal JSON response: %v", err)
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		path     string
+		contains []string
+	}{
+		{"summary and recent analyses", "/dashboard", []string{"Error rate", "Recent analyses", result.Permalink}},
+		{"url history", "/dashboard?url=" + url.QueryEscape(result.NormalizedURL), []string{"History for", `<rect class="chart-bar"`}},
+		{"url history as entered", "/dashboard?url=" + url.QueryEscape(strings.ToUpper(testServer.URL)+"#top"), []string{"History for", `<rect class="chart-bar"`}},
+		{"unknown url", "/dashboard?url=https%3A%2F%2Fnowhere.example%2F", []string{"No analyses stored yet."}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			server.DashboardHandler(rr, httptest.NewRequest("GET", tc.path, nil))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", rr.Code)
+			}
+			for _, want := range tc.contains {
+				if !strings.Contains(rr.Body.String(), want) {
+					t.Errorf("Expected page to contain %q", want)
+				}
+			}
+		})
+	}
+
+	// Without a result store only the metrics summary is shown
+	t.Setenv("RESULTS_DIR", "")
+	rr := httptest.NewRecorder()
+	NewServer().DashboardHandler(rr, httptest.NewRequest("GET", "/dashboard", nil))
+	if !strings.Contains(rr.Body.String(), "Set RESULTS_DIR") {
+		t.Error("Expected a hint that history is disabled")
+	}
+
+	rr = httptest.NewRecorder()
+	server.DashboardHandler(rr, httptest.NewRequest("POST", "/dashboard", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405, got %d", rr.Code)
+	}
+}
+
+func TestCompareHandler(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		title := r.URL.Query().Get("title")
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<!DOCTYPE html><html><head><title>` + title + `</title></head><body><a href="/` + title + `">x</a></body></html>`))
+	}))
+	defer testServer.Close()
+
+	t.Setenv("RESULTS_DIR", t.TempDir())
+	server := NewServer()
+
+	analyze := func(title string) analyzer.AnalysisResult {
+		form := url.Values{}
+		form.Add("url", testServer.URL+"/?title="+title)
+		form.Add("check_links", "false")
+		form.Add("collect_links", "true")
+		req := httptest.NewRequest("POST", "/analyze", strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		server.AnalyzeHandler(rr, req)
+		var result analyzer.AnalysisResult
+		if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+			t.Fatalf("Failed to unmarshal JSON response: %v", err)
+		}
+		return result
+	}
+	first := analyze("First")
+	second := analyze("Second")
+
+	testCases := []struct {
+		name     string
+		query    string
+		expected int
+		contains []string
+	}{
+		{"diff", "?a=" + first.ID + "&b=" + second.ID, http.StatusOK, []string{`<tr class="changed">`, "First", "Second", "+ " + testServer.URL + "/Second"}},
+		{"form only", "", http.StatusOK, []string{`name="a"`}},
+		{"unknown id", "?a=" + first.ID + "&b=0123456789abcdef", http.StatusNotFound, []string{"This result was not found"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			server.CompareHandler(rr, httptest.NewRequest("GET", "/compare"+tc.query, nil))
+			if rr.Code != tc.expected {
+				t.Fatalf("Expected status %d, got %d", tc.expected, rr.Code)
+			}
+			for _, want := range tc.contains {
+				if !strings.Contains(rr.Body.String(), want) {
+					t.Errorf("Expected page to contain %q", want)
+				}
+			}
+		})
+	}
+}
+
+func TestCrawlHandler(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sitemap.xml" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<!DOCTYPE html><html><head><title>Page</title></head><body><a href="/about">About</a></body></html>`))
+	}))
+	defer testServer.Close()
+
+	server := NewServer()
+
+	testCases := []struct {
+		name     string
+		params   map[string]string
+		expected int
+	}{
+		{"valid crawl", map[string]string{"url": testServer.URL, "max_pages": "5"}, http.StatusAccepted},
+		{"missing url", map[string]string{}, http.StatusBadRequest},
+		{"invalid url", map[string]string{"url": "http://exa mple.com"}, http.StatusBadRequest},
+		{"too many pages", map[string]string{"url": testServer.URL, "max_pages": "1000"}, http.StatusBadRequest},
+		{"invalid depth", map[string]string{"url": testServer.URL, "max_depth": "deep"}, http.StatusBadRequest},
+	}
+
+	var location string
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			form := url.Values{}
+			for key, value := range tc.params {
+				form.Add(key, value)
+			}
+			req := httptest.NewRequest("POST", "/crawl", strings.NewReader(form.Encode()))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			rr := httptest.NewRecorder()
+			server.CrawlHandler(rr, req)
+			if rr.Code != tc.expected {
+				t.Fatalf("Expected status %d, got %d", tc.expected, rr.Code)
+			}
+			if rr.Code == http.StatusAccepted {
+				location = rr.Header().Get("Location")
+			}
+		})
+	}
+
+	if !strings.HasPrefix(location, "/crawl/") {
+		t.Fatalf("Expected a /crawl/{id} Location header, got %q", location)
+	}
+	var crawl crawler.Crawl
+	deadline := time.Now().Add(10 * time.Second)
+	for crawl.Status != crawler.StatusCompleted && time.Now().Before(deadline) {
+		rr := httptest.NewRecorder()
+		server.CrawlReportHandler(rr, httptest.NewRequest("GET", location, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rr.Code)
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &crawl); err != nil {
+			t.Fatalf("Failed to unmarshal JSON response: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if crawl.Status != crawler.StatusCompleted || len(crawl.Pages) != 2 {
+		t.Errorf("Expected a completed crawl of 2 pages, got %s with %d pages", crawl.Status, len(crawl.Pages))
+	}
+
+	rr := httptest.NewRecorder()
+	server.CrawlReportHandler(rr, httptest.NewRequest("GET", location+"/sitemap.xml", nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/xml" {
+		t.Errorf("Expected an XML sitemap, got status %d (%s)", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rr.Body.String(), "<loc>"+testServer.URL+"/about</loc>") {
+		t.Errorf("Expected the sitemap to list /about, got %s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	server.CrawlReportHandler(rr, httptest.NewRequest("GET", location+"/export.zip", nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/zip" {
+		t.Errorf("Expected a zip export, got status %d (%s)", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	if !strings.HasPrefix(rr.Body.String(), "PK") {
+		t.Error("Expected the export to be a zip archive")
+	}
+
+	rr = httptest.NewRecorder()
+	server.CrawlReportHandler(rr, httptest.NewRequest("GET", "/crawl/unknown", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown crawl, got %d", rr.Code)
+	}
+}
+
+func TestHreflangHandler(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		alternates := `<link rel="alternate" hreflang="en" href="/en"><link rel="alternate" hreflang="de" href="/de">`
+		if r.URL.Path == "/de" {
+			// The German page forgets the English one
+			alternates = `<link rel="alternate" hreflang="de" href="/de">`
+		}
+		w.Write([]byte(`<!DOCTYPE html><html><head><title>Page</title>` + alternates + `</head><body></body></html>`))
+	}))
+	defer testServer.Close()
+	serverURL := testServer.URL
+
+	server := NewServer()
+
+	testCases := []struct {
+		name     string
+		urls     string
+		expected int
+	}{
+		{"broken pair", serverURL + "/en " + serverURL + "/de", http.StatusOK},
+		{"too few urls", serverURL + "/en", http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("urls", tc.urls)
+			req := httptest.NewRequest("POST", "/hreflang", strings.NewReader(form.Encode()))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			rr := httptest.NewRecorder()
+			server.HreflangHandler(rr, req)
+			if rr.Code != tc.expected {
+				t.Fatalf("Expected status %d, got %d", tc.expected, rr.Code)
+			}
+			if rr.Code != http.StatusOK {
+				return
+			}
+
+			var report analyzer.HreflangReport
+			if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+				t.Fatalf("Failed to unmarshal JSON response: %v", err)
+			}
+			if report.Consistent || len(report.Issues) != 1 || report.Issues[0].Type != analyzer.HreflangMissingReturnLink ||
+				report.Issues[0].Target != serverURL+"/de" {
+				t.Errorf("Expected a missing return link from /de, got %+v", report)
+			}
+		})
+	}
+}
+
+func TestAnalyzeHandler_HeadingsText(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<!DOCTYPE html><html><head><title>Doc</title></head><body>
+			<h1>Guide</h1><h2>Install</h2><h2>Configure <em>the</em>
+			server</h2><h2>Deploy</h2></body></html>`))
+	}))
+	defer testServer.Close()
+
+	server := NewServer()
+
+	testCases := []struct {
+		name     string
+		params   map[string]string
+		expected int
+		headings map[string][]string
+	}{
+		{"default limit", map[string]string{"include_headings_text": "true"}, http.StatusOK,
+			map[string][]string{"h1": {"Guide"}, "h2": {"Install", "Configure the server", "Deploy"}}},
+		{"custom limit", map[string]string{"include_headings_text": "true", "headings_text_limit": "1"}, http.StatusOK,
+			map[string][]string{"h1": {"Guide"}, "h2": {"Install"}}},
+		{"not requested", map[string]string{}, http.StatusOK, nil},
+		{"invalid limit", map[string]string{"include_headings_text": "true", "headings_text_limit": "0"}, http.StatusBadRequest, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("url", testServer.URL)
+			form.Add("check_links", "false")
+			for key, value := range tc.params {
+				form.Add(key, value)
+			}
+
+			req := httptest.NewRequest("POST", "/analyze", strings.NewReader(form.Encode()))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			rr := httptest.NewRecorder()
+			server.AnalyzeHandler(rr, req)
+
+			if rr.Code != tc.expected {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expected, rr.Code, rr.Body.String())
+			}
+			if tc.expected != http.StatusOK {
+				return
+			}
+			var result analyzer.AnalysisResult
+			if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+				t.Fatalf("Failed to unmarshal JSON response: %v", err)
+			}
+			if len(result.HeadingsText) != len(tc.headings) {
+				t.Fatalf("Expected headings %v, got %v", tc.headings, result.HeadingsText)
+			}
+			for level, texts := range tc.headings {
+				if strings.Join(result.HeadingsText[level], "|") != strings.Join(texts, "|") {
+					t.Errorf("Expected %s headings %v, got %v", level, texts, result.HeadingsText[level])
+				}
+			}
+		})
+	}
+}
+
+func TestNDJSONStreaming(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sitemap.xml" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<!DOCTYPE html><html><head><title>Page</title></head><body><a href="/about">About</a></body></html>`))
+	}))
+	defer testServer.Close()
+
+	server := NewServer()
+
+	// readLines decodes a stream, checking it ends with the report
+	readLines := func(t *testing.T, rr *httptest.ResponseRecorder) []ndjsonLine {
+		if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != ndjsonContentType {
+			t.Fatalf("Expected a 200 NDJSON response, got %d (%s)", rr.Code, rr.Header().Get("Content-Type"))
+		}
+		if !rr.Flushed {
+			t.Error("Expected the stream to be flushed through the middleware")
+		}
+		var lines []ndjsonLine
+		for _, raw := range strings.Split(strings.TrimSpace(rr.Body.String()), "\n") {
+			var line ndjsonLine
+			if err := json.Unmarshal([]byte(raw), &line); err != nil {
+				t.Fatalf("Failed to unmarshal line %q: %v", raw, err)
+			}
+			lines = append(lines, line)
+		}
+		if last := lines[len(lines)-1]; last.Report == nil || last.Result != nil {
+			t.Errorf("Expected the last line to be the report, got %+v", last)
+		}
+		return lines
+	}
+
+	t.Run("duplicates", func(t *testing.T) {
+		form := url.Values{"urls": {testServer.URL + "/a " + testServer.URL + "/b " + testServer.URL + "/c"}}
+		req := httptest.NewRequest("POST", "/duplicates", strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Accept", "application/json;q=0.5, application/x-ndjson")
+		rr := httptest.NewRecorder()
+		middleware.Logging(http.HandlerFunc(server.DuplicatesHandler)).ServeHTTP(rr, req)
+
+		lines := readLines(t, rr)
+		if len(lines) != 4 {
+			t.Fatalf("Expected 3 results and a report, got %d lines", len(lines))
+		}
+		streamed := make(map[string]bool)
+		for _, line := range lines[:3] {
+			if line.Result == nil || line.Result.PageTitle != "Page" {
+				t.Errorf("Expected an analysis result, got %+v", line)
+				continue
+			}
+			streamed[line.Result.URL] = true
+		}
+		if len(streamed) != 3 {
+			t.Errorf("Expected every URL to be streamed once, got %v", streamed)
+		}
+	})
+
+	t.Run("crawl", func(t *testing.T) {
+		crawl, err := server.crawls.Start(context.Background(), testServer.URL, crawler.Options{})
+		if err != nil {
+			t.Fatalf("Expected crawl to start, got %v", err)
+		}
+		req := httptest.NewRequest("GET", "/crawl/"+crawl.ID, nil)
+		req.Header.Set("Accept", ndjsonContentType)
+		rr := httptest.NewRecorder()
+		middleware.Logging(http.HandlerFunc(server.CrawlReportHandler)).ServeHTTP(rr, req)
+
+		lines := readLines(t, rr)
+		if len(lines) != 3 {
+			t.Fatalf("Expected 2 pages and a report, got %d lines", len(lines))
+		}
+		for _, line := range lines[:2] {
+			if line.Page == nil || line.Result == nil || line.Result.URL != line.Page.URL {
+				t.Errorf("Expected a page with its analysis, got %+v", line)
+			}
+		}
+		report, _ := json.Marshal(lines[2].Report)
+		var finished crawler.Crawl
+		json.Unmarshal(report, &finished)
+		if finished.Status != crawler.StatusCompleted || len(finished.Pages) != 2 {
+			t.Errorf("Expected the completed crawl report, got %s with %d pages", finished.Status, len(finished.Pages))
+		}
+	})
+
+	// Without the Accept header the report is a single JSON document
+	req := httptest.NewRequest("GET", "/", nil)
+	if wantsNDJSON(req) {
+		t.Error("Expected requests without Accept not to stream")
+	}
+}
+
+func TestAnalyzeAsyncHandler(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<!DOCTYPE html><html><head><title>Async</title></head><body><h1>Slow page</h1></body></html>`))
+	}))
+	defer testServer.Close()
+
+	server := NewServer()
+
+	testCases := []struct {
+		name     string
+		params   map[string]string
+		expected int
+	}{
+		{"valid url", map[string]string{"url": testServer.URL, "check_links": "false"}, http.StatusAccepted},
+		{"missing url", map[string]string{}, http.StatusBadRequest},
+		{"invalid url", map[string]string{"url": "http://exa mple.com"}, http.StatusBadRequest},
+		{"invalid option", map[string]string{"url": testServer.URL, "extract": "not json"}, http.StatusBadRequest},
+	}
+
+	var location string
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			form := url.Values{}
+			for key, value := range tc.params {
+				form.Add(key, value)
+			}
+			req := httptest.NewRequest("POST", "/analyze/async", strings.NewReader(form.Encode()))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			rr := httptest.NewRecorder()
+			server.AnalyzeAsyncHandler(rr, req)
+			if rr.Code != tc.expected {
+				t.Fatalf("Expected status %d, got %d", tc.expected, rr.Code)
+			}
+			if rr.Code == http.StatusAccepted {
+				location = rr.Header().Get("Location")
+			}
+		})
+	}
+
+	if !strings.HasPrefix(location, "/jobs/") {
+		t.Fatalf("Expected a /jobs/{id} Location header, got %q", location)
+	}
+	var job jobs.Job
+	deadline := time.Now().Add(10 * time.Second)
+	for job.Status != jobs.StatusCompleted && time.Now().Before(deadline) {
+		rr := httptest.NewRecorder()
+		server.JobHandler(rr, httptest.NewRequest("GET", location, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rr.Code)
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &job); err != nil {
+			t.Fatalf("Failed to unmarshal JSON response: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if job.Status != jobs.StatusCompleted || job.Result == nil || job.Result.PageTitle != "Async" {
+		t.Errorf("Expected a completed job with its result, got %+v", job)
+	}
+
+	rr := httptest.NewRecorder()
+	server.JobHandler(rr, httptest.NewRequest("GET", location+"?fields=page_title", nil))
+	if !strings.Contains(rr.Body.String(), `"result":{"page_title":"Async"}`) {
+		t.Errorf("Expected the job's result reduced to its title, got %s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	server.JobHandler(rr, httptest.NewRequest("GET", "/jobs/unknown", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown job, got %d", rr.Code)
+	}
+}
+
+// saturateBatchSlots takes every batch slot of the server's limiter and returns
+// the func giving them back
+func saturateBatchSlots(t *testing.T, server *Server) func() {
+	t.Helper()
+	var releases []func()
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		release, ok := server.Limiter().Acquire(ctx, true)
+		cancel()
+		if !ok {
+			break
+		}
+		releases = append(releases, release)
+	}
+	if len(releases) == 0 {
+		t.Fatal("Expected to take the limiter's batch slots")
+	}
+	return func() {
+		for _, release := range releases {
+			release()
+		}
+	}
+}
+
+func TestAnalyzeAsyncHandler_WaitsForBatchSlot(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<!DOCTYPE html><html><head><title>Async</title></head></html>`))
+	}))
+	defer testServer.Close()
+
+	server := NewServer()
+	release := saturateBatchSlots(t, server)
+
+	form := url.Values{"url": {testServer.URL}, "check_links": {"false"}}
+	req := httptest.NewRequest("POST", "/analyze/async", strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	server.AnalyzeAsyncHandler(rr, req)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", rr.Code)
+	}
+	location := rr.Header().Get("Location")
+
+	poll := func() jobs.Job {
+		var job jobs.Job
+		rr := httptest.NewRecorder()
+		server.JobHandler(rr, httptest.NewRequest("GET", location, nil))
+		if err := json.Unmarshal(rr.Body.Bytes(), &job); err != nil {
+			t.Fatalf("Failed to unmarshal JSON response: %v", err)
+		}
+		return job
+	}
+
+	// The job waits while every batch slot is taken
+	time.Sleep(200 * time.Millisecond)
+	if job := poll(); job.Status == jobs.StatusCompleted {
+		t.Fatal("Expected the job to wait for a batch slot")
+	}
+
+	release()
+	deadline := time.Now().Add(10 * time.Second)
+	job := poll()
+	for job.Status != jobs.StatusCompleted && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+		job = poll()
+	}
+	if job.Status != jobs.StatusCompleted {
+		t.Errorf("Expected the job to complete once a slot was free, got %+v", job)
+	}
+}
+func TestConditionalRequests(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<!DOCTYPE html><html><head><title>Polled Page</title></head><body><h1>Hello</h1></body></html>`))
+	}))
+	defer testServer.Close()
+
+	t.Setenv("RESULTS_DIR", t.TempDir())
+	server := NewServer()
+
+	analyze := func(headers map[string]string) *httptest.ResponseRecorder {
+		form := url.Values{"url": {testServer.URL}, "check_links": {"false"}}
+		req := httptest.NewRequest("POST", "/analyze", strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		rr := httptest.NewRecorder()
+		server.AnalyzeHandler(rr, req)
+		return rr
+	}
+
+	first := analyze(nil)
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || !strings.HasPrefix(etag, `W/"`) || first.Header().Get("Last-Modified") == "" {
+		t.Fatalf("Expected a 200 with a weak ETag and Last-Modified, got %d with %v", first.Code, first.Header())
+	}
+	var result analyzer.AnalysisResult
+	json.Unmarshal(first.Body.Bytes(), &result)
+
+	testCases := []struct {
+		name     string
+		headers  map[string]string
+		expected int
+	}{
+		{"matching etag", map[string]string{"If-None-Match": etag}, http.StatusNotModified},
+		{"etag in a list", map[string]string{"If-None-Match": `"other", ` + strings.TrimPrefix(etag, "W/")}, http.StatusNotModified},
+		{"stale etag", map[string]string{"If-None-Match": `W/"stale"`}, http.StatusOK},
+		{"not modified since", map[string]string{"If-Modified-Since": first.Header().Get("Last-Modified")}, http.StatusNotModified},
+		{"etag wins over date", map[string]string{"If-None-Match": `"stale"`, "If-Modified-Since": first.Header().Get("Last-Modified")}, http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := analyze(tc.headers)
+			if rr.Code != tc.expected {
+				t.Fatalf("Expected status %d, got %d", tc.expected, rr.Code)
+			}
+			if rr.Header().Get("ETag") != etag {
+				t.Errorf("Expected the cached result to keep ETag %s, got %s", etag, rr.Header().Get("ETag"))
+			}
+			if rr.Code == http.StatusNotModified && rr.Body.Len() != 0 {
+				t.Errorf("Expected an empty 304 body, got %q", rr.Body.String())
+			}
+		})
+	}
+
+	// Stored results are tagged per language
+	get := func(handler http.HandlerFunc, path, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+	permalink := get(server.PermalinkHandler, result.Permalink, "")
+	if permalink.Code != http.StatusOK || permalink.Header().Get("ETag") == "" {
+		t.Fatalf("Expected a tagged permalink page, got %d with %v", permalink.Code, permalink.Header())
+	}
+	if rr := get(server.PermalinkHandler, result.Permalink, permalink.Header().Get("ETag")); rr.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for an unchanged permalink page, got %d", rr.Code)
+	}
+	if rr := get(server.PermalinkHandler, result.Permalink+"?lang=de", permalink.Header().Get("ETag")); rr.Code != http.StatusOK {
+		t.Errorf("Expected another language to be a new version, got %d", rr.Code)
+	}
+
+	// Jobs change tag with their status
+	job, err := server.jobs.Submit(context.Background(), testServer.URL, analyzer.AnalysisOptions{SkipLinkCheck: true})
+	if err != nil {
+		t.Fatalf("Expected the job to be queued, got %v", err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for job.Status != jobs.StatusCompleted && time.Now().Before(deadline) {
+		job, _ = server.jobs.Get(job.ID)
+		time.Sleep(10 * time.Millisecond)
+	}
+	polled := get(server.JobHandler, "/jobs/"+job.ID, `"`+job.ID+`-queued"`)
+	if polled.Code != http.StatusOK {
+		t.Fatalf("Expected a finished job to differ from its queued version, got %d", polled.Code)
+	}
+	if rr := get(server.JobHandler, "/jobs/"+job.ID, polled.Header().Get("ETag")); rr.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for an unchanged job, got %d", rr.Code)
+	}
+}
+
+func TestAnalyzeHandler_HTML(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<!DOCTYPE html><html><head><title>Readable Page</title></head><body><h1>Hello</h1></body></html>`))
+	}))
+	defer testServer.Close()
+
+	server := NewServer()
+
+	testCases := []struct {
+		name        string
+		accept      string
+		contentType string
+		contains    string
+	}{
+		{"curl default", "*/*", "application/json", `"page_title":"Readable Page"`},
+		{"browser", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "text/html; charset=utf-8", "<div class=\"result-value\">Readable Page</div>"},
+		{"explicit html", "text/html", "text/html; charset=utf-8", "Analysis Results"},
+		{"json preferred", "text/html;q=0.5, application/json", "application/json", `"page_title":"Readable Page"`},
+		{"tie keeps json", "application/json, text/html", "application/json", `"page_title":"Readable Page"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			form := url.Values{"url": {testServer.URL}, "check_links": {"false"}}
+			req := httptest.NewRequest("POST", "/analyze", strings.NewReader(form.Encode()))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("Accept", tc.accept)
+			rr := httptest.NewRecorder()
+			server.AnalyzeHandler(rr, req)
+
+			if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != tc.contentType {
+				t.Fatalf("Expected status 200 with %s, got %d with %s", tc.contentType, rr.Code, rr.Header().Get("Content-Type"))
+			}
+			if !strings.Contains(rr.Body.String(), tc.contains) {
+				t.Errorf("Expected the response to contain %q, got %s", tc.contains, rr.Body.String())
+			}
+			if rr.Header().Get("Vary") != "Accept, Accept-Language" {
+				t.Errorf("Expected Vary: Accept, Accept-Language, got %q", rr.Header().Get("Vary"))
+			}
+		})
+	}
+}
+
+func TestNegotiateContentType(t *testing.T) {
+	testCases := []struct {
+		accept   string
+		expected string
+	}{
+		{"", "application/json"},
+		{"*/*", "application/json"},
+		{"text/*", "text/html"},
+		{"text/html;q=0", "application/json"},
+		{"image/png", "application/json"},
+		{"application/*;q=0.2, text/html;q=0.4", "text/html"},
+		{"text/html, */*;q=0.1", "text/html"},
+	}
+
+	for _, tc := range testCases {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", tc.accept)
+		if got := negotiateContentType(req, "application/json", "text/html"); got != tc.expected {
+			t.Errorf("Expected %s for Accept %q, got %s", tc.expected, tc.accept, got)
+		}
+	}
+}
+
+func TestAnalyzeStreamHandler(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<!DOCTYPE html><html><head><title>Streamed</title></head><body><a href="/about">About</a></body></html>`))
+	}))
+	defer testServer.Close()
+
+	server := NewServer()
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/analyze/stream?url="+url.QueryEscape(testServer.URL), nil)
+	middleware.Logging(http.HandlerFunc(server.AnalyzeStreamHandler)).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "text/event-stream" || !rr.Flushed {
+		t.Fatalf("Expected a flushed event stream, got %d (%s)", rr.Code, rr.Header().Get("Content-Type"))
+	}
+
+	var names []string
+	var done analyzer.AnalysisResult
+	for _, block := range strings.Split(strings.TrimSpace(rr.Body.String()), "\n\n") {
+		event, data, _ := strings.Cut(block, "\n")
+		name := strings.TrimPrefix(event, "event: ")
+		names = append(names, name)
+		if !strings.HasPrefix(data, "data: {") {
+			t.Errorf("Expected JSON data for %s, got %q", name, data)
+		}
+		if name == sseDoneEvent {
+			json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &done)
+		}
+	}
+	expected := "fetched parsed document links links done"
+	if strings.Join(names, " ") != expected {
+		t.Errorf("Expected events %q, got %q", expected, strings.Join(names, " "))
+	}
+	if done.PageTitle != "Streamed" || done.InternalLinks != 1 {
+		t.Errorf("Expected the result in the done event, got %+v", done)
+	}
+
+	rr = httptest.NewRecorder()
+	server.AnalyzeStreamHandler(rr, httptest.NewRequest("GET", "/analyze/stream", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without a URL, got %d", rr.Code)
+	}
+}
+
+func TestAnalyzeHandler_Fields(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<!DOCTYPE html><html><head><title>Selected</title></head><body><h1>One</h1><h2>Two</h2></body></html>`))
+	}))
+	defer testServer.Close()
+
+	server := NewServer()
+
+	tests := []struct {
+		name     string
+		fields   string
+		status   int
+		expected string
+	}{
+		{"top-level fields", "page_title, external_links", http.StatusOK, `{"external_links":0,"page_title":"Selected"}`},
+		{"nested key", "page_title,heading_counts.h1", http.StatusOK, `{"heading_counts":{"h1":1},"page_title":"Selected"}`},
+		{"missing key", "heading_counts.h6", http.StatusOK, `{"heading_counts":{}}`},
+		{"unknown field", "page_title,title", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"url": {testServer.URL}, "check_links": {"false"}, "fields": {tt.fields}}
+			req := httptest.NewRequest("POST", "/analyze", strings.NewReader(form.Encode()))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			rr := httptest.NewRecorder()
+			server.AnalyzeHandler(rr, req)
+
+			if rr.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+			if tt.expected != "" && strings.TrimSpace(rr.Body.String()) != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, rr.Body.String())
+			}
+		})
+	}
+
+	// A failed analysis keeps its error
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+	form := url.Values{"url": {missing.URL}, "fields": {"page_title"}}
+	req := httptest.NewRequest("POST", "/analyze", strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	server.AnalyzeHandler(rr, req)
+	var failed map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &failed)
+	if _, ok := failed["error"]; !ok || len(failed) != 2 {
+		t.Errorf("Expected the page title and error of a failed analysis, got %s", rr.Body.String())
+	}
+}
+
+func TestWebSocketHandler(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<!DOCTYPE html><html><head><title>Live</title></head><body><h1>Live</h1><a href="/next">Next</a></body></html>`))
+	}))
+	defer testServer.Close()
+
+	server := NewServer()
+	wsServer := httptest.NewServer(middleware.Logging(http.HandlerFunc(server.WebSocketHandler)))
+	defer wsServer.Close()
+
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(wsServer.URL, "http"), "", wsServer.URL)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	receive := func() wsMessage {
+		var message wsMessage
+		if err := websocket.JSON.Receive(conn, &message); err != nil {
+			t.Fatalf("Failed to receive: %v", err)
+		}
+		return message
+	}
+
+	request := wsMessage{Type: wsAnalyze, ID: "1", URL: testServer.URL, Params: map[string]string{"fields": "page_title"}}
+	if err := websocket.JSON.Send(conn, request); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	var stages []string
+	var message wsMessage
+	for message = receive(); message.Type == wsProgress; message = receive() {
+		if message.ID != "1" {
+			t.Errorf("Expected progress for request 1, got %q", message.ID)
+		}
+		stages = append(stages, message.Progress.Stage)
+		if message.Progress.Stage == analyzer.ProgressDocument && message.Progress.HeadingCounts["h1"] != 1 {
+			t.Errorf("Expected the heading counts before links are checked, got %+v", message.Progress)
+		}
+	}
+	expected := "fetched parsed document links links"
+	if strings.Join(stages, " ") != expected {
+		t.Errorf("Expected stages %q, got %q", expected, strings.Join(stages, " "))
+	}
+	if message.Type != wsResult || message.ID != "1" {
+		t.Fatalf("Expected the result of request 1, got %+v", message)
+	}
+	if result, _ := json.Marshal(message.Result); string(result) != `{"page_title":"Live"}` {
+		t.Errorf("Expected the selected fields of the result, got %s", result)
+	}
+
+	// Bad requests are answered with an error and leave the connection open
+	for _, tc := range []struct {
+		send     string
+		expected string
+	}{
+		{`not json`, "Invalid message"},
+		{`{"type":"ping"}`, "Unknown message type"},
+		{`{"type":"analyze"}`, "URL parameter is required"},
+		{`{"type":"analyze","url":"` + testServer.URL + `","params":{"fields":"nope"}}`, "Unknown field"},
+	} {
+		if err := websocket.Message.Send(conn, tc.send); err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+		if reply := receive(); reply.Type != wsError || !strings.Contains(reply.Error, tc.expected) {
+			t.Errorf("Expected an error containing %q for %s, got %+v", tc.expected, tc.send, reply)
+		}
+	}
+}
+
+func TestWebSocketAdmission(t *testing.T) {
+	t.Setenv("API_KEYS", "ws-key:0:1")
+	t.Setenv("MAX_CONCURRENT_ANALYSES", "1")
+	t.Setenv("ANALYSIS_QUEUE_SIZE", "0")
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Live</title></head><body></body></html>`))
+	}))
+	defer testServer.Close()
+
+	server := NewServer()
+	wsServer := httptest.NewServer(server.APIKeys().Authenticate(http.HandlerFunc(server.WebSocketHandler)))
+	defer wsServer.Close()
+
+	config, err := websocket.NewConfig("ws"+strings.TrimPrefix(wsServer.URL, "http"), wsServer.URL)
+	if err != nil {
+		t.Fatalf("Failed to configure: %v", err)
+	}
+	config.Header.Set("X-API-Key", "ws-key")
+	conn, err := websocket.DialConfig(config)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	analyze := func() wsMessage {
+		request := wsMessage{Type: wsAnalyze, URL: testServer.URL, Params: map[string]string{"check_links": "false"}}
+		if err := websocket.JSON.Send(conn, request); err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+		for {
+			var message wsMessage
+			if err := websocket.JSON.Receive(conn, &message); err != nil {
+				t.Fatalf("Failed to receive: %v", err)
+			}
+			if message.Type != wsProgress {
+				return message
+			}
+		}
+	}
+
+	// A saturated limiter refuses the analysis without charging the key
+	release, ok := server.Limiter().Acquire(context.Background(), false)
+	if !ok {
+		t.Fatal("Expected to take the only limiter slot")
+	}
+	if reply := analyze(); reply.Type != wsError || !strings.Contains(reply.Error, "capacity") {
+		t.Errorf("Expected a capacity error, got %+v", reply)
+	}
+	release()
+
+	if reply := analyze(); reply.Type != wsResult {
+		t.Errorf("Expected the first analysis within the quota to run, got %+v", reply)
+	}
+	if reply := analyze(); reply.Type != wsError || !strings.Contains(reply.Error, "quota") {
+		t.Errorf("Expected the second analysis to exceed the quota, got %+v", reply)
+	}
+}
+
+func TestWebSocketMemoryPressure(t *testing.T) {
+	var linkChecks atomic.Int32
+	linked := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		linkChecks.Add(1)
+	}))
+	defer linked.Close()
+
+	external := strings.Replace(linked.URL, "127.0.0.1", "localhost", 1)
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Shed</title></head><body><a href="` + external + `/a">A</a></body></html>`))
+	}))
+	defer page.Close()
+
+	analyze := func(server *Server) wsMessage {
+		wsServer := httptest.NewServer(http.HandlerFunc(server.WebSocketHandler))
+		defer wsServer.Close()
+		conn, err := websocket.Dial("ws"+strings.TrimPrefix(wsServer.URL, "http"), "", wsServer.URL)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+		if err := websocket.JSON.Send(conn, wsMessage{Type: wsAnalyze, URL: page.URL}); err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+		for {
+			var message wsMessage
+			if err := websocket.JSON.Receive(conn, &message); err != nil {
+				t.Fatalf("Failed to receive: %v", err)
+			}
+			if message.Type != wsProgress {
+				return message
+			}
+		}
+	}
+
+	// Pressure is checked for each analysis, not only when the connection opened
+	t.Setenv("MEMORY_SOFT_LIMIT_MB", "1")
+	degraded := NewServer()
+	defer degraded.MemoryGuard().Stop()
+	if reply := analyze(degraded); reply.Type != wsResult {
+		t.Fatalf("Expected a result under degraded pressure, got %+v", reply)
+	}
+	if checks := linkChecks.Load(); checks != 0 {
+		t.Errorf("Expected no link checks under memory pressure, got %d", checks)
+	}
+
+	t.Setenv("MEMORY_HARD_LIMIT_MB", "1")
+	critical := NewServer()
+	defer critical.MemoryGuard().Stop()
+	if reply := analyze(critical); reply.Type != wsError || !strings.Contains(reply.Error, "memory") {
+		t.Errorf("Expected a memory error under critical pressure, got %+v", reply)
+	}
+}
@@ -0,0 +1,369 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"web-page-analyzer/logger"
+)
+
+// DefaultLanguage is served when no supported language is requested; its
+// catalog also fills in keys missing from the others
+const DefaultLanguage = "en"
+
+// translations holds the UI strings per language, keyed by message ID
+var translations = map[string]map[string]string{
+	"en": {
+		"app_title":             "Web Page Analyzer",
+		"app_subtitle":          "Analyze web pages for HTML structure, content, and accessibility",
+		"form_label":            "URL Analysis Form",
+		"url_label":             "Enter URL to analyze",
+		"url_help":              "Enter a valid web address to analyze",
+		"url_help_ready":        "Press Enter or click Analyze to start analysis",
+		"analyze_button":        "Analyze Page",
+		"analyzing_button":      "Analyzing...",
+		"results_label":         "Analysis Results",
+		"field_url":             "URL",
+		"field_html_version":    "HTML Version",
+		"field_page_title":      "Page Title",
+		"field_headings":        "Headings",
+		"field_links":           "Links",
+		"field_login_form":      "Login Form",
+		"loading_message":       "Analyzing web page, please wait...",
+		"status_analyzing":      "Analyzing the web page, please wait...",
+		"status_success":        "Analysis completed successfully!",
+		"status_failed":         "Analysis failed. Please try again.",
+		"error_invalid_url":     "Please enter a valid URL",
+		"error_analysis_failed": "Error: Failed to analyze the page.",
+		"no_title":              "No title found",
+		"no_headings":           "No headings found",
+		"links_internal":        "Internal",
+		"links_external":        "External",
+		"links_inaccessible":    "Inaccessible",
+		"yes":                   "Yes",
+		"no":                    "No",
+		"not_available":         "N/A",
+		"shared_result":         "Shared analysis result",
+		"field_analyzed_at":     "Analyzed At",
+		"field_status_code":     "HTTP Status",
+		"field_error":           "Error",
+		"result_not_found":      "This result was not found. It may have expired.",
+		"analyze_another":       "Analyze another page",
+		"field_permalink":       "Permalink",
+		"field_snapshot":        "HTML snapshot",
+		"dashboard_title":       "Dashboard",
+		"stat_total":            "Analyses",
+		"stat_active":           "Running",
+		"stat_error_rate":       "Error rate",
+		"stat_avg_latency":      "Average latency",
+		"stat_p50_latency":      "Median latency",
+		"stat_p95_latency":      "95th percentile latency",
+		"stat_cache_hit_ratio":  "Cache hit ratio",
+		"recent_analyses":       "Recent analyses",
+		"history_for":           "History for",
+		"chart_duration":        "Analysis duration (ms)",
+		"chart_inaccessible":    "Inaccessible links",
+		"field_duration":        "Duration",
+		"view_history":          "History",
+		"no_analyses":           "No analyses stored yet.",
+		"history_disabled":      "Set RESULTS_DIR to keep analysis history.",
+		"compare_title":         "Compare analyses",
+		"compare_before":        "Before",
+		"compare_after":         "After",
+		"compare_button":        "Compare",
+		"compare_changes":       "Changes",
+		"compare_latest":        "Compare latest two runs",
+		"result_id":             "Result ID",
+		"field_final_url":       "Final URL",
+		"field_content_length":  "Content Length",
+		"links_not_compared":    "Links were not collected for both analyses; analyze with collect_links=true to compare them.",
+		"no_differences":        "No differences found.",
+	},
+	"de": {
+		"app_title":             "Webseiten-Analyse",
+		"app_subtitle":          "Webseiten auf HTML-Struktur, Inhalt und Barrierefreiheit analysieren",
+		"form_label":            "Formular zur URL-Analyse",
+		"url_label":             "Zu analysierende URL eingeben",
+		"url_help":              "Geben Sie eine gültige Webadresse ein",
+		"url_help_ready":        "Drücken Sie die Eingabetaste oder klicken Sie auf Analysieren",
+		"analyze_button":        "Seite analysieren",
+		"analyzing_button":      "Wird analysiert...",
+		"results_label":         "Analyseergebnisse",
+		"field_url":             "URL",
+		"field_html_version":    "HTML-Version",
+		"field_page_title":      "Seitentitel",
+		"field_headings":        "Überschriften",
+		"field_links":           "Links",
+		"field_login_form":      "Anmeldeformular",
+		"loading_message":       "Webseite wird analysiert, bitte warten...",
+		"status_analyzing":      "Die Webseite wird analysiert, bitte warten...",
+		"status_success":        "Analyse erfolgreich abgeschlossen!",
+		"status_failed":         "Analyse fehlgeschlagen. Bitte versuchen Sie es erneut.",
+		"error_invalid_url":     "Bitte geben Sie eine gültige URL ein",
+		"error_analysis_failed": "Fehler: Die Seite konnte nicht analysiert werden.",
+		"no_title":              "Kein Titel gefunden",
+		"no_headings":           "Keine Überschriften gefunden",
+		"links_internal":        "Intern",
+		"links_external":        "Extern",
+		"links_inaccessible":    "Nicht erreichbar",
+		"yes":                   "Ja",
+		"no":                    "Nein",
+		"not_available":         "k. A.",
+		"shared_result":         "Geteiltes Analyseergebnis",
+		"field_analyzed_at":     "Analysiert am",
+		"field_status_code":     "HTTP-Status",
+		"field_error":           "Fehler",
+		"result_not_found":      "Dieses Ergebnis wurde nicht gefunden. Möglicherweise ist es abgelaufen.",
+		"analyze_another":       "Weitere Seite analysieren",
+		"field_permalink":       "Permalink",
+		"field_snapshot":        "HTML-Schnappschuss",
+		"dashboard_title":       "Dashboard",
+		"stat_total":            "Analysen",
+		"stat_active":           "Laufend",
+		"stat_error_rate":       "Fehlerquote",
+		"stat_avg_latency":      "Durchschnittliche Latenz",
+		"stat_p50_latency":      "Median-Latenz",
+		"stat_p95_latency":      "Latenz (95. Perzentil)",
+		"stat_cache_hit_ratio":  "Cache-Trefferquote",
+		"recent_analyses":       "Letzte Analysen",
+		"history_for":           "Verlauf für",
+		"chart_duration":        "Analysedauer (ms)",
+		"chart_inaccessible":    "Nicht erreichbare Links",
+		"field_duration":        "Dauer",
+		"view_history":          "Verlauf",
+		"no_analyses":           "Noch keine Analysen gespeichert.",
+		"history_disabled":      "Setzen Sie RESULTS_DIR, um den Analyseverlauf zu speichern.",
+		"compare_title":         "Analysen vergleichen",
+		"compare_before":        "Vorher",
+		"compare_after":         "Nachher",
+		"compare_button":        "Vergleichen",
+		"compare_changes":       "Änderungen",
+		"compare_latest":        "Letzte zwei Läufe vergleichen",
+		"result_id":             "Ergebnis-ID",
+		"field_final_url":       "Endgültige URL",
+		"field_content_length":  "Inhaltslänge",
+		"links_not_compared":    "Links wurden nicht für beide Analysen erfasst; analysieren Sie mit collect_links=true, um sie zu vergleichen.",
+		"no_differences":        "Keine Unterschiede gefunden.",
+	},
+	"fr": {
+		"app_title":             "Analyseur de pages web",
+		"app_subtitle":          "Analysez la structure HTML, le contenu et l'accessibilité des pages web",
+		"form_label":            "Formulaire d'analyse d'URL",
+		"url_label":             "Saisissez l'URL à analyser",
+		"url_help":              "Saisissez une adresse web valide",
+		"url_help_ready":        "Appuyez sur Entrée ou cliquez sur Analyser pour lancer l'analyse",
+		"analyze_button":        "Analyser la page",
+		"analyzing_button":      "Analyse en cours...",
+		"results_label":         "Résultats de l'analyse",
+		"field_url":             "URL",
+		"field_html_version":    "Version HTML",
+		"field_page_title":      "Titre de la page",
+		"field_headings":        "Titres",
+		"field_links":           "Liens",
+		"field_login_form":      "Formulaire de connexion",
+		"loading_message":       "Analyse de la page en cours, veuillez patienter...",
+		"status_analyzing":      "Analyse de la page web en cours, veuillez patienter...",
+		"status_success":        "Analyse terminée avec succès !",
+		"status_failed":         "L'analyse a échoué. Veuillez réessayer.",
+		"error_invalid_url":     "Veuillez saisir une URL valide",
+		"error_analysis_failed": "Erreur : impossible d'analyser la page.",
+		"no_title":              "Aucun titre trouvé",
+		"no_headings":           "Aucun titre de section trouvé",
+		"links_internal":        "Internes",
+		"links_external":        "Externes",
+		"links_inaccessible":    "Inaccessibles",
+		"yes":                   "Oui",
+		"no":                    "Non",
+		"not_available":         "N/D",
+		"shared_result":         "Résultat d'analyse partagé",
+		"field_analyzed_at":     "Analysé le",
+		"field_status_code":     "Statut HTTP",
+		"field_error":           "Erreur",
+		"result_not_found":      "Ce résultat est introuvable. Il a peut-être expiré.",
+		"analyze_another":       "Analyser une autre page",
+		"field_permalink":       "Lien permanent",
+		"field_snapshot":        "Instantané HTML",
+		"dashboard_title":       "Tableau de bord",
+		"stat_total":            "Analyses",
+		"stat_active":           "En cours",
+		"stat_error_rate":       "Taux d'erreur",
+		"stat_avg_latency":      "Latence moyenne",
+		"stat_p50_latency":      "Latence médiane",
+		"stat_p95_latency":      "Latence au 95e centile",
+		"stat_cache_hit_ratio":  "Taux de succès du cache",
+		"recent_analyses":       "Analyses récentes",
+		"history_for":           "Historique de",
+		"chart_duration":        "Durée d'analyse (ms)",
+		"chart_inaccessible":    "Liens inaccessibles",
+		"field_duration":        "Durée",
+		"view_history":          "Historique",
+		"no_analyses":           "Aucune analyse enregistrée pour le moment.",
+		"history_disabled":      "Définissez RESULTS_DIR pour conserver l'historique des analyses.",
+		"compare_title":         "Comparer des analyses",
+		"compare_before":        "Avant",
+		"compare_after":         "Après",
+		"compare_button":        "Comparer",
+		"compare_changes":       "Modifications",
+		"compare_latest":        "Comparer les deux dernières analyses",
+		"result_id":             "ID du résultat",
+		"field_final_url":       "URL finale",
+		"field_content_length":  "Taille du contenu",
+		"links_not_compared":    "Les liens n'ont pas été collectés pour les deux analyses ; analysez avec collect_links=true pour les comparer.",
+		"no_differences":        "Aucune différence trouvée.",
+	},
+	"es": {
+		"app_title":             "Analizador de páginas web",
+		"app_subtitle":          "Analiza la estructura HTML, el contenido y la accesibilidad de páginas web",
+		"form_label":            "Formulario de análisis de URL",
+		"url_label":             "Introduce la URL que quieres analizar",
+		"url_help":              "Introduce una dirección web válida",
+		"url_help_ready":        "Pulsa Intro o haz clic en Analizar para empezar",
+		"analyze_button":        "Analizar página",
+		"analyzing_button":      "Analizando...",
+		"results_label":         "Resultados del análisis",
+		"field_url":             "URL",
+		"field_html_version":    "Versión de HTML",
+		"field_page_title":      "Título de la página",
+		"field_headings":        "Encabezados",
+		"field_links":           "Enlaces",
+		"field_login_form":      "Formulario de inicio de sesión",
+		"loading_message":       "Analizando la página web, espera por favor...",
+		"status_analyzing":      "Analizando la página web, espera por favor...",
+		"status_success":        "¡Análisis completado correctamente!",
+		"status_failed":         "El análisis ha fallado. Inténtalo de nuevo.",
+		"error_invalid_url":     "Introduce una URL válida",
+		"error_analysis_failed": "Error: no se pudo analizar la página.",
+		"no_title":              "No se encontró ningún título",
+		"no_headings":           "No se encontraron encabezados",
+		"links_internal":        "Internos",
+		"links_external":        "Externos",
+		"links_inaccessible":    "Inaccesibles",
+		"yes":                   "Sí",
+		"no":                    "No",
+		"not_available":         "N/D",
+		"shared_result":         "Resultado de análisis compartido",
+		"field_analyzed_at":     "Analizado el",
+		"field_status_code":     "Estado HTTP",
+		"field_error":           "Error",
+		"result_not_found":      "No se encontró este resultado. Puede que haya caducado.",
+		"analyze_another":       "Analizar otra página",
+		"field_permalink":       "Enlace permanente",
+		"field_snapshot":        "Instantánea HTML",
+		"dashboard_title":       "Panel",
+		"stat_total":            "Análisis",
+		"stat_active":           "En curso",
+		"stat_error_rate":       "Tasa de errores",
+		"stat_avg_latency":      "Latencia media",
+		"stat_p50_latency":      "Latencia mediana",
+		"stat_p95_latency":      "Latencia del percentil 95",
+		"stat_cache_hit_ratio":  "Tasa de aciertos de caché",
+		"recent_analyses":       "Análisis recientes",
+		"history_for":           "Historial de",
+		"chart_duration":        "Duración del análisis (ms)",
+		"chart_inaccessible":    "Enlaces inaccesibles",
+		"field_duration":        "Duración",
+		"view_history":          "Historial",
+		"no_analyses":           "Aún no hay análisis guardados.",
+		"history_disabled":      "Configure RESULTS_DIR para conservar el historial de análisis.",
+		"compare_title":         "Comparar análisis",
+		"compare_before":        "Antes",
+		"compare_after":         "Después",
+		"compare_button":        "Comparar",
+		"compare_changes":       "Cambios",
+		"compare_latest":        "Comparar las dos últimas ejecuciones",
+		"result_id":             "ID del resultado",
+		"field_final_url":       "URL final",
+		"field_content_length":  "Tamaño del contenido",
+		"links_not_compared":    "No se recopilaron los enlaces de ambos análisis; analice con collect_links=true para compararlos.",
+		"no_differences":        "No se encontraron diferencias.",
+	},
+}
+
+// SupportedLanguages returns the languages with a catalog, sorted
+func SupportedLanguages() []string {
+	languages := make([]string, 0, len(translations))
+	for lang := range translations {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// catalog returns the strings for lang, falling back to the default language
+// for missing keys; ok is false when lang has no catalog
+func catalog(lang string) (map[string]string, bool) {
+	messages, ok := translations[lang]
+	if !ok {
+		return nil, false
+	}
+	merged := make(map[string]string, len(translations[DefaultLanguage]))
+	for key, message := range translations[DefaultLanguage] {
+		merged[key] = message
+	}
+	for key, message := range messages {
+		merged[key] = message
+	}
+	return merged, true
+}
+
+// negotiateLanguage picks the supported language the client prefers most from
+// an Accept-Language header, matching on the primary subtag (de-AT matches de)
+func negotiateLanguage(acceptLanguage string) string {
+	best, bestQ := DefaultLanguage, 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		primary, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if _, ok := translations[primary]; ok && q > bestQ {
+			best, bestQ = primary, q
+		}
+	}
+	return best
+}
+
+// requestLanguage returns the UI language for a request: a supported lang query
+// parameter wins over Accept-Language
+func requestLanguage(r *http.Request) string {
+	if lang := strings.ToLower(r.URL.Query().Get("lang")); lang != "" {
+		if _, ok := translations[lang]; ok {
+			return lang
+		}
+	}
+	return negotiateLanguage(r.Header.Get("Accept-Language"))
+}
+
+// I18nHandler serves the UI strings of one language at /i18n/{lang}.json
+func (s *Server) I18nHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/i18n/")
+	lang, isJSON := strings.CutSuffix(name, ".json")
+	messages, ok := catalog(strings.ToLower(lang))
+	if !isJSON || !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Language", strings.ToLower(lang))
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	if err := json.NewEncoder(w).Encode(messages); err != nil {
+		logger.Sugar.Errorw("JSON encoding error", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"web-page-analyzer/analyzer"
+	"web-page-analyzer/jobs"
+	"web-page-analyzer/logger"
+)
+
+// jobsPrefix is the path under which background analyses are polled
+const jobsPrefix = "/jobs/"
+
+// newJobManager runs background analyses on ASYNC_WORKERS workers, each taking
+// a batch slot of the concurrency limiter, storing their results for permalinks
+// like /analyze does
+func newJobManager(s *Server) *jobs.Manager {
+	limited := analyzer.LimitedClient(s.analyzer, s.limiter)
+	client := analyzer.ClientFunc(func(ctx context.Context, targetURL string, opts analyzer.AnalysisOptions) *analyzer.AnalysisResult {
+		return s.storeResult(limited.AnalyzeURLWithOptions(ctx, targetURL, opts))
+	})
+	return jobs.New(client, envInt("ASYNC_WORKERS", jobs.DefaultWorkers))
+}
+
+// AnalyzeAsyncHandler queues an analysis with the parameters of /analyze and
+// returns the job with 202 Accepted right away; the result is then polled at
+// /jobs/{id}
+func (s *Server) AnalyzeAsyncHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	targetURL := r.FormValue("url")
+	if targetURL == "" {
+		http.Error(w, "URL parameter is required", http.StatusBadRequest)
+		return
+	}
+	if _, err := s.analyzer.NormalizeURL(targetURL); err != nil {
+		http.Error(w, "Invalid URL format", http.StatusBadRequest)
+		return
+	}
+
+	opts, err := s.analysisOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Nobody waits on a background job, so it yields unless asked not to
+	if r.FormValue("priority") == "" {
+		opts.Priority = analyzer.PriorityBatch
+	}
+
+	job, err := s.jobs.Submit(r.Context(), targetURL, opts)
+	switch {
+	case errors.Is(err, jobs.ErrQueueFull):
+		http.Error(w, "Too many queued jobs, retry later", http.StatusTooManyRequests)
+		return
+	case err != nil:
+		logger.Sugar.Errorw("Failed to queue job", "url", targetURL, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", jobsPrefix+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		logger.Sugar.Errorw("JSON encoding error", "error", err)
+	}
+}
+
+// JobHandler serves the status of a background analysis at /jobs/{id},
+// including its result once it has finished, reduced to the requested fields
+func (s *Server) JobHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	fields, err := requestFields(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job, ok := s.jobs.Get(strings.TrimPrefix(r.URL.Path, jobsPrefix))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	// A job only changes when its status does
+	modified := job.CreatedAt
+	for _, at := range []time.Time{job.StartedAt, job.FinishedAt} {
+		if at.After(modified) {
+			modified = at
+		}
+	}
+	if checkNotModified(w, r, versionETag(job.ID, job.Status), modified) {
+		return
+	}
+
+	result, err := selectFields(job.Result, fields)
+	if err != nil {
+		logger.Sugar.Errorw("Field selection error", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	// The selected result shadows the job's own
+	body := struct {
+		jobs.Job
+		Result interface{} `json:"result,omitempty"`
+	}{job, result}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger.Sugar.Errorw("JSON encoding error", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"web-page-analyzer/analyzer"
+	"web-page-analyzer/crawler"
+	"web-page-analyzer/logger"
+)
+
+// ndjsonContentType is the media type of newline-delimited JSON streams
+const ndjsonContentType = "application/x-ndjson"
+
+// ndjsonLine is one line of a stream: a page of a crawl with its analysis, an
+// analysis of a batch, or the report that closes the stream
+type ndjsonLine struct {
+	Page   *crawler.Page            `json:"page,omitempty"`
+	Result *analyzer.AnalysisResult `json:"result,omitempty"`
+	Report interface{}              `json:"report,omitempty"`
+}
+
+// wantsNDJSON reports whether the Accept header asks for newline-delimited JSON
+func wantsNDJSON(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err == nil && mediaType == ndjsonContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// ndjsonWriter writes lines to a response, flushing each so clients receive it
+// at once; it is safe for concurrent use
+type ndjsonWriter struct {
+	mu         sync.Mutex
+	encoder    *json.Encoder
+	controller *http.ResponseController
+}
+
+// newNDJSONWriter starts a newline-delimited JSON response
+func newNDJSONWriter(w http.ResponseWriter) *ndjsonWriter {
+	w.Header().Set("Content-Type", ndjsonContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	return &ndjsonWriter{encoder: json.NewEncoder(w), controller: http.NewResponseController(w)}
+}
+
+// write encodes line and flushes it; errors are logged, as the status is already sent
+func (n *ndjsonWriter) write(line ndjsonLine) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.encoder.Encode(line); err != nil {
+		logger.Sugar.Errorw("NDJSON encoding error", "error", err)
+		return
+	}
+	if err := n.controller.Flush(); err != nil {
+		logger.Sugar.Debugw("NDJSON flush failed", "error", err)
+	}
+}
+
+// result streams one analysis of a batch
+func (n *ndjsonWriter) result(result *analyzer.AnalysisResult) {
+	n.write(ndjsonLine{Result: result})
+}
+
+// page streams one page of a crawl
+func (n *ndjsonWriter) page(page crawler.Page) {
+	n.write(ndjsonLine{Page: &page, Result: page.Result})
+}
+
+// report ends the stream with the final report
+func (n *ndjsonWriter) report(report interface{}) {
+	n.write(ndjsonLine{Report: report})
+}
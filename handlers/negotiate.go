@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// negotiateContentType picks the offered media type the request's Accept header
+// prefers. Ties, a missing header and one accepting none of the offers fall
+// back to the first offer.
+func negotiateContentType(r *http.Request, offers ...string) string {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return offers[0]
+	}
+	best, bestQuality := offers[0], 0.0
+	for _, offer := range offers {
+		if quality := acceptQuality(accept, offer); quality > bestQuality {
+			best, bestQuality = offer, quality
+		}
+	}
+	return best
+}
+
+// acceptQuality returns the q value an Accept header gives to mediaType, taken
+// from its most specific matching range: the type itself, type/*, then */*
+func acceptQuality(accept, mediaType string) float64 {
+	mainType, _, _ := strings.Cut(mediaType, "/")
+	quality, specificity := 0.0, -1
+	for _, accepted := range strings.Split(accept, ",") {
+		acceptedType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		matched := -1
+		switch acceptedType {
+		case mediaType:
+			matched = 2
+		case mainType + "/*":
+			matched = 1
+		case "*/*":
+			matched = 0
+		}
+		if matched <= specificity {
+			continue
+		}
+		specificity, quality = matched, 1
+		if value, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				quality = parsed
+			}
+		}
+	}
+	return quality
+}
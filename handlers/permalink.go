@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"web-page-analyzer/history"
+	"web-page-analyzer/logger"
+)
+
+// permalinkPrefix is the path under which stored results are served
+const permalinkPrefix = "/r/"
+
+// permalinkTemplate renders a stored result as a read-only page; /analyze also
+// renders fresh results with it for clients asking for HTML
+var permalinkTemplate = template.Must(template.New("permalink").Parse(permalinkHTML))
+
+// permalinkData is the data passed to the permalink template; Record is nil when
+// the result was not found
+type permalinkData struct {
+	Lang     string
+	T        map[string]string
+	Subtitle string
+	Record   *history.Record
+}
+
+// snapshotSuffix follows a permalink to serve the HTML stored with the result
+const snapshotSuffix = "/snapshot"
+
+// PermalinkHandler serves a stored analysis result at /r/{id} as a read-only
+// page, and the HTML it was analyzed from at /r/{id}/snapshot
+func (s *Server) PermalinkHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.results == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, permalinkPrefix), snapshotSuffix); ok {
+		s.serveSnapshot(w, r, id)
+		return
+	}
+
+	lang := requestLanguage(r)
+	messages, _ := catalog(lang)
+	data := permalinkData{Lang: lang, T: messages, Subtitle: messages["shared_result"]}
+
+	statusCode := http.StatusOK
+	record, err := s.results.Get(strings.TrimPrefix(r.URL.Path, permalinkPrefix))
+	switch {
+	case errors.Is(err, history.ErrNotFound):
+		statusCode = http.StatusNotFound
+	case err != nil:
+		logger.Sugar.Errorw("Failed to load stored result", "path", r.URL.Path, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	default:
+		data.Record = record
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	w.Header().Set("Content-Language", lang)
+	w.Header().Set("Vary", "Accept-Language")
+	// Reanalysis replaces the result behind a permalink, so caches keep the page
+	// only briefly and then revalidate it against its ETag
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	// Each reanalysis makes a new version of the result, in every language
+	if record != nil && checkNotModified(w, r, versionETag(record.ID, record.ModifiedAt().UnixNano(), lang), record.ModifiedAt()) {
+		return
+	}
+	w.WriteHeader(statusCode)
+	if err := permalinkTemplate.Execute(w, data); err != nil {
+		logger.Sugar.Errorw("Template execution error", "error", err)
+	}
+}
+
+// serveSnapshot serves the HTML stored with a result as plain text, so the
+// markup is shown rather than rendered on our origin
+func (s *Server) serveSnapshot(w http.ResponseWriter, r *http.Request, id string) {
+	snapshot, err := s.results.Snapshot(id)
+	switch {
+	case errors.Is(err, history.ErrNotFound):
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		logger.Sugar.Errorw("Failed to load stored snapshot", "path", r.URL.Path, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	// Snapshots never change once stored
+	if checkNotModified(w, r, versionETag(id, "snapshot"), time.Time{}) {
+		return
+	}
+	w.Write(snapshot)
+}
+
+const permalinkHTML = `
+<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <meta name="robots" content="noindex">
+    <title>{{.Subtitle}} - {{.T.app_title}}</title>
+    <link rel="stylesheet" href="/static/css/styles.css">
+</head>
+<body>
+    <div class="container">
+        <div class="main-content">
+            <div class="header">
+                <h1 class="title">{{.T.app_title}}</h1>
+                <p class="subtitle">{{.Subtitle}}</p>
+            </div>
+
+            <div class="card">
+                {{- with .Record}}{{with .Result}}
+                <div class="results" role="region" aria-label="{{$.T.results_label}}">
+                    <h2 class="results-header">{{$.T.results_label}}</h2>
+
+                    <div class="result-item">
+                        <div class="result-label">{{$.T.field_url}}</div>
+                        <div class="result-value">{{.URL}}</div>
+                    </div>
+
+                    <div class="result-item">
+                        <div class="result-label">{{$.T.field_analyzed_at}}</div>
+                        <div class="result-value"><time datetime="{{$.Record.CreatedAt.Format "2006-01-02T15:04:05Z07:00"}}">{{$.Record.CreatedAt.Format "2006-01-02 15:04 MST"}}</time></div>
+                    </div>
+                    {{- if .Permalink}}
+
+                    <div class="result-item">
+                        <div class="result-label">{{$.T.field_permalink}}</div>
+                        <div class="result-value"><a href="{{.Permalink}}">{{.Permalink}}</a></div>
+                    </div>
+                    {{- end}}
+                    {{- if $.Record.SnapshotBytes}}
+
+                    <div class="result-item">
+                        <div class="result-label">{{$.T.field_snapshot}}</div>
+                        <div class="result-value"><a href="/r/{{$.Record.ID}}/snapshot">{{$.Record.SnapshotBytes}} B</a></div>
+                    </div>
+                    {{- end}}
+                    {{- if .StatusCode}}
+
+                    <div class="result-item">
+                        <div class="result-label">{{$.T.field_status_code}}</div>
+                        <div class="result-value">{{.StatusCode}}</div>
+                    </div>
+                    {{- end}}
+                    {{- if .Error}}
+
+                    <div class="result-item">
+                        <div class="result-label">{{$.T.field_error}}</div>
+                        <div class="result-value">{{.Error.Message}}</div>
+                    </div>
+                    {{- else}}
+
+                    <div class="result-item">
+                        <div class="result-label">{{$.T.field_html_version}}</div>
+                        <div class="result-value">{{or .HTMLVersion $.T.not_available}}</div>
+                    </div>
+
+                    <div class="result-item">
+                        <div class="result-label">{{$.T.field_page_title}}</div>
+                        <div class="result-value">{{or .PageTitle $.T.no_title}}</div>
+                    </div>
+
+                    <div class="result-item">
+                        <div class="result-label">{{$.T.field_headings}}</div>
+                        <div class="result-value">
+                            {{- if .HeadingCounts}}
+                            <ul class="headings-list">
+                                {{- range $level, $count := .HeadingCounts}}
+                                <li><strong>{{$level}}:</strong> {{$count}}</li>
+                                {{- end}}
+                            </ul>
+                            {{- else}}
+                            <em>{{$.T.no_headings}}</em>
+                            {{- end}}
+                        </div>
+                    </div>
+
+                    <div class="result-item">
+                        <div class="result-label">{{$.T.field_links}}</div>
+                        <div class="result-value">
+                            <strong>{{$.T.links_internal}}:</strong> {{.InternalLinks}}<br>
+                            <strong>{{$.T.links_external}}:</strong> {{.ExternalLinks}}<br>
+                            <strong>{{$.T.links_inaccessible}}:</strong> {{.InaccessibleLinks}}
+                        </div>
+                    </div>
+
+                    <div class="result-item">
+                        <div class="result-label">{{$.T.field_login_form}}</div>
+                        <div class="result-value">{{if .HasLoginForm}}{{$.T.yes}}{{else}}{{$.T.no}}{{end}}</div>
+                    </div>
+                    {{- end}}
+                </div>
+                {{- end}}{{else}}
+                <div class="error-state">
+                    <div class="error-icon">⚠️</div>
+                    <div class="error-message">{{.T.result_not_found}}</div>
+                </div>
+                {{- end}}
+
+                <p><a href="/" class="btn btn-primary">{{.T.analyze_another}}</a></p>
+            </div>
+        </div>
+    </div>
+</body>
+</html>`
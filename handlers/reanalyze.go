@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"web-page-analyzer/analyzer"
+	"web-page-analyzer/history"
+	"web-page-analyzer/logger"
+)
+
+// historyPrefix is the path under which stored results are managed
+const historyPrefix = "/history/"
+
+// reanalyzeSuffix follows a stored result's ID to reanalyze its snapshot
+const reanalyzeSuffix = "/reanalyze"
+
+// ReanalyzeHandler serves POST /history/{id}/reanalyze: it reruns the current
+// analysis over the HTML snapshot stored with a result, without fetching the
+// page again, and stores the new result in place of the old one. It accepts the
+// analysis options of /analyze.
+func (s *Server) ReanalyzeHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, historyPrefix), reanalyzeSuffix)
+	if s.results == nil || !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	opts, err := s.analysisOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	record, err := s.results.Get(id)
+	var snapshot []byte
+	var header http.Header
+	if err == nil {
+		snapshot, err = s.results.Snapshot(id)
+		if errors.Is(err, history.ErrNotFound) {
+			http.Error(w, "Result was stored without an HTML snapshot", http.StatusConflict)
+			return
+		}
+	}
+	if err == nil {
+		// Snapshots stored before headers were kept fall back to the result's headers
+		if header, err = s.results.SnapshotHeader(id); errors.Is(err, history.ErrNotFound) {
+			err = nil
+		}
+	}
+	switch {
+	case errors.Is(err, history.ErrNotFound):
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		logger.Sugar.Errorw("Failed to load stored result", "path", r.URL.Path, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// HTML that cannot be parsed leaves the stored result unchanged
+	result := s.analyzer.ReanalyzeSnapshot(r.Context(), record.Result, snapshot, header, opts)
+	statusCode := http.StatusOK
+	if result.Error != nil && result.Error.Code == analyzer.ErrCodeParseError {
+		statusCode = http.StatusUnprocessableEntity
+	} else {
+		if _, err := s.results.Replace(id, result); err != nil {
+			logger.Sugar.Errorw("Failed to store reanalyzed result", "id", id, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		result.ID = id
+		result.Permalink = permalinkPrefix + id
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		logger.Sugar.Errorw("JSON encoding error", "error", err)
+	}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"web-page-analyzer/analyzer"
+	"web-page-analyzer/logger"
+)
+
+// sseDoneEvent is the name of the last event of a progress stream, carrying the result
+const sseDoneEvent = "done"
+
+// sseWriter writes Server-Sent Events to a response, flushing each. It is safe
+// for concurrent use, and drops events once closed, since an analysis may keep
+// reporting after its request has gone away.
+type sseWriter struct {
+	mu         sync.Mutex
+	w          http.ResponseWriter
+	controller *http.ResponseController
+	closed     bool
+}
+
+// newSSEWriter starts an event stream
+func newSSEWriter(w http.ResponseWriter) *sseWriter {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	return &sseWriter{w: w, controller: http.NewResponseController(w)}
+}
+
+// send writes one event with data encoded as JSON
+func (s *sseWriter) send(event string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		logger.Sugar.Errorw("SSE encoding error", "event", event, "error", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		s.closed = true
+		return
+	}
+	if err := s.controller.Flush(); err != nil {
+		logger.Sugar.Debugw("SSE flush failed", "error", err)
+	}
+}
+
+// close drops any later events
+func (s *sseWriter) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+}
+
+// AnalyzeStreamHandler analyzes a page with the parameters of /analyze and
+// streams its progress as Server-Sent Events: fetched, parsed and links events
+// as the analysis advances, then a done event carrying the result. GET is
+// accepted so browsers can connect with EventSource.
+func (s *Server) AnalyzeStreamHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	url := r.FormValue("url")
+	if url == "" {
+		http.Error(w, "URL parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	opts, err := s.analysisOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fields, err := requestFields(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stream := newSSEWriter(w)
+	defer stream.close()
+
+	ctx := analyzer.WithProgress(r.Context(), func(progress analyzer.Progress) {
+		stream.send(progress.Stage, progress)
+	})
+	result, err := selectFields(s.storeResult(s.analyzer.AnalyzeURLWithOptions(ctx, url, opts)), fields)
+	if err != nil {
+		logger.Sugar.Errorw("Field selection error", "error", err)
+		return
+	}
+	stream.send(sseDoneEvent, result)
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"web-page-analyzer/analyzer"
+	"web-page-analyzer/logger"
+)
+
+// ValidateHandler serves POST /validate, a dry run reporting for each URL
+// whether it is valid and allowed, whether the cache would answer it, and the
+// requests analyzing it would cost, without fetching the pages. It takes the
+// /analyze parameters, with url repeated or urls listing many at once.
+func (s *Server) ValidateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	// URLs may be repeated form values or a single whitespace-separated list
+	urls := append([]string(nil), r.Form["url"]...)
+	for _, value := range r.Form["urls"] {
+		urls = append(urls, strings.Fields(value)...)
+	}
+	if len(urls) == 0 {
+		http.Error(w, "URL parameter is required", http.StatusBadRequest)
+		return
+	}
+	if len(urls) > analyzer.MaxDryRunURLs {
+		http.Error(w, fmt.Sprintf("At most %d URLs are allowed", analyzer.MaxDryRunURLs), http.StatusBadRequest)
+		return
+	}
+
+	opts, err := s.analysisOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report := s.analyzer.DryRunAll(r.Context(), urls, opts)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		logger.Sugar.Errorw("JSON encoding error", "error", err)
+	}
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"web-page-analyzer/analyzer"
+	"web-page-analyzer/logger"
+	"web-page-analyzer/middleware"
+)
+
+// WebSocket message types
+const (
+	wsAnalyze  = "analyze"
+	wsProgress = "progress"
+	wsResult   = "result"
+	wsError    = "error"
+)
+
+// WebSocket connection limits
+const (
+	wsIdleTimeout     = 5 * time.Minute // connections sending nothing for this long are closed
+	wsMaxMessageBytes = 64 << 10        // analyze messages carry a URL and a few parameters
+)
+
+// wsMessage is a message of the /ws protocol. Clients send analyze messages
+// with a URL and the parameters of /analyze; the server answers each with
+// progress messages and then a result, or an error. ID is echoed back so
+// clients can tell the answers to several requests apart.
+type wsMessage struct {
+	Type     string             `json:"type"`
+	ID       string             `json:"id,omitempty"`
+	URL      string             `json:"url,omitempty"`
+	Params   map[string]string  `json:"params,omitempty"`
+	Progress *analyzer.Progress `json:"progress,omitempty"`
+	Result   interface{}        `json:"result,omitempty"`
+	Error    string             `json:"error,omitempty"`
+}
+
+// WebSocketHandler serves /ws, a WebSocket on which the frontend pushes URLs to
+// analyze and receives updates as each analysis advances: the response status,
+// the title and heading counts, link-check progress and finally the result.
+// Analyses run one at a time per connection, and closing the connection
+// cancels the one running. Each analysis is checked by the memory guard, takes
+// a slot of the concurrency limiter and is charged to the API key like a
+// request to /analyze.
+func (s *Server) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	websocket.Server{Handshake: acceptAnyOrigin, Handler: s.serveWebSocket}.ServeHTTP(w, r)
+}
+
+// acceptAnyOrigin matches the CORS policy of the API, which is open to every
+// origin; unlike websocket.Handler it also accepts clients sending no Origin
+func acceptAnyOrigin(config *websocket.Config, r *http.Request) error {
+	origin, err := websocket.Origin(config, r)
+	config.Origin = origin
+	return err
+}
+
+// serveWebSocket reads messages until the connection closes, queueing one
+// analysis behind the running one and refusing others
+func (s *Server) serveWebSocket(conn *websocket.Conn) {
+	defer conn.Close()
+	conn.MaxPayloadBytes = wsMaxMessageBytes
+	// The server's write timeout still applies to the hijacked connection
+	conn.SetWriteDeadline(time.Time{})
+
+	ctx, cancel := context.WithCancel(conn.Request().Context())
+	defer cancel()
+
+	requests := make(chan wsMessage, 1)
+	go func() {
+		defer close(requests)
+		for {
+			conn.SetReadDeadline(time.Now().Add(wsIdleTimeout))
+			var data []byte
+			if err := websocket.Message.Receive(conn, &data); err != nil {
+				// A closed connection cancels the running analysis
+				cancel()
+				return
+			}
+			var message wsMessage
+			if err := json.Unmarshal(data, &message); err != nil {
+				s.sendWebSocket(conn, wsMessage{Type: wsError, Error: "Invalid message: expected a JSON object"})
+				continue
+			}
+			if message.Type != wsAnalyze {
+				s.sendWebSocket(conn, wsMessage{Type: wsError, ID: message.ID, Error: "Unknown message type, expected analyze"})
+				continue
+			}
+			select {
+			case requests <- message:
+			default:
+				s.sendWebSocket(conn, wsMessage{Type: wsError, ID: message.ID, URL: message.URL, Error: "An analysis is already queued on this connection"})
+			}
+		}
+	}()
+
+	for message := range requests {
+		if ctx.Err() != nil {
+			return
+		}
+		s.analyzeWebSocket(ctx, conn, message)
+	}
+}
+
+// analyzeWebSocket runs the analysis an analyze message asks for, sending its
+// progress and result
+func (s *Server) analyzeWebSocket(ctx context.Context, conn *websocket.Conn, message wsMessage) {
+	reply := wsMessage{ID: message.ID, URL: message.URL}
+	fail := func(err string) {
+		reply.Type, reply.Error = wsError, err
+		s.sendWebSocket(conn, reply)
+	}
+
+	if message.URL == "" {
+		fail("URL parameter is required")
+		return
+	}
+
+	// Memory pressure is checked again for each analysis, since a connection
+	// outlives the pressure it was opened under
+	ctx, done, ok := s.memory.Admit(ctx)
+	if !ok {
+		fail("The analyzer is low on memory; retry shortly")
+		return
+	}
+	defer done()
+
+	// Parameters are read exactly as /analyze reads its form, with the
+	// connection's context so shed link checks are honored
+	form := url.Values{}
+	for name, value := range message.Params {
+		form.Set(name, value)
+	}
+	params := (&http.Request{Form: form}).WithContext(ctx)
+	opts, err := s.analysisOptions(params)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	fields, err := requestFields(params)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+
+	// Each analysis is admitted like a request to /analyze: it takes a
+	// limiter slot, then is charged to the key's rate limit and quota
+	release, ok := s.limiter.Acquire(ctx, message.Params["priority"] == "batch")
+	if !ok {
+		fail("The analyzer is at capacity; retry shortly")
+		return
+	}
+	defer release()
+	if config, ok := middleware.APIKeyFromContext(ctx); ok {
+		if status, refusal := s.apiKeys.Charge(config, http.Header{}); status != 0 {
+			fail(refusal)
+			return
+		}
+		ctx = s.chargeEgress(ctx, config)
+	}
+
+	ctx = analyzer.WithProgress(ctx, func(progress analyzer.Progress) {
+		update := reply
+		update.Type, update.Progress = wsProgress, &progress
+		s.sendWebSocket(conn, update)
+	})
+	result, err := selectFields(s.storeResult(s.analyzer.AnalyzeURLWithOptions(ctx, message.URL, opts)), fields)
+	if err != nil {
+		logger.Sugar.Errorw("Field selection error", "error", err)
+		fail("Internal Server Error")
+		return
+	}
+	reply.Type, reply.Result = wsResult, result
+	s.sendWebSocket(conn, reply)
+}
+
+// sendWebSocket writes a message; websocket.JSON serializes concurrent sends
+func (s *Server) sendWebSocket(conn *websocket.Conn, message wsMessage) {
+	if err := websocket.JSON.Send(conn, message); err != nil {
+		logger.Sugar.Debugw("WebSocket send failed", "type", message.Type, "error", err)
+	}
+}
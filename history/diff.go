@@ -0,0 +1,22 @@
+package history
+
+import (
+	"web-page-analyzer/analyzer"
+)
+
+// Diff compares two stored results, listing every compared value, changed or
+// not, so they can be shown side by side
+type Diff struct {
+	Before Entry `json:"before"`
+	After  Entry `json:"after"`
+	analyzer.ResultDiff
+}
+
+// Compare diffs two stored results
+func Compare(before, after *Record) *Diff {
+	return &Diff{
+		Before:     before.Entry,
+		After:      after.Entry,
+		ResultDiff: analyzer.DiffResults(before.Result, after.Result),
+	}
+}
@@ -0,0 +1,501 @@
+// Package history stores completed analysis results so they can be shared,
+// browsed and compared after the request that produced them has finished.
+package history
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"web-page-analyzer/analyzer"
+	"web-page-analyzer/logger"
+)
+
+// DefaultMaxRecords is how many results are kept before the oldest are pruned
+const DefaultMaxRecords = 10000
+
+// MaxPendingWrites is how many saves may wait for the background writer before
+// Save waits for it to catch up
+const MaxPendingWrites = 1000
+
+// idBytes is the number of random bytes in a record ID; IDs are hex encoded
+const idBytes = 8
+
+// ErrNotFound is returned when no record exists for an ID
+var ErrNotFound = errors.New("result not found")
+
+// Entry summarizes a stored result so listings do not need to load every file
+type Entry struct {
+	ID                string    `json:"id"`
+	URL               string    `json:"url"`
+	CreatedAt         time.Time `json:"created_at"`
+	PageTitle         string    `json:"page_title,omitempty"`
+	StatusCode        int       `json:"status_code,omitempty"`
+	DurationMs        int64     `json:"analysis_duration_ms"`
+	InternalLinks     int       `json:"internal_links"`
+	ExternalLinks     int       `json:"external_links"`
+	InaccessibleLinks int       `json:"inaccessible_links"`
+	ErrorCode         string    `json:"error_code,omitempty"`
+	SnapshotBytes     int       `json:"snapshot_bytes,omitempty"` // size of the stored HTML, zero without a snapshot
+	SnapshotTruncated bool      `json:"snapshot_truncated,omitempty"`
+	// ReanalyzedAt is when the result was last replaced by a reanalysis of its snapshot
+	ReanalyzedAt *time.Time `json:"reanalyzed_at,omitempty"`
+}
+
+// ModifiedAt returns when the stored result last changed
+func (e Entry) ModifiedAt() time.Time {
+	if e.ReanalyzedAt != nil {
+		return *e.ReanalyzedAt
+	}
+	return e.CreatedAt
+}
+
+// Record is a stored result together with its summary
+type Record struct {
+	Entry
+	Result *analyzer.AnalysisResult `json:"result"`
+}
+
+// Store keeps one JSON file per result in a directory and an in-memory index of
+// their summaries, oldest first. HTML snapshots are kept gzipped beside them,
+// together with the response headers they were served with. Files are written
+// by a background writer, in order; until then records are served from memory.
+type Store struct {
+	mu         sync.RWMutex
+	dir        string
+	maxRecords int
+	entries    []Entry
+
+	// pending holds the latest unwritten version of each record, queue the
+	// writes and removals for the writer, and changed is signalled whenever
+	// either shrinks. All are guarded by mu.
+	pending map[string]*pendingWrite
+	queue   []fileOp
+	busy    bool
+	changed *sync.Cond
+}
+
+// pendingWrite is a record, and its snapshot and headers when it has them, not
+// yet written to disk
+type pendingWrite struct {
+	id     string
+	data   []byte // record JSON
+	html   []byte // uncompressed snapshot, nil without one
+	header []byte // snapshot headers JSON, nil without them
+}
+
+// fileOp is one job of the writer: writing a record, or removing a pruned one
+type fileOp struct {
+	write  *pendingWrite
+	remove string
+}
+
+// Open creates dir if needed and indexes the results already stored in it.
+// maxRecords <= 0 uses DefaultMaxRecords.
+func Open(dir string, maxRecords int) (*Store, error) {
+	if maxRecords <= 0 {
+		maxRecords = DefaultMaxRecords
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	store := &Store{dir: dir, maxRecords: maxRecords, pending: make(map[string]*pendingWrite)}
+	store.changed = sync.NewCond(&store.mu)
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var record Record
+		if err := json.Unmarshal(data, &record); err != nil || !validID(record.ID) {
+			// Skip files we did not write rather than refusing to start
+			continue
+		}
+		store.entries = append(store.entries, record.Entry)
+	}
+	sort.SliceStable(store.entries, func(i, j int) bool {
+		return store.entries[i].CreatedAt.Before(store.entries[j].CreatedAt)
+	})
+	store.prune()
+	go store.write()
+	return store, nil
+}
+
+// Save stores a copy of result under a new ID and returns its summary. The
+// caller's result is not modified, since fresh results are shared with the cache.
+// The record can be read at once; its files are written in the background.
+func (s *Store) Save(result *analyzer.AnalysisResult) (Entry, error) {
+	id, err := newID()
+	if err != nil {
+		return Entry{}, err
+	}
+
+	stored := *result
+	stored.ID = id
+	stored.Permalink = ""
+	stored.Snapshot = nil
+	record := Record{Entry: summarize(id, &stored), Result: &stored}
+	if result.Snapshot != nil {
+		record.SnapshotBytes = len(result.Snapshot.HTML)
+		record.SnapshotTruncated = result.Snapshot.Truncated
+	}
+	write := &pendingWrite{id: id}
+	if write.data, err = json.Marshal(record); err != nil {
+		return Entry{}, err
+	}
+	if result.Snapshot != nil {
+		write.html = result.Snapshot.HTML
+		if result.Snapshot.Header != nil {
+			if write.header, err = json.Marshal(result.Snapshot.Header); err != nil {
+				return Entry{}, err
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, record.Entry)
+	s.enqueue(write)
+	s.prune()
+	return record.Entry, nil
+}
+
+// Get loads the record stored under id
+func (s *Store) Get(id string) (*Record, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var data []byte
+	var err error
+	if write, ok := s.pending[id]; ok {
+		data = write.data
+	} else if data, err = os.ReadFile(s.path(id)); os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	var record Record
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// Replace stores result in place of the record under id, as after reanalyzing
+// its snapshot, and returns the updated summary. The ID, creation time and
+// snapshot of the record are kept.
+func (s *Store) Replace(id string, result *analyzer.AnalysisResult) (Entry, error) {
+	if !validID(id) {
+		return Entry{}, ErrNotFound
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := -1
+	for i := range s.entries {
+		if s.entries[i].ID == id {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return Entry{}, ErrNotFound
+	}
+	previous := s.entries[index]
+
+	stored := *result
+	stored.ID = id
+	stored.Permalink = ""
+	stored.Snapshot = nil
+	record := Record{Entry: summarize(id, &stored), Result: &stored}
+	record.CreatedAt = previous.CreatedAt
+	record.SnapshotBytes = previous.SnapshotBytes
+	record.SnapshotTruncated = previous.SnapshotTruncated
+	now := time.Now().UTC()
+	record.ReanalyzedAt = &now
+	data, err := json.Marshal(record)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	// A record still waiting for the writer keeps its snapshot
+	write := &pendingWrite{id: id, data: data}
+	if previous, ok := s.pending[id]; ok {
+		write.html, write.header = previous.html, previous.header
+	}
+	s.enqueue(write)
+	s.entries[index] = record.Entry
+	return record.Entry, nil
+}
+
+// Snapshot loads the HTML stored with the record under id, returning
+// ErrNotFound when there is no such record or it was stored without HTML
+func (s *Store) Snapshot(id string) ([]byte, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if write, ok := s.pending[id]; ok && write.html != nil {
+		return write.html, nil
+	}
+	file, err := os.Open(s.snapshotPath(id))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(reader)
+}
+
+// SnapshotHeader loads the response headers stored with the snapshot of the
+// record under id, returning ErrNotFound when none were stored, as for
+// snapshots stored before headers were kept
+func (s *Store) SnapshotHeader(id string) (http.Header, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var data []byte
+	var err error
+	if write, ok := s.pending[id]; ok && write.header != nil {
+		data = write.header
+	} else if data, err = os.ReadFile(s.headerPath(id)); os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	var header http.Header
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// List returns stored summaries, newest first, optionally filtered by URL.
+// limit <= 0 returns every match.
+func (s *Store) List(url string, limit int) []Entry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	matches := []Entry{}
+	for i := len(s.entries) - 1; i >= 0; i-- {
+		entry := s.entries[i]
+		if url != "" && entry.URL != url {
+			continue
+		}
+		matches = append(matches, entry)
+		if limit > 0 && len(matches) == limit {
+			break
+		}
+	}
+	return matches
+}
+
+// Len returns the number of stored results
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.entries)
+}
+
+// prune drops the oldest records beyond maxRecords from the index and queues
+// the removal of their files; the caller must hold the write lock or own the
+// store exclusively
+func (s *Store) prune() {
+	excess := len(s.entries) - s.maxRecords
+	if excess <= 0 {
+		return
+	}
+	for _, entry := range s.entries[:excess] {
+		delete(s.pending, entry.ID)
+		s.queue = append(s.queue, fileOp{remove: entry.ID})
+	}
+	s.entries = append([]Entry(nil), s.entries[excess:]...)
+	s.changed.Broadcast()
+}
+
+// enqueue makes write the latest version of its record and queues it for the
+// writer, first waiting while MaxPendingWrites are queued; the caller must
+// hold the write lock
+func (s *Store) enqueue(write *pendingWrite) {
+	for len(s.queue) >= MaxPendingWrites {
+		s.changed.Wait()
+	}
+	s.pending[write.id] = write
+	s.queue = append(s.queue, fileOp{write: write})
+	s.changed.Broadcast()
+}
+
+// Flush waits until every queued write and removal has reached the disk
+func (s *Store) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.queue) > 0 || s.busy {
+		s.changed.Wait()
+	}
+}
+
+// write runs the queued file operations in order, for as long as the store exists
+func (s *Store) write() {
+	log := logger.WithComponent("history")
+	s.mu.Lock()
+	for {
+		for len(s.queue) == 0 {
+			s.changed.Wait()
+		}
+		op := s.queue[0]
+		s.queue = s.queue[1:]
+		// Versions replaced or pruned since they were queued are skipped
+		current := op.write != nil && s.pending[op.write.id] == op.write
+		s.busy = true
+		s.mu.Unlock()
+
+		var err error
+		switch {
+		case current:
+			err = s.writeRecord(op.write)
+		case op.remove != "":
+			err = s.removeRecord(op.remove)
+		}
+		if err != nil {
+			log.Errorw("Failed to write stored result", "error", err)
+		}
+
+		s.mu.Lock()
+		if current && s.pending[op.write.id] == op.write {
+			delete(s.pending, op.write.id)
+		}
+		s.busy = false
+		s.changed.Broadcast()
+	}
+}
+
+// writeRecord writes the files of a record. The snapshot is written first, so
+// a record never points at a missing one.
+func (s *Store) writeRecord(write *pendingWrite) error {
+	if write.header != nil {
+		if err := writeFile(s.headerPath(write.id), write.header); err != nil {
+			return err
+		}
+	}
+	if write.html != nil {
+		var compressed bytes.Buffer
+		writer := gzip.NewWriter(&compressed)
+		if _, err := writer.Write(write.html); err != nil {
+			return err
+		}
+		if err := writer.Close(); err != nil {
+			return err
+		}
+		if err := writeFile(s.snapshotPath(write.id), compressed.Bytes()); err != nil {
+			return err
+		}
+	}
+	return writeFile(s.path(write.id), write.data)
+}
+
+// removeRecord deletes the files of a pruned record
+func (s *Store) removeRecord(id string) error {
+	for _, path := range []string{s.path(id), s.snapshotPath(id), s.headerPath(id)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *Store) snapshotPath(id string) string {
+	return filepath.Join(s.dir, id+".html.gz")
+}
+
+// headerPath is not a .json file, so Open does not take it for a record
+func (s *Store) headerPath(id string) string {
+	return filepath.Join(s.dir, id+".headers")
+}
+
+// writeFile writes to a temporary file first so a crash never leaves a truncated file
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// summarize builds the index entry for a result, keying it by the normalized URL
+// so that equivalent spellings of a URL share one history
+func summarize(id string, result *analyzer.AnalysisResult) Entry {
+	url := result.NormalizedURL
+	if url == "" {
+		url = result.URL
+	}
+	entry := Entry{
+		ID:                id,
+		URL:               url,
+		CreatedAt:         time.Now().UTC(),
+		PageTitle:         result.PageTitle,
+		StatusCode:        result.StatusCode,
+		DurationMs:        result.AnalysisDurationMs,
+		InternalLinks:     result.InternalLinks,
+		ExternalLinks:     result.ExternalLinks,
+		InaccessibleLinks: result.InaccessibleLinks,
+	}
+	if result.Error != nil {
+		entry.ErrorCode = result.Error.Code
+	}
+	return entry
+}
+
+func newID() (string, error) {
+	buf := make([]byte, idBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// validID reports whether id has the shape newID produces, which also keeps
+// user-supplied IDs from escaping the store directory
+func validID(id string) bool {
+	if len(id) != idBytes*2 {
+		return false
+	}
+	return strings.Trim(id, "0123456789abcdef") == ""
+}
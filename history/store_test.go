@@ -0,0 +1,226 @@
+package history
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"web-page-analyzer/analyzer"
+)
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(dir, 2)
+	if err != nil {
+		t.Fatalf("Expected store to open, got %v", err)
+	}
+
+	original := &analyzer.AnalysisResult{URL: "https://example.com", PageTitle: "First", InternalLinks: 3}
+	first, err := store.Save(original)
+	if err != nil {
+		t.Fatalf("Expected save to succeed, got %v", err)
+	}
+	if !validID(first.ID) {
+		t.Errorf("Expected a valid ID, got %q", first.ID)
+	}
+	if original.ID != "" {
+		t.Errorf("Expected the caller's result to be left unmodified, got ID %q", original.ID)
+	}
+
+	record, err := store.Get(first.ID)
+	if err != nil {
+		t.Fatalf("Expected stored record, got %v", err)
+	}
+	if record.Result.PageTitle != "First" || record.Result.ID != first.ID || record.InternalLinks != 3 {
+		t.Errorf("Expected stored result to round-trip, got %+v", record)
+	}
+
+	second, _ := store.Save(&analyzer.AnalysisResult{URL: "https://example.com/other", PageTitle: "Second"})
+	third, _ := store.Save(&analyzer.AnalysisResult{
+		URL:           "https://EXAMPLE.com",
+		NormalizedURL: "https://example.com",
+		Error:         &analyzer.AnalysisError{Code: analyzer.ErrCodeTimeoutError},
+	})
+
+	// The oldest record is pruned once the store holds more than two
+	if _, err := store.Get(first.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected oldest record to be pruned, got %v", err)
+	}
+	if store.Len() != 2 {
+		t.Errorf("Expected 2 records, got %d", store.Len())
+	}
+
+	entries := store.List("", 0)
+	if len(entries) != 2 || entries[0].ID != third.ID || entries[1].ID != second.ID {
+		t.Errorf("Expected newest first, got %+v", entries)
+	}
+	if matches := store.List("https://example.com", 0); len(matches) != 1 || matches[0].ErrorCode != analyzer.ErrCodeTimeoutError {
+		t.Errorf("Expected one match keyed by normalized URL, got %+v", matches)
+	}
+	if limited := store.List("", 1); len(limited) != 1 {
+		t.Errorf("Expected limit to apply, got %d entries", len(limited))
+	}
+
+	// Records survive reopening the directory once written
+	store.Flush()
+	reopened, err := Open(dir, 2)
+	if err != nil {
+		t.Fatalf("Expected store to reopen, got %v", err)
+	}
+	if reopened.Len() != 2 {
+		t.Errorf("Expected 2 records after reopening, got %d", reopened.Len())
+	}
+	if _, err := reopened.Get(second.ID); err != nil {
+		t.Errorf("Expected record after reopening, got %v", err)
+	}
+
+	for _, id := range []string{"", "../etc/passwd", "ZZZZZZZZZZZZZZZZ", "0123456789abcdef"} {
+		if _, err := store.Get(id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound for %q, got %v", id, err)
+		}
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(dir, 1)
+	if err != nil {
+		t.Fatalf("Expected store to open, got %v", err)
+	}
+
+	html := []byte("<html><head><title>Snapshot</title></head></html>")
+	entry, err := store.Save(&analyzer.AnalysisResult{
+		URL:      "https://example.com",
+		Snapshot: &analyzer.HTMLSnapshot{HTML: html, Header: http.Header{"X-Robots-Tag": {"noindex"}}, Truncated: true},
+	})
+	if err != nil {
+		t.Fatalf("Expected save to succeed, got %v", err)
+	}
+	if entry.SnapshotBytes != len(html) || !entry.SnapshotTruncated {
+		t.Errorf("Expected the snapshot to be summarized, got %+v", entry)
+	}
+	if stored, err := store.Snapshot(entry.ID); err != nil || string(stored) != string(html) {
+		t.Errorf("Expected the snapshot to round-trip, got %q and %v", stored, err)
+	}
+	if header, err := store.SnapshotHeader(entry.ID); err != nil || header.Get("X-Robots-Tag") != "noindex" {
+		t.Errorf("Expected the snapshot headers to round-trip, got %v and %v", header, err)
+	}
+
+	// Results stored without HTML have no snapshot, and pruning removes it
+	plain, _ := store.Save(&analyzer.AnalysisResult{URL: "https://example.com/plain"})
+	if _, err := store.Snapshot(plain.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected no snapshot, got %v", err)
+	}
+	if _, err := store.SnapshotHeader(plain.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected no snapshot headers, got %v", err)
+	}
+	store.Flush()
+	if _, err := os.Stat(filepath.Join(dir, plain.ID+".json")); err != nil {
+		t.Errorf("Expected the record to be written, got %v", err)
+	}
+	for _, name := range []string{entry.ID + ".html.gz", entry.ID + ".headers"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected the pruned %s to be removed, got %v", name, err)
+		}
+	}
+}
+
+func TestReplace(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(dir, 10)
+	if err != nil {
+		t.Fatalf("Expected store to open, got %v", err)
+	}
+
+	html := []byte("<html><head><title>Snapshot</title></head></html>")
+	entry, err := store.Save(&analyzer.AnalysisResult{
+		URL:       "https://example.com",
+		PageTitle: "Old",
+		Snapshot:  &analyzer.HTMLSnapshot{HTML: html},
+	})
+	if err != nil {
+		t.Fatalf("Expected save to succeed, got %v", err)
+	}
+
+	replaced, err := store.Replace(entry.ID, &analyzer.AnalysisResult{URL: "https://example.com", PageTitle: "Snapshot"})
+	if err != nil {
+		t.Fatalf("Expected replace to succeed, got %v", err)
+	}
+	if replaced.ID != entry.ID || !replaced.CreatedAt.Equal(entry.CreatedAt) || replaced.SnapshotBytes != len(html) {
+		t.Errorf("Expected the ID, creation time and snapshot to be kept, got %+v", replaced)
+	}
+	if replaced.ReanalyzedAt == nil || !replaced.ModifiedAt().Equal(*replaced.ReanalyzedAt) {
+		t.Errorf("Expected the reanalysis time to be recorded, got %+v", replaced)
+	}
+	if record, err := store.Get(entry.ID); err != nil || record.Result.PageTitle != "Snapshot" || record.Result.ID != entry.ID {
+		t.Errorf("Expected the replaced result to be stored, got %+v and %v", record, err)
+	}
+	if entries := store.List("", 0); len(entries) != 1 || entries[0].PageTitle != "Snapshot" {
+		t.Errorf("Expected the index to be updated in place, got %+v", entries)
+	}
+	if stored, err := store.Snapshot(entry.ID); err != nil || string(stored) != string(html) {
+		t.Errorf("Expected the snapshot to be kept, got %q and %v", stored, err)
+	}
+
+	// The replacement survives reopening the store
+	store.Flush()
+	reopened, err := Open(dir, 10)
+	if err != nil {
+		t.Fatalf("Expected store to reopen, got %v", err)
+	}
+	if entries := reopened.List("", 0); len(entries) != 1 || entries[0].ReanalyzedAt == nil {
+		t.Errorf("Expected the reanalyzed entry after reopening, got %+v", entries)
+	}
+
+	if _, err := store.Replace("0123456789abcdef", &analyzer.AnalysisResult{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an unknown ID, got %v", err)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	before := &Record{Entry: Entry{ID: "a"}, Result: &analyzer.AnalysisResult{
+		URL:           "https://example.com",
+		PageTitle:     "Old",
+		InternalLinks: 2,
+		HeadingCounts: map[string]int{"h1": 1, "h2": 2},
+		Links:         []string{"https://example.com/a", "https://example.com/b"},
+	}}
+	after := &Record{Entry: Entry{ID: "b"}, Result: &analyzer.AnalysisResult{
+		URL:           "https://example.com",
+		PageTitle:     "New",
+		InternalLinks: 2,
+		HeadingCounts: map[string]int{"h1": 1, "h3": 1},
+		Links:         []string{"https://example.com/b", "https://example.com/c"},
+	}}
+
+	diff := Compare(before, after)
+	changed := map[string]bool{}
+	for _, field := range append(diff.Fields, diff.Headings...) {
+		if field.Changed {
+			changed[field.Field] = true
+		}
+	}
+	for _, field := range []string{"page_title", "h2", "h3"} {
+		if !changed[field] {
+			t.Errorf("Expected %s to be changed", field)
+		}
+	}
+	if changed["internal_links"] || changed["h1"] {
+		t.Error("Expected unchanged fields not to be flagged")
+	}
+	if !diff.LinksCompared || len(diff.LinksAdded) != 1 || diff.LinksAdded[0] != "https://example.com/c" ||
+		len(diff.LinksRemoved) != 1 || diff.LinksRemoved[0] != "https://example.com/a" {
+		t.Errorf("Expected one link added and one removed, got %+v", diff)
+	}
+	if diff.Changes() != 5 {
+		t.Errorf("Expected 5 changes, got %d", diff.Changes())
+	}
+
+	// Links are only compared when both results collected them
+	after.Result.Links = nil
+	if diff := Compare(before, after); diff.LinksCompared {
+		t.Error("Expected links not to be compared without collected links")
+	}
+}
@@ -0,0 +1,169 @@
+// Package jobs runs analyses in the background, so clients can submit a page
+// that takes long to analyze and poll for its result instead of holding a
+// request open until it finishes.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"web-page-analyzer/analyzer"
+	"web-page-analyzer/logger"
+)
+
+// Job defaults and limits
+const (
+	DefaultWorkers = 4               // analyses run at once
+	MaxQueued      = 100             // submitted jobs waiting for a worker
+	JobTimeout     = 5 * time.Minute // an analysis is cancelled after this long
+	MaxJobs        = 1000            // finished jobs kept in memory, oldest dropped first
+)
+
+// Job statuses
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// ErrQueueFull is returned when MaxQueued jobs are already waiting
+var ErrQueueFull = errors.New("job queue is full")
+
+// Job is one background analysis; Result is set once it has finished
+type Job struct {
+	ID         string    `json:"id"`
+	URL        string    `json:"url"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	StartedAt  time.Time `json:"started_at,omitempty"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+	// Result is the analysis, including a failed one, once the job has finished
+	Result *analyzer.AnalysisResult `json:"result,omitempty"`
+
+	options analyzer.AnalysisOptions
+	ctx     context.Context // values of the submitting request, such as its API key
+}
+
+// Manager queues jobs and runs them on a fixed number of workers, keeping
+// their results in memory
+type Manager struct {
+	client analyzer.Client
+	queue  chan *Job
+
+	mu    sync.RWMutex
+	jobs  map[string]*Job
+	order []string // job IDs, oldest first
+}
+
+// New creates a manager analyzing pages with client on workers goroutines
+func New(client analyzer.Client, workers int) *Manager {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	m := &Manager{
+		client: client,
+		queue:  make(chan *Job, MaxQueued),
+		jobs:   make(map[string]*Job),
+	}
+	for i := 0; i < workers; i++ {
+		go m.work()
+	}
+	return m
+}
+
+// Submit queues an analysis of targetURL and returns the new job. The analysis
+// keeps the values of ctx but not its cancellation, so it outlives the request.
+func (m *Manager) Submit(ctx context.Context, targetURL string, opts analyzer.AnalysisOptions) (Job, error) {
+	id, err := newID()
+	if err != nil {
+		return Job{}, err
+	}
+	job := &Job{ID: id, URL: targetURL, Status: StatusQueued, CreatedAt: time.Now().UTC(), options: opts, ctx: context.WithoutCancel(ctx)}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	select {
+	case m.queue <- job:
+	default:
+		return Job{}, ErrQueueFull
+	}
+	m.jobs[id] = job
+	m.order = append(m.order, id)
+	m.prune()
+	return *job, nil
+}
+
+// Get returns a copy of a job
+func (m *Manager) Get(id string) (Job, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// prune drops the oldest finished jobs beyond MaxJobs; the caller must hold the write lock
+func (m *Manager) prune() {
+	for i := 0; len(m.order) > MaxJobs && i < len(m.order); {
+		id := m.order[i]
+		if status := m.jobs[id].Status; status == StatusQueued || status == StatusRunning {
+			i++
+			continue
+		}
+		delete(m.jobs, id)
+		m.order = append(m.order[:i], m.order[i+1:]...)
+	}
+}
+
+// work runs queued jobs one at a time
+func (m *Manager) work() {
+	for job := range m.queue {
+		m.run(job)
+	}
+}
+
+// run analyzes the page of a job and records the result
+func (m *Manager) run(job *Job) {
+	m.mu.Lock()
+	job.Status = StatusRunning
+	job.StartedAt = time.Now().UTC()
+	m.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(job.ctx, JobTimeout)
+	defer cancel()
+	result := m.client.AnalyzeURLWithOptions(ctx, job.URL, job.options)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job.Result = result
+	job.FinishedAt = time.Now().UTC()
+	job.Status = StatusCompleted
+	if result.Error != nil {
+		job.Status = StatusFailed
+		job.Error = result.Error.Message
+	}
+
+	logger.WithComponent("jobs").Infow("Job finished",
+		"id", job.ID,
+		"url", job.URL,
+		"status", job.Status,
+		"duration", job.FinishedAt.Sub(job.StartedAt),
+	)
+}
+
+// newID returns a random job ID
+func newID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
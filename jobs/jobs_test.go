@@ -0,0 +1,89 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"web-page-analyzer/analyzer"
+)
+
+// waitFor polls a job until it finishes
+func waitFor(t *testing.T, m *Manager, id string) Job {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, ok := m.Get(id)
+		if !ok {
+			t.Fatalf("Expected job %s to exist", id)
+		}
+		if job.Status == StatusCompleted || job.Status == StatusFailed {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Job %s did not finish", id)
+	return Job{}
+}
+
+func TestJobs(t *testing.T) {
+	client := analyzer.NewMockClient()
+	client.SetResult("https://example.com", &analyzer.AnalysisResult{PageTitle: "Example"})
+	m := New(client, 2)
+
+	job, err := m.Submit(context.Background(), "https://example.com", analyzer.AnalysisOptions{QuickCheck: true})
+	if err != nil {
+		t.Fatalf("Expected the job to be queued, got %v", err)
+	}
+	if job.ID == "" || job.Status != StatusQueued || job.Result != nil {
+		t.Errorf("Expected a queued job without a result, got %+v", job)
+	}
+
+	job = waitFor(t, m, job.ID)
+	if job.Status != StatusCompleted || job.Result == nil || job.Result.PageTitle != "Example" {
+		t.Errorf("Expected a completed job with its result, got %+v", job)
+	}
+	if job.StartedAt.IsZero() || job.FinishedAt.Before(job.StartedAt) {
+		t.Errorf("Expected start and finish times, got %v and %v", job.StartedAt, job.FinishedAt)
+	}
+	if calls := client.Calls(); len(calls) != 1 || !calls[0].Options.QuickCheck {
+		t.Errorf("Expected one quick analysis, got %+v", calls)
+	}
+
+	// The mock reports unknown URLs as 404, which fails the job but keeps the result
+	failed, _ := m.Submit(context.Background(), "https://missing.example", analyzer.AnalysisOptions{})
+	failed = waitFor(t, m, failed.ID)
+	if failed.Status != StatusFailed || failed.Error == "" || failed.Result == nil || failed.Result.Error == nil {
+		t.Errorf("Expected a failed job with the failed result, got %+v", failed)
+	}
+
+	if _, ok := m.Get("missing"); ok {
+		t.Error("Expected unknown job IDs not to be found")
+	}
+}
+
+func TestJobsQueueFull(t *testing.T) {
+	release := make(chan struct{})
+	client := analyzer.NewMockClient()
+	client.AnalyzeFunc = func(ctx context.Context, targetURL string, opts analyzer.AnalysisOptions) *analyzer.AnalysisResult {
+		<-release
+		return &analyzer.AnalysisResult{URL: targetURL}
+	}
+	defer close(release)
+	m := New(client, 1)
+
+	// One job runs and MaxQueued wait; the next is refused
+	var err error
+	for i := 0; i <= MaxQueued+1 && err == nil; i++ {
+		_, err = m.Submit(context.Background(), "https://example.com", analyzer.AnalysisOptions{})
+		if i == 0 {
+			// Let the worker take the first job off the queue
+			deadline := time.Now().Add(5 * time.Second)
+			for len(m.queue) > 0 && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}
+	if err != ErrQueueFull {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/signal"
 	"runtime"
+	"strings"
 	"syscall"
 	"time"
 
@@ -15,6 +16,7 @@ import (
 	"web-page-analyzer/handlers"
 	"web-page-analyzer/logger"
 	"web-page-analyzer/middleware"
+	"web-page-analyzer/tracing"
 )
 
 var startTime = time.Now()
@@ -24,6 +26,9 @@ func main() {
 	logger.Init()
 	defer logger.Sync()
 
+	// Export analysis spans when an OTLP endpoint is configured
+	tracing.Init()
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
@@ -31,6 +36,41 @@ func main() {
 
 	server := handlers.NewServer()
 
+	// Run scheduled analyses configured via SCHEDULES_FILE
+	server.Scheduler().Start()
+
+	// Metered API endpoints require an API key when API_KEYS is configured
+	// and are bounded by the memory guard and the global analysis concurrency limiter.
+	// The key is charged only once the request is admitted, so requests shed or
+	// refused at capacity use none of its rate limit or quota.
+	metered := func(limit func(http.Handler) http.Handler, handler http.HandlerFunc) http.Handler {
+		return server.APIKeys().Authenticate(server.MemoryGuard().Shed(limit(server.Metered(handler))))
+	}
+	unlimited := func(next http.Handler) http.Handler { return next }
+	analyzeHandler := metered(server.Limiter().Limit, server.AnalyzeHandler)
+	duplicatesHandler := metered(server.Limiter().LimitBatch, server.DuplicatesHandler)
+	hreflangHandler := metered(server.Limiter().LimitBatch, server.HreflangHandler)
+	analyzeStreamHandler := metered(server.Limiter().Limit, server.AnalyzeStreamHandler)
+	// Async analyses and crawls return at once; the job manager and the crawler
+	// bound how many run, and each analysis takes a batch slot of the limiter
+	analyzeAsyncHandler := metered(unlimited, server.AnalyzeAsyncHandler)
+	crawlHandler := metered(unlimited, server.CrawlHandler)
+	usageHandler := server.APIKeys().Authenticate(http.HandlerFunc(server.UsageHandler))
+	// Reanalyses fetch no page, but check its links like any analysis
+	reanalyzeHandler := metered(server.Limiter().Limit, server.ReanalyzeHandler)
+	// Dry runs fetch no pages, so they need a key but use none of its quota
+	validateHandler := server.APIKeys().Authenticate(http.HandlerFunc(server.ValidateHandler))
+	// WebSocket connections outlive the request timeout, so they get a chain of their own;
+	// the memory guard refuses them at connect time and checks again for each analysis
+	// on a connection, which also takes a limiter slot and is charged to the key when it starts
+	webSocketHandler := middleware.Chain(
+		server.APIKeys().Authenticate(server.MemoryGuard().Shed(http.HandlerFunc(server.WebSocketHandler))),
+		middleware.PanicRecovery,
+		middleware.Logging,
+		middleware.Tracing,
+		middleware.SecurityHeaders,
+	)
+
 	// Create middleware chain for main routes
 	middlewareChain := middleware.Chain(
 		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -39,7 +79,33 @@ func main() {
 			case "/":
 				server.IndexHandler(w, r)
 			case "/analyze":
-				server.AnalyzeHandler(w, r)
+				analyzeHandler.ServeHTTP(w, r)
+			case "/analyze/stream":
+				analyzeStreamHandler.ServeHTTP(w, r)
+			case "/analyze/async":
+				analyzeAsyncHandler.ServeHTTP(w, r)
+			case "/duplicates":
+				duplicatesHandler.ServeHTTP(w, r)
+			case "/hreflang":
+				hreflangHandler.ServeHTTP(w, r)
+			case "/crawl":
+				crawlHandler.ServeHTTP(w, r)
+			case "/validate":
+				validateHandler.ServeHTTP(w, r)
+			case "/account/usage":
+				usageHandler.ServeHTTP(w, r)
+			case "/incidents":
+				server.IncidentsHandler(w, r)
+			case "/changes":
+				server.ChangesHandler(w, r)
+			case "/admin/hosts":
+				server.HostsHandler(w, r)
+			case "/dashboard":
+				server.DashboardHandler(w, r)
+			case "/compare":
+				server.CompareHandler(w, r)
+			case "/api/v1/capabilities":
+				server.CapabilitiesHandler(w, r)
 			case "/metrics":
 				handleMetrics(w, r, server)
 			case "/health":
@@ -47,11 +113,32 @@ func main() {
 			case "/cache-logging":
 				handleCacheLogging(w, r, server)
 			default:
+				if strings.HasPrefix(r.URL.Path, "/i18n/") {
+					server.I18nHandler(w, r)
+					return
+				}
+				if strings.HasPrefix(r.URL.Path, "/r/") {
+					server.PermalinkHandler(w, r)
+					return
+				}
+				if strings.HasPrefix(r.URL.Path, "/crawl/") {
+					server.CrawlReportHandler(w, r)
+					return
+				}
+				if strings.HasPrefix(r.URL.Path, "/history/") {
+					reanalyzeHandler.ServeHTTP(w, r)
+					return
+				}
+				if strings.HasPrefix(r.URL.Path, "/jobs/") {
+					server.JobHandler(w, r)
+					return
+				}
 				http.NotFound(w, r)
 			}
 		}),
 		middleware.PanicRecovery,
 		middleware.Logging,
+		middleware.Tracing,
 		middleware.CORS,
 		middleware.SecurityHeaders,
 		middleware.Timeout(60*time.Second), // Increased timeout for complex sites
@@ -67,6 +154,7 @@ func main() {
 
 	// Set up routes
 	http.Handle("/static/", staticHandler)
+	http.Handle("/ws", webSocketHandler)
 	http.Handle("/", middlewareChain)
 
 	// Enable profiling endpoints in development
@@ -115,6 +203,18 @@ func main() {
 	if err := httpServer.Shutdown(ctx); err != nil {
 		logger.Sugar.Fatal("Server forced to shutdown:", err)
 	}
+	server.MemoryGuard().Stop()
+	server.Scheduler().Stop()
+	server.FlushResults()
+	if err := server.APIKeys().Close(); err != nil {
+		logger.Sugar.Warnw("Failed to save API usage", "error", err)
+	}
+	if err := server.GetAnalyzer().SaveHostReputation(); err != nil {
+		logger.Sugar.Warnw("Failed to save host reputation", "error", err)
+	}
+	if err := tracing.Shutdown(ctx); err != nil {
+		logger.Sugar.Warnw("Failed to export remaining spans", "error", err)
+	}
 
 	logger.Sugar.Info("Server exited gracefully")
 }
@@ -144,7 +244,35 @@ func handleMetrics(w http.ResponseWriter, _ *http.Request, server *handlers.Serv
 			"avg_duration":    metrics.AvgDuration.String(),
 			"cache_hits":      metrics.CacheHits,
 			"cache_misses":    metrics.CacheMisses,
+			"failed_requests": metrics.FailedRequests,
+			"error_rate":      metrics.ErrorRate(),
+			"latency_p50":     metrics.LatencyP50.String(),
+			"latency_p95":     metrics.LatencyP95.String(),
+		},
+		"cost": map[string]interface{}{
+			"outbound_requests": metrics.OutboundRequests,
+			"outbound_bytes":    metrics.OutboundBytes,
+			"fetch_time":        metrics.FetchTime.String(),
+			"parse_time":        metrics.ParseTime.String(),
+			"link_check_time":   metrics.LinkCheckTime.String(),
+		},
+		"cache": map[string]interface{}{
+			"entries":   metrics.CacheEntries,
+			"expired":   metrics.CacheExpired,
+			"evictions": metrics.CacheEvictions,
+			"hit_ratio": metrics.CacheHitRatio(),
+		},
+		"circuit_breaker": map[string]interface{}{
+			"state":                metrics.CircuitBreakerState,
+			"consecutive_failures": metrics.CircuitBreakerFailures,
+			"trips":                metrics.CircuitBreakerTrips,
 		},
+		"throttled_hosts": metrics.ThrottledHosts,
+		"worker_pool":     metrics.WorkerPool,
+		"concurrency":     server.Limiter().Stats(),
+		"priorities":      server.GetAnalyzer().PriorityStats(),
+		"memory":          server.MemoryGuard().Stats(),
+		"scheduler":       server.Scheduler().Stats(),
 		"runtime": map[string]interface{}{
 			"goroutines":        runtime.NumGoroutine(),
 			"memory_alloc":      m.Alloc,
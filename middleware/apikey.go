@@ -0,0 +1,510 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"web-page-analyzer/logger"
+)
+
+// APIKeyConfig describes the limits attached to an API key
+type APIKeyConfig struct {
+	Key           string
+	RatePerMinute int
+	MonthlyQuota  int64
+}
+
+// Usage reports the metered usage of an API key for the current billing period
+type Usage struct {
+	KeyID         string    `json:"key_id"`
+	Period        string    `json:"period"`
+	Used          int64     `json:"used"`
+	MonthlyQuota  int64     `json:"monthly_quota"`
+	Remaining     int64     `json:"remaining"`
+	RatePerMinute int       `json:"rate_per_minute"`
+	ResetsAt      time.Time `json:"resets_at"`
+	// OutboundRequests and OutboundBytes are the egress of the analyses the key ran
+	OutboundRequests int64 `json:"outbound_requests"`
+	OutboundBytes    int64 `json:"outbound_bytes"`
+}
+
+// UsageStore persists per-key usage counters
+type UsageStore interface {
+	Increment(key, period string) (int64, error)
+	Add(key, period string, n int64) (int64, error)
+	Get(key, period string) (int64, error)
+}
+
+// Egress counters are kept in the usage store beside the request counter,
+// under the key with these suffixes; keys never contain a colon
+const (
+	outboundRequestsSuffix = ":outbound_requests"
+	outboundBytesSuffix    = ":outbound_bytes"
+)
+
+// apiKeyContextKey stores the authenticated key in the request context
+type apiKeyContextKey struct{}
+
+// APIKeyAuth authenticates requests by API key and enforces per-key rate limits and monthly quotas
+type APIKeyAuth struct {
+	keys  map[string]APIKeyConfig
+	store UsageStore
+	now   func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// NewAPIKeyAuth creates an API key authenticator; with no keys configured every request is allowed
+func NewAPIKeyAuth(keys []APIKeyConfig, store UsageStore) *APIKeyAuth {
+	auth := &APIKeyAuth{
+		keys:    make(map[string]APIKeyConfig),
+		store:   store,
+		now:     time.Now,
+		buckets: make(map[string]*tokenBucket),
+	}
+	for _, key := range keys {
+		auth.keys[key.Key] = key
+	}
+	return auth
+}
+
+// ParseAPIKeys parses a comma-separated list of "key:rate_per_minute:monthly_quota" entries.
+// A zero rate or quota means unlimited.
+func ParseAPIKeys(spec string) ([]APIKeyConfig, error) {
+	var keys []APIKeyConfig
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid API key entry %q, expected key:rate_per_minute:monthly_quota", entry)
+		}
+		rate, err := strconv.Atoi(parts[1])
+		if err != nil || rate < 0 {
+			return nil, fmt.Errorf("invalid rate limit in API key entry %q", entry)
+		}
+		quota, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil || quota < 0 {
+			return nil, fmt.Errorf("invalid monthly quota in API key entry %q", entry)
+		}
+		keys = append(keys, APIKeyConfig{Key: parts[0], RatePerMinute: rate, MonthlyQuota: quota})
+	}
+	return keys, nil
+}
+
+// Enabled reports whether API keys are required
+func (a *APIKeyAuth) Enabled() bool {
+	return len(a.keys) > 0
+}
+
+// Authenticate rejects requests without a valid API key
+func (a *APIKeyAuth) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		config, ok := a.keys[requestAPIKey(r)]
+		if !ok {
+			writeJSONError(w, http.StatusUnauthorized, "A valid API key is required in the X-API-Key header")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, config)))
+	})
+}
+
+// Meter enforces the rate limit and monthly quota of the key Authenticate
+// stored in the request's context, and records the request against the key's
+// usage. Requests Authenticate let through without a key are not metered.
+func (a *APIKeyAuth) Meter(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		config, ok := APIKeyFromContext(r.Context())
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if status, message := a.Charge(config, w.Header()); status != 0 {
+			writeJSONError(w, status, message)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Charge enforces a key's monthly quota and rate limit and records one request
+// against its usage, setting the X-RateLimit-*, X-Quota-* and Retry-After
+// headers in header. It returns zero when the request is admitted, or the
+// status and message refusing it.
+func (a *APIKeyAuth) Charge(config APIKeyConfig, header http.Header) (int, string) {
+	now := a.now()
+
+	// Count the request first, so concurrent requests cannot all pass a check
+	// made before any of them was recorded; one refused is taken back
+	period := usagePeriod(now)
+	used, err := a.store.Increment(config.Key, period)
+	if err != nil {
+		logger.Sugar.Errorw("Failed to record API key usage", "key_id", maskKey(config.Key), "error", err)
+	}
+	counted := err == nil
+	if config.MonthlyQuota > 0 {
+		header.Set("X-Quota-Limit", strconv.FormatInt(config.MonthlyQuota, 10))
+		if counted && used > config.MonthlyQuota {
+			a.uncount(config, period)
+			resetsAt := nextPeriod(now)
+			header.Set("X-Quota-Remaining", "0")
+			header.Set("Retry-After", strconv.Itoa(int(math.Ceil(resetsAt.Sub(now).Seconds()))))
+			return http.StatusTooManyRequests, "Monthly quota exhausted for this API key"
+		}
+	}
+
+	// The rate limit is checked once the quota admits the request, so requests
+	// refused for an exhausted quota do not use up rate tokens
+	if config.RatePerMinute > 0 {
+		allowed, remaining, retryAfter := a.bucket(config).take(now)
+		header.Set("X-RateLimit-Limit", strconv.Itoa(config.RatePerMinute))
+		header.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		if !allowed {
+			if counted {
+				a.uncount(config, period)
+				used--
+			}
+			header.Set("Retry-After", strconv.Itoa(retryAfter))
+			if config.MonthlyQuota > 0 {
+				header.Set("X-Quota-Remaining", strconv.FormatInt(max64(config.MonthlyQuota-used, 0), 10))
+			}
+			return http.StatusTooManyRequests, "Rate limit exceeded for this API key"
+		}
+	}
+
+	if config.MonthlyQuota > 0 {
+		header.Set("X-Quota-Remaining", strconv.FormatInt(max64(config.MonthlyQuota-used, 0), 10))
+	}
+	return 0, ""
+}
+
+// uncount takes back a request Charge counted but refused
+func (a *APIKeyAuth) uncount(config APIKeyConfig, period string) {
+	if _, err := a.store.Add(config.Key, period, -1); err != nil {
+		logger.Sugar.Errorw("Failed to roll back API key usage", "key_id", maskKey(config.Key), "error", err)
+	}
+}
+
+// Close writes pending usage to the store's file and stops its background
+// writes, when the store keeps one
+func (a *APIKeyAuth) Close() error {
+	if closer, ok := a.store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Usage returns the current period's usage for an API key
+func (a *APIKeyAuth) Usage(config APIKeyConfig) (Usage, error) {
+	now := a.now()
+	period := usagePeriod(now)
+	used, err := a.store.Get(config.Key, period)
+	if err != nil {
+		return Usage{}, err
+	}
+
+	requests, err := a.store.Get(config.Key+outboundRequestsSuffix, period)
+	if err != nil {
+		return Usage{}, err
+	}
+	bytes, err := a.store.Get(config.Key+outboundBytesSuffix, period)
+	if err != nil {
+		return Usage{}, err
+	}
+
+	usage := Usage{
+		KeyID:            maskKey(config.Key),
+		Period:           period,
+		Used:             used,
+		MonthlyQuota:     config.MonthlyQuota,
+		RatePerMinute:    config.RatePerMinute,
+		ResetsAt:         nextPeriod(now),
+		OutboundRequests: requests,
+		OutboundBytes:    bytes,
+	}
+	if config.MonthlyQuota > 0 {
+		usage.Remaining = max64(config.MonthlyQuota-used, 0)
+	} else {
+		usage.Remaining = -1
+	}
+	return usage, nil
+}
+
+// RecordEgress charges the outbound requests and response bytes of an analysis
+// to a key's usage for the current period
+func (a *APIKeyAuth) RecordEgress(config APIKeyConfig, requests int, bytes int64) {
+	period := usagePeriod(a.now())
+	if _, err := a.store.Add(config.Key+outboundRequestsSuffix, period, int64(requests)); err != nil {
+		logger.Sugar.Errorw("Failed to record API key egress", "key_id", maskKey(config.Key), "error", err)
+	}
+	if _, err := a.store.Add(config.Key+outboundBytesSuffix, period, bytes); err != nil {
+		logger.Sugar.Errorw("Failed to record API key egress", "key_id", maskKey(config.Key), "error", err)
+	}
+}
+
+// APIKeyFromContext returns the API key authenticated for the request
+func APIKeyFromContext(ctx context.Context) (APIKeyConfig, bool) {
+	config, ok := ctx.Value(apiKeyContextKey{}).(APIKeyConfig)
+	return config, ok
+}
+
+// bucket returns the rate limiter for a key, creating it on first use
+func (a *APIKeyAuth) bucket(config APIKeyConfig) *tokenBucket {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	bucket, ok := a.buckets[config.Key]
+	if !ok {
+		bucket = newTokenBucket(config.RatePerMinute, a.now())
+		a.buckets[config.Key] = bucket
+	}
+	return bucket
+}
+
+// requestAPIKey extracts the API key from the X-API-Key or Authorization header
+func requestAPIKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	return ""
+}
+
+// usagePeriod returns the billing period (calendar month, UTC) containing t
+func usagePeriod(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+// nextPeriod returns the start of the billing period after the one containing t
+func nextPeriod(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// maskKey hides all but the last four characters of an API key
+func maskKey(key string) string {
+	if len(key) <= 4 {
+		return strings.Repeat("*", len(key))
+	}
+	return strings.Repeat("*", len(key)-4) + key[len(key)-4:]
+}
+
+// max64 returns the larger of two int64 values
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// writeJSONError writes an error message as a JSON body
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// tokenBucket is a per-key rate limiter refilled continuously over a minute
+type tokenBucket struct {
+	mu       sync.Mutex
+	capacity float64
+	tokens   float64
+	rate     float64 // tokens per second
+	updated  time.Time
+}
+
+// newTokenBucket creates a full bucket allowing perMinute requests per minute
+func newTokenBucket(perMinute int, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		capacity: float64(perMinute),
+		tokens:   float64(perMinute),
+		rate:     float64(perMinute) / 60,
+		updated:  now,
+	}
+}
+
+// take consumes a token if available, returning the remaining tokens and
+// the seconds to wait when the bucket is empty
+func (b *tokenBucket) take(now time.Time) (bool, int, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens = math.Min(b.capacity, b.tokens+now.Sub(b.updated).Seconds()*b.rate)
+	b.updated = now
+
+	if b.tokens < 1 {
+		return false, 0, int(math.Ceil((1 - b.tokens) / b.rate))
+	}
+	b.tokens--
+	return true, int(b.tokens), 0
+}
+
+// MemoryUsageStore keeps usage counters in memory
+type MemoryUsageStore struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+// NewMemoryUsageStore creates an empty in-memory usage store
+func NewMemoryUsageStore() *MemoryUsageStore {
+	return &MemoryUsageStore{counts: make(map[string]int64)}
+}
+
+// Increment adds one request to a key's counter and returns the new total
+func (s *MemoryUsageStore) Increment(key, period string) (int64, error) {
+	return s.Add(key, period, 1)
+}
+
+// Add adds n to a key's counter and returns the new total
+func (s *MemoryUsageStore) Add(key, period string, n int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[key+"|"+period] += n
+	return s.counts[key+"|"+period], nil
+}
+
+// Get returns a key's counter for a period
+func (s *MemoryUsageStore) Get(key, period string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts[key+"|"+period], nil
+}
+
+// UsageSaveInterval is how often a FileUsageStore writes changed counters to disk
+const UsageSaveInterval = 5 * time.Second
+
+// FileUsageStore keeps usage counters in memory and persists them to a JSON file
+// so quotas survive restarts. Counters are written in the background every
+// UsageSaveInterval, and on Close, so requests never wait on the disk; only the
+// current and previous billing periods are kept.
+type FileUsageStore struct {
+	*MemoryUsageStore
+	path  string
+	dirty bool // guarded by MemoryUsageStore.mu
+
+	saveMu sync.Mutex
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewFileUsageStore loads usage counters from path, starting empty if the file
+// does not exist, and starts writing them back in the background
+func NewFileUsageStore(path string) (*FileUsageStore, error) {
+	store := &FileUsageStore{
+		MemoryUsageStore: NewMemoryUsageStore(),
+		path:             path,
+		stop:             make(chan struct{}),
+		done:             make(chan struct{}),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &store.counts); err != nil {
+			return nil, err
+		}
+	}
+	go store.run()
+	return store, nil
+}
+
+// Increment adds one request to a key's counter and returns the new total
+func (s *FileUsageStore) Increment(key, period string) (int64, error) {
+	return s.Add(key, period, 1)
+}
+
+// Add adds n to a key's counter and returns the new total; the change is
+// written to disk by the next save
+func (s *FileUsageStore) Add(key, period string, n int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[key+"|"+period] += n
+	s.dirty = true
+	return s.counts[key+"|"+period], nil
+}
+
+// run saves the counters every UsageSaveInterval until Close
+func (s *FileUsageStore) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(UsageSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Save(); err != nil {
+				logger.Sugar.Errorw("Failed to save API usage", "path", s.path, "error", err)
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Save drops the counters of billing periods before the previous one and
+// writes the rest to disk when they changed since the last save
+func (s *FileUsageStore) Save() error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	oldest := usagePeriod(nextPeriod(time.Now()).AddDate(0, -2, 0))
+	for counter := range s.counts {
+		if i := strings.LastIndex(counter, "|"); i >= 0 && counter[i+1:] < oldest {
+			delete(s.counts, counter)
+		}
+	}
+	data, err := json.Marshal(s.counts)
+	s.dirty = false
+	s.mu.Unlock()
+
+	if err == nil {
+		// Write to a temporary file first so a crash never leaves a truncated store
+		tmp := s.path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0o600); err == nil {
+			err = os.Rename(tmp, s.path)
+		}
+	}
+	if err != nil {
+		s.mu.Lock()
+		s.dirty = true
+		s.mu.Unlock()
+	}
+	return err
+}
+
+// Close stops the background saves and writes pending changes
+func (s *FileUsageStore) Close() error {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	<-s.done
+	return s.Save()
+}
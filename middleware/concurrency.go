@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Concurrency limiter defaults
+const (
+	DefaultMaxConcurrent    = 10
+	DefaultMaxQueued        = 50
+	DefaultQueueWait        = 30 * time.Second
+	SaturatedRetryAfterSecs = 5
+	InteractiveReservePct   = 20 // share of slots batch requests may not take
+)
+
+// ConcurrencyStats is a snapshot of the concurrency limiter state
+type ConcurrencyStats struct {
+	Active        int   `json:"active"`
+	Queued        int   `json:"queued"`
+	MaxConcurrent int   `json:"max_concurrent"`
+	MaxQueued     int   `json:"max_queued"`
+	Rejected      int64 `json:"rejected"`
+	// BatchActive counts the active requests marked as batch work, and
+	// ReservedInteractive the slots batch requests may never take
+	BatchActive         int `json:"batch_active"`
+	ReservedInteractive int `json:"reserved_interactive"`
+}
+
+// ConcurrencyLimiter bounds the number of requests processed at once, holding
+// excess requests in a bounded wait queue. Batch requests, such as crawls and
+// bulk jobs, also need one of the batch slots, so a share of the capacity is
+// always left for interactive requests.
+type ConcurrencyLimiter struct {
+	slots      chan struct{}
+	batchSlots chan struct{}
+	maxQueued  int
+	queueWait  time.Duration
+
+	queued   atomic.Int64
+	rejected atomic.Int64
+}
+
+// NewConcurrencyLimiter creates a limiter allowing maxConcurrent requests with up to
+// maxQueued more waiting at most queueWait for a slot
+func NewConcurrencyLimiter(maxConcurrent, maxQueued int, queueWait time.Duration) *ConcurrencyLimiter {
+	// Keep InteractiveReservePct of the slots, and at least one unless there
+	// is only one, free of batch work
+	reserved := maxConcurrent * InteractiveReservePct / 100
+	if reserved == 0 && maxConcurrent > 1 {
+		reserved = 1
+	}
+	return &ConcurrencyLimiter{
+		slots:      make(chan struct{}, maxConcurrent),
+		batchSlots: make(chan struct{}, maxConcurrent-reserved),
+		maxQueued:  maxQueued,
+		queueWait:  queueWait,
+	}
+}
+
+// Limit admits requests while slots are free, queues them while the queue has room,
+// and rejects them with 429 and Retry-After once saturated. Requests asking for
+// priority=batch are limited as batch work.
+func (l *ConcurrencyLimiter) Limit(next http.Handler) http.Handler {
+	return l.limit(next, func(r *http.Request) bool {
+		return r.FormValue("priority") == "batch"
+	})
+}
+
+// LimitBatch limits like Limit but treats every request as batch work, for
+// endpoints that fan out into many analyses
+func (l *ConcurrencyLimiter) LimitBatch(next http.Handler) http.Handler {
+	return l.limit(next, func(*http.Request) bool { return true })
+}
+
+// limit admits requests, taking a batch slot first for those isBatch reports
+func (l *ConcurrencyLimiter) limit(next http.Handler, isBatch func(*http.Request) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		release, ok := l.Acquire(r.Context(), isBatch(r))
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(SaturatedRetryAfterSecs))
+			writeJSONError(w, http.StatusTooManyRequests, "The analyzer is at capacity; retry shortly")
+			return
+		}
+		defer release()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Acquire admits work outside an HTTP request, such as an analysis asked for on
+// a WebSocket, as Limit admits requests: it takes a slot, and a batch slot when
+// batch is set, waiting in the queue while none is free. It returns the func
+// giving the slots back, or false when the limiter is saturated or ctx ends first.
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context, batch bool) (func(), bool) {
+	semaphores := []chan struct{}{l.slots}
+	if batch {
+		semaphores = []chan struct{}{l.batchSlots, l.slots}
+	}
+	if !l.acquire(ctx, semaphores) {
+		l.rejected.Add(1)
+		return nil, false
+	}
+	return func() { releaseSlots(semaphores) }, true
+}
+
+// acquire takes a slot in each semaphore in turn, queueing the request while
+// one is full, and reports whether all were acquired. On failure the slots
+// already taken are given back.
+func (l *ConcurrencyLimiter) acquire(ctx context.Context, semaphores []chan struct{}) bool {
+	var timer *time.Timer
+	for i, semaphore := range semaphores {
+		select {
+		case semaphore <- struct{}{}:
+			continue
+		default:
+		}
+
+		// A request counts once against the queue however many slots it waits for
+		if timer == nil {
+			if l.queued.Add(1) > int64(l.maxQueued) {
+				l.queued.Add(-1)
+				releaseSlots(semaphores[:i])
+				return false
+			}
+			defer l.queued.Add(-1)
+			timer = time.NewTimer(l.queueWait)
+			defer timer.Stop()
+		}
+
+		select {
+		case semaphore <- struct{}{}:
+		case <-timer.C:
+			releaseSlots(semaphores[:i])
+			return false
+		case <-ctx.Done():
+			releaseSlots(semaphores[:i])
+			return false
+		}
+	}
+	return true
+}
+
+// releaseSlots gives back one slot in each semaphore
+func releaseSlots(semaphores []chan struct{}) {
+	for _, semaphore := range semaphores {
+		<-semaphore
+	}
+}
+
+// Stats returns the current limiter state
+func (l *ConcurrencyLimiter) Stats() ConcurrencyStats {
+	return ConcurrencyStats{
+		Active:        len(l.slots),
+		Queued:        int(l.queued.Load()),
+		MaxConcurrent: cap(l.slots),
+		MaxQueued:     l.maxQueued,
+		Rejected:      l.rejected.Load(),
+
+		BatchActive:         len(l.batchSlots),
+		ReservedInteractive: cap(l.slots) - cap(l.batchSlots),
+	}
+}
@@ -0,0 +1,216 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"web-page-analyzer/logger"
+)
+
+// Memory guard defaults
+const (
+	DefaultMemorySampleInterval = time.Second
+	OverloadedRetryAfterSecs    = 10
+)
+
+// MemoryPressure describes how close the process is to its memory limits
+type MemoryPressure int32
+
+const (
+	// MemoryNormal means requests are served as usual
+	MemoryNormal MemoryPressure = iota
+	// MemoryDegraded means link checking is disabled for new analyses
+	MemoryDegraded
+	// MemoryCritical means new analyses are rejected
+	MemoryCritical
+)
+
+// String returns the pressure level name
+func (p MemoryPressure) String() string {
+	switch p {
+	case MemoryDegraded:
+		return "degraded"
+	case MemoryCritical:
+		return "critical"
+	default:
+		return "normal"
+	}
+}
+
+// MemoryStats is a snapshot of the memory guard state
+type MemoryStats struct {
+	Pressure   string `json:"pressure"`
+	HeapAlloc  uint64 `json:"heap_alloc"`
+	SoftLimit  uint64 `json:"soft_limit"`
+	HardLimit  uint64 `json:"hard_limit"`
+	Active     int64  `json:"active"`
+	Degraded   int64  `json:"degraded"`
+	Rejected   int64  `json:"rejected"`
+	Enabled    bool   `json:"enabled"`
+	SampledAt  string `json:"sampled_at,omitempty"`
+	IntervalMs int64  `json:"interval_ms"`
+}
+
+type shedKey struct{}
+
+// MemoryGuard samples heap usage in the background and sheds load when it grows
+// past the configured limits: above the soft limit analyses run without link
+// checking, above the hard limit new analyses are rejected with 503
+type MemoryGuard struct {
+	softLimit uint64
+	hardLimit uint64
+	interval  time.Duration
+
+	pressure  atomic.Int32
+	heapAlloc atomic.Uint64
+	sampledAt atomic.Int64
+	active    atomic.Int64
+	degraded  atomic.Int64
+	rejected  atomic.Int64
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewMemoryGuard creates a guard with soft and hard heap limits in bytes. A zero
+// limit disables that level; with both zero the guard never sheds load.
+func NewMemoryGuard(softLimit, hardLimit uint64, interval time.Duration) *MemoryGuard {
+	if interval <= 0 {
+		interval = DefaultMemorySampleInterval
+	}
+	g := &MemoryGuard{
+		softLimit: softLimit,
+		hardLimit: hardLimit,
+		interval:  interval,
+		stop:      make(chan struct{}),
+	}
+
+	if g.Enabled() {
+		g.sample()
+		go g.run()
+	}
+	return g
+}
+
+// Enabled reports whether any memory limit is configured
+func (g *MemoryGuard) Enabled() bool {
+	return g.softLimit > 0 || g.hardLimit > 0
+}
+
+// Stop ends background sampling
+func (g *MemoryGuard) Stop() {
+	g.stopOnce.Do(func() { close(g.stop) })
+}
+
+// run samples heap usage until the guard is stopped
+func (g *MemoryGuard) run() {
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			g.sample()
+		case <-g.stop:
+			return
+		}
+	}
+}
+
+// sample reads the current heap size and updates the pressure level
+func (g *MemoryGuard) sample() {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	pressure := MemoryNormal
+	switch {
+	case g.hardLimit > 0 && m.HeapAlloc >= g.hardLimit:
+		pressure = MemoryCritical
+	case g.softLimit > 0 && m.HeapAlloc >= g.softLimit:
+		pressure = MemoryDegraded
+	}
+
+	g.heapAlloc.Store(m.HeapAlloc)
+	g.sampledAt.Store(time.Now().UnixNano())
+	if previous := MemoryPressure(g.pressure.Swap(int32(pressure))); previous != pressure {
+		logger.WithComponent("memory_guard").Warnw("Memory pressure changed",
+			"from", previous.String(),
+			"to", pressure.String(),
+			"heap_alloc", m.HeapAlloc,
+			"active_analyses", g.active.Load(),
+		)
+	}
+}
+
+// Pressure returns the most recently sampled pressure level
+func (g *MemoryGuard) Pressure() MemoryPressure {
+	return MemoryPressure(g.pressure.Load())
+}
+
+// Shed rejects requests with 503 and Retry-After under critical memory pressure and
+// marks them to run without link checking under degraded pressure
+func (g *MemoryGuard) Shed(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, done, ok := g.Admit(r.Context())
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(OverloadedRetryAfterSecs))
+			writeJSONError(w, http.StatusServiceUnavailable, "The analyzer is low on memory; retry shortly")
+			return
+		}
+		defer done()
+		if LinkChecksShed(ctx) {
+			w.Header().Set("X-Load-Shedding", "link-checks-disabled")
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Admit checks the current pressure for work outside an HTTP request, such as
+// an analysis asked for on a WebSocket, as Shed does for requests. It returns
+// ctx marked with whether link checking is shed and the func to call once the
+// work is done, or false under critical pressure.
+func (g *MemoryGuard) Admit(ctx context.Context) (context.Context, func(), bool) {
+	shed := false
+	switch g.Pressure() {
+	case MemoryCritical:
+		g.rejected.Add(1)
+		return ctx, nil, false
+	case MemoryDegraded:
+		g.degraded.Add(1)
+		shed = true
+	}
+
+	g.active.Add(1)
+	return context.WithValue(ctx, shedKey{}, shed), func() { g.active.Add(-1) }, true
+}
+
+// LinkChecksShed reports whether the memory guard disabled link checking for the request
+func LinkChecksShed(ctx context.Context) bool {
+	shed, _ := ctx.Value(shedKey{}).(bool)
+	return shed
+}
+
+// Stats returns the current guard state
+func (g *MemoryGuard) Stats() MemoryStats {
+	stats := MemoryStats{
+		Pressure:   g.Pressure().String(),
+		HeapAlloc:  g.heapAlloc.Load(),
+		SoftLimit:  g.softLimit,
+		HardLimit:  g.hardLimit,
+		Active:     g.active.Load(),
+		Degraded:   g.degraded.Load(),
+		Rejected:   g.rejected.Load(),
+		Enabled:    g.Enabled(),
+		IntervalMs: g.interval.Milliseconds(),
+	}
+	if sampledAt := g.sampledAt.Load(); sampledAt > 0 {
+		stats.SampledAt = time.Unix(0, sampledAt).UTC().Format(time.RFC3339)
+	}
+	return stats
+}
@@ -1,12 +1,15 @@
 package middleware
 
 import (
+	"bufio"
 	"context"
+	"net"
 	"net/http"
 	"runtime/debug"
 	"time"
 
 	"web-page-analyzer/logger"
+	"web-page-analyzer/tracing"
 )
 
 // ResponseWriter wraps http.ResponseWriter to capture status code
@@ -24,6 +27,21 @@ func (rw *ResponseWriter) Write(b []byte) (int, error) {
 	return rw.ResponseWriter.Write(b)
 }
 
+// Unwrap exposes the underlying writer so http.ResponseController can flush streamed responses
+func (rw *ResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Hijack hands the connection over to WebSocket handlers, which do not look
+// through Unwrap; the upgrade is logged as 101 Switching Protocols
+func (rw *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, buf, err := http.NewResponseController(rw.ResponseWriter).Hijack()
+	if err == nil {
+		rw.statusCode = http.StatusSwitchingProtocols
+	}
+	return conn, buf, err
+}
+
 // PanicRecovery middleware recovers from panics and returns 500 error
 func PanicRecovery(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -60,12 +78,39 @@ func Logging(next http.Handler) http.Handler {
 	})
 }
 
+// Tracing middleware records a server span for each request, continuing the
+// trace of callers sending a traceparent header, so analyses run for the
+// request appear beneath it
+func Tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Paths hold IDs, so spans are named by method alone and carry the path
+		ctx, span := tracing.Start(tracing.Extract(r.Context(), r.Header), r.Method, tracing.KindServer,
+			tracing.String("http.request.method", r.Method),
+			tracing.String("url.path", r.URL.Path),
+			tracing.String("user_agent.original", r.UserAgent()),
+		)
+		if span == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		defer span.End()
+
+		rw := &ResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(rw, r.WithContext(ctx))
+
+		span.SetAttributes(tracing.Int("http.response.status_code", rw.statusCode))
+		if rw.statusCode >= http.StatusInternalServerError {
+			span.SetError(http.StatusText(rw.statusCode))
+		}
+	})
+}
+
 // CORS middleware adds CORS headers
 func CORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-API-Key, Authorization")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -0,0 +1,225 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"web-page-analyzer/analyzer"
+)
+
+// MaxChanges bounds the number of changes kept in the change log; the oldest are dropped first
+const MaxChanges = 1000
+
+// Snapshot is the part of a successful run compared against the next run of the same URL
+type Snapshot struct {
+	Title             string         `json:"title"`
+	HTMLVersion       string         `json:"html_version"`
+	StatusCode        int            `json:"status_code"`
+	HasLoginForm      bool           `json:"has_login_form"`
+	InternalLinks     int            `json:"internal_links"`
+	ExternalLinks     int            `json:"external_links"`
+	InaccessibleLinks int            `json:"inaccessible_links"`
+	HeadingCounts     map[string]int `json:"heading_counts"`
+	Links             []string       `json:"links"`
+}
+
+// snapshotOf captures the comparable fields of an analysis result
+func snapshotOf(result *analyzer.AnalysisResult) Snapshot {
+	return Snapshot{
+		Title:             result.PageTitle,
+		HTMLVersion:       result.HTMLVersion,
+		StatusCode:        result.StatusCode,
+		HasLoginForm:      result.HasLoginForm,
+		InternalLinks:     result.InternalLinks,
+		ExternalLinks:     result.ExternalLinks,
+		InaccessibleLinks: result.InaccessibleLinks,
+		HeadingCounts:     result.HeadingCounts,
+		Links:             result.Links,
+	}
+}
+
+// FieldChange is a field whose value differs between consecutive runs
+type FieldChange struct {
+	Field  string `json:"field"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// Change records what differs between a run and the previous run of the same URL
+type Change struct {
+	ID           int64         `json:"id"`
+	Schedule     string        `json:"schedule"`
+	URL          string        `json:"url"`
+	DetectedAt   time.Time     `json:"detected_at"`
+	Fields       []FieldChange `json:"fields,omitempty"`
+	LinksAdded   []string      `json:"links_added,omitempty"`
+	LinksRemoved []string      `json:"links_removed,omitempty"`
+}
+
+// Summary describes the change in one line, e.g. for notifications
+func (c *Change) Summary() string {
+	var parts []string
+	for _, field := range c.Fields {
+		parts = append(parts, fmt.Sprintf("%s %q -> %q", field.Field, field.Before, field.After))
+	}
+	if len(c.LinksAdded) > 0 {
+		parts = append(parts, fmt.Sprintf("%d links added", len(c.LinksAdded)))
+	}
+	if len(c.LinksRemoved) > 0 {
+		parts = append(parts, fmt.Sprintf("%d links removed", len(c.LinksRemoved)))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// result restores the compared fields of a snapshot as an analysis result.
+// Scheduled runs always collect links, so a snapshot without any had none.
+func (s Snapshot) result() *analyzer.AnalysisResult {
+	links := s.Links
+	if links == nil {
+		links = []string{}
+	}
+	return &analyzer.AnalysisResult{
+		PageTitle:         s.Title,
+		HTMLVersion:       s.HTMLVersion,
+		StatusCode:        s.StatusCode,
+		HasLoginForm:      s.HasLoginForm,
+		InternalLinks:     s.InternalLinks,
+		ExternalLinks:     s.ExternalLinks,
+		InaccessibleLinks: s.InaccessibleLinks,
+		HeadingCounts:     s.HeadingCounts,
+		Links:             links,
+	}
+}
+
+// diffSnapshots lists the fields and links that differ between two snapshots
+func diffSnapshots(before, after Snapshot) ([]FieldChange, []string, []string) {
+	diff := analyzer.DiffResults(before.result(), after.result())
+	var fields []FieldChange
+	for _, field := range diff.Fields {
+		if field.Changed {
+			fields = append(fields, FieldChange{Field: field.Field, Before: field.Before, After: field.After})
+		}
+	}
+	for _, heading := range diff.Headings {
+		if heading.Changed {
+			fields = append(fields, FieldChange{Field: "heading_counts." + heading.Field, Before: heading.Before, After: heading.After})
+		}
+	}
+	return fields, diff.LinksAdded, diff.LinksRemoved
+}
+
+// changeLogState is the persisted form of a change log
+type changeLogState struct {
+	Snapshots map[string]Snapshot `json:"snapshots"`
+	Changes   []Change            `json:"changes"`
+	NextID    int64               `json:"next_id"`
+}
+
+// ChangeLog keeps the last snapshot of each URL and the changes detected between
+// consecutive runs, optionally persisting both to a JSON file so diffs survive restarts
+type ChangeLog struct {
+	mu    sync.RWMutex
+	path  string
+	state changeLogState
+}
+
+// NewChangeLog creates an in-memory change log
+func NewChangeLog() *ChangeLog {
+	return &ChangeLog{state: changeLogState{Snapshots: make(map[string]Snapshot)}}
+}
+
+// LoadChangeLog loads a change log from path, starting empty if the file does not exist
+func LoadChangeLog(path string) (*ChangeLog, error) {
+	log := NewChangeLog()
+	log.path = path
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &log.state); err != nil {
+			return nil, err
+		}
+		if log.state.Snapshots == nil {
+			log.state.Snapshots = make(map[string]Snapshot)
+		}
+	}
+	return log, nil
+}
+
+// Record compares a run with the previous run of its URL and stores the change, if
+// any. Failed runs are neither diffed nor stored, so a transient outage does not
+// show up as every field changing twice.
+func (c *ChangeLog) Record(schedule *Schedule, run *Run) (*Change, error) {
+	if run.Result.Error != nil {
+		return nil, nil
+	}
+	snapshot := snapshotOf(run.Result)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	previous, seen := c.state.Snapshots[schedule.URL]
+	c.state.Snapshots[schedule.URL] = snapshot
+
+	var change *Change
+	if seen {
+		fields, added, removed := diffSnapshots(previous, snapshot)
+		if len(fields) > 0 || len(added) > 0 || len(removed) > 0 {
+			c.state.NextID++
+			change = &Change{
+				ID:           c.state.NextID,
+				Schedule:     schedule.Name,
+				URL:          schedule.URL,
+				DetectedAt:   run.StartedAt,
+				Fields:       fields,
+				LinksAdded:   added,
+				LinksRemoved: removed,
+			}
+			c.state.Changes = append(c.state.Changes, *change)
+			if excess := len(c.state.Changes) - MaxChanges; excess > 0 {
+				c.state.Changes = append([]Change(nil), c.state.Changes[excess:]...)
+			}
+		}
+	}
+	return change, c.save()
+}
+
+// save writes the change log to disk; the caller must hold the write lock
+func (c *ChangeLog) save() error {
+	if c.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(c.state)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated log
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// Changes returns recorded changes, newest first, optionally filtered by URL
+func (c *ChangeLog) Changes(url string) []Change {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	matches := []Change{}
+	for i := len(c.state.Changes) - 1; i >= 0; i-- {
+		change := c.state.Changes[i]
+		if url != "" && change.URL != url {
+			continue
+		}
+		matches = append(matches, change)
+	}
+	return matches
+}
@@ -0,0 +1,235 @@
+package scheduler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Message is an email ready to be sent
+type Message struct {
+	To          []string
+	Subject     string
+	Text        string
+	Attachments []Attachment
+}
+
+// Attachment is a file attached to a message
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Mailer delivers report emails
+type Mailer interface {
+	Send(msg *Message) error
+}
+
+// SMTPMailer sends email through an SMTP server, using STARTTLS when offered
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPMailer creates a mailer for host:port. Credentials are optional; when
+// given, PLAIN auth is used, which net/smtp only permits over TLS or to localhost.
+func NewSMTPMailer(addr, from, username, password string) (*SMTPMailer, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP address %q: %w", addr, err)
+	}
+	if from == "" {
+		return nil, fmt.Errorf("a sender address is required")
+	}
+
+	mailer := &SMTPMailer{addr: addr, from: from}
+	if username != "" {
+		mailer.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return mailer, nil
+}
+
+// Send delivers the message to its recipients
+func (m *SMTPMailer) Send(msg *Message) error {
+	data, err := encodeMessage(m.from, msg)
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(m.addr, m.auth, m.from, msg.To, data)
+}
+
+// encodeMessage renders a message as MIME, with attachments as base64 parts
+func encodeMessage(from string, msg *Message) ([]byte, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	textPart, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"8bit"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	textPart.Write([]byte(msg.Text))
+
+	for _, attachment := range msg.Attachments {
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {attachment.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoded := base64.StdEncoding.EncodeToString(attachment.Data)
+		for len(encoded) > 76 {
+			part.Write([]byte(encoded[:76] + "\r\n"))
+			encoded = encoded[76:]
+		}
+		part.Write([]byte(encoded + "\r\n"))
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", from)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", writer.Boundary())
+	message.Write(body.Bytes())
+
+	return message.Bytes(), nil
+}
+
+// buildReportEmail summarizes a scheduled run, attaching the HTML report if requested
+func buildReportEmail(schedule *Schedule, run *Run) *Message {
+	result := run.Result
+
+	status := "OK"
+	switch {
+	case result.Error != nil:
+		status = "FAILED"
+	case len(run.Incidents) > 0:
+		status = "BREACH"
+	}
+	subject := schedule.Email.Subject
+	if subject == "" {
+		subject = "Web page report: " + schedule.Name
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "Scheduled analysis %q (%s)\n", schedule.Name, status)
+	fmt.Fprintf(&text, "URL: %s\n", result.URL)
+	fmt.Fprintf(&text, "Run at: %s\n\n", run.StartedAt.Format(time.RFC1123))
+	if result.Error != nil {
+		fmt.Fprintf(&text, "Error: %s\n", result.Error.Error())
+	} else {
+		fmt.Fprintf(&text, "Title: %s\n", result.PageTitle)
+		fmt.Fprintf(&text, "HTML version: %s\n", result.HTMLVersion)
+		fmt.Fprintf(&text, "Links: %d internal, %d external, %d inaccessible\n",
+			result.InternalLinks, result.ExternalLinks, result.InaccessibleLinks)
+		fmt.Fprintf(&text, "Login form: %t\n", result.HasLoginForm)
+	}
+	if len(run.Incidents) > 0 {
+		text.WriteString("\nExpectations breached:\n")
+		for _, incident := range run.Incidents {
+			fmt.Fprintf(&text, "- %s: expected %s, got %s\n", incident.Expectation, incident.Expected, incident.Actual)
+		}
+	}
+	if run.Change != nil {
+		text.WriteString("\nChanged since the last run:\n")
+		for _, field := range run.Change.Fields {
+			fmt.Fprintf(&text, "- %s: %q -> %q\n", field.Field, field.Before, field.After)
+		}
+		for _, link := range run.Change.LinksAdded {
+			fmt.Fprintf(&text, "+ %s\n", link)
+		}
+		for _, link := range run.Change.LinksRemoved {
+			fmt.Fprintf(&text, "- %s\n", link)
+		}
+	}
+
+	msg := &Message{
+		To:      schedule.Email.To,
+		Subject: fmt.Sprintf("[%s] %s", status, subject),
+		Text:    text.String(),
+	}
+	if schedule.Email.AttachReport {
+		var report bytes.Buffer
+		if err := reportTemplate.Execute(&report, reportData(schedule, run, status)); err == nil {
+			msg.Attachments = append(msg.Attachments, Attachment{
+				Filename:    "report.html",
+				ContentType: "text/html; charset=utf-8",
+				Data:        report.Bytes(),
+			})
+		}
+	}
+	return msg
+}
+
+// headingCount is a heading level and its count, for ordered display
+type headingCount struct {
+	Level string
+	Count int
+}
+
+// reportData prepares the values rendered by the HTML report template
+func reportData(schedule *Schedule, run *Run, status string) map[string]interface{} {
+	var headings []headingCount
+	for level, count := range run.Result.HeadingCounts {
+		headings = append(headings, headingCount{Level: level, Count: count})
+	}
+	sort.Slice(headings, func(i, j int) bool { return headings[i].Level < headings[j].Level })
+
+	return map[string]interface{}{
+		"Name":      schedule.Name,
+		"Status":    status,
+		"RunAt":     run.StartedAt.Format(time.RFC1123),
+		"Result":    run.Result,
+		"Headings":  headings,
+		"Incidents": run.Incidents,
+	}
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Name}} report</title></head>
+<body style="font-family: sans-serif">
+<h1>{{.Name}} &mdash; {{.Status}}</h1>
+<p><a href="{{.Result.URL}}">{{.Result.URL}}</a><br>Run at {{.RunAt}}</p>
+{{if .Result.Error}}
+<p style="color: #b00020"><strong>Error:</strong> {{.Result.Error.Error}}</p>
+{{else}}
+<table border="1" cellpadding="6" cellspacing="0">
+<tr><th align="left">Title</th><td>{{.Result.PageTitle}}</td></tr>
+<tr><th align="left">HTML version</th><td>{{.Result.HTMLVersion}}</td></tr>
+<tr><th align="left">Internal links</th><td>{{.Result.InternalLinks}}</td></tr>
+<tr><th align="left">External links</th><td>{{.Result.ExternalLinks}}</td></tr>
+<tr><th align="left">Inaccessible links</th><td>{{.Result.InaccessibleLinks}}</td></tr>
+<tr><th align="left">Login form</th><td>{{.Result.HasLoginForm}}</td></tr>
+{{range .Headings}}<tr><th align="left">{{.Level}} headings</th><td>{{.Count}}</td></tr>
+{{end}}</table>
+{{end}}
+{{if .Incidents}}
+<h2>Expectations breached</h2>
+<ul>
+{{range .Incidents}}<li><strong>{{.Expectation}}</strong>: expected {{.Expected}}, got {{.Actual}}</li>
+{{end}}</ul>
+{{end}}
+</body>
+</html>
+`))
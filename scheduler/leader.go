@@ -0,0 +1,144 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"web-page-analyzer/analyzer"
+	"web-page-analyzer/logger"
+)
+
+// Leader election defaults
+const (
+	LeaseTTL           = 15 * time.Second
+	LeaseRenewInterval = LeaseTTL / 3
+	DefaultLeaseKey    = analyzer.SharedKeyPrefix + "scheduler:leader"
+)
+
+// Lease is a lock held by at most one instance until it expires. The instance
+// holding it runs the schedules; the others wait to take over if it lapses.
+type Lease interface {
+	// Acquire takes the lease for holder, or renews it if holder already owns it,
+	// and reports whether holder owns it afterwards
+	Acquire(ctx context.Context, holder string, ttl time.Duration) (bool, error)
+	// Release gives up the lease if holder owns it
+	Release(ctx context.Context, holder string) error
+}
+
+// Scripts compare the holder and act in one step, so an instance never extends
+// or deletes a lease another instance took after its own expired
+const (
+	renewScript   = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) else return 0 end`
+	releaseScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) else return 0 end`
+)
+
+// RedisLease is a lease stored in a Redis key holding the owner's ID
+type RedisLease struct {
+	client *analyzer.RedisClient
+	key    string
+}
+
+// NewRedisLease creates a lease on key; an empty key uses DefaultLeaseKey
+func NewRedisLease(client *analyzer.RedisClient, key string) *RedisLease {
+	if key == "" {
+		key = DefaultLeaseKey
+	}
+	return &RedisLease{client: client, key: key}
+}
+
+// Acquire takes the lease if it is free, otherwise renews it if holder owns it
+func (l *RedisLease) Acquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	ttlMs := strconv.FormatInt(ttl.Milliseconds(), 10)
+
+	reply, err := l.client.Do(ctx, "SET", l.key, holder, "NX", "PX", ttlMs)
+	if err != nil {
+		return false, err
+	}
+	if reply == "OK" {
+		return true, nil
+	}
+
+	reply, err = l.client.Do(ctx, "EVAL", renewScript, "1", l.key, holder, ttlMs)
+	if err != nil {
+		return false, err
+	}
+	return reply == int64(1), nil
+}
+
+// Release deletes the lease if holder owns it, letting another instance take over at once
+func (l *RedisLease) Release(ctx context.Context, holder string) error {
+	_, err := l.client.Do(ctx, "EVAL", releaseScript, "1", l.key, holder)
+	return err
+}
+
+// newHolderID identifies this instance as a lease holder
+func newHolderID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "scheduler"
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+// SetLease enables leader election: only the instance holding the lease runs
+// schedules. Without a lease every instance runs them.
+func (s *Scheduler) SetLease(lease Lease) {
+	s.lease = lease
+}
+
+// IsLeader reports whether this instance currently runs the schedules
+func (s *Scheduler) IsLeader() bool {
+	return s.lease == nil || s.leader.Load()
+}
+
+// elect keeps acquiring or renewing the lease until Stop is called, then releases it
+func (s *Scheduler) elect() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(LeaseRenewInterval)
+	defer ticker.Stop()
+
+	for {
+		s.campaign()
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			if s.leader.Swap(false) {
+				ctx, cancel := context.WithTimeout(context.Background(), analyzer.RedisTimeout)
+				if err := s.lease.Release(ctx, s.holder); err != nil {
+					logger.WithComponent("scheduler").Warnw("Failed to release scheduler lease", "error", err)
+				}
+				cancel()
+			}
+			return
+		}
+	}
+}
+
+// campaign makes one attempt to acquire or renew the lease. On an error this
+// instance steps down, since it can no longer prove it holds the lease.
+func (s *Scheduler) campaign() {
+	ctx, cancel := context.WithTimeout(context.Background(), analyzer.RedisTimeout)
+	defer cancel()
+
+	acquired, err := s.lease.Acquire(ctx, s.holder, LeaseTTL)
+	if err != nil {
+		logger.WithComponent("scheduler").Warnw("Scheduler lease unavailable", "holder", s.holder, "error", err)
+		acquired = false
+	}
+
+	if was := s.leader.Swap(acquired); was != acquired {
+		if acquired {
+			logger.WithComponent("scheduler").Infow("Became scheduler leader", "holder", s.holder)
+		} else {
+			logger.WithComponent("scheduler").Infow("Lost scheduler leadership", "holder", s.holder)
+		}
+	}
+}
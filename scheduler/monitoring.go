@@ -0,0 +1,116 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxIncidents bounds the number of incidents kept in memory; the oldest are dropped first
+const MaxIncidents = 1000
+
+// Expectations are the conditions a monitored page must meet on every scheduled run
+type Expectations struct {
+	// Status is the HTTP status the page must return, e.g. 200
+	Status int `json:"status,omitempty"`
+	// MaxBrokenLinks is the number of inaccessible links at or above which a run is a breach
+	MaxBrokenLinks *int `json:"max_broken_links,omitempty"`
+	// TitleContains is text the page title must contain (case-insensitive)
+	TitleContains string `json:"title_contains,omitempty"`
+	// LoginForm requires the login form to be present (true) or absent (false)
+	LoginForm *bool `json:"login_form,omitempty"`
+}
+
+// Incident records a scheduled run that breached one of its expectations
+type Incident struct {
+	ID          int64     `json:"id"`
+	Schedule    string    `json:"schedule"`
+	URL         string    `json:"url"`
+	Expectation string    `json:"expectation"`
+	Expected    string    `json:"expected"`
+	Actual      string    `json:"actual"`
+	DetectedAt  time.Time `json:"detected_at"`
+}
+
+// checkExpectations compares a run against the schedule's expectations
+func checkExpectations(schedule *Schedule, run *Run) []Incident {
+	expect := schedule.Expect
+	if expect == nil {
+		return nil
+	}
+	result := run.Result
+
+	var incidents []Incident
+	breach := func(expectation, expected, actual string) {
+		incidents = append(incidents, Incident{
+			Schedule:    schedule.Name,
+			URL:         schedule.URL,
+			Expectation: expectation,
+			Expected:    expected,
+			Actual:      actual,
+			DetectedAt:  run.StartedAt,
+		})
+	}
+
+	if expect.Status != 0 && result.StatusCode != expect.Status {
+		actual := strconv.Itoa(result.StatusCode)
+		if result.StatusCode == 0 && result.Error != nil {
+			actual = "no response: " + result.Error.Message
+		}
+		breach("status", strconv.Itoa(expect.Status), actual)
+	}
+
+	// Content expectations can only be judged when the page was analyzed
+	if result.Error != nil {
+		if expect.Status == 0 {
+			breach("analysis", "success", result.Error.Message)
+		}
+		return incidents
+	}
+
+	if expect.MaxBrokenLinks != nil && result.InaccessibleLinks >= *expect.MaxBrokenLinks {
+		breach("max_broken_links", fmt.Sprintf("fewer than %d", *expect.MaxBrokenLinks), strconv.Itoa(result.InaccessibleLinks))
+	}
+	if expect.TitleContains != "" && !strings.Contains(strings.ToLower(result.PageTitle), strings.ToLower(expect.TitleContains)) {
+		breach("title_contains", expect.TitleContains, result.PageTitle)
+	}
+	if expect.LoginForm != nil && result.HasLoginForm != *expect.LoginForm {
+		breach("login_form", strconv.FormatBool(*expect.LoginForm), strconv.FormatBool(result.HasLoginForm))
+	}
+	return incidents
+}
+
+// recordIncidents assigns IDs to new incidents and stores them, returning them
+// with their IDs; the caller must hold the write lock
+func (s *Scheduler) recordIncidents(incidents []Incident) []Incident {
+	for i := range incidents {
+		s.nextIncidentID++
+		incidents[i].ID = s.nextIncidentID
+	}
+	s.incidents = append(s.incidents, incidents...)
+	if excess := len(s.incidents) - MaxIncidents; excess > 0 {
+		s.incidents = append([]Incident(nil), s.incidents[excess:]...)
+	}
+	return incidents
+}
+
+// Incidents returns recorded incidents, newest first, optionally filtered by
+// schedule name and URL
+func (s *Scheduler) Incidents(schedule, url string) []Incident {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	matches := []Incident{}
+	for i := len(s.incidents) - 1; i >= 0; i-- {
+		incident := s.incidents[i]
+		if schedule != "" && incident.Schedule != schedule {
+			continue
+		}
+		if url != "" && incident.URL != url {
+			continue
+		}
+		matches = append(matches, incident)
+	}
+	return matches
+}
@@ -0,0 +1,297 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"web-page-analyzer/analyzer"
+	"web-page-analyzer/logger"
+)
+
+// Scheduler defaults
+const (
+	MinInterval       = time.Minute
+	ScheduledRunLimit = 5 * time.Minute
+)
+
+// EmailSettings configures the report email sent after each scheduled run
+type EmailSettings struct {
+	To []string `json:"to"`
+	// Subject overrides the default "Web page report: <name>" subject
+	Subject string `json:"subject,omitempty"`
+	// AttachReport attaches the full HTML report in addition to the text summary
+	AttachReport bool `json:"attach_report"`
+	// OnlyOnFailure suppresses the email when the analysis succeeded and met its expectations
+	OnlyOnFailure bool `json:"only_on_failure,omitempty"`
+}
+
+// Schedule is a URL analyzed on a fixed interval
+type Schedule struct {
+	Name     string         `json:"name"`
+	URL      string         `json:"url"`
+	Interval string         `json:"interval"`
+	Options  ScheduleOpts   `json:"options"`
+	Email    *EmailSettings `json:"email,omitempty"`
+	// Expect turns on monitoring: runs breaching these expectations are recorded as incidents
+	Expect *Expectations `json:"expect,omitempty"`
+
+	interval time.Duration
+}
+
+// ScheduleOpts selects the optional analysis features for a scheduled run
+type ScheduleOpts struct {
+	SkipLinkCheck   bool `json:"skip_link_check,omitempty"`
+	CompareVariants bool `json:"compare_variants,omitempty"`
+	ExtractContent  bool `json:"extract_content,omitempty"`
+	LookupDomain    bool `json:"whois,omitempty"`
+}
+
+// analysisOptions converts the schedule options to analyzer options
+func (o ScheduleOpts) analysisOptions() analyzer.AnalysisOptions {
+	return analyzer.AnalysisOptions{
+		SkipLinkCheck:   o.SkipLinkCheck,
+		CompareVariants: o.CompareVariants,
+		ExtractContent:  o.ExtractContent,
+		LookupDomain:    o.LookupDomain,
+		// Each run must see the live page for change detection to mean anything
+		CollectLinks: true,
+		BypassCache:  true,
+		Priority:     analyzer.PriorityBatch,
+	}
+}
+
+// validate checks a schedule and parses its interval
+func (s *Schedule) validate() error {
+	if s.URL == "" {
+		return fmt.Errorf("schedule %q: url is required", s.Name)
+	}
+	if s.Name == "" {
+		s.Name = s.URL
+	}
+	interval, err := time.ParseDuration(s.Interval)
+	if err != nil {
+		return fmt.Errorf("schedule %q: invalid interval %q", s.Name, s.Interval)
+	}
+	if interval < MinInterval {
+		return fmt.Errorf("schedule %q: interval must be at least %s", s.Name, MinInterval)
+	}
+	if s.Email != nil && len(s.Email.To) == 0 {
+		return fmt.Errorf("schedule %q: email requires at least one recipient", s.Name)
+	}
+	s.interval = interval
+	return nil
+}
+
+// LoadSchedules reads a JSON array of schedules from a file
+func LoadSchedules(path string) ([]*Schedule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var schedules []*Schedule
+	if err := json.Unmarshal(data, &schedules); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	for _, schedule := range schedules {
+		if err := schedule.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return schedules, nil
+}
+
+// Run is the outcome of one scheduled analysis
+type Run struct {
+	Schedule  string                   `json:"schedule"`
+	StartedAt time.Time                `json:"started_at"`
+	Result    *analyzer.AnalysisResult `json:"result"`
+	Incidents []Incident               `json:"incidents,omitempty"`
+	Change    *Change                  `json:"change,omitempty"`
+	Emailed   bool                     `json:"emailed"`
+}
+
+// Scheduler analyzes configured URLs on their intervals and emails reports
+type Scheduler struct {
+	analyzer  *analyzer.Analyzer
+	client    analyzer.Client // runs the analyses, through the limiter when one is set
+	schedules []*Schedule
+	mailer    Mailer
+	changes   *ChangeLog
+
+	// lease elects the one instance that runs schedules; leader is whether this instance holds it
+	lease  Lease
+	holder string
+	leader atomic.Bool
+
+	mu             sync.RWMutex
+	lastRuns       map[string]*Run
+	incidents      []Incident
+	nextIncidentID int64
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// New creates a scheduler; mailer may be nil when no schedule sends email
+func New(a *analyzer.Analyzer, schedules []*Schedule, mailer Mailer) *Scheduler {
+	return &Scheduler{
+		analyzer:  a,
+		client:    a,
+		schedules: schedules,
+		mailer:    mailer,
+		changes:   NewChangeLog(),
+		holder:    newHolderID(),
+		lastRuns:  make(map[string]*Run),
+		stop:      make(chan struct{}),
+	}
+}
+
+// SetLimiter makes every scheduled analysis take a batch slot of limiter first
+func (s *Scheduler) SetLimiter(limiter analyzer.Limiter) {
+	s.client = analyzer.LimitedClient(s.analyzer, limiter)
+}
+
+// SetChangeLog replaces the in-memory change log, e.g. with one persisted to disk
+func (s *Scheduler) SetChangeLog(changes *ChangeLog) {
+	s.changes = changes
+}
+
+// Changes returns the changes detected between consecutive runs, newest first,
+// optionally filtered by URL
+func (s *Scheduler) Changes(url string) []Change {
+	return s.changes.Changes(url)
+}
+
+// Schedules returns the configured schedules
+func (s *Scheduler) Schedules() []*Schedule {
+	return s.schedules
+}
+
+// Start runs every schedule on its interval until Stop is called. With a lease,
+// runs are skipped unless this instance is the elected leader.
+func (s *Scheduler) Start() {
+	if s.lease != nil && len(s.schedules) > 0 {
+		s.wg.Add(1)
+		go s.elect()
+	}
+	for _, schedule := range s.schedules {
+		s.wg.Add(1)
+		go s.loop(schedule)
+	}
+	if len(s.schedules) > 0 {
+		logger.WithComponent("scheduler").Infow("Scheduler started", "schedules", len(s.schedules))
+	}
+}
+
+// Stop ends all schedule loops and waits for running analyses to finish
+func (s *Scheduler) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+	s.wg.Wait()
+}
+
+// loop runs a schedule each time its interval elapses
+func (s *Scheduler) loop(schedule *Schedule) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(schedule.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !s.IsLeader() {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), ScheduledRunLimit)
+			s.RunNow(ctx, schedule)
+			cancel()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// RunNow analyzes a schedule's URL immediately and sends its report email
+func (s *Scheduler) RunNow(ctx context.Context, schedule *Schedule) *Run {
+	run := &Run{
+		Schedule:  schedule.Name,
+		StartedAt: time.Now().UTC(),
+	}
+	run.Result = s.client.AnalyzeURLWithOptions(ctx, schedule.URL, schedule.Options.analysisOptions())
+
+	s.mu.Lock()
+	run.Incidents = s.recordIncidents(checkExpectations(schedule, run))
+	s.mu.Unlock()
+
+	change, err := s.changes.Record(schedule, run)
+	if err != nil {
+		logger.WithComponent("scheduler").Errorw("Failed to persist change log",
+			"schedule", schedule.Name, "error", err)
+	}
+	if change != nil {
+		run.Change = change
+		if notifier := s.analyzer.Notifier(); notifier != nil {
+			notifier.NotifyChange(schedule.URL, change.Summary())
+		}
+	}
+
+	if s.shouldEmail(schedule, run) {
+		if err := s.mailer.Send(buildReportEmail(schedule, run)); err != nil {
+			logger.WithComponent("scheduler").Errorw("Failed to email scheduled report",
+				"schedule", schedule.Name, "error", err)
+		} else {
+			run.Emailed = true
+		}
+	}
+
+	s.mu.Lock()
+	s.lastRuns[schedule.Name] = run
+	s.mu.Unlock()
+
+	return run
+}
+
+// shouldEmail reports whether a run's report is emailed
+func (s *Scheduler) shouldEmail(schedule *Schedule, run *Run) bool {
+	if schedule.Email == nil || s.mailer == nil {
+		return false
+	}
+	return !schedule.Email.OnlyOnFailure || run.failed()
+}
+
+// failed reports whether the analysis failed or breached an expectation
+func (r *Run) failed() bool {
+	return r.Result.Error != nil || len(r.Incidents) > 0
+}
+
+// Stats describes the scheduler for the metrics endpoint
+type Stats struct {
+	Schedules int    `json:"schedules"`
+	Election  bool   `json:"leader_election"`
+	Leader    bool   `json:"leader"`
+	Holder    string `json:"holder"`
+}
+
+// Stats returns the schedule count and this instance's leadership
+func (s *Scheduler) Stats() Stats {
+	return Stats{
+		Schedules: len(s.schedules),
+		Election:  s.lease != nil,
+		Leader:    s.IsLeader(),
+		Holder:    s.holder,
+	}
+}
+
+// LastRun returns the most recent run of a schedule
+func (s *Scheduler) LastRun(name string) (*Run, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	run, ok := s.lastRuns[name]
+	return run, ok
+}
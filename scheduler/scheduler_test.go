@@ -0,0 +1,475 @@
+package scheduler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"web-page-analyzer/analyzer"
+)
+
+// recordingMailer keeps sent messages instead of delivering them
+type recordingMailer struct {
+	mu   sync.Mutex
+	sent []*Message
+}
+
+func (m *recordingMailer) Send(msg *Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func TestLoadSchedules(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		valid   bool
+	}{
+		{"valid", `[{"name":"home","url":"https://example.com","interval":"168h","email":{"to":["ops@example.com"]}}]`, true},
+		{"missing url", `[{"name":"home","interval":"1h"}]`, false},
+		{"bad interval", `[{"url":"https://example.com","interval":"weekly"}]`, false},
+		{"too frequent", `[{"url":"https://example.com","interval":"10s"}]`, false},
+		{"no recipients", `[{"url":"https://example.com","interval":"1h","email":{"to":[]}}]`, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "schedules.json")
+			os.WriteFile(path, []byte(tc.content), 0o600)
+
+			schedules, err := LoadSchedules(path)
+			if tc.valid && err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !tc.valid && err == nil {
+				t.Fatalf("Expected error for %s", tc.content)
+			}
+			if tc.valid && schedules[0].interval != 168*time.Hour {
+				t.Errorf("Expected interval 168h, got %v", schedules[0].interval)
+			}
+		})
+	}
+}
+
+func TestRunNow_EmailsReport(t *testing.T) {
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Weekly</title></head><body><h1>Hi</h1></body></html>`))
+	}))
+	defer page.Close()
+
+	mailer := &recordingMailer{}
+	schedule := &Schedule{
+		Name:    "weekly",
+		URL:     page.URL,
+		Options: ScheduleOpts{SkipLinkCheck: true},
+		Email:   &EmailSettings{To: []string{"owner@example.com"}, AttachReport: true},
+	}
+	failing := &Schedule{
+		Name:  "failing-only",
+		URL:   page.URL,
+		Email: &EmailSettings{To: []string{"owner@example.com"}, OnlyOnFailure: true},
+	}
+	s := New(analyzer.NewAnalyzer(10*time.Second), []*Schedule{schedule, failing}, mailer)
+
+	run := s.RunNow(context.Background(), schedule)
+	if !run.Emailed || len(mailer.sent) != 1 {
+		t.Fatalf("Expected one report email, got %d", len(mailer.sent))
+	}
+
+	msg := mailer.sent[0]
+	if msg.Subject != "[OK] Web page report: weekly" {
+		t.Errorf("Expected OK subject, got %s", msg.Subject)
+	}
+	if !strings.Contains(msg.Text, "Title: Weekly") {
+		t.Errorf("Expected title in summary, got %s", msg.Text)
+	}
+	if len(msg.Attachments) != 1 || !strings.Contains(string(msg.Attachments[0].Data), "<td>Weekly</td>") {
+		t.Errorf("Expected HTML report attachment, got %+v", msg.Attachments)
+	}
+
+	// Successful runs of failure-only schedules send nothing
+	if run := s.RunNow(context.Background(), failing); run.Emailed {
+		t.Error("Expected no email for a successful failure-only schedule")
+	}
+	if last, ok := s.LastRun("failing-only"); !ok || last.Result.PageTitle != "Weekly" {
+		t.Error("Expected last run to be recorded")
+	}
+}
+
+func TestEncodeMessage(t *testing.T) {
+	data, err := encodeMessage("analyzer@example.com", &Message{
+		To:          []string{"a@example.com", "b@example.com"},
+		Subject:     "Report ✓",
+		Text:        "Summary",
+		Attachments: []Attachment{{Filename: "report.html", ContentType: "text/html", Data: []byte("<p>hi</p>")}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	encoded := string(data)
+	for _, want := range []string{
+		"To: a@example.com, b@example.com\r\n",
+		"Subject: =?utf-8?q?Report_=E2=9C=93?=\r\n",
+		"Content-Type: multipart/mixed; boundary=",
+		"Content-Disposition: attachment; filename=report.html",
+		"PHA+aGk8L3A+",
+	} {
+		if !strings.Contains(encoded, want) {
+			t.Errorf("Expected message to contain %q", want)
+		}
+	}
+}
+
+func TestRunNow_RecordsIncidents(t *testing.T) {
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Store closed</title></head><body></body></html>`))
+	}))
+	defer page.Close()
+
+	maxBroken := 5
+	hasLogin := true
+	monitored := &Schedule{
+		Name:    "store",
+		URL:     page.URL,
+		Options: ScheduleOpts{SkipLinkCheck: true},
+		Expect: &Expectations{
+			Status:         http.StatusOK,
+			MaxBrokenLinks: &maxBroken,
+			TitleContains:  "shop",
+			LoginForm:      &hasLogin,
+		},
+		Email: &EmailSettings{To: []string{"ops@example.com"}, OnlyOnFailure: true},
+	}
+	mailer := &recordingMailer{}
+	s := New(analyzer.NewAnalyzer(10*time.Second), []*Schedule{monitored}, mailer)
+
+	run := s.RunNow(context.Background(), monitored)
+
+	var breached []string
+	for _, incident := range run.Incidents {
+		breached = append(breached, incident.Expectation)
+	}
+	if strings.Join(breached, ",") != "title_contains,login_form" {
+		t.Errorf("Expected title and login form breaches, got %v", breached)
+	}
+	if len(mailer.sent) != 1 || !strings.HasPrefix(mailer.sent[0].Subject, "[BREACH]") {
+		t.Errorf("Expected a breach email for a failure-only schedule, got %d emails", len(mailer.sent))
+	}
+
+	incidents := s.Incidents("store", "")
+	if len(incidents) != 2 || incidents[0].ID != 2 || incidents[1].ID != 1 {
+		t.Errorf("Expected 2 incidents newest first, got %+v", incidents)
+	}
+	if other := s.Incidents("", "https://other.example"); len(other) != 0 {
+		t.Errorf("Expected no incidents for another URL, got %d", len(other))
+	}
+}
+
+// saturatedLimiter never has a free slot
+type saturatedLimiter struct {
+	batch bool
+}
+
+func (l *saturatedLimiter) Acquire(ctx context.Context, batch bool) (func(), bool) {
+	l.batch = batch
+	return nil, false
+}
+
+func TestRunNow_WaitsForLimiter(t *testing.T) {
+	fetched := false
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched = true
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Home</title></head><body></body></html>`))
+	}))
+	defer page.Close()
+
+	schedule := &Schedule{Name: "home", URL: page.URL, Options: ScheduleOpts{SkipLinkCheck: true}}
+	s := New(analyzer.NewAnalyzer(10*time.Second), []*Schedule{schedule}, nil)
+	limiter := &saturatedLimiter{}
+	s.SetLimiter(limiter)
+
+	// A run waits for a batch slot until its time is up, without fetching the page
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	run := s.RunNow(ctx, schedule)
+	if run.Result.Error == nil || run.Result.Error.Code != analyzer.ErrCodeTimeoutError {
+		t.Errorf("Expected a timeout while waiting for a slot, got %+v", run.Result.Error)
+	}
+	if fetched || !limiter.batch {
+		t.Errorf("Expected no fetch before a batch slot was taken, fetched %v (batch %v)", fetched, limiter.batch)
+	}
+}
+
+func TestRunNow_RecordsChanges(t *testing.T) {
+	var mu sync.Mutex
+	body := `<html><head><title>Pricing</title></head><body><a href="/plans">Plans</a><a href="/faq">FAQ</a></body></html>`
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(body))
+	}))
+	defer page.Close()
+
+	var notified []analyzer.Notification
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var notification analyzer.Notification
+		json.NewDecoder(r.Body).Decode(&notification)
+		mu.Lock()
+		notified = append(notified, notification)
+		mu.Unlock()
+	}))
+	defer webhook.Close()
+
+	notifier, err := analyzer.NewNotifier(analyzer.NotificationConfig{
+		Webhooks: []analyzer.Webhook{{URL: webhook.URL}},
+		Rules:    []analyzer.NotificationRule{{Condition: analyzer.ConditionPageChanged}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	a := analyzer.NewAnalyzer(10 * time.Second)
+	a.SetNotifier(notifier)
+
+	path := filepath.Join(t.TempDir(), "changes.json")
+	changes, err := LoadChangeLog(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	schedule := &Schedule{Name: "pricing", URL: page.URL, Options: ScheduleOpts{SkipLinkCheck: true}}
+	s := New(a, []*Schedule{schedule}, nil)
+	s.SetChangeLog(changes)
+
+	// The first run has nothing to compare against, an unchanged page records nothing
+	if run := s.RunNow(context.Background(), schedule); run.Change != nil {
+		t.Errorf("Expected no change on the first run, got %+v", run.Change)
+	}
+	if run := s.RunNow(context.Background(), schedule); run.Change != nil {
+		t.Errorf("Expected no change for an unchanged page, got %+v", run.Change)
+	}
+
+	mu.Lock()
+	body = `<html><head><title>Pricing 2025</title></head><body><a href="/plans">Plans</a><a href="/contact">Contact</a></body></html>`
+	mu.Unlock()
+
+	run := s.RunNow(context.Background(), schedule)
+	if run.Change == nil {
+		t.Fatal("Expected a change after the page was edited")
+	}
+	if len(run.Change.Fields) != 1 || run.Change.Fields[0].Field != "page_title" || run.Change.Fields[0].After != "Pricing 2025" {
+		t.Errorf("Expected only the title to change, got %+v", run.Change.Fields)
+	}
+	if len(run.Change.LinksAdded) != 1 || run.Change.LinksAdded[0] != page.URL+"/contact" {
+		t.Errorf("Expected /contact to be added, got %v", run.Change.LinksAdded)
+	}
+	if len(run.Change.LinksRemoved) != 1 || run.Change.LinksRemoved[0] != page.URL+"/faq" {
+		t.Errorf("Expected /faq to be removed, got %v", run.Change.LinksRemoved)
+	}
+
+	// The change log survives a restart
+	reloaded, err := LoadChangeLog(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if logged := reloaded.Changes(page.URL); len(logged) != 1 || logged[0].ID != 1 {
+		t.Errorf("Expected the persisted change, got %+v", logged)
+	}
+	if other := reloaded.Changes("https://other.example"); len(other) != 0 {
+		t.Errorf("Expected no changes for another URL, got %d", len(other))
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		count := len(notified)
+		mu.Unlock()
+		if count > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(notified) != 1 || notified[0].Condition != analyzer.ConditionPageChanged || !strings.Contains(notified[0].Message, "1 links added") {
+		t.Errorf("Expected one page_changed notification, got %+v", notified)
+	}
+}
+
+// startFakeRedis serves SET NX PX and the lease scripts, honouring expiry
+func startFakeRedis(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	type entry struct {
+		value   string
+		expires time.Time
+	}
+	var mu sync.Mutex
+	data := make(map[string]entry)
+	lookup := func(key string) (string, bool) {
+		e, ok := data[key]
+		if !ok || time.Now().After(e.expires) {
+			return "", false
+		}
+		return e.value, true
+	}
+
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		for {
+			// Commands arrive as RESP arrays of bulk strings
+			header, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			count, _ := strconv.Atoi(strings.TrimSpace(header[1:]))
+			args := make([]string, count)
+			for i := range args {
+				sizeLine, _ := reader.ReadString('\n')
+				size, _ := strconv.Atoi(strings.TrimSpace(sizeLine[1:]))
+				buf := make([]byte, size+2)
+				io.ReadFull(reader, buf)
+				args[i] = string(buf[:size])
+			}
+
+			mu.Lock()
+			reply := "-ERR unknown command\r\n"
+			switch args[0] {
+			case "SET":
+				ttl, _ := strconv.Atoi(args[5])
+				reply = "$-1\r\n"
+				if _, held := lookup(args[1]); !held {
+					data[args[1]] = entry{args[2], time.Now().Add(time.Duration(ttl) * time.Millisecond)}
+					reply = "+OK\r\n"
+				}
+			case "EVAL":
+				key, holder := args[3], args[4]
+				reply = ":0\r\n"
+				if owner, held := lookup(key); held && owner == holder {
+					if args[1] == renewScript {
+						ttl, _ := strconv.Atoi(args[5])
+						data[key] = entry{holder, time.Now().Add(time.Duration(ttl) * time.Millisecond)}
+					} else {
+						delete(data, key)
+					}
+					reply = ":1\r\n"
+				}
+			}
+			mu.Unlock()
+			conn.Write([]byte(reply))
+		}
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestRedisLease(t *testing.T) {
+	client, err := analyzer.NewRedisClient("redis://" + startFakeRedis(t))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer client.Close()
+	lease := NewRedisLease(client, "")
+	ctx := context.Background()
+
+	if ok, err := lease.Acquire(ctx, "a", time.Minute); err != nil || !ok {
+		t.Fatalf("Expected a to acquire the free lease, got %v (%v)", ok, err)
+	}
+	if ok, _ := lease.Acquire(ctx, "b", time.Minute); ok {
+		t.Error("Expected b to be refused while a holds the lease")
+	}
+	if ok, _ := lease.Acquire(ctx, "a", time.Minute); !ok {
+		t.Error("Expected a to renew its own lease")
+	}
+
+	// Releasing by a non-holder is a no-op; the holder's release frees it at once
+	lease.Release(ctx, "b")
+	if ok, _ := lease.Acquire(ctx, "b", time.Minute); ok {
+		t.Error("Expected b's release not to free a's lease")
+	}
+	lease.Release(ctx, "a")
+	if ok, _ := lease.Acquire(ctx, "b", 50*time.Millisecond); !ok {
+		t.Error("Expected b to acquire the released lease")
+	}
+
+	// An expired lease fails over to another holder
+	time.Sleep(100 * time.Millisecond)
+	if ok, _ := lease.Acquire(ctx, "a", time.Minute); !ok {
+		t.Error("Expected a to take over the expired lease")
+	}
+}
+
+func TestLeaderElection(t *testing.T) {
+	client, err := analyzer.NewRedisClient("redis://" + startFakeRedis(t))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer client.Close()
+
+	schedule := &Schedule{Name: "home", URL: "http://127.0.0.1:1", Interval: "1h", interval: time.Hour}
+	first := New(analyzer.NewAnalyzer(time.Second), []*Schedule{schedule}, nil)
+	second := New(analyzer.NewAnalyzer(time.Second), []*Schedule{schedule}, nil)
+	if !first.IsLeader() {
+		t.Error("Expected a scheduler without a lease to run its schedules")
+	}
+	first.SetLease(NewRedisLease(client, ""))
+	second.SetLease(NewRedisLease(client, ""))
+
+	first.Start()
+	waitFor(t, first.IsLeader)
+	second.campaign()
+	if second.IsLeader() {
+		t.Fatal("Expected only one leader")
+	}
+
+	// Stopping the leader releases the lease so the other instance takes over
+	first.Stop()
+	if first.IsLeader() {
+		t.Error("Expected a stopped scheduler to step down")
+	}
+	second.campaign()
+	if !second.IsLeader() || !second.Stats().Leader {
+		t.Error("Expected the second instance to take over")
+	}
+}
+
+// waitFor polls a condition for up to five seconds
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
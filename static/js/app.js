@@ -11,8 +11,13 @@ document.addEventListener('DOMContentLoaded', function() {
     const resultsDiv = document.getElementById('results');
     const urlHelp = document.getElementById('url-help');
     
+    // Load UI strings for the language the page was rendered in
+    const i18n = new I18n(document.documentElement.lang);
+    i18n.load();
+    const t = (key, fallback) => i18n.t(key, fallback);
+
     // Initialize the results renderer
-    const resultsRenderer = new ResultsRenderer(resultsDiv);
+    const resultsRenderer = new ResultsRenderer(resultsDiv, t);
 
     // Form submission handler
     analyzeForm.addEventListener('submit', async function(e) {
@@ -20,7 +25,7 @@ document.addEventListener('DOMContentLoaded', function() {
         
         const url = urlInput.value.trim();
         if (!url) {
-            resultsRenderer.renderError('Please enter a valid URL');
+            resultsRenderer.renderError(t('error_invalid_url', 'Please enter a valid URL'));
             return;
         }
         
@@ -28,7 +33,7 @@ document.addEventListener('DOMContentLoaded', function() {
         setButtonLoading(true);
         
         // Update help text to show processing state
-        updateHelpText('Analyzing the web page, please wait...');
+        updateHelpText(t('status_analyzing', 'Analyzing the web page, please wait...'));
         
         // Show results container with loading state
         resultsRenderer.show();
@@ -50,12 +55,12 @@ document.addEventListener('DOMContentLoaded', function() {
             const result = await response.json();
             resultsRenderer.renderResults(result);
             // Update help text to show success
-            updateHelpText('Analysis completed successfully!');
+            updateHelpText(t('status_success', 'Analysis completed successfully!'));
         } catch (error) {
             console.error('Analysis error:', error);
-            resultsRenderer.renderError(`Error: Failed to analyze the page. ${error.message}`);
+            resultsRenderer.renderError(`${t('error_analysis_failed', 'Error: Failed to analyze the page.')} ${error.message}`);
             // Update help text to show error
-            updateHelpText('Analysis failed. Please try again.');
+            updateHelpText(t('status_failed', 'Analysis failed. Please try again.'));
         } finally {
             // Reset button state
             setButtonLoading(false);
@@ -66,8 +71,8 @@ document.addEventListener('DOMContentLoaded', function() {
      * Set button loading state using data attributes
      */
     function setButtonLoading(loading) {
-        const loadingText = submitBtn.dataset.loadingText || 'Analyzing...';
-        const defaultText = submitBtn.dataset.defaultText || 'Analyze Page';
+        const loadingText = submitBtn.dataset.loadingText || t('analyzing_button', 'Analyzing...');
+        const defaultText = submitBtn.dataset.defaultText || t('analyze_button', 'Analyze Page');
         
         if (loading) {
             submitBtn.disabled = true;
@@ -87,24 +92,24 @@ document.addEventListener('DOMContentLoaded', function() {
         this.parentElement.classList.add('focused');
         // Show contextual help when focused
         if (this.value.trim() === '') {
-            updateHelpText('Enter a valid web address to analyze');
+            updateHelpText(t('url_help', 'Enter a valid web address to analyze'));
         } else {
-            updateHelpText('Press Enter or click Analyze to start analysis');
+            updateHelpText(t('url_help_ready', 'Press Enter or click Analyze to start analysis'));
         }
     });
 
     urlInput.addEventListener('blur', function() {
         this.parentElement.classList.remove('focused');
         // Reset to default help text when not focused
-        updateHelpText('Enter a valid web address to analyze');
+        updateHelpText(t('url_help', 'Enter a valid web address to analyze'));
     });
 
     urlInput.addEventListener('input', function() {
         // Update help text based on input
         if (this.value.trim() === '') {
-            updateHelpText('Enter a valid web address to analyze');
+            updateHelpText(t('url_help', 'Enter a valid web address to analyze'));
         } else {
-            updateHelpText('Press Enter or click Analyze to start analysis');
+            updateHelpText(t('url_help_ready', 'Press Enter or click Analyze to start analysis'));
         }
     });
 
@@ -122,7 +127,7 @@ document.addEventListener('DOMContentLoaded', function() {
         if (e.key === 'Escape') {
             urlInput.value = '';
             resultsRenderer.hide();
-            updateHelpText('Enter a valid web address to analyze');
+            updateHelpText(t('url_help', 'Enter a valid web address to analyze'));
             urlInput.focus();
         }
     });
@@ -0,0 +1,31 @@
+/**
+ * I18n - Loads UI strings for the page language from /i18n/{lang}.json
+ */
+class I18n {
+    constructor(lang) {
+        this.lang = lang || 'en';
+        this.messages = {};
+    }
+
+    /**
+     * Fetch the catalog; on failure the English fallbacks passed to t() are used
+     */
+    async load() {
+        try {
+            const response = await fetch(`/i18n/${encodeURIComponent(this.lang)}.json`);
+            if (response.ok) {
+                this.messages = await response.json();
+            }
+        } catch (error) {
+            console.error('Failed to load translations:', error);
+        }
+        return this;
+    }
+
+    /**
+     * Translate a message ID, falling back to the given text
+     */
+    t(key, fallback) {
+        return this.messages[key] || fallback || key;
+    }
+}
@@ -2,8 +2,9 @@
  * ResultsRenderer - Handles rendering of analysis results using HTML templates
  */
 class ResultsRenderer {
-    constructor(container) {
+    constructor(container, translate) {
         this.container = container;
+        this.t = translate || ((key, fallback) => fallback);
         this.templates = this.loadTemplates();
     }
     
@@ -65,9 +66,9 @@ class ResultsRenderer {
             
             // Handle special cases
             if (key === 'page_title') {
-                field.textContent = value || 'No title found';
+                field.textContent = value || this.t('no_title', 'No title found');
             } else if (key === 'login_form') {
-                field.textContent = value ? 'Yes' : 'No';
+                field.textContent = value ? this.t('yes', 'Yes') : this.t('no', 'No');
             } else if (key === 'headings') {
                 // Headings are handled separately by renderHeadings
                 return;
@@ -75,7 +76,7 @@ class ResultsRenderer {
                 // Links are handled separately by renderLinks
                 return;
             } else {
-                field.textContent = value || 'N/A';
+                field.textContent = value || this.t('not_available', 'N/A');
             }
         });
     }
@@ -88,7 +89,10 @@ class ResultsRenderer {
         if (!headingsField) return;
         
         if (!headingCounts || Object.keys(headingCounts).length === 0) {
-            headingsField.innerHTML = '<em>No headings found</em>';
+            headingsField.innerHTML = '';
+            const empty = document.createElement('em');
+            empty.textContent = this.t('no_headings', 'No headings found');
+            headingsField.appendChild(empty);
             return;
         }
         
@@ -113,9 +117,9 @@ class ResultsRenderer {
         if (!linksField) return;
         
         linksField.innerHTML = `
-            <strong>Internal:</strong> ${data.internal_links}<br>
-            <strong>External:</strong> ${data.external_links}<br>
-            <strong>Inaccessible:</strong> ${data.inaccessible_links}
+            <strong>${this.t('links_internal', 'Internal')}:</strong> ${data.internal_links}<br>
+            <strong>${this.t('links_external', 'External')}:</strong> ${data.external_links}<br>
+            <strong>${this.t('links_inaccessible', 'Inaccessible')}:</strong> ${data.inaccessible_links}
         `;
     }
     
@@ -0,0 +1,248 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"web-page-analyzer/logger"
+)
+
+// Export defaults and limits
+const (
+	DefaultServiceName = "web-page-analyzer"
+	BatchSize          = 512              // spans sent per export request
+	BatchInterval      = 5 * time.Second  // a partial batch is sent after this long
+	MaxQueued          = 4096             // spans waiting for export; more are dropped
+	ExportTimeout      = 10 * time.Second // an export request is abandoned after this long
+)
+
+// exporter batches ended spans and posts them to an OTLP/HTTP endpoint as JSON
+type exporter struct {
+	endpoint string
+	service  string
+	headers  map[string]string
+	client   *http.Client
+
+	queue chan *Span
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// newExporter starts an exporter sending to endpoint
+func newExporter(endpoint, service string, headers map[string]string) *exporter {
+	e := &exporter{
+		endpoint: endpoint,
+		service:  service,
+		headers:  headers,
+		client:   &http.Client{Timeout: ExportTimeout},
+		queue:    make(chan *Span, MaxQueued),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// enqueue queues an ended span, dropping it when the queue is full rather than
+// slowing down the analysis
+func (e *exporter) enqueue(span *Span) {
+	select {
+	case e.queue <- span:
+	default:
+	}
+}
+
+// run exports full batches as they fill and partial ones every BatchInterval
+func (e *exporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(BatchInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, BatchSize)
+	flush := func() {
+		if len(batch) > 0 {
+			e.export(batch)
+			batch = batch[:0]
+		}
+	}
+	for {
+		select {
+		case span := <-e.queue:
+			batch = append(batch, span)
+			if len(batch) == BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.stop:
+			for {
+				select {
+				case span := <-e.queue:
+					batch = append(batch, span)
+					if len(batch) == BatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// shutdown exports the queued spans and stops the exporter
+func (e *exporter) shutdown(ctx context.Context) error {
+	close(e.stop)
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// export posts a batch of spans
+func (e *exporter) export(batch []*Span) {
+	body, err := json.Marshal(e.request(batch))
+	if err != nil {
+		logger.WithComponent("tracing").Warnw("Failed to encode spans", "error", err)
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		logger.WithComponent("tracing").Warnw("Invalid OTLP endpoint", "endpoint", e.endpoint, "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		logger.WithComponent("tracing").Warnw("Failed to export spans", "endpoint", e.endpoint, "spans", len(batch), "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		logger.WithComponent("tracing").Warnw("Span export rejected", "endpoint", e.endpoint, "spans", len(batch), "status", resp.StatusCode)
+	}
+}
+
+// OTLP/HTTP JSON encoding of an export request. IDs are hex, and 64-bit
+// integers are strings, as the OTLP JSON mapping requires.
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+// otlpStatus codes: 0 unset, 2 error
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+// request builds the export request for a batch
+func (e *exporter) request(batch []*Span) otlpRequest {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, span := range batch {
+		span.mu.Lock()
+		encoded := otlpSpan{
+			TraceID:           hex.EncodeToString(span.context.TraceID[:]),
+			SpanID:            hex.EncodeToString(span.context.SpanID[:]),
+			Name:              span.name,
+			Kind:              span.kind,
+			StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+			Attributes:        otlpAttributes(span.attributes),
+		}
+		if span.parent != (SpanID{}) {
+			encoded.ParentSpanID = hex.EncodeToString(span.parent[:])
+		}
+		if span.failed {
+			encoded.Status = otlpStatus{Code: 2, Message: span.message}
+		}
+		span.mu.Unlock()
+		spans = append(spans, encoded)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: otlpAttributes([]Attribute{String("service.name", e.service)})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: DefaultServiceName}, Spans: spans}},
+	}}}
+}
+
+// otlpAttributes encodes attributes with their typed values
+func otlpAttributes(attributes []Attribute) []otlpAttribute {
+	encoded := make([]otlpAttribute, 0, len(attributes))
+	for _, attribute := range attributes {
+		var value otlpValue
+		switch v := attribute.Value.(type) {
+		case string:
+			value.StringValue = &v
+		case int:
+			s := strconv.Itoa(v)
+			value.IntValue = &s
+		case int64:
+			s := strconv.FormatInt(v, 10)
+			value.IntValue = &s
+		case float64:
+			value.DoubleValue = &v
+		case bool:
+			value.BoolValue = &v
+		default:
+			s := fmt.Sprint(v)
+			value.StringValue = &s
+		}
+		encoded = append(encoded, otlpAttribute{Key: attribute.Key, Value: value})
+	}
+	return encoded
+}
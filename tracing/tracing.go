@@ -0,0 +1,249 @@
+// Package tracing records spans of the analysis pipeline and exports them over
+// OTLP/HTTP to an OpenTelemetry collector, Jaeger or Tempo, so the fetch, parse
+// and link checks of a single analysis can be followed on one timeline. Trace
+// context arrives in the W3C traceparent header. Tracing stays off until an
+// OTLP endpoint is configured, and spans then cost nothing.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Span kinds, numbered as in OTLP
+const (
+	KindInternal = 1
+	KindServer   = 2
+	KindClient   = 3
+)
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+// SpanContext is the part of a span that is propagated to its children
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid reports whether both IDs are set
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Attribute is a span attribute; its value is a string, int, int64, float64 or bool
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// String returns a string attribute
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int returns an integer attribute
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Bool returns a boolean attribute
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Span is one timed operation. Spans are nil while tracing is off, and every
+// method of a nil Span does nothing.
+type Span struct {
+	exporter *exporter
+	name     string
+	kind     int
+	context  SpanContext
+	parent   SpanID
+	start    time.Time
+
+	mu         sync.Mutex
+	end        time.Time
+	attributes []Attribute
+	failed     bool
+	message    string
+	ended      bool
+}
+
+// spanContextKey holds the SpanContext of the current span in a context
+type spanContextKey struct{}
+
+// active is the exporter spans are sent to; nil while tracing is off
+var active atomic.Pointer[exporter]
+
+// Enabled reports whether spans are being recorded
+func Enabled() bool {
+	return active.Load() != nil
+}
+
+// Start begins a span as a child of the span in ctx, which may be a remote
+// parent taken from an incoming request, or as the root of a new trace. It
+// returns a context carrying the span; End must be called once the operation
+// finishes.
+func Start(ctx context.Context, name string, kind int, attributes ...Attribute) (context.Context, *Span) {
+	exp := active.Load()
+	if exp == nil {
+		return ctx, nil
+	}
+
+	span := &Span{exporter: exp, name: name, kind: kind, start: time.Now(), attributes: attributes}
+	if parent := SpanContextFromContext(ctx); parent.IsValid() {
+		span.context.TraceID = parent.TraceID
+		span.context.Sampled = parent.Sampled
+		span.parent = parent.SpanID
+	} else {
+		// Root spans are always sampled
+		rand.Read(span.context.TraceID[:])
+		span.context.Sampled = true
+	}
+	rand.Read(span.context.SpanID[:])
+	return context.WithValue(ctx, spanContextKey{}, span.context), span
+}
+
+// SpanContextFromContext returns the SpanContext of the current span in ctx,
+// which is invalid when there is none
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc
+}
+
+// SetAttributes adds attributes to the span
+func (s *Span) SetAttributes(attributes ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes = append(s.attributes, attributes...)
+}
+
+// SetError marks the span as failed with a description of the failure
+func (s *Span) SetError(message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed = true
+	s.message = message
+}
+
+// End finishes the span and queues it for export; later calls do nothing, so
+// End may also be deferred as a fallback for early returns
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	if s.context.Sampled {
+		s.exporter.enqueue(s)
+	}
+}
+
+// Extract returns a context carrying the remote parent named by a request's
+// traceparent header, so spans started with it continue the caller's trace.
+// A missing or malformed header leaves ctx unchanged.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	if !Enabled() {
+		return ctx
+	}
+	if sc, ok := parseTraceParent(header.Get("traceparent")); ok {
+		return context.WithValue(ctx, spanContextKey{}, sc)
+	}
+	return ctx
+}
+
+// parseTraceParent parses a W3C traceparent value: version, trace ID, parent
+// span ID and flags as hex, separated by dashes
+func parseTraceParent(value string) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	// Later versions may append fields; version ff is forbidden
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, false
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, sc.IsValid()
+}
+
+// Init enables tracing when OTEL_EXPORTER_OTLP_TRACES_ENDPOINT names a
+// collector's trace endpoint, or OTEL_EXPORTER_OTLP_ENDPOINT its base URL.
+// OTEL_SERVICE_NAME names the service, and OTEL_EXPORTER_OTLP_HEADERS adds
+// comma-separated key=value headers, such as credentials, to every export.
+func Init() {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+	}
+	if endpoint == "" {
+		return
+	}
+
+	service := os.Getenv("OTEL_SERVICE_NAME")
+	if service == "" {
+		service = DefaultServiceName
+	}
+	headers := make(map[string]string)
+	for _, entry := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if key, value, ok := strings.Cut(entry, "="); ok {
+			headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	Enable(endpoint, service, headers)
+}
+
+// Enable starts exporting spans to an OTLP/HTTP trace endpoint, replacing any
+// earlier exporter
+func Enable(endpoint, service string, headers map[string]string) {
+	if previous := active.Swap(newExporter(endpoint, service, headers)); previous != nil {
+		previous.shutdown(context.Background())
+	}
+}
+
+// Shutdown turns tracing off and exports the spans still queued, waiting until
+// ctx is done at most
+func Shutdown(ctx context.Context) error {
+	if exp := active.Swap(nil); exp != nil {
+		return exp.shutdown(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		valid   bool
+		sampled bool
+	}{
+		{"sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"not sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		{"future version with extra field", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true, true},
+		{"empty", "", false, false},
+		{"forbidden version", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"version 00 with extra field", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false, false},
+		{"zero trace ID", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"zero span ID", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false, false},
+		{"short trace ID", "00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01", false, false},
+		{"not hex", "00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, ok := parseTraceParent(tt.value)
+			if ok != tt.valid {
+				t.Fatalf("Expected valid %v, got %v", tt.valid, ok)
+			}
+			if ok && sc.Sampled != tt.sampled {
+				t.Errorf("Expected sampled %v, got %v", tt.sampled, sc.Sampled)
+			}
+		})
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	ctx := context.Background()
+	spanCtx, span := Start(ctx, "noop", KindInternal)
+	if span != nil || spanCtx != ctx {
+		t.Fatalf("Expected no span while tracing is off")
+	}
+	// A nil span ignores every call
+	span.SetAttributes(String("key", "value"))
+	span.SetError("failed")
+	span.End()
+
+	header := http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}
+	if SpanContextFromContext(Extract(ctx, header)).IsValid() {
+		t.Errorf("Expected no remote parent while tracing is off")
+	}
+}
+
+// collector is a fake OTLP/HTTP trace endpoint
+type collector struct {
+	mu       sync.Mutex
+	requests []otlpRequest
+	headers  http.Header
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request otlpRequest
+	json.NewDecoder(r.Body).Decode(&request)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, request)
+	c.headers = r.Header.Clone()
+}
+
+func (c *collector) spans() map[string]otlpSpan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	spans := make(map[string]otlpSpan)
+	for _, request := range c.requests {
+		for _, resource := range request.ResourceSpans {
+			for _, scope := range resource.ScopeSpans {
+				for _, span := range scope.Spans {
+					spans[span.Name] = span
+				}
+			}
+		}
+	}
+	return spans
+}
+
+func TestExport(t *testing.T) {
+	received := &collector{}
+	server := httptest.NewServer(received)
+	defer server.Close()
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", server.URL+"/")
+	t.Setenv("OTEL_SERVICE_NAME", "analyzer-test")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "Authorization=Bearer secret, X-Tenant=web")
+	Init()
+	defer Shutdown(context.Background())
+
+	header := http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}
+	ctx, parent := Start(Extract(context.Background(), header), "GET", KindServer, String("url.path", "/analyze"))
+	_, child := Start(ctx, "fetch", KindClient)
+	child.SetAttributes(Int("http.response.status_code", 503), Bool("retried", false))
+	child.SetError("service unavailable")
+	child.End()
+	child.End()
+	parent.End()
+
+	// Unsampled traces are not exported
+	header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00")
+	_, unsampled := Start(Extract(context.Background(), header), "unsampled", KindServer)
+	unsampled.End()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := Shutdown(shutdownCtx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if Enabled() {
+		t.Errorf("Expected tracing to be off after shutdown")
+	}
+
+	spans := received.spans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 exported spans, got %d: %+v", len(spans), spans)
+	}
+	root, fetch := spans["GET"], spans["fetch"]
+	if root.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || root.ParentSpanID != "00f067aa0ba902b7" {
+		t.Errorf("Expected the server span to continue the remote trace, got %+v", root)
+	}
+	if fetch.TraceID != root.TraceID || fetch.ParentSpanID != root.SpanID || fetch.Kind != KindClient {
+		t.Errorf("Expected fetch to be a client child of the server span, got %+v", fetch)
+	}
+	if fetch.Status.Code != 2 || fetch.Status.Message != "service unavailable" {
+		t.Errorf("Expected an error status on fetch, got %+v", fetch.Status)
+	}
+	if len(fetch.Attributes) != 2 || *fetch.Attributes[0].Value.IntValue != "503" || *fetch.Attributes[1].Value.BoolValue {
+		t.Errorf("Expected typed attributes on fetch, got %+v", fetch.Attributes)
+	}
+	if spanID, _ := hex.DecodeString(root.SpanID); len(spanID) != 8 {
+		t.Errorf("Expected an 8-byte span ID, got %q", root.SpanID)
+	}
+
+	received.mu.Lock()
+	defer received.mu.Unlock()
+	if service := received.requests[0].ResourceSpans[0].Resource.Attributes[0]; *service.Value.StringValue != "analyzer-test" {
+		t.Errorf("Expected service.name analyzer-test, got %+v", service)
+	}
+	if received.headers.Get("Authorization") != "Bearer secret" || received.headers.Get("X-Tenant") != "web" {
+		t.Errorf("Expected the configured export headers, got %v", received.headers)
+	}
+}